@@ -2,26 +2,134 @@ package commands
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
-	"github.com/dokku/docker-orchestrate/internal"
+	"github.com/dokku/docker-orchestrate/pkg/orchestrate"
 	"github.com/josegonzalez/cli-skeleton/command"
 	"github.com/posener/complete"
+	"github.com/rs/zerolog"
 	flag "github.com/spf13/pflag"
 )
 
 type DeployCommand struct {
 	command.Meta
 
-	containerNameTemplate string
-	file                  string
-	profiles              []string
-	projectDirectory      string
-	projectName           string
-	replicas              int
-	skipDatabases         bool
+	allowZero              bool
+	atomic                 bool
+	build                  bool
+	canary                 int
+	command                string
+	compatibility          bool
+	config                 string
+	containerNameTemplate  string
+	continueOnError        bool
+	defaultHealthcheck     string
+	diff                   bool
+	drainCommand           string
+	dumpComposeConfig      string
+	entrypoint             string
+	envFromContainer       []string
+	eventsFile             string
+	failFast               bool
+	failureLogLines        int
+	file                   string
+	healthcheckCommandFile string
+	healthStartPeriod      string
+	ignoreDepFailures      bool
+	image                  string
+	index                  int
+	inheritLabels          []string
+	interleave             []string
+	keepOld                bool
+	logLevel               string
+	maxOldContainers       int
+	metricsAddr            string
+	minFreeDisk            string
+	noBuild                bool
+	noRename               bool
+	onlyNew                bool
+	otelEndpoint           string
+	parallelismBudget      int
+	pinRollbackImage       string
+	profiles               []string
+	promote                bool
+	projectLabel           string
+	projectDirectory       string
+	projectName            string
+	pullParallel           int
+	pullProgress           bool
+	purgeState             bool
+	quietPull              bool
+	recreate               bool
+	recreateAnonVolumes    bool
+	replicas               int
+	replicasDelta          string
+	replicasFile           string
+	replicasFromLabel      string
+	replicasMax            int
+	replicasMin            int
+	revision               string
+	scaleDownKeep          string
+	selectImage            string
+	selector               string
+	skipDatabases          bool
+	skipPullFor            []string
+	stopGracePeriod        string
+	summaryFormat          string
+	teardownOnFailure      bool
+	timeoutOverall         string
+	timeoutPerContainer    string
+	verifyGraph            bool
+	verifyImageExists      bool
+	waitForDependencies    string
+	waitForImages          []string
+	waitForImagesTimeout   string
+	warningsAsErrors       bool
+}
+
+// deployFlagRules are the relationships between flags checked once the flags are parsed
+var deployFlagRules = []orchestrate.FlagRule{
+	{Flag: "allow-zero", ConflictsWith: []string{"canary", "replicas-min"}, Requires: []string{"replicas"}, RequiresService: true},
+	{Flag: "atomic", ConflictsWith: []string{"continue-on-error", "keep-old"}, ForbidsService: true},
+	{Flag: "build", ConflictsWith: []string{"no-build"}, ForbidsService: true},
+	{Flag: "canary", ConflictsWith: []string{"promote"}, RequiresService: true},
+	{Flag: "command", RequiresService: true},
+	{Flag: "continue-on-error", ForbidsService: true},
+	{Flag: "diff", ConflictsWith: []string{"atomic", "canary", "index", "promote"}},
+	{Flag: "entrypoint", RequiresService: true},
+	{Flag: "env-from-container", RequiresService: true},
+	{Flag: "healthcheck-command-file", RequiresService: true},
+	{Flag: "ignore-dependency-failures", ForbidsService: true, Requires: []string{"continue-on-error"}},
+	{Flag: "image", ConflictsWith: []string{"file"}, RequiresService: true},
+	{Flag: "index", ConflictsWith: []string{"canary", "keep-old", "no-rename", "promote", "replicas", "replicas-max", "replicas-min"}, RequiresService: true},
+	{Flag: "interleave", ConflictsWith: []string{"atomic"}, ForbidsService: true},
+	{Flag: "keep-old", ConflictsWith: []string{"max-old-containers"}},
+	{Flag: "min-free-disk", ForbidsService: true},
+	{Flag: "no-build", ForbidsService: true},
+	{Flag: "only-new", ConflictsWith: []string{"atomic", "canary", "index", "promote", "recreate"}},
+	{Flag: "parallelism-budget", ForbidsService: true},
+	{Flag: "pin-rollback-image", RequiresService: true},
+	{Flag: "promote", RequiresService: true},
+	{Flag: "pull-parallel", ForbidsService: true},
+	{Flag: "pull-progress", ConflictsWith: []string{"quiet-pull"}, Requires: []string{"pull-parallel"}},
+	{Flag: "recreate", ConflictsWith: []string{"canary", "index", "promote"}},
+	{Flag: "replicas", RequiresService: true},
+	{Flag: "replicas-delta", ConflictsWith: []string{"allow-zero", "canary", "index", "replicas"}, RequiresService: true},
+	{Flag: "replicas-from-label", ConflictsWith: []string{"replicas-file"}},
+	{Flag: "replicas-max", RequiresService: true},
+	{Flag: "replicas-min", RequiresService: true},
+	{Flag: "select", ForbidsService: true},
+	{Flag: "select-by-image", ForbidsService: true},
+	{Flag: "summary-format", ForbidsService: true},
+	{Flag: "teardown-on-failure", ForbidsService: true},
+	{Flag: "timeout-health", ConflictsWith: []string{"timeout-per-container"}},
+	{Flag: "timeout-overall", ForbidsService: true},
+	{Flag: "verify-graph", ForbidsService: true},
+	{Flag: "wait-for-images-timeout", Requires: []string{"wait-for-images"}},
 }
 
 func (c *DeployCommand) Name() string {
@@ -39,8 +147,16 @@ func (c *DeployCommand) Help() string {
 func (c *DeployCommand) Examples() map[string]string {
 	appName := os.Getenv("CLI_APP_NAME")
 	return map[string]string{
-		"Deploy the entire Compose project": fmt.Sprintf("%s %s", appName, c.Name()),
-		"Deploy a specific service":         fmt.Sprintf("%s %s web", appName, c.Name()),
+		"Deploy the entire Compose project":              fmt.Sprintf("%s %s", appName, c.Name()),
+		"Deploy a specific service":                      fmt.Sprintf("%s %s web", appName, c.Name()),
+		"Deploy services matching a selector":            fmt.Sprintf("%s %s --select 'profile in (web,worker) and not label:batch'", appName, c.Name()),
+		"Deploy a canary container of a service":         fmt.Sprintf("%s %s web --canary 1", appName, c.Name()),
+		"Replace a single container of a service":        fmt.Sprintf("%s %s web --index 2", appName, c.Name()),
+		"Deploy every service using an image":            fmt.Sprintf("%s %s --select-by-image registry.example.com/myapp", appName, c.Name()),
+		"Deploy the project with a JSON summary":         fmt.Sprintf("%s %s --summary-format json", appName, c.Name()),
+		"Pin a known-good rollback image of a service":   fmt.Sprintf("%s %s web --pin-rollback-image registry.example.com/web:1.4.2", appName, c.Name()),
+		"Deploy a service with an overridden entrypoint": fmt.Sprintf("%s %s web --entrypoint /bin/sh --command '-c \"sleep infinity\"'", appName, c.Name()),
+		"Deploy an image without a compose file":         fmt.Sprintf("%s %s web --image nginx:alpine --replicas 2", appName, c.Name()),
 	}
 }
 
@@ -66,12 +182,77 @@ func (c *DeployCommand) ParsedArguments(args []string) (map[string]command.Argum
 func (c *DeployCommand) FlagSet() *flag.FlagSet {
 	f := c.Meta.FlagSet(c.Name(), command.FlagSetClient)
 	f.IntVar(&c.replicas, "replicas", 0, "the number of replicas to deploy")
+	f.StringVar(&c.replicasDelta, "replicas-delta", "", "adjust the replica count relative to the running containers, such as +2 or -1")
+	f.BoolVar(&c.allowZero, "allow-zero", false, "allow --replicas 0 to stop every container of the service")
+	f.StringVar(&c.replicasFile, "replicas-file", "", "the path to a JSON or YAML file mapping service names to replica counts")
+	f.StringVar(&c.replicasFromLabel, "replicas-from-label", "", "a container label holding the desired replica count, read off the existing containers of each service")
+	f.IntVar(&c.replicasMax, "replicas-max", 0, "the maximum number of replicas to deploy")
+	f.IntVar(&c.replicasMin, "replicas-min", 0, "the minimum number of replicas to deploy")
+	f.StringVar(&c.revision, "revision", "", "the source revision being deployed, stamped on the new containers (defaults to $GIT_SHA or $SOURCE_COMMIT)")
+	f.StringVar(&c.scaleDownKeep, "scale-down-keep", "newest", "which containers a scale down keeps (newest, oldest, healthy)")
 	f.StringSliceVar(&c.profiles, "profile", []string{}, "one or more profiles to enable")
-	f.StringVar(&c.containerNameTemplate, "container-name-template", "{{.ProjectName}}-{{.ServiceName}}-{{.InstanceID}}", "the template for the container name")
+	f.BoolVar(&c.atomic, "atomic", false, "create and health-verify the new containers of every service before stopping any old container")
+	f.BoolVar(&c.build, "build", false, "build the images of services with a build section before deploying the project")
+	f.IntVar(&c.canary, "canary", 0, "deploy this many new containers alongside the existing ones without replacing any")
+	f.StringVar(&c.command, "command", "", "override the command of the service for this deploy")
+	f.BoolVar(&c.compatibility, "compatibility", false, "translate swarm deploy keys into container-level settings")
+	f.StringVar(&c.config, "config", "", "the path to a YAML file providing default flag values (defaults to .orchestrate.yaml in the project directory)")
+	f.StringVar(&c.containerNameTemplate, "container-name-template", orchestrate.DefaultContainerNameTemplate, "the template for the container name")
+	f.BoolVar(&c.continueOnError, "continue-on-error", false, "keep deploying the remaining services when a service fails, skipping only the services depending on it")
+	f.StringVar(&c.defaultHealthcheck, "default-healthcheck-command", "", "the host healthcheck command of services without a healthcheck of their own")
+	f.BoolVar(&c.diff, "diff", false, "print how a deploy would change the running containers of each service and exit without changing anything")
+	f.StringVar(&c.drainCommand, "drain-command", "", "a host command run for each container just before it is stopped, such as to deregister it from a load balancer")
+	f.StringVar(&c.dumpComposeConfig, "dump-compose-config", "", "write the resolved compose config to the specified path before deploying")
+	f.StringVar(&c.entrypoint, "entrypoint", "", "override the entrypoint of the service for this deploy")
+	f.StringSliceVar(&c.envFromContainer, "env-from-container", []string{}, "an environment variable to copy off a running container onto the new containers, in the form service:KEY")
+	f.StringVar(&c.eventsFile, "events-file", "", "write the structured deploy events as JSON lines to the specified path")
+	f.BoolVar(&c.failFast, "fail-fast", true, "abort a failed scale-up batch with its first failure, rather than reporting every failed container")
+	f.IntVar(&c.failureLogLines, "failure-log-lines", 50, "the number of trailing log lines printed for each container that fails its healthcheck")
 	f.StringVar(&c.file, "file", "", "the path to the Compose file")
+	f.StringVar(&c.healthcheckCommandFile, "healthcheck-command-file", "", "the path to a file holding the host healthcheck command of the service")
+	f.StringVar(&c.healthStartPeriod, "health-start-period", "", "override the healthcheck start period for this deploy")
+	f.BoolVar(&c.ignoreDepFailures, "ignore-dependency-failures", false, "deploy services whose dependencies failed instead of skipping them")
+	f.StringVar(&c.image, "image", "", "deploy the service running this image without a compose file")
+	f.IntVar(&c.index, "index", 0, "replace only the container with this instance number, leaving the others running")
+	f.StringSliceVar(&c.inheritLabels, "inherit-label", []string{}, "a label to copy from each replaced container onto its replacement")
+	f.StringSliceVar(&c.interleave, "interleave", []string{}, "two services to deploy side by side, alternating their rolling update batches")
+	f.BoolVar(&c.keepOld, "keep-old", false, "leave the old containers running after a start-first update for a manual cutover")
+	f.StringVar(&c.logLevel, "log-level", "info", "the minimum level of log messages to emit (debug, info, warn, error)")
+	f.IntVar(&c.maxOldContainers, "max-old-containers", 0, "the number of containers allowed above the desired replicas during a start-first update (defaults to parallelism)")
+	f.StringVar(&c.metricsAddr, "metrics-addr", "", "an address, such as :9090, to serve Prometheus metrics of the deploy on while it runs")
+	f.StringVar(&c.minFreeDisk, "min-free-disk", "", "the minimum free disk space on the docker data-root required before deploying the project")
+	f.BoolVar(&c.noBuild, "no-build", false, "fail before deploying the project if a service with a build section has no image")
+	f.BoolVar(&c.noRename, "no-rename", false, "leave containers with the names compose gives them instead of renaming them to the container name template")
+	f.BoolVar(&c.onlyNew, "only-new", false, "leave existing containers running untouched, only adding new containers to reach the replica count")
+	f.StringVar(&c.otelEndpoint, "otel-endpoint", "", "an OTLP/HTTP endpoint, such as http://localhost:4318, to export the deploy's tracing spans to")
+	f.IntVar(&c.parallelismBudget, "parallelism-budget", 0, "the number of containers updated at once across all services of the deploy")
+	f.StringVar(&c.pinRollbackImage, "pin-rollback-image", "", "a known-good image to pin as the target of rollback for the service")
+	f.BoolVar(&c.promote, "promote", false, "replace the remaining containers of a service with canary containers running")
 	f.StringVar(&c.projectDirectory, "project-directory", "", "the path to the project directory")
+	f.StringVar(&c.projectLabel, "project-label", "", "override the compose project label value used to discover containers")
 	f.StringVar(&c.projectName, "project-name", "", "the name of the project")
+	f.IntVar(&c.pullParallel, "pull-parallel", 0, "pull the distinct service images with this many pulls at once before deploying the project")
+	f.BoolVar(&c.pullProgress, "pull-progress", false, "stream the per-layer progress of the images pulled by --pull-parallel")
+	f.BoolVar(&c.purgeState, "purge-state", false, "remove the local state of the project, such as its deploy history, before deploying")
+	f.BoolVar(&c.quietPull, "quiet-pull", false, "pull images without printing their per-layer progress")
+	f.BoolVar(&c.recreate, "recreate", false, "replace only the containers whose config or image differ from the service, leaving matching containers running")
+	f.BoolVar(&c.recreateAnonVolumes, "recreate-anonymous-volumes", false, "recreate anonymous volumes instead of reusing them from previous containers")
+	f.BoolVar(&c.teardownOnFailure, "teardown-on-failure", false, "remove the containers, networks and volumes created by a failed project deploy")
+	f.StringVar(&c.timeoutPerContainer, "timeout-health", "", "alias for --timeout-per-container")
+	f.StringVar(&c.timeoutOverall, "timeout-overall", "", "an upper bound on the whole project deploy, after which in-flight work is cancelled and the remaining services are not started")
+	f.StringVar(&c.timeoutPerContainer, "timeout-per-container", "", "an absolute ceiling on how long any single container may take to become healthy")
+	f.StringVar(&c.selector, "select", "", "an expression selecting which services to deploy")
+	f.StringVar(&c.selectImage, "select-by-image", "", "only deploy the services whose image belongs to this repository")
 	f.BoolVar(&c.skipDatabases, "skip-databases", false, "whether to skip deploying databases")
+	f.StringSliceVar(&c.skipPullFor, "skip-pull-for", []string{}, "one or more services whose images are not pulled, relying on the local image")
+	f.StringVar(&c.stopGracePeriod, "stop-grace-period", "", "override how long every service's containers are given to exit once stopped before they are killed")
+	f.StringVar(&c.summaryFormat, "summary-format", "text", "the format of the summary printed once a project deploy finishes (text, json)")
+	f.BoolVar(&c.verifyGraph, "verify-graph", false, "verify every deployed service is still healthy once the entire project is deployed")
+	f.BoolVar(&c.verifyImageExists, "verify-image-exists", false, "verify every service image is present locally or in its registry before changing any container")
+	f.StringVar(&c.waitForDependencies, "wait-for-dependencies-timeout", "5m", "how long to wait for each service_healthy dependency to become healthy")
+	f.StringSliceVar(&c.waitForImages, "wait-for-images", []string{}, "images to wait for in their registry before deploying, such as myapp:v2,worker:v2")
+	f.StringVar(&c.waitForImagesTimeout, "wait-for-images-timeout", "10m", "how long to wait for the --wait-for-images images to become available")
+	f.BoolVar(&c.warningsAsErrors, "warnings-as-errors", false, "fail the deploy when any warning was raised during it")
 	return f
 }
 
@@ -79,13 +260,77 @@ func (c *DeployCommand) AutocompleteFlags() complete.Flags {
 	return command.MergeAutocompleteFlags(
 		c.Meta.AutocompleteFlags(command.FlagSetClient),
 		complete.Flags{
-			"--container-name-template": complete.PredictAnything,
-			"--file":                    complete.PredictFiles("*"),
-			"--profiles":                complete.PredictAnything,
-			"--project-directory":       complete.PredictDirs("*"),
-			"--project-name":            complete.PredictAnything,
-			"--replicas":                complete.PredictAnything,
-			"--skip-databases":          complete.PredictNothing,
+			"--allow-zero":                    complete.PredictNothing,
+			"--atomic":                        complete.PredictNothing,
+			"--build":                         complete.PredictNothing,
+			"--canary":                        complete.PredictAnything,
+			"--command":                       complete.PredictAnything,
+			"--compatibility":                 complete.PredictNothing,
+			"--config":                        complete.PredictFiles("*.yaml"),
+			"--container-name-template":       complete.PredictAnything,
+			"--continue-on-error":             complete.PredictNothing,
+			"--default-healthcheck-command":   complete.PredictAnything,
+			"--diff":                          complete.PredictNothing,
+			"--drain-command":                 complete.PredictAnything,
+			"--dump-compose-config":           complete.PredictFiles("*"),
+			"--entrypoint":                    complete.PredictAnything,
+			"--env-from-container":            complete.PredictAnything,
+			"--events-file":                   complete.PredictFiles("*"),
+			"--fail-fast":                     complete.PredictNothing,
+			"--failure-log-lines":             complete.PredictAnything,
+			"--file":                          complete.PredictFiles("*"),
+			"--health-start-period":           complete.PredictAnything,
+			"--healthcheck-command-file":      complete.PredictFiles("*"),
+			"--ignore-dependency-failures":    complete.PredictNothing,
+			"--image":                         complete.PredictAnything,
+			"--index":                         complete.PredictAnything,
+			"--inherit-label":                 complete.PredictAnything,
+			"--keep-old":                      complete.PredictNothing,
+			"--log-level":                     complete.PredictSet("debug", "info", "warn", "error"),
+			"--max-old-containers":            complete.PredictAnything,
+			"--metrics-addr":                  complete.PredictAnything,
+			"--min-free-disk":                 complete.PredictAnything,
+			"--no-build":                      complete.PredictNothing,
+			"--no-rename":                     complete.PredictNothing,
+			"--only-new":                      complete.PredictNothing,
+			"--otel-endpoint":                 complete.PredictAnything,
+			"--parallelism-budget":            complete.PredictAnything,
+			"--pin-rollback-image":            complete.PredictAnything,
+			"--profiles":                      complete.PredictAnything,
+			"--project-directory":             complete.PredictDirs("*"),
+			"--promote":                       complete.PredictNothing,
+			"--project-label":                 complete.PredictAnything,
+			"--project-name":                  complete.PredictAnything,
+			"--pull-parallel":                 complete.PredictAnything,
+			"--pull-progress":                 complete.PredictNothing,
+			"--purge-state":                   complete.PredictNothing,
+			"--quiet-pull":                    complete.PredictNothing,
+			"--recreate":                      complete.PredictNothing,
+			"--recreate-anonymous-volumes":    complete.PredictNothing,
+			"--replicas":                      complete.PredictAnything,
+			"--replicas-delta":                complete.PredictAnything,
+			"--replicas-file":                 complete.PredictFiles("*"),
+			"--replicas-from-label":           complete.PredictAnything,
+			"--replicas-max":                  complete.PredictAnything,
+			"--replicas-min":                  complete.PredictAnything,
+			"--revision":                      complete.PredictAnything,
+			"--scale-down-keep":               complete.PredictSet("newest", "oldest", "healthy"),
+			"--select":                        complete.PredictAnything,
+			"--select-by-image":               complete.PredictAnything,
+			"--skip-databases":                complete.PredictNothing,
+			"--skip-pull-for":                 complete.PredictAnything,
+			"--stop-grace-period":             complete.PredictAnything,
+			"--summary-format":                complete.PredictSet("text", "json"),
+			"--teardown-on-failure":           complete.PredictNothing,
+			"--timeout-health":                complete.PredictAnything,
+			"--timeout-overall":               complete.PredictAnything,
+			"--timeout-per-container":         complete.PredictAnything,
+			"--verify-graph":                  complete.PredictNothing,
+			"--verify-image-exists":           complete.PredictNothing,
+			"--wait-for-dependencies-timeout": complete.PredictAnything,
+			"--wait-for-images":               complete.PredictAnything,
+			"--wait-for-images-timeout":       complete.PredictAnything,
+			"--warnings-as-errors":            complete.PredictNothing,
 		},
 	)
 }
@@ -99,6 +344,11 @@ func (c *DeployCommand) Run(args []string) int {
 		return 1
 	}
 
+	if err := c.applyFlagConfig(flags); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
 	arguments, err := c.ParsedArguments(flags.Args())
 	if err != nil {
 		c.Ui.Error(err.Error())
@@ -106,33 +356,180 @@ func (c *DeployCommand) Run(args []string) int {
 		return 1
 	}
 
-	if c.file == "" {
-		c.file, err = internal.ComposeFile()
+	err = orchestrate.ValidateFlags(orchestrate.ValidateFlagsInput{
+		Changed:     flags.Changed,
+		Rules:       deployFlagRules,
+		ServiceName: arguments["service-name"].StringValue(),
+	})
+	if err != nil {
+		c.Ui.Error(err.Error())
+		c.Ui.Error(command.CommandErrorText(c))
+		return 1
+	}
+
+	if c.failureLogLines < 0 {
+		c.Ui.Error("--failure-log-lines must not be negative")
+		c.Ui.Error(command.CommandErrorText(c))
+		return 1
+	}
+
+	if c.index < 0 {
+		c.Ui.Error("--index must be a positive instance number")
+		c.Ui.Error(command.CommandErrorText(c))
+		return 1
+	}
+
+	if c.scaleDownKeep != "newest" && c.scaleDownKeep != "oldest" && c.scaleDownKeep != "healthy" {
+		c.Ui.Error(fmt.Sprintf("invalid --scale-down-keep value %s: expected newest, oldest or healthy", c.scaleDownKeep))
+		c.Ui.Error(command.CommandErrorText(c))
+		return 1
+	}
+
+	if c.summaryFormat != "text" && c.summaryFormat != "json" {
+		c.Ui.Error(fmt.Sprintf("invalid --summary-format value %s: expected text or json", c.summaryFormat))
+		c.Ui.Error(command.CommandErrorText(c))
+		return 1
+	}
+
+	healthStartPeriod, err := orchestrate.ParseDurationFlag("--health-start-period", c.healthStartPeriod)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		c.Ui.Error(command.CommandErrorText(c))
+		return 1
+	}
+
+	var replicasDelta int
+	if c.replicasDelta != "" {
+		replicasDelta, err = orchestrate.ParseReplicasDelta(c.replicasDelta)
 		if err != nil {
 			c.Ui.Error(err.Error())
+			c.Ui.Error(command.CommandErrorText(c))
 			return 1
 		}
 	}
 
-	if c.projectDirectory == "" {
-		c.projectDirectory = filepath.Dir(c.file)
+	stopGracePeriod, err := orchestrate.ParseDurationFlag("--stop-grace-period", c.stopGracePeriod)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		c.Ui.Error(command.CommandErrorText(c))
+		return 1
+	}
+
+	timeoutFlag := "--timeout-per-container"
+	if flags.Changed("timeout-health") && !flags.Changed("timeout-per-container") {
+		timeoutFlag = "--timeout-health"
+	}
+	timeoutPerContainer, err := orchestrate.ParseDurationFlag(timeoutFlag, c.timeoutPerContainer)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		c.Ui.Error(command.CommandErrorText(c))
+		return 1
+	}
+
+	timeoutOverall, err := orchestrate.ParseDurationFlag("--timeout-overall", c.timeoutOverall)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		c.Ui.Error(command.CommandErrorText(c))
+		return 1
 	}
 
-	if c.projectName == "" {
-		c.projectName = filepath.Base(filepath.Dir(c.file))
+	waitForDependencies, err := orchestrate.ParseDurationFlag("--wait-for-dependencies-timeout", c.waitForDependencies)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		c.Ui.Error(command.CommandErrorText(c))
+		return 1
 	}
 
-	project, err := internal.ComposeProject(c.projectName, c.file, c.profiles)
+	waitForImagesTimeout, err := orchestrate.ParseDurationFlag("--wait-for-images-timeout", c.waitForImagesTimeout)
 	if err != nil {
 		c.Ui.Error(err.Error())
+		c.Ui.Error(command.CommandErrorText(c))
 		return 1
 	}
 
-	client, err := internal.NewDockerClient()
+	minFreeDisk, err := orchestrate.ParseSizeFlag("--min-free-disk", c.minFreeDisk)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		c.Ui.Error(command.CommandErrorText(c))
+		return 1
+	}
+
+	// compose only merges the override file when no file is specified
+	overrideFiles := []string{}
+	var project *orchestrate.Project
+	if c.image != "" {
+		// the synthesized compose file is temporary, so the project's state
+		// lives in the directory the deploy is run from
+		if c.projectDirectory == "" {
+			c.projectDirectory, err = os.Getwd()
+			if err != nil {
+				c.Ui.Error(fmt.Sprintf("error getting working directory: %v", err))
+				return 1
+			}
+		}
+
+		if c.projectName == "" {
+			c.projectName = filepath.Base(c.projectDirectory)
+		}
+
+		project, err = orchestrate.ImageProject(orchestrate.ImageProjectInput{
+			Image:       c.image,
+			ProjectName: c.projectName,
+			ServiceName: arguments["service-name"].StringValue(),
+			WorkingDir:  c.projectDirectory,
+		})
+		if err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		c.projectName = project.Name
+
+		composeFile, cleanup, err := orchestrate.WriteImageComposeFile(project)
+		if err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		defer cleanup()
+		c.file = composeFile
+	} else {
+		if c.file == "" {
+			composeFiles, err := orchestrate.ComposeFiles()
+			if err != nil {
+				c.Ui.Error(err.Error())
+				return 1
+			}
+			c.file = composeFiles[0]
+			overrideFiles = composeFiles[1:]
+		}
+
+		if c.projectDirectory == "" {
+			c.projectDirectory = filepath.Dir(c.file)
+		}
+
+		if c.projectName == "" {
+			c.projectName = filepath.Base(filepath.Dir(c.file))
+		}
+
+		project, err = orchestrate.LoadProjectFiles(c.projectName, append([]string{c.file}, overrideFiles...), c.profiles)
+		if err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+	}
+
+	if c.dumpComposeConfig != "" {
+		if err := orchestrate.DumpComposeConfig(project, c.dumpComposeConfig); err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+	}
+
+	client, err := orchestrate.NewClient()
 	if err != nil {
 		c.Ui.Error(err.Error())
 		return 1
 	}
+	defer client.Close()
 
 	logger, ok := c.Ui.(*command.ZerologUi)
 	if !ok {
@@ -140,47 +537,359 @@ func (c *DeployCommand) Run(args []string) int {
 		return 1
 	}
 
-	serviceName := arguments["service-name"].StringValue()
-	ctx := context.Background()
-	if serviceName == "" {
-		if c.replicas > 0 {
-			c.Ui.Error("--replicas flag requires a service name argument")
+	logLevel, err := zerolog.ParseLevel(c.logLevel)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("invalid log level: %v", err))
+		return 1
+	}
+	logger.StdoutLogger = logger.StdoutLogger.Level(logLevel)
+	logger.StderrLogger = logger.StderrLogger.Level(logLevel)
+
+	// the JSON summary is written to stdout on its own so it can be parsed,
+	// with the deploy output sent to stderr instead
+	if c.summaryFormat == "json" {
+		logger.StdoutLogger = logger.StderrLogger
+	}
+
+	if c.diff {
+		return c.printDiff(client, logger, project, arguments["service-name"].StringValue(), replicasDelta)
+	}
+
+	// the lock file records who is deploying the project and since when, for
+	// the status command and for a concurrent deploy to report
+	lockFile := orchestrate.LockFile(c.projectDirectory, c.projectName)
+	lock, err := orchestrate.AcquireDeployLock(lockFile, orchestrate.NewDeployLockHolder(c.projectName, os.Args))
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+	defer func() {
+		if err := lock.Release(); err != nil {
+			logger.Warn(fmt.Sprintf("Unable to release deploy lock: path=%s, error=%v", lockFile, err))
+		}
+	}()
+
+	// events are written unbuffered, so everything emitted before a failure
+	// is on disk by the time the file is closed
+	var events *orchestrate.EventEmitter
+	if c.eventsFile != "" {
+		eventsFile, err := os.Create(c.eventsFile)
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("error creating events file: %v", err))
+			return 1
+		}
+		defer eventsFile.Close()
+		events = orchestrate.NewEventEmitter(eventsFile)
+	}
+
+	if c.purgeState {
+		removed, err := orchestrate.PurgeState(c.projectDirectory, c.projectName)
+		if err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		logger.Info(fmt.Sprintf("Purged project state: history_records=%d", removed))
+	}
+
+	if c.revision == "" {
+		c.revision = orchestrate.RevisionFromEnvironment()
+	}
+
+	deployID := orchestrate.NewDeployID()
+	history := orchestrate.NewDeployHistory(orchestrate.HistoryFile(c.projectDirectory))
+	logger.Info(fmt.Sprintf("Starting deploy: deploy_id=%s", deployID))
+	if c.revision != "" {
+		logger.Info(fmt.Sprintf("Deploying revision: revision=%s", c.revision))
+	}
+
+	// spans join the trace of the pipeline running the deploy, if any
+	ctx := orchestrate.TraceContextFromEnvironment(context.Background())
+	var tracerProvider orchestrate.TracerProvider
+	if c.otelEndpoint != "" {
+		provider, err := orchestrate.NewTracerProvider(ctx, c.otelEndpoint)
+		if err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if err := provider.Shutdown(shutdownCtx); err != nil {
+				logger.Warn(fmt.Sprintf("Unable to export tracing spans: endpoint=%s, error=%v", c.otelEndpoint, err))
+			}
+		}()
+		tracerProvider = provider
+	}
+
+	if len(c.waitForImages) > 0 {
+		if err := orchestrate.WaitForImages(ctx, orchestrate.WaitForImagesInput{
+			Client:  client,
+			Images:  c.waitForImages,
+			Logger:  logger,
+			Timeout: waitForImagesTimeout,
+		}); err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+	}
+
+	var metrics *orchestrate.DeployMetrics
+	if c.metricsAddr != "" {
+		metrics = orchestrate.NewDeployMetrics()
+		server, err := orchestrate.ServeMetrics(c.metricsAddr, metrics)
+		if err != nil {
+			c.Ui.Error(err.Error())
 			return 1
 		}
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if err := server.Shutdown(shutdownCtx); err != nil {
+				logger.Warn(fmt.Sprintf("Unable to stop metrics server: addr=%s, error=%v", c.metricsAddr, err))
+			}
+		}()
+		logger.Info(fmt.Sprintf("Serving metrics: addr=%s", c.metricsAddr))
+	}
 
+	warnings := orchestrate.NewDeployWarnings()
+	serviceName := arguments["service-name"].StringValue()
+	if serviceName == "" {
 		logger.LogHeader1(fmt.Sprintf("Deploying entire project from %s", c.file))
-		err = internal.DeployProject(ctx, internal.DeployProjectInput{
-			Client:                client,
-			ComposeFile:           c.file,
-			ContainerNameTemplate: c.containerNameTemplate,
-			Logger:                logger,
-			Project:               project,
-			ProjectName:           c.projectName,
-			SkipDatabases:         c.skipDatabases,
+		result, err := orchestrate.DeployProjectWithResult(ctx, orchestrate.DeployProjectInput{
+			Atomic:                     c.atomic,
+			Build:                      c.build,
+			Client:                     client,
+			Compatibility:              c.compatibility,
+			ComposeFile:                c.file,
+			ContainerNameTemplate:      c.containerNameTemplate,
+			ContainerTimeout:           timeoutPerContainer,
+			ContinueOnError:            c.continueOnError,
+			DefaultHealthcheckCommand:  c.defaultHealthcheck,
+			DeployID:                   deployID,
+			DrainCommand:               c.drainCommand,
+			Events:                     events,
+			FailureLogLines:            c.failureLogLines,
+			HealthStartPeriod:          healthStartPeriod,
+			History:                    history,
+			IgnoreDependencyFailures:   c.ignoreDepFailures,
+			InheritLabels:              c.inheritLabels,
+			Interleave:                 c.interleave,
+			KeepOld:                    c.keepOld,
+			Logger:                     logger,
+			MaxOldContainers:           c.maxOldContainers,
+			Metrics:                    metrics,
+			MinFreeDisk:                minFreeDisk,
+			NoBuild:                    c.noBuild,
+			OnlyNew:                    c.onlyNew,
+			OverallTimeout:             timeoutOverall,
+			OverrideFiles:              overrideFiles,
+			ParallelismBudget:          c.parallelismBudget,
+			Project:                    project,
+			ProjectLabel:               c.projectLabel,
+			ProjectName:                c.projectName,
+			PullParallel:               c.pullParallel,
+			PullProgress:               c.pullProgress,
+			QuietPull:                  c.quietPull,
+			Recreate:                   c.recreate,
+			RecreateAnonymousVolumes:   c.recreateAnonVolumes,
+			ReplicasFile:               c.replicasFile,
+			ReplicasFromLabel:          c.replicasFromLabel,
+			ReportAllFailures:          !c.failFast,
+			Revision:                   c.revision,
+			ScaleDownKeep:              c.scaleDownKeep,
+			SelectImage:                c.selectImage,
+			Selector:                   c.selector,
+			SkipDatabases:              c.skipDatabases,
+			SkipRename:                 c.noRename,
+			SkipPullFor:                c.skipPullFor,
+			StopGracePeriod:            stopGracePeriod,
+			TeardownOnFailure:          c.teardownOnFailure,
+			TracerProvider:             tracerProvider,
+			VerifyGraph:                c.verifyGraph,
+			VerifyImageExists:          c.verifyImageExists,
+			WaitForDependenciesTimeout: waitForDependencies,
+			Warnings:                   warnings,
 		})
+		if c.summaryFormat == "json" {
+			summary, summaryErr := result.SummaryJSON()
+			if summaryErr != nil {
+				c.Ui.Error(summaryErr.Error())
+				return 1
+			}
+			fmt.Fprintln(os.Stdout, summary)
+		} else if len(result.Services) > 0 {
+			c.Ui.Output(result.SummaryTable())
+		}
+		if report := warnings.Report(); report != "" && c.summaryFormat != "json" {
+			c.Ui.Output(report)
+		}
 		if err != nil {
 			c.Ui.Error(err.Error())
 			return 1
 		}
+		if err := c.checkWarnings(warnings); err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
 		logger.Info("Entire project deployed")
 		return 0
 	}
 
 	logger.LogHeader2(fmt.Sprintf("Deploying service %s", serviceName))
-	err = internal.DeployService(ctx, internal.DeployServiceInput{
-		Client:                client,
-		ComposeFile:           c.file,
-		ContainerNameTemplate: c.containerNameTemplate,
-		Logger:                logger,
-		Project:               project,
-		ProjectName:           c.projectName,
-		Replicas:              c.replicas,
-		ServiceName:           serviceName,
-		SkipDatabases:         c.skipDatabases,
+	err = orchestrate.DeployService(ctx, orchestrate.DeployServiceInput{
+		AllowZero:                 c.allowZero,
+		Canary:                    c.canary,
+		Client:                    client,
+		Command:                   c.command,
+		Compatibility:             c.compatibility,
+		ComposeFile:               c.file,
+		ContainerNameTemplate:     c.containerNameTemplate,
+		ContainerTimeout:          timeoutPerContainer,
+		DefaultHealthcheckCommand: c.defaultHealthcheck,
+		DeployID:                  deployID,
+		DrainCommand:              c.drainCommand,
+		Entrypoint:                c.entrypoint,
+		EnvFromContainer:          c.envFromContainer,
+		Events:                    events,
+		FailureLogLines:           c.failureLogLines,
+		HealthcheckCommandFile:    c.healthcheckCommandFile,
+		HealthStartPeriod:         healthStartPeriod,
+		History:                   history,
+		Index:                     c.index,
+		InheritLabels:             c.inheritLabels,
+		KeepOld:                   c.keepOld,
+		Logger:                    logger,
+		MaxOldContainers:          c.maxOldContainers,
+		Metrics:                   metrics,
+		OnlyNew:                   c.onlyNew,
+		OverrideFiles:             overrideFiles,
+		PinRollbackImage:          c.pinRollbackImage,
+		Project:                   project,
+		ProjectLabel:              c.projectLabel,
+		ProjectName:               c.projectName,
+		Promote:                   c.promote,
+		QuietPull:                 c.quietPull,
+		Recreate:                  c.recreate,
+		RecreateAnonymousVolumes:  c.recreateAnonVolumes,
+		Replicas:                  c.replicas,
+		ReplicasDelta:             replicasDelta,
+		ReplicasFile:              c.replicasFile,
+		ReplicasFromLabel:         c.replicasFromLabel,
+		ReplicasMax:               c.replicasMax,
+		ReplicasMin:               c.replicasMin,
+		ReportAllFailures:         !c.failFast,
+		Revision:                  c.revision,
+		ScaleDownKeep:             c.scaleDownKeep,
+		ServiceName:               serviceName,
+		SkipDatabases:             c.skipDatabases,
+		SkipRename:                c.noRename,
+		StopGracePeriod:           stopGracePeriod,
+		TracerProvider:            tracerProvider,
+		VerifyImageExists:         c.verifyImageExists,
+		Warnings:                  warnings,
+	})
+	if report := warnings.Report(); report != "" {
+		c.Ui.Output(report)
+	}
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+	if err := c.checkWarnings(warnings); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+	return 0
+}
+
+// checkWarnings returns an error when warnings were raised during the deploy
+// and --warnings-as-errors is set
+func (c *DeployCommand) checkWarnings(warnings *orchestrate.DeployWarnings) error {
+	if !c.warningsAsErrors {
+		return nil
+	}
+	if count := len(warnings.Warnings()); count > 0 {
+		return fmt.Errorf("deploy raised %d warnings and --warnings-as-errors is set", count)
+	}
+	return nil
+}
+
+// printDiff prints how a deploy would change the running containers of the
+// project or the given service, without changing anything
+func (c *DeployCommand) printDiff(client orchestrate.Client, logger *command.ZerologUi, project *orchestrate.Project, serviceName string, replicasDelta int) int {
+	ctx := context.Background()
+	if serviceName == "" {
+		diffs, err := orchestrate.DiffProject(ctx, orchestrate.DeployProjectInput{
+			Client:            client,
+			Logger:            logger,
+			Project:           project,
+			ProjectLabel:      c.projectLabel,
+			ProjectName:       c.projectName,
+			ReplicasFile:      c.replicasFile,
+			ReplicasFromLabel: c.replicasFromLabel,
+			SelectImage:       c.selectImage,
+			Selector:          c.selector,
+			SkipDatabases:     c.skipDatabases,
+		})
+		if err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		for _, diff := range diffs {
+			c.Ui.Output(diff.String())
+		}
+		return 0
+	}
+
+	diff, err := orchestrate.DiffService(ctx, orchestrate.DeployServiceInput{
+		AllowZero:         c.allowZero,
+		Client:            client,
+		Logger:            logger,
+		Project:           project,
+		ProjectLabel:      c.projectLabel,
+		ProjectName:       c.projectName,
+		Replicas:          c.replicas,
+		ReplicasDelta:     replicasDelta,
+		ReplicasFile:      c.replicasFile,
+		ReplicasFromLabel: c.replicasFromLabel,
+		ReplicasMax:       c.replicasMax,
+		ReplicasMin:       c.replicasMin,
+		ServiceName:       serviceName,
+		SkipDatabases:     c.skipDatabases,
 	})
 	if err != nil {
 		c.Ui.Error(err.Error())
 		return 1
 	}
+	c.Ui.Output(diff.String())
 	return 0
 }
+
+// applyFlagConfig sets the flags not given on the command line from the
+// config file, which is either the one given with --config or the optional
+// .orchestrate.yaml in the project directory
+func (c *DeployCommand) applyFlagConfig(flags *flag.FlagSet) error {
+	path := c.config
+	if path == "" {
+		projectDirectory := c.projectDirectory
+		if projectDirectory == "" && c.file != "" {
+			projectDirectory = filepath.Dir(c.file)
+		}
+		path = filepath.Join(projectDirectory, orchestrate.FlagConfigFile)
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+	}
+
+	config, err := orchestrate.LoadFlagConfig(path)
+	if err != nil {
+		return err
+	}
+
+	return orchestrate.ApplyFlagConfig(orchestrate.ApplyFlagConfigInput{
+		Changed: flags.Changed,
+		Config:  config,
+		Path:    path,
+		Set:     flags.Set,
+	})
+}
@@ -0,0 +1,172 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/dokku/docker-orchestrate/pkg/orchestrate"
+	"github.com/josegonzalez/cli-skeleton/command"
+	"github.com/posener/complete"
+	flag "github.com/spf13/pflag"
+	"golang.org/x/term"
+)
+
+type ExecCommand struct {
+	command.Meta
+
+	file         string
+	index        int
+	noTty        bool
+	projectLabel string
+	projectName  string
+}
+
+func (c *ExecCommand) Name() string {
+	return "exec"
+}
+
+func (c *ExecCommand) Synopsis() string {
+	return "Run a command in a running container of a service"
+}
+
+func (c *ExecCommand) Help() string {
+	return command.CommandHelp(c)
+}
+
+func (c *ExecCommand) Examples() map[string]string {
+	appName := os.Getenv("CLI_APP_NAME")
+	return map[string]string{
+		"Open a shell in a service container":           fmt.Sprintf("%s %s web sh", appName, c.Name()),
+		"Run a command in a specific service container": fmt.Sprintf("%s %s --index 2 web cat /etc/hostname", appName, c.Name()),
+	}
+}
+
+func (c *ExecCommand) Arguments() []command.Argument {
+	args := []command.Argument{}
+	args = append(args, command.Argument{
+		Name:        "service-name",
+		Description: "the name of the service to run the command in",
+		Optional:    false,
+		Type:        command.ArgumentString,
+	})
+	args = append(args, command.Argument{
+		Name:        "command",
+		Description: "the command to run, along with its arguments",
+		Optional:    false,
+		Type:        command.ArgumentList,
+	})
+	return args
+}
+
+func (c *ExecCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictNothing
+}
+
+func (c *ExecCommand) ParsedArguments(args []string) (map[string]command.Argument, error) {
+	return command.ParseArguments(args, c.Arguments())
+}
+
+func (c *ExecCommand) FlagSet() *flag.FlagSet {
+	f := c.Meta.FlagSet(c.Name(), command.FlagSetClient)
+	// flags after the service name belong to the command being run
+	f.SetInterspersed(false)
+	f.StringVar(&c.file, "file", "", "the path to the Compose file")
+	f.IntVar(&c.index, "index", 0, "the container number of the service container to run the command in")
+	f.BoolVar(&c.noTty, "no-tty", false, "do not allocate a pseudo-TTY, even when stdin is a terminal")
+	f.StringVar(&c.projectLabel, "project-label", "", "override the compose project label value used to discover containers")
+	f.StringVar(&c.projectName, "project-name", "", "the name of the project")
+	return f
+}
+
+func (c *ExecCommand) AutocompleteFlags() complete.Flags {
+	return command.MergeAutocompleteFlags(
+		c.Meta.AutocompleteFlags(command.FlagSetClient),
+		complete.Flags{
+			"--file":          complete.PredictFiles("*"),
+			"--index":         complete.PredictAnything,
+			"--no-tty":        complete.PredictNothing,
+			"--project-label": complete.PredictAnything,
+			"--project-name":  complete.PredictAnything,
+		},
+	)
+}
+
+func (c *ExecCommand) Run(args []string) int {
+	flags := c.FlagSet()
+	flags.Usage = func() { c.Ui.Output(c.Help()) }
+	if err := flags.Parse(args); err != nil {
+		c.Ui.Error(err.Error())
+		c.Ui.Error(command.CommandErrorText(c))
+		return 1
+	}
+
+	arguments, err := c.ParsedArguments(flags.Args())
+	if err != nil {
+		c.Ui.Error(err.Error())
+		c.Ui.Error(command.CommandErrorText(c))
+		return 1
+	}
+
+	if c.index < 0 {
+		c.Ui.Error("--index must be a positive container number")
+		return 1
+	}
+
+	if c.file == "" {
+		composeFile, err := orchestrate.ComposeFile()
+		if err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		c.file = composeFile
+	}
+
+	if c.projectName == "" {
+		c.projectName = filepath.Base(filepath.Dir(c.file))
+	}
+
+	client, err := orchestrate.NewClient()
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+	defer client.Close()
+
+	input := orchestrate.ExecServiceInput{
+		Client:       client,
+		Command:      arguments["command"].ListValue(),
+		Index:        c.index,
+		ProjectLabel: c.projectLabel,
+		ProjectName:  c.projectName,
+		ServiceName:  arguments["service-name"].StringValue(),
+		Stderr:       os.Stderr,
+		Stdin:        os.Stdin,
+		Stdout:       os.Stdout,
+	}
+
+	// the terminal is switched to raw mode so keystrokes such as ctrl-c
+	// reach the command in the container rather than this process
+	stdinFd := int(os.Stdin.Fd())
+	if !c.noTty && term.IsTerminal(stdinFd) {
+		input.Tty = true
+		if width, height, err := term.GetSize(stdinFd); err == nil {
+			input.ConsoleSize = &[2]uint{uint(height), uint(width)}
+		}
+
+		state, err := term.MakeRaw(stdinFd)
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("error setting terminal to raw mode: %v", err))
+			return 1
+		}
+		defer term.Restore(stdinFd, state)
+	}
+
+	exitCode, err := orchestrate.ExecService(context.Background(), input)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+	return exitCode
+}
@@ -0,0 +1,136 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dokku/docker-orchestrate/pkg/orchestrate"
+	"github.com/josegonzalez/cli-skeleton/command"
+	"github.com/posener/complete"
+	flag "github.com/spf13/pflag"
+)
+
+type HistoryCommand struct {
+	command.Meta
+
+	file             string
+	projectDirectory string
+	projectName      string
+}
+
+func (c *HistoryCommand) Name() string {
+	return "history"
+}
+
+func (c *HistoryCommand) Synopsis() string {
+	return "List past deploys of a Compose project"
+}
+
+func (c *HistoryCommand) Help() string {
+	return command.CommandHelp(c)
+}
+
+func (c *HistoryCommand) Examples() map[string]string {
+	appName := os.Getenv("CLI_APP_NAME")
+	return map[string]string{
+		"List past deploys of the entire Compose project": fmt.Sprintf("%s %s", appName, c.Name()),
+		"List past deploys of a specific service":         fmt.Sprintf("%s %s web", appName, c.Name()),
+	}
+}
+
+func (c *HistoryCommand) Arguments() []command.Argument {
+	args := []command.Argument{}
+	args = append(args, command.Argument{
+		Name:        "service-name",
+		Description: "the name of the service to list deploys for",
+		Optional:    true,
+		Type:        command.ArgumentString,
+	})
+	return args
+}
+
+func (c *HistoryCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictNothing
+}
+
+func (c *HistoryCommand) ParsedArguments(args []string) (map[string]command.Argument, error) {
+	return command.ParseArguments(args, c.Arguments())
+}
+
+func (c *HistoryCommand) FlagSet() *flag.FlagSet {
+	f := c.Meta.FlagSet(c.Name(), command.FlagSetClient)
+	f.StringVar(&c.file, "file", "", "the path to the Compose file")
+	f.StringVar(&c.projectDirectory, "project-directory", "", "the path to the project directory")
+	f.StringVar(&c.projectName, "project-name", "", "the name of the project")
+	return f
+}
+
+func (c *HistoryCommand) AutocompleteFlags() complete.Flags {
+	return command.MergeAutocompleteFlags(
+		c.Meta.AutocompleteFlags(command.FlagSetClient),
+		complete.Flags{
+			"--file":              complete.PredictFiles("*"),
+			"--project-directory": complete.PredictDirs("*"),
+			"--project-name":      complete.PredictAnything,
+		},
+	)
+}
+
+func (c *HistoryCommand) Run(args []string) int {
+	flags := c.FlagSet()
+	flags.Usage = func() { c.Ui.Output(c.Help()) }
+	if err := flags.Parse(args); err != nil {
+		c.Ui.Error(err.Error())
+		c.Ui.Error(command.CommandErrorText(c))
+		return 1
+	}
+
+	arguments, err := c.ParsedArguments(flags.Args())
+	if err != nil {
+		c.Ui.Error(err.Error())
+		c.Ui.Error(command.CommandErrorText(c))
+		return 1
+	}
+
+	if c.file == "" {
+		composeFile, err := orchestrate.ComposeFile()
+		if err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		c.file = composeFile
+	}
+
+	if c.projectDirectory == "" {
+		c.projectDirectory = filepath.Dir(c.file)
+	}
+
+	if c.projectName == "" {
+		c.projectName = filepath.Base(filepath.Dir(c.file))
+	}
+
+	history := orchestrate.NewDeployHistory(orchestrate.HistoryFile(c.projectDirectory))
+	records, err := history.Records(arguments["service-name"].StringValue())
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	var output strings.Builder
+	w := tabwriter.NewWriter(&output, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DEPLOY ID\tTIME\tSERVICE\tIMAGE\tREPLICAS\tREVISION")
+	for _, record := range records {
+		if record.Project != c.projectName {
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n", record.DeployID, record.Time.Format(time.RFC3339), record.Service, record.Image, record.Replicas, record.Revision)
+	}
+	w.Flush()
+
+	c.Ui.Output(strings.TrimSuffix(output.String(), "\n"))
+	return 0
+}
@@ -0,0 +1,152 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dokku/docker-orchestrate/pkg/orchestrate"
+	"github.com/josegonzalez/cli-skeleton/command"
+	"github.com/posener/complete"
+	flag "github.com/spf13/pflag"
+)
+
+type LogsCommand struct {
+	command.Meta
+
+	deployID     string
+	file         string
+	projectLabel string
+	projectName  string
+	tail         int
+}
+
+func (c *LogsCommand) Name() string {
+	return "logs"
+}
+
+func (c *LogsCommand) Synopsis() string {
+	return "Show the logs of the containers of a Compose project"
+}
+
+func (c *LogsCommand) Help() string {
+	return command.CommandHelp(c)
+}
+
+func (c *LogsCommand) Examples() map[string]string {
+	appName := os.Getenv("CLI_APP_NAME")
+	return map[string]string{
+		"Show the logs of the entire Compose project":                 fmt.Sprintf("%s %s", appName, c.Name()),
+		"Show the last lines of the containers created by one deploy": fmt.Sprintf("%s %s --deploy-id 20260101T120000Z-a1b2c3 --tail 50 web", appName, c.Name()),
+	}
+}
+
+func (c *LogsCommand) Arguments() []command.Argument {
+	args := []command.Argument{}
+	args = append(args, command.Argument{
+		Name:        "service-name",
+		Description: "the name of the service to show logs for",
+		Optional:    true,
+		Type:        command.ArgumentString,
+	})
+	return args
+}
+
+func (c *LogsCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictNothing
+}
+
+func (c *LogsCommand) ParsedArguments(args []string) (map[string]command.Argument, error) {
+	return command.ParseArguments(args, c.Arguments())
+}
+
+func (c *LogsCommand) FlagSet() *flag.FlagSet {
+	f := c.Meta.FlagSet(c.Name(), command.FlagSetClient)
+	f.StringVar(&c.deployID, "deploy-id", "", "only show the logs of containers stamped with this deploy id")
+	f.StringVar(&c.file, "file", "", "the path to the Compose file")
+	f.StringVar(&c.projectLabel, "project-label", "", "override the compose project label value used to discover containers")
+	f.StringVar(&c.projectName, "project-name", "", "the name of the project")
+	f.IntVar(&c.tail, "tail", 0, "the number of trailing log lines to show for each container (0 for all)")
+	return f
+}
+
+func (c *LogsCommand) AutocompleteFlags() complete.Flags {
+	return command.MergeAutocompleteFlags(
+		c.Meta.AutocompleteFlags(command.FlagSetClient),
+		complete.Flags{
+			"--deploy-id":     complete.PredictAnything,
+			"--file":          complete.PredictFiles("*"),
+			"--project-label": complete.PredictAnything,
+			"--project-name":  complete.PredictAnything,
+			"--tail":          complete.PredictAnything,
+		},
+	)
+}
+
+func (c *LogsCommand) Run(args []string) int {
+	flags := c.FlagSet()
+	flags.Usage = func() { c.Ui.Output(c.Help()) }
+	if err := flags.Parse(args); err != nil {
+		c.Ui.Error(err.Error())
+		c.Ui.Error(command.CommandErrorText(c))
+		return 1
+	}
+
+	arguments, err := c.ParsedArguments(flags.Args())
+	if err != nil {
+		c.Ui.Error(err.Error())
+		c.Ui.Error(command.CommandErrorText(c))
+		return 1
+	}
+
+	if c.file == "" {
+		composeFile, err := orchestrate.ComposeFile()
+		if err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		c.file = composeFile
+	}
+
+	if c.projectName == "" {
+		c.projectName = filepath.Base(filepath.Dir(c.file))
+	}
+
+	client, err := orchestrate.NewClient()
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+	defer client.Close()
+
+	logs, err := orchestrate.ServiceLogs(context.Background(), orchestrate.ServiceLogsInput{
+		Client:       client,
+		DeployID:     c.deployID,
+		ProjectLabel: c.projectLabel,
+		ProjectName:  c.projectName,
+		ServiceName:  arguments["service-name"].StringValue(),
+		Tail:         c.tail,
+	})
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	// each line is prefixed with its container, as docker compose logs does
+	var output strings.Builder
+	for _, log := range logs {
+		for _, line := range strings.Split(strings.TrimRight(log.Logs, "\n"), "\n") {
+			if line == "" {
+				continue
+			}
+			fmt.Fprintf(&output, "%s | %s\n", log.Name, line)
+		}
+	}
+
+	if output.Len() > 0 {
+		c.Ui.Output(strings.TrimSuffix(output.String(), "\n"))
+	}
+	return 0
+}
@@ -0,0 +1,172 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dokku/docker-orchestrate/pkg/orchestrate"
+	"github.com/josegonzalez/cli-skeleton/command"
+	"github.com/posener/complete"
+	flag "github.com/spf13/pflag"
+)
+
+type PsCommand struct {
+	command.Meta
+
+	deployID     string
+	file         string
+	projectLabel string
+	projectName  string
+	since        string
+	until        string
+}
+
+func (c *PsCommand) Name() string {
+	return "ps"
+}
+
+func (c *PsCommand) Synopsis() string {
+	return "List the containers of a Compose project"
+}
+
+func (c *PsCommand) Help() string {
+	return command.CommandHelp(c)
+}
+
+func (c *PsCommand) Examples() map[string]string {
+	appName := os.Getenv("CLI_APP_NAME")
+	return map[string]string{
+		"List the containers of the entire Compose project":         fmt.Sprintf("%s %s", appName, c.Name()),
+		"List the containers of a service created in the last hour": fmt.Sprintf("%s %s --since 1h web", appName, c.Name()),
+	}
+}
+
+func (c *PsCommand) Arguments() []command.Argument {
+	args := []command.Argument{}
+	args = append(args, command.Argument{
+		Name:        "service-name",
+		Description: "the name of the service to list containers for",
+		Optional:    true,
+		Type:        command.ArgumentString,
+	})
+	return args
+}
+
+func (c *PsCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictNothing
+}
+
+func (c *PsCommand) ParsedArguments(args []string) (map[string]command.Argument, error) {
+	return command.ParseArguments(args, c.Arguments())
+}
+
+func (c *PsCommand) FlagSet() *flag.FlagSet {
+	f := c.Meta.FlagSet(c.Name(), command.FlagSetClient)
+	f.StringVar(&c.deployID, "deploy-id", "", "only list containers stamped with this deploy id")
+	f.StringVar(&c.file, "file", "", "the path to the Compose file")
+	f.StringVar(&c.projectLabel, "project-label", "", "override the compose project label value used to discover containers")
+	f.StringVar(&c.projectName, "project-name", "", "the name of the project")
+	f.StringVar(&c.since, "since", "", "only list containers created within this long, such as 1h")
+	f.StringVar(&c.until, "until", "", "only list containers created at least this long ago, such as 30m")
+	return f
+}
+
+func (c *PsCommand) AutocompleteFlags() complete.Flags {
+	return command.MergeAutocompleteFlags(
+		c.Meta.AutocompleteFlags(command.FlagSetClient),
+		complete.Flags{
+			"--deploy-id":     complete.PredictAnything,
+			"--file":          complete.PredictFiles("*"),
+			"--project-label": complete.PredictAnything,
+			"--project-name":  complete.PredictAnything,
+			"--since":         complete.PredictAnything,
+			"--until":         complete.PredictAnything,
+		},
+	)
+}
+
+func (c *PsCommand) Run(args []string) int {
+	flags := c.FlagSet()
+	flags.Usage = func() { c.Ui.Output(c.Help()) }
+	if err := flags.Parse(args); err != nil {
+		c.Ui.Error(err.Error())
+		c.Ui.Error(command.CommandErrorText(c))
+		return 1
+	}
+
+	arguments, err := c.ParsedArguments(flags.Args())
+	if err != nil {
+		c.Ui.Error(err.Error())
+		c.Ui.Error(command.CommandErrorText(c))
+		return 1
+	}
+
+	since, err := orchestrate.ParseDurationFlag("--since", c.since)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	until, err := orchestrate.ParseDurationFlag("--until", c.until)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	if c.file == "" {
+		composeFile, err := orchestrate.ComposeFile()
+		if err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		c.file = composeFile
+	}
+
+	if c.projectName == "" {
+		c.projectName = filepath.Base(filepath.Dir(c.file))
+	}
+
+	client, err := orchestrate.NewClient()
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+	defer client.Close()
+
+	now := time.Now()
+	containers, err := orchestrate.ListContainers(context.Background(), orchestrate.ListContainersInput{
+		Client:       client,
+		DeployID:     c.deployID,
+		Now:          now,
+		ProjectLabel: c.projectLabel,
+		ProjectName:  c.projectName,
+		ServiceName:  arguments["service-name"].StringValue(),
+		Since:        since,
+		Until:        until,
+	})
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	var output strings.Builder
+	w := tabwriter.NewWriter(&output, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSERVICE\tIMAGE\tCREATED\tSTATUS")
+	for _, container := range containers {
+		name := container.ID
+		if len(container.Names) > 0 {
+			name = strings.TrimPrefix(container.Names[0], "/")
+		}
+		age := now.Sub(time.Unix(container.Created, 0)).Truncate(time.Second)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s ago\t%s\n", name, container.Labels["com.docker.compose.service"], container.Image, age, container.Status)
+	}
+	w.Flush()
+
+	c.Ui.Output(strings.TrimSuffix(output.String(), "\n"))
+	return 0
+}
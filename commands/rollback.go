@@ -0,0 +1,200 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/dokku/docker-orchestrate/pkg/orchestrate"
+	"github.com/josegonzalez/cli-skeleton/command"
+	"github.com/posener/complete"
+	"github.com/rs/zerolog"
+	flag "github.com/spf13/pflag"
+)
+
+type RollbackCommand struct {
+	command.Meta
+
+	containerNameTemplate string
+	file                  string
+	logLevel              string
+	profiles              []string
+	projectDirectory      string
+	projectLabel          string
+	projectName           string
+	to                    string
+}
+
+func (c *RollbackCommand) Name() string {
+	return "rollback"
+}
+
+func (c *RollbackCommand) Synopsis() string {
+	return "Roll a service back to a past deploy"
+}
+
+func (c *RollbackCommand) Help() string {
+	return command.CommandHelp(c)
+}
+
+func (c *RollbackCommand) Examples() map[string]string {
+	appName := os.Getenv("CLI_APP_NAME")
+	return map[string]string{
+		"Roll a service back to a past deploy":                   fmt.Sprintf("%s %s web --to 20240102T030405Z-a1b2c3", appName, c.Name()),
+		"Roll a service back to its pinned image or last deploy": fmt.Sprintf("%s %s web", appName, c.Name()),
+	}
+}
+
+func (c *RollbackCommand) Arguments() []command.Argument {
+	args := []command.Argument{}
+	args = append(args, command.Argument{
+		Name:        "service-name",
+		Description: "the name of the service to roll back",
+		Optional:    false,
+		Type:        command.ArgumentString,
+	})
+	return args
+}
+
+func (c *RollbackCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictNothing
+}
+
+func (c *RollbackCommand) ParsedArguments(args []string) (map[string]command.Argument, error) {
+	return command.ParseArguments(args, c.Arguments())
+}
+
+func (c *RollbackCommand) FlagSet() *flag.FlagSet {
+	f := c.Meta.FlagSet(c.Name(), command.FlagSetClient)
+	f.StringSliceVar(&c.profiles, "profile", []string{}, "one or more profiles to enable")
+	f.StringVar(&c.containerNameTemplate, "container-name-template", orchestrate.DefaultContainerNameTemplate, "the template for the container name")
+	f.StringVar(&c.file, "file", "", "the path to the Compose file")
+	f.StringVar(&c.logLevel, "log-level", "info", "the minimum level of log messages to emit (debug, info, warn, error)")
+	f.StringVar(&c.projectDirectory, "project-directory", "", "the path to the project directory")
+	f.StringVar(&c.projectLabel, "project-label", "", "override the compose project label value used to discover containers")
+	f.StringVar(&c.projectName, "project-name", "", "the name of the project")
+	f.StringVar(&c.to, "to", "", "the id of the recorded deploy to roll back to (defaults to the pinned rollback image, or else the previous deploy)")
+	return f
+}
+
+func (c *RollbackCommand) AutocompleteFlags() complete.Flags {
+	return command.MergeAutocompleteFlags(
+		c.Meta.AutocompleteFlags(command.FlagSetClient),
+		complete.Flags{
+			"--container-name-template": complete.PredictAnything,
+			"--file":                    complete.PredictFiles("*"),
+			"--log-level":               complete.PredictSet("debug", "info", "warn", "error"),
+			"--profiles":                complete.PredictAnything,
+			"--project-directory":       complete.PredictDirs("*"),
+			"--project-label":           complete.PredictAnything,
+			"--project-name":            complete.PredictAnything,
+			"--to":                      complete.PredictAnything,
+		},
+	)
+}
+
+func (c *RollbackCommand) Run(args []string) int {
+	flags := c.FlagSet()
+	flags.Usage = func() { c.Ui.Output(c.Help()) }
+	if err := flags.Parse(args); err != nil {
+		c.Ui.Error(err.Error())
+		c.Ui.Error(command.CommandErrorText(c))
+		return 1
+	}
+
+	arguments, err := c.ParsedArguments(flags.Args())
+	if err != nil {
+		c.Ui.Error(err.Error())
+		c.Ui.Error(command.CommandErrorText(c))
+		return 1
+	}
+
+	// compose only merges the override file when no file is specified
+	overrideFiles := []string{}
+	if c.file == "" {
+		composeFiles, err := orchestrate.ComposeFiles()
+		if err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		c.file = composeFiles[0]
+		overrideFiles = composeFiles[1:]
+	}
+
+	if c.projectDirectory == "" {
+		c.projectDirectory = filepath.Dir(c.file)
+	}
+
+	if c.projectName == "" {
+		c.projectName = filepath.Base(filepath.Dir(c.file))
+	}
+
+	project, err := orchestrate.LoadProjectFiles(c.projectName, append([]string{c.file}, overrideFiles...), c.profiles)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	client, err := orchestrate.NewClient()
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+	defer client.Close()
+
+	logger, ok := c.Ui.(*command.ZerologUi)
+	if !ok {
+		c.Ui.Error("UI is not a ZerologUi")
+		return 1
+	}
+
+	logLevel, err := zerolog.ParseLevel(c.logLevel)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("invalid log level: %v", err))
+		return 1
+	}
+	logger.StdoutLogger = logger.StdoutLogger.Level(logLevel)
+	logger.StderrLogger = logger.StderrLogger.Level(logLevel)
+
+	// a rollback replaces containers just as a deploy does, so it takes
+	// the same lock
+	lockFile := orchestrate.LockFile(c.projectDirectory, c.projectName)
+	lock, err := orchestrate.AcquireDeployLock(lockFile, orchestrate.NewDeployLockHolder(c.projectName, os.Args))
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+	defer func() {
+		if err := lock.Release(); err != nil {
+			logger.Warn(fmt.Sprintf("Unable to release deploy lock: path=%s, error=%v", lockFile, err))
+		}
+	}()
+
+	deployID := orchestrate.NewDeployID()
+	logger.Info(fmt.Sprintf("Starting deploy: deploy_id=%s", deployID))
+
+	serviceName := arguments["service-name"].StringValue()
+	logger.LogHeader2(fmt.Sprintf("Rolling back service %s", serviceName))
+	err = orchestrate.RollbackService(context.Background(), orchestrate.RollbackServiceInput{
+		DeployID: c.to,
+		DeployServiceInput: orchestrate.DeployServiceInput{
+			Client:                client,
+			ComposeFile:           c.file,
+			ContainerNameTemplate: c.containerNameTemplate,
+			DeployID:              deployID,
+			History:               orchestrate.NewDeployHistory(orchestrate.HistoryFile(c.projectDirectory)),
+			Logger:                logger,
+			OverrideFiles:         overrideFiles,
+			Project:               project,
+			ProjectLabel:          c.projectLabel,
+			ProjectName:           c.projectName,
+			ServiceName:           serviceName,
+		},
+	})
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,144 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dokku/docker-orchestrate/pkg/orchestrate"
+	"github.com/josegonzalez/cli-skeleton/command"
+	"github.com/posener/complete"
+	flag "github.com/spf13/pflag"
+)
+
+type StateCommand struct {
+	command.Meta
+
+	file             string
+	projectDirectory string
+	projectName      string
+	yes              bool
+}
+
+func (c *StateCommand) Name() string {
+	return "state"
+}
+
+func (c *StateCommand) Synopsis() string {
+	return "Manage the local orchestrate state of a Compose project"
+}
+
+func (c *StateCommand) Help() string {
+	return command.CommandHelp(c)
+}
+
+func (c *StateCommand) Examples() map[string]string {
+	appName := os.Getenv("CLI_APP_NAME")
+	return map[string]string{
+		"Reset the local state of the Compose project":                fmt.Sprintf("%s %s reset", appName, c.Name()),
+		"Reset the local state of the Compose project without asking": fmt.Sprintf("%s %s reset --yes", appName, c.Name()),
+	}
+}
+
+func (c *StateCommand) Arguments() []command.Argument {
+	args := []command.Argument{}
+	args = append(args, command.Argument{
+		Name:        "action",
+		Description: "the action to take on the state, currently only reset",
+		Optional:    false,
+		Type:        command.ArgumentString,
+	})
+	return args
+}
+
+func (c *StateCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictSet("reset")
+}
+
+func (c *StateCommand) ParsedArguments(args []string) (map[string]command.Argument, error) {
+	return command.ParseArguments(args, c.Arguments())
+}
+
+func (c *StateCommand) FlagSet() *flag.FlagSet {
+	f := c.Meta.FlagSet(c.Name(), command.FlagSetClient)
+	f.StringVar(&c.file, "file", "", "the path to the Compose file")
+	f.StringVar(&c.projectDirectory, "project-directory", "", "the path to the project directory")
+	f.StringVar(&c.projectName, "project-name", "", "the name of the project")
+	f.BoolVar(&c.yes, "yes", false, "reset the state without asking for confirmation")
+	return f
+}
+
+func (c *StateCommand) AutocompleteFlags() complete.Flags {
+	return command.MergeAutocompleteFlags(
+		c.Meta.AutocompleteFlags(command.FlagSetClient),
+		complete.Flags{
+			"--file":              complete.PredictFiles("*"),
+			"--project-directory": complete.PredictDirs("*"),
+			"--project-name":      complete.PredictAnything,
+			"--yes":               complete.PredictNothing,
+		},
+	)
+}
+
+func (c *StateCommand) Run(args []string) int {
+	flags := c.FlagSet()
+	flags.Usage = func() { c.Ui.Output(c.Help()) }
+	if err := flags.Parse(args); err != nil {
+		c.Ui.Error(err.Error())
+		c.Ui.Error(command.CommandErrorText(c))
+		return 1
+	}
+
+	arguments, err := c.ParsedArguments(flags.Args())
+	if err != nil {
+		c.Ui.Error(err.Error())
+		c.Ui.Error(command.CommandErrorText(c))
+		return 1
+	}
+
+	action := arguments["action"].StringValue()
+	if action != "reset" {
+		c.Ui.Error(fmt.Sprintf("unknown state action: %s", action))
+		c.Ui.Error(command.CommandErrorText(c))
+		return 1
+	}
+
+	if c.file == "" {
+		composeFile, err := orchestrate.ComposeFile()
+		if err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		c.file = composeFile
+	}
+
+	if c.projectDirectory == "" {
+		c.projectDirectory = filepath.Dir(c.file)
+	}
+
+	if c.projectName == "" {
+		c.projectName = filepath.Base(filepath.Dir(c.file))
+	}
+
+	if !c.yes {
+		answer, err := c.Ui.Ask(fmt.Sprintf("Reset the local state of project %s in %s? [y/N]", c.projectName, c.projectDirectory))
+		if err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+			c.Ui.Output("State left unchanged")
+			return 0
+		}
+	}
+
+	removed, err := orchestrate.PurgeState(c.projectDirectory, c.projectName)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	c.Ui.Output(fmt.Sprintf("Reset the local state of project %s: removed %d history records", c.projectName, removed))
+	return 0
+}
@@ -0,0 +1,140 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dokku/docker-orchestrate/pkg/orchestrate"
+	"github.com/josegonzalez/cli-skeleton/command"
+	"github.com/posener/complete"
+	flag "github.com/spf13/pflag"
+)
+
+type StatusCommand struct {
+	command.Meta
+
+	file             string
+	locks            bool
+	projectDirectory string
+	projectName      string
+}
+
+func (c *StatusCommand) Name() string {
+	return "status"
+}
+
+func (c *StatusCommand) Synopsis() string {
+	return "Show the deploy status of a Compose project"
+}
+
+func (c *StatusCommand) Help() string {
+	return command.CommandHelp(c)
+}
+
+func (c *StatusCommand) Examples() map[string]string {
+	appName := os.Getenv("CLI_APP_NAME")
+	return map[string]string{
+		"Show which deploy holds the lock of the Compose project": fmt.Sprintf("%s %s --locks", appName, c.Name()),
+	}
+}
+
+func (c *StatusCommand) Arguments() []command.Argument {
+	args := []command.Argument{}
+	return args
+}
+
+func (c *StatusCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictNothing
+}
+
+func (c *StatusCommand) ParsedArguments(args []string) (map[string]command.Argument, error) {
+	return command.ParseArguments(args, c.Arguments())
+}
+
+func (c *StatusCommand) FlagSet() *flag.FlagSet {
+	f := c.Meta.FlagSet(c.Name(), command.FlagSetClient)
+	f.StringVar(&c.file, "file", "", "the path to the Compose file")
+	f.BoolVar(&c.locks, "locks", false, "show the deploy holding the lock of the project, if any")
+	f.StringVar(&c.projectDirectory, "project-directory", "", "the path to the project directory")
+	f.StringVar(&c.projectName, "project-name", "", "the name of the project")
+	return f
+}
+
+func (c *StatusCommand) AutocompleteFlags() complete.Flags {
+	return command.MergeAutocompleteFlags(
+		c.Meta.AutocompleteFlags(command.FlagSetClient),
+		complete.Flags{
+			"--file":              complete.PredictFiles("*"),
+			"--locks":             complete.PredictNothing,
+			"--project-directory": complete.PredictDirs("*"),
+			"--project-name":      complete.PredictAnything,
+		},
+	)
+}
+
+func (c *StatusCommand) Run(args []string) int {
+	flags := c.FlagSet()
+	flags.Usage = func() { c.Ui.Output(c.Help()) }
+	if err := flags.Parse(args); err != nil {
+		c.Ui.Error(err.Error())
+		c.Ui.Error(command.CommandErrorText(c))
+		return 1
+	}
+
+	if _, err := c.ParsedArguments(flags.Args()); err != nil {
+		c.Ui.Error(err.Error())
+		c.Ui.Error(command.CommandErrorText(c))
+		return 1
+	}
+
+	if !c.locks {
+		c.Ui.Error("no status view selected, currently only --locks is supported")
+		c.Ui.Error(command.CommandErrorText(c))
+		return 1
+	}
+
+	if c.file == "" {
+		composeFile, err := orchestrate.ComposeFile()
+		if err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		c.file = composeFile
+	}
+
+	if c.projectDirectory == "" {
+		c.projectDirectory = filepath.Dir(c.file)
+	}
+
+	if c.projectName == "" {
+		c.projectName = filepath.Base(filepath.Dir(c.file))
+	}
+
+	holder, found, err := orchestrate.ReadDeployLock(orchestrate.LockFile(c.projectDirectory, c.projectName))
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+	if !found {
+		c.Ui.Output(fmt.Sprintf("No deploy in progress for project %s", c.projectName))
+		return 0
+	}
+
+	state := "running"
+	if holder.Stale() {
+		state = "stale"
+	}
+
+	var output strings.Builder
+	w := tabwriter.NewWriter(&output, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PROJECT\tPID\tHOSTNAME\tSTARTED\tDURATION\tSTATE\tCOMMAND")
+	fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\t%s\n", holder.Project, holder.PID, holder.Hostname, holder.StartedAt.Format(time.RFC3339), time.Since(holder.StartedAt).Round(time.Second), state, strings.Join(holder.Args, " "))
+	w.Flush()
+
+	c.Ui.Output(strings.TrimSuffix(output.String(), "\n"))
+	return 0
+}
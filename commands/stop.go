@@ -0,0 +1,153 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/dokku/docker-orchestrate/pkg/orchestrate"
+	"github.com/josegonzalez/cli-skeleton/command"
+	"github.com/posener/complete"
+	flag "github.com/spf13/pflag"
+)
+
+type StopCommand struct {
+	command.Meta
+
+	file            string
+	old             bool
+	projectLabel    string
+	projectName     string
+	stopGracePeriod string
+}
+
+func (c *StopCommand) Name() string {
+	return "stop"
+}
+
+func (c *StopCommand) Synopsis() string {
+	return "Stop the containers of a service left running by a deploy"
+}
+
+func (c *StopCommand) Help() string {
+	return command.CommandHelp(c)
+}
+
+func (c *StopCommand) Examples() map[string]string {
+	appName := os.Getenv("CLI_APP_NAME")
+	return map[string]string{
+		"Stop the previous generation of a service once traffic has moved": fmt.Sprintf("%s %s --old web", appName, c.Name()),
+	}
+}
+
+func (c *StopCommand) Arguments() []command.Argument {
+	args := []command.Argument{}
+	args = append(args, command.Argument{
+		Name:        "service-name",
+		Description: "the name of the service to stop containers of",
+		Optional:    false,
+		Type:        command.ArgumentString,
+	})
+	return args
+}
+
+func (c *StopCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictNothing
+}
+
+func (c *StopCommand) ParsedArguments(args []string) (map[string]command.Argument, error) {
+	return command.ParseArguments(args, c.Arguments())
+}
+
+func (c *StopCommand) FlagSet() *flag.FlagSet {
+	f := c.Meta.FlagSet(c.Name(), command.FlagSetClient)
+	f.StringVar(&c.file, "file", "", "the path to the Compose file")
+	f.BoolVar(&c.old, "old", false, "stop the containers that are not of the newest generation, such as those left running by --keep-old")
+	f.StringVar(&c.projectLabel, "project-label", "", "override the compose project label value used to discover containers")
+	f.StringVar(&c.projectName, "project-name", "", "the name of the project")
+	f.StringVar(&c.stopGracePeriod, "stop-grace-period", "", "override how long each container is given to exit once stopped before it is killed")
+	return f
+}
+
+func (c *StopCommand) AutocompleteFlags() complete.Flags {
+	return command.MergeAutocompleteFlags(
+		c.Meta.AutocompleteFlags(command.FlagSetClient),
+		complete.Flags{
+			"--file":              complete.PredictFiles("*"),
+			"--old":               complete.PredictNothing,
+			"--project-label":     complete.PredictAnything,
+			"--project-name":      complete.PredictAnything,
+			"--stop-grace-period": complete.PredictAnything,
+		},
+	)
+}
+
+func (c *StopCommand) Run(args []string) int {
+	flags := c.FlagSet()
+	flags.Usage = func() { c.Ui.Output(c.Help()) }
+	if err := flags.Parse(args); err != nil {
+		c.Ui.Error(err.Error())
+		c.Ui.Error(command.CommandErrorText(c))
+		return 1
+	}
+
+	arguments, err := c.ParsedArguments(flags.Args())
+	if err != nil {
+		c.Ui.Error(err.Error())
+		c.Ui.Error(command.CommandErrorText(c))
+		return 1
+	}
+
+	if !c.old {
+		c.Ui.Error("no containers selected, currently only --old is supported")
+		c.Ui.Error(command.CommandErrorText(c))
+		return 1
+	}
+
+	stopGracePeriod, err := orchestrate.ParseDurationFlag("--stop-grace-period", c.stopGracePeriod)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	if c.file == "" {
+		composeFile, err := orchestrate.ComposeFile()
+		if err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		c.file = composeFile
+	}
+
+	if c.projectName == "" {
+		c.projectName = filepath.Base(filepath.Dir(c.file))
+	}
+
+	logger, ok := c.Ui.(*command.ZerologUi)
+	if !ok {
+		c.Ui.Error("UI is not a ZerologUi")
+		return 1
+	}
+
+	client, err := orchestrate.NewClient()
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+	defer client.Close()
+
+	err = orchestrate.StopOldContainers(context.Background(), orchestrate.StopOldContainersInput{
+		Client:          client,
+		Logger:          logger,
+		ProjectLabel:    c.projectLabel,
+		ProjectName:     c.projectName,
+		ServiceName:     arguments["service-name"].StringValue(),
+		StopGracePeriod: stopGracePeriod,
+	})
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+	return 0
+}
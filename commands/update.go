@@ -0,0 +1,162 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/dokku/docker-orchestrate/pkg/orchestrate"
+	"github.com/josegonzalez/cli-skeleton/command"
+	"github.com/posener/complete"
+	flag "github.com/spf13/pflag"
+)
+
+type UpdateCommand struct {
+	command.Meta
+
+	cpus         float64
+	file         string
+	memory       string
+	projectLabel string
+	projectName  string
+}
+
+func (c *UpdateCommand) Name() string {
+	return "update"
+}
+
+func (c *UpdateCommand) Synopsis() string {
+	return "Change the resource limits of a service's running containers in place"
+}
+
+func (c *UpdateCommand) Help() string {
+	return command.CommandHelp(c)
+}
+
+func (c *UpdateCommand) Examples() map[string]string {
+	appName := os.Getenv("CLI_APP_NAME")
+	return map[string]string{
+		"Change the memory and cpu limits of a service": fmt.Sprintf("%s %s --memory 512m --cpus 1.5 web", appName, c.Name()),
+	}
+}
+
+func (c *UpdateCommand) Arguments() []command.Argument {
+	args := []command.Argument{}
+	args = append(args, command.Argument{
+		Name:        "service-name",
+		Description: "the name of the service to update",
+		Optional:    false,
+		Type:        command.ArgumentString,
+	})
+	return args
+}
+
+func (c *UpdateCommand) AutocompleteArgs() complete.Predictor {
+	return complete.PredictNothing
+}
+
+func (c *UpdateCommand) ParsedArguments(args []string) (map[string]command.Argument, error) {
+	return command.ParseArguments(args, c.Arguments())
+}
+
+func (c *UpdateCommand) FlagSet() *flag.FlagSet {
+	f := c.Meta.FlagSet(c.Name(), command.FlagSetClient)
+	f.Float64Var(&c.cpus, "cpus", 0, "the number of cpus each container may use")
+	f.StringVar(&c.file, "file", "", "the path to the Compose file")
+	f.StringVar(&c.memory, "memory", "", "the memory limit of each container, such as 512m")
+	f.StringVar(&c.projectLabel, "project-label", "", "override the compose project label value used to discover containers")
+	f.StringVar(&c.projectName, "project-name", "", "the name of the project")
+	return f
+}
+
+func (c *UpdateCommand) AutocompleteFlags() complete.Flags {
+	return command.MergeAutocompleteFlags(
+		c.Meta.AutocompleteFlags(command.FlagSetClient),
+		complete.Flags{
+			"--cpus":          complete.PredictAnything,
+			"--file":          complete.PredictFiles("*"),
+			"--memory":        complete.PredictAnything,
+			"--project-label": complete.PredictAnything,
+			"--project-name":  complete.PredictAnything,
+		},
+	)
+}
+
+func (c *UpdateCommand) Run(args []string) int {
+	flags := c.FlagSet()
+	flags.Usage = func() { c.Ui.Output(c.Help()) }
+	if err := flags.Parse(args); err != nil {
+		c.Ui.Error(err.Error())
+		c.Ui.Error(command.CommandErrorText(c))
+		return 1
+	}
+
+	arguments, err := c.ParsedArguments(flags.Args())
+	if err != nil {
+		c.Ui.Error(err.Error())
+		c.Ui.Error(command.CommandErrorText(c))
+		return 1
+	}
+
+	memory, err := orchestrate.ParseMemoryFlag("--memory", c.memory)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	if c.file == "" {
+		composeFile, err := orchestrate.ComposeFile()
+		if err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		c.file = composeFile
+	}
+
+	if c.projectName == "" {
+		c.projectName = filepath.Base(filepath.Dir(c.file))
+	}
+
+	logger, ok := c.Ui.(*command.ZerologUi)
+	if !ok {
+		c.Ui.Error("UI is not a ZerologUi")
+		return 1
+	}
+
+	// changing the limits mid-deploy would be undone by the containers the
+	// deploy replaces, so an update takes the same lock
+	lockFile := orchestrate.LockFile(filepath.Dir(c.file), c.projectName)
+	lock, err := orchestrate.AcquireDeployLock(lockFile, orchestrate.NewDeployLockHolder(c.projectName, os.Args))
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+	defer func() {
+		if err := lock.Release(); err != nil {
+			logger.Warn(fmt.Sprintf("Unable to release deploy lock: path=%s, error=%v", lockFile, err))
+		}
+	}()
+
+	client, err := orchestrate.NewClient()
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+	defer client.Close()
+
+	err = orchestrate.UpdateServiceResources(context.Background(), orchestrate.UpdateServiceResourcesInput{
+		CPUs:         c.cpus,
+		Client:       client,
+		Logger:       logger,
+		Memory:       memory,
+		ProjectLabel: c.projectLabel,
+		ProjectName:  c.projectName,
+		ServiceName:  arguments["service-name"].StringValue(),
+	})
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,53 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// cutoverError is returned when an atomic deploy fails after it has started
+// stopping old containers, at which point the prepared containers must be
+// left in place
+type cutoverError struct {
+	Err error
+}
+
+// Error returns the error message
+func (e *cutoverError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *cutoverError) Unwrap() error {
+	return e.Err
+}
+
+// cutoverProject stops the old containers of every service prepared by an
+// atomic deploy, in dependency order, and brings the new containers to the
+// naming convention
+func cutoverProject(ctx context.Context, input DeployProjectInput, projectResult *DeployProjectResult) error {
+	input.Logger.LogHeader2("Cutting over prepared services")
+	for i, summary := range projectResult.Services {
+		if summary.Outcome != OutcomeOK {
+			continue
+		}
+
+		startedAt := time.Now()
+		serviceInput := projectServiceInput(input, summary.Service)
+		serviceInput.AtomicPhase = AtomicPhaseCutover
+		// the replica count was resolved while preparing, and is kept so
+		// the cutover does not resolve a different one
+		serviceInput.AllowZero = true
+		serviceInput.Replicas = summary.Replicas
+		serviceInput.ReplicasDelta = 0
+		result, err := deployService(ctx, serviceInput)
+		projectResult.Services[i].Duration += time.Since(startedAt)
+		if err != nil {
+			projectResult.Services[i].Outcome = serviceOutcome(result, err)
+			return &cutoverError{Err: fmt.Errorf("error cutting over service %s: %v", summary.Service, err)}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,261 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/josegonzalez/cli-skeleton/command"
+	"github.com/rs/zerolog"
+)
+
+func TestDeployProjectAtomic(t *testing.T) {
+	project := &types.Project{
+		Services: types.Services{
+			"web": types.ServiceConfig{
+				Name:  "web",
+				Image: "example/web:latest",
+				Deploy: &types.DeployConfig{
+					UpdateConfig: &types.UpdateConfig{
+						Monitor: types.Duration(time.Millisecond),
+					},
+				},
+			},
+			"worker": types.ServiceConfig{
+				Name:  "worker",
+				Image: "example/worker:latest",
+				Deploy: &types.DeployConfig{
+					UpdateConfig: &types.UpdateConfig{
+						Monitor: types.Duration(time.Millisecond),
+					},
+				},
+				DependsOn: types.DependsOnConfig{
+					"web": types.ServiceDependency{Condition: types.ServiceConditionStarted},
+				},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	// newDeploy returns a client and executor sharing one set of containers,
+	// recording the order in which containers are created and stopped
+	newDeploy := func(failCreateFor string) (*mockDockerClient, CommandExecutor, *[]container.Summary, *[]string) {
+		containers := []container.Summary{}
+		for _, service := range []string{"web", "worker"} {
+			containers = append(containers, container.Summary{ID: fmt.Sprintf("old_%s_container_id", service), Created: 100, State: container.StateRunning, Labels: map[string]string{
+				"com.docker.compose.project": "test",
+				"com.docker.compose.service": service,
+			}})
+		}
+		steps := []string{}
+
+		mockClient := &mockDockerClient{
+			containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+				matched := []container.Summary{}
+				for _, c := range containers {
+					if slices.ContainsFunc(options.Filters.Get("label"), func(label string) bool {
+						key, value, _ := strings.Cut(label, "=")
+						return c.Labels[key] != value
+					}) {
+						continue
+					}
+					if slices.Contains(options.Filters.Get("status"), container.StateRunning) && c.State != container.StateRunning {
+						continue
+					}
+					matched = append(matched, c)
+				}
+				return matched, nil
+			},
+			containerStart: func(ctx context.Context, id string, options container.StartOptions) error {
+				for i := range containers {
+					if containers[i].ID == id {
+						containers[i].State = container.StateRunning
+					}
+				}
+				return nil
+			},
+			containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+				return container.InspectResponse{
+					ContainerJSONBase: &container.ContainerJSONBase{
+						Name:  "/" + id,
+						State: &container.State{Running: true},
+					},
+				}, nil
+			},
+			containerTerminate: func(ctx context.Context, id string, stopTimeout time.Duration) error {
+				steps = append(steps, "stop:"+id)
+				containers = slices.DeleteFunc(containers, func(c container.Summary) bool { return c.ID == id })
+				return nil
+			},
+			containerRemove: func(ctx context.Context, id string, options container.RemoveOptions) error {
+				steps = append(steps, "remove:"+id)
+				containers = slices.DeleteFunc(containers, func(c container.Summary) bool { return c.ID == id })
+				return nil
+			},
+		}
+
+		mockExecutor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+			if !slices.Contains(input.Args, "create") {
+				return ExecCommandResponse{ExitCode: 0}, nil
+			}
+
+			service := input.Args[len(input.Args)-1]
+			steps = append(steps, "create:"+service)
+			if service == failCreateFor {
+				return ExecCommandResponse{ExitCode: 1}, fmt.Errorf("no such image")
+			}
+			containers = append(containers, container.Summary{ID: fmt.Sprintf("new_%s_container_id", service), Created: 200, State: container.StateCreated, Labels: map[string]string{
+				"com.docker.compose.project": "test",
+				"com.docker.compose.service": service,
+				DeployIDLabel:                "deploy-1",
+			}})
+			return ExecCommandResponse{ExitCode: 0}, nil
+		}
+
+		return mockClient, mockExecutor, &containers, &steps
+	}
+
+	t.Run("prepares every service before cutting over", func(t *testing.T) {
+		mockClient, mockExecutor, containers, steps := newDeploy("")
+
+		result, err := DeployProjectWithResult(context.Background(), DeployProjectInput{
+			Atomic:                true,
+			Client:                mockClient,
+			ComposeFile:           "/tmp/docker-compose.yaml",
+			ContainerNameTemplate: "{{.ServiceName}}-{{.InstanceID}}",
+			DeployID:              "deploy-1",
+			Executor:              mockExecutor,
+			HealthStartPeriod:     time.Second,
+			Logger:                logger,
+			Project:               project,
+			ProjectName:           "test",
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected := []string{
+			"create:web",
+			"create:worker",
+			"stop:old_web_container_id",
+			"stop:old_worker_container_id",
+		}
+		if !slices.Equal(*steps, expected) {
+			t.Errorf("expected %v, got %v", expected, *steps)
+		}
+
+		ids := []string{}
+		for _, c := range *containers {
+			ids = append(ids, c.ID)
+		}
+		if !slices.Equal(ids, []string{"new_web_container_id", "new_worker_container_id"}) {
+			t.Errorf("expected only the new containers to be left, got %v", ids)
+		}
+
+		for _, summary := range result.Services {
+			if summary.Outcome != OutcomeOK || summary.Replicas != 1 {
+				t.Errorf("expected %s to be deployed with one replica, got %+v", summary.Service, summary)
+			}
+		}
+	})
+
+	t.Run("cuts over by deploy id rather than age", func(t *testing.T) {
+		mockClient, mockExecutor, containers, steps := newDeploy("")
+
+		// the old containers report a later creation time than the prepared
+		// ones will, as they would with a skewed clock
+		for i := range *containers {
+			(*containers)[i].Created = 300
+		}
+
+		err := DeployProject(context.Background(), DeployProjectInput{
+			Atomic:                true,
+			Client:                mockClient,
+			ComposeFile:           "/tmp/docker-compose.yaml",
+			ContainerNameTemplate: "{{.ServiceName}}-{{.InstanceID}}",
+			DeployID:              "deploy-1",
+			Executor:              mockExecutor,
+			Logger:                logger,
+			Project:               project,
+			ProjectName:           "test",
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected := []string{
+			"create:web",
+			"create:worker",
+			"stop:old_web_container_id",
+			"stop:old_worker_container_id",
+		}
+		if !slices.Equal(*steps, expected) {
+			t.Errorf("expected %v, got %v", expected, *steps)
+		}
+	})
+
+	t.Run("tears down prepared containers on failure", func(t *testing.T) {
+		mockClient, mockExecutor, containers, steps := newDeploy("worker")
+
+		err := DeployProject(context.Background(), DeployProjectInput{
+			Atomic:                true,
+			Client:                mockClient,
+			ComposeFile:           "/tmp/docker-compose.yaml",
+			ContainerNameTemplate: "{{.ServiceName}}-{{.InstanceID}}",
+			DeployID:              "deploy-1",
+			Executor:              mockExecutor,
+			HealthStartPeriod:     time.Second,
+			Logger:                logger,
+			Project:               project,
+			ProjectName:           "test",
+		})
+		if err == nil || !strings.Contains(err.Error(), "error preparing new containers") {
+			t.Fatalf("expected the worker prepare error, got %v", err)
+		}
+
+		expected := []string{
+			"create:web",
+			"create:worker",
+			"remove:new_web_container_id",
+		}
+		if !slices.Equal(*steps, expected) {
+			t.Errorf("expected %v, got %v", expected, *steps)
+		}
+
+		ids := []string{}
+		for _, c := range *containers {
+			ids = append(ids, c.ID)
+		}
+		if !slices.Equal(ids, []string{"old_web_container_id", "old_worker_container_id"}) {
+			t.Errorf("expected the old containers to be left as they were, got %v", ids)
+		}
+	})
+
+	t.Run("requires a deploy id", func(t *testing.T) {
+		err := DeployProject(context.Background(), DeployProjectInput{
+			Atomic:      true,
+			Client:      &mockDockerClient{},
+			ComposeFile: "/tmp/docker-compose.yaml",
+			Logger:      logger,
+			Project:     project,
+			ProjectName: "test",
+		})
+		if err == nil || err.Error() != "deploy id is required for atomic deploys" {
+			t.Errorf("expected a missing deploy id error, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,122 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/compose/v5/pkg/api"
+	"github.com/josegonzalez/cli-skeleton/command"
+)
+
+// BuildImagesInput is the input for the buildImages function
+type BuildImagesInput struct {
+	// Build is whether to build the images of build-backed services before deploying
+	Build bool
+	// Client is the Docker client to use
+	Client DockerClientInterface
+	// ComposeFile is the path to the compose file
+	ComposeFile string
+	// Executor is the command executor to use
+	Executor CommandExecutor
+	// Logger is the logger to use
+	Logger *command.ZerologUi
+	// NoBuild is whether to fail when a build-backed service has no image to deploy, rather than letting compose build it
+	NoBuild bool
+	// OverlayFiles are additional compose files layered over the compose file
+	OverlayFiles []string
+	// Project is the compose project
+	Project *types.Project
+	// ProjectName is the name of the project
+	ProjectName string
+	// ServiceNames are the services being deployed
+	ServiceNames []string
+	// SkipDatabases is whether database services are skipped, and so not built
+	SkipDatabases bool
+}
+
+// buildImages builds the images of the build-backed services up front, or
+// with NoBuild, checks that each of them already has an image, so that a
+// failed or unwanted build aborts the deploy before any container is touched
+func buildImages(ctx context.Context, input BuildImagesInput) error {
+	if !input.Build && !input.NoBuild {
+		return nil
+	}
+
+	if input.Build && input.NoBuild {
+		return fmt.Errorf("building images and disabling builds cannot be combined")
+	}
+
+	services := buildServices(input)
+	if len(services) == 0 {
+		return nil
+	}
+
+	if input.NoBuild {
+		missing := []string{}
+		for _, service := range services {
+			image := api.GetImageNameOrDefault(service, input.ProjectName)
+			if _, err := input.Client.ImageInspect(ctx, image); err != nil {
+				missing = append(missing, fmt.Sprintf("%s (%s)", service.Name, image))
+			}
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("services need building but builds are disabled: services=%s", strings.Join(missing, ","))
+		}
+		return nil
+	}
+
+	executor := input.Executor
+	if executor == nil {
+		executor = ExecCommand
+	}
+
+	serviceNames := []string{}
+	for _, service := range services {
+		serviceNames = append(serviceNames, service.Name)
+	}
+
+	input.Logger.Info(fmt.Sprintf("Building images: services=%s", strings.Join(serviceNames, ",")))
+	err := runComposeCommand(ctx, executor, ExecCommandInput{
+		Command: "docker",
+		Args: composeCommandArgs(ComposeCommandArgsInput{
+			ComposeFile:  input.ComposeFile,
+			OverlayFiles: input.OverlayFiles,
+			ProjectName:  input.ProjectName,
+		}, append([]string{"build"}, serviceNames...)...),
+		StreamStdio:      true,
+		WorkingDirectory: filepath.Dir(input.ComposeFile),
+	})
+	if err != nil {
+		return fmt.Errorf("error building images: %v", err)
+	}
+
+	input.Logger.Info(fmt.Sprintf("Built images: count=%d", len(serviceNames)))
+	return nil
+}
+
+// buildServices returns the services being deployed that have a build
+// section, in deploy order, ignoring skipped database services
+func buildServices(input BuildImagesInput) []types.ServiceConfig {
+	services := []types.ServiceConfig{}
+	for _, serviceName := range input.ServiceNames {
+		service, err := input.Project.GetService(serviceName)
+		if err != nil || service.Build == nil {
+			continue
+		}
+
+		if shouldSkipService(ShouldSkipServiceInput{
+			Logger:              input.Logger,
+			Service:             &service,
+			ShouldSkipDatabases: input.SkipDatabases,
+			SilenceLogging:      true,
+		}) {
+			continue
+		}
+
+		services = append(services, service)
+	}
+	return services
+}
@@ -0,0 +1,146 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/docker/api/types/image"
+	"github.com/josegonzalez/cli-skeleton/command"
+	"github.com/rs/zerolog"
+)
+
+func TestBuildImages(t *testing.T) {
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	project := &types.Project{
+		Services: types.Services{
+			"web": types.ServiceConfig{
+				Name:  "web",
+				Image: "example/web:dev",
+				Build: &types.BuildConfig{Context: "."},
+			},
+			"worker": types.ServiceConfig{
+				Name:  "worker",
+				Build: &types.BuildConfig{Context: "./worker"},
+			},
+			"proxy": types.ServiceConfig{
+				Name:  "proxy",
+				Image: "nginx:1.27",
+			},
+		},
+	}
+	serviceNames := []string{"proxy", "web", "worker"}
+
+	t.Run("builds only build-backed services", func(t *testing.T) {
+		calls := [][]string{}
+		executor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+			calls = append(calls, input.Args)
+			return ExecCommandResponse{ExitCode: 0}, nil
+		}
+
+		err := buildImages(context.Background(), BuildImagesInput{
+			Build:        true,
+			Client:       &mockDockerClient{},
+			ComposeFile:  "/app/docker-compose.yaml",
+			Executor:     executor,
+			Logger:       logger,
+			Project:      project,
+			ProjectName:  "proj",
+			ServiceNames: serviceNames,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected := [][]string{{"compose", "-f", "/app/docker-compose.yaml", "-p", "proj", "build", "web", "worker"}}
+		if !slices.EqualFunc(calls, expected, slices.Equal) {
+			t.Errorf("expected a single build of the build-backed services\nexpected: %v\ngot:      %v", expected, calls)
+		}
+	})
+
+	t.Run("not built without the flag", func(t *testing.T) {
+		executor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+			t.Errorf("expected no command to be run, got %v", input.Args)
+			return ExecCommandResponse{ExitCode: 0}, nil
+		}
+
+		err := buildImages(context.Background(), BuildImagesInput{
+			Client:       &mockDockerClient{},
+			ComposeFile:  "/app/docker-compose.yaml",
+			Executor:     executor,
+			Logger:       logger,
+			Project:      project,
+			ProjectName:  "proj",
+			ServiceNames: serviceNames,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("no build fails for services without an image", func(t *testing.T) {
+		inspected := []string{}
+		mockClient := &mockDockerClient{
+			imageInspect: func(ctx context.Context, imageID string) (image.InspectResponse, error) {
+				inspected = append(inspected, imageID)
+				if imageID == "proj-worker" {
+					return image.InspectResponse{}, errors.New("no such image")
+				}
+				return image.InspectResponse{ID: imageID}, nil
+			},
+		}
+		executor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+			t.Errorf("expected no command to be run, got %v", input.Args)
+			return ExecCommandResponse{ExitCode: 0}, nil
+		}
+
+		err := buildImages(context.Background(), BuildImagesInput{
+			Client:       mockClient,
+			ComposeFile:  "/app/docker-compose.yaml",
+			Executor:     executor,
+			Logger:       logger,
+			NoBuild:      true,
+			Project:      project,
+			ProjectName:  "proj",
+			ServiceNames: serviceNames,
+		})
+		if err == nil || err.Error() != "services need building but builds are disabled: services=worker (proj-worker)" {
+			t.Errorf("expected the service without an image to be reported, got %v", err)
+		}
+		if !slices.Equal(inspected, []string{"example/web:dev", "proj-worker"}) {
+			t.Errorf("expected only build-backed images to be inspected, got %v", inspected)
+		}
+	})
+
+	t.Run("build failure", func(t *testing.T) {
+		executor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+			return ExecCommandResponse{ExitCode: 1}, errors.New("failed to solve: dockerfile parse error")
+		}
+
+		err := buildImages(context.Background(), BuildImagesInput{
+			Build:        true,
+			Client:       &mockDockerClient{},
+			ComposeFile:  "/app/docker-compose.yaml",
+			Executor:     executor,
+			Logger:       logger,
+			Project:      project,
+			ProjectName:  "proj",
+			ServiceNames: serviceNames,
+		})
+		if err == nil || !strings.Contains(err.Error(), "error building images: failed to solve") {
+			t.Errorf("expected a build error, got %v", err)
+		}
+	})
+}
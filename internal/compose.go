@@ -5,8 +5,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"os"
 	"path/filepath"
+	"regexp"
 	"slices"
 	"strings"
 	"sync"
@@ -14,6 +17,7 @@ import (
 	"time"
 
 	"github.com/compose-spec/compose-go/v2/cli"
+	"github.com/compose-spec/compose-go/v2/consts"
 	"github.com/compose-spec/compose-go/v2/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
@@ -46,19 +50,53 @@ func ComposeFile() (string, error) {
 	return "", errors.New("no compose file found")
 }
 
+// ComposeFiles gets the compose file from the current directory along with
+// the docker-compose.override file, if present, in the order compose
+// merges them
+func ComposeFiles() ([]string, error) {
+	composeFile, err := ComposeFile()
+	if err != nil {
+		return nil, err
+	}
+
+	composeFiles := []string{composeFile}
+	for _, overrideFile := range []string{"docker-compose.override.yaml", "docker-compose.override.yml"} {
+		if _, err := os.Stat(overrideFile); err != nil {
+			continue
+		}
+
+		overrideFile, err = filepath.Abs(overrideFile)
+		if err != nil {
+			return nil, fmt.Errorf("error expanding path: %v", err)
+		}
+
+		// compose only merges the first override file found
+		composeFiles = append(composeFiles, overrideFile)
+		break
+	}
+
+	return composeFiles, nil
+}
+
 // ComposeProject reads the compose file specified by the filename
 // and returns the compose types.Project
 func ComposeProject(projectName string, filename string, profiles []string) (*types.Project, error) {
+	return ComposeProjectFiles(projectName, []string{filename}, profiles)
+}
+
+// ComposeProjectFiles reads and merges the compose files specified by the
+// filenames, in order, and returns the compose types.Project
+func ComposeProjectFiles(projectName string, filenames []string, profiles []string) (*types.Project, error) {
 	ctx := context.Background()
 
 	opts := []cli.ProjectOptionsFn{
 		cli.WithOsEnv,
 		cli.WithDotEnv,
-		cli.WithDefaultProfiles(profiles...),
+		withMergedProfiles(profiles),
 		cli.WithName(projectName),
 	}
 
-	options, err := cli.NewProjectOptions([]string{filename}, opts...)
+	options, err := cli.NewProjectOptions(filenames, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("error creating project options: %v", err)
 	}
@@ -71,10 +109,126 @@ func ComposeProject(projectName string, filename string, profiles []string) (*ty
 	return project, nil
 }
 
+// withMergedProfiles activates the given profiles along with any listed in
+// COMPOSE_PROFILES. Compose itself only reads the variable when no profiles
+// are passed, so the two are merged here instead.
+func withMergedProfiles(profiles []string) cli.ProjectOptionsFn {
+	return func(o *cli.ProjectOptions) error {
+		merged := slices.Clone(profiles)
+		for _, profile := range strings.Split(o.Environment[consts.ComposeProfiles], ",") {
+			profile = strings.TrimSpace(profile)
+			if profile != "" && !slices.Contains(merged, profile) {
+				merged = append(merged, profile)
+			}
+		}
+		return cli.WithProfiles(merged)(o)
+	}
+}
+
+// DumpComposeConfig writes the fully-resolved compose project as YAML to the
+// specified path
+func DumpComposeConfig(project *types.Project, path string) error {
+	contents, err := project.MarshalYAML()
+	if err != nil {
+		return fmt.Errorf("error marshaling compose config: %v", err)
+	}
+
+	if err := os.WriteFile(path, contents, 0644); err != nil {
+		return fmt.Errorf("error writing compose config: %v", err)
+	}
+
+	return nil
+}
+
+// ComposeCommandArgsInput is the input for the composeCommandArgs function
+type ComposeCommandArgsInput struct {
+	// ComposeFile is the path to the compose file
+	ComposeFile string
+	// OverlayFiles are additional compose files layered over the compose file
+	OverlayFiles []string
+	// ProjectName is the name of the project
+	ProjectName string
+	// QuietPull is whether to suppress the per-layer progress of image pulls
+	QuietPull bool
+	// RecreateAnonymousVolumes is whether to recreate anonymous volumes instead of reusing them
+	RecreateAnonymousVolumes bool
+	// SkipPull is whether compose uses the local image rather than pulling it, whatever the pull_policy of the service
+	SkipPull bool
+}
+
+// composeCommandArgs builds the arguments for a `docker compose` invocation
+// against the project, followed by the specified subcommand arguments
+func composeCommandArgs(input ComposeCommandArgsInput, args ...string) []string {
+	composeArgs := []string{"compose", "-f", input.ComposeFile}
+	for _, overlayFile := range input.OverlayFiles {
+		composeArgs = append(composeArgs, "-f", overlayFile)
+	}
+	composeArgs = append(composeArgs, "-p", input.ProjectName)
+	if len(args) == 0 {
+		return composeArgs
+	}
+
+	// subcommand flags must follow the subcommand itself
+	subcommand := args[0]
+	creates := subcommand == "create" || subcommand == "up"
+
+	// anonymous volumes are only inherited when compose recreates an existing
+	// container, and compose rejects --renew-anon-volumes alongside
+	// --no-recreate, so the flag is only passed to invocations that may
+	// recreate. compose only accepts it on up, so such a create runs as the
+	// equivalent up --no-start.
+	renew := input.RecreateAnonymousVolumes && creates && !slices.Contains(args[1:], "--no-recreate")
+	if renew && subcommand == "create" {
+		composeArgs = append(composeArgs, "up", "--no-start")
+	} else {
+		composeArgs = append(composeArgs, subcommand)
+	}
+	if renew {
+		composeArgs = append(composeArgs, "--renew-anon-volumes")
+	}
+	if input.QuietPull && creates {
+		composeArgs = append(composeArgs, "--quiet-pull")
+	}
+	if input.SkipPull && creates {
+		composeArgs = append(composeArgs, "--pull", "never")
+	}
+	return append(composeArgs, args[1:]...)
+}
+
+// runComposeCommand runs a `docker compose` invocation, capturing its stderr
+// so that a failure carries the reason compose gave, such as a denied image
+// pull, rather than only its exit status
+func runComposeCommand(ctx context.Context, executor CommandExecutor, input ExecCommandInput) error {
+	var stderr bytes.Buffer
+	if input.StderrWriter != nil {
+		input.StderrWriter = io.MultiWriter(input.StderrWriter, &stderr)
+	} else {
+		input.StderrWriter = &stderr
+	}
+
+	_, err := executor(ctx, input)
+	if err == nil {
+		return nil
+	}
+
+	output := strings.TrimSpace(stderr.String())
+	if output == "" {
+		return err
+	}
+	if strings.Contains(err.Error(), output) {
+		return &ErrorWithOutput{Err: err, Output: output}
+	}
+	return &ErrorWithOutput{Err: fmt.Errorf("%v: %s", err, output), Output: output}
+}
+
 // ComposeContainersInput is the input for the ComposeContainers function
 type ComposeContainersInput struct {
 	// Client is the Docker client to use. If nil, a new one will be created.
 	Client DockerClientInterface
+	// ExtraFilters are additional filters narrowing the containers returned, such as a deploy-id label
+	ExtraFilters []filters.KeyValuePair
+	// ProjectLabel overrides the com.docker.compose.project label value used to discover containers. Defaults to ProjectName.
+	ProjectLabel string
 	// ProjectName is the name of the project
 	ProjectName string
 	// ServiceName is the name of the service
@@ -83,6 +237,15 @@ type ComposeContainersInput struct {
 	Status string
 }
 
+// deployIDFilters returns the filters narrowing containers to those stamped
+// with the deploy ID, or none when the deploy ID is empty
+func deployIDFilters(deployID string) []filters.KeyValuePair {
+	if deployID == "" {
+		return nil
+	}
+	return []filters.KeyValuePair{filters.Arg("label", fmt.Sprintf("%s=%s", DeployIDLabel, deployID))}
+}
+
 // composeContainers returns detailed information about containers
 func composeContainers(input ComposeContainersInput) ([]container.Summary, error) {
 	if input.Client == nil {
@@ -93,7 +256,11 @@ func composeContainers(input ComposeContainersInput) ([]container.Summary, error
 
 	// Build filters for container labels
 	filterArgs := filters.NewArgs()
-	filterArgs.Add("label", fmt.Sprintf("com.docker.compose.project=%s", input.ProjectName))
+	projectLabel := input.ProjectName
+	if input.ProjectLabel != "" {
+		projectLabel = input.ProjectLabel
+	}
+	filterArgs.Add("label", fmt.Sprintf("com.docker.compose.project=%s", projectLabel))
 	if input.ServiceName != "" {
 		filterArgs.Add("label", fmt.Sprintf("com.docker.compose.service=%s", input.ServiceName))
 	}
@@ -101,6 +268,9 @@ func composeContainers(input ComposeContainersInput) ([]container.Summary, error
 	if input.Status != "" {
 		filterArgs.Add("status", input.Status)
 	}
+	for _, extraFilter := range input.ExtraFilters {
+		filterArgs.Add(extraFilter.Key, extraFilter.Value)
+	}
 
 	// List containers with filters
 	return input.Client.ContainerList(ctx, container.ListOptions{
@@ -109,12 +279,57 @@ func composeContainers(input ComposeContainersInput) ([]container.Summary, error
 	})
 }
 
+// RemoveLeftoverContainersInput contains the parameters for removing leftover containers
+type RemoveLeftoverContainersInput struct {
+	// Client is the Docker client to use
+	Client DockerClientInterface
+	// Logger is the logger to use
+	Logger *command.ZerologUi
+	// ProjectLabel overrides the com.docker.compose.project label value used to discover containers. Defaults to ProjectName.
+	ProjectLabel string
+	// ProjectName is the name of the project
+	ProjectName string
+	// ServiceName is the name of the service
+	ServiceName string
+}
+
+// removeLeftoverContainers removes containers of a service that were created
+// but never started, or that have since exited or died
+func removeLeftoverContainers(ctx context.Context, input RemoveLeftoverContainersInput) error {
+	containers, err := composeContainers(ComposeContainersInput{
+		Client:       input.Client,
+		ProjectLabel: input.ProjectLabel,
+		ProjectName:  input.ProjectName,
+		ServiceName:  input.ServiceName,
+	})
+	if err != nil {
+		return fmt.Errorf("error getting leftover containers: %v", err)
+	}
+
+	for _, c := range containers {
+		if c.State != container.StateCreated && c.State != container.StateExited && c.State != container.StateDead {
+			continue
+		}
+
+		input.Logger.Info(fmt.Sprintf("Removing leftover container: id=%s, state=%s", c.ID[:12], c.State))
+		if err := input.Client.ContainerRemove(ctx, c.ID, container.RemoveOptions{}); err != nil {
+			return fmt.Errorf("error removing leftover container %s: %v", c.ID[:12], err)
+		}
+	}
+
+	return nil
+}
+
 // RollingUpdateInput contains the parameters for rolling update
 type RollingUpdateInput struct {
+	// BatchTurn is called before each batch and blocks until the batch may start, returning a function that passes the turn on once the batch succeeds. If nil, batches start right away.
+	BatchTurn func(ctx context.Context) (func(), error)
 	// Client is the Docker client to use. If nil, a new one will be created.
 	Client DockerClientInterface
 	// ComposeFile is the path to the compose file
 	ComposeFile string
+	// ContainerTimeout is an absolute ceiling on how long any single container may take to become healthy
+	ContainerTimeout time.Duration
 	// ContainersToUpdate is the list of containers to update
 	ContainersToUpdate []container.Summary
 	// CurrentReplicas is the current number of replicas
@@ -123,36 +338,96 @@ type RollingUpdateInput struct {
 	Delay time.Duration
 	// DesiredReplicas is the target number of replicas
 	DesiredReplicas int
+	// DrainCommand is the host command run for each container just before it is stopped, with the container still up
+	DrainCommand string
+	// DrainTimeout is how long to wait after the drain command before stopping the container
+	DrainTimeout time.Duration
 	// Executor is the command executor to use. If nil, ExecCommand will be used.
 	Executor CommandExecutor
 	// FailureAction is the action to take on failure (pause or empty)
 	FailureAction string
+	// FailureLogLines is the number of trailing log lines printed for each container that fails its healthcheck
+	FailureLogLines int
 	// HealthcheckCommand is the command to run for health checks
 	HealthcheckCommand string
+	// HealthcheckExpectOutput is the pattern the output of the healthcheck command must match for the check to pass
+	HealthcheckExpectOutput *regexp.Regexp
+	// HealthcheckMode is how the docker healthcheck status is followed, either poll or events
+	HealthcheckMode string
+	// HealthcheckScheme is the scheme of the published URL handed to the healthcheck command
+	HealthcheckScheme string
+	// InheritLabels are the labels copied from each batch's old containers onto their replacements
+	InheritLabels []string
+	// KeepOld is whether to leave the old containers running once their replacements are healthy (start-first only)
+	KeepOld bool
 	// Logger is the logger to use
 	Logger *command.ZerologUi
 	// MaxFailureRatio is the maximum allowed failure ratio
 	MaxFailureRatio float32
+	// MaxOldContainers is the number of containers allowed above the desired replicas during a start-first update. Defaults to Parallelism.
+	MaxOldContainers int
+	// Metrics records the new containers becoming healthy or failing. If nil, nothing is recorded.
+	Metrics *DeployMetrics
 	// Monitor is the health check monitoring duration
 	Monitor time.Duration
+	// OnHealthyHostCommand is the command to run on the host for each new container once it is healthy
+	OnHealthyHostCommand string
+	// OnUnhealthyHostCommand is the command to run on the host for each new container that fails its healthcheck, before it is terminated
+	OnUnhealthyHostCommand string
 	// Order is the update order strategy (start-first or stop-first)
 	Order string
+	// OverlayFiles are additional compose files layered over the compose file
+	OverlayFiles []string
 	// Parallelism is the number of containers to update simultaneously
 	Parallelism int
+	// ParallelismBudget is shared with the other services of the deploy, each batch holding a slot per container. If nil, only Parallelism bounds the batches.
+	ParallelismBudget *ParallelismBudget
+	// PerReplicaVolume is the Go template for a volume spec bound to each container. Replacements bind the volume of the container they replace.
+	PerReplicaVolume string
+	// Profiles are the active compose profiles
+	Profiles []string
 	// ProjectDir is the project directory
 	ProjectDir string
+	// ProjectLabel overrides the com.docker.compose.project label value used to discover containers. Defaults to ProjectName.
+	ProjectLabel string
 	// ProjectName is the name of the project
 	ProjectName string
+	// QuietPull is whether to suppress the per-layer progress of image pulls
+	QuietPull bool
+	// RecreateAnonymousVolumes is whether to recreate anonymous volumes instead of reusing them
+	RecreateAnonymousVolumes bool
+	// RunningGrace is how long a container without a healthcheck must stay running before it is considered healthy. If 0, it is healthy as soon as it is running.
+	RunningGrace time.Duration
 	// ServiceName is the name of the service
 	ServiceName string
+	// ServiceReadinessCommand is a host command run once per batch that gates the whole batch in place of the per-container healthchecks
+	ServiceReadinessCommand string
+	// SkipPull is whether the service's image is never pulled, relying on the local image
+	SkipPull bool
 	// Sleeper is the function to use for sleeping. If nil, time.Sleep will be used.
 	Sleeper func(time.Duration)
+	// SkipCleanupHooks is whether new containers that fail are terminated without running the stop hooks
+	SkipCleanupHooks bool
+	// SkipHealthcheck is whether to consider new containers healthy without waiting on their healthchecks
+	SkipHealthcheck bool
+	// StartPeriod is the healthcheck start period for new containers
+	StartPeriod time.Duration
+	// PreStopCommand is the command to run inside a container before stopping it
+	PreStopCommand string
 	// PreStopHostCommand is the command to run before stopping a container
 	PreStopHostCommand string
+	// PreStopOrder is which pre-stop command runs first, either host-first or container-first
+	PreStopOrder string
 	// PostStopHostCommand is the command to run after stopping a container
 	PostStopHostCommand string
+	// StopGracePeriod is how long a container is given to exit once stopped before it is killed, or 0 for its own stop timeout
+	StopGracePeriod time.Duration
+	// SuccessThreshold is the number of consecutive healthy readings required before a container is considered healthy
+	SuccessThreshold int
 	// TickerCh is an optional channel to use for ticking. If nil, time.NewTicker will be used.
 	TickerCh <-chan time.Time
+	// Warnings collects the warnings raised while updating, if set
+	Warnings *DeployWarnings
 }
 
 // RollingUpdateOutput is the output of the rollingUpdateContainers function
@@ -175,32 +450,58 @@ func rollingUpdateContainers(ctx context.Context, input RollingUpdateInput) (Rol
 		input.Sleeper = time.Sleep
 	}
 
+	if input.Parallelism < 1 {
+		input.Parallelism = 1
+	}
+
 	output := RollingUpdateOutput{
 		Failures:     0,
 		TotalUpdates: 0,
 	}
 
+	totalContainers := len(input.ContainersToUpdate)
+	totalBatches := (totalContainers + input.Parallelism - 1) / input.Parallelism
+
 	// Process containers in batches based on parallelism
-	for i := 0; i < len(input.ContainersToUpdate); i += input.Parallelism {
+	for i := 0; i < totalContainers; i += input.Parallelism {
 		batchSize := input.Parallelism
-		if i+batchSize > len(input.ContainersToUpdate) {
-			batchSize = len(input.ContainersToUpdate) - i
+		if i+batchSize > totalContainers {
+			batchSize = totalContainers - i
 		}
 
 		batch := input.ContainersToUpdate[i : i+batchSize]
 
-		if input.Order == "start-first" {
-			if err := rollingUpdateBatchStartFirst(ctx, input, batch, &output); err != nil {
+		// a failed batch keeps the turn, as the failure pauses the services
+		// the batches are interleaved with
+		passTurn := func() {}
+		if input.BatchTurn != nil {
+			var err error
+			passTurn, err = input.BatchTurn(ctx)
+			if err != nil {
 				return output, err
 			}
+		}
+
+		release, err := input.ParallelismBudget.acquire(ctx, len(batch))
+		if err != nil {
+			return output, err
+		}
+
+		input.Logger.Info(fmt.Sprintf("Rolling update progress: batch=%d/%d, complete=%d%%", i/input.Parallelism+1, totalBatches, i*100/totalContainers))
+
+		if input.Order == "start-first" {
+			err = rollingUpdateBatchStartFirst(ctx, input, batch, &output)
 		} else {
-			if err := rollingUpdateBatchStopFirst(ctx, input, batch, &output); err != nil {
-				return output, err
-			}
+			err = rollingUpdateBatchStopFirst(ctx, input, batch, &output)
+		}
+		release()
+		if err != nil {
+			return output, err
 		}
+		passTurn()
 
 		// Wait for delay between batches (except for the last batch)
-		if i+batchSize < len(input.ContainersToUpdate) && input.Delay > 0 {
+		if i+batchSize < totalContainers && input.Delay > 0 {
 			input.Logger.Info(fmt.Sprintf("Waiting before next batch: %v", input.Delay))
 			input.Sleeper(input.Delay)
 		}
@@ -211,43 +512,49 @@ func rollingUpdateContainers(ctx context.Context, input RollingUpdateInput) (Rol
 
 // rollingUpdateBatchStartFirst starts the new containers first
 func rollingUpdateBatchStartFirst(ctx context.Context, input RollingUpdateInput, batch []container.Summary, output *RollingUpdateOutput) error {
+	overlayFiles, cleanup, err := batchOverlayFiles(ctx, input, batch)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
 	// Get currently running containers to determine current scale
 	currentContainers, err := composeContainers(ComposeContainersInput{
-		Client:      input.Client,
-		ProjectName: input.ProjectName,
-		ServiceName: input.ServiceName,
-		Status:      "running",
+		Client:       input.Client,
+		ProjectLabel: input.ProjectLabel,
+		ProjectName:  input.ProjectName,
+		ServiceName:  input.ServiceName,
+		Status:       "running",
 	})
 	if err != nil {
 		return fmt.Errorf("error getting current containers: %v", err)
 	}
 
-	// Start new containers
+	// Guard against old containers accumulating when replacements keep failing
 	newScale := len(currentContainers) + len(batch)
-	_, err = input.Executor(ctx, ExecCommandInput{
-		Command: "docker",
-		Args: []string{
-			"compose",
-			"-f", input.ComposeFile,
-			"-p", input.ProjectName,
-			"up",
-			"--detach",
-			"--scale", fmt.Sprintf("%s=%d", input.ServiceName, newScale),
-			"--no-deps",
-			"--no-recreate",
-			input.ServiceName,
-		},
-		WorkingDirectory: input.ProjectDir,
-	})
+	if input.DesiredReplicas > 0 && !input.KeepOld {
+		maxOldContainers := input.MaxOldContainers
+		if maxOldContainers <= 0 {
+			maxOldContainers = input.Parallelism
+		}
+		maxLiveContainers := input.DesiredReplicas + maxOldContainers
+		if newScale > maxLiveContainers {
+			return fmt.Errorf("live container count would exceed safety cap (%d > %d), pausing deployment", newScale, maxLiveContainers)
+		}
+	}
+
+	// Start new containers
+	err = startReplacementContainers(ctx, input, overlayFiles, currentContainers, batch)
 	if err != nil {
 		return fmt.Errorf("error creating new containers: %v", err)
 	}
 
 	// Get all containers to find the new ones
 	allContainers, err := composeContainers(ComposeContainersInput{
-		Client:      input.Client,
-		ProjectName: input.ProjectName,
-		ServiceName: input.ServiceName,
+		Client:       input.Client,
+		ProjectLabel: input.ProjectLabel,
+		ProjectName:  input.ProjectName,
+		ServiceName:  input.ServiceName,
 	})
 	if err != nil {
 		return fmt.Errorf("error getting containers after scale up: %v", err)
@@ -286,6 +593,19 @@ func rollingUpdateBatchStartFirst(ctx context.Context, input RollingUpdateInput,
 	}
 	close(oldContainersToStop)
 
+	input.Metrics.containersStarted(input.ServiceName, len(newContainers))
+
+	healthStatusCache := NewHealthStatusCache(input.Client, containerIDs(newContainers), input.Monitor)
+	serviceReadiness := serviceReadinessOnce(ctx, WaitForServiceReadinessInput{
+		Client:       input.Client,
+		Command:      input.ServiceReadinessCommand,
+		ContainerIDs: containerIDs(newContainers),
+		Executor:     input.Executor,
+		Monitor:      input.Monitor,
+		ServiceName:  input.ServiceName,
+		StartPeriod:  input.StartPeriod,
+		TickerCh:     input.TickerCh,
+	}, nil)
 	for _, nc := range newContainers {
 		wg.Add(1)
 		go func(newContainer container.Summary) {
@@ -297,16 +617,31 @@ func rollingUpdateBatchStartFirst(ctx context.Context, input RollingUpdateInput,
 
 			input.Logger.Info(fmt.Sprintf("Waiting for container to become healthy: %s", newContainer.ID[:12]))
 			healthcheckInput := WaitForHealthcheckInput{
-				Client:             input.Client,
-				ContainerID:        newContainer.ID,
-				Executor:           input.Executor,
-				HealthcheckCommand: input.HealthcheckCommand,
-				Monitor:            input.Monitor,
-				ServiceName:        input.ServiceName,
-				TickerCh:           input.TickerCh,
+				Client:                  input.Client,
+				ContainerID:             newContainer.ID,
+				ContainerTimeout:        input.ContainerTimeout,
+				Executor:                input.Executor,
+				HealthcheckCommand:      input.HealthcheckCommand,
+				HealthcheckExpectOutput: input.HealthcheckExpectOutput,
+				HealthcheckMode:         input.HealthcheckMode,
+				HealthcheckScheme:       input.HealthcheckScheme,
+				HealthStatusCache:       healthStatusCache,
+				Monitor:                 input.Monitor,
+				RunningGrace:            input.RunningGrace,
+				ServiceName:             input.ServiceName,
+				SkipHealthcheck:         input.SkipHealthcheck,
+				StartPeriod:             input.StartPeriod,
+				SuccessThreshold:        input.SuccessThreshold,
+				TickerCh:                input.TickerCh,
 			}
 
-			if err := waitForHealthcheck(ctx, healthcheckInput); err != nil {
+			var err error
+			if input.ServiceReadinessCommand != "" && !input.SkipHealthcheck {
+				err = serviceReadiness()
+			} else {
+				err = waitForHealthcheck(ctx, healthcheckInput)
+			}
+			if err != nil {
 				input.Logger.Info(fmt.Sprintf("Container %s failed health check: %v", newContainer.ID[:12], err))
 				if eo, ok := err.(*ErrorWithOutput); ok {
 					lines := strings.Split(eo.Output, "\n")
@@ -314,34 +649,47 @@ func rollingUpdateBatchStartFirst(ctx context.Context, input RollingUpdateInput,
 						input.Logger.Info(fmt.Sprintf("    %s", line))
 					}
 				}
+				dumpContainerLogs(ctx, input.Logger, input.Client, newContainer.ID, input.FailureLogLines)
 
 				mu.Lock()
 				output.Failures++
 				mu.Unlock()
+				input.Metrics.containerFailed(input.ServiceName)
+
+				runHostHook(ctx, input.Logger, runScriptInput{
+					Client:        input.Client,
+					ContainerID:   newContainer.ID,
+					Executor:      input.Executor,
+					FailureOutput: healthcheckFailureOutput(err),
+					ServiceName:   input.ServiceName,
+					Script:        input.OnUnhealthyHostCommand,
+					ScriptType:    "on-unhealthy",
+					Warnings:      input.Warnings,
+				})
 
 				// Clean up failed container
-				_ = runHostScript(ctx, runScriptInput{
-					Client:      input.Client,
-					ContainerID: newContainer.ID,
-					Executor:    input.Executor,
-					ServiceName: input.ServiceName,
-					Script:      input.PreStopHostCommand,
-					ScriptType:  "pre-stop",
-				})
-				_ = input.Client.ContainerTerminate(ctx, newContainer.ID)
-				_ = runHostScript(ctx, runScriptInput{
-					Client:      input.Client,
-					ContainerID: newContainer.ID,
-					Executor:    input.Executor,
-					ServiceName: input.ServiceName,
-					Script:      input.PostStopHostCommand,
-					ScriptType:  "post-stop",
-				})
+				stopFailedContainer(ctx, input, newContainer.ID)
 
 				// We don't return error here because we want to continue with others in batch
 				// but we check failure ratio later
 				return
 			}
+			input.Metrics.containerHealthy(input.ServiceName)
+
+			runHostHook(ctx, input.Logger, runScriptInput{
+				Client:      input.Client,
+				ContainerID: newContainer.ID,
+				Executor:    input.Executor,
+				ServiceName: input.ServiceName,
+				Script:      input.OnHealthyHostCommand,
+				ScriptType:  "on-healthy",
+				Warnings:    input.Warnings,
+			})
+
+			if input.KeepOld {
+				input.Logger.Info(fmt.Sprintf("Container %s is healthy, keeping old containers running", newContainer.ID[:12]))
+				return
+			}
 
 			// Pop an old container to stop
 			oldContainer, ok := <-oldContainersToStop
@@ -356,16 +704,24 @@ func rollingUpdateBatchStartFirst(ctx context.Context, input RollingUpdateInput,
 				}
 
 				input.Logger.Info(fmt.Sprintf("Container %s is healthy, stopping %s", newContainer.ID[:12], oldContainerIdentifier))
-				_ = runHostScript(ctx, runScriptInput{
-					Client:      input.Client,
-					ContainerID: oldContainer.ID,
-					Executor:    input.Executor,
-					ServiceName: input.ServiceName,
-					Script:      input.PreStopHostCommand,
-					ScriptType:  "pre-stop",
+				runPreStopHooks(ctx, PreStopHooksInput{
+					Client:          input.Client,
+					Command:         input.PreStopCommand,
+					ContainerID:     oldContainer.ID,
+					DrainCommand:    input.DrainCommand,
+					DrainTimeout:    input.DrainTimeout,
+					Executor:        input.Executor,
+					HostCommand:     input.PreStopHostCommand,
+					Logger:          input.Logger,
+					Order:           input.PreStopOrder,
+					ServiceName:     input.ServiceName,
+					StopGracePeriod: input.StopGracePeriod,
+					Warnings:        input.Warnings,
 				})
-				if err := input.Client.ContainerTerminate(ctx, oldContainer.ID); err != nil {
+				if err := input.Client.ContainerTerminateWithTimeout(ctx, oldContainer.ID, input.StopGracePeriod); err != nil {
 					input.Logger.Info(fmt.Sprintf("Error stopping old container %s: %v", oldContainerIdentifier, err))
+				} else {
+					input.Metrics.containerStopped(input.ServiceName)
 				}
 				_ = runHostScript(ctx, runScriptInput{
 					Client:      input.Client,
@@ -402,6 +758,12 @@ func rollingUpdateBatchStartFirst(ctx context.Context, input RollingUpdateInput,
 
 // rollingUpdateBatchStopFirst stops the old containers first
 func rollingUpdateBatchStopFirst(ctx context.Context, input RollingUpdateInput, batch []container.Summary, output *RollingUpdateOutput) error {
+	overlayFiles, cleanup, err := batchOverlayFiles(ctx, input, batch)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
 	input.Logger.Info(fmt.Sprintf("Stopping %d old containers first", len(batch)))
 
 	g, stopCtx := errgroup.WithContext(ctx)
@@ -416,15 +778,24 @@ func rollingUpdateBatchStopFirst(ctx context.Context, input RollingUpdateInput,
 		}
 		g.Go(func() error {
 			input.Logger.Info(fmt.Sprintf("Stopping container %s", containerIdentifier))
-			_ = runHostScript(ctx, runScriptInput{
-				Client:      input.Client,
-				ContainerID: containerID,
-				Executor:    input.Executor,
-				ServiceName: input.ServiceName,
-				Script:      input.PreStopHostCommand,
-				ScriptType:  "pre-stop",
+			runPreStopHooks(ctx, PreStopHooksInput{
+				Client:          input.Client,
+				Command:         input.PreStopCommand,
+				ContainerID:     containerID,
+				DrainCommand:    input.DrainCommand,
+				DrainTimeout:    input.DrainTimeout,
+				Executor:        input.Executor,
+				HostCommand:     input.PreStopHostCommand,
+				Logger:          input.Logger,
+				Order:           input.PreStopOrder,
+				ServiceName:     input.ServiceName,
+				StopGracePeriod: input.StopGracePeriod,
+				Warnings:        input.Warnings,
 			})
-			err := input.Client.ContainerTerminate(stopCtx, containerID)
+			err := input.Client.ContainerTerminateWithTimeout(stopCtx, containerID, input.StopGracePeriod)
+			if err == nil {
+				input.Metrics.containerStopped(input.ServiceName)
+			}
 			_ = runHostScript(ctx, runScriptInput{
 				Client:      input.Client,
 				ContainerID: containerID,
@@ -445,40 +816,27 @@ func rollingUpdateBatchStopFirst(ctx context.Context, input RollingUpdateInput,
 	// We want to scale back up to target replicas (or current replicas if we are in middle of update)
 	// Actually, we should scale up to whatever the count was before we stopped these
 	currentContainers, err := composeContainers(ComposeContainersInput{
-		Client:      input.Client,
-		ProjectName: input.ProjectName,
-		ServiceName: input.ServiceName,
+		Client:       input.Client,
+		ProjectLabel: input.ProjectLabel,
+		ProjectName:  input.ProjectName,
+		ServiceName:  input.ServiceName,
 	})
 	if err != nil {
 		return fmt.Errorf("error getting current containers: %v", err)
 	}
 
 	// Start new containers
-	targetScale := len(currentContainers) + len(batch)
-	_, err = input.Executor(ctx, ExecCommandInput{
-		Command: "docker",
-		Args: []string{
-			"compose",
-			"-f", input.ComposeFile,
-			"-p", input.ProjectName,
-			"up",
-			"--detach",
-			"--scale", fmt.Sprintf("%s=%d", input.ServiceName, targetScale),
-			"--no-deps",
-			"--no-recreate",
-			input.ServiceName,
-		},
-		WorkingDirectory: input.ProjectDir,
-	})
+	err = startReplacementContainers(ctx, input, overlayFiles, currentContainers, batch)
 	if err != nil {
 		return fmt.Errorf("error starting new containers: %v", err)
 	}
 
 	// Get all containers to find the new ones
 	allContainers, err := composeContainers(ComposeContainersInput{
-		Client:      input.Client,
-		ProjectName: input.ProjectName,
-		ServiceName: input.ServiceName,
+		Client:       input.Client,
+		ProjectLabel: input.ProjectLabel,
+		ProjectName:  input.ProjectName,
+		ServiceName:  input.ServiceName,
 	})
 	if err != nil {
 		return fmt.Errorf("error getting containers after scale up: %v", err)
@@ -507,6 +865,19 @@ func rollingUpdateBatchStopFirst(ctx context.Context, input RollingUpdateInput,
 	var wg sync.WaitGroup
 	var mu sync.Mutex
 
+	input.Metrics.containersStarted(input.ServiceName, len(newContainers))
+
+	healthStatusCache := NewHealthStatusCache(input.Client, containerIDs(newContainers), input.Monitor)
+	serviceReadiness := serviceReadinessOnce(ctx, WaitForServiceReadinessInput{
+		Client:       input.Client,
+		Command:      input.ServiceReadinessCommand,
+		ContainerIDs: containerIDs(newContainers),
+		Executor:     input.Executor,
+		Monitor:      input.Monitor,
+		ServiceName:  input.ServiceName,
+		StartPeriod:  input.StartPeriod,
+		TickerCh:     input.TickerCh,
+	}, nil)
 	for _, nc := range newContainers {
 		wg.Add(1)
 		go func(newContainer container.Summary) {
@@ -518,16 +889,31 @@ func rollingUpdateBatchStopFirst(ctx context.Context, input RollingUpdateInput,
 
 			input.Logger.Info(fmt.Sprintf("Waiting for container to become healthy: %s", newContainer.ID[:12]))
 			healthcheckInput := WaitForHealthcheckInput{
-				Client:             input.Client,
-				ContainerID:        newContainer.ID,
-				Executor:           input.Executor,
-				HealthcheckCommand: input.HealthcheckCommand,
-				Monitor:            input.Monitor,
-				ServiceName:        input.ServiceName,
-				TickerCh:           input.TickerCh,
+				Client:                  input.Client,
+				ContainerID:             newContainer.ID,
+				ContainerTimeout:        input.ContainerTimeout,
+				Executor:                input.Executor,
+				HealthcheckCommand:      input.HealthcheckCommand,
+				HealthcheckExpectOutput: input.HealthcheckExpectOutput,
+				HealthcheckMode:         input.HealthcheckMode,
+				HealthcheckScheme:       input.HealthcheckScheme,
+				HealthStatusCache:       healthStatusCache,
+				Monitor:                 input.Monitor,
+				RunningGrace:            input.RunningGrace,
+				ServiceName:             input.ServiceName,
+				SkipHealthcheck:         input.SkipHealthcheck,
+				StartPeriod:             input.StartPeriod,
+				SuccessThreshold:        input.SuccessThreshold,
+				TickerCh:                input.TickerCh,
 			}
 
-			if err := waitForHealthcheck(ctx, healthcheckInput); err != nil {
+			var err error
+			if input.ServiceReadinessCommand != "" && !input.SkipHealthcheck {
+				err = serviceReadiness()
+			} else {
+				err = waitForHealthcheck(ctx, healthcheckInput)
+			}
+			if err != nil {
 				input.Logger.Info(fmt.Sprintf("Container %s failed health check: %v", newContainer.ID[:12], err))
 				if eo, ok := err.(*ErrorWithOutput); ok {
 					lines := strings.Split(eo.Output, "\n")
@@ -535,31 +921,38 @@ func rollingUpdateBatchStopFirst(ctx context.Context, input RollingUpdateInput,
 						input.Logger.Info(fmt.Sprintf("    %s", line))
 					}
 				}
+				dumpContainerLogs(ctx, input.Logger, input.Client, newContainer.ID, input.FailureLogLines)
 
 				mu.Lock()
 				output.Failures++
 				mu.Unlock()
-
-				_ = runHostScript(ctx, runScriptInput{
-					Client:      input.Client,
-					ContainerID: newContainer.ID,
-					Executor:    input.Executor,
-					ServiceName: input.ServiceName,
-					Script:      input.PreStopHostCommand,
-					ScriptType:  "pre-stop",
-				})
-				_ = input.Client.ContainerTerminate(ctx, newContainer.ID)
-				_ = runHostScript(ctx, runScriptInput{
-					Client:      input.Client,
-					ContainerID: newContainer.ID,
-					Executor:    input.Executor,
-					ServiceName: input.ServiceName,
-					Script:      input.PostStopHostCommand,
-					ScriptType:  "post-stop",
+				input.Metrics.containerFailed(input.ServiceName)
+
+				runHostHook(ctx, input.Logger, runScriptInput{
+					Client:        input.Client,
+					ContainerID:   newContainer.ID,
+					Executor:      input.Executor,
+					FailureOutput: healthcheckFailureOutput(err),
+					ServiceName:   input.ServiceName,
+					Script:        input.OnUnhealthyHostCommand,
+					ScriptType:    "on-unhealthy",
+					Warnings:      input.Warnings,
 				})
+
+				stopFailedContainer(ctx, input, newContainer.ID)
 				return
 			}
 			input.Logger.Info(fmt.Sprintf("Container %s is healthy", newContainer.ID[:12]))
+			input.Metrics.containerHealthy(input.ServiceName)
+			runHostHook(ctx, input.Logger, runScriptInput{
+				Client:      input.Client,
+				ContainerID: newContainer.ID,
+				Executor:    input.Executor,
+				ServiceName: input.ServiceName,
+				Script:      input.OnHealthyHostCommand,
+				ScriptType:  "on-healthy",
+				Warnings:    input.Warnings,
+			})
 		}(nc)
 	}
 
@@ -593,24 +986,42 @@ type ScaleDownContainersInput struct {
 	CurrentReplicas int
 	// DesiredReplicas is the target number of replicas
 	DesiredReplicas int
+	// DrainCommand is the host command run for each container just before it is stopped, with the container still up
+	DrainCommand string
+	// DrainTimeout is how long to wait after the drain command before stopping the container
+	DrainTimeout time.Duration
 	// Executor is the command executor to use. If nil, ExecCommand will be used.
 	Executor CommandExecutor
+	// Keep is which containers are kept: newest, oldest or healthy. Defaults to newest.
+	Keep string
 	// Logger is the logger to use
 	Logger *command.ZerologUi
+	// Metrics records the containers stopped. If nil, nothing is recorded.
+	Metrics *DeployMetrics
+	// Parallelism is the number of containers to stop simultaneously. Defaults to 1.
+	Parallelism int
 	// ProjectName is the name of the project
 	ProjectName string
 	// ServiceName is the name of the service
 	ServiceName string
 	// SkipDatabases is whether to skip interacting with databases
 	SkipDatabases bool
+	// PreStopCommand is the command to run inside a container before stopping it
+	PreStopCommand string
 	// PreStopHostCommand is the command to run before stopping a container
 	PreStopHostCommand string
+	// PreStopOrder is which pre-stop command runs first, either host-first or container-first
+	PreStopOrder string
 	// PostStopHostCommand is the command to run after stopping a container
 	PostStopHostCommand string
+	// StopGracePeriod is how long a container is given to exit once stopped before it is killed, or 0 for its own stop timeout
+	StopGracePeriod time.Duration
+	// Warnings collects the warnings raised while stopping containers, if set
+	Warnings *DeployWarnings
 }
 
 // scaleDownContainers scales down containers by stopping and removing excess ones
-// It always removes the oldest containers first
+// By default it removes the oldest containers first, see scaleDownOrder
 func scaleDownContainers(ctx context.Context, input ScaleDownContainersInput) error {
 	toRemove := input.CurrentReplicas - input.DesiredReplicas
 
@@ -634,48 +1045,71 @@ func scaleDownContainers(ctx context.Context, input ScaleDownContainersInput) er
 
 	input.Logger.Info(fmt.Sprintf("Scaling down containers: current-replicas=%d, target-replicas=%d", input.CurrentReplicas, input.DesiredReplicas))
 
-	// Sort containers by creation time to ensure we remove the oldest ones
-	sortContainersByCreationTime(input.CurrentContainers, false)
+	// Order the containers so those to remove come first
+	scaleDownOrder(input.CurrentContainers, input.Keep)
 
-	// Remove the oldest containers (first toRemove containers)
+	executor := input.Executor
+	if executor == nil {
+		executor = ExecCommand
+	}
+
+	parallelism := input.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	// Remove the first toRemove containers
 	containersToRemove := input.CurrentContainers[:toRemove]
-	for _, container := range containersToRemove {
-		containerIdentifier := container.ID[:12]
-		for _, name := range container.Names {
+	g, stopCtx := errgroup.WithContext(ctx)
+	g.SetLimit(parallelism)
+	for _, c := range containersToRemove {
+		containerID := c.ID
+		containerIdentifier := containerID[:12]
+		for _, name := range c.Names {
 			if n, found := strings.CutPrefix(name, "/"); found {
 				containerIdentifier = n
 				break
 			}
 		}
-		input.Logger.Info(fmt.Sprintf("Stopping container %s", containerIdentifier))
 
-		executor := input.Executor
-		if executor == nil {
-			executor = ExecCommand
-		}
+		g.Go(func() error {
+			// Abort before touching further containers if the deploy was cancelled
+			if err := stopCtx.Err(); err != nil {
+				return err
+			}
 
-		_ = runHostScript(ctx, runScriptInput{
-			Client:      input.Client,
-			ContainerID: container.ID,
-			Executor:    executor,
-			ServiceName: input.ServiceName,
-			Script:      input.PreStopHostCommand,
-			ScriptType:  "pre-stop",
-		})
-		if err := input.Client.ContainerTerminate(ctx, container.ID); err != nil {
-			return fmt.Errorf("error scaling down: %v", err)
-		}
-		_ = runHostScript(ctx, runScriptInput{
-			Client:      input.Client,
-			ContainerID: container.ID,
-			Executor:    executor,
-			ServiceName: input.ServiceName,
-			Script:      input.PostStopHostCommand,
-			ScriptType:  "post-stop",
+			input.Logger.Info(fmt.Sprintf("Stopping container %s", containerIdentifier))
+			runPreStopHooks(ctx, PreStopHooksInput{
+				Client:          input.Client,
+				Command:         input.PreStopCommand,
+				ContainerID:     containerID,
+				DrainCommand:    input.DrainCommand,
+				DrainTimeout:    input.DrainTimeout,
+				Executor:        executor,
+				HostCommand:     input.PreStopHostCommand,
+				Logger:          input.Logger,
+				Order:           input.PreStopOrder,
+				ServiceName:     input.ServiceName,
+				StopGracePeriod: input.StopGracePeriod,
+				Warnings:        input.Warnings,
+			})
+			if err := input.Client.ContainerTerminateWithTimeout(stopCtx, containerID, input.StopGracePeriod); err != nil {
+				return fmt.Errorf("error scaling down: %v", err)
+			}
+			input.Metrics.containerStopped(input.ServiceName)
+			_ = runHostScript(ctx, runScriptInput{
+				Client:      input.Client,
+				ContainerID: containerID,
+				Executor:    executor,
+				ServiceName: input.ServiceName,
+				Script:      input.PostStopHostCommand,
+				ScriptType:  "post-stop",
+			})
+			return nil
 		})
 	}
 
-	return nil
+	return g.Wait()
 }
 
 // ScaleUpContainersInput is the input for the scaleUpContainers function
@@ -684,40 +1118,106 @@ type ScaleUpContainersInput struct {
 	Client DockerClientInterface
 	// ComposeFile is the path to the compose file
 	ComposeFile string
+	// ContainerTimeout is an absolute ceiling on how long any single container may take to become healthy
+	ContainerTimeout time.Duration
 	// CurrentReplicas is the current number of containers
 	CurrentReplicas int
 	// Delay is the delay between batches
 	Delay time.Duration
 	// DesiredReplicas is the target number of replicas
 	DesiredReplicas int
+	// DrainCommand is the host command run for each container just before it is stopped, with the container still up
+	DrainCommand string
+	// DrainTimeout is how long to wait after the drain command before stopping the container
+	DrainTimeout time.Duration
 	// Executor is the command executor to use. If nil, ExecCommand will be used.
 	Executor CommandExecutor
 	// ExistingContainers is the list of existing containers to skip
 	ExistingContainers []container.Summary
 	// FailureAction is the action to take on failure (pause or empty)
 	FailureAction string
+	// FailureLogLines is the number of trailing log lines printed for each container that fails its healthcheck
+	FailureLogLines int
 	// HealthcheckCommand is the command to run for health checks
 	HealthcheckCommand string
+	// HealthcheckExpectOutput is the pattern the output of the healthcheck command must match for the check to pass
+	HealthcheckExpectOutput *regexp.Regexp
+	// HealthcheckMode is how the docker healthcheck status is followed, either poll or events
+	HealthcheckMode string
+	// HealthcheckScheme is the scheme of the published URL handed to the healthcheck command
+	HealthcheckScheme string
+	// HealthcheckTimeoutAction is what happens to a new container whose healthcheck times out, either terminate or keep. Empty terminates it.
+	HealthcheckTimeoutAction string
 	// Logger is the logger to use
 	Logger *command.ZerologUi
 	// MaxFailureRatio is the maximum allowed failure ratio
 	MaxFailureRatio float32
+	// Metrics records the new containers becoming healthy or failing. If nil, nothing is recorded.
+	Metrics *DeployMetrics
 	// Monitor is the health check monitoring duration
 	Monitor time.Duration
+	// NoRecreate is whether existing containers whose configuration differs from the service are left as they are, rather than recreated
+	NoRecreate bool
+	// OnHealthyHostCommand is the command to run on the host for each new container once it is healthy
+	OnHealthyHostCommand string
+	// OnUnhealthyHostCommand is the command to run on the host for each new container that fails its healthcheck, before it is terminated
+	OnUnhealthyHostCommand string
+	// OverlayFiles are additional compose files layered over the compose file
+	OverlayFiles []string
 	// Parallelism is the number of containers to update simultaneously
 	Parallelism int
+	// ParallelismBudget is shared with the other services of the deploy, each batch holding a slot per container. If nil, only Parallelism bounds the batches.
+	ParallelismBudget *ParallelismBudget
+	// PerReplicaVolume is the Go template for a volume spec bound to each new container by its instance ID
+	PerReplicaVolume string
+	// Profiles are the active compose profiles
+	Profiles []string
 	// ProjectDir is the project directory
 	ProjectDir string
+	// ProjectLabel overrides the com.docker.compose.project label value used to discover containers. Defaults to ProjectName.
+	ProjectLabel string
 	// ProjectName is the name of the project
 	ProjectName string
+	// QuietPull is whether to suppress the per-layer progress of image pulls
+	QuietPull bool
+	// RecreateAnonymousVolumes is whether to recreate anonymous volumes instead of reusing them
+	RecreateAnonymousVolumes bool
+	// ReplacedContainers are the old containers the new ones replace, oldest first. With a per-replica volume, the new containers take over the volumes of the containers they replace.
+	ReplacedContainers []container.Summary
+	// ReportAllFailures is whether a failed batch reports every container that failed, rather than only the first
+	ReportAllFailures bool
+	// RunningGrace is how long a container without a healthcheck must stay running before it is considered healthy. If 0, it is healthy as soon as it is running.
+	RunningGrace time.Duration
+	// ScaleStep is the number of containers created at a time, each step started and healthy before the next is created. If 0, every container is created at once.
+	ScaleStep int
 	// ServiceName is the name of the service
 	ServiceName string
+	// ServiceReadinessCommand is a host command run once per batch that gates the whole batch in place of the per-container healthchecks
+	ServiceReadinessCommand string
+	// PreStopCommand is the command to run inside a container before stopping it
+	PreStopCommand string
 	// PreStopHostCommand is the command to run before stopping a container
 	PreStopHostCommand string
+	// PreStopOrder is which pre-stop command runs first, either host-first or container-first
+	PreStopOrder string
 	// PostStopHostCommand is the command to run after stopping a container
 	PostStopHostCommand string
+	// SkipPull is whether the service's image is never pulled, relying on the local image
+	SkipPull bool
+	// StopGracePeriod is how long a container is given to exit once stopped before it is killed, or 0 for its own stop timeout
+	StopGracePeriod time.Duration
+	// SkipCleanupHooks is whether new containers that fail are terminated without running the stop hooks
+	SkipCleanupHooks bool
+	// SkipHealthcheck is whether to consider new containers healthy without waiting on their healthchecks
+	SkipHealthcheck bool
+	// StartPeriod is the healthcheck start period for new containers
+	StartPeriod time.Duration
+	// SuccessThreshold is the number of consecutive healthy readings required before a container is considered healthy
+	SuccessThreshold int
 	// TickerCh is an optional channel to use for ticking. If nil, time.NewTicker will be used.
 	TickerCh <-chan time.Time
+	// Warnings collects the warnings raised while scaling up, if set
+	Warnings *DeployWarnings
 }
 
 // scaleUpContainers scales up containers by creating and starting new ones
@@ -729,31 +1229,108 @@ func scaleUpContainers(ctx context.Context, input ScaleUpContainersInput) error
 		executor = ExecCommand
 	}
 
-	// Create all containers at once
-	_, err := executor(ctx, ExecCommandInput{
-		Command: "docker",
-		Args: []string{
-			"compose",
-			"-f", input.ComposeFile,
-			"-p", input.ProjectName,
-			"create",
-			"--scale", fmt.Sprintf("%s=%d", input.ServiceName, input.DesiredReplicas),
-			input.ServiceName,
-		},
-		WorkingDirectory: input.ProjectDir,
-	})
-	if err != nil {
-		return fmt.Errorf("error creating containers: %v", err)
+	// Each step is created only once the containers of the previous step
+	// are healthy, so a constrained host never starts them all at once
+	steps := scaleUpSteps(input.CurrentReplicas, input.DesiredReplicas, input.ScaleStep)
+	existingContainers := input.ExistingContainers
+	currentReplicas := input.CurrentReplicas
+	progress := &scaleUpProgress{}
+	for i, target := range steps {
+		stepInput := input
+		stepInput.CurrentReplicas = currentReplicas
+		stepInput.DesiredReplicas = target
+		stepInput.ExistingContainers = existingContainers
+		if len(steps) > 1 {
+			input.Logger.Info(fmt.Sprintf("Scaling up step: service=%s, step=%d/%d, target-replicas=%d", input.ServiceName, i+1, len(steps), target))
+		}
+
+		createdContainers, allContainers, err := createScaleUpContainers(ctx, stepInput, executor)
+		if err != nil {
+			return err
+		}
+		existingContainers = allContainers
+		currentReplicas = target
+
+		if len(createdContainers) == 0 {
+			input.Logger.Info("No created containers to start")
+			continue
+		}
+
+		if err := startScaleUpBatches(ctx, stepInput, executor, createdContainers, progress); err != nil {
+			return err
+		}
+
+		if i < len(steps)-1 && input.Delay > 0 {
+			input.Logger.Info(fmt.Sprintf("Waiting before next step: %v", input.Delay))
+			time.Sleep(input.Delay)
+		}
+	}
+
+	return nil
+}
+
+// scaleUpSteps returns the replica count targeted by each step of a scale
+// up, in increments of step. If step is 0, the desired count is reached in
+// a single step.
+func scaleUpSteps(current int, desired int, step int) []int {
+	steps := []int{}
+	if step > 0 {
+		for target := current + step; target < desired; target += step {
+			steps = append(steps, target)
+		}
+	}
+	return append(steps, desired)
+}
+
+// scaleUpProgress counts the containers started by a scale up across its
+// steps, so the failure ratio covers the whole scale up
+type scaleUpProgress struct {
+	failures     int
+	totalUpdates int
+}
+
+// createScaleUpContainers creates the containers needed to reach the
+// desired replica count, returning the new containers along with every
+// container of the service
+func createScaleUpContainers(ctx context.Context, input ScaleUpContainersInput, executor CommandExecutor) ([]container.Summary, []container.Summary, error) {
+	if input.PerReplicaVolume != "" {
+		// each replica binds its own volume, so containers are created one at a time
+		if err := createPerReplicaContainers(ctx, input, executor); err != nil {
+			return nil, nil, fmt.Errorf("error creating containers: %v", err)
+		}
+	} else {
+		createArgs := []string{"create", "--scale", fmt.Sprintf("%s=%d", input.ServiceName, input.DesiredReplicas)}
+		if input.NoRecreate {
+			createArgs = append(createArgs, "--no-recreate")
+		}
+
+		// Create all containers of the step at once
+		err := runComposeCommand(ctx, executor, ExecCommandInput{
+			Command: "docker",
+			Args: composeCommandArgs(ComposeCommandArgsInput{
+				ComposeFile:              input.ComposeFile,
+				OverlayFiles:             input.OverlayFiles,
+				ProjectName:              input.ProjectName,
+				QuietPull:                input.QuietPull,
+				RecreateAnonymousVolumes: input.RecreateAnonymousVolumes,
+				SkipPull:                 input.SkipPull,
+			}, append(createArgs, input.ServiceName)...),
+			WorkingDirectory: input.ProjectDir,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("error creating containers: %v", err)
+		}
 	}
 
 	// Get all created containers (including existing running ones)
 	allContainers, err := composeContainers(ComposeContainersInput{
-		Client:      input.Client,
-		ProjectName: input.ProjectName,
-		ServiceName: input.ServiceName,
+		Client:       input.Client,
+		ProjectLabel: input.ProjectLabel,
+		ProjectName:  input.ProjectName,
+		ServiceName:  input.ServiceName,
 	})
 	if err != nil {
-		return fmt.Errorf("error getting created containers: %v", err)
+		return nil, nil, fmt.Errorf("error getting created containers: %v", err)
 	}
 
 	// Filter to only get created (not running) containers
@@ -768,14 +1345,12 @@ func scaleUpContainers(ctx context.Context, input ScaleUpContainersInput) error
 		createdContainers = append(createdContainers, c)
 	}
 
-	if len(createdContainers) == 0 {
-		input.Logger.Info("No created containers to start")
-		return nil
-	}
-
-	totalUpdates := 0
-	failures := 0
+	return createdContainers, allContainers, nil
+}
 
+// startScaleUpBatches starts the created containers in batches of the
+// parallelism, waiting for each batch to become healthy before the next
+func startScaleUpBatches(ctx context.Context, input ScaleUpContainersInput, executor CommandExecutor, createdContainers []container.Summary, progress *scaleUpProgress) error {
 	// Start containers in batches according to parallelism
 	for i := 0; i < len(createdContainers); i += input.Parallelism {
 		batchSize := input.Parallelism
@@ -785,44 +1360,100 @@ func scaleUpContainers(ctx context.Context, input ScaleUpContainersInput) error
 
 		batch := createdContainers[i : i+batchSize]
 
-		var wg sync.WaitGroup
+		release, err := input.ParallelismBudget.acquire(ctx, len(batch))
+		if err != nil {
+			return err
+		}
+
 		var mu sync.Mutex
-		var batchErr error
+		var batchErrs []error
+
+		// When any failure aborts the deploy, the first one cancels the
+		// healthcheck waits of the rest of the batch rather than leaving
+		// them to poll until their own timeout
+		failFast := input.MaxFailureRatio == 0 && !input.ReportAllFailures
+		g, healthCtx := errgroup.WithContext(ctx)
 
 		// Start containers in this batch
+		var started sync.WaitGroup
+		started.Add(len(batch))
+		healthStatusCache := NewHealthStatusCache(input.Client, containerIDs(batch), input.Monitor)
+		serviceReadiness := serviceReadinessOnce(ctx, WaitForServiceReadinessInput{
+			Client:       input.Client,
+			Command:      input.ServiceReadinessCommand,
+			ContainerIDs: containerIDs(batch),
+			Executor:     executor,
+			Monitor:      input.Monitor,
+			ServiceName:  input.ServiceName,
+			StartPeriod:  input.StartPeriod,
+			TickerCh:     input.TickerCh,
+		}, &started)
 		for _, c := range batch {
-			wg.Add(1)
-			go func(c container.Summary) {
-				defer wg.Done()
-
+			g.Go(func() error {
 				mu.Lock()
-				totalUpdates++
+				progress.totalUpdates++
 				mu.Unlock()
 
-				if err := input.Client.ContainerStart(ctx, c.ID, container.StartOptions{}); err != nil {
+				err := input.Client.ContainerStart(ctx, c.ID, container.StartOptions{})
+				started.Done()
+				if err != nil {
 					input.Logger.Info(fmt.Sprintf("Error starting container %s: %v", c.ID[:12], err))
 					mu.Lock()
-					failures++
-					if batchErr == nil {
-						batchErr = fmt.Errorf("error starting container %s: %v", c.ID[:12], err)
-					}
+					progress.failures++
+					startErr := fmt.Errorf("error starting container %s: %v", c.ID[:12], err)
+					batchErrs = append(batchErrs, startErr)
 					mu.Unlock()
-					return
+					input.Metrics.containerFailed(input.ServiceName)
+					if failFast {
+						return startErr
+					}
+					return nil
 				}
 
+				input.Metrics.containersStarted(input.ServiceName, 1)
+
 				// Wait for health check
 				input.Logger.Info(fmt.Sprintf("Waiting for container to become healthy: %s", c.ID[:12]))
 				healthcheckInput := WaitForHealthcheckInput{
-					Client:             input.Client,
-					ContainerID:        c.ID,
-					Executor:           executor,
-					HealthcheckCommand: input.HealthcheckCommand,
-					Monitor:            input.Monitor,
-					ServiceName:        input.ServiceName,
-					TickerCh:           input.TickerCh,
+					Client:                  input.Client,
+					ContainerID:             c.ID,
+					ContainerTimeout:        input.ContainerTimeout,
+					Executor:                executor,
+					HealthcheckCommand:      input.HealthcheckCommand,
+					HealthcheckExpectOutput: input.HealthcheckExpectOutput,
+					HealthcheckMode:         input.HealthcheckMode,
+					HealthcheckScheme:       input.HealthcheckScheme,
+					HealthStatusCache:       healthStatusCache,
+					Monitor:                 input.Monitor,
+					RunningGrace:            input.RunningGrace,
+					ServiceName:             input.ServiceName,
+					SkipHealthcheck:         input.SkipHealthcheck,
+					StartPeriod:             input.StartPeriod,
+					SuccessThreshold:        input.SuccessThreshold,
+					TickerCh:                input.TickerCh,
 				}
 
-				if err := waitForHealthcheck(ctx, healthcheckInput); err != nil {
+				if input.ServiceReadinessCommand != "" && !input.SkipHealthcheck {
+					err = serviceReadiness()
+				} else {
+					err = waitForHealthcheck(healthCtx, healthcheckInput)
+					if err != nil && healthCtx.Err() != nil && ctx.Err() == nil {
+						// Another container failed first, so this one's health is
+						// unknown and it is stopped without counting as a failure
+						input.Logger.Info(fmt.Sprintf("Cancelled health check after another container in the batch failed: %s", c.ID[:12]))
+						stopScaleUpContainer(ctx, input, executor, c.ID)
+						return nil
+					}
+				}
+				var timeoutErr *HealthcheckTimeoutError
+				if errors.As(err, &timeoutErr) && input.HealthcheckTimeoutAction == "keep" {
+					// there is no old container to fall back to, so the new
+					// one is left running for diagnosis rather than removed
+					input.Warnings.Warn(input.Logger, input.ServiceName, fmt.Sprintf("Keeping container that timed out waiting to become healthy: service=%s, container=%s, error=%v", input.ServiceName, c.ID[:12], err))
+					dumpContainerLogs(ctx, input.Logger, input.Client, c.ID, input.FailureLogLines)
+					return nil
+				}
+				if err != nil {
 					input.Logger.Info(fmt.Sprintf("Container %s failed health check: %v", c.ID[:12], err))
 					if eo, ok := err.(*ErrorWithOutput); ok {
 						lines := strings.Split(eo.Output, "\n")
@@ -830,38 +1461,52 @@ func scaleUpContainers(ctx context.Context, input ScaleUpContainersInput) error
 							input.Logger.Info(fmt.Sprintf("    %s", line))
 						}
 					}
+					dumpContainerLogs(ctx, input.Logger, input.Client, c.ID, input.FailureLogLines)
 
+					healthErr := fmt.Errorf("container %s failed health check: %v", c.ID[:12], err)
 					mu.Lock()
-					failures++
-					if batchErr == nil {
-						batchErr = fmt.Errorf("container %s failed health check: %v", c.ID[:12], err)
-					}
+					progress.failures++
+					batchErrs = append(batchErrs, healthErr)
 					mu.Unlock()
-
-					_ = runHostScript(ctx, runScriptInput{
-						Client:      input.Client,
-						ContainerID: c.ID,
-						Executor:    executor,
-						ServiceName: input.ServiceName,
-						Script:      input.PreStopHostCommand,
-						ScriptType:  "pre-stop",
-					})
-					_ = input.Client.ContainerTerminate(ctx, c.ID)
-					_ = runHostScript(ctx, runScriptInput{
-						Client:      input.Client,
-						ContainerID: c.ID,
-						Executor:    executor,
-						ServiceName: input.ServiceName,
-						Script:      input.PostStopHostCommand,
-						ScriptType:  "post-stop",
+					input.Metrics.containerFailed(input.ServiceName)
+
+					runHostHook(ctx, input.Logger, runScriptInput{
+						Client:        input.Client,
+						ContainerID:   c.ID,
+						Executor:      executor,
+						FailureOutput: healthcheckFailureOutput(err),
+						ServiceName:   input.ServiceName,
+						Script:        input.OnUnhealthyHostCommand,
+						ScriptType:    "on-unhealthy",
+						Warnings:      input.Warnings,
 					})
+
+					stopScaleUpContainer(ctx, input, executor, c.ID)
+					if failFast {
+						return healthErr
+					}
+					return nil
 				}
-			}(c)
+				input.Metrics.containerHealthy(input.ServiceName)
+
+				runHostHook(ctx, input.Logger, runScriptInput{
+					Client:      input.Client,
+					ContainerID: c.ID,
+					Executor:    executor,
+					ServiceName: input.ServiceName,
+					Script:      input.OnHealthyHostCommand,
+					ScriptType:  "on-healthy",
+					Warnings:    input.Warnings,
+				})
+				return nil
+			})
 		}
-		wg.Wait()
+		// Every failure is already recorded in batchErrs
+		_ = g.Wait()
+		release()
 
 		// Check failure ratio after batch completes
-		failureRatio := float64(failures) / float64(totalUpdates)
+		failureRatio := float64(progress.failures) / float64(progress.totalUpdates)
 		maxFailureRatioFloat := float64(input.MaxFailureRatio)
 		if maxFailureRatioFloat > 0 && failureRatio > maxFailureRatioFloat {
 			if input.FailureAction == "pause" {
@@ -870,12 +1515,22 @@ func scaleUpContainers(ctx context.Context, input ScaleUpContainersInput) error
 			return fmt.Errorf("max failure ratio exceeded (%.2f > %.2f)", failureRatio, maxFailureRatioFloat)
 		}
 
-		if input.FailureAction == "pause" && failures > 0 {
+		if input.FailureAction == "pause" && progress.failures > 0 {
 			return fmt.Errorf("deployment paused due to failure (failure_action: pause)")
 		}
 
-		if batchErr != nil && input.MaxFailureRatio == 0 {
-			return batchErr
+		// The whole batch has finished by now, so every failure in it can
+		// be reported rather than only the first
+		if len(batchErrs) > 0 && input.MaxFailureRatio == 0 {
+			if !input.ReportAllFailures || len(batchErrs) == 1 {
+				return batchErrs[0]
+			}
+
+			messages := []string{}
+			for _, err := range batchErrs {
+				messages = append(messages, err.Error())
+			}
+			return fmt.Errorf("%d containers failed: %s", len(batchErrs), strings.Join(messages, "; "))
 		}
 
 		// Wait for delay between batches (except for the last batch)
@@ -888,6 +1543,102 @@ func scaleUpContainers(ctx context.Context, input ScaleUpContainersInput) error
 	return nil
 }
 
+// cleanupTimeout bounds the cleanup of a container once its deploy has
+// been cancelled
+const cleanupTimeout = time.Minute
+
+// cleanupContext returns the context to clean up a failed container in. A
+// deploy cancelled mid-batch, such as by its overall timeout, still stops the
+// containers it started, on a context of its own bounded by cleanupTimeout.
+func cleanupContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ctx.Err() == nil {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+}
+
+// stopFailedContainer stops a new container of a rolling update that did
+// not become healthy, running its stop hooks around the termination unless
+// they are skipped
+func stopFailedContainer(ctx context.Context, input RollingUpdateInput, containerID string) {
+	ctx, cancel := cleanupContext(ctx)
+	defer cancel()
+
+	if input.SkipCleanupHooks {
+		if err := input.Client.ContainerTerminateWithTimeout(ctx, containerID, input.StopGracePeriod); err == nil {
+			input.Metrics.containerStopped(input.ServiceName)
+		}
+		return
+	}
+
+	runPreStopHooks(ctx, PreStopHooksInput{
+		Client:          input.Client,
+		Command:         input.PreStopCommand,
+		ContainerID:     containerID,
+		DrainCommand:    input.DrainCommand,
+		DrainTimeout:    input.DrainTimeout,
+		Executor:        input.Executor,
+		HostCommand:     input.PreStopHostCommand,
+		Logger:          input.Logger,
+		Order:           input.PreStopOrder,
+		ServiceName:     input.ServiceName,
+		StopGracePeriod: input.StopGracePeriod,
+		Warnings:        input.Warnings,
+	})
+	if err := input.Client.ContainerTerminateWithTimeout(ctx, containerID, input.StopGracePeriod); err == nil {
+		input.Metrics.containerStopped(input.ServiceName)
+	}
+	_ = runHostScript(ctx, runScriptInput{
+		Client:      input.Client,
+		ContainerID: containerID,
+		Executor:    input.Executor,
+		ServiceName: input.ServiceName,
+		Script:      input.PostStopHostCommand,
+		ScriptType:  "post-stop",
+	})
+}
+
+// stopScaleUpContainer stops a started container that did not become
+// healthy, running its stop hooks around the termination unless they are
+// skipped
+func stopScaleUpContainer(ctx context.Context, input ScaleUpContainersInput, executor CommandExecutor, containerID string) {
+	ctx, cancel := cleanupContext(ctx)
+	defer cancel()
+
+	if input.SkipCleanupHooks {
+		if err := input.Client.ContainerTerminateWithTimeout(ctx, containerID, input.StopGracePeriod); err == nil {
+			input.Metrics.containerStopped(input.ServiceName)
+		}
+		return
+	}
+
+	runPreStopHooks(ctx, PreStopHooksInput{
+		Client:          input.Client,
+		Command:         input.PreStopCommand,
+		ContainerID:     containerID,
+		DrainCommand:    input.DrainCommand,
+		DrainTimeout:    input.DrainTimeout,
+		Executor:        executor,
+		HostCommand:     input.PreStopHostCommand,
+		Logger:          input.Logger,
+		Order:           input.PreStopOrder,
+		ServiceName:     input.ServiceName,
+		StopGracePeriod: input.StopGracePeriod,
+		Warnings:        input.Warnings,
+	})
+	if err := input.Client.ContainerTerminateWithTimeout(ctx, containerID, input.StopGracePeriod); err == nil {
+		input.Metrics.containerStopped(input.ServiceName)
+	}
+	_ = runHostScript(ctx, runScriptInput{
+		Client:      input.Client,
+		ContainerID: containerID,
+		Executor:    executor,
+		ServiceName: input.ServiceName,
+		Script:      input.PostStopHostCommand,
+		ScriptType:  "post-stop",
+	})
+}
+
 // sortContainersByCreationTime sorts containers by creation time
 func sortContainersByCreationTime(containers []container.Summary, newestFirst bool) {
 	slices.SortFunc(containers, func(a, b container.Summary) int {
@@ -910,6 +1661,58 @@ func sortContainersByCreationTime(containers []container.Summary, newestFirst bo
 	})
 }
 
+// scaleDownOrder sorts containers so those a scale down removes come first.
+// keep is newest (the default) to remove the oldest containers first, oldest
+// to remove the newest first, or healthy to remove stopped, unhealthy and
+// still-starting containers before healthy ones, oldest first within each.
+func scaleDownOrder(containers []container.Summary, keep string) {
+	if keep == "oldest" {
+		sortContainersByCreationTime(containers, true)
+		return
+	}
+
+	sortContainersByCreationTime(containers, false)
+	if keep != "healthy" {
+		return
+	}
+
+	rank := func(summary container.Summary) int {
+		health := summaryHealth(summary)
+		switch {
+		case !health.Running:
+			return 0
+		case health.Status == container.Unhealthy:
+			return 1
+		case health.Status == container.Starting:
+			return 2
+		}
+		return 3
+	}
+	slices.SortStableFunc(containers, func(a, b container.Summary) int {
+		return rank(a) - rank(b)
+	})
+}
+
+// GenerationLabel is the label stamped on the containers of a deploy that
+// leaves the previous generation running
+const GenerationLabel = "com.dokku.orchestrate/generation"
+
+// CanaryLabel is the label stamped on canary containers deployed alongside
+// the existing containers of a service
+const CanaryLabel = "com.dokku.orchestrate/canary"
+
+// DeployIDLabel is the label identifying the deploy that created a container,
+// used to scope operations to the containers of a single deploy
+const DeployIDLabel = "com.dokku.orchestrate/deploy-id"
+
+// RevisionLabel is the label identifying the source revision a container
+// was deployed from
+const RevisionLabel = "com.dokku.orchestrate/revision"
+
+// ReplicaVolumeLabel is the label recording the instance ID the per-replica
+// volume of a container was rendered for
+const ReplicaVolumeLabel = "com.dokku.orchestrate/replica-volume"
+
 // ContainerNameTemplateData is the data structure for container name templates
 type ContainerNameTemplateData struct {
 	// ProjectName is the name of the project
@@ -918,6 +1721,52 @@ type ContainerNameTemplateData struct {
 	ServiceName string
 	// InstanceID is the instance ID
 	InstanceID int
+	// Profile is the active compose profiles, sorted and joined with a dash. Empty when no profile is active.
+	Profile string
+	// Profiles are the active compose profiles, sorted
+	Profiles []string
+}
+
+// containerNameTemplateData returns the container name template data for an
+// instance of a service
+func containerNameTemplateData(projectName string, serviceName string, profiles []string, instanceID int) ContainerNameTemplateData {
+	sortedProfiles := slices.Sorted(slices.Values(profiles))
+	return ContainerNameTemplateData{
+		ProjectName: projectName,
+		ServiceName: serviceName,
+		InstanceID:  instanceID,
+		Profile:     strings.Join(sortedProfiles, "-"),
+		Profiles:    sortedProfiles,
+	}
+}
+
+// validateContainerNameTemplate checks that a container name template gives
+// each instance of a service its own name. The template is rendered for two
+// instances, and a template rendering the same name for both, such as one
+// not referencing .InstanceID, cannot name more than one replica.
+func validateContainerNameTemplate(nameTemplate string, projectName string, serviceName string, profiles []string, replicas int) error {
+	if nameTemplate == "" || replicas <= 1 {
+		return nil
+	}
+
+	tmpl, err := template.New("container-name").Parse(nameTemplate)
+	if err != nil {
+		return fmt.Errorf("error parsing container name template: %v", err)
+	}
+
+	names := []string{}
+	for _, instanceID := range []int{1, 2} {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, containerNameTemplateData(projectName, serviceName, profiles, instanceID)); err != nil {
+			return fmt.Errorf("error executing container name template: %v", err)
+		}
+		names = append(names, buf.String())
+	}
+
+	if names[0] == names[1] {
+		return fmt.Errorf("container name template %q renders the same name %q for every instance of service %s, so its %d replicas would collide: reference {{.InstanceID}} in the template", nameTemplate, names[0], serviceName, replicas)
+	}
+	return nil
 }
 
 type RenameContainersToConventionInput struct {
@@ -931,10 +1780,13 @@ type RenameContainersToConventionInput struct {
 	ServiceName string
 	// NameTemplate is the Go template for container names
 	NameTemplate string
+	// Profiles are the active compose profiles
+	Profiles []string
 }
 
 // renameContainersToConvention renames all containers to follow the naming convention
-// using the provided Go template. The template has access to .ProjectName, .ServiceName, and .InstanceID
+// using the provided Go template. The template has access to .ProjectName, .ServiceName, .InstanceID,
+// .Profile and .Profiles
 func renameContainersToConvention(ctx context.Context, input RenameContainersToConventionInput) error {
 	if len(input.Containers) == 0 {
 		return nil
@@ -954,11 +1806,7 @@ func renameContainersToConvention(ctx context.Context, input RenameContainersToC
 
 		// Execute the template
 		var buf bytes.Buffer
-		data := ContainerNameTemplateData{
-			ProjectName: input.ProjectName,
-			ServiceName: input.ServiceName,
-			InstanceID:  instanceID,
-		}
+		data := containerNameTemplateData(input.ProjectName, input.ServiceName, input.Profiles, instanceID)
 		if err := tmpl.Execute(&buf, data); err != nil {
 			return fmt.Errorf("error executing container name template: %v", err)
 		}
@@ -979,3 +1827,329 @@ func renameContainersToConvention(ctx context.Context, input RenameContainersToC
 
 	return nil
 }
+
+// InstanceContainerInput is the input for the instanceContainer function
+type InstanceContainerInput struct {
+	// Containers are the running containers of the service
+	Containers []container.Summary
+	// Index is the instance number of the container to find
+	Index int
+	// NameTemplate is the Go template for container names
+	NameTemplate string
+	// Profiles are the active compose profiles
+	Profiles []string
+	// ProjectName is the name of the project
+	ProjectName string
+	// ServiceName is the name of the service
+	ServiceName string
+}
+
+// instanceContainer finds the container named for an instance number by the
+// container name template, returning it along with its name
+func instanceContainer(input InstanceContainerInput) (container.Summary, string, error) {
+	tmpl, err := template.New("container-name").Parse(input.NameTemplate)
+	if err != nil {
+		return container.Summary{}, "", fmt.Errorf("error parsing container name template: %v", err)
+	}
+
+	var buf bytes.Buffer
+	data := containerNameTemplateData(input.ProjectName, input.ServiceName, input.Profiles, input.Index)
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return container.Summary{}, "", fmt.Errorf("error executing container name template: %v", err)
+	}
+	name := buf.String()
+
+	for _, c := range input.Containers {
+		for _, containerName := range c.Names {
+			if strings.TrimPrefix(containerName, "/") == name {
+				return c, name, nil
+			}
+		}
+	}
+
+	return container.Summary{}, name, fmt.Errorf("no running container named %s for instance %d of service %s", name, input.Index, input.ServiceName)
+}
+
+// startReplacementContainers starts the replacements of a batch of old
+// containers next to the current containers. With a per-replica volume, each
+// replacement is started on its own, binding the volume of the container it
+// replaces so the replica keeps its data.
+func startReplacementContainers(ctx context.Context, input RollingUpdateInput, overlayFiles []string, currentContainers []container.Summary, batch []container.Summary) error {
+	composeArgs := ComposeCommandArgsInput{
+		ComposeFile:              input.ComposeFile,
+		OverlayFiles:             overlayFiles,
+		ProjectName:              input.ProjectName,
+		QuietPull:                input.QuietPull,
+		RecreateAnonymousVolumes: input.RecreateAnonymousVolumes,
+		SkipPull:                 input.SkipPull,
+	}
+	if input.PerReplicaVolume == "" {
+		return runComposeCommand(ctx, input.Executor, ExecCommandInput{
+			Command: "docker",
+			Args: composeCommandArgs(composeArgs,
+				"up",
+				"--detach",
+				"--scale", fmt.Sprintf("%s=%d", input.ServiceName, len(currentContainers)+len(batch)),
+				"--no-deps",
+				"--no-recreate",
+				input.ServiceName,
+			),
+			WorkingDirectory: input.ProjectDir,
+		})
+	}
+
+	for i, volumeInstance := range replicaVolumeInstances(currentContainers, batch, len(batch)) {
+		input.Logger.Info(fmt.Sprintf("Starting container with per-replica volume: service=%s, instance=%d", input.ServiceName, volumeInstance))
+		err := createPerReplicaContainer(ctx, PerReplicaContainerInput{
+			Args: []string{
+				"up",
+				"--detach",
+				"--scale", fmt.Sprintf("%s=%d", input.ServiceName, len(currentContainers)+i+1),
+				"--no-deps",
+				"--no-recreate",
+				input.ServiceName,
+			},
+			ComposeArgs: composeArgs,
+			Executor:    input.Executor,
+			Overlay: PerReplicaVolumeOverlayInput{
+				InstanceID:     volumeInstance,
+				Profiles:       input.Profiles,
+				ProjectName:    input.ProjectName,
+				ServiceName:    input.ServiceName,
+				VolumeTemplate: input.PerReplicaVolume,
+			},
+			ProjectDir: input.ProjectDir,
+		})
+		if err != nil {
+			return fmt.Errorf("error starting container for instance %d: %v", volumeInstance, err)
+		}
+	}
+	return nil
+}
+
+// batchOverlayFiles returns the overlay files used to create the replacements
+// for a batch, adding an overlay carrying the labels inherited from the
+// batch's old containers. The returned cleanup removes any overlay written.
+func batchOverlayFiles(ctx context.Context, input RollingUpdateInput, batch []container.Summary) ([]string, func(), error) {
+	labels, err := inheritedLabels(ctx, input, batch)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(labels) == 0 {
+		return input.OverlayFiles, func() {}, nil
+	}
+
+	input.Logger.Info(fmt.Sprintf("Inheriting labels from old containers: service=%s, labels=%s", input.ServiceName, strings.Join(slices.Sorted(maps.Keys(labels)), ",")))
+	overlayFile, err := writeComposeOverlay(input.ServiceName, map[string]interface{}{"labels": labels})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return append(slices.Clone(input.OverlayFiles), overlayFile), func() { os.Remove(overlayFile) }, nil
+}
+
+// inheritedLabels reads the labels to inherit off the old containers of a
+// batch. Labels cannot be changed once a container is created, so they are
+// applied to the replacements at creation time. When old containers in the
+// same batch disagree on a value, the first one is kept.
+func inheritedLabels(ctx context.Context, input RollingUpdateInput, batch []container.Summary) (map[string]string, error) {
+	labels := map[string]string{}
+	if len(input.InheritLabels) == 0 {
+		return labels, nil
+	}
+
+	for _, c := range batch {
+		containerJSON, err := input.Client.ContainerInspect(ctx, c.ID)
+		if err != nil {
+			return nil, fmt.Errorf("error inspecting container %s: %v", c.ID[:12], err)
+		}
+		if containerJSON.Config == nil {
+			continue
+		}
+
+		for _, key := range input.InheritLabels {
+			value, ok := containerJSON.Config.Labels[key]
+			if !ok {
+				continue
+			}
+
+			if existing, ok := labels[key]; ok && existing != value {
+				input.Warnings.Warn(input.Logger, input.ServiceName, fmt.Sprintf("Conflicting inherited label values in batch, keeping the first: label=%s, kept=%s, ignored=%s", key, existing, value))
+				continue
+			}
+			labels[key] = value
+		}
+	}
+
+	return labels, nil
+}
+
+// containerIDs returns the IDs of the given containers
+func containerIDs(containers []container.Summary) []string {
+	ids := make([]string, 0, len(containers))
+	for _, c := range containers {
+		ids = append(ids, c.ID)
+	}
+	return ids
+}
+
+// RunToCompletionInput contains the parameters for running a one-shot service
+type RunToCompletionInput struct {
+	// Client is the Docker client to use
+	Client DockerClientInterface
+	// ComposeFile is the path to the compose file
+	ComposeFile string
+	// Executor is the command executor to use. If nil, ExecCommand will be used.
+	Executor CommandExecutor
+	// Logger is the logger to use
+	Logger *command.ZerologUi
+	// OverlayFiles are additional compose files layered over the compose file
+	OverlayFiles []string
+	// ProjectDir is the project directory
+	ProjectDir string
+	// ProjectLabel overrides the com.docker.compose.project label value used to discover containers. Defaults to ProjectName.
+	ProjectLabel string
+	// ProjectName is the name of the project
+	ProjectName string
+	// QuietPull is whether to suppress the per-layer progress of image pulls
+	QuietPull bool
+	// RecreateAnonymousVolumes is whether to recreate anonymous volumes instead of reusing them
+	RecreateAnonymousVolumes bool
+	// Replicas is the number of containers to run
+	Replicas int
+	// ServiceName is the name of the service
+	ServiceName string
+	// SkipPull is whether the service's image is never pulled, relying on the local image
+	SkipPull bool
+}
+
+// RunToCompletionOutput is the outcome of running a one-shot service
+type RunToCompletionOutput struct {
+	// Failed is the number of containers that failed to start or exited with a non-zero code
+	Failed int
+	// Succeeded is the number of containers that exited 0
+	Succeeded int
+}
+
+// runToCompletion runs the containers of a one-shot service and waits for
+// them to exit. A container succeeds if it exits 0 and fails otherwise.
+func runToCompletion(ctx context.Context, input RunToCompletionInput) (RunToCompletionOutput, error) {
+	output := RunToCompletionOutput{}
+	input.Logger.Info(fmt.Sprintf("Running service to completion: service=%s, replicas=%d", input.ServiceName, input.Replicas))
+	if input.Replicas == 0 {
+		input.Logger.Info("No replicas to run")
+		return output, nil
+	}
+
+	executor := input.Executor
+	if executor == nil {
+		executor = ExecCommand
+	}
+
+	// Containers that exited in an earlier run would otherwise be counted
+	// towards the scale by compose and started again
+	err := removeLeftoverContainers(ctx, RemoveLeftoverContainersInput{
+		Client:       input.Client,
+		Logger:       input.Logger,
+		ProjectLabel: input.ProjectLabel,
+		ProjectName:  input.ProjectName,
+		ServiceName:  input.ServiceName,
+	})
+	if err != nil {
+		return output, err
+	}
+
+	err = runComposeCommand(ctx, executor, ExecCommandInput{
+		Command: "docker",
+		Args: composeCommandArgs(ComposeCommandArgsInput{
+			ComposeFile:              input.ComposeFile,
+			OverlayFiles:             input.OverlayFiles,
+			ProjectName:              input.ProjectName,
+			QuietPull:                input.QuietPull,
+			RecreateAnonymousVolumes: input.RecreateAnonymousVolumes,
+			SkipPull:                 input.SkipPull,
+		},
+			"create",
+			"--scale", fmt.Sprintf("%s=%d", input.ServiceName, input.Replicas),
+			input.ServiceName,
+		),
+		WorkingDirectory: input.ProjectDir,
+	})
+	if err != nil {
+		return output, fmt.Errorf("error creating containers: %v", err)
+	}
+
+	containers, err := composeContainers(ComposeContainersInput{
+		Client:       input.Client,
+		ProjectLabel: input.ProjectLabel,
+		ProjectName:  input.ProjectName,
+		ServiceName:  input.ServiceName,
+	})
+	if err != nil {
+		return output, fmt.Errorf("error getting created containers: %v", err)
+	}
+
+	// Only the containers created by this run are started, so one still
+	// running from an earlier run is left alone
+	containers = slices.DeleteFunc(containers, func(c container.Summary) bool {
+		return c.State != container.StateCreated
+	})
+	if len(containers) == 0 {
+		return output, fmt.Errorf("no containers found for service %s", input.ServiceName)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var runErr error
+	for _, c := range containers {
+		wg.Add(1)
+		go func(c container.Summary) {
+			defer wg.Done()
+
+			exitCode, err := runContainerToCompletion(ctx, input.Client, c.ID)
+			if err == nil && exitCode != 0 {
+				err = fmt.Errorf("container %s exited with code %d", c.ID[:12], exitCode)
+			}
+
+			if err != nil {
+				input.Logger.Info(fmt.Sprintf("Container %s failed: %v", c.ID[:12], err))
+				mu.Lock()
+				output.Failed++
+				if runErr == nil {
+					runErr = err
+				}
+				mu.Unlock()
+				return
+			}
+
+			input.Logger.Info(fmt.Sprintf("Container %s completed successfully", c.ID[:12]))
+			mu.Lock()
+			output.Succeeded++
+			mu.Unlock()
+		}(c)
+	}
+	wg.Wait()
+
+	input.Logger.Info(fmt.Sprintf("Service ran to completion: service=%s, succeeded=%d, failed=%d", input.ServiceName, output.Succeeded, output.Failed))
+	return output, runErr
+}
+
+// runContainerToCompletion starts a container and returns its exit code
+func runContainerToCompletion(ctx context.Context, client DockerClientInterface, containerID string) (int64, error) {
+	if err := client.ContainerStart(ctx, containerID, container.StartOptions{}); err != nil {
+		return 0, fmt.Errorf("error starting container %s: %v", containerID[:12], err)
+	}
+
+	respCh, errCh := client.ContainerWait(ctx, containerID, container.WaitConditionNotRunning)
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case err := <-errCh:
+		return 0, fmt.Errorf("error waiting for container %s: %v", containerID[:12], err)
+	case resp := <-respCh:
+		if resp.Error != nil {
+			return 0, fmt.Errorf("error waiting for container %s: %s", containerID[:12], resp.Error.Message)
+		}
+		return resp.StatusCode, nil
+	}
+}
@@ -3,14 +3,22 @@ package internal
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"text/template"
 	"time"
 
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
 	"github.com/josegonzalez/cli-skeleton/command"
 	"github.com/rs/zerolog"
 )
@@ -93,6 +101,240 @@ func TestContainerNameTemplate(t *testing.T) {
 	}
 }
 
+func TestComposeCommandArgs(t *testing.T) {
+	args := composeCommandArgs(ComposeCommandArgsInput{
+		ComposeFile:  "/app/docker-compose.yaml",
+		OverlayFiles: []string{"/tmp/overlay-1.json", "/tmp/overlay-2.json"},
+		ProjectName:  "proj",
+	}, "create", "web")
+
+	expected := []string{
+		"compose",
+		"-f", "/app/docker-compose.yaml",
+		"-f", "/tmp/overlay-1.json",
+		"-f", "/tmp/overlay-2.json",
+		"-p", "proj",
+		"create", "web",
+	}
+	if strings.Join(args, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected args %v, got %v", expected, args)
+	}
+}
+
+func TestComposeCommandArgsQuietPull(t *testing.T) {
+	input := ComposeCommandArgsInput{
+		ComposeFile: "/app/docker-compose.yaml",
+		ProjectName: "proj",
+		QuietPull:   true,
+	}
+
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{args: []string{"create", "--scale", "web=2", "web"}, expected: "compose -f /app/docker-compose.yaml -p proj create --quiet-pull --scale web=2 web"},
+		{args: []string{"up", "--detach", "web"}, expected: "compose -f /app/docker-compose.yaml -p proj up --quiet-pull --detach web"},
+		{args: []string{"rm", "--force", "web"}, expected: "compose -f /app/docker-compose.yaml -p proj rm --force web"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.args[0], func(t *testing.T) {
+			args := composeCommandArgs(input, tt.args...)
+			if strings.Join(args, " ") != tt.expected {
+				t.Errorf("expected args %q, got %q", tt.expected, strings.Join(args, " "))
+			}
+		})
+	}
+}
+
+func TestComposeCommandArgsSkipPull(t *testing.T) {
+	input := ComposeCommandArgsInput{
+		ComposeFile: "/app/docker-compose.yaml",
+		ProjectName: "proj",
+		SkipPull:    true,
+	}
+
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{args: []string{"create", "--scale", "web=2", "web"}, expected: "compose -f /app/docker-compose.yaml -p proj create --pull never --scale web=2 web"},
+		{args: []string{"up", "--detach", "web"}, expected: "compose -f /app/docker-compose.yaml -p proj up --pull never --detach web"},
+		{args: []string{"rm", "--force", "web"}, expected: "compose -f /app/docker-compose.yaml -p proj rm --force web"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.args[0], func(t *testing.T) {
+			args := composeCommandArgs(input, tt.args...)
+			if strings.Join(args, " ") != tt.expected {
+				t.Errorf("expected args %q, got %q", tt.expected, strings.Join(args, " "))
+			}
+		})
+	}
+}
+
+// composeFlagConflict mirrors the flag validation of docker compose that the
+// argv alone does not show: create has no --renew-anon-volumes, and up
+// rejects it alongside --no-recreate
+func composeFlagConflict(args []string) error {
+	renew := slices.Contains(args, "--renew-anon-volumes")
+	if renew && slices.Contains(args, "create") {
+		return errors.New("unknown flag: --renew-anon-volumes")
+	}
+	if renew && slices.Contains(args, "--no-recreate") {
+		return errors.New("--no-recreate and --renew-anon-volumes are incompatible")
+	}
+	return nil
+}
+
+func TestComposeCommandArgsRecreateAnonymousVolumes(t *testing.T) {
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	tests := []struct {
+		enabled    bool
+		noRecreate bool
+		expected   string
+	}{
+		{enabled: false, noRecreate: false, expected: "create --scale web=2 web"},
+		{enabled: true, noRecreate: false, expected: "up --no-start --renew-anon-volumes --scale web=2 web"},
+		{enabled: false, noRecreate: true, expected: "create --scale web=2 --no-recreate web"},
+		// new containers never inherit anonymous volumes, so there is nothing to renew
+		{enabled: true, noRecreate: true, expected: "create --scale web=2 --no-recreate web"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("enabled=%t,no-recreate=%t", tt.enabled, tt.noRecreate), func(t *testing.T) {
+			var createArgs []string
+			executor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+				createArgs = input.Args
+				if err := composeFlagConflict(input.Args); err != nil {
+					return ExecCommandResponse{ExitCode: 1}, err
+				}
+				return ExecCommandResponse{}, errors.New("stop after create")
+			}
+
+			err := scaleUpContainers(context.Background(), ScaleUpContainersInput{
+				Client:                   &mockDockerClient{},
+				ComposeFile:              "docker-compose.yml",
+				DesiredReplicas:          2,
+				Executor:                 executor,
+				Logger:                   logger,
+				NoRecreate:               tt.noRecreate,
+				Parallelism:              1,
+				ProjectName:              "proj",
+				RecreateAnonymousVolumes: tt.enabled,
+				ServiceName:              "web",
+			})
+			if err == nil || !strings.Contains(err.Error(), "stop after create") {
+				t.Fatalf("expected compose to accept the flags, got %v", err)
+			}
+
+			expected := "compose -f docker-compose.yml -p proj " + tt.expected
+			if strings.Join(createArgs, " ") != expected {
+				t.Errorf("expected args %q, got %q", expected, strings.Join(createArgs, " "))
+			}
+		})
+	}
+
+	t.Run("rolling update up", func(t *testing.T) {
+		args := composeCommandArgs(ComposeCommandArgsInput{
+			ComposeFile:              "docker-compose.yml",
+			ProjectName:              "proj",
+			RecreateAnonymousVolumes: true,
+		}, "up", "--detach", "--scale", "web=4", "--no-deps", "--no-recreate", "web")
+		if err := composeFlagConflict(args); err != nil {
+			t.Errorf("expected compose to accept %v, got %v", args, err)
+		}
+	})
+}
+
+func TestComposeContainersProjectLabel(t *testing.T) {
+	tests := []struct {
+		name          string
+		projectLabel  string
+		expectedLabel string
+	}{
+		{
+			name:          "defaults to the project name",
+			projectLabel:  "",
+			expectedLabel: "com.docker.compose.project=proj",
+		},
+		{
+			name:          "override label",
+			projectLabel:  "legacy-proj",
+			expectedLabel: "com.docker.compose.project=legacy-proj",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var listOptions container.ListOptions
+			mock := &mockDockerClient{
+				containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+					listOptions = options
+					return nil, nil
+				},
+			}
+
+			_, err := composeContainers(ComposeContainersInput{
+				Client:       mock,
+				ProjectLabel: tt.projectLabel,
+				ProjectName:  "proj",
+				ServiceName:  "web",
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			labels := listOptions.Filters.Get("label")
+			if !slices.Contains(labels, tt.expectedLabel) {
+				t.Errorf("expected label filter %s, got %v", tt.expectedLabel, labels)
+			}
+			if len(labels) != 2 {
+				t.Errorf("expected a project and a service label filter, got %v", labels)
+			}
+		})
+	}
+}
+
+func TestComposeContainersExtraFilters(t *testing.T) {
+	containers := []container.Summary{
+		{ID: "first_deploy", Labels: map[string]string{"com.docker.compose.project": "proj", DeployIDLabel: "abc123"}},
+		{ID: "second_deploy", Labels: map[string]string{"com.docker.compose.project": "proj", DeployIDLabel: "def456"}},
+		{ID: "unlabeled", Labels: map[string]string{"com.docker.compose.project": "proj"}},
+	}
+	mock := &mockDockerClient{
+		containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+			matching := []container.Summary{}
+			for _, c := range containers {
+				if options.Filters.MatchKVList("label", c.Labels) {
+					matching = append(matching, c)
+				}
+			}
+			return matching, nil
+		},
+	}
+
+	got, err := composeContainers(ComposeContainersInput{
+		Client:       mock,
+		ExtraFilters: []filters.KeyValuePair{filters.Arg("label", fmt.Sprintf("%s=abc123", DeployIDLabel))},
+		ProjectName:  "proj",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(got) != 1 || got[0].ID != "first_deploy" {
+		t.Errorf("expected only the container from the matching deploy, got %v", got)
+	}
+}
+
 func TestComposeFile(t *testing.T) {
 	// create a temporary directory
 	tempDir := t.TempDir()
@@ -155,6 +397,246 @@ func TestComposeFile(t *testing.T) {
 	})
 }
 
+func TestComposeFiles(t *testing.T) {
+	// create a temporary directory
+	tempDir := t.TempDir()
+
+	// change to the temporary directory
+	origWd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := os.Chdir(tempDir); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() {
+		_ = os.Chdir(origWd)
+	}()
+
+	tests := []struct {
+		name     string
+		files    []string
+		expected []string
+	}{
+		{
+			name:     "base only",
+			files:    []string{"docker-compose.yaml"},
+			expected: []string{"docker-compose.yaml"},
+		},
+		{
+			name:     "yaml base with yaml override",
+			files:    []string{"docker-compose.yaml", "docker-compose.override.yaml"},
+			expected: []string{"docker-compose.yaml", "docker-compose.override.yaml"},
+		},
+		{
+			name:     "yaml base with yml override",
+			files:    []string{"docker-compose.yaml", "docker-compose.override.yml"},
+			expected: []string{"docker-compose.yaml", "docker-compose.override.yml"},
+		},
+		{
+			name:     "yml base with yaml override",
+			files:    []string{"docker-compose.yml", "docker-compose.override.yaml"},
+			expected: []string{"docker-compose.yml", "docker-compose.override.yaml"},
+		},
+		{
+			name:     "yml base with yml override",
+			files:    []string{"docker-compose.yml", "docker-compose.override.yml"},
+			expected: []string{"docker-compose.yml", "docker-compose.override.yml"},
+		},
+		{
+			name:     "only the first override is used",
+			files:    []string{"docker-compose.yml", "docker-compose.override.yaml", "docker-compose.override.yml"},
+			expected: []string{"docker-compose.yml", "docker-compose.override.yaml"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, file := range tt.files {
+				f, err := os.Create(file)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				f.Close()
+				defer os.Remove(file)
+			}
+
+			paths, err := ComposeFiles()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			names := []string{}
+			for _, path := range paths {
+				if !filepath.IsAbs(path) {
+					t.Errorf("expected an absolute path, got %s", path)
+				}
+				names = append(names, filepath.Base(path))
+			}
+			if strings.Join(names, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("expected files %v, got %v", tt.expected, names)
+			}
+		})
+	}
+
+	t.Run("override without base", func(t *testing.T) {
+		f, err := os.Create("docker-compose.override.yml")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		f.Close()
+		defer os.Remove("docker-compose.override.yml")
+
+		if _, err := ComposeFiles(); err == nil {
+			t.Fatal("expected error, got nil")
+		}
+	})
+}
+
+func TestComposeProjectFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	baseFile := filepath.Join(tempDir, "docker-compose.yml")
+	overrideFile := filepath.Join(tempDir, "docker-compose.override.yml")
+
+	if err := os.WriteFile(baseFile, []byte("services:\n  web:\n    image: nginx:1.27\n"), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := os.WriteFile(overrideFile, []byte("services:\n  web:\n    image: nginx:1.27-alpine\n"), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	project, err := ComposeProjectFiles("proj", []string{baseFile, overrideFile}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	service, err := project.GetService("web")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if service.Image != "nginx:1.27-alpine" {
+		t.Errorf("expected override image nginx:1.27-alpine, got %s", service.Image)
+	}
+}
+
+func TestComposeProjectFilesUpdateConfig(t *testing.T) {
+	tempDir := t.TempDir()
+	baseFile := filepath.Join(tempDir, "docker-compose.yml")
+	overrideFile := filepath.Join(tempDir, "docker-compose.override.yml")
+
+	base := `services:
+  web:
+    image: nginx:1.27
+    deploy:
+      replicas: 4
+      update_config:
+        parallelism: 1
+        delay: 5s
+        order: start-first
+        x-healthcheck-success-threshold: 2
+`
+	override := `services:
+  web:
+    deploy:
+      update_config:
+        parallelism: 3
+`
+	if err := os.WriteFile(baseFile, []byte(base), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := os.WriteFile(overrideFile, []byte(override), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	project, err := ComposeProjectFiles("proj", []string{baseFile, overrideFile}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	service, err := project.GetService("web")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	params, err := resolveDeployParams(context.Background(), DeployServiceInput{ServiceName: "web"}, &service)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if params.Parallelism != 3 {
+		t.Errorf("expected the override parallelism of 3, got %d", params.Parallelism)
+	}
+	// keys the override does not set are kept from the base file
+	if params.Delay != 5*time.Second || params.Order != "start-first" || params.SuccessThreshold != 2 || params.Replicas != 4 {
+		t.Errorf("expected the base update_config to be merged, got delay=%v, order=%s, success-threshold=%d, replicas=%d", params.Delay, params.Order, params.SuccessThreshold, params.Replicas)
+	}
+}
+
+func TestComposeProjectFilesProfiles(t *testing.T) {
+	tempDir := t.TempDir()
+	composeFile := filepath.Join(tempDir, "docker-compose.yml")
+	contents := "services:\n  web:\n    image: nginx:1.27\n  worker:\n    image: nginx:1.27\n    profiles: [worker]\n  debug:\n    image: nginx:1.27\n    profiles: [debug]\n  admin:\n    image: nginx:1.27\n    profiles: [admin]\n"
+	if err := os.WriteFile(composeFile, []byte(contents), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		env      string
+		profiles []string
+		expected []string
+	}{
+		{name: "no profiles", expected: []string{"web"}},
+		{name: "flag profiles", profiles: []string{"worker"}, expected: []string{"web", "worker"}},
+		{name: "env profiles", env: "worker, debug", expected: []string{"debug", "web", "worker"}},
+		{name: "env and flag profiles are merged", env: "debug,worker", profiles: []string{"admin", "worker"}, expected: []string{"admin", "debug", "web", "worker"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("COMPOSE_PROFILES", tt.env)
+
+			project, err := ComposeProject("proj", composeFile, tt.profiles)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			serviceNames := project.ServiceNames()
+			slices.Sort(serviceNames)
+			if !slices.Equal(serviceNames, tt.expected) {
+				t.Errorf("expected services %v, got %v", tt.expected, serviceNames)
+			}
+		})
+	}
+}
+
+func TestDumpComposeConfig(t *testing.T) {
+	tempDir := t.TempDir()
+	composeFile := filepath.Join(tempDir, "docker-compose.yml")
+	dumpFile := filepath.Join(tempDir, "resolved.yml")
+
+	if err := os.WriteFile(composeFile, []byte("services:\n  web:\n    image: nginx:${NGINX_TAG:-1.27}\n"), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	project, err := ComposeProject("proj", composeFile, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := DumpComposeConfig(project, dumpFile); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	contents, err := os.ReadFile(dumpFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(contents), "image: nginx:1.27") {
+		t.Errorf("expected dumped config to contain the resolved image, got:\n%s", contents)
+	}
+}
+
 func TestRenameContainersToConvention(t *testing.T) {
 	ctx := context.Background()
 	containers := []container.Summary{
@@ -188,6 +670,30 @@ func TestRenameContainersToConvention(t *testing.T) {
 		}
 	})
 
+	t.Run("profile-aware template", func(t *testing.T) {
+		mock := &mockDockerClient{}
+		input := RenameContainersToConventionInput{
+			Client:       mock,
+			Containers:   containers,
+			ProjectName:  "proj",
+			ServiceName:  "web",
+			NameTemplate: "{{.Profile}}-{{.ProjectName}}-{{.ServiceName}}-{{.InstanceID}}",
+			Profiles:     []string{"staging", "blue"},
+		}
+
+		err := renameContainersToConvention(ctx, input)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if mock.renamedContainers["id1_container_id"] != "blue-staging-proj-web-1" {
+			t.Errorf("expected id1_container_id renamed to blue-staging-proj-web-1, got %s", mock.renamedContainers["id1_container_id"])
+		}
+		if mock.renamedContainers["id2_container_id"] != "blue-staging-proj-web-2" {
+			t.Errorf("expected id2_container_id renamed to blue-staging-proj-web-2, got %s", mock.renamedContainers["id2_container_id"])
+		}
+	})
+
 	t.Run("skip renaming if already correct", func(t *testing.T) {
 		mock := &mockDockerClient{}
 		containersWithCorrectNames := []container.Summary{
@@ -345,7 +851,7 @@ func TestRollingUpdateBatchStopFirst(t *testing.T) {
 					},
 				}, nil
 			},
-			containerTerminate: func(ctx context.Context, id string) error {
+			containerTerminate: func(ctx context.Context, id string, stopTimeout time.Duration) error {
 				terminatedIds = append(terminatedIds, id)
 				return nil
 			},
@@ -414,7 +920,7 @@ func TestRollingUpdateBatchStopFirst(t *testing.T) {
 					},
 				}, nil
 			},
-			containerTerminate: func(ctx context.Context, id string) error {
+			containerTerminate: func(ctx context.Context, id string, stopTimeout time.Duration) error {
 				return nil
 			},
 		}
@@ -504,7 +1010,7 @@ func TestRollingUpdateContainers(t *testing.T) {
 					},
 				}, nil
 			},
-			containerTerminate: func(ctx context.Context, id string) error {
+			containerTerminate: func(ctx context.Context, id string, stopTimeout time.Duration) error {
 				terminatedIds = append(terminatedIds, id)
 				return nil
 			},
@@ -587,7 +1093,7 @@ func TestRollingUpdateContainers(t *testing.T) {
 					},
 				}, nil
 			},
-			containerTerminate: func(ctx context.Context, id string) error {
+			containerTerminate: func(ctx context.Context, id string, stopTimeout time.Duration) error {
 				terminatedIds = append(terminatedIds, id)
 				return nil
 			},
@@ -632,6 +1138,96 @@ func TestRollingUpdateContainers(t *testing.T) {
 	})
 }
 
+func TestRollingUpdateContainersProgress(t *testing.T) {
+	ctx := context.Background()
+	var buf bytes.Buffer
+	writer := zerolog.SyncWriter(&buf)
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(writer).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(writer).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	// the batch goroutines list containers concurrently
+	var mu sync.Mutex
+	listCallCount := 0
+	mock := &mockDockerClient{
+		containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			listCallCount++
+			if listCallCount%2 == 1 {
+				return []container.Summary{}, nil
+			}
+			return []container.Summary{
+				{ID: "new_container_id", Created: 300},
+			}, nil
+		},
+		containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+			return container.InspectResponse{
+				ContainerJSONBase: &container.ContainerJSONBase{
+					State: &container.State{
+						Running: true,
+					},
+				},
+			}, nil
+		},
+	}
+
+	executor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+		return ExecCommandResponse{ExitCode: 0}, nil
+	}
+
+	containers := []container.Summary{
+		{ID: "old1_container_id", Created: 50},
+		{ID: "old2_container_id", Created: 60},
+		{ID: "old3_container_id", Created: 70},
+		{ID: "old4_container_id", Created: 80},
+		{ID: "old5_container_id", Created: 90},
+	}
+
+	input := RollingUpdateInput{
+		Client:             mock,
+		Executor:           executor,
+		Logger:             logger,
+		ProjectName:        "proj",
+		ServiceName:        "web",
+		Parallelism:        2, // 3 batches
+		Order:              "stop-first",
+		ContainersToUpdate: containers,
+		TickerCh:           testTickerCh(),
+	}
+
+	if _, err := rollingUpdateContainers(ctx, input); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	output := buf.String()
+	expectedLines := []string{
+		"Rolling update progress: batch=1/3, complete=0%",
+		"Rolling update progress: batch=2/3, complete=40%",
+		"Rolling update progress: batch=3/3, complete=80%",
+	}
+	for _, expected := range expectedLines {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected output to contain %q, got: %s", expected, output)
+		}
+	}
+
+	// an unset parallelism updates one container at a time instead of
+	// dividing by zero
+	buf.Reset()
+	input.Parallelism = 0
+	if _, err := rollingUpdateContainers(ctx, input); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if output := buf.String(); !strings.Contains(output, "Rolling update progress: batch=5/5, complete=80%") {
+		t.Errorf("expected one container per batch, got: %s", output)
+	}
+}
+
 func TestRollingUpdateBatchStartFirst(t *testing.T) {
 	ctx := context.Background()
 	var buf bytes.Buffer
@@ -670,7 +1266,7 @@ func TestRollingUpdateBatchStartFirst(t *testing.T) {
 					},
 				}, nil
 			},
-			containerTerminate: func(ctx context.Context, id string) error {
+			containerTerminate: func(ctx context.Context, id string, stopTimeout time.Duration) error {
 				terminatedIds = append(terminatedIds, id)
 				return nil
 			},
@@ -718,41 +1314,57 @@ func TestRollingUpdateBatchStartFirst(t *testing.T) {
 		}
 	})
 
-	t.Run("failure ratio exceeded", func(t *testing.T) {
+	t.Run("live container cap trips on repeated failures", func(t *testing.T) {
 		listCallCount := 0
+		terminatedIds := make([]string, 0)
 		mock := &mockDockerClient{
 			containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
 				listCallCount++
-				if listCallCount == 1 {
+				switch listCallCount {
+				case 1:
+					return []container.Summary{
+						{ID: "old1_container_id", Created: 50},
+						{ID: "old2_container_id", Created: 60},
+					}, nil
+				case 2:
 					return []container.Summary{
 						{ID: "old1_container_id", Created: 50},
+						{ID: "old2_container_id", Created: 60},
+						{ID: "new1_container_id", Created: 300},
+					}, nil
+				default:
+					// a leaked container from the failed batch is still running
+					return []container.Summary{
+						{ID: "old1_container_id", Created: 50},
+						{ID: "old2_container_id", Created: 60},
+						{ID: "leaked_container_id", Created: 310},
 					}, nil
 				}
-				return []container.Summary{
-					{ID: "old1_container_id", Created: 50},
-					{ID: "new1_container_id", Created: 300},
-				}, nil
 			},
 			containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
 				return container.InspectResponse{
 					ContainerJSONBase: &container.ContainerJSONBase{
 						State: &container.State{
-							Running: false, // will cause healthcheck failure
+							Running: false,
 						},
 					},
 				}, nil
 			},
-			containerTerminate: func(ctx context.Context, id string) error {
+			containerTerminate: func(ctx context.Context, id string, stopTimeout time.Duration) error {
+				terminatedIds = append(terminatedIds, id)
 				return nil
 			},
 		}
 
+		executorCallCount := 0
 		executor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+			executorCallCount++
 			return ExecCommandResponse{ExitCode: 0}, nil
 		}
 
-		batch := []container.Summary{
+		containers := []container.Summary{
 			{ID: "old1_container_id", Created: 50},
+			{ID: "old2_container_id", Created: 60},
 		}
 
 		input := RollingUpdateInput{
@@ -761,47 +1373,346 @@ func TestRollingUpdateBatchStartFirst(t *testing.T) {
 			Logger:             logger,
 			ProjectName:        "proj",
 			ServiceName:        "web",
+			DesiredReplicas:    2,
 			Parallelism:        1,
-			MaxFailureRatio:    0.1, // 10%
-			ContainersToUpdate: batch,
+			Order:              "start-first",
+			ContainersToUpdate: containers,
 			TickerCh:           testTickerCh(),
 		}
 
-		output := &RollingUpdateOutput{}
-		err := rollingUpdateBatchStartFirst(ctx, input, batch, output)
+		_, err := rollingUpdateContainers(ctx, input)
 		if err == nil {
 			t.Fatal("expected error, got nil")
 		}
-		if !strings.Contains(err.Error(), "max failure ratio exceeded") {
-			t.Errorf("expected error to contain 'max failure ratio exceeded', got '%s'", err.Error())
+		if !strings.Contains(err.Error(), "live container count would exceed safety cap (4 > 3)") {
+			t.Errorf("expected safety cap error, got '%s'", err.Error())
 		}
-		if output.Failures != 1 {
-			t.Errorf("expected 1 failure, got %d", output.Failures)
+		if executorCallCount != 1 {
+			t.Errorf("expected only the first batch to start containers, got %d executor calls", executorCallCount)
+		}
+		if len(terminatedIds) != 1 || terminatedIds[0] != "new1_container_id" {
+			t.Errorf("expected only the failed new container to be terminated, got %v", terminatedIds)
 		}
 	})
-}
-
-func TestScaleDownContainers(t *testing.T) {
-	ctx := context.Background()
-	var buf bytes.Buffer
-	logger := &command.ZerologUi{
-		StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
-		StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
-		OriginalFields:    nil,
-		Ui:                nil,
-		OutputIndentField: false,
-	}
 
-	t.Run("successful scale down", func(t *testing.T) {
+	t.Run("keep old leaves old containers running", func(t *testing.T) {
+		listCallCount := 0
 		terminatedIds := make([]string, 0)
 		mock := &mockDockerClient{
-			containerTerminate: func(ctx context.Context, id string) error {
-				terminatedIds = append(terminatedIds, id)
-				return nil
-			},
-		}
-
-		containers := []container.Summary{
+			containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+				listCallCount++
+				containers := []container.Summary{
+					{ID: "old1_container_id", Created: 50},
+					{ID: "old2_container_id", Created: 60},
+				}
+				if listCallCount >= 2 {
+					containers = append(containers, container.Summary{ID: "new1_container_id", Created: 300})
+				}
+				if listCallCount >= 4 {
+					containers = append(containers, container.Summary{ID: "new2_container_id", Created: 310})
+				}
+				return containers, nil
+			},
+			containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+				return container.InspectResponse{
+					ContainerJSONBase: &container.ContainerJSONBase{
+						State: &container.State{
+							Running: true,
+						},
+					},
+				}, nil
+			},
+			containerTerminate: func(ctx context.Context, id string, stopTimeout time.Duration) error {
+				terminatedIds = append(terminatedIds, id)
+				return nil
+			},
+		}
+
+		executor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+			return ExecCommandResponse{ExitCode: 0}, nil
+		}
+
+		containers := []container.Summary{
+			{ID: "old1_container_id", Created: 50},
+			{ID: "old2_container_id", Created: 60},
+		}
+
+		input := RollingUpdateInput{
+			Client:             mock,
+			Executor:           executor,
+			KeepOld:            true,
+			Logger:             logger,
+			ProjectName:        "proj",
+			ServiceName:        "web",
+			DesiredReplicas:    2,
+			Parallelism:        1,
+			Order:              "start-first",
+			ContainersToUpdate: containers,
+			TickerCh:           testTickerCh(),
+		}
+
+		output, err := rollingUpdateContainers(ctx, input)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(terminatedIds) != 0 {
+			t.Errorf("expected no containers to be terminated, got %v", terminatedIds)
+		}
+		if output.TotalUpdates != 2 {
+			t.Errorf("expected 2 total updates, got %d", output.TotalUpdates)
+		}
+	})
+
+	t.Run("on healthy host command runs for each new container", func(t *testing.T) {
+		listCallCount := 0
+		terminatedIds := make([]string, 0)
+		mock := &mockDockerClient{
+			containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+				listCallCount++
+				containers := []container.Summary{
+					{ID: "old1_container_id", Created: 50},
+					{ID: "old2_container_id", Created: 60},
+				}
+				if listCallCount >= 2 {
+					containers = append(containers, container.Summary{ID: "new1_container_id", Created: 300})
+				}
+				if listCallCount >= 4 {
+					containers = append(containers, container.Summary{ID: "new2_container_id", Created: 310})
+				}
+				return slices.DeleteFunc(containers, func(c container.Summary) bool {
+					return slices.Contains(terminatedIds, c.ID)
+				}), nil
+			},
+			containerTerminate: func(ctx context.Context, id string, stopTimeout time.Duration) error {
+				terminatedIds = append(terminatedIds, id)
+				return nil
+			},
+			containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+				return container.InspectResponse{
+					ContainerJSONBase: &container.ContainerJSONBase{
+						State: &container.State{
+							Running: true,
+						},
+					},
+					NetworkSettings: &container.NetworkSettings{},
+				}, nil
+			},
+		}
+
+		hooks := []string{}
+		executor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+			if strings.HasPrefix(filepath.Base(input.Command), "on-healthy-") {
+				script, err := os.ReadFile(input.Command)
+				if err != nil {
+					t.Errorf("unexpected error reading hook script: %v", err)
+				}
+				hooks = append(hooks, strings.TrimPrefix(string(script), "#!/usr/bin/env bash\n"))
+			}
+			return ExecCommandResponse{ExitCode: 0}, nil
+		}
+
+		input := RollingUpdateInput{
+			Client:               mock,
+			Executor:             executor,
+			Logger:               logger,
+			OnHealthyHostCommand: "register {{.ContainerShortID}}",
+			ProjectName:          "proj",
+			ServiceName:          "web",
+			DesiredReplicas:      2,
+			Parallelism:          1,
+			Order:                "start-first",
+			ContainersToUpdate: []container.Summary{
+				{ID: "old1_container_id", Created: 50},
+				{ID: "old2_container_id", Created: 60},
+			},
+			TickerCh: testTickerCh(),
+		}
+
+		_, err := rollingUpdateContainers(ctx, input)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected := []string{"register new1_contain", "register new2_contain"}
+		if !slices.Equal(hooks, expected) {
+			t.Errorf("expected hooks %v, got %v", expected, hooks)
+		}
+	})
+
+	t.Run("inherit labels from old container", func(t *testing.T) {
+		listCallCount := 0
+		mock := &mockDockerClient{
+			containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+				listCallCount++
+				if listCallCount == 1 {
+					return []container.Summary{
+						{ID: "old1_container_id", Created: 50},
+					}, nil
+				}
+				return []container.Summary{
+					{ID: "old1_container_id", Created: 50},
+					{ID: "new1_container_id", Created: 300},
+				}, nil
+			},
+			containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+				labels := map[string]string{}
+				if id == "old1_container_id" {
+					labels = map[string]string{"canary-weight": "10", "unrelated": "value"}
+				}
+				return container.InspectResponse{
+					ContainerJSONBase: &container.ContainerJSONBase{
+						State: &container.State{
+							Running: true,
+						},
+					},
+					Config: &container.Config{Labels: labels},
+				}, nil
+			},
+			containerTerminate: func(ctx context.Context, id string, stopTimeout time.Duration) error {
+				return nil
+			},
+		}
+
+		var overlay map[string]map[string]map[string]map[string]string
+		executor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+			if !slices.Contains(input.Args, "up") {
+				return ExecCommandResponse{ExitCode: 0}, nil
+			}
+
+			// the inherited labels overlay is the last file passed
+			index := -1
+			for i, arg := range input.Args {
+				if arg == "-f" {
+					index = i
+				}
+			}
+			contents, err := os.ReadFile(input.Args[index+1])
+			if err != nil {
+				t.Fatalf("unexpected error reading overlay: %v", err)
+			}
+			if err := json.Unmarshal(contents, &overlay); err != nil {
+				t.Fatalf("unexpected error parsing overlay: %v", err)
+			}
+			return ExecCommandResponse{ExitCode: 0}, nil
+		}
+
+		batch := []container.Summary{
+			{ID: "old1_container_id", Created: 50},
+		}
+
+		input := RollingUpdateInput{
+			Client:             mock,
+			ComposeFile:        "/tmp/docker-compose.yaml",
+			Executor:           executor,
+			InheritLabels:      []string{"canary-weight", "missing"},
+			Logger:             logger,
+			ProjectName:        "proj",
+			ServiceName:        "web",
+			Parallelism:        1,
+			ContainersToUpdate: batch,
+			TickerCh:           testTickerCh(),
+		}
+
+		output := &RollingUpdateOutput{}
+		err := rollingUpdateBatchStartFirst(ctx, input, batch, output)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		labels := overlay["services"]["web"]["labels"]
+		if labels["canary-weight"] != "10" {
+			t.Errorf("expected canary-weight label to be inherited, got %v", labels)
+		}
+		if len(labels) != 1 {
+			t.Errorf("expected only the requested label to be inherited, got %v", labels)
+		}
+	})
+
+	t.Run("failure ratio exceeded", func(t *testing.T) {
+		listCallCount := 0
+		mock := &mockDockerClient{
+			containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+				listCallCount++
+				if listCallCount == 1 {
+					return []container.Summary{
+						{ID: "old1_container_id", Created: 50},
+					}, nil
+				}
+				return []container.Summary{
+					{ID: "old1_container_id", Created: 50},
+					{ID: "new1_container_id", Created: 300},
+				}, nil
+			},
+			containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+				return container.InspectResponse{
+					ContainerJSONBase: &container.ContainerJSONBase{
+						State: &container.State{
+							Running: false, // will cause healthcheck failure
+						},
+					},
+				}, nil
+			},
+			containerTerminate: func(ctx context.Context, id string, stopTimeout time.Duration) error {
+				return nil
+			},
+		}
+
+		executor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+			return ExecCommandResponse{ExitCode: 0}, nil
+		}
+
+		batch := []container.Summary{
+			{ID: "old1_container_id", Created: 50},
+		}
+
+		input := RollingUpdateInput{
+			Client:             mock,
+			Executor:           executor,
+			Logger:             logger,
+			ProjectName:        "proj",
+			ServiceName:        "web",
+			Parallelism:        1,
+			MaxFailureRatio:    0.1, // 10%
+			ContainersToUpdate: batch,
+			TickerCh:           testTickerCh(),
+		}
+
+		output := &RollingUpdateOutput{}
+		err := rollingUpdateBatchStartFirst(ctx, input, batch, output)
+		if err == nil {
+			t.Fatal("expected error, got nil")
+		}
+		if !strings.Contains(err.Error(), "max failure ratio exceeded") {
+			t.Errorf("expected error to contain 'max failure ratio exceeded', got '%s'", err.Error())
+		}
+		if output.Failures != 1 {
+			t.Errorf("expected 1 failure, got %d", output.Failures)
+		}
+	})
+}
+
+func TestScaleDownContainers(t *testing.T) {
+	ctx := context.Background()
+	var buf bytes.Buffer
+	writer := zerolog.SyncWriter(&buf)
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(writer).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(writer).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	t.Run("successful scale down", func(t *testing.T) {
+		terminatedIds := make([]string, 0)
+		mock := &mockDockerClient{
+			containerTerminate: func(ctx context.Context, id string, stopTimeout time.Duration) error {
+				terminatedIds = append(terminatedIds, id)
+				return nil
+			},
+		}
+
+		containers := []container.Summary{
 			{ID: "id1_oldest_container", Created: 100},
 			{ID: "id3_newest_container", Created: 300},
 			{ID: "id2_middle_container", Created: 200},
@@ -834,9 +1745,174 @@ func TestScaleDownContainers(t *testing.T) {
 		}
 	})
 
+	t.Run("scale down keep policies", func(t *testing.T) {
+		tests := []struct {
+			keep     string
+			expected []string
+		}{
+			{keep: "", expected: []string{"old_healthy", "mid_healthy", "mid_unhealthy"}},
+			{keep: "newest", expected: []string{"old_healthy", "mid_healthy", "mid_unhealthy"}},
+			{keep: "oldest", expected: []string{"new_starting", "new_exited", "mid_unhealthy"}},
+			{keep: "healthy", expected: []string{"new_exited", "mid_unhealthy", "new_starting"}},
+		}
+
+		for _, tt := range tests {
+			terminatedIds := make([]string, 0)
+			mock := &mockDockerClient{
+				containerTerminate: func(ctx context.Context, id string, stopTimeout time.Duration) error {
+					terminatedIds = append(terminatedIds, strings.TrimSuffix(id, "_container_id"))
+					return nil
+				},
+			}
+
+			err := scaleDownContainers(ctx, ScaleDownContainersInput{
+				Client: mock,
+				CurrentContainers: []container.Summary{
+					{ID: "mid_healthy_container_id", Created: 200, State: container.StateRunning, Status: "Up 1 minute (healthy)"},
+					{ID: "new_exited_container_id", Created: 300, State: container.StateExited, Status: "Exited (1) 5 seconds ago"},
+					{ID: "old_healthy_container_id", Created: 100, State: container.StateRunning, Status: "Up 2 minutes (healthy)"},
+					{ID: "mid_unhealthy_container_id", Created: 250, State: container.StateRunning, Status: "Up 1 minute (unhealthy)"},
+					{ID: "new_starting_container_id", Created: 400, State: container.StateRunning, Status: "Up 3 seconds (health: starting)"},
+				},
+				CurrentReplicas: 5,
+				DesiredReplicas: 2,
+				Keep:            tt.keep,
+				Logger:          logger,
+				ProjectName:     "proj",
+				ServiceName:     "web",
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !slices.Equal(terminatedIds, tt.expected) {
+				t.Errorf("keep %q: expected %v to be removed, got %v", tt.keep, tt.expected, terminatedIds)
+			}
+		}
+	})
+
+	t.Run("stops containers with the stop grace period", func(t *testing.T) {
+		stopTimeouts := []time.Duration{}
+		mock := &mockDockerClient{
+			containerTerminate: func(ctx context.Context, id string, stopTimeout time.Duration) error {
+				stopTimeouts = append(stopTimeouts, stopTimeout)
+				return nil
+			},
+		}
+
+		err := scaleDownContainers(ctx, ScaleDownContainersInput{
+			Client:            mock,
+			CurrentContainers: []container.Summary{{ID: "id1_oldest_container", Created: 100}, {ID: "id2_newest_container", Created: 200}},
+			CurrentReplicas:   2,
+			DesiredReplicas:   0,
+			Logger:            logger,
+			ProjectName:       "proj",
+			ServiceName:       "web",
+			StopGracePeriod:   3 * time.Second,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !slices.Equal(stopTimeouts, []time.Duration{3 * time.Second, 3 * time.Second}) {
+			t.Errorf("expected every container to be stopped with the grace period, got %v", stopTimeouts)
+		}
+	})
+	t.Run("parallel scale down", func(t *testing.T) {
+		// each termination reports itself and then holds its slot until
+		// released, so the number in flight is known without timing
+		entered := make(chan string)
+		release := make(chan struct{})
+		mock := &mockDockerClient{
+			containerTerminate: func(ctx context.Context, id string, stopTimeout time.Duration) error {
+				entered <- id
+				<-release
+				return nil
+			},
+		}
+
+		containers := []container.Summary{}
+		for i := 7; i >= 1; i-- {
+			containers = append(containers, container.Summary{
+				ID:      fmt.Sprintf("id%d_container_id", i),
+				Created: int64(i * 100),
+			})
+		}
+
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- scaleDownContainers(ctx, ScaleDownContainersInput{
+				Client:            mock,
+				CurrentContainers: containers,
+				CurrentReplicas:   7,
+				DesiredReplicas:   1,
+				Logger:            logger,
+				Parallelism:       3,
+				ProjectName:       "proj",
+				ServiceName:       "web",
+			})
+		}()
+
+		first := []string{<-entered, <-entered, <-entered}
+		select {
+		case id := <-entered:
+			t.Fatalf("expected at most 3 concurrent terminations, %s started while 3 were in flight", id)
+		default:
+		}
+
+		close(release)
+		rest := []string{<-entered, <-entered, <-entered}
+		if err := <-errCh; err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// The oldest containers are stopped first and the newest is kept
+		slices.Sort(first)
+		slices.Sort(rest)
+		if expected := []string{"id1_container_id", "id2_container_id", "id3_container_id"}; !slices.Equal(first, expected) {
+			t.Errorf("expected the oldest containers %v to be stopped first, got %v", expected, first)
+		}
+		if expected := []string{"id4_container_id", "id5_container_id", "id6_container_id"}; !slices.Equal(rest, expected) {
+			t.Errorf("expected the containers %v to be stopped next, got %v", expected, rest)
+		}
+	})
+
+	t.Run("cancelled context", func(t *testing.T) {
+		mock := &mockDockerClient{
+			containerTerminate: func(ctx context.Context, id string, stopTimeout time.Duration) error {
+				t.Error("ContainerTerminate should not have been called")
+				return nil
+			},
+		}
+
+		containers := []container.Summary{
+			{ID: "id1_oldest_container", Created: 100},
+			{ID: "id2_middle_container", Created: 200},
+			{ID: "id3_newest_container", Created: 300},
+		}
+
+		cancelledCtx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		input := ScaleDownContainersInput{
+			Client:            mock,
+			CurrentContainers: containers,
+			CurrentReplicas:   3,
+			DesiredReplicas:   0,
+			Logger:            logger,
+			ProjectName:       "proj",
+			ServiceName:       "web",
+		}
+
+		err := scaleDownContainers(cancelledCtx, input)
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+	})
+
 	t.Run("no scale down needed", func(t *testing.T) {
 		mock := &mockDockerClient{
-			containerTerminate: func(ctx context.Context, id string) error {
+			containerTerminate: func(ctx context.Context, id string, stopTimeout time.Duration) error {
 				t.Error("ContainerTerminate should not have been called")
 				return nil
 			},
@@ -864,9 +1940,10 @@ func TestScaleDownContainers(t *testing.T) {
 func TestScaleUpContainers(t *testing.T) {
 	ctx := context.Background()
 	var buf bytes.Buffer
+	writer := zerolog.SyncWriter(&buf)
 	logger := &command.ZerologUi{
-		StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
-		StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		StderrLogger:      zerolog.New(writer).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(writer).With().Timestamp().Logger(),
 		OriginalFields:    nil,
 		Ui:                nil,
 		OutputIndentField: false,
@@ -963,4 +2040,605 @@ func TestScaleUpContainers(t *testing.T) {
 			t.Errorf("expected error to contain 'max failure ratio exceeded', got '%s'", err.Error())
 		}
 	})
+
+	t.Run("failed batch reports every failure without fail fast", func(t *testing.T) {
+		for _, reportAll := range []bool{true, false} {
+			mock := &mockDockerClient{
+				containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+					return []container.Summary{
+						{ID: "new1_container_id", Names: []string{"/new1"}},
+						{ID: "new2_container_id", Names: []string{"/new2"}},
+					}, nil
+				},
+				containerStart: func(ctx context.Context, id string, options container.StartOptions) error {
+					return fmt.Errorf("port is already allocated")
+				},
+			}
+
+			executor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+				return ExecCommandResponse{ExitCode: 0}, nil
+			}
+
+			err := scaleUpContainers(ctx, ScaleUpContainersInput{
+				Client:             mock,
+				DesiredReplicas:    2,
+				ExistingContainers: []container.Summary{},
+				Executor:           executor,
+				Logger:             logger,
+				Parallelism:        2,
+				ProjectName:        "proj",
+				ReportAllFailures:  reportAll,
+				ServiceName:        "web",
+				TickerCh:           testTickerCh(),
+			})
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+
+			reported := 0
+			for _, id := range []string{"new1_contain", "new2_contain"} {
+				if strings.Contains(err.Error(), fmt.Sprintf("error starting container %s", id)) {
+					reported++
+				}
+			}
+			if reportAll {
+				if reported != 2 || !strings.HasPrefix(err.Error(), "2 containers failed: ") {
+					t.Errorf("expected both failed containers to be reported, got %q", err.Error())
+				}
+			} else if reported != 1 {
+				t.Errorf("expected only the first failure to be reported, got %q", err.Error())
+			}
+		}
+	})
+
+	t.Run("first failure cancels the batch's other healthchecks", func(t *testing.T) {
+		var mu sync.Mutex
+		terminated := []string{}
+		mock := &mockDockerClient{
+			containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+				return []container.Summary{
+					{ID: "new1_container_id", Names: []string{"/new1"}},
+					{ID: "new2_container_id", Names: []string{"/new2"}},
+				}, nil
+			},
+			containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+				// the sibling never settles, so only cancellation ends its wait
+				state := &container.State{Running: true, Health: &container.Health{Status: container.Starting}}
+				if id == "new1_container_id" {
+					state = &container.State{Running: false}
+				}
+				return container.InspectResponse{
+					ContainerJSONBase: &container.ContainerJSONBase{State: state},
+				}, nil
+			},
+			containerTerminate: func(ctx context.Context, id string, stopTimeout time.Duration) error {
+				mu.Lock()
+				terminated = append(terminated, id)
+				mu.Unlock()
+				return nil
+			},
+		}
+
+		executor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+			return ExecCommandResponse{ExitCode: 0}, nil
+		}
+
+		// keep ticking so the sibling polls until it is cancelled
+		ticker := time.NewTicker(time.Millisecond)
+		defer ticker.Stop()
+
+		done := make(chan error, 1)
+		go func() {
+			done <- scaleUpContainers(ctx, ScaleUpContainersInput{
+				Client:             mock,
+				DesiredReplicas:    2,
+				ExistingContainers: []container.Summary{},
+				Executor:           executor,
+				Logger:             logger,
+				Monitor:            time.Hour,
+				Parallelism:        2,
+				ProjectName:        "proj",
+				ServiceName:        "web",
+				TickerCh:           ticker.C,
+			})
+		}()
+
+		var err error
+		select {
+		case err = <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the sibling's health check to be cancelled")
+		}
+		if err == nil || err.Error() != "container new1_contain failed health check: container is not running" {
+			t.Fatalf("expected only the first container's failure to be reported, got %v", err)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		slices.Sort(terminated)
+		if !slices.Equal(terminated, []string{"new1_container_id", "new2_container_id"}) {
+			t.Errorf("expected both containers to be stopped, got %v", terminated)
+		}
+	})
+
+	t.Run("healthcheck timeout action", func(t *testing.T) {
+		// scaleUp scales up a container that never leaves the starting
+		// state, returning the error and the terminated containers
+		scaleUp := func(action string) (error, []string) {
+			terminated := []string{}
+			mock := &mockDockerClient{
+				containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+					return []container.Summary{{ID: "new1_container_id", Names: []string{"/new1"}}}, nil
+				},
+				containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+					return container.InspectResponse{
+						ContainerJSONBase: &container.ContainerJSONBase{
+							State: &container.State{
+								Running: true,
+								Health:  &container.Health{Status: container.Starting},
+							},
+						},
+					}, nil
+				},
+				containerTerminate: func(ctx context.Context, id string, stopTimeout time.Duration) error {
+					terminated = append(terminated, id)
+					return nil
+				},
+			}
+
+			executor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+				return ExecCommandResponse{ExitCode: 0}, nil
+			}
+
+			ticker := time.NewTicker(time.Millisecond)
+			defer ticker.Stop()
+			err := scaleUpContainers(ctx, ScaleUpContainersInput{
+				Client:                   mock,
+				DesiredReplicas:          1,
+				Executor:                 executor,
+				ExistingContainers:       []container.Summary{},
+				HealthcheckTimeoutAction: action,
+				Logger:                   logger,
+				Monitor:                  time.Millisecond,
+				Parallelism:              1,
+				ProjectName:              "proj",
+				ServiceName:              "web",
+				TickerCh:                 ticker.C,
+			})
+			return err, terminated
+		}
+
+		t.Run("terminate", func(t *testing.T) {
+			err, terminated := scaleUp("terminate")
+			if err == nil || !strings.Contains(err.Error(), "health check timeout after") {
+				t.Errorf("expected the scale up to fail with the timeout, got %v", err)
+			}
+			if !slices.Equal(terminated, []string{"new1_container_id"}) {
+				t.Errorf("expected the timed out container to be terminated, got %v", terminated)
+			}
+		})
+
+		t.Run("keep", func(t *testing.T) {
+			err, terminated := scaleUp("keep")
+			if err != nil {
+				t.Errorf("expected the timed out container to only be warned about, got %v", err)
+			}
+			if len(terminated) != 0 {
+				t.Errorf("expected the timed out container to be kept running, got %v terminated", terminated)
+			}
+		})
+	})
+
+	t.Run("on healthy host command runs per healthy container", func(t *testing.T) {
+		mock := &mockDockerClient{
+			containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+				return []container.Summary{
+					{ID: "new1_container_id", Names: []string{"/new1"}},
+					{ID: "new2_container_id", Names: []string{"/new2"}},
+				}, nil
+			},
+			containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+				return container.InspectResponse{
+					ContainerJSONBase: &container.ContainerJSONBase{
+						State: &container.State{
+							Running: true,
+						},
+					},
+					NetworkSettings: &container.NetworkSettings{
+						Networks: map[string]*network.EndpointSettings{
+							"bridge": {IPAddress: "172.17.0." + id[3:4]},
+						},
+					},
+				}, nil
+			},
+		}
+
+		var mu sync.Mutex
+		hooks := []string{}
+		executor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+			if !strings.HasPrefix(filepath.Base(input.Command), "on-healthy-") {
+				return ExecCommandResponse{ExitCode: 0}, nil
+			}
+
+			script, err := os.ReadFile(input.Command)
+			if err != nil {
+				t.Errorf("unexpected error reading hook script: %v", err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			hooks = append(hooks, strings.TrimPrefix(string(script), "#!/usr/bin/env bash\n"))
+
+			// a failing hook is logged but does not fail the container
+			if strings.Contains(string(script), "new2") {
+				return ExecCommandResponse{ExitCode: 1}, errors.New("registration failed")
+			}
+			return ExecCommandResponse{ExitCode: 0}, nil
+		}
+
+		input := ScaleUpContainersInput{
+			Client:               mock,
+			Executor:             executor,
+			Logger:               logger,
+			OnHealthyHostCommand: "register {{.ContainerShortID}} {{.ContainerIP}}",
+			ProjectName:          "proj",
+			ServiceName:          "web",
+			DesiredReplicas:      2,
+			Parallelism:          2,
+			ExistingContainers:   []container.Summary{},
+			TickerCh:             testTickerCh(),
+		}
+
+		err := scaleUpContainers(ctx, input)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		slices.Sort(hooks)
+		expected := []string{"register new1_contain 172.17.0.1", "register new2_contain 172.17.0.2"}
+		if !slices.Equal(hooks, expected) {
+			t.Errorf("expected hooks %v, got %v", expected, hooks)
+		}
+	})
+
+	t.Run("on unhealthy host command receives the failure output", func(t *testing.T) {
+		mock := &mockDockerClient{
+			containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+				return []container.Summary{
+					{ID: "new1_container_id", Names: []string{"/new1"}},
+				}, nil
+			},
+			containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+				return container.InspectResponse{
+					ContainerJSONBase: &container.ContainerJSONBase{
+						State: &container.State{
+							Running: true,
+						},
+					},
+					NetworkSettings: &container.NetworkSettings{},
+				}, nil
+			},
+		}
+
+		hooks := []string{}
+		executor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+			switch {
+			case strings.HasPrefix(filepath.Base(input.Command), "healthcheck-"):
+				fmt.Fprint(input.StdoutWriter, "curl: (7) connection refused")
+				return ExecCommandResponse{ExitCode: 7}, errors.New("exit status 7")
+			case strings.HasPrefix(filepath.Base(input.Command), "on-unhealthy-"):
+				script, err := os.ReadFile(input.Command)
+				if err != nil {
+					t.Errorf("unexpected error reading hook script: %v", err)
+				}
+				hooks = append(hooks, strings.TrimPrefix(string(script), "#!/usr/bin/env bash\n"))
+			}
+			return ExecCommandResponse{ExitCode: 0}, nil
+		}
+
+		input := ScaleUpContainersInput{
+			Client:                 mock,
+			Executor:               executor,
+			HealthcheckCommand:     "curl -f http://{{.ContainerIP}}/health",
+			Logger:                 logger,
+			OnUnhealthyHostCommand: "{{.ContainerShortID}} failed: {{.FailureOutput}}",
+			ProjectName:            "proj",
+			ServiceName:            "web",
+			DesiredReplicas:        1,
+			Parallelism:            1,
+			ExistingContainers:     []container.Summary{},
+			TickerCh:               testTickerCh(),
+		}
+
+		err := scaleUpContainers(ctx, input)
+		if err == nil {
+			t.Fatal("expected error, got nil")
+		}
+
+		expected := []string{"new1_contain failed: healthcheck command failed for container new1_contain: exit status 7\ncurl: (7) connection refused"}
+		if !slices.Equal(hooks, expected) {
+			t.Errorf("expected hooks %q, got %q", expected, hooks)
+		}
+	})
+
+	t.Run("creates containers in steps", func(t *testing.T) {
+		var mu sync.Mutex
+		events := []string{}
+		containers := []container.Summary{}
+		mock := &mockDockerClient{
+			containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+				return slices.Clone(containers), nil
+			},
+			containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+				return container.InspectResponse{
+					ContainerJSONBase: &container.ContainerJSONBase{
+						State: &container.State{Running: true},
+					},
+				}, nil
+			},
+			containerStart: func(ctx context.Context, id string, options container.StartOptions) error {
+				mu.Lock()
+				defer mu.Unlock()
+				events = append(events, "start "+id)
+				return nil
+			},
+		}
+
+		executor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+			scale := input.Args[slices.Index(input.Args, "--scale")+1]
+			events = append(events, "create "+scale)
+			_, replicas, _ := strings.Cut(scale, "=")
+			for strconv.Itoa(len(containers)) != replicas {
+				containers = append(containers, container.Summary{ID: fmt.Sprintf("new%d_container_id", len(containers)+1)})
+			}
+			return ExecCommandResponse{ExitCode: 0}, nil
+		}
+
+		err := scaleUpContainers(ctx, ScaleUpContainersInput{
+			Client:             mock,
+			Executor:           executor,
+			Logger:             logger,
+			ProjectName:        "proj",
+			ServiceName:        "web",
+			DesiredReplicas:    5,
+			Parallelism:        5,
+			ScaleStep:          2,
+			ExistingContainers: []container.Summary{},
+			TickerCh:           testTickerCh(),
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected := []string{
+			"create web=2",
+			"start new1_container_id",
+			"start new2_container_id",
+			"create web=4",
+			"start new3_container_id",
+			"start new4_container_id",
+			"create web=5",
+			"start new5_container_id",
+		}
+		slices.Sort(events[1:3])
+		slices.Sort(events[4:6])
+		if !slices.Equal(events, expected) {
+			t.Errorf("expected each step to be created once the previous one started\nexpected: %v\ngot:      %v", expected, events)
+		}
+	})
+
+	t.Run("create failure carries compose stderr", func(t *testing.T) {
+		executor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+			fmt.Fprintln(input.StderrWriter, " web Pulling")
+			fmt.Fprintln(input.StderrWriter, "Error response from daemon: pull access denied for private/web, repository does not exist or may require 'docker login'")
+			return ExecCommandResponse{ExitCode: 1}, errors.New("exit status 1")
+		}
+
+		err := scaleUpContainers(ctx, ScaleUpContainersInput{
+			Client:             &mockDockerClient{},
+			Executor:           executor,
+			Logger:             logger,
+			ProjectName:        "proj",
+			ServiceName:        "web",
+			DesiredReplicas:    1,
+			Parallelism:        1,
+			ExistingContainers: []container.Summary{},
+			TickerCh:           testTickerCh(),
+		})
+		if err == nil {
+			t.Fatal("expected error, got nil")
+		}
+		if !strings.Contains(err.Error(), "error creating containers: exit status 1") || !strings.Contains(err.Error(), "pull access denied for private/web") {
+			t.Errorf("expected the error to carry the compose stderr, got %v", err)
+		}
+	})
+}
+
+func TestRunComposeCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		stderr   string
+		err      error
+		expected string
+	}{
+		{
+			name:     "success",
+			stderr:   "Container proj-web-1 Created",
+			expected: "",
+		},
+		{
+			name:     "exit status only",
+			stderr:   "no such service: worker\n",
+			err:      errors.New("exit status 1"),
+			expected: "exit status 1: no such service: worker",
+		},
+		{
+			name:     "stderr already in the error",
+			stderr:   "no such service: worker\n",
+			err:      errors.New("no such service: worker\n"),
+			expected: "no such service: worker\n",
+		},
+		{
+			name:     "no stderr",
+			err:      errors.New("exit status 1"),
+			expected: "exit status 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+				fmt.Fprint(input.StderrWriter, tt.stderr)
+				return ExecCommandResponse{}, tt.err
+			}
+
+			err := runComposeCommand(context.Background(), executor, ExecCommandInput{Command: "docker"})
+			if tt.expected == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.expected {
+				t.Errorf("expected error %q, got %v", tt.expected, err)
+			}
+			if tt.stderr != "" {
+				eo, ok := err.(*ErrorWithOutput)
+				if !ok || eo.Output != strings.TrimSpace(tt.stderr) {
+					t.Errorf("expected the stderr as the error output, got %#v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestRunToCompletion(t *testing.T) {
+	ctx := context.Background()
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	newMockClient := func(exitCode int64, started *[]string) *mockDockerClient {
+		return &mockDockerClient{
+			containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+				return []container.Summary{
+					{ID: "job1_container_id", State: container.StateCreated},
+				}, nil
+			},
+			containerStart: func(ctx context.Context, id string, options container.StartOptions) error {
+				*started = append(*started, id)
+				return nil
+			},
+			containerWait: func(ctx context.Context, id string, condition container.WaitCondition) (<-chan container.WaitResponse, <-chan error) {
+				if condition != container.WaitConditionNotRunning {
+					t.Errorf("expected to wait for not-running, got %s", condition)
+				}
+				respCh := make(chan container.WaitResponse, 1)
+				respCh <- container.WaitResponse{StatusCode: exitCode}
+				return respCh, make(chan error)
+			},
+		}
+	}
+
+	executor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+		return ExecCommandResponse{ExitCode: 0}, nil
+	}
+
+	t.Run("zero exit succeeds", func(t *testing.T) {
+		started := []string{}
+		output, err := runToCompletion(ctx, RunToCompletionInput{
+			Client:      newMockClient(0, &started),
+			ComposeFile: "docker-compose.yml",
+			Executor:    executor,
+			Logger:      logger,
+			ProjectName: "proj",
+			Replicas:    1,
+			ServiceName: "migrate",
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(started) != 1 || started[0] != "job1_container_id" {
+			t.Errorf("expected job1_container_id to be started, got %v", started)
+		}
+		if output.Succeeded != 1 || output.Failed != 0 {
+			t.Errorf("expected 1 succeeded and 0 failed containers, got %+v", output)
+		}
+	})
+
+	t.Run("non-zero exit fails", func(t *testing.T) {
+		started := []string{}
+		output, err := runToCompletion(ctx, RunToCompletionInput{
+			Client:      newMockClient(3, &started),
+			ComposeFile: "docker-compose.yml",
+			Executor:    executor,
+			Logger:      logger,
+			ProjectName: "proj",
+			Replicas:    1,
+			ServiceName: "migrate",
+		})
+		if err == nil {
+			t.Fatal("expected error, got nil")
+		}
+		if err.Error() != "container job1_contain exited with code 3" {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if output.Succeeded != 0 || output.Failed != 1 {
+			t.Errorf("expected 0 succeeded and 1 failed containers, got %+v", output)
+		}
+	})
+
+	t.Run("containers from an earlier run are not started", func(t *testing.T) {
+		started := []string{}
+		removed := []string{}
+		created := false
+		mock := newMockClient(0, &started)
+		mock.containerList = func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+			containers := []container.Summary{
+				{ID: "running_container_id", State: container.StateRunning},
+			}
+			if !slices.Contains(removed, "exited_container_id") {
+				containers = append(containers, container.Summary{ID: "exited_container_id", State: container.StateExited})
+			}
+			if created {
+				containers = append(containers, container.Summary{ID: "job1_container_id", State: container.StateCreated})
+			}
+			return containers, nil
+		}
+		mock.containerRemove = func(ctx context.Context, id string, options container.RemoveOptions) error {
+			removed = append(removed, id)
+			return nil
+		}
+
+		output, err := runToCompletion(ctx, RunToCompletionInput{
+			Client:      mock,
+			ComposeFile: "docker-compose.yml",
+			Executor: func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+				if slices.Contains(removed, "exited_container_id") {
+					created = true
+				}
+				return ExecCommandResponse{ExitCode: 0}, nil
+			},
+			Logger:      logger,
+			ProjectName: "proj",
+			Replicas:    1,
+			ServiceName: "migrate",
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if fmt.Sprint(removed) != "[exited_container_id]" {
+			t.Errorf("expected the exited container to be removed before creating, got %v", removed)
+		}
+		if fmt.Sprint(started) != "[job1_container_id]" {
+			t.Errorf("expected only the created container to be started, got %v", started)
+		}
+		if output.Succeeded != 1 || output.Failed != 0 {
+			t.Errorf("expected 1 succeeded and 0 failed containers, got %+v", output)
+		}
+	})
 }
@@ -1,73 +1,675 @@
 package internal
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
+	"maps"
+	"net"
+	"os"
 	"path/filepath"
+	"regexp"
 	"slices"
 	"strings"
+	"text/template"
 	"time"
 
 	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/compose/v5/pkg/api"
 	"github.com/docker/compose/v5/pkg/compose"
 	"github.com/docker/docker/api/types/container"
 	"github.com/josegonzalez/cli-skeleton/command"
 	parser "github.com/novln/docker-parser"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// AtomicPhasePrepare creates and health-verifies a service's new containers alongside the old ones
+	AtomicPhasePrepare = "prepare"
+	// AtomicPhaseCutover stops a service's old containers once its new containers are prepared
+	AtomicPhaseCutover = "cutover"
 )
 
 // DeployProjectInput is the input for the DeployProject function
 type DeployProjectInput struct {
+	// Atomic is whether every service's new containers are created and health-verified before any old container is stopped
+	Atomic bool
+	// Build is whether to build the images of build-backed services before deploying
+	Build bool
 	// Client is the Docker client to use
 	Client DockerClientInterface
+	// Compatibility is whether to translate swarm deploy keys into container settings
+	Compatibility bool
 	// ComposeFile is the path to the compose file
 	ComposeFile string
+	// ContainerTimeout is an absolute ceiling on how long any single container may take to become healthy
+	ContainerTimeout time.Duration
 	// ContainerNameTemplate is the Go template for container names
 	ContainerNameTemplate string
+	// ContinueOnError is whether a failed service leaves the remaining services to be deployed, skipping only those depending on it
+	ContinueOnError bool
+	// DefaultHealthcheckCommand is the host healthcheck command of services without a healthcheck of their own
+	DefaultHealthcheckCommand string
+	// DeployID identifies the deploy. If set, it is stamped on the new containers and recorded in the history.
+	DeployID string
+	// DrainCommand is the host command run for each container just before it is stopped, such as to deregister it from a load balancer, for services without an x-drain-command of their own
+	DrainCommand string
+	// Events receives structured deploy events. If nil, no events are emitted.
+	Events *EventEmitter
 	// Executor is the command executor to use
 	Executor CommandExecutor
+	// FailureLogLines is the number of trailing log lines printed for each container that fails its healthcheck. If zero, no logs are printed.
+	FailureLogLines int
+	// HealthStartPeriod overrides the healthcheck start period for every service
+	HealthStartPeriod time.Duration
+	// History records each successful service deploy. If nil, no history is kept.
+	History *DeployHistory
+	// IgnoreDependencyFailures is whether services whose dependencies failed are deployed anyway rather than skipped. Requires ContinueOnError.
+	IgnoreDependencyFailures bool
+	// InheritLabels are the labels copied from each replaced container onto its replacement
+	InheritLabels []string
+	// Interleave are two services whose rolling updates are deployed side by side, alternating batches in lockstep. If either fails, the other is paused.
+	Interleave []string
+	// KeepOld is whether to leave the old containers running after a start-first update
+	KeepOld bool
 	// Logger is the logger to use
 	Logger *command.ZerologUi
+	// MaxOldContainers is the number of containers allowed above the desired replicas during a start-first update
+	MaxOldContainers int
+	// Metrics records the Prometheus metrics of the deploy. If nil, no metrics are recorded.
+	Metrics *DeployMetrics
+	// MinFreeDisk is the minimum number of bytes that must be free on the Docker data-root before deploying. If 0, the check is skipped.
+	MinFreeDisk int64
+	// NoBuild is whether to fail before deploying when a build-backed service has no image, rather than letting compose build it
+	NoBuild bool
+	// OnServiceComplete is called after each service deploy with its result and error, if set
+	OnServiceComplete func(service string, result DeployServiceResult, err error)
+	// OnlyNew is whether existing containers are left running untouched, only adding new containers to reach the replica count
+	OnlyNew bool
+	// OverallTimeout is an upper bound on the whole project deploy. Once it passes, in-flight work is cancelled and the remaining services are not started. If 0, the deploy is not bounded.
+	OverallTimeout time.Duration
+	// OverrideFiles are compose files merged over the compose file, such as docker-compose.override.yml
+	OverrideFiles []string
+	// ParallelismBudget bounds the containers updated at once across all the services of the deploy. If 0, every service uses its own parallelism.
+	ParallelismBudget int
 	// Project is the project configuration
 	Project *types.Project
+	// ProjectLabel overrides the com.docker.compose.project label value used to discover containers. Defaults to ProjectName.
+	ProjectLabel string
 	// ProjectName is the name of the project
 	ProjectName string
+	// PullParallel is the number of distinct service images to pull at once before deploying. If 0, images are not pulled up front.
+	PullParallel int
+	// PullProgress is whether the images pulled up front stream their per-layer progress
+	PullProgress bool
+	// QuietPull is whether to suppress the per-layer progress of image pulls
+	QuietPull bool
+	// Recreate is whether only the containers whose config fingerprint or image differ from the service are replaced, leaving matching containers running
+	Recreate bool
+	// RecreateAnonymousVolumes is whether to recreate anonymous volumes instead of reusing them
+	RecreateAnonymousVolumes bool
+	// ReplicasFile is the path to a JSON or YAML file mapping service names to replica counts, taking precedence over the compose file
+	ReplicasFile string
+	// ReplicasFromLabel is a container label holding the desired replica count of the service, read off its existing containers when no replica count is given
+	ReplicasFromLabel string
+	// ReportAllFailures is whether a failed scale-up batch reports every container that failed, rather than only the first
+	ReportAllFailures bool
+	// Revision is the source revision being deployed. If set, it is stamped on the new containers and recorded in the history.
+	Revision string
+	// ScaleDownKeep is which containers a scale down keeps: newest, oldest or healthy. Defaults to newest, removing the oldest containers first.
+	ScaleDownKeep string
+	// SelectImage is an optional image repository limiting the deploy to the services using it
+	SelectImage string
+	// Selector is an optional expression limiting which services are deployed
+	Selector string
 	// SkipDatabases is whether to skip deploying databases
 	SkipDatabases bool
+	// SkipPullFor are the services whose images are not pulled up front, relying on the local image
+	SkipPullFor []string
+	// SkipRename is whether to leave the containers with the names compose gave them instead of renaming them to the container name template
+	SkipRename bool
+	// StopGracePeriod overrides how long every service's containers are given to exit once stopped before they are killed
+	StopGracePeriod time.Duration
+	// Strict is whether ambiguous service settings, such as differing `deploy.replicas` and `scale` values, fail the deploy instead of logging a warning
+	Strict bool
+	// TeardownOnFailure is whether a failed deploy removes the containers, networks and volumes it created. Requires DeployID.
+	TeardownOnFailure bool
+	// TracerProvider creates the spans traced for the deploy. If nil, spans are only recorded under a span already in the context.
+	TracerProvider trace.TracerProvider
+	// VerifyGraph is whether to verify that every deployed service is still healthy once all services are deployed
+	VerifyGraph bool
+	// VerifyImageExists is whether to check every service image is present locally or in its registry before deploying
+	VerifyImageExists bool
+	// WaitForDependenciesTimeout bounds how long to wait for each `service_healthy` dependency. Defaults to 5 minutes.
+	WaitForDependenciesTimeout time.Duration
+	// Warnings collects the warnings raised during the deploy, if set
+	Warnings *DeployWarnings
 }
 
 // DeployProject deploys a project
 func DeployProject(ctx context.Context, input DeployProjectInput) error {
+	_, err := DeployProjectWithResult(ctx, input)
+	return err
+}
+
+// DeployProjectWithResult deploys a project, returning the outcome of each
+// service the deploy reached. The result is populated even when the deploy fails.
+func DeployProjectWithResult(ctx context.Context, input DeployProjectInput) (DeployProjectResult, error) {
+	if input.OverallTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, input.OverallTimeout, errOverallTimeout)
+		defer cancel()
+	}
+
+	ctx, span := startSpan(ctx, input.TracerProvider, "deploy project", attribute.String("project", input.ProjectName))
+	_ = input.Events.Emit(Event{Phase: EventProjectStarted, Project: input.ProjectName})
+	result := DeployProjectResult{}
+	err := deployProjectWithTeardown(ctx, input, &result)
+	if err != nil && errors.Is(context.Cause(ctx), errOverallTimeout) {
+		err = overallTimeoutError(input.OverallTimeout, result)
+		input.Logger.Warn(err.Error())
+	}
+	endSpan(span, err)
+	input.Events.emitResult(Event{Project: input.ProjectName}, EventProjectCompleted, EventProjectFailed, err)
+	result.Success = err == nil
+	if err != nil {
+		result.Error = err.Error()
+	}
+	result.Warnings = input.Warnings.Warnings()
+	return result, err
+}
+
+// errOverallTimeout is the cause of the cancellation of a project deploy that
+// ran out of its overall timeout
+var errOverallTimeout = errors.New("deploy exceeded the overall timeout")
+
+// overallTimeoutError reports which services of a project deploy completed,
+// failed, were skipped, were in progress or never started when the overall
+// timeout passed
+func overallTimeoutError(timeout time.Duration, result DeployProjectResult) error {
+	completed := []string{}
+	failed := []string{}
+	skipped := []string{}
+	inProgress := []string{}
+	notStarted := []string{}
+	for _, service := range result.Services {
+		switch service.Outcome {
+		case OutcomeOK:
+			completed = append(completed, service.Service)
+		case OutcomeSkipped:
+			skipped = append(skipped, service.Service)
+		case OutcomeTimedOut:
+			inProgress = append(inProgress, service.Service)
+		case OutcomeNotStarted:
+			notStarted = append(notStarted, service.Service)
+		default:
+			failed = append(failed, service.Service)
+		}
+	}
+
+	list := func(services []string) string {
+		if len(services) == 0 {
+			return "none"
+		}
+		return strings.Join(services, ",")
+	}
+	return fmt.Errorf("deploy exceeded the overall timeout of %v: completed=%s, failed=%s, skipped=%s, in-progress=%s, not-started=%s", timeout, list(completed), list(failed), list(skipped), list(inProgress), list(notStarted))
+}
+
+// deployProjectWithTeardown deploys the project, removing everything the
+// deploy created if it fails and teardown on failure is enabled
+func deployProjectWithTeardown(ctx context.Context, input DeployProjectInput, projectResult *DeployProjectResult) (err error) {
+	if input.Atomic {
+		if input.DeployID == "" {
+			return fmt.Errorf("deploy id is required for atomic deploys")
+		}
+		if input.ContinueOnError || input.KeepOld {
+			return fmt.Errorf("atomic deploys cannot be combined with continuing on error or keeping old containers")
+		}
+	}
+
+	if input.IgnoreDependencyFailures && !input.ContinueOnError {
+		return fmt.Errorf("ignoring dependency failures requires continuing on error")
+	}
+
+	// an atomic deploy always removes what it prepared if it fails before
+	// the cutover, as the old containers are still serving
+	if !input.TeardownOnFailure && !input.Atomic {
+		return deployProject(ctx, input, projectResult)
+	}
+
+	if input.DeployID == "" {
+		return fmt.Errorf("deploy id is required to tear down on failure")
+	}
+
+	projectLabel := input.ProjectName
+	if input.ProjectLabel != "" {
+		projectLabel = input.ProjectLabel
+	}
+
+	// resources that exist before the deploy are never torn down
+	existing, err := listProjectResources(ctx, input.Client, projectLabel)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		// once old containers are being stopped, the new ones are all that
+		// is left of the services that were cut over
+		var cutoverErr *cutoverError
+		if err == nil || errors.As(err, &cutoverErr) {
+			return
+		}
+
+		teardownErr := teardownDeploy(context.WithoutCancel(ctx), TeardownDeployInput{
+			Client:       input.Client,
+			DeployID:     input.DeployID,
+			Existing:     existing,
+			Logger:       input.Logger,
+			ProjectLabel: projectLabel,
+		})
+		if teardownErr != nil {
+			input.Warnings.Warn(input.Logger, "", fmt.Sprintf("Unable to tear down deploy: deploy_id=%s, error=%v", input.DeployID, teardownErr))
+		}
+	}()
+
+	return deployProject(ctx, input, projectResult)
+}
+
+// deployProject deploys every selected service in dependency order,
+// recording the outcome of each service in the project result
+func deployProject(ctx context.Context, input DeployProjectInput, projectResult *DeployProjectResult) error {
 	orderedServices, err := OrderServices(ctx, input)
 	if err != nil {
 		return err
 	}
 
-	for _, serviceName := range orderedServices {
-		input.Logger.LogHeader2(fmt.Sprintf("Deploying service %s", serviceName))
-		err = DeployService(ctx, DeployServiceInput{
-			Client:                input.Client,
-			ComposeFile:           input.ComposeFile,
-			ContainerNameTemplate: input.ContainerNameTemplate,
-			Executor:              input.Executor,
-			Logger:                input.Logger,
-			Project:               input.Project,
-			ProjectName:           input.ProjectName,
-			ServiceName:           serviceName,
-			SkipDatabases:         input.SkipDatabases,
+	servicesToDeploy, err := selectServices(input, orderedServices)
+	if err != nil {
+		return err
+	}
+
+	// once the overall timeout passes, the services the deploy never reached
+	// are recorded as not started
+	defer func() {
+		if !errors.Is(context.Cause(ctx), errOverallTimeout) {
+			return
+		}
+		for _, serviceName := range servicesToDeploy {
+			reached := slices.ContainsFunc(projectResult.Services, func(summary ServiceSummary) bool {
+				return summary.Service == serviceName
+			})
+			if !reached {
+				projectResult.Services = append(projectResult.Services, ServiceSummary{Outcome: OutcomeNotStarted, Service: serviceName})
+			}
+		}
+	}()
+
+	// outcome classifies a service deploy, counting any service interrupted
+	// by the overall timeout as timed out
+	outcome := func(result DeployServiceResult, err error) string {
+		if err != nil && errors.Is(context.Cause(ctx), errOverallTimeout) {
+			return OutcomeTimedOut
+		}
+		return serviceOutcome(result, err)
+	}
+
+	err = checkDiskSpace(ctx, CheckDiskSpaceInput{
+		Client:      input.Client,
+		Logger:      input.Logger,
+		MinFreeDisk: input.MinFreeDisk,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = checkPortConflicts(ctx, CheckPortConflictsInput{
+		Client:       input.Client,
+		Project:      input.Project,
+		ProjectLabel: input.ProjectLabel,
+		ProjectName:  input.ProjectName,
+		ServiceNames: servicesToDeploy,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = pullImages(ctx, PullImagesInput{
+		Executor:      input.Executor,
+		Logger:        input.Logger,
+		Parallelism:   input.PullParallel,
+		Progress:      input.PullProgress,
+		Project:       input.Project,
+		QuietPull:     input.QuietPull,
+		ServiceNames:  servicesToDeploy,
+		SkipDatabases: input.SkipDatabases,
+		SkipServices:  input.SkipPullFor,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = buildImages(ctx, BuildImagesInput{
+		Build:         input.Build,
+		Client:        input.Client,
+		ComposeFile:   input.ComposeFile,
+		Executor:      input.Executor,
+		Logger:        input.Logger,
+		NoBuild:       input.NoBuild,
+		OverlayFiles:  input.OverrideFiles,
+		Project:       input.Project,
+		ProjectName:   input.ProjectName,
+		ServiceNames:  servicesToDeploy,
+		SkipDatabases: input.SkipDatabases,
+	})
+	if err != nil {
+		return err
+	}
+
+	if input.VerifyImageExists {
+		services := []types.ServiceConfig{}
+		for _, serviceName := range servicesToDeploy {
+			service, err := input.Project.GetService(serviceName)
+			if err != nil {
+				return err
+			}
+			services = append(services, service)
+		}
+
+		err = verifyImages(ctx, VerifyImagesInput{
+			Client:        input.Client,
+			Executor:      input.Executor,
+			Logger:        input.Logger,
+			Services:      services,
+			SkipDatabases: input.SkipDatabases,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := validateInterleave(input, servicesToDeploy); err != nil {
+		return err
+	}
+	servicesToDeploy = interleaveOrder(input.Project, servicesToDeploy, input.Interleave)
+
+	// services that failed, or were skipped because a dependency failed
+	failed := map[string]bool{}
+	deployErrs := []string{}
+
+	// recordFailure records the failure of a service, returning the error
+	// unless the remaining services are deployed anyway
+	recordFailure := func(serviceName string, err error) error {
+		if !input.ContinueOnError {
+			return err
+		}
+		input.Warnings.Warn(input.Logger, serviceName, fmt.Sprintf("Service deploy failed, continuing: service=%s, error=%v", serviceName, err))
+		failed[serviceName] = true
+		deployErrs = append(deployErrs, fmt.Sprintf("%s: %v", serviceName, err))
+		return nil
+	}
+
+	// prepareService skips a service whose dependencies failed or waits for
+	// its dependencies, returning whether the service is ready to deploy
+	prepareService := func(serviceName string, startedAt time.Time) ([]string, bool, error) {
+		failedDeps, err := failedDependencies(input.Project, serviceName, failed)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(failedDeps) > 0 && !input.IgnoreDependencyFailures {
+			input.Warnings.Warn(input.Logger, serviceName, fmt.Sprintf("Skipping service with failed dependencies: service=%s, failed=%s", serviceName, strings.Join(failedDeps, ",")))
+			failed[serviceName] = true
+			projectResult.Services = append(projectResult.Services, ServiceSummary{
+				Duration:           time.Since(startedAt),
+				FailedDependencies: failedDeps,
+				Outcome:            OutcomeSkipped,
+				Service:            serviceName,
+			})
+			return failedDeps, false, nil
+		}
+
+		if len(failedDeps) > 0 {
+			input.Warnings.Warn(input.Logger, serviceName, fmt.Sprintf("Deploying despite failed dependencies: service=%s, failed=%s", serviceName, strings.Join(failedDeps, ",")))
+		}
+
+		// a failed dependency will never become healthy, so only the
+		// dependencies that did not fail are waited on
+		err = waitForDependencies(ctx, WaitForDependenciesInput{
+			Client:           input.Client,
+			DeployedServices: servicesToDeploy,
+			Logger:           input.Logger,
+			Project:          input.Project,
+			ProjectLabel:     input.ProjectLabel,
+			ProjectName:      input.ProjectName,
+			ServiceName:      serviceName,
+			SkipDatabases:    input.SkipDatabases,
+			SkipServices:     failedDeps,
+			Timeout:          input.WaitForDependenciesTimeout,
 		})
 		if err != nil {
+			projectResult.Services = append(projectResult.Services, ServiceSummary{
+				Duration: time.Since(startedAt),
+				Outcome:  outcome(DeployServiceResult{}, err),
+				Service:  serviceName,
+			})
+			return nil, false, recordFailure(serviceName, err)
+		}
+		return failedDeps, true, nil
+	}
+
+	// every service draws on the same budget, so services deployed together
+	// never update more containers at once than it allows
+	parallelismBudget := NewParallelismBudget(input.ParallelismBudget)
+	for i := 0; i < len(servicesToDeploy); i++ {
+		// continuing on error does not extend past the overall timeout
+		if errors.Is(context.Cause(ctx), errOverallTimeout) {
+			return errOverallTimeout
+		}
+
+		// interleaved services are ordered next to each other and deployed
+		// together
+		group := servicesToDeploy[i : i+1]
+		if slices.Contains(input.Interleave, servicesToDeploy[i]) {
+			group = servicesToDeploy[i : i+2]
+			i++
+		}
+
+		deploys := []groupDeploy{}
+		for _, serviceName := range group {
+			input.Logger.LogHeader2(fmt.Sprintf("Deploying service %s", serviceName))
+			startedAt := time.Now()
+
+			failedDeps, ready, err := prepareService(serviceName, startedAt)
+			if err != nil {
+				return err
+			}
+			if !ready {
+				continue
+			}
+
+			serviceInput := projectServiceInput(input, serviceName)
+			serviceInput.ParallelismBudget = parallelismBudget
+			if input.Atomic {
+				serviceInput.AtomicPhase = AtomicPhasePrepare
+			}
+			deploys = append(deploys, groupDeploy{
+				FailedDependencies: failedDeps,
+				Input:              serviceInput,
+				StartedAt:          startedAt,
+			})
+		}
+
+		var groupErr error
+		for _, deploy := range deployServiceGroup(ctx, deploys) {
+			serviceName := deploy.Input.ServiceName
+			projectResult.Services = append(projectResult.Services, ServiceSummary{
+				Duration:           deploy.Duration,
+				FailedDependencies: deploy.FailedDependencies,
+				Failures:           deploy.Result.Failures,
+				Outcome:            outcome(deploy.Result, deploy.Err),
+				Replicas:           deploy.Result.Replicas,
+				Service:            serviceName,
+				Updates:            deploy.Result.Updates,
+			})
+			if input.OnServiceComplete != nil {
+				input.OnServiceComplete(serviceName, deploy.Result, deploy.Err)
+			}
+			if deploy.Err != nil {
+				if err := recordFailure(serviceName, deploy.Err); err != nil && groupErr == nil {
+					groupErr = err
+				}
+			}
+		}
+		if groupErr != nil {
+			return groupErr
+		}
+	}
+
+	if len(deployErrs) > 0 {
+		return fmt.Errorf("error deploying %d services: %s", len(deployErrs), strings.Join(deployErrs, "; "))
+	}
+
+	if input.Atomic {
+		if err := cutoverProject(ctx, input, projectResult); err != nil {
 			return err
 		}
 	}
 
-	return RemoveMissingServices(ctx, input, orderedServices)
+	if err := RemoveMissingServices(ctx, input, orderedServices); err != nil {
+		return err
+	}
+
+	if !input.VerifyGraph {
+		return nil
+	}
+
+	return verifyGraphHealth(ctx, VerifyGraphHealthInput{
+		Client:        input.Client,
+		Logger:        input.Logger,
+		Project:       input.Project,
+		ProjectLabel:  input.ProjectLabel,
+		ProjectName:   input.ProjectName,
+		ServiceNames:  servicesToDeploy,
+		SkipDatabases: input.SkipDatabases,
+	})
+}
+
+// projectServiceInput returns the input deploying one service of the project
+func projectServiceInput(input DeployProjectInput, serviceName string) DeployServiceInput {
+	return DeployServiceInput{
+		Client:                    input.Client,
+		Compatibility:             input.Compatibility,
+		ComposeFile:               input.ComposeFile,
+		ContainerNameTemplate:     input.ContainerNameTemplate,
+		ContainerTimeout:          input.ContainerTimeout,
+		DefaultHealthcheckCommand: input.DefaultHealthcheckCommand,
+		DeployID:                  input.DeployID,
+		DrainCommand:              input.DrainCommand,
+		Events:                    input.Events,
+		Executor:                  input.Executor,
+		FailureLogLines:           input.FailureLogLines,
+		HealthStartPeriod:         input.HealthStartPeriod,
+		History:                   input.History,
+		InheritLabels:             input.InheritLabels,
+		KeepOld:                   input.KeepOld,
+		Logger:                    serviceLogger(input.Logger, serviceName),
+		MaxOldContainers:          input.MaxOldContainers,
+		MaxParallelism:            input.ParallelismBudget,
+		Metrics:                   input.Metrics,
+		OnlyNew:                   input.OnlyNew,
+		OverrideFiles:             input.OverrideFiles,
+		Project:                   input.Project,
+		ProjectLabel:              input.ProjectLabel,
+		ProjectName:               input.ProjectName,
+		QuietPull:                 input.QuietPull,
+		Recreate:                  input.Recreate,
+		RecreateAnonymousVolumes:  input.RecreateAnonymousVolumes,
+		ReplicasFile:              input.ReplicasFile,
+		ReplicasFromLabel:         input.ReplicasFromLabel,
+		ReportAllFailures:         input.ReportAllFailures,
+		Revision:                  input.Revision,
+		ScaleDownKeep:             input.ScaleDownKeep,
+		ServiceName:               serviceName,
+		SkipDatabases:             input.SkipDatabases,
+		SkipPull:                  slices.Contains(input.SkipPullFor, serviceName),
+		SkipRename:                input.SkipRename,
+		StopGracePeriod:           input.StopGracePeriod,
+		Strict:                    input.Strict,
+		TracerProvider:            input.TracerProvider,
+		Warnings:                  input.Warnings,
+	}
+}
+
+// selectServices filters the ordered services down to those matching the selector and image, if any
+func selectServices(input DeployProjectInput, orderedServices []string) ([]string, error) {
+	selectedServices := orderedServices
+	if input.Selector != "" {
+		selector, err := ParseSelector(input.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing selector: %v", err)
+		}
+
+		matched := []string{}
+		for _, serviceName := range selectedServices {
+			service, err := input.Project.GetService(serviceName)
+			if err != nil {
+				return nil, err
+			}
+			if selector.Matches(service) {
+				matched = append(matched, serviceName)
+			}
+		}
+
+		input.Logger.Info(fmt.Sprintf("Selected services: selector=%q, services=%s", input.Selector, strings.Join(matched, ",")))
+		selectedServices = matched
+	}
+
+	if input.SelectImage != "" {
+		parsedImage, err := parser.Parse(input.SelectImage)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing image %s: %v", input.SelectImage, err)
+		}
+
+		matched := []string{}
+		for _, serviceName := range selectedServices {
+			service, err := input.Project.GetService(serviceName)
+			if err != nil {
+				return nil, err
+			}
+			if serviceUsesImageRepository(service, parsedImage.Repository()) {
+				matched = append(matched, serviceName)
+			}
+		}
+
+		input.Logger.Info(fmt.Sprintf("Selected services: image=%s, services=%s", parsedImage.Repository(), strings.Join(matched, ",")))
+		selectedServices = matched
+	}
+
+	return selectedServices, nil
+}
+
+// serviceUsesImageRepository returns whether the image of a service belongs to
+// the given fully-qualified repository, ignoring its tag or digest
+func serviceUsesImageRepository(service types.ServiceConfig, repository string) bool {
+	if service.Image == "" {
+		return false
+	}
+
+	parsedImage, err := parser.Parse(service.Image)
+	if err != nil {
+		return false
+	}
+	return parsedImage.Repository() == repository
 }
 
 func RemoveMissingServices(ctx context.Context, input DeployProjectInput, orderedServices []string) error {
 	// Query all containers with the project label
 	allContainers, err := composeContainers(ComposeContainersInput{
-		Client:      input.Client,
-		ProjectName: input.ProjectName,
+		Client:       input.Client,
+		ProjectLabel: input.ProjectLabel,
+		ProjectName:  input.ProjectName,
 	})
 	if err != nil {
 		return fmt.Errorf("error querying containers: %v", err)
@@ -88,10 +690,11 @@ func RemoveMissingServices(ctx context.Context, input DeployProjectInput, ordere
 
 	for serviceName := range servicesToRemove {
 		currentContainers, err := composeContainers(ComposeContainersInput{
-			Client:      input.Client,
-			ProjectName: input.ProjectName,
-			ServiceName: serviceName,
-			Status:      "running",
+			Client:       input.Client,
+			ProjectLabel: input.ProjectLabel,
+			ProjectName:  input.ProjectName,
+			ServiceName:  serviceName,
+			Status:       "running",
 		})
 		if err != nil {
 			return fmt.Errorf("error getting current containers: %v", err)
@@ -111,6 +714,8 @@ func RemoveMissingServices(ctx context.Context, input DeployProjectInput, ordere
 			ProjectName:         input.ProjectName,
 			ServiceName:         serviceName,
 			SkipDatabases:       input.SkipDatabases,
+			StopGracePeriod:     input.StopGracePeriod,
+			Warnings:            input.Warnings,
 		})
 		if err != nil {
 			return err
@@ -122,44 +727,197 @@ func RemoveMissingServices(ctx context.Context, input DeployProjectInput, ordere
 
 // DeployServiceInput is the input for the DeployService function
 type DeployServiceInput struct {
+	// AllowZero is whether a Replicas of 0 scales the service down to no running containers, rather than falling back to the compose file replica count
+	AllowZero bool
+	// AtomicPhase is the phase of an atomic project deploy the service is deployed in, either AtomicPhasePrepare or AtomicPhaseCutover. If empty, the service is updated as usual.
+	AtomicPhase string
+	// BatchTurn is called before each batch of the rolling update and blocks until the batch may start. If nil, batches start right away.
+	BatchTurn func(ctx context.Context) (func(), error)
+	// Canary is the number of new containers to deploy alongside the existing ones, without replacing any. If 0, the service is updated as usual.
+	Canary int
 	// Client is the Docker client to use
 	Client DockerClientInterface
+	// Compatibility is whether to translate swarm deploy keys into container settings
+	Compatibility bool
+	// Command overrides the command of the service for this deploy
+	Command string
 	// ComposeFile is the path to the compose file
 	ComposeFile string
+	// ContainerTimeout is an absolute ceiling on how long any single container may take to become healthy
+	ContainerTimeout time.Duration
 	// ContainerNameTemplate is the Go template for container names
 	ContainerNameTemplate string
+	// DefaultHealthcheckCommand is the host healthcheck command of a service without a healthcheck of its own
+	DefaultHealthcheckCommand string
+	// DeployID identifies the deploy. If set, it is stamped on the new containers and recorded in the history.
+	DeployID string
+	// DrainCommand is the host command run for each container just before it is stopped, such as to deregister it from a load balancer, unless the service sets an x-drain-command of its own
+	DrainCommand string
+	// Entrypoint overrides the entrypoint of the service for this deploy
+	Entrypoint string
+	// EnvFromContainer are environment variables copied off a running container onto the new containers, each in the form service:KEY
+	EnvFromContainer []string
+	// Events receives structured deploy events. If nil, no events are emitted.
+	Events *EventEmitter
 	// Executor is the command executor to use
 	Executor CommandExecutor
+	// FailureLogLines is the number of trailing log lines printed for each container that fails its healthcheck. If zero, no logs are printed.
+	FailureLogLines int
+	// HealthcheckCommandFile is the path to a file holding the host healthcheck command of the service, overriding its x-healthcheck-host-command
+	HealthcheckCommandFile string
+	// HealthStartPeriod overrides the healthcheck start period of the service
+	HealthStartPeriod time.Duration
+	// History records the deploy once it succeeds. If nil, no history is kept.
+	History *DeployHistory
+	// Image overrides the image of the service for this deploy
+	Image string
+	// Index is the instance number of the only container to replace, as used by the container name template. If zero, every container is deployed.
+	Index int
+	// InheritLabels are the labels copied from each replaced container onto its replacement
+	InheritLabels []string
+	// KeepOld is whether to leave the old containers running after a start-first update
+	KeepOld bool
 	// Logger is the logger to use
 	Logger *command.ZerologUi
+	// MaxOldContainers is the number of containers allowed above the desired replicas during a start-first update
+	MaxOldContainers int
+	// MaxParallelism caps the number of containers updated at once, such as to a project's parallelism budget. If 0, the service's own parallelism is used.
+	MaxParallelism int
+	// Metrics records the Prometheus metrics of the deploy. If nil, no metrics are recorded.
+	Metrics *DeployMetrics
+	// OnlyNew is whether existing containers are left running untouched, only adding new containers to reach the replica count
+	OnlyNew bool
+	// OverrideFiles are compose files merged over the compose file, such as docker-compose.override.yml
+	OverrideFiles []string
+	// ParallelismBudget bounds the containers updated at once across the services of the deploy. If nil, the service uses its own parallelism.
+	ParallelismBudget *ParallelismBudget
+	// PinRollbackImage is the known-good image pinned as the rollback target of the service. If empty, the pin of the running containers is carried over.
+	PinRollbackImage string
 	// Project is the project configuration
 	Project *types.Project
+	// Promote is whether to replace the remaining containers of a service that has canary containers running
+	Promote bool
+	// ProjectLabel overrides the com.docker.compose.project label value used to discover containers. Defaults to ProjectName.
+	ProjectLabel string
 	// ProjectName is the name of the project
 	ProjectName string
+	// QuietPull is whether to suppress the per-layer progress of image pulls
+	QuietPull bool
+	// Recreate is whether only the containers whose config fingerprint or image differ from the service are replaced, leaving matching containers running
+	Recreate bool
+	// RecreateAnonymousVolumes is whether to recreate anonymous volumes instead of reusing them
+	RecreateAnonymousVolumes bool
 	// Replicas is the number of replicas to deploy
 	Replicas int
+	// ReplicasDelta adjusts the replica count relative to the number of running containers of the service, clamped at zero. If 0, the replica count is not relative.
+	ReplicasDelta int
+	// ReplicasFile is the path to a JSON or YAML file mapping service names to replica counts, taking precedence over the compose file
+	ReplicasFile string
+	// ReplicasFromLabel is a container label holding the desired replica count of the service, read off its existing containers when no replica count is given
+	ReplicasFromLabel string
+	// ReplicasMax is the maximum number of replicas to deploy. If 0, no maximum is enforced.
+	ReplicasMax int
+	// ReplicasMin is the minimum number of replicas to deploy. If 0, no minimum is enforced.
+	ReplicasMin int
+	// ReportAllFailures is whether a failed scale-up batch reports every container that failed, rather than only the first
+	ReportAllFailures bool
+	// Revision is the source revision being deployed. If set, it is stamped on the new containers and recorded in the history.
+	Revision string
+	// ScaleDownKeep is which containers a scale down keeps: newest, oldest or healthy. Defaults to newest, removing the oldest containers first.
+	ScaleDownKeep string
 	// ServiceName is the name of the service
 	ServiceName string
 	// SkipDatabases is whether to skip deploying databases
 	SkipDatabases bool
+	// SkipPull is whether the service's image is never pulled, relying on the local image
+	SkipPull bool
+	// SkipRename is whether to leave the containers with the names compose gave them instead of renaming them to the container name template
+	SkipRename bool
+	// StopGracePeriod overrides how long the service's containers are given to exit once stopped before they are killed
+	StopGracePeriod time.Duration
+	// Strict is whether ambiguous service settings, such as differing `deploy.replicas` and `scale` values, fail the deploy instead of logging a warning
+	Strict bool
+	// TracerProvider creates the spans traced for the deploy. If nil, spans are only recorded under a span already in the context.
+	TracerProvider trace.TracerProvider
+	// VerifyImageExists is whether to check the service image is present locally or in its registry before touching any container
+	VerifyImageExists bool
+	// Warnings collects the warnings raised during the deploy, if set
+	Warnings *DeployWarnings
 }
 
 // DeployService deploys a single service
 func DeployService(ctx context.Context, input DeployServiceInput) error {
+	_, err := deployServiceWithResult(ctx, input)
+	return err
+}
+
+// DeployServiceResult is the outcome of deploying a single service
+type DeployServiceResult struct {
+	// Duration is how long the service deploy took
+	Duration time.Duration
+	// Failures is the number of new containers that failed their healthcheck
+	Failures int
+	// Ports are the host ports assigned to the published ports of the running containers
+	Ports []PortMapping
+	// Replicas is the number of running containers once the deploy finished
+	Replicas int
+	// Skipped is whether the service was skipped rather than deployed
+	Skipped bool
+	// Updates is the number of containers replaced by the rolling update
+	Updates int
+}
+
+// deployServiceWithResult deploys a single service, emitting its events and
+// returning the outcome of the deploy
+func deployServiceWithResult(ctx context.Context, input DeployServiceInput) (DeployServiceResult, error) {
+	ctx, span := startSpan(ctx, input.TracerProvider, "deploy service", attribute.String("service", input.ServiceName))
+	_ = input.Events.Emit(Event{Phase: EventServiceStarted, Project: input.ProjectName, Service: input.ServiceName})
+	startedAt := time.Now()
+	result, err := deployService(ctx, input)
+	endSpan(span, err)
+	result.Duration = time.Since(startedAt)
+	input.Metrics.serviceCompleted(input.ServiceName, result, err)
+	input.Events.emitResult(Event{Project: input.ProjectName, Service: input.ServiceName}, EventServiceCompleted, EventServiceFailed, err)
+	return result, err
+}
+
+// serviceOverrides returns the compose overrides a deploy applies to the
+// service definition, such as the --command and --entrypoint overrides
+func serviceOverrides(input DeployServiceInput, service *types.ServiceConfig) map[string]interface{} {
+	overrides := map[string]interface{}{}
+	if input.Compatibility {
+		maps.Copy(overrides, compatibilityOverrides(service))
+	}
+	maps.Copy(overrides, legacyResourceOverrides(service))
+	if input.Entrypoint != "" {
+		overrides["entrypoint"] = input.Entrypoint
+	}
+	if input.Command != "" {
+		overrides["command"] = input.Command
+	}
+	if input.Image != "" {
+		overrides["image"] = input.Image
+	}
+	return overrides
+}
+
+// deployService performs the rolling update of a single service
+func deployService(ctx context.Context, input DeployServiceInput) (DeployServiceResult, error) {
+	result := DeployServiceResult{}
 	if input.ComposeFile == "" {
-		return fmt.Errorf("compose file is required")
+		return result, fmt.Errorf("compose file is required")
 	}
 
 	if input.ProjectName == "" {
-		return fmt.Errorf("project name is required")
+		return result, fmt.Errorf("project name is required")
 	}
 
 	if input.Project == nil {
-		return fmt.Errorf("project is required")
+		return result, fmt.Errorf("project is required")
 	}
 
 	if input.ServiceName == "" {
-		return fmt.Errorf("service name is required")
+		return result, fmt.Errorf("service name is required")
 	}
 
 	var service *types.ServiceConfig
@@ -170,7 +928,7 @@ func DeployService(ctx context.Context, input DeployServiceInput) error {
 		}
 	}
 	if service == nil {
-		return fmt.Errorf("service %s not found in compose file", input.ServiceName)
+		return result, fmt.Errorf("service %s not found in compose file", input.ServiceName)
 	}
 
 	skipService := shouldSkipService(ShouldSkipServiceInput{
@@ -179,215 +937,982 @@ func DeployService(ctx context.Context, input DeployServiceInput) error {
 		Logger:              input.Logger,
 	})
 	if skipService {
-		return nil
+		result.Skipped = true
+		return result, nil
 	}
 
-	replicas := ServiceReplicas(input, service)
+	// extra_hosts are passed through to the container by compose at create
+	// time, so only surface entries that will not resolve as expected
+	for _, entry := range invalidExtraHosts(service.ExtraHosts) {
+		input.Warnings.Warn(input.Logger, input.ServiceName, fmt.Sprintf("Invalid extra_hosts entry: service=%s, entry=%s", input.ServiceName, entry))
+	}
 
-	// Get update_config settings
-	var updateConfig *types.UpdateConfig
-	if service.Deploy != nil && service.Deploy.UpdateConfig != nil {
-		updateConfig = service.Deploy.UpdateConfig
+	if err := validateServiceLimits(service); err != nil {
+		return result, err
 	}
-	if updateConfig == nil {
-		// Default update config if not specified
-		parallelismVal := uint64(1)
-		updateConfig = &types.UpdateConfig{
-			Parallelism:   &parallelismVal,
-			Delay:         types.Duration(10 * time.Second),
-			FailureAction: "pause",
-			Monitor:       types.Duration(5 * time.Second),
-			Order:         "start-first",
+
+	checkLoggingDriver(ctx, CheckLoggingDriverInput{
+		Client:   input.Client,
+		Logger:   input.Logger,
+		Service:  service,
+		Warnings: input.Warnings,
+	})
+
+	params, err := resolveDeployParams(ctx, input, service)
+	if err != nil {
+		return result, err
+	}
+	if !input.SkipRename {
+		if err := validateContainerNameTemplate(params.ContainerNameTemplate, input.ProjectName, input.ServiceName, input.Project.Profiles, params.Replicas); err != nil {
+			return result, err
 		}
 	}
+	if command := defaultHealthcheckCommand(ctx, input, service, params); command != "" {
+		input.Logger.Info(fmt.Sprintf("Applying default healthcheck command, service has no healthcheck of its own: service=%s", input.ServiceName))
+		params.HealthcheckCommand = command
+	}
+	logDeployPlan(input.Logger, service, params)
+	warnRestartPolicy(input, service, params)
 
-	// Validate failure_action - only support "pause"
-	if updateConfig.FailureAction != "" && updateConfig.FailureAction != "pause" {
-		return fmt.Errorf("failure_action must be 'pause' (got: %s)", updateConfig.FailureAction)
+	projectDir := filepath.Dir(input.ComposeFile)
+
+	executor := input.Executor
+	if executor == nil {
+		executor = ExecCommand
 	}
 
-	// Get defaults
-	parallelism := 1
-	if updateConfig.Parallelism != nil {
-		parallelism = int(*updateConfig.Parallelism)
+	// A missing image is only noticed once the new containers fail to
+	// start, by which point a stop-first update has removed the old ones
+	if input.VerifyImageExists {
+		verifyService := *service
+		if input.Image != "" {
+			verifyService.Image = input.Image
+		}
+
+		err := verifyImages(ctx, VerifyImagesInput{
+			Client:        input.Client,
+			Executor:      executor,
+			Logger:        input.Logger,
+			Services:      []types.ServiceConfig{verifyService},
+			SkipDatabases: input.SkipDatabases,
+		})
+		if err != nil {
+			return result, err
+		}
 	}
-	delay := 0 * time.Second
-	if updateConfig.Delay > 0 {
-		delay = time.Duration(updateConfig.Delay)
+
+	overlayFiles := slices.Clone(input.OverrideFiles)
+	overrides := serviceOverrides(input, service)
+	if legacyOverrides := legacyResourceOverrides(service); len(legacyOverrides) > 0 && hasDeployResources(service) {
+		input.Warnings.Warn(input.Logger, input.ServiceName, fmt.Sprintf("Ambiguous resource limits, legacy keys and deploy.resources are both set: service=%s, legacy=%s", input.ServiceName, strings.Join(slices.Sorted(maps.Keys(legacyOverrides)), ",")))
 	}
-	monitor := 5 * time.Second
-	if updateConfig.Monitor > 0 {
-		monitor = time.Duration(updateConfig.Monitor)
+	// the fingerprint covers the config the containers are created from, so
+	// it is taken before the deploy's own labels are added
+	fingerprint := configFingerprint(service, overrides)
+	if len(input.EnvFromContainer) > 0 {
+		env, err := envFromContainers(ctx, EnvFromContainersInput{
+			Client:       input.Client,
+			Logger:       input.Logger,
+			ProjectLabel: input.ProjectLabel,
+			ProjectName:  input.ProjectName,
+			Specs:        input.EnvFromContainer,
+		})
+		if err != nil {
+			return result, err
+		}
+		overrides["environment"] = env
 	}
-	maxFailureRatio := updateConfig.MaxFailureRatio
-	order := "stop-first"
-	if updateConfig.Order != "" {
-		order = string(updateConfig.Order)
+	labels := map[string]string{
+		ConfigFingerprintLabel: fingerprint,
+	}
+	if input.KeepOld {
+		// Stamp the new generation so the previous one can be told apart
+		// once both are left running
+		generation := time.Now().UTC().Format("20060102150405")
+		labels[GenerationLabel] = generation
+		input.Logger.Info(fmt.Sprintf("Keeping old containers after update: service=%s, generation=%s", input.ServiceName, generation))
+	}
+	if input.DeployID != "" {
+		labels[DeployIDLabel] = input.DeployID
+	}
+	if input.Revision != "" {
+		labels[RevisionLabel] = input.Revision
 	}
 
-	healthcheckHostCommand := ""
-	preStopHostCommand := ""
-	postStopHostCommand := ""
-	if updateConfig.Extensions != nil {
-		if cmd, ok := updateConfig.Extensions["x-healthcheck-host-command"].(string); ok {
-			healthcheckHostCommand = cmd
+	// A pinned rollback image outlives the containers it is stamped on, so
+	// it is carried over from the running containers until another is pinned
+	rollbackImage := input.PinRollbackImage
+	if rollbackImage != "" {
+		input.Logger.Info(fmt.Sprintf("Pinning rollback image: service=%s, image=%s", input.ServiceName, rollbackImage))
+	} else {
+		rollbackImage, _, err = pinnedRollbackImage(ctx, input)
+		if err != nil {
+			return result, err
+		}
+	}
+	if rollbackImage != "" {
+		labels[RollbackImageLabel] = rollbackImage
+	}
+	if input.Index > 0 && (input.Canary > 0 || input.Promote || input.KeepOld) {
+		return result, fmt.Errorf("an indexed deploy cannot be combined with canary, promote or keep-old: service=%s", input.ServiceName)
+	}
+	if input.AtomicPhase != "" && (input.Index > 0 || input.Canary > 0 || input.Promote || input.KeepOld) {
+		return result, fmt.Errorf("an atomic deploy cannot be combined with index, canary, promote or keep-old: service=%s", input.ServiceName)
+	}
+	if input.AtomicPhase != "" && input.DeployID == "" {
+		return result, fmt.Errorf("deploy id is required for atomic deploys: service=%s", input.ServiceName)
+	}
+	if input.Index > 0 && input.SkipRename {
+		return result, fmt.Errorf("an indexed deploy cannot skip renaming containers: service=%s", input.ServiceName)
+	}
+	if input.Index > 0 && params.RunToCompletion {
+		return result, fmt.Errorf("indexed deploys are not supported for run-to-completion services: service=%s", input.ServiceName)
+	}
+	if input.Canary > 0 {
+		if input.Promote {
+			return result, fmt.Errorf("canary and promote cannot be combined: service=%s", input.ServiceName)
 		}
-		if cmd, ok := updateConfig.Extensions["x-pre-stop-host-command"].(string); ok {
-			preStopHostCommand = cmd
+		if params.RunToCompletion {
+			return result, fmt.Errorf("canary deploys are not supported for run-to-completion services: service=%s", input.ServiceName)
 		}
-		if cmd, ok := updateConfig.Extensions["x-post-stop-host-command"].(string); ok {
-			postStopHostCommand = cmd
+		labels[CanaryLabel] = "true"
+	}
+	if len(labels) > 0 {
+		overrides["labels"] = labels
+	}
+	if len(overrides) > 0 {
+		overlayFile, err := writeComposeOverlay(input.ServiceName, overrides)
+		if err != nil {
+			return result, err
 		}
+		defer os.Remove(overlayFile)
+		overlayFiles = append(overlayFiles, overlayFile)
 	}
 
-	projectDir := filepath.Dir(input.ComposeFile)
+	// An overridden entrypoint or command changes how the container starts,
+	// so its healthcheck no longer reflects the service's readiness
+	skipHealthcheck := input.Command != "" || input.Entrypoint != ""
+	if skipHealthcheck {
+		input.Logger.Info(fmt.Sprintf("Skipping healthchecks for overridden entrypoint or command: service=%s", input.ServiceName))
+	}
 
-	executor := input.Executor
-	if executor == nil {
-		executor = ExecCommand
+	// A service left out of the up-front pull must not be pulled by compose
+	// either, or a pull_policy of always still reaches the registry
+	skipPull := input.SkipPull || serviceSkipsPull(service)
+
+	// One-shot services are judged by their exit code rather than kept at a
+	// replica count, and so run while preparing rather than at the cutover
+	if params.RunToCompletion && input.AtomicPhase == AtomicPhaseCutover {
+		return result, nil
+	}
+	if params.RunToCompletion {
+		output, err := runToCompletion(ctx, RunToCompletionInput{
+			Client:                   input.Client,
+			ComposeFile:              input.ComposeFile,
+			Executor:                 executor,
+			Logger:                   input.Logger,
+			OverlayFiles:             overlayFiles,
+			ProjectDir:               projectDir,
+			ProjectLabel:             input.ProjectLabel,
+			ProjectName:              input.ProjectName,
+			QuietPull:                input.QuietPull,
+			RecreateAnonymousVolumes: input.RecreateAnonymousVolumes,
+			Replicas:                 params.Replicas,
+			ServiceName:              input.ServiceName,
+			SkipPull:                 skipPull,
+		})
+		result.Failures = output.Failed
+		return result, err
+	}
+
+	// Containers left behind in a created or exited state by a prior failed
+	// attempt would otherwise be counted towards the scale by compose
+	err = removeLeftoverContainers(ctx, RemoveLeftoverContainersInput{
+		Client:       input.Client,
+		Logger:       input.Logger,
+		ProjectLabel: input.ProjectLabel,
+		ProjectName:  input.ProjectName,
+		ServiceName:  input.ServiceName,
+	})
+	if err != nil {
+		return result, err
 	}
 
 	// Get current running containers
 	currentContainers, err := composeContainers(ComposeContainersInput{
-		Client:      input.Client,
-		ProjectName: input.ProjectName,
-		ServiceName: input.ServiceName,
-		Status:      "running",
+		Client:       input.Client,
+		ProjectLabel: input.ProjectLabel,
+		ProjectName:  input.ProjectName,
+		ServiceName:  input.ServiceName,
+		Status:       "running",
 	})
 	if err != nil {
-		return fmt.Errorf("error getting current containers: %v", err)
+		return result, fmt.Errorf("error getting current containers: %v", err)
+	}
+	input.Metrics.serviceStarted(input.ServiceName, params.Replicas, len(currentContainers))
+
+	// Only a service with containers to replace would have them stopped by
+	// a stop-first update, so services being created or scaled out are
+	// deployed as usual
+	if input.KeepOld && params.Order != "start-first" && len(currentContainers) > 0 && !input.OnlyNew {
+		return result, fmt.Errorf("keeping old containers requires the start-first update order: service=%s, order=%s", input.ServiceName, params.Order)
+	}
+
+	// A host healthcheck command that cannot run would fail every new
+	// container, so it is first tried against the oldest running container
+	if !skipHealthcheck && params.HealthcheckCommand != "" && len(currentContainers) > 0 {
+		oldest := slices.MinFunc(currentContainers, func(a, b container.Summary) int {
+			return cmp.Compare(a.Created, b.Created)
+		})
+		err := smokeTestHealthcheck(ctx, input.Logger, runScriptInput{
+			Client:          input.Client,
+			ContainerID:     oldest.ID,
+			Executor:        executor,
+			HealthURLScheme: params.HealthcheckScheme,
+			ServiceName:     input.ServiceName,
+			Script:          params.HealthcheckCommand,
+			ScriptType:      "healthcheck",
+		})
+		if err != nil {
+			return result, err
+		}
 	}
 
-	// Scale down if needed (before rolling update)
-	if len(currentContainers) > replicas {
+	// An atomic deploy prepares a full set of new containers next to the old
+	// ones, so no service is touched until every service has proven healthy
+	if input.AtomicPhase == AtomicPhasePrepare {
+		input.Logger.Info(fmt.Sprintf("Preparing new containers: service=%s, replicas=%d, existing=%d", input.ServiceName, params.Replicas, len(currentContainers)))
+		if params.Replicas == 0 {
+			return result, nil
+		}
+
+		// the prepared containers take over the per-replica volumes of
+		// the containers they replace once cut over
+		replacedContainers := slices.Clone(currentContainers)
+		sortContainersByCreationTime(replacedContainers, false)
+
+		err := scaleUpContainers(ctx, ScaleUpContainersInput{
+			Client:                   input.Client,
+			ComposeFile:              input.ComposeFile,
+			ContainerTimeout:         params.ContainerTimeout,
+			CurrentReplicas:          len(currentContainers),
+			Delay:                    params.Delay,
+			DesiredReplicas:          len(currentContainers) + params.Replicas,
+			DrainCommand:             params.DrainCommand,
+			DrainTimeout:             params.DrainTimeout,
+			Executor:                 executor,
+			ExistingContainers:       currentContainers,
+			FailureAction:            params.FailureAction,
+			FailureLogLines:          input.FailureLogLines,
+			HealthcheckCommand:       params.HealthcheckCommand,
+			HealthcheckExpectOutput:  params.HealthcheckExpectOutput,
+			HealthcheckMode:          params.HealthcheckMode,
+			HealthcheckScheme:        params.HealthcheckScheme,
+			Logger:                   input.Logger,
+			MaxFailureRatio:          params.MaxFailureRatio,
+			Metrics:                  input.Metrics,
+			Monitor:                  params.Monitor,
+			NoRecreate:               true,
+			OnHealthyHostCommand:     params.OnHealthyHostCommand,
+			OnUnhealthyHostCommand:   params.OnUnhealthyHostCommand,
+			OverlayFiles:             overlayFiles,
+			Parallelism:              params.Parallelism,
+			ParallelismBudget:        input.ParallelismBudget,
+			PerReplicaVolume:         params.PerReplicaVolume,
+			PostStopHostCommand:      params.PostStopHostCommand,
+			PreStopCommand:           params.PreStopCommand,
+			PreStopHostCommand:       params.PreStopHostCommand,
+			PreStopOrder:             params.PreStopOrder,
+			Profiles:                 input.Project.Profiles,
+			ProjectDir:               projectDir,
+			ProjectLabel:             input.ProjectLabel,
+			ProjectName:              input.ProjectName,
+			QuietPull:                input.QuietPull,
+			RecreateAnonymousVolumes: input.RecreateAnonymousVolumes,
+			ReplacedContainers:       replacedContainers,
+			ReportAllFailures:        input.ReportAllFailures,
+			RunningGrace:             params.RunningGrace,
+			ScaleStep:                params.ScaleStep,
+			ServiceName:              input.ServiceName,
+			ServiceReadinessCommand:  params.ServiceReadinessCommand,
+			SkipCleanupHooks:         !params.CleanupRunHooks,
+			SkipHealthcheck:          skipHealthcheck,
+			SkipPull:                 skipPull,
+			StartPeriod:              params.StartPeriod,
+			StopGracePeriod:          params.StopGracePeriod,
+			SuccessThreshold:         params.SuccessThreshold,
+			Warnings:                 input.Warnings,
+		})
+		if err != nil {
+			if hint := serviceLimitsHint(service, err); hint != "" {
+				input.Warnings.Warn(input.Logger, input.ServiceName, hint)
+			}
+			return result, fmt.Errorf("error preparing new containers: %v", err)
+		}
+
+		result.Replicas = params.Replicas
+		result.Updates = params.Replicas
+		return result, nil
+	}
+
+	// The old containers are those not stamped by this deploy, and are
+	// picked by their label rather than their age, so a skewed clock can
+	// never stop a prepared container in their place
+	if input.AtomicPhase == AtomicPhaseCutover {
+		oldContainers := slices.DeleteFunc(slices.Clone(currentContainers), func(c container.Summary) bool {
+			return c.Labels[DeployIDLabel] == input.DeployID
+		})
+
+		input.Logger.Info(fmt.Sprintf("Cutting over to new containers: service=%s, prepared=%d, old=%d", input.ServiceName, len(currentContainers)-len(oldContainers), len(oldContainers)))
 		err := scaleDownContainers(ctx, ScaleDownContainersInput{
+			Client:              input.Client,
+			ComposeFile:         input.ComposeFile,
+			CurrentContainers:   oldContainers,
+			CurrentReplicas:     len(oldContainers),
+			DesiredReplicas:     0,
+			DrainCommand:        params.DrainCommand,
+			DrainTimeout:        params.DrainTimeout,
+			Executor:            executor,
+			Logger:              input.Logger,
+			Metrics:             input.Metrics,
+			Parallelism:         params.ScaleDownParallelism,
+			PostStopHostCommand: params.PostStopHostCommand,
+			PreStopCommand:      params.PreStopCommand,
+			PreStopHostCommand:  params.PreStopHostCommand,
+			PreStopOrder:        params.PreStopOrder,
+			ProjectName:         input.ProjectName,
+			ServiceName:         input.ServiceName,
+			StopGracePeriod:     params.StopGracePeriod,
+			Warnings:            input.Warnings,
+		})
+		if err != nil {
+			return result, err
+		}
+
+		return completeServiceDeploy(ctx, input, service, params, RollingUpdateOutput{})
+	}
+
+	// A canary runs the new image alongside the existing containers without
+	// replacing any of them, so traffic can be split externally
+	if input.Canary > 0 {
+		if len(currentContainers) == 0 {
+			return result, fmt.Errorf("canary deploys require running containers to deploy alongside: service=%s", input.ServiceName)
+		}
+
+		input.Logger.Info(fmt.Sprintf("Deploying canary: service=%s, canaries=%d, existing=%d", input.ServiceName, input.Canary, len(currentContainers)))
+		err := scaleUpContainers(ctx, ScaleUpContainersInput{
+			Client:                   input.Client,
+			ComposeFile:              input.ComposeFile,
+			ContainerTimeout:         params.ContainerTimeout,
+			CurrentReplicas:          len(currentContainers),
+			Delay:                    params.Delay,
+			DesiredReplicas:          len(currentContainers) + input.Canary,
+			DrainCommand:             params.DrainCommand,
+			DrainTimeout:             params.DrainTimeout,
+			Executor:                 executor,
+			ExistingContainers:       currentContainers,
+			FailureAction:            params.FailureAction,
+			FailureLogLines:          input.FailureLogLines,
+			HealthcheckCommand:       params.HealthcheckCommand,
+			HealthcheckExpectOutput:  params.HealthcheckExpectOutput,
+			HealthcheckMode:          params.HealthcheckMode,
+			HealthcheckScheme:        params.HealthcheckScheme,
+			HealthcheckTimeoutAction: params.HealthcheckTimeoutAction,
+			Logger:                   input.Logger,
+			MaxFailureRatio:          params.MaxFailureRatio,
+			Metrics:                  input.Metrics,
+			Monitor:                  params.Monitor,
+			NoRecreate:               true,
+			OnHealthyHostCommand:     params.OnHealthyHostCommand,
+			OnUnhealthyHostCommand:   params.OnUnhealthyHostCommand,
+			OverlayFiles:             overlayFiles,
+			Parallelism:              params.Parallelism,
+			ParallelismBudget:        input.ParallelismBudget,
+			PerReplicaVolume:         params.PerReplicaVolume,
+			PostStopHostCommand:      params.PostStopHostCommand,
+			PreStopCommand:           params.PreStopCommand,
+			PreStopHostCommand:       params.PreStopHostCommand,
+			PreStopOrder:             params.PreStopOrder,
+			Profiles:                 input.Project.Profiles,
+			ProjectDir:               projectDir,
+			ProjectLabel:             input.ProjectLabel,
+			ProjectName:              input.ProjectName,
+			QuietPull:                input.QuietPull,
+			RecreateAnonymousVolumes: input.RecreateAnonymousVolumes,
+			ReportAllFailures:        input.ReportAllFailures,
+			RunningGrace:             params.RunningGrace,
+			ScaleStep:                params.ScaleStep,
+			ServiceName:              input.ServiceName,
+			ServiceReadinessCommand:  params.ServiceReadinessCommand,
+			SkipCleanupHooks:         !params.CleanupRunHooks,
+			SkipHealthcheck:          skipHealthcheck,
+			SkipPull:                 skipPull,
+			StartPeriod:              params.StartPeriod,
+			StopGracePeriod:          params.StopGracePeriod,
+			SuccessThreshold:         params.SuccessThreshold,
+			Warnings:                 input.Warnings,
+		})
+		if err != nil {
+			if hint := serviceLimitsHint(service, err); hint != "" {
+				input.Warnings.Warn(input.Logger, input.ServiceName, hint)
+			}
+			return result, fmt.Errorf("error deploying canary: %v", err)
+		}
+
+		canaryContainers, err := composeContainers(ComposeContainersInput{
+			Client:       input.Client,
+			ProjectLabel: input.ProjectLabel,
+			ProjectName:  input.ProjectName,
+			ServiceName:  input.ServiceName,
+			Status:       "running",
+		})
+		if err != nil {
+			return result, fmt.Errorf("error getting final container count: %v", err)
+		}
+
+		result.Replicas = len(canaryContainers)
+		input.Logger.Info(fmt.Sprintf("Canary deployed: service=%s, canaries=%d, actual=%d", input.ServiceName, input.Canary, len(canaryContainers)))
+		return result, nil
+	}
+
+	// Only the indexed container is replaced, leaving the replica count and
+	// every other container as they are
+	if input.Index > 0 {
+		target, targetName, err := instanceContainer(InstanceContainerInput{
+			Containers:   currentContainers,
+			Index:        input.Index,
+			NameTemplate: params.ContainerNameTemplate,
+			Profiles:     input.Project.Profiles,
+			ProjectName:  input.ProjectName,
+			ServiceName:  input.ServiceName,
+		})
+		if err != nil {
+			return result, err
+		}
+
+		input.Logger.Info(fmt.Sprintf("Replacing service instance: service=%s, index=%d, container=%s", input.ServiceName, input.Index, targetName))
+		rollingUpdateOutput, err := rollingUpdateContainers(ctx, RollingUpdateInput{
+			Client:                   input.Client,
+			ComposeFile:              input.ComposeFile,
+			ContainerTimeout:         params.ContainerTimeout,
+			ContainersToUpdate:       []container.Summary{target},
+			CurrentReplicas:          1,
+			DesiredReplicas:          len(currentContainers),
+			DrainCommand:             params.DrainCommand,
+			DrainTimeout:             params.DrainTimeout,
+			Executor:                 executor,
+			FailureAction:            params.FailureAction,
+			FailureLogLines:          input.FailureLogLines,
+			HealthcheckCommand:       params.HealthcheckCommand,
+			HealthcheckExpectOutput:  params.HealthcheckExpectOutput,
+			HealthcheckMode:          params.HealthcheckMode,
+			HealthcheckScheme:        params.HealthcheckScheme,
+			InheritLabels:            input.InheritLabels,
+			Logger:                   input.Logger,
+			MaxFailureRatio:          params.MaxFailureRatio,
+			MaxOldContainers:         1,
+			Metrics:                  input.Metrics,
+			Monitor:                  params.Monitor,
+			OnHealthyHostCommand:     params.OnHealthyHostCommand,
+			OnUnhealthyHostCommand:   params.OnUnhealthyHostCommand,
+			Order:                    params.Order,
+			OverlayFiles:             overlayFiles,
+			Parallelism:              1,
+			ParallelismBudget:        input.ParallelismBudget,
+			PerReplicaVolume:         params.PerReplicaVolume,
+			PostStopHostCommand:      params.PostStopHostCommand,
+			PreStopCommand:           params.PreStopCommand,
+			PreStopHostCommand:       params.PreStopHostCommand,
+			PreStopOrder:             params.PreStopOrder,
+			Profiles:                 input.Project.Profiles,
+			ProjectDir:               projectDir,
+			ProjectLabel:             input.ProjectLabel,
+			ProjectName:              input.ProjectName,
+			QuietPull:                input.QuietPull,
+			RecreateAnonymousVolumes: input.RecreateAnonymousVolumes,
+			RunningGrace:             params.RunningGrace,
+			ServiceName:              input.ServiceName,
+			ServiceReadinessCommand:  params.ServiceReadinessCommand,
+			SkipCleanupHooks:         !params.CleanupRunHooks,
+			SkipHealthcheck:          skipHealthcheck,
+			SkipPull:                 skipPull,
+			StartPeriod:              params.StartPeriod,
+			StopGracePeriod:          params.StopGracePeriod,
+			SuccessThreshold:         params.SuccessThreshold,
+			Warnings:                 input.Warnings,
+		})
+		if err != nil {
+			if hint := serviceLimitsHint(service, err); hint != "" {
+				input.Warnings.Warn(input.Logger, input.ServiceName, hint)
+			}
+			return result, fmt.Errorf("error replacing instance %d: %v", input.Index, err)
+		}
+
+		finalContainers, err := composeContainers(ComposeContainersInput{
+			Client:       input.Client,
+			ProjectLabel: input.ProjectLabel,
+			ProjectName:  input.ProjectName,
+			ServiceName:  input.ServiceName,
+			Status:       "running",
+		})
+		if err != nil {
+			return result, fmt.Errorf("error getting final container count: %v", err)
+		}
+
+		// the replacement takes over the name of the container it replaced,
+		// so the other instances keep their names
+		for _, c := range finalContainers {
+			if slices.ContainsFunc(currentContainers, func(existing container.Summary) bool { return existing.ID == c.ID }) {
+				continue
+			}
+			if err := input.Client.ContainerRename(ctx, c.ID, targetName); err != nil {
+				return result, fmt.Errorf("error renaming container %s to %s: %v", c.ID[:12], targetName, err)
+			}
+		}
+
+		result.Failures = rollingUpdateOutput.Failures
+		result.Replicas = len(finalContainers)
+		result.Updates = rollingUpdateOutput.TotalUpdates
+		input.Logger.Info(fmt.Sprintf("Service instance replaced: service=%s, index=%d, actual=%d", input.ServiceName, input.Index, len(finalContainers)))
+		return result, nil
+	}
+
+	if input.Promote {
+		canaries := 0
+		for _, c := range currentContainers {
+			if c.Labels[CanaryLabel] == "true" {
+				canaries++
+			}
+		}
+		if canaries == 0 {
+			return result, fmt.Errorf("no canary containers to promote: service=%s", input.ServiceName)
+		}
+		input.Logger.Info(fmt.Sprintf("Promoting canary: service=%s, canaries=%d, replicas=%d", input.ServiceName, canaries, params.Replicas))
+	}
+
+	if params.Replicas == 0 {
+		input.Logger.Info(fmt.Sprintf("Scaling service to zero: service=%s, current=%d", input.ServiceName, len(currentContainers)))
+	}
+
+	// Scale down if needed (before rolling update, unless deferred until after)
+	if params.ScaleDownOrder == "before" && len(currentContainers) > params.Replicas {
+		scaleDownCtx, span := startSpan(ctx, nil, "scale down", attribute.String("service", input.ServiceName), attribute.Int("replicas", params.Replicas))
+		err := scaleDownContainers(scaleDownCtx, ScaleDownContainersInput{
 			Client:              input.Client,
 			ComposeFile:         input.ComposeFile,
 			CurrentContainers:   currentContainers,
 			CurrentReplicas:     len(currentContainers),
-			DesiredReplicas:     replicas,
+			DesiredReplicas:     params.Replicas,
+			DrainCommand:        params.DrainCommand,
+			DrainTimeout:        params.DrainTimeout,
 			Executor:            executor,
+			Keep:                input.ScaleDownKeep,
 			Logger:              input.Logger,
-			PostStopHostCommand: postStopHostCommand,
-			PreStopHostCommand:  preStopHostCommand,
+			Metrics:             input.Metrics,
+			Parallelism:         params.ScaleDownParallelism,
+			PostStopHostCommand: params.PostStopHostCommand,
+			PreStopCommand:      params.PreStopCommand,
+			PreStopHostCommand:  params.PreStopHostCommand,
+			PreStopOrder:        params.PreStopOrder,
 			ProjectName:         input.ProjectName,
 			ServiceName:         input.ServiceName,
+			StopGracePeriod:     params.StopGracePeriod,
+			Warnings:            input.Warnings,
 		})
+		endSpan(span, err)
 		if err != nil {
-			return err
+			return result, err
 		}
 	}
 
 	// refresh the current containers
 	containersToUpdate, err := composeContainers(ComposeContainersInput{
-		Client:      input.Client,
-		ProjectName: input.ProjectName,
-		ServiceName: input.ServiceName,
-		Status:      "running",
+		Client:       input.Client,
+		ProjectLabel: input.ProjectLabel,
+		ProjectName:  input.ProjectName,
+		ServiceName:  input.ServiceName,
+		Status:       "running",
 	})
 	if err != nil {
-		return fmt.Errorf("error getting updated containers: %v", err)
+		return result, fmt.Errorf("error getting updated containers: %v", err)
 	}
 
+	// A stop-first batch covering every running container leaves the service
+	// down until its replacements are healthy, so the maintenance service
+	// answers in its place for that gap
+	maintenanceInput := MaintenanceServiceInput{
+		ComposeFile:        input.ComposeFile,
+		Executor:           executor,
+		Logger:             input.Logger,
+		MaintenanceService: params.MaintenanceService,
+		OverlayFiles:       input.OverrideFiles,
+		ProjectDir:         projectDir,
+		ProjectName:        input.ProjectName,
+		QuietPull:          input.QuietPull,
+		ServiceName:        input.ServiceName,
+	}
+	runningReplicas := len(containersToUpdate)
+
 	// Perform rolling update on existing containers first
-	if len(containersToUpdate) > replicas {
+	if len(containersToUpdate) > params.Replicas {
 		// Only update up to the target replica count
-		containersToUpdate = containersToUpdate[:replicas]
+		containersToUpdate = containersToUpdate[:params.Replicas]
 	}
 	// sort containersToUpdate by oldest first
 	sortContainersByCreationTime(containersToUpdate, false)
 
+	// Containers already matching the service are left running, so only
+	// the containers deployed with another config or image are replaced
+	if input.Recreate {
+		desiredImage := service.Image
+		if input.Image != "" {
+			desiredImage = input.Image
+		}
+		if desiredImage == "" {
+			desiredImage = api.GetImageNameOrDefault(*service, input.ProjectName)
+		}
+		stale := staleContainers(containersToUpdate, fingerprint, desiredImage)
+		input.Logger.Info(fmt.Sprintf("Recreating containers that differ from the service: service=%s, stale=%d, matching=%d", input.ServiceName, len(stale), len(containersToUpdate)-len(stale)))
+		containersToUpdate = stale
+	}
+
+	// A pure scale out leaves every existing container as it is, so only
+	// the scale up runs
+	if input.OnlyNew && len(containersToUpdate) > 0 {
+		input.Logger.Info(fmt.Sprintf("Skipping rolling update of existing containers: service=%s, existing=%d", input.ServiceName, len(containersToUpdate)))
+		containersToUpdate = nil
+	}
+
+	// Excess containers left running until after the update still count
+	// towards the live containers capped during a start-first update
+	rollingDesiredReplicas := params.Replicas
+	if params.ScaleDownOrder == "after" {
+		rollingDesiredReplicas = max(params.Replicas, len(currentContainers))
+	}
+
+	useMaintenanceService := false
+	if params.MaintenanceService != "" && len(containersToUpdate) > 0 {
+		if min(params.Parallelism, len(containersToUpdate)) < runningReplicas {
+			input.Logger.Info(fmt.Sprintf("Skipping maintenance service, containers keep running during the update: service=%s, maintenance-service=%s", input.ServiceName, params.MaintenanceService))
+		} else {
+			if err := startMaintenanceService(ctx, maintenanceInput); err != nil {
+				return result, err
+			}
+			useMaintenanceService = true
+		}
+	}
+
 	var rollingUpdateOutput RollingUpdateOutput
 	if len(containersToUpdate) > 0 {
-		rollingUpdateOutput, err = rollingUpdateContainers(ctx, RollingUpdateInput{
-			Client:              input.Client,
-			ComposeFile:         input.ComposeFile,
-			ContainersToUpdate:  containersToUpdate,
-			CurrentReplicas:     len(containersToUpdate),
-			Delay:               delay,
-			DesiredReplicas:     replicas,
-			Executor:            executor,
-			FailureAction:       updateConfig.FailureAction,
-			HealthcheckCommand:  healthcheckHostCommand,
-			Logger:              input.Logger,
-			MaxFailureRatio:     maxFailureRatio,
-			Monitor:             monitor,
-			Order:               order,
-			Parallelism:         parallelism,
-			PostStopHostCommand: postStopHostCommand,
-			PreStopHostCommand:  preStopHostCommand,
-			ProjectDir:          projectDir,
-			ProjectName:         input.ProjectName,
-			ServiceName:         input.ServiceName,
+		rollingUpdateCtx, span := startSpan(ctx, nil, "rolling update", attribute.String("service", input.ServiceName), attribute.Int("containers", len(containersToUpdate)))
+		rollingUpdateOutput, err = rollingUpdateContainers(rollingUpdateCtx, RollingUpdateInput{
+			BatchTurn:                input.BatchTurn,
+			Client:                   input.Client,
+			ComposeFile:              input.ComposeFile,
+			ContainerTimeout:         params.ContainerTimeout,
+			ContainersToUpdate:       containersToUpdate,
+			CurrentReplicas:          len(containersToUpdate),
+			Delay:                    params.Delay,
+			DesiredReplicas:          rollingDesiredReplicas,
+			DrainCommand:             params.DrainCommand,
+			DrainTimeout:             params.DrainTimeout,
+			Executor:                 executor,
+			FailureAction:            params.FailureAction,
+			FailureLogLines:          input.FailureLogLines,
+			HealthcheckCommand:       params.HealthcheckCommand,
+			HealthcheckExpectOutput:  params.HealthcheckExpectOutput,
+			HealthcheckMode:          params.HealthcheckMode,
+			HealthcheckScheme:        params.HealthcheckScheme,
+			InheritLabels:            input.InheritLabels,
+			KeepOld:                  input.KeepOld,
+			Logger:                   input.Logger,
+			MaxFailureRatio:          params.MaxFailureRatio,
+			MaxOldContainers:         input.MaxOldContainers,
+			Metrics:                  input.Metrics,
+			Monitor:                  params.Monitor,
+			OnHealthyHostCommand:     params.OnHealthyHostCommand,
+			OnUnhealthyHostCommand:   params.OnUnhealthyHostCommand,
+			Order:                    params.Order,
+			OverlayFiles:             overlayFiles,
+			Parallelism:              params.Parallelism,
+			ParallelismBudget:        input.ParallelismBudget,
+			PerReplicaVolume:         params.PerReplicaVolume,
+			PostStopHostCommand:      params.PostStopHostCommand,
+			PreStopCommand:           params.PreStopCommand,
+			PreStopHostCommand:       params.PreStopHostCommand,
+			PreStopOrder:             params.PreStopOrder,
+			Profiles:                 input.Project.Profiles,
+			ProjectDir:               projectDir,
+			ProjectLabel:             input.ProjectLabel,
+			ProjectName:              input.ProjectName,
+			QuietPull:                input.QuietPull,
+			RecreateAnonymousVolumes: input.RecreateAnonymousVolumes,
+			RunningGrace:             params.RunningGrace,
+			ServiceName:              input.ServiceName,
+			ServiceReadinessCommand:  params.ServiceReadinessCommand,
+			SkipCleanupHooks:         !params.CleanupRunHooks,
+			SkipHealthcheck:          skipHealthcheck,
+			SkipPull:                 skipPull,
+			StartPeriod:              params.StartPeriod,
+			StopGracePeriod:          params.StopGracePeriod,
+			SuccessThreshold:         params.SuccessThreshold,
+			Warnings:                 input.Warnings,
 		})
+		endSpan(span, err)
 		if err != nil {
-			return fmt.Errorf("error rolling update containers: %v", err)
+			if hint := serviceLimitsHint(service, err); hint != "" {
+				input.Warnings.Warn(input.Logger, input.ServiceName, hint)
+			}
+			if useMaintenanceService {
+				input.Warnings.Warn(input.Logger, input.ServiceName, fmt.Sprintf("Leaving maintenance service running after failed update: service=%s, maintenance-service=%s", input.ServiceName, params.MaintenanceService))
+			}
+			return result, fmt.Errorf("error rolling update containers: %v", err)
+		}
+	}
+
+	if useMaintenanceService {
+		if err := stopMaintenanceService(ctx, maintenanceInput); err != nil {
+			input.Warnings.Warn(input.Logger, input.ServiceName, fmt.Sprintf("Maintenance service left running: service=%s, maintenance-service=%s, error=%v", input.ServiceName, params.MaintenanceService, err))
 		}
 	}
 
 	// Get updated container count after rolling update
 	updatedContainers, err := composeContainers(ComposeContainersInput{
-		Client:      input.Client,
-		ProjectName: input.ProjectName,
-		ServiceName: input.ServiceName,
-		Status:      "running",
+		Client:       input.Client,
+		ProjectLabel: input.ProjectLabel,
+		ProjectName:  input.ProjectName,
+		ServiceName:  input.ServiceName,
+		Status:       "running",
 	})
 	if err != nil {
-		return fmt.Errorf("error getting updated containers: %v", err)
+		return result, fmt.Errorf("error getting updated containers: %v", err)
 	}
 
 	// Scale up if needed (only after existing containers are replaced)
-	if len(updatedContainers) < replicas {
-		err := scaleUpContainers(ctx, ScaleUpContainersInput{
-			Client:              input.Client,
-			ComposeFile:         input.ComposeFile,
-			CurrentReplicas:     len(updatedContainers),
-			Delay:               delay,
-			DesiredReplicas:     replicas,
-			Executor:            executor,
-			ExistingContainers:  updatedContainers,
-			FailureAction:       string(updateConfig.FailureAction),
-			HealthcheckCommand:  healthcheckHostCommand,
-			Logger:              input.Logger,
-			MaxFailureRatio:     maxFailureRatio,
-			Monitor:             monitor,
-			Parallelism:         parallelism,
-			PostStopHostCommand: postStopHostCommand,
-			PreStopHostCommand:  preStopHostCommand,
-			ProjectDir:          projectDir,
-			ProjectName:         input.ProjectName,
-			ServiceName:         input.ServiceName,
+	if len(updatedContainers) < params.Replicas {
+		scaleUpCtx, span := startSpan(ctx, nil, "scale up", attribute.String("service", input.ServiceName), attribute.Int("replicas", params.Replicas))
+		err := scaleUpContainers(scaleUpCtx, ScaleUpContainersInput{
+			Client:                   input.Client,
+			ComposeFile:              input.ComposeFile,
+			ContainerTimeout:         params.ContainerTimeout,
+			CurrentReplicas:          len(updatedContainers),
+			Delay:                    params.Delay,
+			DesiredReplicas:          params.Replicas,
+			DrainCommand:             params.DrainCommand,
+			DrainTimeout:             params.DrainTimeout,
+			Executor:                 executor,
+			ExistingContainers:       updatedContainers,
+			FailureAction:            params.FailureAction,
+			FailureLogLines:          input.FailureLogLines,
+			HealthcheckCommand:       params.HealthcheckCommand,
+			HealthcheckExpectOutput:  params.HealthcheckExpectOutput,
+			HealthcheckMode:          params.HealthcheckMode,
+			HealthcheckScheme:        params.HealthcheckScheme,
+			HealthcheckTimeoutAction: params.HealthcheckTimeoutAction,
+			Logger:                   input.Logger,
+			MaxFailureRatio:          params.MaxFailureRatio,
+			Metrics:                  input.Metrics,
+			Monitor:                  params.Monitor,
+			OnHealthyHostCommand:     params.OnHealthyHostCommand,
+			OnUnhealthyHostCommand:   params.OnUnhealthyHostCommand,
+			OverlayFiles:             overlayFiles,
+			Parallelism:              params.Parallelism,
+			ParallelismBudget:        input.ParallelismBudget,
+			PerReplicaVolume:         params.PerReplicaVolume,
+			PostStopHostCommand:      params.PostStopHostCommand,
+			PreStopCommand:           params.PreStopCommand,
+			PreStopHostCommand:       params.PreStopHostCommand,
+			PreStopOrder:             params.PreStopOrder,
+			Profiles:                 input.Project.Profiles,
+			ProjectDir:               projectDir,
+			ProjectLabel:             input.ProjectLabel,
+			ProjectName:              input.ProjectName,
+			QuietPull:                input.QuietPull,
+			RecreateAnonymousVolumes: input.RecreateAnonymousVolumes,
+			ReportAllFailures:        input.ReportAllFailures,
+			RunningGrace:             params.RunningGrace,
+			ScaleStep:                params.ScaleStep,
+			ServiceName:              input.ServiceName,
+			ServiceReadinessCommand:  params.ServiceReadinessCommand,
+			SkipCleanupHooks:         !params.CleanupRunHooks,
+			SkipHealthcheck:          skipHealthcheck,
+			SkipPull:                 skipPull,
+			StartPeriod:              params.StartPeriod,
+			StopGracePeriod:          params.StopGracePeriod,
+			SuccessThreshold:         params.SuccessThreshold,
+			Warnings:                 input.Warnings,
 		})
+		endSpan(span, err)
 		if err != nil {
-			return err
+			if hint := serviceLimitsHint(service, err); hint != "" {
+				input.Warnings.Warn(input.Logger, input.ServiceName, hint)
+			}
+			return result, err
+		}
+	}
+
+	// Scale down once the replacements are healthy, so capacity is never
+	// dropped before the update has proven itself
+	if params.ScaleDownOrder == "after" {
+		runningContainers, err := composeContainers(ComposeContainersInput{
+			Client:       input.Client,
+			ProjectLabel: input.ProjectLabel,
+			ProjectName:  input.ProjectName,
+			ServiceName:  input.ServiceName,
+			Status:       "running",
+		})
+		if err != nil {
+			return result, fmt.Errorf("error getting running containers: %v", err)
+		}
+
+		if len(runningContainers) > params.Replicas {
+			scaleDownCtx, span := startSpan(ctx, nil, "scale down", attribute.String("service", input.ServiceName), attribute.Int("replicas", params.Replicas))
+			err := scaleDownContainers(scaleDownCtx, ScaleDownContainersInput{
+				Client:              input.Client,
+				ComposeFile:         input.ComposeFile,
+				CurrentContainers:   runningContainers,
+				CurrentReplicas:     len(runningContainers),
+				DesiredReplicas:     params.Replicas,
+				DrainCommand:        params.DrainCommand,
+				DrainTimeout:        params.DrainTimeout,
+				Executor:            executor,
+				Keep:                input.ScaleDownKeep,
+				Logger:              input.Logger,
+				Metrics:             input.Metrics,
+				Parallelism:         params.ScaleDownParallelism,
+				PostStopHostCommand: params.PostStopHostCommand,
+				PreStopCommand:      params.PreStopCommand,
+				PreStopHostCommand:  params.PreStopHostCommand,
+				PreStopOrder:        params.PreStopOrder,
+				ProjectName:         input.ProjectName,
+				ServiceName:         input.ServiceName,
+				StopGracePeriod:     params.StopGracePeriod,
+				Warnings:            input.Warnings,
+			})
+			endSpan(span, err)
+			if err != nil {
+				return result, err
+			}
 		}
 	}
 
+	return completeServiceDeploy(ctx, input, service, params, rollingUpdateOutput)
+}
+
+// completeServiceDeploy renames the running containers of a deployed service
+// to the naming convention, reports their published ports and records the
+// deploy in the history
+func completeServiceDeploy(ctx context.Context, input DeployServiceInput, service *types.ServiceConfig, params DeployParams, rollingUpdateOutput RollingUpdateOutput) (DeployServiceResult, error) {
+	result := DeployServiceResult{}
+
 	// Get final container count
 	finalContainers, err := composeContainers(ComposeContainersInput{
-		Client:      input.Client,
-		ProjectName: input.ProjectName,
-		ServiceName: input.ServiceName,
-		Status:      "running",
+		Client:       input.Client,
+		ProjectLabel: input.ProjectLabel,
+		ProjectName:  input.ProjectName,
+		ServiceName:  input.ServiceName,
+		Status:       "running",
 	})
 	if err != nil {
-		return fmt.Errorf("error getting final container count: %v", err)
+		return result, fmt.Errorf("error getting final container count: %v", err)
 	}
 
-	// Rename all containers to follow the naming convention
-	err = renameContainersToConvention(ctx, RenameContainersToConventionInput{
-		Client:       input.Client,
-		Containers:   finalContainers,
-		ProjectName:  input.ProjectName,
-		ServiceName:  input.ServiceName,
-		NameTemplate: input.ContainerNameTemplate,
+	// Rename all containers to follow the naming convention, unless
+	// external tooling manages their names
+	if !input.SkipRename {
+		err = renameContainersToConvention(ctx, RenameContainersToConventionInput{
+			Client:       input.Client,
+			Containers:   finalContainers,
+			ProjectName:  input.ProjectName,
+			ServiceName:  input.ServiceName,
+			NameTemplate: params.ContainerNameTemplate,
+			Profiles:     input.Project.Profiles,
+		})
+		if err != nil {
+			return result, fmt.Errorf("error renaming containers: %v", err)
+		}
+	}
+
+	// The smoke test checks the converged service end to end, so it is
+	// skipped along with the healthchecks for an overridden start
+	if input.Command != "" || input.Entrypoint != "" {
+		params.SmokeTestCommand = ""
+	}
+	executor := input.Executor
+	if executor == nil {
+		executor = ExecCommand
+	}
+	err = runSmokeTest(ctx, RunSmokeTestInput{
+		Client:          input.Client,
+		Command:         params.SmokeTestCommand,
+		Containers:      finalContainers,
+		Executor:        executor,
+		HealthURLScheme: params.HealthcheckScheme,
+		Logger:          input.Logger,
+		ServiceName:     input.ServiceName,
 	})
 	if err != nil {
-		return fmt.Errorf("error renaming containers: %v", err)
+		return result, err
 	}
 
-	input.Logger.Info(fmt.Sprintf("Deployment complete: service=%s, expected=%d, actual=%d failures=%d", input.ServiceName, replicas, len(finalContainers), rollingUpdateOutput.Failures))
-	return nil
+	// Dynamically published ports are only assigned once the containers
+	// run, so surface them for whatever routes traffic to the service
+	portMappings, err := containerPortMappings(ctx, input.Client, finalContainers)
+	if err != nil {
+		input.Warnings.Warn(input.Logger, input.ServiceName, fmt.Sprintf("Unable to read published ports: service=%s, error=%v", input.ServiceName, err))
+	}
+	for _, mapping := range portMappings {
+		input.Logger.Info(fmt.Sprintf("Published port: service=%s, container=%s, port=%s", input.ServiceName, mapping.Container, mapping))
+	}
+
+	record := HistoryRecord{
+		DeployID: input.DeployID,
+		Image:    service.Image,
+		Project:  input.ProjectName,
+		Replicas: params.Replicas,
+		Revision: input.Revision,
+		Service:  input.ServiceName,
+	}
+	if input.Image != "" {
+		record.Image = input.Image
+	}
+	if len(finalContainers) > 0 {
+		record.ImageID = finalContainers[0].ImageID
+	}
+	if err := input.History.Append(record); err != nil {
+		input.Warnings.Warn(input.Logger, input.ServiceName, fmt.Sprintf("Unable to record deploy history: service=%s, error=%v", input.ServiceName, err))
+	}
+
+	logAppliedExtensions(input.Logger, input, service, params)
+
+	result.Failures = rollingUpdateOutput.Failures
+	result.Ports = portMappings
+	result.Replicas = len(finalContainers)
+	result.Updates = rollingUpdateOutput.TotalUpdates
+	input.Logger.Info(fmt.Sprintf("Deployment complete: service=%s, expected=%d, actual=%d failures=%d", input.ServiceName, params.Replicas, len(finalContainers), rollingUpdateOutput.Failures))
+	return result, nil
+}
+
+// failedDependencies returns the sorted dependencies of a service that failed
+// or were skipped during the deploy
+func failedDependencies(project *types.Project, serviceName string, failed map[string]bool) ([]string, error) {
+	if len(failed) == 0 {
+		return nil, nil
+	}
+
+	service, err := project.GetService(serviceName)
+	if err != nil {
+		return nil, err
+	}
+
+	dependencies := []string{}
+	for dependency := range service.DependsOn {
+		if failed[dependency] {
+			dependencies = append(dependencies, dependency)
+		}
+	}
+	slices.Sort(dependencies)
+	return dependencies, nil
 }
 
 // OrderServices orders the services in the project in dependency order
@@ -542,6 +2067,411 @@ func isDatabaseService(serviceImage string, logger *command.ZerologUi) bool {
 	return false
 }
 
+// invalidExtraHosts returns the extra_hosts entries that are not a valid host:ip pair
+func invalidExtraHosts(extraHosts types.HostsList) []string {
+	invalid := []string{}
+	for host, ips := range extraHosts {
+		if host == "" || strings.ContainsAny(host, ":=") {
+			for _, ip := range ips {
+				invalid = append(invalid, fmt.Sprintf("%s:%s", host, ip))
+			}
+			continue
+		}
+
+		for _, ip := range ips {
+			if ip == "host-gateway" {
+				continue
+			}
+			if net.ParseIP(strings.Trim(ip, "[]")) == nil {
+				invalid = append(invalid, fmt.Sprintf("%s:%s", host, ip))
+			}
+		}
+	}
+
+	slices.Sort(invalid)
+	return invalid
+}
+
+// DeployParams are the resolved settings used to deploy a service
+type DeployParams struct {
+	// CleanupRunHooks is whether the stop hooks run when a new container that failed is cleaned up
+	CleanupRunHooks bool
+	// ContainerNameTemplate is the Go template for the service's container names
+	ContainerNameTemplate string
+	// ContainerTimeout is an absolute ceiling on how long any single container may take to become healthy
+	ContainerTimeout time.Duration
+	// Delay is the delay between batches
+	Delay time.Duration
+	// DrainCommand is the host command run for each container just before it is stopped, with the container still up
+	DrainCommand string
+	// DrainTimeout is how long to wait after the drain command before stopping the container
+	DrainTimeout time.Duration
+	// Extensions are the x- extensions set in the update_config section
+	Extensions map[string]interface{}
+	// FailureAction is the action to take on failure
+	FailureAction string
+	// HealthcheckCommand is the host command to run for health checks
+	HealthcheckCommand string
+	// HealthcheckExpectOutput is the pattern the output of the healthcheck command must match for the check to pass
+	HealthcheckExpectOutput *regexp.Regexp
+	// HealthcheckMode is how the docker healthcheck status is followed, either poll or events
+	HealthcheckMode string
+	// HealthcheckScheme is the scheme of the published URL handed to the healthcheck command
+	HealthcheckScheme string
+	// HealthcheckTimeoutAction is what happens to a net-new container whose healthcheck times out, either terminate or keep
+	HealthcheckTimeoutAction string
+	// MaintenanceService is the service started in place of the service while a stop-first update leaves it without containers
+	MaintenanceService string
+	// MaxFailureRatio is the maximum allowed failure ratio
+	MaxFailureRatio float32
+	// Monitor is the health check monitoring duration
+	Monitor time.Duration
+	// OnHealthyHostCommand is the host command to run for each new container once it is healthy
+	OnHealthyHostCommand string
+	// OnUnhealthyHostCommand is the host command to run for each new container that fails its healthcheck
+	OnUnhealthyHostCommand string
+	// Order is the update order (start-first or stop-first)
+	Order string
+	// Parallelism is the number of containers to update simultaneously
+	Parallelism int
+	// PerReplicaVolume is the Go template for a volume spec bound to each container by its instance ID
+	PerReplicaVolume string
+	// PostStopHostCommand is the host command to run after stopping a container
+	PostStopHostCommand string
+	// PreStopCommand is the command to run inside a container before stopping it
+	PreStopCommand string
+	// PreStopHostCommand is the host command to run before stopping a container
+	PreStopHostCommand string
+	// PreStopOrder is which pre-stop command runs first, either host-first or container-first
+	PreStopOrder string
+	// Replicas is the number of containers that should be running
+	Replicas int
+	// RunToCompletion is whether the service runs to completion rather than staying up
+	RunToCompletion bool
+	// RunningGrace is how long a container without a healthcheck must stay running before it is considered healthy. If 0, it is healthy as soon as it is running.
+	RunningGrace time.Duration
+	// ScaleDownOrder is whether excess containers are removed before or after the rolling update
+	ScaleDownOrder string
+	// ScaleDownParallelism is the number of excess containers stopped at once when scaling down
+	ScaleDownParallelism int
+	// ScaleStep is the number of containers created at a time when scaling up. If 0, every container is created at once.
+	ScaleStep int
+	// ServiceReadinessCommand is the host command run once per batch in place of the per-container healthchecks
+	ServiceReadinessCommand string
+	// SmokeTestCommand is the host command run once the service is fully deployed, failing the deploy if it fails
+	SmokeTestCommand string
+	// StartPeriod is the healthcheck start period for new containers
+	StartPeriod time.Duration
+	// StopGracePeriod is how long containers are given to exit once stopped before they are killed, or 0 for their own stop timeout
+	StopGracePeriod time.Duration
+	// SuccessThreshold is the number of consecutive healthy readings required before a container is considered healthy
+	SuccessThreshold int
+}
+
+// resolveDeployParams resolves the deploy settings for a service from the
+// input flags, the replicas file, the service's update_config section and
+// the defaults
+func resolveDeployParams(ctx context.Context, input DeployServiceInput, service *types.ServiceConfig) (DeployParams, error) {
+	params := DeployParams{
+		CleanupRunHooks:          true,
+		Delay:                    0 * time.Second,
+		Extensions:               map[string]interface{}{},
+		HealthcheckMode:          "poll",
+		HealthcheckScheme:        "http",
+		HealthcheckTimeoutAction: "terminate",
+		Monitor:                  5 * time.Second,
+		Order:                    "stop-first",
+		Parallelism:              1,
+		PreStopOrder:             "host-first",
+		Replicas:                 ServiceReplicas(input, service),
+		ScaleDownOrder:           "before",
+		ScaleDownParallelism:     1,
+		StartPeriod:              ServiceStartPeriod(input, service),
+		StopGracePeriod:          ServiceStopGracePeriod(input, service),
+		SuccessThreshold:         1,
+	}
+
+	containerNameTemplate, err := ServiceContainerNameTemplate(input, service)
+	if err != nil {
+		return params, err
+	}
+	params.ContainerNameTemplate = containerNameTemplate
+
+	perReplicaVolume, err := servicePerReplicaVolume(service)
+	if err != nil {
+		return params, err
+	}
+	params.PerReplicaVolume = perReplicaVolume
+
+	// compose rejects differing values when loading a file, but a project
+	// built or loaded without the consistency check can still carry both
+	if service.Deploy != nil && service.Deploy.Replicas != nil && service.Scale != nil && *service.Deploy.Replicas != *service.Scale {
+		if input.Strict {
+			return params, fmt.Errorf("conflicting replica counts for service %s: deploy.replicas=%d, scale=%d", service.Name, *service.Deploy.Replicas, *service.Scale)
+		}
+		input.Warnings.Warn(input.Logger, service.Name, fmt.Sprintf("Conflicting replica counts, using deploy.replicas: service=%s, deploy.replicas=%d, scale=%d", service.Name, *service.Deploy.Replicas, *service.Scale))
+	}
+
+	// The replicas file takes precedence over the compose file, but not
+	// over an explicit replica count
+	if input.Replicas <= 0 && !input.AllowZero && input.ReplicasFile != "" {
+		fileReplicas, err := LoadReplicasFile(input.ReplicasFile)
+		if err != nil {
+			return params, err
+		}
+		if replicas, ok := fileReplicas[service.Name]; ok {
+			params.Replicas = replicas
+		}
+	}
+	if input.Replicas <= 0 && !input.AllowZero && input.ReplicasFromLabel != "" {
+		if replicas, ok := labelReplicas(ctx, input); ok {
+			params.Replicas = replicas
+		}
+	}
+
+	if input.ReplicasDelta != 0 {
+		replicas, err := deltaReplicas(input)
+		if err != nil {
+			return params, err
+		}
+		params.Replicas = replicas
+	}
+
+	if input.ReplicasMin > 0 && input.ReplicasMax > 0 && input.ReplicasMin > input.ReplicasMax {
+		return params, fmt.Errorf("replicas min (%d) cannot be greater than replicas max (%d)", input.ReplicasMin, input.ReplicasMax)
+	}
+	params.Replicas = clampReplicas(input, params.Replicas)
+
+	// Get update_config settings
+	var updateConfig *types.UpdateConfig
+	if service.Deploy != nil && service.Deploy.UpdateConfig != nil {
+		updateConfig = service.Deploy.UpdateConfig
+	}
+	if updateConfig == nil {
+		// Default update config if not specified
+		parallelismVal := uint64(1)
+		updateConfig = &types.UpdateConfig{
+			Parallelism:   &parallelismVal,
+			Delay:         types.Duration(10 * time.Second),
+			FailureAction: "pause",
+			Monitor:       types.Duration(5 * time.Second),
+			Order:         "start-first",
+		}
+	}
+
+	// Validate failure_action - only support "pause"
+	if updateConfig.FailureAction != "" && updateConfig.FailureAction != "pause" {
+		return params, fmt.Errorf("failure_action must be 'pause' (got: %s)", updateConfig.FailureAction)
+	}
+	params.FailureAction = updateConfig.FailureAction
+
+	if updateConfig.Parallelism != nil {
+		params.Parallelism = int(*updateConfig.Parallelism)
+	}
+	if input.MaxParallelism > 0 && params.Parallelism > input.MaxParallelism {
+		params.Parallelism = input.MaxParallelism
+	}
+	if updateConfig.Delay > 0 {
+		params.Delay = time.Duration(updateConfig.Delay)
+	}
+	if updateConfig.Monitor > 0 {
+		params.Monitor = time.Duration(updateConfig.Monitor)
+	}
+	params.MaxFailureRatio = updateConfig.MaxFailureRatio
+	if updateConfig.Order != "" {
+		params.Order = updateConfig.Order
+	}
+
+	for key, value := range updateConfig.Extensions {
+		if strings.HasPrefix(key, "x-") {
+			params.Extensions[key] = value
+		}
+	}
+	if cmd, ok := params.Extensions["x-healthcheck-host-command"].(string); ok {
+		params.HealthcheckCommand = cmd
+	}
+	healthcheckCommand, err := loadHealthcheckCommandFile(input, params)
+	if err != nil {
+		return params, err
+	}
+	if healthcheckCommand != "" {
+		params.HealthcheckCommand = healthcheckCommand
+	}
+	if cmd, ok := params.Extensions["x-on-healthy-host-command"].(string); ok {
+		params.OnHealthyHostCommand = cmd
+	}
+	if cmd, ok := params.Extensions["x-on-unhealthy-host-command"].(string); ok {
+		params.OnUnhealthyHostCommand = cmd
+	}
+	if cmd, ok := params.Extensions["x-pre-stop-host-command"].(string); ok {
+		params.PreStopHostCommand = cmd
+	}
+	params.DrainCommand = input.DrainCommand
+	if cmd, ok := params.Extensions["x-drain-command"].(string); ok {
+		params.DrainCommand = cmd
+	}
+	if value, ok := params.Extensions["x-drain-timeout"]; ok {
+		drainTimeout, ok := value.(string)
+		if !ok {
+			return params, fmt.Errorf("invalid x-drain-timeout value %v: expected a duration", value)
+		}
+		parsed, err := ParseDurationFlag("x-drain-timeout", drainTimeout)
+		if err != nil {
+			return params, err
+		}
+		params.DrainTimeout = parsed
+	}
+	if value, ok := params.Extensions["x-running-grace"]; ok {
+		runningGrace, ok := value.(string)
+		if !ok {
+			return params, fmt.Errorf("invalid x-running-grace value %v: expected a duration", value)
+		}
+		parsed, err := ParseDurationFlag("x-running-grace", runningGrace)
+		if err != nil {
+			return params, err
+		}
+		params.RunningGrace = parsed
+	}
+	if cmd, ok := params.Extensions["x-pre-stop-command"].(string); ok {
+		params.PreStopCommand = cmd
+	}
+	if cmd, ok := params.Extensions["x-post-stop-host-command"].(string); ok {
+		params.PostStopHostCommand = cmd
+	}
+	if cmd, ok := params.Extensions["x-service-readiness-command"].(string); ok {
+		params.ServiceReadinessCommand = cmd
+	}
+	if cmd, ok := params.Extensions["x-smoke-test-command"].(string); ok {
+		params.SmokeTestCommand = cmd
+	}
+	params.RunToCompletion = runToCompletionService(updateConfig)
+
+	if value, ok := params.Extensions["x-scale-down-order"]; ok {
+		scaleDownOrder, _ := value.(string)
+		if scaleDownOrder != "before" && scaleDownOrder != "after" {
+			return params, fmt.Errorf("invalid x-scale-down-order value %v: expected before or after", value)
+		}
+		params.ScaleDownOrder = scaleDownOrder
+	}
+
+	if value, ok := params.Extensions["x-scale-down-parallelism"]; ok {
+		parallelism, ok := extensionInt(value)
+		if !ok || parallelism < 1 {
+			return params, fmt.Errorf("invalid x-scale-down-parallelism value %v: expected a positive integer", value)
+		}
+		params.ScaleDownParallelism = parallelism
+	}
+
+	if value, ok := params.Extensions["x-pre-stop-order"]; ok {
+		preStopOrder, _ := value.(string)
+		if preStopOrder != "host-first" && preStopOrder != "container-first" {
+			return params, fmt.Errorf("invalid x-pre-stop-order value %v: expected host-first or container-first", value)
+		}
+		params.PreStopOrder = preStopOrder
+	}
+
+	if value, ok := params.Extensions["x-healthcheck-scheme"]; ok {
+		scheme, _ := value.(string)
+		if scheme != "http" && scheme != "https" {
+			return params, fmt.Errorf("invalid x-healthcheck-scheme value %v: expected http or https", value)
+		}
+		params.HealthcheckScheme = scheme
+	}
+
+	maintenanceService, err := maintenanceServiceName(input, params)
+	if err != nil {
+		return params, err
+	}
+	params.MaintenanceService = maintenanceService
+
+	if value, ok := params.Extensions["x-healthcheck-expect-output"]; ok {
+		pattern, _ := value.(string)
+		if pattern == "" {
+			return params, fmt.Errorf("invalid x-healthcheck-expect-output value %v: expected a regular expression", value)
+		}
+		expectOutput, err := regexp.Compile(pattern)
+		if err != nil {
+			return params, fmt.Errorf("invalid x-healthcheck-expect-output value %q: %v", pattern, err)
+		}
+		params.HealthcheckExpectOutput = expectOutput
+	}
+
+	if value, ok := params.Extensions["x-healthcheck-success-threshold"]; ok {
+		threshold, ok := extensionInt(value)
+		if !ok || threshold < 1 {
+			return params, fmt.Errorf("invalid x-healthcheck-success-threshold value %v: expected a positive integer", value)
+		}
+		params.SuccessThreshold = threshold
+	}
+
+	if value, ok := params.Extensions["x-healthcheck-mode"]; ok {
+		mode, _ := value.(string)
+		if mode != "poll" && mode != "events" {
+			return params, fmt.Errorf("invalid x-healthcheck-mode value %v: expected poll or events", value)
+		}
+		params.HealthcheckMode = mode
+	}
+
+	if value, ok := params.Extensions["x-cleanup-run-hooks"]; ok {
+		runHooks, ok := value.(bool)
+		if !ok {
+			return params, fmt.Errorf("invalid x-cleanup-run-hooks value %v: expected true or false", value)
+		}
+		params.CleanupRunHooks = runHooks
+	}
+
+	if value, ok := params.Extensions["x-healthcheck-timeout-action"]; ok {
+		action, _ := value.(string)
+		if action != "terminate" && action != "keep" {
+			return params, fmt.Errorf("invalid x-healthcheck-timeout-action value %v: expected terminate or keep", value)
+		}
+		params.HealthcheckTimeoutAction = action
+	}
+
+	if value, ok := params.Extensions["x-scale-step"]; ok {
+		step, ok := extensionInt(value)
+		if !ok || step < 1 {
+			return params, fmt.Errorf("invalid x-scale-step value %v: expected a positive integer", value)
+		}
+		params.ScaleStep = step
+	}
+
+	// docker only emits a health event when the status changes, so the
+	// healthy readings of a success threshold can only be counted by polling
+	if params.HealthcheckMode == "events" && params.SuccessThreshold > 1 {
+		return params, fmt.Errorf("x-healthcheck-mode events cannot be combined with x-healthcheck-success-threshold: service=%s", service.Name)
+	}
+
+	params.ContainerTimeout = input.ContainerTimeout
+	if params.ContainerTimeout == 0 {
+		if value, ok := params.Extensions["x-container-timeout"].(string); ok {
+			parsed, err := ParseDurationFlag("x-container-timeout", value)
+			if err != nil {
+				return params, err
+			}
+			params.ContainerTimeout = parsed
+		}
+	}
+
+	return params, nil
+}
+
+// logDeployPlan logs the resolved deploy plan for a service as a single
+// structured debug record
+func logDeployPlan(logger *command.ZerologUi, service *types.ServiceConfig, params DeployParams) {
+	logger.StdoutLogger.Debug().
+		Str("service", service.Name).
+		Str("image", service.Image).
+		Int("replicas", params.Replicas).
+		Int("parallelism", params.Parallelism).
+		Str("order", params.Order).
+		Str("delay", params.Delay.String()).
+		Str("monitor", params.Monitor.String()).
+		Str("failure_action", params.FailureAction).
+		Interface("extensions", params.Extensions).
+		Msg("Resolved deploy plan")
+}
+
 // ServiceReplicas returns the number of containers that should be running
 // get the number of containers that should be running
 //
@@ -550,6 +2480,11 @@ func isDatabaseService(serviceImage string, logger *command.ZerologUi) bool {
 //	or the `service.[service-name].scale` field in the compose file
 //	or 1 if none of the above are specified
 func ServiceReplicas(input DeployServiceInput, service *types.ServiceConfig) int {
+	// an intentional zero stops the service instead of falling back to the defaults
+	if input.AllowZero && input.Replicas == 0 {
+		return 0
+	}
+
 	var replicas int
 	if input.Replicas > 0 {
 		replicas = input.Replicas
@@ -566,3 +2501,119 @@ func ServiceReplicas(input DeployServiceInput, service *types.ServiceConfig) int
 	}
 	return replicas
 }
+
+// clampReplicas clamps the replica count into the bounds set by the
+// `input.ReplicasMin` and `input.ReplicasMax` fields, logging when it does
+func clampReplicas(input DeployServiceInput, replicas int) int {
+	clamped := replicas
+	if input.ReplicasMin > 0 && clamped < input.ReplicasMin {
+		clamped = input.ReplicasMin
+	}
+	if input.ReplicasMax > 0 && clamped > input.ReplicasMax {
+		clamped = input.ReplicasMax
+	}
+
+	if clamped != replicas && input.Logger != nil {
+		input.Logger.Info(fmt.Sprintf("Clamping replicas: service=%s, requested=%d, min=%d, max=%d, replicas=%d", input.ServiceName, replicas, input.ReplicasMin, input.ReplicasMax, clamped))
+	}
+
+	return clamped
+}
+
+// ServiceContainerNameTemplate returns the container name template for the service
+// get the template used when renaming the service's containers
+//
+//	from the `service.[service-name].x-container-name-template` field in the compose file if specified
+//	or the `input.ContainerNameTemplate` field
+func ServiceContainerNameTemplate(input DeployServiceInput, service *types.ServiceConfig) (string, error) {
+	value, ok := service.Extensions["x-container-name-template"]
+	if !ok {
+		return input.ContainerNameTemplate, nil
+	}
+
+	nameTemplate, ok := value.(string)
+	if !ok || nameTemplate == "" {
+		return "", fmt.Errorf("invalid x-container-name-template for service %s: expected a non-empty string", service.Name)
+	}
+
+	if _, err := template.New("container-name").Parse(nameTemplate); err != nil {
+		return "", fmt.Errorf("invalid x-container-name-template for service %s: %v", service.Name, err)
+	}
+
+	return nameTemplate, nil
+}
+
+// ServiceStartPeriod returns the healthcheck start period for the service
+// get the start period used when waiting for containers to become healthy
+//
+//	from the `input.HealthStartPeriod` field if specified
+//	or the `service.[service-name].healthcheck.start_period` field in the compose file
+//	or 0 if none of the above are specified
+func ServiceStartPeriod(input DeployServiceInput, service *types.ServiceConfig) time.Duration {
+	if input.HealthStartPeriod > 0 {
+		return input.HealthStartPeriod
+	}
+
+	if service.HealthCheck != nil && service.HealthCheck.StartPeriod != nil {
+		return time.Duration(*service.HealthCheck.StartPeriod)
+	}
+
+	return 0
+}
+
+// ServiceStopGracePeriod returns how long the containers of the service are
+// given to exit once stopped before they are killed
+//
+//	from the `input.StopGracePeriod` field if specified
+//	or the `service.[service-name].stop_grace_period` field in the compose file
+//	or 0, leaving each container its own stop timeout
+func ServiceStopGracePeriod(input DeployServiceInput, service *types.ServiceConfig) time.Duration {
+	if input.StopGracePeriod > 0 {
+		return input.StopGracePeriod
+	}
+
+	if service.StopGracePeriod != nil {
+		return time.Duration(*service.StopGracePeriod)
+	}
+
+	return 0
+}
+
+// warnRestartPolicy warns when a service that is never restarted is kept at
+// a replica count, as a one-shot job is likely missing x-run-to-completion
+// and would otherwise be replaced by containers expected to stay up
+func warnRestartPolicy(input DeployServiceInput, service *types.ServiceConfig, params DeployParams) {
+	if service.Restart != types.RestartPolicyNo || params.RunToCompletion {
+		return
+	}
+
+	input.Warnings.Warn(input.Logger, service.Name, fmt.Sprintf("Service does not restart but is deployed for replicas, set x-run-to-completion to run it as a one-shot job: service=%s, restart=%s", service.Name, service.Restart))
+}
+
+// runToCompletionService returns whether the service is marked with the
+// x-run-to-completion extension
+func runToCompletionService(updateConfig *types.UpdateConfig) bool {
+	if updateConfig == nil || updateConfig.Extensions == nil {
+		return false
+	}
+
+	runToCompletion, ok := updateConfig.Extensions["x-run-to-completion"].(bool)
+	return ok && runToCompletion
+}
+
+// extensionInt returns the integer value of an extension, which may be
+// decoded as either an int or a float64 depending on the source format
+func extensionInt(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case uint64:
+		return int(v), true
+	case float64:
+		if v != float64(int(v)) {
+			return 0, false
+		}
+		return int(v), true
+	}
+	return 0, false
+}
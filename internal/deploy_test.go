@@ -3,12 +3,17 @@ package internal
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"os"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/compose-spec/compose-go/v2/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
 	"github.com/josegonzalez/cli-skeleton/command"
 	"github.com/rs/zerolog"
 )
@@ -93,7 +98,7 @@ func TestDeployServiceReplicaOverride(t *testing.T) {
 				Client:                mockClient,
 				Executor:              mockExecutor,
 				ComposeFile:           "/tmp/docker-compose.yaml",
-				ContainerNameTemplate: "{{.ServiceName}}",
+				ContainerNameTemplate: "{{.ServiceName}}-{{.InstanceID}}",
 				Logger:                logger,
 				Project:               project,
 				ProjectName:           "test",
@@ -287,7 +292,7 @@ func TestIsDatabaseService(t *testing.T) {
 				Image: tt.image,
 			}
 
-			result := isDatabaseService(service, logger)
+			result := isDatabaseService(service.Image, logger)
 
 			if result != tt.expectedResult {
 				t.Errorf("isDatabaseService() = %v, want %v for image %s", result, tt.expectedResult, tt.image)
@@ -758,6 +763,7 @@ func TestServiceReplicas(t *testing.T) {
 
 	tests := []struct {
 		name             string
+		allowZero        bool
 		inputReplicas    int
 		deployReplicas   *int
 		scaleReplicas    *int
@@ -854,6 +860,30 @@ func TestServiceReplicas(t *testing.T) {
 			scaleReplicas:    nil,
 			expectedReplicas: 1,
 		},
+		{
+			name:             "allowed_zero_override_is_kept",
+			allowZero:        true,
+			inputReplicas:    0,
+			deployReplicas:   &threeReplicas,
+			scaleReplicas:    &fiveReplicas,
+			expectedReplicas: 0,
+		},
+		{
+			name:             "allowed_zero_does_not_default_to_one",
+			allowZero:        true,
+			inputReplicas:    0,
+			deployReplicas:   nil,
+			scaleReplicas:    nil,
+			expectedReplicas: 0,
+		},
+		{
+			name:             "allow_zero_with_nonzero_override",
+			allowZero:        true,
+			inputReplicas:    tenReplicas,
+			deployReplicas:   &threeReplicas,
+			scaleReplicas:    &fiveReplicas,
+			expectedReplicas: 10,
+		},
 	}
 
 	for _, tt := range tests {
@@ -871,7 +901,8 @@ func TestServiceReplicas(t *testing.T) {
 			service.Scale = tt.scaleReplicas
 
 			input := DeployServiceInput{
-				Replicas: tt.inputReplicas,
+				AllowZero: tt.allowZero,
+				Replicas:  tt.inputReplicas,
 			}
 
 			result := ServiceReplicas(input, service)
@@ -883,3 +914,2600 @@ func TestServiceReplicas(t *testing.T) {
 		})
 	}
 }
+
+func TestDeployServiceZeroReplicas(t *testing.T) {
+	threeReplicas := 3
+	project := &types.Project{
+		Services: types.Services{
+			"web": types.ServiceConfig{
+				Name:  "web",
+				Image: "example/web:latest",
+				Deploy: &types.DeployConfig{
+					Replicas: &threeReplicas,
+				},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	running := []container.Summary{
+		{ID: "web1_container_id", Created: 100},
+		{ID: "web2_container_id", Created: 200},
+	}
+	terminated := []string{}
+	mockClient := &mockDockerClient{
+		containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+			if !slices.Contains(options.Filters.Get("status"), "running") {
+				return []container.Summary{}, nil
+			}
+			return slices.DeleteFunc(slices.Clone(running), func(c container.Summary) bool {
+				return slices.Contains(terminated, c.ID)
+			}), nil
+		},
+		containerTerminate: func(ctx context.Context, id string, stopTimeout time.Duration) error {
+			terminated = append(terminated, id)
+			return nil
+		},
+	}
+
+	created := false
+	mockExecutor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+		if slices.Contains(input.Args, "create") {
+			created = true
+		}
+		return ExecCommandResponse{ExitCode: 0}, nil
+	}
+
+	result, err := deployServiceWithResult(context.Background(), DeployServiceInput{
+		AllowZero:             true,
+		Client:                mockClient,
+		ComposeFile:           "/tmp/docker-compose.yaml",
+		ContainerNameTemplate: "{{.ServiceName}}",
+		Executor:              mockExecutor,
+		Logger:                logger,
+		Project:               project,
+		ProjectName:           "test",
+		Replicas:              0,
+		ServiceName:           "web",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	slices.Sort(terminated)
+	if !slices.Equal(terminated, []string{"web1_container_id", "web2_container_id"}) {
+		t.Errorf("expected every container to be stopped, got %v", terminated)
+	}
+	if created {
+		t.Error("expected no containers to be created")
+	}
+	if result.Replicas != 0 {
+		t.Errorf("expected 0 running replicas, got %d", result.Replicas)
+	}
+}
+
+func TestResolveDeployParamsReplicasConflict(t *testing.T) {
+	deployReplicas := 3
+	scale := 5
+	service := &types.ServiceConfig{
+		Name:   "web",
+		Scale:  &scale,
+		Deploy: &types.DeployConfig{Replicas: &deployReplicas},
+	}
+
+	t.Run("warns and prefers deploy.replicas", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := &command.ZerologUi{
+			StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+			StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+			OriginalFields:    nil,
+			Ui:                nil,
+			OutputIndentField: false,
+		}
+
+		params, err := resolveDeployParams(context.Background(), DeployServiceInput{Logger: logger, ServiceName: "web"}, service)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if params.Replicas != 3 {
+			t.Errorf("expected deploy.replicas to take precedence, got %d replicas", params.Replicas)
+		}
+		if !strings.Contains(buf.String(), "Conflicting replica counts, using deploy.replicas: service=web, deploy.replicas=3, scale=5") {
+			t.Errorf("expected a conflict warning, output: %s", buf.String())
+		}
+	})
+
+	t.Run("strict fails", func(t *testing.T) {
+		_, err := resolveDeployParams(context.Background(), DeployServiceInput{ServiceName: "web", Strict: true}, service)
+		if err == nil || err.Error() != "conflicting replica counts for service web: deploy.replicas=3, scale=5" {
+			t.Errorf("expected a conflict error, got %v", err)
+		}
+	})
+
+	t.Run("matching values do not conflict", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := &command.ZerologUi{
+			StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+			StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+			OriginalFields:    nil,
+			Ui:                nil,
+			OutputIndentField: false,
+		}
+
+		matchingScale := 3
+		_, err := resolveDeployParams(context.Background(), DeployServiceInput{Logger: logger, ServiceName: "web", Strict: true}, &types.ServiceConfig{
+			Name:   "web",
+			Scale:  &matchingScale,
+			Deploy: &types.DeployConfig{Replicas: &deployReplicas},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if strings.Contains(buf.String(), "Conflicting replica counts") {
+			t.Errorf("expected no conflict warning, output: %s", buf.String())
+		}
+	})
+}
+
+func TestServiceStartPeriod(t *testing.T) {
+	composeStartPeriod := types.Duration(30 * time.Second)
+
+	tests := []struct {
+		name                string
+		inputStartPeriod    time.Duration
+		composeStartPeriod  *types.Duration
+		expectedStartPeriod time.Duration
+	}{
+		{
+			name:                "override_takes_precedence_over_compose",
+			inputStartPeriod:    2 * time.Minute,
+			composeStartPeriod:  &composeStartPeriod,
+			expectedStartPeriod: 2 * time.Minute,
+		},
+		{
+			name:                "no_override_use_compose",
+			inputStartPeriod:    0,
+			composeStartPeriod:  &composeStartPeriod,
+			expectedStartPeriod: 30 * time.Second,
+		},
+		{
+			name:                "override_without_compose",
+			inputStartPeriod:    time.Minute,
+			composeStartPeriod:  nil,
+			expectedStartPeriod: time.Minute,
+		},
+		{
+			name:                "nothing_defined_defaults_to_zero",
+			inputStartPeriod:    0,
+			composeStartPeriod:  nil,
+			expectedStartPeriod: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &types.ServiceConfig{
+				Name: "test-service",
+			}
+			if tt.composeStartPeriod != nil {
+				service.HealthCheck = &types.HealthCheckConfig{
+					StartPeriod: tt.composeStartPeriod,
+				}
+			}
+
+			input := DeployServiceInput{
+				HealthStartPeriod: tt.inputStartPeriod,
+			}
+
+			result := ServiceStartPeriod(input, service)
+			if result != tt.expectedStartPeriod {
+				t.Errorf("ServiceStartPeriod() = %v, want %v", result, tt.expectedStartPeriod)
+			}
+		})
+	}
+}
+
+func TestServiceStopGracePeriod(t *testing.T) {
+	composeStopGracePeriod := types.Duration(time.Minute)
+
+	tests := []struct {
+		name                    string
+		inputStopGracePeriod    time.Duration
+		composeStopGracePeriod  *types.Duration
+		expectedStopGracePeriod time.Duration
+	}{
+		{
+			name:                    "override_takes_precedence_over_compose",
+			inputStopGracePeriod:    2 * time.Second,
+			composeStopGracePeriod:  &composeStopGracePeriod,
+			expectedStopGracePeriod: 2 * time.Second,
+		},
+		{
+			name:                    "no_override_use_compose",
+			inputStopGracePeriod:    0,
+			composeStopGracePeriod:  &composeStopGracePeriod,
+			expectedStopGracePeriod: time.Minute,
+		},
+		{
+			name:                    "nothing_defined_defaults_to_zero",
+			inputStopGracePeriod:    0,
+			composeStopGracePeriod:  nil,
+			expectedStopGracePeriod: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &types.ServiceConfig{
+				Name:            "test-service",
+				StopGracePeriod: tt.composeStopGracePeriod,
+			}
+
+			input := DeployServiceInput{
+				StopGracePeriod: tt.inputStopGracePeriod,
+			}
+
+			result := ServiceStopGracePeriod(input, service)
+			if result != tt.expectedStopGracePeriod {
+				t.Errorf("ServiceStopGracePeriod() = %v, want %v", result, tt.expectedStopGracePeriod)
+			}
+		})
+	}
+}
+
+func TestStopTimeoutSeconds(t *testing.T) {
+	if result := stopTimeoutSeconds(0); result != nil {
+		t.Errorf("expected a zero stop timeout to leave the container's own, got %d", *result)
+	}
+
+	tests := map[time.Duration]int{
+		500 * time.Millisecond:  1,
+		2500 * time.Millisecond: 3,
+		10 * time.Second:        10,
+	}
+	for stopTimeout, expected := range tests {
+		result := stopTimeoutSeconds(stopTimeout)
+		if result == nil || *result != expected {
+			t.Errorf("stopTimeoutSeconds(%v) = %v, want %d", stopTimeout, result, expected)
+		}
+	}
+}
+
+func TestServiceContainerNameTemplate(t *testing.T) {
+	globalTemplate := "{{.ProjectName}}-{{.ServiceName}}-{{.InstanceID}}"
+
+	tests := []struct {
+		name             string
+		service          *types.ServiceConfig
+		expectedTemplate string
+		expectedError    string
+	}{
+		{
+			name:             "service uses the global template",
+			service:          &types.ServiceConfig{Name: "web"},
+			expectedTemplate: globalTemplate,
+		},
+		{
+			name: "service uses its own template",
+			service: &types.ServiceConfig{
+				Name:       "db",
+				Extensions: types.Extensions{"x-container-name-template": "{{.ProjectName}}-{{.ServiceName}}"},
+			},
+			expectedTemplate: "{{.ProjectName}}-{{.ServiceName}}",
+		},
+		{
+			name: "invalid service template",
+			service: &types.ServiceConfig{
+				Name:       "db",
+				Extensions: types.Extensions{"x-container-name-template": "{{.ServiceName"},
+			},
+			expectedError: "invalid x-container-name-template for service db",
+		},
+		{
+			name: "non-string service template",
+			service: &types.ServiceConfig{
+				Name:       "db",
+				Extensions: types.Extensions{"x-container-name-template": 1},
+			},
+			expectedError: "expected a non-empty string",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := DeployServiceInput{
+				ContainerNameTemplate: globalTemplate,
+			}
+
+			result, err := ServiceContainerNameTemplate(input, tt.service)
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result != tt.expectedTemplate {
+				t.Errorf("ServiceContainerNameTemplate() = %q, want %q", result, tt.expectedTemplate)
+			}
+		})
+	}
+}
+
+func TestInvalidExtraHosts(t *testing.T) {
+	tests := []struct {
+		name            string
+		extraHosts      types.HostsList
+		expectedInvalid []string
+	}{
+		{
+			name:            "no_extra_hosts",
+			extraHosts:      nil,
+			expectedInvalid: []string{},
+		},
+		{
+			name: "valid_entries",
+			extraHosts: types.HostsList{
+				"db":       {"10.0.0.5"},
+				"ipv6host": {"::1"},
+				"gateway":  {"host-gateway"},
+			},
+			expectedInvalid: []string{},
+		},
+		{
+			name: "malformed_ip",
+			extraHosts: types.HostsList{
+				"db":    {"10.0.0.5"},
+				"cache": {"not-an-ip"},
+			},
+			expectedInvalid: []string{"cache:not-an-ip"},
+		},
+		{
+			name: "malformed_host",
+			extraHosts: types.HostsList{
+				"bad:host": {"10.0.0.6"},
+			},
+			expectedInvalid: []string{"bad:host:10.0.0.6"},
+		},
+		{
+			name: "multiple_malformed",
+			extraHosts: types.HostsList{
+				"api":   {"999.1.1.1"},
+				"cache": {"10.0.0.7", "nope"},
+			},
+			expectedInvalid: []string{"api:999.1.1.1", "cache:nope"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := invalidExtraHosts(tt.extraHosts)
+			if !slices.Equal(result, tt.expectedInvalid) {
+				t.Errorf("invalidExtraHosts() = %v, want %v", result, tt.expectedInvalid)
+			}
+		})
+	}
+}
+
+func TestDeployProjectSelector(t *testing.T) {
+	mockClient := &mockDockerClient{
+		containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+			return []container.Summary{}, nil
+		},
+	}
+
+	mockExecutor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+		return ExecCommandResponse{ExitCode: 0}, nil
+	}
+
+	project := &types.Project{
+		Services: types.Services{
+			"web": types.ServiceConfig{
+				Name:     "web",
+				Profiles: []string{"web"},
+			},
+			"worker": types.ServiceConfig{
+				Name:     "worker",
+				Profiles: []string{"worker"},
+				Labels:   types.Labels{"batch": "true"},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	err := DeployProject(context.Background(), DeployProjectInput{
+		Client:                mockClient,
+		ComposeFile:           "/tmp/docker-compose.yaml",
+		ContainerNameTemplate: "{{.ServiceName}}",
+		Executor:              mockExecutor,
+		Logger:                logger,
+		Project:               project,
+		ProjectName:           "test",
+		Selector:              "profile in (web,worker) and not label:batch",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	output := buf.String()
+	if !strings.Contains(output, "Deploying service web") {
+		t.Errorf("expected web to be deployed, output: %s", output)
+	}
+	if strings.Contains(output, "Deploying service worker") {
+		t.Errorf("expected worker to be skipped, output: %s", output)
+	}
+}
+
+func TestDeployProjectSelectImage(t *testing.T) {
+	mockClient := &mockDockerClient{
+		containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+			return []container.Summary{}, nil
+		},
+	}
+
+	mockExecutor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+		return ExecCommandResponse{ExitCode: 0}, nil
+	}
+
+	project := &types.Project{
+		Services: types.Services{
+			"worker": types.ServiceConfig{
+				Name:  "worker",
+				Image: "docker.io/library/myapp:2",
+				DependsOn: types.DependsOnConfig{
+					"web": types.ServiceDependency{Condition: types.ServiceConditionStarted},
+				},
+			},
+			"web": types.ServiceConfig{
+				Name:  "web",
+				Image: "myapp:1",
+			},
+			"proxy": types.ServiceConfig{
+				Name:  "proxy",
+				Image: "example/myapp:1",
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	result, err := DeployProjectWithResult(context.Background(), DeployProjectInput{
+		Client:                mockClient,
+		ComposeFile:           "/tmp/docker-compose.yaml",
+		ContainerNameTemplate: "{{.ServiceName}}",
+		Executor:              mockExecutor,
+		Logger:                logger,
+		Project:               project,
+		ProjectName:           "test",
+		SelectImage:           "myapp",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	deployed := []string{}
+	for _, summary := range result.Services {
+		deployed = append(deployed, summary.Service)
+	}
+	if strings.Join(deployed, ",") != "web,worker" {
+		t.Errorf("expected web then worker to be deployed, got %v", deployed)
+	}
+
+	t.Run("invalid image", func(t *testing.T) {
+		err := DeployProject(context.Background(), DeployProjectInput{
+			Client:                mockClient,
+			ComposeFile:           "/tmp/docker-compose.yaml",
+			ContainerNameTemplate: "{{.ServiceName}}",
+			Executor:              mockExecutor,
+			Logger:                logger,
+			Project:               project,
+			ProjectName:           "test",
+			SelectImage:           "Not A Valid Image",
+		})
+		if err == nil || !strings.HasPrefix(err.Error(), "error parsing image Not A Valid Image:") {
+			t.Errorf("expected an image parse error, got %v", err)
+		}
+	})
+}
+
+func TestDeployProjectOnServiceComplete(t *testing.T) {
+	mockClient := &mockDockerClient{
+		containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+			return []container.Summary{}, nil
+		},
+	}
+
+	mockExecutor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+		return ExecCommandResponse{ExitCode: 0}, nil
+	}
+
+	project := &types.Project{
+		Services: types.Services{
+			"web": types.ServiceConfig{
+				Name: "web",
+			},
+			"db": types.ServiceConfig{
+				Name:  "db",
+				Image: "postgres:16",
+				DependsOn: types.DependsOnConfig{
+					"web": types.ServiceDependency{Condition: types.ServiceConditionStarted},
+				},
+			},
+			"worker": types.ServiceConfig{
+				Name: "worker",
+				DependsOn: types.DependsOnConfig{
+					"db": types.ServiceDependency{Condition: types.ServiceConditionStarted},
+				},
+				Deploy: &types.DeployConfig{
+					UpdateConfig: &types.UpdateConfig{
+						Extensions: types.Extensions{"x-healthcheck-success-threshold": "many"},
+					},
+				},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	services := []string{}
+	results := map[string]DeployServiceResult{}
+	errs := map[string]error{}
+	err := DeployProject(context.Background(), DeployProjectInput{
+		Client:                mockClient,
+		ComposeFile:           "/tmp/docker-compose.yaml",
+		ContainerNameTemplate: "{{.ServiceName}}",
+		Executor:              mockExecutor,
+		Logger:                logger,
+		OnServiceComplete: func(service string, result DeployServiceResult, err error) {
+			services = append(services, service)
+			results[service] = result
+			errs[service] = err
+		},
+		Project:       project,
+		ProjectName:   "test",
+		SkipDatabases: true,
+	})
+	if err == nil {
+		t.Fatal("expected the worker deploy to fail")
+	}
+
+	if strings.Join(services, ",") != "web,db,worker" {
+		t.Fatalf("expected the callback to fire for web, db and worker, got %v", services)
+	}
+	if errs["web"] != nil || results["web"].Skipped || results["web"].Duration <= 0 {
+		t.Errorf("expected web to be deployed, got result=%+v err=%v", results["web"], errs["web"])
+	}
+	if errs["db"] != nil || !results["db"].Skipped {
+		t.Errorf("expected db to be skipped, got result=%+v err=%v", results["db"], errs["db"])
+	}
+	if errs["worker"] == nil || !strings.Contains(errs["worker"].Error(), "invalid x-healthcheck-success-threshold value") {
+		t.Errorf("expected worker to fail, got result=%+v err=%v", results["worker"], errs["worker"])
+	}
+}
+
+func TestDeployProjectReusesClient(t *testing.T) {
+	containerListCalls := 0
+	mockClient := &mockDockerClient{
+		containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+			containerListCalls++
+			return []container.Summary{}, nil
+		},
+	}
+
+	mockExecutor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+		return ExecCommandResponse{ExitCode: 0}, nil
+	}
+
+	project := &types.Project{
+		Services: types.Services{
+			"web": types.ServiceConfig{Name: "web"},
+			"worker": types.ServiceConfig{
+				Name: "worker",
+				DependsOn: types.DependsOnConfig{
+					"web": types.ServiceDependency{Condition: types.ServiceConditionStarted},
+				},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	// every Docker call goes through the client handed to the deploy, so a
+	// long-running host only has the one client it created to close
+	created := dockerClientsCreated.Load()
+	err := DeployProject(context.Background(), DeployProjectInput{
+		Client:                mockClient,
+		ComposeFile:           "/tmp/docker-compose.yaml",
+		ContainerNameTemplate: "{{.ServiceName}}",
+		Executor:              mockExecutor,
+		Logger:                logger,
+		Project:               project,
+		ProjectName:           "test",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := dockerClientsCreated.Load(); got != created {
+		t.Errorf("expected no Docker clients to be created during the deploy, got %d", got-created)
+	}
+	if containerListCalls == 0 {
+		t.Error("expected the deploy to use the client it was handed")
+	}
+}
+
+func TestLogDeployPlan(t *testing.T) {
+	parallelism := uint64(2)
+	service := &types.ServiceConfig{
+		Name:  "web",
+		Image: "nginx:1.27",
+		Deploy: &types.DeployConfig{
+			UpdateConfig: &types.UpdateConfig{
+				Parallelism:   &parallelism,
+				Delay:         types.Duration(15 * time.Second),
+				FailureAction: "pause",
+				Monitor:       types.Duration(30 * time.Second),
+				Order:         "start-first",
+				Extensions: types.Extensions{
+					"x-container-timeout": "2m",
+				},
+			},
+		},
+	}
+
+	params, err := resolveDeployParams(context.Background(), DeployServiceInput{Replicas: 3}, service)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if params.ContainerTimeout != 2*time.Minute {
+		t.Errorf("expected container timeout of 2m, got %v", params.ContainerTimeout)
+	}
+
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger: zerolog.New(&buf).Level(zerolog.DebugLevel),
+		StdoutLogger: zerolog.New(&buf).Level(zerolog.DebugLevel),
+	}
+	logDeployPlan(logger, service, params)
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("expected a single JSON record, got %q: %v", buf.String(), err)
+	}
+
+	expected := map[string]interface{}{
+		"level":          "debug",
+		"service":        "web",
+		"image":          "nginx:1.27",
+		"replicas":       float64(3),
+		"parallelism":    float64(2),
+		"order":          "start-first",
+		"delay":          "15s",
+		"monitor":        "30s",
+		"failure_action": "pause",
+	}
+	for key, value := range expected {
+		if record[key] != value {
+			t.Errorf("expected %s=%v, got %v", key, value, record[key])
+		}
+	}
+
+	extensions, ok := record["extensions"].(map[string]interface{})
+	if !ok || extensions["x-container-timeout"] != "2m" {
+		t.Errorf("expected extensions to contain x-container-timeout=2m, got %v", record["extensions"])
+	}
+
+	buf.Reset()
+	logger.StdoutLogger = logger.StdoutLogger.Level(zerolog.InfoLevel)
+	logDeployPlan(logger, service, params)
+	if buf.Len() != 0 {
+		t.Errorf("expected no output at info level, got %q", buf.String())
+	}
+}
+
+func TestDeployServiceCommandOverride(t *testing.T) {
+	created := false
+	started := []string{}
+	mockClient := &mockDockerClient{
+		containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+			if !created || slices.Contains(options.Filters.Get("status"), "running") {
+				return []container.Summary{}, nil
+			}
+			return []container.Summary{
+				{ID: "new1_container_id", Created: 100},
+			}, nil
+		},
+		containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+			t.Errorf("expected healthcheck to be skipped, but container %s was inspected", id)
+			return container.InspectResponse{}, nil
+		},
+		containerStart: func(ctx context.Context, id string, options container.StartOptions) error {
+			started = append(started, id)
+			return nil
+		},
+	}
+
+	var overlay map[string]map[string]map[string]interface{}
+	mockExecutor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+		if slices.Contains(input.Args, "create") {
+			created = true
+			index := slices.Index(input.Args, "/tmp/docker-compose.yaml")
+			if index == -1 || len(input.Args) < index+3 || input.Args[index+1] != "-f" {
+				t.Fatalf("expected an overlay file after the compose file, got %v", input.Args)
+			}
+
+			contents, err := os.ReadFile(input.Args[index+2])
+			if err != nil {
+				t.Fatalf("unexpected error reading overlay: %v", err)
+			}
+			if err := json.Unmarshal(contents, &overlay); err != nil {
+				t.Fatalf("unexpected error parsing overlay: %v", err)
+			}
+		}
+		return ExecCommandResponse{ExitCode: 0}, nil
+	}
+
+	project := &types.Project{
+		Services: types.Services{
+			"web": types.ServiceConfig{
+				Name: "web",
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	err := DeployService(context.Background(), DeployServiceInput{
+		Client:                mockClient,
+		Command:               `-c "sleep infinity"`,
+		ComposeFile:           "/tmp/docker-compose.yaml",
+		ContainerNameTemplate: "{{.ServiceName}}",
+		Entrypoint:            "/bin/sh",
+		Executor:              mockExecutor,
+		Logger:                logger,
+		Project:               project,
+		ProjectName:           "test",
+		ServiceName:           "web",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	service := overlay["services"]["web"]
+	if service["entrypoint"] != "/bin/sh" {
+		t.Errorf("expected entrypoint override /bin/sh, got %v", service["entrypoint"])
+	}
+	if service["command"] != `-c "sleep infinity"` {
+		t.Errorf("expected command override, got %v", service["command"])
+	}
+	if len(started) != 1 {
+		t.Errorf("expected 1 container to be started, got %v", started)
+	}
+	if !strings.Contains(buf.String(), "Skipping healthchecks") {
+		t.Errorf("expected healthcheck skip to be logged, got %s", buf.String())
+	}
+}
+
+func TestDeployServiceLeftoverContainers(t *testing.T) {
+	created := false
+	removed := []string{}
+	started := []string{}
+	mockClient := &mockDockerClient{
+		containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+			if slices.Contains(options.Filters.Get("status"), "running") {
+				return []container.Summary{}, nil
+			}
+
+			containers := []container.Summary{}
+			for _, c := range []container.Summary{
+				{ID: "exited1_container_id", Created: 50, State: container.StateExited},
+				{ID: "created1_container_id", Created: 60, State: container.StateCreated},
+			} {
+				if !slices.Contains(removed, c.ID) {
+					containers = append(containers, c)
+				}
+			}
+			if created {
+				containers = append(containers, container.Summary{ID: "new1_container_id", Created: 100, State: container.StateCreated})
+			}
+			return containers, nil
+		},
+		containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+			return container.InspectResponse{
+				ContainerJSONBase: &container.ContainerJSONBase{
+					State: &container.State{Running: true},
+				},
+			}, nil
+		},
+		containerRemove: func(ctx context.Context, id string, options container.RemoveOptions) error {
+			removed = append(removed, id)
+			return nil
+		},
+		containerStart: func(ctx context.Context, id string, options container.StartOptions) error {
+			started = append(started, id)
+			return nil
+		},
+	}
+
+	mockExecutor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+		if slices.Contains(input.Args, "create") {
+			if len(removed) != 2 {
+				t.Errorf("expected leftover containers to be removed before create, removed %v", removed)
+			}
+			created = true
+		}
+		return ExecCommandResponse{ExitCode: 0}, nil
+	}
+
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	err := DeployService(context.Background(), DeployServiceInput{
+		Client:                mockClient,
+		ComposeFile:           "/tmp/docker-compose.yaml",
+		ContainerNameTemplate: "{{.ServiceName}}",
+		Executor:              mockExecutor,
+		Logger:                logger,
+		Project: &types.Project{
+			Services: types.Services{
+				"web": types.ServiceConfig{
+					Name: "web",
+					Deploy: &types.DeployConfig{
+						UpdateConfig: &types.UpdateConfig{
+							Monitor: types.Duration(time.Millisecond),
+						},
+					},
+				},
+			},
+		},
+		ProjectName: "test",
+		ServiceName: "web",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if strings.Join(removed, ",") != "exited1_container_id,created1_container_id" {
+		t.Errorf("expected leftover containers to be removed, got %v", removed)
+	}
+	if strings.Join(started, ",") != "new1_container_id" {
+		t.Errorf("expected only the new container to be started, got %v", started)
+	}
+}
+
+func TestDeployServiceScaleDownOrder(t *testing.T) {
+	tests := []struct {
+		name           string
+		scaleDownOrder string
+		firstEvent     string
+	}{
+		{name: "before", scaleDownOrder: "before", firstEvent: "terminate old1_container_id"},
+		{name: "after", scaleDownOrder: "after", firstEvent: "up"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := []string{}
+			running := []container.Summary{
+				{ID: "old1_container_id", Created: 50},
+				{ID: "old2_container_id", Created: 60},
+			}
+			created := int64(100)
+
+			mockClient := &mockDockerClient{
+				containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+					if !slices.Contains(options.Filters.Get("status"), "running") && len(options.Filters.Get("status")) > 0 {
+						return []container.Summary{}, nil
+					}
+					return slices.Clone(running), nil
+				},
+				containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+					return container.InspectResponse{
+						ContainerJSONBase: &container.ContainerJSONBase{
+							State: &container.State{Running: true},
+						},
+					}, nil
+				},
+				containerTerminate: func(ctx context.Context, id string, stopTimeout time.Duration) error {
+					events = append(events, fmt.Sprintf("terminate %s", id))
+					running = slices.DeleteFunc(running, func(c container.Summary) bool {
+						return c.ID == id
+					})
+					return nil
+				},
+			}
+
+			mockExecutor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+				if !slices.Contains(input.Args, "up") {
+					return ExecCommandResponse{ExitCode: 0}, nil
+				}
+
+				events = append(events, "up")
+				scale := 0
+				for i, arg := range input.Args {
+					if arg == "--scale" {
+						_, _ = fmt.Sscanf(input.Args[i+1], "web=%d", &scale)
+					}
+				}
+				for len(running) < scale {
+					created++
+					running = append(running, container.Summary{ID: fmt.Sprintf("new%d_container_id", created), Created: created})
+				}
+				return ExecCommandResponse{ExitCode: 0}, nil
+			}
+
+			var buf bytes.Buffer
+			logger := &command.ZerologUi{
+				StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+				StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+				OriginalFields:    nil,
+				Ui:                nil,
+				OutputIndentField: false,
+			}
+
+			replicas := 1
+			err := DeployService(context.Background(), DeployServiceInput{
+				Client:                mockClient,
+				ComposeFile:           "/tmp/docker-compose.yaml",
+				ContainerNameTemplate: "{{.ServiceName}}",
+				Executor:              mockExecutor,
+				Logger:                logger,
+				Project: &types.Project{
+					Services: types.Services{
+						"web": types.ServiceConfig{
+							Name: "web",
+							Deploy: &types.DeployConfig{
+								Replicas: &replicas,
+								UpdateConfig: &types.UpdateConfig{
+									Extensions: types.Extensions{"x-scale-down-order": tt.scaleDownOrder},
+									Monitor:    types.Duration(time.Millisecond),
+									Order:      "start-first",
+								},
+							},
+						},
+					},
+				},
+				ProjectName: "test",
+				ServiceName: "web",
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(events) == 0 || events[0] != tt.firstEvent {
+				t.Errorf("expected the first event to be %q, got %v", tt.firstEvent, events)
+			}
+			if len(running) != 1 || !strings.HasPrefix(running[0].ID, "new") {
+				t.Errorf("expected a single new container to be left running, got %v", running)
+			}
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		service := types.ServiceConfig{
+			Name: "web",
+			Deploy: &types.DeployConfig{
+				UpdateConfig: &types.UpdateConfig{
+					Extensions: types.Extensions{"x-scale-down-order": "sideways"},
+				},
+			},
+		}
+		_, err := resolveDeployParams(context.Background(), DeployServiceInput{ServiceName: "web"}, &service)
+		if err == nil || err.Error() != "invalid x-scale-down-order value sideways: expected before or after" {
+			t.Errorf("expected an invalid order error, got %v", err)
+		}
+	})
+
+	t.Run("scale down parallelism", func(t *testing.T) {
+		parallelism := uint64(4)
+		service := types.ServiceConfig{
+			Name: "web",
+			Deploy: &types.DeployConfig{
+				UpdateConfig: &types.UpdateConfig{
+					Parallelism: &parallelism,
+				},
+			},
+		}
+		params, err := resolveDeployParams(context.Background(), DeployServiceInput{ServiceName: "web"}, &service)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if params.ScaleDownParallelism != 1 {
+			t.Errorf("expected scale down to stop one container at a time regardless of the update parallelism, got %d", params.ScaleDownParallelism)
+		}
+
+		service.Deploy.UpdateConfig.Extensions = types.Extensions{"x-scale-down-parallelism": 3}
+		params, err = resolveDeployParams(context.Background(), DeployServiceInput{ServiceName: "web"}, &service)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if params.ScaleDownParallelism != 3 {
+			t.Errorf("expected a scale down parallelism of 3, got %d", params.ScaleDownParallelism)
+		}
+
+		service.Deploy.UpdateConfig.Extensions = types.Extensions{"x-scale-down-parallelism": 0}
+		_, err = resolveDeployParams(context.Background(), DeployServiceInput{ServiceName: "web"}, &service)
+		if err == nil || err.Error() != "invalid x-scale-down-parallelism value 0: expected a positive integer" {
+			t.Errorf("expected an invalid parallelism error, got %v", err)
+		}
+	})
+}
+
+func TestDeployProjectContinueOnError(t *testing.T) {
+	// db fails to resolve its deploy settings, so it fails before touching any container
+	project := &types.Project{
+		Services: types.Services{
+			"db": types.ServiceConfig{
+				Name: "db",
+				Deploy: &types.DeployConfig{
+					UpdateConfig: &types.UpdateConfig{
+						Extensions: types.Extensions{"x-healthcheck-success-threshold": "many"},
+					},
+				},
+			},
+			"api": types.ServiceConfig{
+				Name: "api",
+				DependsOn: types.DependsOnConfig{
+					"db": types.ServiceDependency{Condition: types.ServiceConditionHealthy},
+				},
+			},
+			"worker": types.ServiceConfig{
+				Name: "worker",
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	mockExecutor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+		return ExecCommandResponse{ExitCode: 0}, nil
+	}
+
+	deploy := func(ignoreDependencyFailures bool) (DeployProjectResult, []string, error) {
+		deployed := []string{}
+		result, err := DeployProjectWithResult(context.Background(), DeployProjectInput{
+			Client: &mockDockerClient{
+				containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+					return []container.Summary{}, nil
+				},
+			},
+			ComposeFile:              "/tmp/docker-compose.yaml",
+			ContainerNameTemplate:    "{{.ServiceName}}",
+			ContinueOnError:          true,
+			Executor:                 mockExecutor,
+			IgnoreDependencyFailures: ignoreDependencyFailures,
+			Logger:                   logger,
+			OnServiceComplete: func(service string, result DeployServiceResult, err error) {
+				if err == nil {
+					deployed = append(deployed, service)
+				}
+			},
+			Project:     project,
+			ProjectName: "test",
+		})
+		return result, deployed, err
+	}
+
+	outcomes := func(result DeployProjectResult) map[string]ServiceSummary {
+		summaries := map[string]ServiceSummary{}
+		for _, summary := range result.Services {
+			summaries[summary.Service] = summary
+		}
+		return summaries
+	}
+
+	t.Run("dependents of a failed service are skipped", func(t *testing.T) {
+		result, deployed, err := deploy(false)
+		if err == nil || !strings.Contains(err.Error(), "error deploying 1 services: db: invalid x-healthcheck-success-threshold value") {
+			t.Fatalf("expected the db failure to be reported, got %v", err)
+		}
+
+		slices.Sort(deployed)
+		if !slices.Equal(deployed, []string{"worker"}) {
+			t.Errorf("expected only the unrelated worker to be deployed, got %v", deployed)
+		}
+		summaries := outcomes(result)
+		if summaries["db"].Outcome != OutcomeFailed {
+			t.Errorf("expected db to have failed, got %+v", summaries["db"])
+		}
+		if summaries["api"].Outcome != OutcomeSkipped || !slices.Equal(summaries["api"].FailedDependencies, []string{"db"}) {
+			t.Errorf("expected api to be skipped for its failed db dependency, got %+v", summaries["api"])
+		}
+	})
+
+	t.Run("dependents deploy despite a failed dependency", func(t *testing.T) {
+		result, deployed, err := deploy(true)
+		if err == nil || !strings.Contains(err.Error(), "db: invalid x-healthcheck-success-threshold value") {
+			t.Fatalf("expected the db failure to still be reported, got %v", err)
+		}
+
+		slices.Sort(deployed)
+		if !slices.Equal(deployed, []string{"api", "worker"}) {
+			t.Errorf("expected api to be deployed despite db failing, got %v", deployed)
+		}
+		summaries := outcomes(result)
+		if summaries["api"].Outcome != OutcomeOK || !slices.Equal(summaries["api"].FailedDependencies, []string{"db"}) {
+			t.Errorf("expected api to be deployed in a degraded state, got %+v", summaries["api"])
+		}
+		if !strings.Contains(result.SummaryTable(), "ok (degraded)") {
+			t.Errorf("expected the summary to show the degraded state, got:\n%s", result.SummaryTable())
+		}
+	})
+
+	t.Run("ignoring dependency failures requires continuing on error", func(t *testing.T) {
+		err := DeployProject(context.Background(), DeployProjectInput{
+			Client:                   &mockDockerClient{},
+			ComposeFile:              "/tmp/docker-compose.yaml",
+			IgnoreDependencyFailures: true,
+			Logger:                   logger,
+			Project:                  project,
+			ProjectName:              "test",
+		})
+		if err == nil || err.Error() != "ignoring dependency failures requires continuing on error" {
+			t.Errorf("expected a missing continue on error error, got %v", err)
+		}
+	})
+}
+
+func TestResolveDeployParamsHealthcheckScheme(t *testing.T) {
+	tests := []struct {
+		name          string
+		extensions    types.Extensions
+		expected      string
+		expectedError string
+	}{
+		{
+			name:     "defaults to http",
+			expected: "http",
+		},
+		{
+			name:       "https",
+			extensions: types.Extensions{"x-healthcheck-scheme": "https"},
+			expected:   "https",
+		},
+		{
+			name:          "invalid",
+			extensions:    types.Extensions{"x-healthcheck-scheme": "ftp"},
+			expectedError: "invalid x-healthcheck-scheme value ftp: expected http or https",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := types.ServiceConfig{
+				Name: "web",
+				Deploy: &types.DeployConfig{
+					UpdateConfig: &types.UpdateConfig{Extensions: tt.extensions},
+				},
+			}
+			params, err := resolveDeployParams(context.Background(), DeployServiceInput{ServiceName: "web"}, &service)
+			if tt.expectedError != "" {
+				if err == nil || err.Error() != tt.expectedError {
+					t.Errorf("expected error %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if params.HealthcheckScheme != tt.expected {
+				t.Errorf("expected scheme %q, got %q", tt.expected, params.HealthcheckScheme)
+			}
+		})
+	}
+}
+
+func TestResolveDeployParamsHealthcheckExpectOutput(t *testing.T) {
+	tests := []struct {
+		name          string
+		extensions    types.Extensions
+		expected      string
+		expectedError string
+	}{
+		{
+			name: "unset",
+		},
+		{
+			name:       "pattern",
+			extensions: types.Extensions{"x-healthcheck-expect-output": "^OK$"},
+			expected:   "^OK$",
+		},
+		{
+			name:          "invalid",
+			extensions:    types.Extensions{"x-healthcheck-expect-output": "(ok"},
+			expectedError: "invalid x-healthcheck-expect-output value \"(ok\": error parsing regexp: missing closing ): `(ok`",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := types.ServiceConfig{
+				Name: "web",
+				Deploy: &types.DeployConfig{
+					UpdateConfig: &types.UpdateConfig{Extensions: tt.extensions},
+				},
+			}
+			params, err := resolveDeployParams(context.Background(), DeployServiceInput{ServiceName: "web"}, &service)
+			if tt.expectedError != "" {
+				if err == nil || err.Error() != tt.expectedError {
+					t.Errorf("expected error %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			pattern := ""
+			if params.HealthcheckExpectOutput != nil {
+				pattern = params.HealthcheckExpectOutput.String()
+			}
+			if pattern != tt.expected {
+				t.Errorf("expected pattern %q, got %q", tt.expected, pattern)
+			}
+		})
+	}
+}
+
+func TestResolveDeployParamsHealthcheckMode(t *testing.T) {
+	tests := []struct {
+		name          string
+		extensions    types.Extensions
+		expected      string
+		expectedError string
+	}{
+		{
+			name:     "defaults to poll",
+			expected: "poll",
+		},
+		{
+			name:       "events",
+			extensions: types.Extensions{"x-healthcheck-mode": "events"},
+			expected:   "events",
+		},
+		{
+			name:          "invalid",
+			extensions:    types.Extensions{"x-healthcheck-mode": "watch"},
+			expectedError: "invalid x-healthcheck-mode value watch: expected poll or events",
+		},
+		{
+			name:          "events with a success threshold",
+			extensions:    types.Extensions{"x-healthcheck-mode": "events", "x-healthcheck-success-threshold": 3},
+			expectedError: "x-healthcheck-mode events cannot be combined with x-healthcheck-success-threshold: service=web",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := types.ServiceConfig{
+				Name: "web",
+				Deploy: &types.DeployConfig{
+					UpdateConfig: &types.UpdateConfig{Extensions: tt.extensions},
+				},
+			}
+			params, err := resolveDeployParams(context.Background(), DeployServiceInput{ServiceName: "web"}, &service)
+			if tt.expectedError != "" {
+				if err == nil || err.Error() != tt.expectedError {
+					t.Errorf("expected error %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if params.HealthcheckMode != tt.expected {
+				t.Errorf("expected healthcheck mode %q, got %q", tt.expected, params.HealthcheckMode)
+			}
+		})
+	}
+}
+
+func TestResolveDeployParamsPreStopOrder(t *testing.T) {
+	tests := []struct {
+		name          string
+		extensions    types.Extensions
+		expected      string
+		expectedError string
+	}{
+		{
+			name:     "defaults to host-first",
+			expected: "host-first",
+		},
+		{
+			name:       "container-first",
+			extensions: types.Extensions{"x-pre-stop-command": "drain", "x-pre-stop-order": "container-first"},
+			expected:   "container-first",
+		},
+		{
+			name:          "invalid",
+			extensions:    types.Extensions{"x-pre-stop-order": "parallel"},
+			expectedError: "invalid x-pre-stop-order value parallel: expected host-first or container-first",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := types.ServiceConfig{
+				Name: "web",
+				Deploy: &types.DeployConfig{
+					UpdateConfig: &types.UpdateConfig{Extensions: tt.extensions},
+				},
+			}
+			params, err := resolveDeployParams(context.Background(), DeployServiceInput{ServiceName: "web"}, &service)
+			if tt.expectedError != "" {
+				if err == nil || err.Error() != tt.expectedError {
+					t.Errorf("expected error %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if params.PreStopOrder != tt.expected {
+				t.Errorf("expected order %q, got %q", tt.expected, params.PreStopOrder)
+			}
+		})
+	}
+}
+
+func TestDeployServiceIndex(t *testing.T) {
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	replicas := 3
+	project := &types.Project{
+		Services: types.Services{
+			"web": types.ServiceConfig{
+				Name: "web",
+				Deploy: &types.DeployConfig{
+					Replicas: &replicas,
+					UpdateConfig: &types.UpdateConfig{
+						Monitor: types.Duration(time.Millisecond),
+						Order:   "start-first",
+					},
+				},
+			},
+		},
+	}
+
+	newContainers := func() []container.Summary {
+		return []container.Summary{
+			{ID: "old1_container_id", Created: 50, Names: []string{"/test-web-1"}, State: container.StateRunning},
+			{ID: "old2_container_id", Created: 60, Names: []string{"/test-web-2"}, State: container.StateRunning},
+			{ID: "old3_container_id", Created: 70, Names: []string{"/test-web-3"}, State: container.StateRunning},
+		}
+	}
+
+	t.Run("only the indexed container is replaced", func(t *testing.T) {
+		containers := newContainers()
+		terminated := []string{}
+		renamed := map[string]string{}
+		mockClient := &mockDockerClient{
+			containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+				return slices.Clone(containers), nil
+			},
+			containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+				return container.InspectResponse{
+					ContainerJSONBase: &container.ContainerJSONBase{
+						State: &container.State{Running: true},
+					},
+				}, nil
+			},
+			containerTerminate: func(ctx context.Context, id string, stopTimeout time.Duration) error {
+				terminated = append(terminated, id)
+				containers = slices.DeleteFunc(containers, func(c container.Summary) bool {
+					return c.ID == id
+				})
+				return nil
+			},
+			containerRename: func(ctx context.Context, id string, newName string) error {
+				renamed[id] = newName
+				return nil
+			},
+		}
+
+		scales := []string{}
+		mockExecutor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+			if index := slices.Index(input.Args, "--scale"); index != -1 {
+				scales = append(scales, input.Args[index+1])
+				containers = append(containers, container.Summary{ID: "new_container_id", Created: 100, State: container.StateRunning})
+			}
+			return ExecCommandResponse{ExitCode: 0}, nil
+		}
+
+		err := DeployService(context.Background(), DeployServiceInput{
+			Client:                mockClient,
+			ComposeFile:           "/tmp/docker-compose.yaml",
+			ContainerNameTemplate: "{{.ProjectName}}-{{.ServiceName}}-{{.InstanceID}}",
+			Executor:              mockExecutor,
+			HealthStartPeriod:     time.Second,
+			Index:                 2,
+			Logger:                logger,
+			Project:               project,
+			ProjectName:           "test",
+			ServiceName:           "web",
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !slices.Equal(scales, []string{"web=4"}) {
+			t.Errorf("expected a single replacement to be started, got scales %v", scales)
+		}
+		if !slices.Equal(terminated, []string{"old2_container_id"}) {
+			t.Errorf("expected only the indexed container to be replaced, got %v", terminated)
+		}
+		if len(renamed) != 1 || renamed["new_container_id"] != "test-web-2" {
+			t.Errorf("expected only the replacement to take the indexed name, got %v", renamed)
+		}
+	})
+
+	t.Run("unknown index", func(t *testing.T) {
+		containers := newContainers()
+		mockClient := &mockDockerClient{
+			containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+				return slices.Clone(containers), nil
+			},
+		}
+		mockExecutor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+			t.Errorf("expected no compose command to run, got %v", input.Args)
+			return ExecCommandResponse{ExitCode: 0}, nil
+		}
+
+		err := DeployService(context.Background(), DeployServiceInput{
+			Client:                mockClient,
+			ComposeFile:           "/tmp/docker-compose.yaml",
+			ContainerNameTemplate: "{{.ProjectName}}-{{.ServiceName}}-{{.InstanceID}}",
+			Executor:              mockExecutor,
+			Index:                 5,
+			Logger:                logger,
+			Project:               project,
+			ProjectName:           "test",
+			ServiceName:           "web",
+		})
+		if err == nil || err.Error() != "no running container named test-web-5 for instance 5 of service web" {
+			t.Errorf("expected an unknown instance error, got %v", err)
+		}
+	})
+}
+
+func TestDeployServiceCanary(t *testing.T) {
+	type canaryState struct {
+		containers []container.Summary
+		createArgs []string
+		events     []string
+	}
+
+	newMocks := func(t *testing.T, state *canaryState) (*mockDockerClient, CommandExecutor) {
+		created := int64(100)
+		mockClient := &mockDockerClient{
+			containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+				statuses := options.Filters.Get("status")
+				return slices.DeleteFunc(slices.Clone(state.containers), func(c container.Summary) bool {
+					return len(statuses) > 0 && !slices.Contains(statuses, string(c.State))
+				}), nil
+			},
+			containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+				return container.InspectResponse{
+					ContainerJSONBase: &container.ContainerJSONBase{
+						State: &container.State{Running: true},
+					},
+				}, nil
+			},
+			containerStart: func(ctx context.Context, id string, options container.StartOptions) error {
+				for i := range state.containers {
+					if state.containers[i].ID == id {
+						state.containers[i].State = container.StateRunning
+					}
+				}
+				return nil
+			},
+			containerTerminate: func(ctx context.Context, id string, stopTimeout time.Duration) error {
+				state.events = append(state.events, fmt.Sprintf("terminate %s", id))
+				state.containers = slices.DeleteFunc(state.containers, func(c container.Summary) bool {
+					return c.ID == id
+				})
+				return nil
+			},
+		}
+
+		mockExecutor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+			subcommand := ""
+			for _, arg := range []string{"create", "up"} {
+				if slices.Contains(input.Args, arg) {
+					subcommand = arg
+				}
+			}
+			if subcommand == "" {
+				return ExecCommandResponse{ExitCode: 0}, nil
+			}
+			state.events = append(state.events, subcommand)
+
+			labels := map[string]string{}
+			if index := slices.Index(input.Args, "/tmp/docker-compose.yaml"); index != -1 && input.Args[index+1] == "-f" {
+				contents, err := os.ReadFile(input.Args[index+2])
+				if err != nil {
+					t.Fatalf("unexpected error reading overlay: %v", err)
+				}
+				var overlay struct {
+					Services map[string]struct {
+						Labels map[string]string `json:"labels"`
+					} `json:"services"`
+				}
+				if err := json.Unmarshal(contents, &overlay); err != nil {
+					t.Fatalf("unexpected error parsing overlay: %v", err)
+				}
+				labels = overlay.Services["web"].Labels
+			}
+
+			scale := 0
+			_, _ = fmt.Sscanf(input.Args[slices.Index(input.Args, "--scale")+1], "web=%d", &scale)
+			if subcommand == "create" {
+				state.createArgs = input.Args
+			}
+			for len(state.containers) < scale {
+				created++
+				newState := container.StateCreated
+				if subcommand == "up" {
+					newState = container.StateRunning
+				}
+				state.containers = append(state.containers, container.Summary{
+					ID:      fmt.Sprintf("new%d_container_id", created),
+					Created: created,
+					Labels:  labels,
+					State:   newState,
+				})
+			}
+			return ExecCommandResponse{ExitCode: 0}, nil
+		}
+
+		return mockClient, mockExecutor
+	}
+
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	replicas := 2
+	project := &types.Project{
+		Services: types.Services{
+			"web": types.ServiceConfig{
+				Name: "web",
+				Deploy: &types.DeployConfig{
+					Replicas: &replicas,
+					UpdateConfig: &types.UpdateConfig{
+						Monitor: types.Duration(time.Millisecond),
+						Order:   "start-first",
+					},
+				},
+			},
+		},
+	}
+
+	deploy := func(client DockerClientInterface, executor CommandExecutor, canary int, promote bool) error {
+		return DeployService(context.Background(), DeployServiceInput{
+			Canary:                canary,
+			Client:                client,
+			ComposeFile:           "/tmp/docker-compose.yaml",
+			ContainerNameTemplate: "{{.ServiceName}}-{{.InstanceID}}",
+			Executor:              executor,
+			HealthStartPeriod:     time.Second,
+			Logger:                logger,
+			Project:               project,
+			ProjectName:           "test",
+			Promote:               promote,
+			ServiceName:           "web",
+		})
+	}
+
+	t.Run("canary is deployed alongside the existing containers", func(t *testing.T) {
+		state := &canaryState{containers: []container.Summary{
+			{ID: "old1_container_id", Created: 50, State: container.StateRunning},
+			{ID: "old2_container_id", Created: 60, State: container.StateRunning},
+		}}
+		client, executor := newMocks(t, state)
+
+		if err := deploy(client, executor, 1, false); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !slices.Equal(state.events, []string{"create"}) {
+			t.Errorf("expected only the canary to be created, got events %v", state.events)
+		}
+		if !slices.Contains(state.createArgs, "--no-recreate") || !slices.Contains(state.createArgs, "web=3") {
+			t.Errorf("expected a single canary to be created without recreating the existing containers, got %v", state.createArgs)
+		}
+		if len(state.containers) != 3 {
+			t.Fatalf("expected the existing containers and the canary to be running, got %v", state.containers)
+		}
+		for _, c := range state.containers {
+			isCanary := c.Labels[CanaryLabel] == "true"
+			if isCanary != strings.HasPrefix(c.ID, "new") || c.State != container.StateRunning {
+				t.Errorf("expected only the new container to be a running canary, got %+v", c)
+			}
+		}
+	})
+
+	t.Run("promote replaces the rest of the service", func(t *testing.T) {
+		state := &canaryState{containers: []container.Summary{
+			{ID: "old1_container_id", Created: 50, State: container.StateRunning},
+			{ID: "old2_container_id", Created: 60, State: container.StateRunning},
+			{ID: "canary_container_id", Created: 70, State: container.StateRunning, Labels: map[string]string{CanaryLabel: "true"}},
+		}}
+		client, executor := newMocks(t, state)
+
+		if err := deploy(client, executor, 0, true); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(state.events) == 0 || state.events[0] != "terminate old1_container_id" {
+			t.Errorf("expected the oldest container to be removed first, got events %v", state.events)
+		}
+		if len(state.containers) != 2 {
+			t.Fatalf("expected the desired 2 replicas to be running, got %v", state.containers)
+		}
+		for _, c := range state.containers {
+			if !strings.HasPrefix(c.ID, "new") || c.Labels[CanaryLabel] != "" {
+				t.Errorf("expected only new non-canary containers to be left running, got %+v", c)
+			}
+		}
+	})
+
+	t.Run("promote without a canary", func(t *testing.T) {
+		state := &canaryState{containers: []container.Summary{
+			{ID: "old1_container_id", Created: 50, State: container.StateRunning},
+		}}
+		client, executor := newMocks(t, state)
+
+		err := deploy(client, executor, 0, true)
+		if err == nil || err.Error() != "no canary containers to promote: service=web" {
+			t.Errorf("expected a missing canary error, got %v", err)
+		}
+		if len(state.events) != 0 {
+			t.Errorf("expected no containers to be touched, got events %v", state.events)
+		}
+	})
+
+	t.Run("canary without existing containers", func(t *testing.T) {
+		client, executor := newMocks(t, &canaryState{})
+
+		err := deploy(client, executor, 1, false)
+		if err == nil || err.Error() != "canary deploys require running containers to deploy alongside: service=web" {
+			t.Errorf("expected a missing containers error, got %v", err)
+		}
+	})
+}
+
+func TestDeployServicePublishedPorts(t *testing.T) {
+	created := []container.Summary{}
+	running := []container.Summary{}
+	mockClient := &mockDockerClient{
+		containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+			if slices.Contains(options.Filters.Get("status"), "running") {
+				return slices.Clone(running), nil
+			}
+			return slices.Clone(created), nil
+		},
+		containerStart: func(ctx context.Context, id string, options container.StartOptions) error {
+			running = append(running, created...)
+			created = []container.Summary{}
+			return nil
+		},
+		containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+			return container.InspectResponse{
+				ContainerJSONBase: &container.ContainerJSONBase{
+					Name:  "/web",
+					State: &container.State{Running: true},
+				},
+				NetworkSettings: &container.NetworkSettings{
+					NetworkSettingsBase: container.NetworkSettingsBase{
+						Ports: nat.PortMap{
+							"8080/tcp": []nat.PortBinding{{HostIP: "0.0.0.0", HostPort: "32768"}},
+						},
+					},
+				},
+			}, nil
+		},
+	}
+
+	mockExecutor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+		if slices.Contains(input.Args, "create") {
+			created = append(created, container.Summary{ID: "new1_container_id", Created: 100, State: container.StateCreated})
+		}
+		return ExecCommandResponse{ExitCode: 0}, nil
+	}
+
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	result, err := deployService(context.Background(), DeployServiceInput{
+		Client:                mockClient,
+		ComposeFile:           "/tmp/docker-compose.yaml",
+		ContainerNameTemplate: "{{.ServiceName}}",
+		Executor:              mockExecutor,
+		HealthStartPeriod:     time.Second,
+		Logger:                logger,
+		Project: &types.Project{
+			Services: types.Services{
+				"web": types.ServiceConfig{
+					Name:  "web",
+					Ports: []types.ServicePortConfig{{Target: 8080, Protocol: "tcp"}},
+					Deploy: &types.DeployConfig{
+						UpdateConfig: &types.UpdateConfig{
+							Monitor: types.Duration(time.Millisecond),
+						},
+					},
+				},
+			},
+		},
+		ProjectName: "test",
+		ServiceName: "web",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []PortMapping{{Container: "web", ContainerPort: "8080/tcp", HostIP: "0.0.0.0", HostPort: "32768"}}
+	if !slices.Equal(result.Ports, expected) {
+		t.Errorf("expected ports %v, got %v", expected, result.Ports)
+	}
+	if !strings.Contains(buf.String(), "Published port: service=web, container=web, port=0.0.0.0:32768->8080/tcp") {
+		t.Errorf("expected the assigned host port to be logged, output: %s", buf.String())
+	}
+}
+
+func TestClampReplicas(t *testing.T) {
+	tests := []struct {
+		name        string
+		replicas    int
+		replicasMin int
+		replicasMax int
+		expected    int
+		clamped     bool
+	}{
+		{name: "below min", replicas: 1, replicasMin: 2, replicasMax: 5, expected: 2, clamped: true},
+		{name: "above max", replicas: 8, replicasMin: 2, replicasMax: 5, expected: 5, clamped: true},
+		{name: "within range", replicas: 3, replicasMin: 2, replicasMax: 5, expected: 3},
+		{name: "no bounds", replicas: 8, expected: 8},
+		{name: "only min", replicas: 8, replicasMin: 2, expected: 8},
+		{name: "only max", replicas: 1, replicasMax: 5, expected: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := &command.ZerologUi{
+				StderrLogger: zerolog.New(&buf),
+				StdoutLogger: zerolog.New(&buf),
+			}
+
+			got := clampReplicas(DeployServiceInput{
+				Logger:      logger,
+				ReplicasMax: tt.replicasMax,
+				ReplicasMin: tt.replicasMin,
+				ServiceName: "web",
+			}, tt.replicas)
+			if got != tt.expected {
+				t.Errorf("expected %d replicas, got %d", tt.expected, got)
+			}
+
+			logged := strings.Contains(buf.String(), "Clamping replicas")
+			if logged != tt.clamped {
+				t.Errorf("expected clamping to be logged=%t, got output %q", tt.clamped, buf.String())
+			}
+		})
+	}
+
+	t.Run("min greater than max", func(t *testing.T) {
+		_, err := resolveDeployParams(context.Background(), DeployServiceInput{ReplicasMax: 2, ReplicasMin: 5}, &types.ServiceConfig{Name: "web"})
+		if err == nil {
+			t.Fatal("expected error, got nil")
+		}
+	})
+}
+
+func TestDeployServiceRevision(t *testing.T) {
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	project := &types.Project{
+		Services: types.Services{
+			"web": types.ServiceConfig{
+				Name:  "web",
+				Image: "example/web:latest",
+				Deploy: &types.DeployConfig{
+					UpdateConfig: &types.UpdateConfig{
+						Monitor: types.Duration(time.Millisecond),
+					},
+				},
+			},
+		},
+	}
+
+	created := []container.Summary{}
+	running := []container.Summary{}
+	mockClient := &mockDockerClient{
+		containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+			if slices.Contains(options.Filters.Get("status"), "running") {
+				return slices.Clone(running), nil
+			}
+			return slices.Clone(created), nil
+		},
+		containerStart: func(ctx context.Context, id string, options container.StartOptions) error {
+			running = append(running, created...)
+			created = []container.Summary{}
+			return nil
+		},
+		containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+			return container.InspectResponse{
+				ContainerJSONBase: &container.ContainerJSONBase{
+					Name:  "/web",
+					State: &container.State{Running: true},
+				},
+			}, nil
+		},
+	}
+
+	var overlay map[string]map[string]map[string]interface{}
+	mockExecutor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+		if !slices.Contains(input.Args, "create") {
+			return ExecCommandResponse{ExitCode: 0}, nil
+		}
+
+		created = append(created, container.Summary{ID: "new_container_id", Created: 100})
+		index := slices.Index(input.Args, "/tmp/docker-compose.yaml")
+		contents, err := os.ReadFile(input.Args[index+2])
+		if err != nil {
+			t.Fatalf("unexpected error reading overlay: %v", err)
+		}
+		if err := json.Unmarshal(contents, &overlay); err != nil {
+			t.Fatalf("unexpected error parsing overlay: %v", err)
+		}
+		return ExecCommandResponse{ExitCode: 0}, nil
+	}
+
+	history := NewDeployHistory(HistoryFile(t.TempDir()))
+	err := DeployService(context.Background(), DeployServiceInput{
+		Client:                mockClient,
+		ComposeFile:           "/tmp/docker-compose.yaml",
+		ContainerNameTemplate: "{{.ServiceName}}",
+		DeployID:              "deploy-1",
+		Executor:              mockExecutor,
+		HealthStartPeriod:     time.Second,
+		History:               history,
+		Logger:                logger,
+		Project:               project,
+		ProjectName:           "test",
+		Revision:              "0123abcd",
+		ServiceName:           "web",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	labels, _ := overlay["services"]["web"]["labels"].(map[string]interface{})
+	if labels[RevisionLabel] != "0123abcd" {
+		t.Errorf("expected the revision label on the new containers, got %v", labels)
+	}
+
+	records, err := history.Records("web")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(records) != 1 || records[0].Revision != "0123abcd" {
+		t.Errorf("expected the revision to be recorded, got %+v", records)
+	}
+}
+
+func TestDeployServiceSkipRename(t *testing.T) {
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	project := &types.Project{
+		Services: types.Services{
+			"web": types.ServiceConfig{
+				Name:  "web",
+				Image: "example/web:latest",
+				Deploy: &types.DeployConfig{
+					UpdateConfig: &types.UpdateConfig{
+						Monitor: types.Duration(time.Millisecond),
+					},
+				},
+			},
+		},
+	}
+
+	// deploy runs a deploy of a fresh web service, returning the names
+	// containers were renamed to
+	deploy := func(skipRename bool) []string {
+		renamed := []string{}
+		created := []container.Summary{}
+		running := []container.Summary{}
+		mockClient := &mockDockerClient{
+			containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+				if slices.Contains(options.Filters.Get("status"), "running") {
+					return slices.Clone(running), nil
+				}
+				return slices.Clone(created), nil
+			},
+			containerStart: func(ctx context.Context, id string, options container.StartOptions) error {
+				running = append(running, created...)
+				created = []container.Summary{}
+				return nil
+			},
+			containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+				return container.InspectResponse{
+					ContainerJSONBase: &container.ContainerJSONBase{
+						Name:  "/test-web-1",
+						State: &container.State{Running: true},
+					},
+				}, nil
+			},
+			containerRename: func(ctx context.Context, id, name string) error {
+				renamed = append(renamed, name)
+				return nil
+			},
+		}
+
+		mockExecutor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+			if slices.Contains(input.Args, "create") {
+				created = append(created, container.Summary{ID: "new_container_id", Created: 100, Names: []string{"/test-web-1"}})
+			}
+			return ExecCommandResponse{ExitCode: 0}, nil
+		}
+
+		err := DeployService(context.Background(), DeployServiceInput{
+			Client:                mockClient,
+			ComposeFile:           "/tmp/docker-compose.yaml",
+			ContainerNameTemplate: "{{.ServiceName}}-{{.InstanceID}}",
+			Executor:              mockExecutor,
+			HealthStartPeriod:     time.Second,
+			Logger:                logger,
+			Project:               project,
+			ProjectName:           "test",
+			ServiceName:           "web",
+			SkipRename:            skipRename,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return renamed
+	}
+
+	if renamed := deploy(false); !slices.Equal(renamed, []string{"web-1"}) {
+		t.Errorf("expected the container to be renamed to the convention, got %v", renamed)
+	}
+	if renamed := deploy(true); len(renamed) != 0 {
+		t.Errorf("expected no containers to be renamed, got %v", renamed)
+	}
+
+	t.Run("indexed deploys need the names", func(t *testing.T) {
+		err := DeployService(context.Background(), DeployServiceInput{
+			Client:      &mockDockerClient{},
+			ComposeFile: "/tmp/docker-compose.yaml",
+			Index:       1,
+			Logger:      logger,
+			Project:     project,
+			ProjectName: "test",
+			ServiceName: "web",
+			SkipRename:  true,
+		})
+		if err == nil || err.Error() != "an indexed deploy cannot skip renaming containers: service=web" {
+			t.Errorf("expected an index conflict error, got %v", err)
+		}
+	})
+}
+
+func TestDeployServiceRestartNo(t *testing.T) {
+	newProject := func(runToCompletion bool) *types.Project {
+		updateConfig := &types.UpdateConfig{Monitor: types.Duration(time.Millisecond)}
+		if runToCompletion {
+			updateConfig.Extensions = types.Extensions{"x-run-to-completion": true}
+		}
+		return &types.Project{
+			Services: types.Services{
+				"migrate": types.ServiceConfig{
+					Name:    "migrate",
+					Image:   "example/migrate:latest",
+					Restart: types.RestartPolicyNo,
+					Deploy:  &types.DeployConfig{UpdateConfig: updateConfig},
+				},
+			},
+		}
+	}
+
+	// deploy runs a deploy of a fresh migrate service whose containers
+	// exit with the given code, returning the result and the logged output
+	deploy := func(project *types.Project, exitCode int64) (DeployServiceResult, string, error) {
+		var buf bytes.Buffer
+		logger := &command.ZerologUi{
+			StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+			StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+			OriginalFields:    nil,
+			Ui:                nil,
+			OutputIndentField: false,
+		}
+
+		created := []container.Summary{}
+		running := []container.Summary{}
+		mockClient := &mockDockerClient{
+			containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+				if slices.Contains(options.Filters.Get("status"), "running") {
+					return slices.Clone(running), nil
+				}
+				return slices.Clone(created), nil
+			},
+			containerStart: func(ctx context.Context, id string, options container.StartOptions) error {
+				running = append(running, created...)
+				created = []container.Summary{}
+				return nil
+			},
+			containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+				return container.InspectResponse{
+					ContainerJSONBase: &container.ContainerJSONBase{
+						Name:  "/test-migrate-1",
+						State: &container.State{Running: true},
+					},
+				}, nil
+			},
+			containerWait: func(ctx context.Context, id string, condition container.WaitCondition) (<-chan container.WaitResponse, <-chan error) {
+				respCh := make(chan container.WaitResponse, 1)
+				respCh <- container.WaitResponse{StatusCode: exitCode}
+				return respCh, make(chan error)
+			},
+		}
+
+		mockExecutor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+			if slices.Contains(input.Args, "create") {
+				created = append(created, container.Summary{ID: "job1_container_id", Created: 100, State: container.StateCreated})
+			}
+			return ExecCommandResponse{ExitCode: 0}, nil
+		}
+
+		result, err := deployService(context.Background(), DeployServiceInput{
+			Client:            mockClient,
+			ComposeFile:       "/tmp/docker-compose.yaml",
+			Executor:          mockExecutor,
+			HealthStartPeriod: time.Second,
+			Logger:            logger,
+			Project:           project,
+			ProjectName:       "test",
+			ServiceName:       "migrate",
+			SkipRename:        true,
+		})
+		return result, buf.String(), err
+	}
+
+	warning := "Service does not restart but is deployed for replicas, set x-run-to-completion to run it as a one-shot job: service=migrate, restart=no"
+
+	t.Run("warns when deployed for replicas", func(t *testing.T) {
+		_, output, err := deploy(newProject(false), 0)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(output, warning) {
+			t.Errorf("expected the restart policy mismatch to be warned about, got %s", output)
+		}
+	})
+
+	t.Run("runs as a batch job", func(t *testing.T) {
+		result, output, err := deploy(newProject(true), 0)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if strings.Contains(output, warning) {
+			t.Errorf("expected no warning for a run-to-completion service, got %s", output)
+		}
+		if !strings.Contains(output, "Service ran to completion: service=migrate, succeeded=1, failed=0") {
+			t.Errorf("expected the batch job to be reported, got %s", output)
+		}
+		if result.Failures != 0 || result.Replicas != 0 {
+			t.Errorf("expected no failures and no running replicas, got %+v", result)
+		}
+	})
+
+	t.Run("reports a failed batch job", func(t *testing.T) {
+		result, output, err := deploy(newProject(true), 2)
+		if err == nil || err.Error() != "container job1_contain exited with code 2" {
+			t.Errorf("expected the exit code to fail the deploy, got %v", err)
+		}
+		if result.Failures != 1 {
+			t.Errorf("expected the failed container to be counted, got %+v", result)
+		}
+		if !strings.Contains(output, "Service ran to completion: service=migrate, succeeded=0, failed=1") {
+			t.Errorf("expected the batch job to be reported, got %s", output)
+		}
+	})
+}
+
+func TestDeployServiceRecreate(t *testing.T) {
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger: zerolog.New(&buf),
+		StdoutLogger: zerolog.New(&buf),
+	}
+
+	replicas := 3
+	value := "1"
+	service := types.ServiceConfig{
+		Name:        "web",
+		Image:       "nginx:1.27",
+		Environment: types.MappingWithEquals{"FEATURE": &value},
+		Deploy: &types.DeployConfig{
+			Replicas: &replicas,
+			UpdateConfig: &types.UpdateConfig{
+				Monitor: types.Duration(time.Millisecond),
+				Order:   "start-first",
+			},
+		},
+	}
+	project := &types.Project{
+		Services: types.Services{"web": service},
+	}
+
+	current := map[string]string{ConfigFingerprintLabel: configFingerprint(&service, nil)}
+	stale := map[string]string{ConfigFingerprintLabel: "environment=000000000000,volumes=000000000000"}
+	containers := []container.Summary{
+		{ID: "old1_container_id", Created: 50, Image: "nginx:1.27", Labels: current, Names: []string{"/test-web-1"}, State: container.StateRunning},
+		{ID: "old2_container_id", Created: 60, Image: "nginx:1.27", Labels: stale, Names: []string{"/test-web-2"}, State: container.StateRunning},
+		{ID: "old3_container_id", Created: 70, Image: "nginx:1.27", Labels: current, Names: []string{"/test-web-3"}, State: container.StateRunning},
+	}
+
+	terminated := []string{}
+	mockClient := &mockDockerClient{
+		containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+			return slices.Clone(containers), nil
+		},
+		containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+			return container.InspectResponse{
+				ContainerJSONBase: &container.ContainerJSONBase{
+					State: &container.State{Running: true},
+				},
+			}, nil
+		},
+		containerTerminate: func(ctx context.Context, id string, stopTimeout time.Duration) error {
+			terminated = append(terminated, id)
+			containers = slices.DeleteFunc(containers, func(c container.Summary) bool {
+				return c.ID == id
+			})
+			return nil
+		},
+		containerRename: func(ctx context.Context, id string, newName string) error {
+			return nil
+		},
+	}
+
+	scales := []string{}
+	mockExecutor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+		if index := slices.Index(input.Args, "--scale"); index != -1 {
+			scales = append(scales, input.Args[index+1])
+			containers = append(containers, container.Summary{ID: "new_container_id", Created: 100, Image: "nginx:1.27", Labels: current, State: container.StateRunning})
+		}
+		return ExecCommandResponse{ExitCode: 0}, nil
+	}
+
+	err := DeployService(context.Background(), DeployServiceInput{
+		Client:                mockClient,
+		ComposeFile:           "/tmp/docker-compose.yaml",
+		ContainerNameTemplate: "{{.ProjectName}}-{{.ServiceName}}-{{.InstanceID}}",
+		Executor:              mockExecutor,
+		HealthStartPeriod:     time.Second,
+		Logger:                logger,
+		Project:               project,
+		ProjectName:           "test",
+		Recreate:              true,
+		ServiceName:           "web",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !slices.Equal(scales, []string{"web=4"}) {
+		t.Errorf("expected a single replacement to be started, got scales %v", scales)
+	}
+	if !slices.Equal(terminated, []string{"old2_container_id"}) {
+		t.Errorf("expected only the container with a stale fingerprint to be recreated, got %v", terminated)
+	}
+}
+
+func TestDeployServiceRecreateBuiltImage(t *testing.T) {
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger: zerolog.New(&buf),
+		StdoutLogger: zerolog.New(&buf),
+	}
+
+	replicas := 2
+	service := types.ServiceConfig{
+		Name:  "web",
+		Build: &types.BuildConfig{Context: "."},
+		Deploy: &types.DeployConfig{
+			Replicas: &replicas,
+		},
+	}
+	project := &types.Project{
+		Services: types.Services{"web": service},
+	}
+
+	// compose names the image of a service without one after the project
+	current := map[string]string{ConfigFingerprintLabel: configFingerprint(&service, nil)}
+	containers := []container.Summary{
+		{ID: "old1_container_id", Created: 50, Image: "test-web", Labels: current, Names: []string{"/test-web-1"}, State: container.StateRunning},
+		{ID: "old2_container_id", Created: 60, Image: "test-web", Labels: current, Names: []string{"/test-web-2"}, State: container.StateRunning},
+	}
+
+	terminated := []string{}
+	mockClient := &mockDockerClient{
+		containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+			return slices.Clone(containers), nil
+		},
+		containerTerminate: func(ctx context.Context, id string, stopTimeout time.Duration) error {
+			terminated = append(terminated, id)
+			return nil
+		},
+		containerRename: func(ctx context.Context, id string, newName string) error {
+			return nil
+		},
+	}
+	mockExecutor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+		if slices.Contains(input.Args, "--scale") {
+			t.Errorf("expected no container to be created, got %v", input.Args)
+		}
+		return ExecCommandResponse{ExitCode: 0}, nil
+	}
+
+	err := DeployService(context.Background(), DeployServiceInput{
+		Client:                mockClient,
+		ComposeFile:           "/tmp/docker-compose.yaml",
+		ContainerNameTemplate: "{{.ProjectName}}-{{.ServiceName}}-{{.InstanceID}}",
+		Executor:              mockExecutor,
+		Logger:                logger,
+		Project:               project,
+		ProjectName:           "test",
+		Recreate:              true,
+		ServiceName:           "web",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(terminated) != 0 {
+		t.Errorf("expected the matching containers of a built service to be left running, got %v", terminated)
+	}
+}
+
+func TestDeployServiceKeepOldOrder(t *testing.T) {
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger: zerolog.New(&buf),
+		StdoutLogger: zerolog.New(&buf),
+	}
+
+	replicas := 1
+	project := &types.Project{
+		Services: types.Services{
+			"web": types.ServiceConfig{
+				Name:  "web",
+				Image: "nginx:1.27",
+				Deploy: &types.DeployConfig{
+					Replicas:     &replicas,
+					UpdateConfig: &types.UpdateConfig{Monitor: types.Duration(time.Millisecond), Order: "stop-first"},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		existing    []container.Summary
+		expectError bool
+	}{
+		{
+			name:        "service without containers to replace",
+			existing:    []container.Summary{},
+			expectError: false,
+		},
+		{
+			name: "service with containers to replace",
+			existing: []container.Summary{
+				{ID: "old1_container_id", Created: 50, Image: "nginx:1.25", Names: []string{"/test-web-1"}, State: container.StateRunning},
+			},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			containers := slices.Clone(tt.existing)
+			terminated := []string{}
+			mockClient := &mockDockerClient{
+				containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+					return slices.Clone(containers), nil
+				},
+				containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+					return container.InspectResponse{
+						ContainerJSONBase: &container.ContainerJSONBase{
+							State: &container.State{Running: true},
+						},
+					}, nil
+				},
+				containerTerminate: func(ctx context.Context, id string, stopTimeout time.Duration) error {
+					terminated = append(terminated, id)
+					return nil
+				},
+				containerRename: func(ctx context.Context, id string, newName string) error {
+					return nil
+				},
+			}
+			mockExecutor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+				if slices.Contains(input.Args, "--scale") && len(containers) == 0 {
+					containers = append(containers, container.Summary{ID: "new1_container_id", Created: 100, Image: "nginx:1.27", State: container.StateRunning})
+				}
+				return ExecCommandResponse{ExitCode: 0}, nil
+			}
+
+			err := DeployService(context.Background(), DeployServiceInput{
+				Client:                mockClient,
+				ComposeFile:           "/tmp/docker-compose.yaml",
+				ContainerNameTemplate: "{{.ProjectName}}-{{.ServiceName}}-{{.InstanceID}}",
+				Executor:              mockExecutor,
+				KeepOld:               true,
+				Logger:                logger,
+				Project:               project,
+				ProjectName:           "test",
+				ServiceName:           "web",
+			})
+			if tt.expectError {
+				if err == nil || !strings.Contains(err.Error(), "requires the start-first update order") {
+					t.Fatalf("expected the update order to be rejected, got %v", err)
+				}
+				if len(terminated) != 0 {
+					t.Errorf("expected no container to be stopped, got %v", terminated)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected a service without containers to replace to deploy, got %v", err)
+			}
+		})
+	}
+}
+
+func TestDeployServiceOnlyNew(t *testing.T) {
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger: zerolog.New(&buf),
+		StdoutLogger: zerolog.New(&buf),
+	}
+
+	replicas := 4
+	project := &types.Project{
+		Services: types.Services{
+			"web": types.ServiceConfig{
+				Name:  "web",
+				Image: "nginx:1.27",
+				Deploy: &types.DeployConfig{
+					Replicas: &replicas,
+					UpdateConfig: &types.UpdateConfig{
+						Monitor: types.Duration(time.Millisecond),
+					},
+				},
+			},
+		},
+	}
+
+	// the existing containers run an older image, so a normal deploy would
+	// replace every one of them
+	containers := []container.Summary{
+		{ID: "old1_container_id", Created: 50, Image: "nginx:1.26", Names: []string{"/test-web-1"}, State: container.StateRunning},
+		{ID: "old2_container_id", Created: 60, Image: "nginx:1.26", Names: []string{"/test-web-2"}, State: container.StateRunning},
+	}
+
+	terminated := []string{}
+	mockClient := &mockDockerClient{
+		containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+			return slices.Clone(containers), nil
+		},
+		containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+			return container.InspectResponse{
+				ContainerJSONBase: &container.ContainerJSONBase{
+					State: &container.State{Running: true},
+				},
+			}, nil
+		},
+		containerTerminate: func(ctx context.Context, id string, stopTimeout time.Duration) error {
+			terminated = append(terminated, id)
+			return nil
+		},
+		containerRename: func(ctx context.Context, id string, newName string) error {
+			return nil
+		},
+	}
+
+	scales := []string{}
+	mockExecutor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+		if index := slices.Index(input.Args, "--scale"); index != -1 {
+			scales = append(scales, input.Args[index+1])
+			containers = append(containers,
+				container.Summary{ID: "new1_container_id", Created: 100, Image: "nginx:1.27", State: container.StateRunning},
+				container.Summary{ID: "new2_container_id", Created: 110, Image: "nginx:1.27", State: container.StateRunning},
+			)
+		}
+		return ExecCommandResponse{ExitCode: 0}, nil
+	}
+
+	err := DeployService(context.Background(), DeployServiceInput{
+		Client:                mockClient,
+		ComposeFile:           "/tmp/docker-compose.yaml",
+		ContainerNameTemplate: "{{.ProjectName}}-{{.ServiceName}}-{{.InstanceID}}",
+		Executor:              mockExecutor,
+		HealthStartPeriod:     time.Second,
+		Logger:                logger,
+		OnlyNew:               true,
+		Project:               project,
+		ProjectName:           "test",
+		ServiceName:           "web",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(terminated) != 0 {
+		t.Errorf("expected no existing container to be terminated, got %v", terminated)
+	}
+	if !slices.Equal(scales, []string{"web=4"}) {
+		t.Errorf("expected only the scale up to the replica count, got scales %v", scales)
+	}
+	if !strings.Contains(buf.String(), "Skipping rolling update of existing containers: service=web, existing=2") {
+		t.Errorf("expected the skipped rolling update to be logged, got %s", buf.String())
+	}
+}
+
+func TestDeployServiceContainerNameTemplateReplicas(t *testing.T) {
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger: zerolog.New(&buf),
+		StdoutLogger: zerolog.New(&buf),
+	}
+
+	replicas := 3
+	project := &types.Project{
+		Services: types.Services{
+			"web": types.ServiceConfig{
+				Name:   "web",
+				Deploy: &types.DeployConfig{Replicas: &replicas},
+			},
+		},
+	}
+
+	mockClient := &mockDockerClient{
+		containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+			return []container.Summary{}, nil
+		},
+	}
+	mockExecutor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+		t.Errorf("expected no compose command to run, got %v", input.Args)
+		return ExecCommandResponse{ExitCode: 0}, nil
+	}
+
+	err := DeployService(context.Background(), DeployServiceInput{
+		Client:                mockClient,
+		ComposeFile:           "/tmp/docker-compose.yaml",
+		ContainerNameTemplate: "{{.ProjectName}}-{{.ServiceName}}",
+		Executor:              mockExecutor,
+		Logger:                logger,
+		Project:               project,
+		ProjectName:           "test",
+		ServiceName:           "web",
+	})
+	expected := `container name template "{{.ProjectName}}-{{.ServiceName}}" renders the same name "test-web" for every instance of service web, so its 3 replicas would collide: reference {{.InstanceID}} in the template`
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected a colliding template error, got %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		nameTemplate string
+		replicas     int
+		expectError  bool
+	}{
+		{name: "instance id", nameTemplate: "{{.ServiceName}}-{{.InstanceID}}", replicas: 3},
+		{name: "single replica", nameTemplate: "{{.ServiceName}}", replicas: 1},
+		{name: "instance id in a condition", nameTemplate: "{{.ServiceName}}{{if gt .InstanceID 1}}-{{.InstanceID}}{{end}}", replicas: 3},
+		{name: "instance id unused", nameTemplate: "{{.ServiceName}}{{if lt .InstanceID 0}}-{{.InstanceID}}{{end}}", replicas: 2, expectError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateContainerNameTemplate(tt.nameTemplate, "test", "web", nil, tt.replicas)
+			if (err != nil) != tt.expectError {
+				t.Errorf("expected error=%v, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
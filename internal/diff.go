@@ -0,0 +1,315 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/docker/api/types/container"
+)
+
+// ConfigFingerprintLabel is the label holding the fingerprint of the config a
+// container was deployed with, so a later diff can tell whether it changed
+const ConfigFingerprintLabel = "com.dokku.orchestrate/config-fingerprint"
+
+// ServiceDiff is the difference between the running containers of a service
+// and the state a deploy would bring it to
+type ServiceDiff struct {
+	// ConfigChanges are the parts of the config that changed, such as environment or volumes
+	ConfigChanges []string
+	// ConfigUnknown is whether a running container predates the config fingerprint, so config changes cannot be detected
+	ConfigUnknown bool
+	// CurrentImages are the distinct images of the running containers
+	CurrentImages []DiffImage
+	// CurrentReplicas is the number of running containers
+	CurrentReplicas int
+	// DesiredImage is the image the service is deployed with
+	DesiredImage DiffImage
+	// DesiredReplicas is the number of containers the service is deployed with
+	DesiredReplicas int
+	// ServiceName is the name of the service
+	ServiceName string
+}
+
+// DiffImage is an image reference along with the id it resolves to locally
+type DiffImage struct {
+	// ID is the id of the image, empty when the image is not available locally
+	ID string
+	// Name is the image reference
+	Name string
+}
+
+// String returns the image reference along with its short id
+func (i DiffImage) String() string {
+	if i.ID == "" {
+		return fmt.Sprintf("%s (not pulled)", i.Name)
+	}
+	return fmt.Sprintf("%s (%s)", i.Name, shortImageID(i.ID))
+}
+
+// ImageChanged returns whether any running container uses an image other than the desired one
+func (d ServiceDiff) ImageChanged() bool {
+	for _, current := range d.CurrentImages {
+		if current.Name != d.DesiredImage.Name {
+			return true
+		}
+		if d.DesiredImage.ID != "" && current.ID != d.DesiredImage.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// Changed returns whether a deploy would change the service
+func (d ServiceDiff) Changed() bool {
+	return d.ImageChanged() || d.CurrentReplicas != d.DesiredReplicas || len(d.ConfigChanges) > 0
+}
+
+// String returns a compact description of the diff
+func (d ServiceDiff) String() string {
+	if !d.Changed() && !d.ConfigUnknown {
+		return fmt.Sprintf("%s: no changes", d.ServiceName)
+	}
+
+	lines := []string{fmt.Sprintf("%s:", d.ServiceName)}
+	if d.ImageChanged() {
+		currentImages := []string{}
+		for _, current := range d.CurrentImages {
+			currentImages = append(currentImages, current.String())
+		}
+		lines = append(lines, fmt.Sprintf("  image: %s -> %s", strings.Join(currentImages, ", "), d.DesiredImage))
+	} else if d.CurrentReplicas == 0 {
+		lines = append(lines, fmt.Sprintf("  image: none -> %s", d.DesiredImage))
+	}
+	if d.CurrentReplicas != d.DesiredReplicas {
+		lines = append(lines, fmt.Sprintf("  replicas: %d -> %d (%+d)", d.CurrentReplicas, d.DesiredReplicas, d.DesiredReplicas-d.CurrentReplicas))
+	}
+	for _, change := range d.ConfigChanges {
+		lines = append(lines, fmt.Sprintf("  %s: changed", change))
+	}
+	if d.ConfigUnknown {
+		lines = append(lines, "  config: unknown, running containers have no config fingerprint")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// DiffProject returns the diff of each service a project deploy would
+// deploy, in deploy order, without changing anything
+func DiffProject(ctx context.Context, input DeployProjectInput) ([]ServiceDiff, error) {
+	orderedServices, err := OrderServices(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	servicesToDiff, err := selectServices(input, orderedServices)
+	if err != nil {
+		return nil, err
+	}
+
+	diffs := []ServiceDiff{}
+	for _, serviceName := range servicesToDiff {
+		diff, skipped, err := diffService(ctx, projectServiceInput(input, serviceName))
+		if err != nil {
+			return diffs, err
+		}
+		if !skipped {
+			diffs = append(diffs, diff)
+		}
+	}
+
+	return diffs, nil
+}
+
+// DiffService returns the diff between the running containers of a service
+// and the state a deploy would bring it to, without changing anything
+func DiffService(ctx context.Context, input DeployServiceInput) (ServiceDiff, error) {
+	diff, _, err := diffService(ctx, input)
+	return diff, err
+}
+
+// diffService returns the diff of a service, and whether the service is
+// skipped by deploys and so left out of a project diff
+func diffService(ctx context.Context, input DeployServiceInput) (ServiceDiff, bool, error) {
+	diff := ServiceDiff{ServiceName: input.ServiceName}
+	if input.Project == nil {
+		return diff, false, fmt.Errorf("project is required")
+	}
+
+	service, err := input.Project.GetService(input.ServiceName)
+	if err != nil {
+		return diff, false, fmt.Errorf("service %s not found in compose file", input.ServiceName)
+	}
+
+	skipService := shouldSkipService(ShouldSkipServiceInput{
+		Logger:              input.Logger,
+		Service:             &service,
+		ShouldSkipDatabases: input.SkipDatabases,
+		SilenceLogging:      true,
+	})
+	if skipService {
+		return diff, true, nil
+	}
+
+	params, err := resolveDeployParams(ctx, input, &service)
+	if err != nil {
+		return diff, false, err
+	}
+	diff.DesiredReplicas = params.Replicas
+
+	if input.Image != "" {
+		service.Image = input.Image
+	}
+	diff.DesiredImage = DiffImage{Name: service.Image}
+	if desiredImage, err := input.Client.ImageInspect(ctx, service.Image); err == nil {
+		diff.DesiredImage.ID = desiredImage.ID
+	}
+
+	containers, err := composeContainers(ComposeContainersInput{
+		Client:       input.Client,
+		ProjectLabel: input.ProjectLabel,
+		ProjectName:  input.ProjectName,
+		ServiceName:  input.ServiceName,
+		Status:       "running",
+	})
+	if err != nil {
+		return diff, false, fmt.Errorf("error getting running containers: %v", err)
+	}
+	diff.CurrentReplicas = len(containers)
+
+	desiredFingerprint := configFingerprint(&service, serviceOverrides(input, &service))
+	configChanges := map[string]bool{}
+	for _, c := range containers {
+		inspect, err := input.Client.ContainerInspect(ctx, c.ID)
+		if err != nil {
+			return diff, false, fmt.Errorf("error inspecting container %s: %v", c.ID, err)
+		}
+
+		current := DiffImage{ID: inspect.Image}
+		if inspect.Config != nil {
+			current.Name = inspect.Config.Image
+		}
+		if !slices.Contains(diff.CurrentImages, current) {
+			diff.CurrentImages = append(diff.CurrentImages, current)
+		}
+
+		fingerprint := containerLabel(inspect, ConfigFingerprintLabel)
+		if fingerprint == "" {
+			diff.ConfigUnknown = true
+			continue
+		}
+		for _, change := range configFingerprintChanges(fingerprint, desiredFingerprint) {
+			configChanges[change] = true
+		}
+	}
+	diff.ConfigChanges = slices.Sorted(maps.Keys(configChanges))
+
+	return diff, false, nil
+}
+
+// configFingerprint returns the fingerprint of the config the containers of a
+// service are created from, as a comma-separated list of hashes of its
+// environment, its volumes and the rest of its config along with the
+// overrides applied by the deploy. Like the compose config hash, settings
+// that do not change the containers themselves are left out, such as the
+// replica count, the build config and the rollout settings. The image is
+// compared on its own, and environment read from other containers when
+// deploying is not covered.
+func configFingerprint(service *types.ServiceConfig, overrides map[string]interface{}) string {
+	config := *service
+	config.Build = nil
+	config.DependsOn = nil
+	config.Environment = nil
+	config.Extensions = nil
+	config.Image = ""
+	config.Profiles = nil
+	config.PullPolicy = ""
+	config.Scale = nil
+	config.Volumes = nil
+	if config.Deploy != nil {
+		deploy := *config.Deploy
+		deploy.Replicas = nil
+		deploy.RollbackConfig = nil
+		deploy.UpdateConfig = nil
+		config.Deploy = &deploy
+	}
+
+	configOverrides := map[string]interface{}{}
+	for key, value := range overrides {
+		if key != "environment" && key != "image" {
+			configOverrides[key] = value
+		}
+	}
+
+	parts := []string{}
+	for _, part := range []struct {
+		name  string
+		value interface{}
+	}{
+		{name: "environment", value: service.Environment},
+		{name: "volumes", value: service.Volumes},
+		{name: "config", value: map[string]interface{}{"service": config, "overrides": configOverrides}},
+	} {
+		// maps marshal with sorted keys, so equal configs hash the same
+		encoded, err := json.Marshal(part.value)
+		if err != nil {
+			encoded = []byte(fmt.Sprintf("%v", part.value))
+		}
+		sum := sha256.Sum256(encoded)
+		parts = append(parts, fmt.Sprintf("%s=%s", part.name, hex.EncodeToString(sum[:])[:12]))
+	}
+	return strings.Join(parts, ",")
+}
+
+// staleContainers returns the containers that differ from the desired config
+// fingerprint or image. Containers deployed before the fingerprint was
+// stamped are stale, as they cannot be compared.
+func staleContainers(containers []container.Summary, desiredFingerprint string, image string) []container.Summary {
+	stale := []container.Summary{}
+	for _, c := range containers {
+		if c.Labels[ConfigFingerprintLabel] != desiredFingerprint || c.Image != image {
+			stale = append(stale, c)
+		}
+	}
+	return stale
+}
+
+// configFingerprintChanges returns the names of the parts differing between two fingerprints
+func configFingerprintChanges(current string, desired string) []string {
+	currentParts := map[string]string{}
+	for _, part := range strings.Split(current, ",") {
+		name, hash, _ := strings.Cut(part, "=")
+		currentParts[name] = hash
+	}
+
+	changes := []string{}
+	for _, part := range strings.Split(desired, ",") {
+		name, hash, _ := strings.Cut(part, "=")
+		if currentParts[name] != hash {
+			changes = append(changes, name)
+		}
+	}
+	return changes
+}
+
+// containerLabel returns the value of a label of an inspected container
+func containerLabel(inspect container.InspectResponse, label string) string {
+	if inspect.Config == nil {
+		return ""
+	}
+	return inspect.Config.Labels[label]
+}
+
+// shortImageID returns the first twelve characters of an image id
+func shortImageID(id string) string {
+	id = strings.TrimPrefix(id, "sha256:")
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
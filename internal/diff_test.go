@@ -0,0 +1,149 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/josegonzalez/cli-skeleton/command"
+	"github.com/rs/zerolog"
+)
+
+func TestDiffService(t *testing.T) {
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	debug := "true"
+	replicas := 3
+	service := types.ServiceConfig{
+		Name:        "web",
+		Image:       "nginx:1.27",
+		Environment: types.MappingWithEquals{"DEBUG": &debug},
+		Deploy:      &types.DeployConfig{Replicas: &replicas},
+	}
+	project := &types.Project{
+		Services: types.Services{"web": service},
+	}
+
+	// the running container was deployed from an older image, and before
+	// the environment gained the DEBUG variable
+	deployed := service
+	deployed.Environment = types.MappingWithEquals{}
+	mockClient := &mockDockerClient{
+		containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+			if !slices.Contains(options.Filters.Get("status"), "running") {
+				t.Errorf("expected only running containers to be listed")
+			}
+			return []container.Summary{
+				{ID: "old1_container_id", State: container.StateRunning},
+			}, nil
+		},
+		containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+			return container.InspectResponse{
+				ContainerJSONBase: &container.ContainerJSONBase{
+					ID:    id,
+					Image: "sha256:1111111111111111111111111111111111111111111111111111111111111111",
+				},
+				Config: &container.Config{
+					Image:  "nginx:1.25",
+					Labels: map[string]string{ConfigFingerprintLabel: configFingerprint(&deployed, nil)},
+				},
+			}, nil
+		},
+		imageInspect: func(ctx context.Context, imageID string) (image.InspectResponse, error) {
+			return image.InspectResponse{ID: "sha256:2222222222222222222222222222222222222222222222222222222222222222"}, nil
+		},
+	}
+
+	diff, err := DiffService(context.Background(), DeployServiceInput{
+		Client:      mockClient,
+		Logger:      logger,
+		Project:     project,
+		ProjectName: "test",
+		ServiceName: "web",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !diff.ImageChanged() {
+		t.Errorf("expected the image change to be reported, got %+v", diff)
+	}
+	if diff.CurrentReplicas != 1 || diff.DesiredReplicas != 3 {
+		t.Errorf("expected replicas to go from 1 to 3, got %d to %d", diff.CurrentReplicas, diff.DesiredReplicas)
+	}
+	if !slices.Equal(diff.ConfigChanges, []string{"environment"}) {
+		t.Errorf("expected only the environment to have changed, got %v", diff.ConfigChanges)
+	}
+
+	expected := strings.Join([]string{
+		"web:",
+		"  image: nginx:1.25 (111111111111) -> nginx:1.27 (222222222222)",
+		"  replicas: 1 -> 3 (+2)",
+		"  environment: changed",
+	}, "\n")
+	if diff.String() != expected {
+		t.Errorf("unexpected diff\nexpected:\n%s\ngot:\n%s", expected, diff.String())
+	}
+}
+
+func TestStaleContainers(t *testing.T) {
+	replicas := 2
+	service := types.ServiceConfig{
+		Name:    "web",
+		Image:   "nginx:1.27",
+		Command: types.ShellCommand{"nginx", "-g", "daemon off;"},
+		Deploy:  &types.DeployConfig{Replicas: &replicas},
+	}
+	deployed := configFingerprint(&service, nil)
+	containers := []container.Summary{
+		{ID: "web1_container_id", Image: "nginx:1.27", Labels: map[string]string{ConfigFingerprintLabel: deployed}},
+	}
+
+	t.Run("matching config", func(t *testing.T) {
+		scaled := service
+		more := 5
+		scaled.Deploy = &types.DeployConfig{Replicas: &more}
+		if stale := staleContainers(containers, configFingerprint(&scaled, nil), "nginx:1.27"); len(stale) != 0 {
+			t.Errorf("expected a replica count change to leave the containers alone, got %v", stale)
+		}
+	})
+
+	changes := map[string]func(service *types.ServiceConfig) map[string]interface{}{
+		"command": func(service *types.ServiceConfig) map[string]interface{} {
+			service.Command = types.ShellCommand{"nginx", "-g", "daemon off; worker_processes 2;"}
+			return nil
+		},
+		"ports": func(service *types.ServiceConfig) map[string]interface{} {
+			service.Ports = []types.ServicePortConfig{{Target: 80, Published: "8080"}}
+			return nil
+		},
+		"labels": func(service *types.ServiceConfig) map[string]interface{} {
+			service.Labels = types.Labels{"team": "web"}
+			return nil
+		},
+		"entrypoint override": func(service *types.ServiceConfig) map[string]interface{} {
+			return map[string]interface{}{"entrypoint": "/docker-entrypoint.sh"}
+		},
+	}
+	for name, change := range changes {
+		t.Run(name, func(t *testing.T) {
+			changed := service
+			overrides := change(&changed)
+			if stale := staleContainers(containers, configFingerprint(&changed, overrides), "nginx:1.27"); len(stale) != 1 {
+				t.Errorf("expected a %s change to make the container stale, got %v", name, stale)
+			}
+		})
+	}
+}
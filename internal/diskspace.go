@@ -0,0 +1,69 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/go-units"
+	"github.com/josegonzalez/cli-skeleton/command"
+)
+
+// DiskSpace describes the filesystem holding the Docker data-root
+type DiskSpace struct {
+	// Available is the number of bytes available for new images and containers
+	Available uint64
+	// Path is the Docker data-root
+	Path string
+	// Total is the size of the filesystem in bytes
+	Total uint64
+}
+
+// CheckDiskSpaceInput contains the parameters for the free disk space pre-flight
+type CheckDiskSpaceInput struct {
+	// Client is the Docker client to use
+	Client DockerClientInterface
+	// Logger is the logger to use
+	Logger *command.ZerologUi
+	// MinFreeDisk is the minimum number of free bytes required. If 0, the check is skipped.
+	MinFreeDisk int64
+}
+
+// ParseSizeFlag parses the value of a size flag, such as `500MB` or `5GB`.
+// An empty value is treated as unset and returns 0.
+func ParseSizeFlag(name string, value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	size, err := units.FromHumanSize(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s value %q: expected a size such as 500MB or 5GB", name, value)
+	}
+
+	if size < 0 {
+		return 0, fmt.Errorf("invalid %s value %q: size must not be negative", name, value)
+	}
+
+	return size, nil
+}
+
+// checkDiskSpace fails when the Docker data-root has less free space than
+// required, so a deploy does not run out of disk partway through pulling
+// images and creating containers
+func checkDiskSpace(ctx context.Context, input CheckDiskSpaceInput) error {
+	if input.MinFreeDisk <= 0 {
+		return nil
+	}
+
+	diskSpace, err := input.Client.DiskUsage(ctx)
+	if err != nil {
+		return fmt.Errorf("error checking free disk space: %v", err)
+	}
+
+	input.Logger.Info(fmt.Sprintf("Checking free disk space: path=%s, available=%s, required=%s", diskSpace.Path, units.BytesSize(float64(diskSpace.Available)), units.BytesSize(float64(input.MinFreeDisk))))
+	if diskSpace.Available < uint64(input.MinFreeDisk) {
+		return fmt.Errorf("insufficient free disk space on %s: %s available, %s required", diskSpace.Path, units.BytesSize(float64(diskSpace.Available)), units.BytesSize(float64(input.MinFreeDisk)))
+	}
+
+	return nil
+}
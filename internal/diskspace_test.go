@@ -0,0 +1,119 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/josegonzalez/cli-skeleton/command"
+	"github.com/rs/zerolog"
+)
+
+func TestParseSizeFlag(t *testing.T) {
+	tests := []struct {
+		name          string
+		value         string
+		expected      int64
+		expectedError string
+	}{
+		{name: "unset", value: "", expected: 0},
+		{name: "bytes", value: "1024", expected: 1024},
+		{name: "megabytes", value: "500MB", expected: 500 * 1000 * 1000},
+		{name: "gigabytes", value: "5GB", expected: 5 * 1000 * 1000 * 1000},
+		{name: "garbage", value: "lots", expectedError: `invalid --min-free-disk value "lots": expected a size such as 500MB or 5GB`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSizeFlag("--min-free-disk", tt.value)
+			if tt.expectedError != "" {
+				if err == nil {
+					t.Fatalf("expected error, got nil")
+				}
+				if err.Error() != tt.expectedError {
+					t.Errorf("expected error %q, got %q", tt.expectedError, err.Error())
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("expected %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestCheckDiskSpace(t *testing.T) {
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	tests := []struct {
+		name          string
+		minFreeDisk   int64
+		diskSpace     DiskSpace
+		diskUsageErr  error
+		expectedError string
+	}{
+		{
+			name:         "disabled",
+			minFreeDisk:  0,
+			diskUsageErr: errors.New("should not be called"),
+		},
+		{
+			name:        "enough free space",
+			minFreeDisk: 5 * 1000 * 1000 * 1000,
+			diskSpace:   DiskSpace{Available: 10 * 1000 * 1000 * 1000, Path: "/var/lib/docker"},
+		},
+		{
+			name:          "low free space",
+			minFreeDisk:   5 * 1000 * 1000 * 1000,
+			diskSpace:     DiskSpace{Available: 1000 * 1000 * 1000, Path: "/var/lib/docker"},
+			expectedError: "insufficient free disk space on /var/lib/docker: 953.7MiB available, 4.657GiB required",
+		},
+		{
+			name:          "disk usage unavailable",
+			minFreeDisk:   1,
+			diskUsageErr:  errors.New("daemon is remote"),
+			expectedError: "error checking free disk space: daemon is remote",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := &mockDockerClient{
+				diskUsage: func(ctx context.Context) (DiskSpace, error) {
+					return tt.diskSpace, tt.diskUsageErr
+				},
+			}
+
+			err := checkDiskSpace(context.Background(), CheckDiskSpaceInput{
+				Client:      mockClient,
+				Logger:      logger,
+				MinFreeDisk: tt.minFreeDisk,
+			})
+			if tt.expectedError == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), tt.expectedError) {
+				t.Errorf("expected error %q, got %q", tt.expectedError, err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+
+package internal
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// filesystemSpace returns the available and total bytes of the filesystem holding the path
+func filesystemSpace(path string) (uint64, uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, 0, fmt.Errorf("error reading filesystem stats for %s: %v", path, err)
+	}
+
+	return uint64(stat.Bavail) * uint64(stat.Bsize), uint64(stat.Blocks) * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,12 @@
+//go:build windows
+
+package internal
+
+import (
+	"fmt"
+)
+
+// filesystemSpace returns the available and total bytes of the filesystem holding the path
+func filesystemSpace(path string) (uint64, uint64, error) {
+	return 0, 0, fmt.Errorf("reading free disk space is not supported on windows")
+}
@@ -1,23 +1,67 @@
 package internal
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
+	"math"
+	"sync/atomic"
+	"time"
 
+	"github.com/docker/cli/cli/config"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/registry"
+	"github.com/docker/docker/api/types/system"
+	"github.com/docker/docker/api/types/volume"
 	dockerClient "github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	parser "github.com/novln/docker-parser"
 )
 
 // DockerClientInterface is an interface for the Docker client
 type DockerClientInterface interface {
 	Close() error
+	ContainerExec(ctx context.Context, containerID string, options ContainerExecOptions) (int, error)
 	ContainerInspect(ctx context.Context, containerID string) (container.InspectResponse, error)
 	ContainerList(ctx context.Context, options container.ListOptions) ([]container.Summary, error)
+	ContainerLogs(ctx context.Context, containerID string, options container.LogsOptions) (string, error)
 	ContainerRemove(ctx context.Context, containerID string, options container.RemoveOptions) error
 	ContainerRename(ctx context.Context, containerID, newName string) error
 	ContainerStart(ctx context.Context, containerID string, options container.StartOptions) error
 	ContainerStop(ctx context.Context, containerID string, options container.StopOptions) error
 	ContainerTerminate(ctx context.Context, containerID string) error
+	ContainerTerminateWithTimeout(ctx context.Context, containerID string, stopTimeout time.Duration) error
+	ContainerUpdate(ctx context.Context, containerID string, updateConfig container.UpdateConfig) (container.UpdateResponse, error)
+	ContainerWait(ctx context.Context, containerID string, condition container.WaitCondition) (<-chan container.WaitResponse, <-chan error)
+	DiskUsage(ctx context.Context) (DiskSpace, error)
+	DistributionInspect(ctx context.Context, imageRef string) (registry.DistributionInspect, error)
+	Events(ctx context.Context, options events.ListOptions) (<-chan events.Message, <-chan error)
+	ImageInspect(ctx context.Context, imageID string) (image.InspectResponse, error)
+	Info(ctx context.Context) (system.Info, error)
+	NetworkList(ctx context.Context, options network.ListOptions) ([]network.Summary, error)
+	NetworkRemove(ctx context.Context, networkID string) error
+	VolumeList(ctx context.Context, options volume.ListOptions) (volume.ListResponse, error)
+	VolumeRemove(ctx context.Context, volumeID string, force bool) error
+}
+
+// ContainerExecOptions configures a command run inside a running container
+type ContainerExecOptions struct {
+	// Cmd is the command to run, along with its arguments
+	Cmd []string
+	// ConsoleSize is the initial height and width of the TTY, if one is allocated
+	ConsoleSize *[2]uint
+	// Stderr receives the standard error of the command. With a TTY, standard error is merged into Stdout.
+	Stderr io.Writer
+	// Stdin is attached to the standard input of the command, if set
+	Stdin io.Reader
+	// Stdout receives the standard output of the command
+	Stdout io.Writer
+	// Tty is whether to allocate a pseudo-TTY for the command
+	Tty bool
 }
 
 // DockerClient is a wrapper around the Docker client
@@ -26,7 +70,14 @@ type DockerClient struct {
 	cli *dockerClient.Client
 }
 
-// NewDockerClient returns a new Docker client instance
+// dockerClientsCreated counts the Docker clients created by the process.
+// A deploy reuses the client it is handed, so the count must not change
+// while one runs.
+var dockerClientsCreated atomic.Int64
+
+// NewDockerClient returns a new Docker client instance. The caller owns the
+// client and must close it once done, as every client holds its own
+// connection pool.
 func NewDockerClient() (DockerClientInterface, error) {
 	cli, err := dockerClient.NewClientWithOpts(
 		dockerClient.FromEnv,
@@ -35,6 +86,7 @@ func NewDockerClient() (DockerClientInterface, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error creating Docker client: %v", err)
 	}
+	dockerClientsCreated.Add(1)
 	return &DockerClient{cli: cli}, nil
 }
 
@@ -73,10 +125,17 @@ func (d *DockerClient) ContainerStart(ctx context.Context, containerID string, o
 	return d.cli.ContainerStart(ctx, containerID, options)
 }
 
-// ContainerTerminate terminates a container
+// ContainerTerminate terminates a container, giving it 10 seconds to exit
+// before it is killed
 func (d *DockerClient) ContainerTerminate(ctx context.Context, containerID string) error {
-	timeoutSeconds := 10
-	if err := d.cli.ContainerStop(ctx, containerID, container.StopOptions{Timeout: &timeoutSeconds}); err != nil {
+	return d.ContainerTerminateWithTimeout(ctx, containerID, 10*time.Second)
+}
+
+// ContainerTerminateWithTimeout stops and removes a container, giving it the
+// stop timeout to exit before it is killed. A zero stop timeout leaves the
+// container's own, which compose sets from the service's stop_grace_period.
+func (d *DockerClient) ContainerTerminateWithTimeout(ctx context.Context, containerID string, stopTimeout time.Duration) error {
+	if err := d.cli.ContainerStop(ctx, containerID, container.StopOptions{Timeout: stopTimeoutSeconds(stopTimeout)}); err != nil {
 		return fmt.Errorf("error stopping container: %v", err)
 	}
 
@@ -86,3 +145,215 @@ func (d *DockerClient) ContainerTerminate(ctx context.Context, containerID strin
 
 	return nil
 }
+
+// stopTimeoutSeconds returns the stop timeout in the whole seconds the Docker
+// API takes, rounded up so a sub-second timeout is not turned into an
+// immediate kill, or nil for a zero timeout to leave the container's own
+func stopTimeoutSeconds(stopTimeout time.Duration) *int {
+	if stopTimeout <= 0 {
+		return nil
+	}
+
+	timeoutSeconds := int(math.Ceil(stopTimeout.Seconds()))
+	return &timeoutSeconds
+}
+
+// ContainerUpdate changes the resource limits of a container in place
+func (d *DockerClient) ContainerUpdate(ctx context.Context, containerID string, updateConfig container.UpdateConfig) (container.UpdateResponse, error) {
+	return d.cli.ContainerUpdate(ctx, containerID, updateConfig)
+}
+
+// ContainerWait waits for a container to reach the given condition
+func (d *DockerClient) ContainerWait(ctx context.Context, containerID string, condition container.WaitCondition) (<-chan container.WaitResponse, <-chan error) {
+	return d.cli.ContainerWait(ctx, containerID, condition)
+}
+
+// DiskUsage reports the free space on the filesystem holding the Docker
+// data-root. The filesystem is read from the host running the command, so
+// this requires the Docker daemon to be local.
+func (d *DockerClient) DiskUsage(ctx context.Context) (DiskSpace, error) {
+	info, err := d.cli.Info(ctx)
+	if err != nil {
+		return DiskSpace{}, fmt.Errorf("error getting docker info: %v", err)
+	}
+
+	available, total, err := filesystemSpace(info.DockerRootDir)
+	if err != nil {
+		return DiskSpace{}, err
+	}
+
+	return DiskSpace{
+		Available: available,
+		Path:      info.DockerRootDir,
+		Total:     total,
+	}, nil
+}
+
+// DistributionInspect looks up the manifest of an image in its registry
+// without pulling it, using the credentials stored by `docker login`
+func (d *DockerClient) DistributionInspect(ctx context.Context, imageRef string) (registry.DistributionInspect, error) {
+	return d.cli.DistributionInspect(ctx, imageRef, registryAuth(imageRef))
+}
+
+// registryAuth returns the encoded credentials stored by `docker login` for
+// the registry of an image, or an empty string when there are none
+func registryAuth(imageRef string) string {
+	parsedImage, err := parser.Parse(imageRef)
+	if err != nil {
+		return ""
+	}
+
+	registryHost := parsedImage.Registry()
+	if registryHost == "docker.io" {
+		registryHost = "https://index.docker.io/v1/"
+	}
+
+	auth, err := config.LoadDefaultConfigFile(io.Discard).GetAuthConfig(registryHost)
+	if err != nil || (auth.Username == "" && auth.IdentityToken == "" && auth.RegistryToken == "") {
+		return ""
+	}
+
+	encoded, err := registry.EncodeAuthConfig(registry.AuthConfig{
+		Auth:          auth.Auth,
+		IdentityToken: auth.IdentityToken,
+		Password:      auth.Password,
+		RegistryToken: auth.RegistryToken,
+		ServerAddress: auth.ServerAddress,
+		Username:      auth.Username,
+	})
+	if err != nil {
+		return ""
+	}
+	return encoded
+}
+
+// Events streams the events of the Docker daemon matching the given filters
+// until the context is canceled
+func (d *DockerClient) Events(ctx context.Context, options events.ListOptions) (<-chan events.Message, <-chan error) {
+	return d.cli.Events(ctx, options)
+}
+
+// ImageInspect inspects a local image
+func (d *DockerClient) ImageInspect(ctx context.Context, imageID string) (image.InspectResponse, error) {
+	return d.cli.ImageInspect(ctx, imageID)
+}
+
+// Info returns system-wide information about the Docker daemon, including
+// the plugins it has registered
+func (d *DockerClient) Info(ctx context.Context) (system.Info, error) {
+	return d.cli.Info(ctx)
+}
+
+// NetworkList lists networks
+func (d *DockerClient) NetworkList(ctx context.Context, options network.ListOptions) ([]network.Summary, error) {
+	return d.cli.NetworkList(ctx, options)
+}
+
+// NetworkRemove removes a network
+func (d *DockerClient) NetworkRemove(ctx context.Context, networkID string) error {
+	return d.cli.NetworkRemove(ctx, networkID)
+}
+
+// VolumeList lists volumes
+func (d *DockerClient) VolumeList(ctx context.Context, options volume.ListOptions) (volume.ListResponse, error) {
+	return d.cli.VolumeList(ctx, options)
+}
+
+// VolumeRemove removes a volume
+func (d *DockerClient) VolumeRemove(ctx context.Context, volumeID string, force bool) error {
+	return d.cli.VolumeRemove(ctx, volumeID, force)
+}
+
+// ContainerLogs returns the output of a container, with stdout and stderr
+// interleaved as the daemon recorded them
+func (d *DockerClient) ContainerLogs(ctx context.Context, containerID string, options container.LogsOptions) (string, error) {
+	inspect, err := d.cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return "", fmt.Errorf("error inspecting container: %v", err)
+	}
+
+	reader, err := d.cli.ContainerLogs(ctx, containerID, options)
+	if err != nil {
+		return "", fmt.Errorf("error reading container logs: %v", err)
+	}
+	defer reader.Close()
+
+	// without a TTY, the daemon multiplexes stdout and stderr on one stream
+	var output bytes.Buffer
+	if inspect.Config != nil && inspect.Config.Tty {
+		_, err = io.Copy(&output, reader)
+	} else {
+		_, err = stdcopy.StdCopy(&output, &output, reader)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error reading container logs: %v", err)
+	}
+
+	return output.String(), nil
+}
+
+// ContainerExec runs a command inside a running container, streaming its
+// input and output, and returns the exit code of the command
+func (d *DockerClient) ContainerExec(ctx context.Context, containerID string, options ContainerExecOptions) (int, error) {
+	stdout := options.Stdout
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	stderr := options.Stderr
+	if stderr == nil {
+		stderr = io.Discard
+	}
+
+	created, err := d.cli.ContainerExecCreate(ctx, containerID, container.ExecOptions{
+		AttachStderr: true,
+		AttachStdin:  options.Stdin != nil,
+		AttachStdout: true,
+		Cmd:          options.Cmd,
+		ConsoleSize:  options.ConsoleSize,
+		Tty:          options.Tty,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error creating exec: %v", err)
+	}
+
+	attached, err := d.cli.ContainerExecAttach(ctx, created.ID, container.ExecAttachOptions{
+		ConsoleSize: options.ConsoleSize,
+		Tty:         options.Tty,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error attaching to exec: %v", err)
+	}
+	defer attached.Close()
+
+	// the attached stream does not observe the context, so it is closed
+	// once the context is done to unblock the read below
+	stop := context.AfterFunc(ctx, attached.Close)
+	defer stop()
+
+	if options.Stdin != nil {
+		go func() {
+			_, _ = io.Copy(attached.Conn, options.Stdin)
+			_ = attached.CloseWrite()
+		}()
+	}
+
+	// without a TTY, the daemon multiplexes stdout and stderr on one stream
+	if options.Tty {
+		_, err = io.Copy(stdout, attached.Reader)
+	} else {
+		_, err = stdcopy.StdCopy(stdout, stderr, attached.Reader)
+	}
+	if ctx.Err() != nil {
+		return 0, fmt.Errorf("error reading exec output: %v", ctx.Err())
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error reading exec output: %v", err)
+	}
+
+	inspect, err := d.cli.ContainerExecInspect(ctx, created.ID)
+	if err != nil {
+		return 0, fmt.Errorf("error inspecting exec: %v", err)
+	}
+
+	return inspect.ExitCode, nil
+}
@@ -0,0 +1,25 @@
+package internal
+
+import (
+	"fmt"
+	"time"
+)
+
+// ParseDurationFlag parses the value of a duration flag or setting, such as
+// `30s` or `5m`. An empty value is treated as unset and returns 0.
+func ParseDurationFlag(name string, value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s value %q: expected a duration such as 30s or 5m", name, value)
+	}
+
+	if duration < 0 {
+		return 0, fmt.Errorf("invalid %s value %q: duration must not be negative", name, value)
+	}
+
+	return duration, nil
+}
@@ -0,0 +1,45 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDurationFlag(t *testing.T) {
+	tests := []struct {
+		name          string
+		value         string
+		expected      time.Duration
+		expectedError string
+	}{
+		{name: "unset", value: "", expected: 0},
+		{name: "seconds", value: "30s", expected: 30 * time.Second},
+		{name: "minutes", value: "5m", expected: 5 * time.Minute},
+		{name: "compound", value: "1m30s", expected: 90 * time.Second},
+		{name: "missing unit", value: "30", expectedError: `invalid --timeout value "30": expected a duration such as 30s or 5m`},
+		{name: "garbage", value: "soon", expectedError: `invalid --timeout value "soon": expected a duration such as 30s or 5m`},
+		{name: "negative", value: "-5s", expectedError: `invalid --timeout value "-5s": duration must not be negative`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDurationFlag("--timeout", tt.value)
+			if tt.expectedError != "" {
+				if err == nil {
+					t.Fatalf("expected error, got nil")
+				}
+				if err.Error() != tt.expectedError {
+					t.Errorf("expected error %q, got %q", tt.expectedError, err.Error())
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/josegonzalez/cli-skeleton/command"
+)
+
+// EnvFromContainersInput is the input for the envFromContainers function
+type EnvFromContainersInput struct {
+	// Client is the Docker client to use
+	Client DockerClientInterface
+	// Logger is the logger to use
+	Logger *command.ZerologUi
+	// ProjectLabel overrides the com.docker.compose.project label value used to discover containers. Defaults to ProjectName.
+	ProjectLabel string
+	// ProjectName is the name of the project
+	ProjectName string
+	// Specs are the variables to copy, each in the form service:KEY
+	Specs []string
+}
+
+// parseEnvFromContainer splits a service:KEY spec into its service and key
+func parseEnvFromContainer(spec string) (string, string, error) {
+	serviceName, key, ok := strings.Cut(spec, ":")
+	if !ok || serviceName == "" || key == "" || strings.Contains(key, "=") {
+		return "", "", fmt.Errorf("invalid env from container value %s: expected service:KEY", spec)
+	}
+	return serviceName, key, nil
+}
+
+// envFromContainers reads environment variables off the newest running
+// container of each referenced service. The values are escaped so compose
+// does not interpolate them when the overlay carrying them is loaded.
+func envFromContainers(ctx context.Context, input EnvFromContainersInput) (map[string]string, error) {
+	env := map[string]string{}
+	for _, spec := range input.Specs {
+		serviceName, key, err := parseEnvFromContainer(spec)
+		if err != nil {
+			return nil, err
+		}
+
+		containers, err := composeContainers(ComposeContainersInput{
+			Client:       input.Client,
+			ProjectLabel: input.ProjectLabel,
+			ProjectName:  input.ProjectName,
+			ServiceName:  serviceName,
+			Status:       "running",
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error getting containers for service %s: %v", serviceName, err)
+		}
+		if len(containers) == 0 {
+			return nil, fmt.Errorf("no running containers to copy %s from for service %s", key, serviceName)
+		}
+		sortContainersByCreationTime(containers, true)
+		source := containers[0]
+
+		containerJSON, err := input.Client.ContainerInspect(ctx, source.ID)
+		if err != nil {
+			return nil, fmt.Errorf("error inspecting container %s: %v", source.ID[:12], err)
+		}
+
+		value, found := "", false
+		if containerJSON.Config != nil {
+			for _, entry := range containerJSON.Config.Env {
+				if name, v, ok := strings.Cut(entry, "="); ok && name == key {
+					value, found = v, true
+				}
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("environment variable %s is not set on container %s of service %s", key, source.ID[:12], serviceName)
+		}
+
+		// values are not logged, as copied variables are usually secrets
+		input.Logger.Info(fmt.Sprintf("Copying environment variable from container: service=%s, container=%s, key=%s", serviceName, source.ID[:12], key))
+		env[key] = strings.ReplaceAll(value, "$", "$$")
+	}
+
+	return env, nil
+}
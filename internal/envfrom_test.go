@@ -0,0 +1,92 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/josegonzalez/cli-skeleton/command"
+	"github.com/rs/zerolog"
+)
+
+func TestEnvFromContainers(t *testing.T) {
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	mockClient := &mockDockerClient{
+		containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+			if !slices.Contains(options.Filters.Get("label"), "com.docker.compose.service=vault-agent") {
+				return []container.Summary{}, nil
+			}
+			return []container.Summary{
+				{ID: "old_agent_container_id", Created: 100},
+				{ID: "new_agent_container_id", Created: 200},
+			}, nil
+		},
+		containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+			env := []string{"PATH=/usr/bin", "DB_PASSWORD=stale"}
+			if id == "new_agent_container_id" {
+				env = []string{"PATH=/usr/bin", "DB_PASSWORD=pa$$=word", "API_TOKEN=token"}
+			}
+			return container.InspectResponse{
+				ContainerJSONBase: &container.ContainerJSONBase{ID: id},
+				Config:            &container.Config{Env: env},
+			}, nil
+		},
+	}
+
+	t.Run("copies from the newest container", func(t *testing.T) {
+		env, err := envFromContainers(context.Background(), EnvFromContainersInput{
+			Client:      mockClient,
+			Logger:      logger,
+			ProjectName: "test",
+			Specs:       []string{"vault-agent:DB_PASSWORD", "vault-agent:API_TOKEN"},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if env["DB_PASSWORD"] != "pa$$$$=word" {
+			t.Errorf("expected the escaped value from the newest container, got %q", env["DB_PASSWORD"])
+		}
+		if env["API_TOKEN"] != "token" {
+			t.Errorf("expected API_TOKEN to be copied, got %q", env["API_TOKEN"])
+		}
+		if strings.Contains(buf.String(), "pa$$=word") {
+			t.Errorf("expected the value not to be logged, got %s", buf.String())
+		}
+	})
+
+	tests := []struct {
+		name          string
+		spec          string
+		expectedError string
+	}{
+		{name: "missing key", spec: "vault-agent", expectedError: "invalid env from container value vault-agent: expected service:KEY"},
+		{name: "unset variable", spec: "vault-agent:MISSING", expectedError: "environment variable MISSING is not set on container new_agent_co of service vault-agent"},
+		{name: "no running containers", spec: "web:DB_PASSWORD", expectedError: "no running containers to copy DB_PASSWORD from for service web"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := envFromContainers(context.Background(), EnvFromContainersInput{
+				Client:      mockClient,
+				Logger:      logger,
+				ProjectName: "test",
+				Specs:       []string{tt.spec},
+			})
+			if err == nil || err.Error() != tt.expectedError {
+				t.Errorf("expected error %q, got %v", tt.expectedError, err)
+			}
+		})
+	}
+}
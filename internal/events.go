@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	// EventProjectStarted is emitted when a project deploy begins
+	EventProjectStarted = "project_started"
+	// EventProjectCompleted is emitted when a project deploy succeeds
+	EventProjectCompleted = "project_completed"
+	// EventProjectFailed is emitted when a project deploy fails
+	EventProjectFailed = "project_failed"
+	// EventServiceStarted is emitted when a service deploy begins
+	EventServiceStarted = "service_started"
+	// EventServiceCompleted is emitted when a service deploy succeeds
+	EventServiceCompleted = "service_completed"
+	// EventServiceFailed is emitted when a service deploy fails
+	EventServiceFailed = "service_failed"
+)
+
+// Event is a structured record of a deploy phase
+type Event struct {
+	// Error is the error message of a failed phase
+	Error string `json:"error,omitempty"`
+	// Phase is the deploy phase the event records
+	Phase string `json:"phase"`
+	// Project is the name of the project
+	Project string `json:"project,omitempty"`
+	// Service is the name of the service, if the event is scoped to one
+	Service string `json:"service,omitempty"`
+	// Time is when the event was emitted
+	Time time.Time `json:"time"`
+}
+
+// EventEmitter writes deploy events as JSON lines. A nil emitter discards
+// every event, so callers do not need to check whether one is configured.
+type EventEmitter struct {
+	encoder *json.Encoder
+	mu      sync.Mutex
+}
+
+// NewEventEmitter creates an emitter writing to the given writer
+func NewEventEmitter(w io.Writer) *EventEmitter {
+	return &EventEmitter{
+		encoder: json.NewEncoder(w),
+	}
+}
+
+// Emit writes a single event, stamping its time if unset
+func (e *EventEmitter) Emit(event Event) error {
+	if e == nil {
+		return nil
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	if err := e.encoder.Encode(event); err != nil {
+		return fmt.Errorf("error writing event: %v", err)
+	}
+	return nil
+}
+
+// emitResult emits the completed or failed phase for the given result
+func (e *EventEmitter) emitResult(event Event, completedPhase string, failedPhase string, err error) {
+	event.Phase = completedPhase
+	if err != nil {
+		event.Phase = failedPhase
+		event.Error = err.Error()
+	}
+	_ = e.Emit(event)
+}
@@ -0,0 +1,125 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/josegonzalez/cli-skeleton/command"
+	"github.com/rs/zerolog"
+)
+
+func TestDeployProjectEventsFile(t *testing.T) {
+	mockClient := &mockDockerClient{
+		containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+			return []container.Summary{}, nil
+		},
+	}
+
+	mockExecutor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+		return ExecCommandResponse{ExitCode: 0}, nil
+	}
+
+	project := &types.Project{
+		Services: types.Services{
+			"web": types.ServiceConfig{
+				Name: "web",
+			},
+			"worker": types.ServiceConfig{
+				Name: "worker",
+				DependsOn: types.DependsOnConfig{
+					"web": types.ServiceDependency{Condition: types.ServiceConditionStarted},
+				},
+				Deploy: &types.DeployConfig{
+					UpdateConfig: &types.UpdateConfig{
+						Extensions: types.Extensions{"x-healthcheck-success-threshold": "many"},
+					},
+				},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	eventsPath := filepath.Join(t.TempDir(), "events.jsonl")
+	eventsFile, err := os.Create(eventsPath)
+	if err != nil {
+		t.Fatalf("unexpected error creating events file: %v", err)
+	}
+
+	err = DeployProject(context.Background(), DeployProjectInput{
+		Client:                mockClient,
+		ComposeFile:           "/tmp/docker-compose.yaml",
+		ContainerNameTemplate: "{{.ServiceName}}",
+		Events:                NewEventEmitter(eventsFile),
+		Executor:              mockExecutor,
+		Logger:                logger,
+		Project:               project,
+		ProjectName:           "test",
+	})
+	if err == nil {
+		t.Fatal("expected the worker deploy to fail")
+	}
+	if err := eventsFile.Close(); err != nil {
+		t.Fatalf("unexpected error closing events file: %v", err)
+	}
+
+	contents, err := os.Open(eventsPath)
+	if err != nil {
+		t.Fatalf("unexpected error opening events file: %v", err)
+	}
+	defer contents.Close()
+
+	events := []Event{}
+	scanner := bufio.NewScanner(contents)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("unexpected error parsing event %q: %v", scanner.Text(), err)
+		}
+		events = append(events, event)
+	}
+
+	expected := []Event{
+		{Phase: EventProjectStarted, Project: "test"},
+		{Phase: EventServiceStarted, Project: "test", Service: "web"},
+		{Phase: EventServiceCompleted, Project: "test", Service: "web"},
+		{Phase: EventServiceStarted, Project: "test", Service: "worker"},
+		{Phase: EventServiceFailed, Project: "test", Service: "worker"},
+		{Phase: EventProjectFailed, Project: "test"},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events, got %d: %+v", len(expected), len(events), events)
+	}
+	for i, event := range events {
+		if event.Phase != expected[i].Phase || event.Project != expected[i].Project || event.Service != expected[i].Service {
+			t.Errorf("event %d: expected %s %s/%s, got %s %s/%s", i, expected[i].Phase, expected[i].Project, expected[i].Service, event.Phase, event.Project, event.Service)
+		}
+		if event.Time.IsZero() {
+			t.Errorf("event %d: expected a timestamp", i)
+		}
+	}
+	if events[4].Error == "" || events[5].Error == "" {
+		t.Errorf("expected failed events to carry the error, got %+v", events)
+	}
+}
+
+func TestEventEmitterNil(t *testing.T) {
+	var emitter *EventEmitter
+	if err := emitter.Emit(Event{Phase: EventProjectStarted}); err != nil {
+		t.Errorf("expected a nil emitter to discard events, got %v", err)
+	}
+}
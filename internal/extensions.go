@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/josegonzalez/cli-skeleton/command"
+)
+
+// deployExtension is an x- extension read while resolving the deploy
+// settings of a service
+type deployExtension struct {
+	// Name is the name of the extension, such as x-scale-step
+	Name string
+	// OverriddenBy returns whether a flag takes precedence over the extension. If nil, the extension always applies.
+	OverriddenBy func(input DeployServiceInput) bool
+	// ServiceLevel is whether the extension is set on the service itself rather than in its update_config section
+	ServiceLevel bool
+	// Value returns the effective value of the extension. If nil, the value set in the compose file is used.
+	Value func(params DeployParams) interface{}
+}
+
+// deployExtensions are the x- extensions applied when deploying a service
+var deployExtensions = []deployExtension{
+	{Name: "x-cleanup-run-hooks", Value: func(params DeployParams) interface{} { return params.CleanupRunHooks }},
+	{Name: "x-container-name-template", ServiceLevel: true, Value: func(params DeployParams) interface{} { return params.ContainerNameTemplate }},
+	{Name: "x-container-timeout", OverriddenBy: func(input DeployServiceInput) bool { return input.ContainerTimeout > 0 }, Value: func(params DeployParams) interface{} { return params.ContainerTimeout.String() }},
+	{Name: "x-drain-command", Value: func(params DeployParams) interface{} { return params.DrainCommand }},
+	{Name: "x-drain-timeout", Value: func(params DeployParams) interface{} { return params.DrainTimeout.String() }},
+	{Name: "x-healthcheck-expect-output", Value: func(params DeployParams) interface{} { return params.HealthcheckExpectOutput.String() }},
+	{Name: "x-healthcheck-host-command", OverriddenBy: func(input DeployServiceInput) bool { return input.HealthcheckCommandFile != "" }},
+	{Name: "x-healthcheck-host-command-file", OverriddenBy: func(input DeployServiceInput) bool { return input.HealthcheckCommandFile != "" }},
+	{Name: "x-healthcheck-mode", Value: func(params DeployParams) interface{} { return params.HealthcheckMode }},
+	{Name: "x-healthcheck-scheme", Value: func(params DeployParams) interface{} { return params.HealthcheckScheme }},
+	{Name: "x-healthcheck-success-threshold", Value: func(params DeployParams) interface{} { return params.SuccessThreshold }},
+	{Name: "x-healthcheck-timeout-action", Value: func(params DeployParams) interface{} { return params.HealthcheckTimeoutAction }},
+	{Name: "x-maintenance-service", Value: func(params DeployParams) interface{} { return params.MaintenanceService }},
+	{Name: "x-on-healthy-host-command", Value: func(params DeployParams) interface{} { return params.OnHealthyHostCommand }},
+	{Name: "x-on-unhealthy-host-command", Value: func(params DeployParams) interface{} { return params.OnUnhealthyHostCommand }},
+	{Name: "x-per-replica-volume", ServiceLevel: true, Value: func(params DeployParams) interface{} { return params.PerReplicaVolume }},
+	{Name: "x-post-stop-host-command", Value: func(params DeployParams) interface{} { return params.PostStopHostCommand }},
+	{Name: "x-pre-stop-command", Value: func(params DeployParams) interface{} { return params.PreStopCommand }},
+	{Name: "x-pre-stop-host-command", Value: func(params DeployParams) interface{} { return params.PreStopHostCommand }},
+	{Name: "x-pre-stop-order", Value: func(params DeployParams) interface{} { return params.PreStopOrder }},
+	{Name: "x-run-to-completion", Value: func(params DeployParams) interface{} { return params.RunToCompletion }},
+	{Name: "x-running-grace", Value: func(params DeployParams) interface{} { return params.RunningGrace.String() }},
+	{Name: "x-scale-down-order", Value: func(params DeployParams) interface{} { return params.ScaleDownOrder }},
+	{Name: "x-scale-down-parallelism", Value: func(params DeployParams) interface{} { return params.ScaleDownParallelism }},
+	{Name: "x-scale-step", Value: func(params DeployParams) interface{} { return params.ScaleStep }},
+	{Name: "x-service-readiness-command", Value: func(params DeployParams) interface{} { return params.ServiceReadinessCommand }},
+	{Name: "x-smoke-test-command", Value: func(params DeployParams) interface{} { return params.SmokeTestCommand }},
+}
+
+// appliedExtensions returns the x- extensions set on the service that took
+// effect, keyed by name, along with their effective values. Extensions that
+// are unknown or overridden by a flag are left out.
+func appliedExtensions(input DeployServiceInput, service *types.ServiceConfig, params DeployParams) map[string]interface{} {
+	applied := map[string]interface{}{}
+	for _, extension := range deployExtensions {
+		var value interface{}
+		var ok bool
+		if extension.ServiceLevel {
+			value, ok = service.Extensions[extension.Name]
+		} else {
+			value, ok = params.Extensions[extension.Name]
+		}
+		if !ok {
+			continue
+		}
+
+		if extension.OverriddenBy != nil && extension.OverriddenBy(input) {
+			continue
+		}
+
+		if extension.Value != nil {
+			value = extension.Value(params)
+		}
+		applied[extension.Name] = value
+	}
+	return applied
+}
+
+// logAppliedExtensions logs the x- extensions that took effect for a
+// deployed service as a single structured debug record, so it can be
+// confirmed that the compose file was read as intended
+func logAppliedExtensions(logger *command.ZerologUi, input DeployServiceInput, service *types.ServiceConfig, params DeployParams) {
+	logger.StdoutLogger.Debug().
+		Str("service", service.Name).
+		Interface("extensions", appliedExtensions(input, service, params)).
+		Msg("Applied extensions")
+}
@@ -0,0 +1,80 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/josegonzalez/cli-skeleton/command"
+	"github.com/rs/zerolog"
+)
+
+func TestLogAppliedExtensions(t *testing.T) {
+	service := &types.ServiceConfig{
+		Name:  "web",
+		Image: "nginx:1.27",
+		Deploy: &types.DeployConfig{
+			UpdateConfig: &types.UpdateConfig{
+				Order: "start-first",
+				Extensions: types.Extensions{
+					"x-container-timeout": "2m",
+					"x-scale-step":        2,
+					"x-unknown":           "ignored",
+				},
+			},
+		},
+	}
+
+	params, err := resolveDeployParams(context.Background(), DeployServiceInput{}, service)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger: zerolog.New(&buf).Level(zerolog.DebugLevel),
+		StdoutLogger: zerolog.New(&buf).Level(zerolog.DebugLevel),
+	}
+	logAppliedExtensions(logger, DeployServiceInput{}, service, params)
+
+	var record struct {
+		Extensions map[string]interface{} `json:"extensions"`
+		Message    string                 `json:"message"`
+		Service    string                 `json:"service"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("expected a single JSON record, got %q: %v", buf.String(), err)
+	}
+	if record.Message != "Applied extensions" || record.Service != "web" {
+		t.Errorf("expected an applied extensions record for web, got %q", buf.String())
+	}
+
+	expected := map[string]interface{}{
+		"x-container-timeout": "2m0s",
+		"x-scale-step":        float64(2),
+	}
+	if len(record.Extensions) != len(expected) {
+		t.Errorf("expected only the applied extensions %v, got %v", expected, record.Extensions)
+	}
+	for name, value := range expected {
+		if record.Extensions[name] != value {
+			t.Errorf("expected %s=%v, got %v", name, value, record.Extensions[name])
+		}
+	}
+	for _, name := range []string{"x-smoke-test-command", "x-unknown"} {
+		if _, ok := record.Extensions[name]; ok {
+			t.Errorf("expected %s to be left out, got %v", name, record.Extensions)
+		}
+	}
+
+	t.Run("overridden by a flag", func(t *testing.T) {
+		input := DeployServiceInput{ContainerTimeout: time.Minute}
+		applied := appliedExtensions(input, service, params)
+		if _, ok := applied["x-container-timeout"]; ok {
+			t.Errorf("expected x-container-timeout to be left out when overridden, got %v", applied)
+		}
+	})
+}
@@ -0,0 +1,143 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"go.yaml.in/yaml/v4"
+)
+
+// FlagRule declares how a flag relates to other flags and to the service
+// name argument
+type FlagRule struct {
+	// ConflictsWith are the flags that cannot be set alongside the flag
+	ConflictsWith []string
+	// Flag is the name of the flag, without the leading dashes
+	Flag string
+	// ForbidsService is whether the flag cannot be used when deploying a single service
+	ForbidsService bool
+	// Requires are the flags that must also be set when the flag is set
+	Requires []string
+	// RequiresService is whether the flag can only be used when deploying a single service
+	RequiresService bool
+}
+
+// ValidateFlagsInput is the input for the ValidateFlags function
+type ValidateFlagsInput struct {
+	// Changed reports whether a flag was explicitly set
+	Changed func(name string) bool
+	// Rules are the flag relationships to check
+	Rules []FlagRule
+	// ServiceName is the service name argument, if any
+	ServiceName string
+}
+
+// ValidateFlags checks the set flags against the declared rules, returning a
+// single error listing every violated rule
+func ValidateFlags(input ValidateFlagsInput) error {
+	violations := []string{}
+	for _, rule := range input.Rules {
+		if !input.Changed(rule.Flag) {
+			continue
+		}
+
+		if rule.RequiresService && input.ServiceName == "" {
+			violations = append(violations, fmt.Sprintf("--%s flag requires a service name argument", rule.Flag))
+		}
+		if rule.ForbidsService && input.ServiceName != "" {
+			violations = append(violations, fmt.Sprintf("--%s flag cannot be used with a service name argument", rule.Flag))
+		}
+		for _, conflict := range rule.ConflictsWith {
+			if input.Changed(conflict) {
+				violations = append(violations, fmt.Sprintf("--%s and --%s flags cannot be used together", rule.Flag, conflict))
+			}
+		}
+		for _, required := range rule.Requires {
+			if !input.Changed(required) {
+				violations = append(violations, fmt.Sprintf("--%s flag requires the --%s flag", rule.Flag, required))
+			}
+		}
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(violations, "; "))
+}
+
+// FlagConfigFile is the name of the file in the project directory providing
+// default flag values
+const FlagConfigFile = ".orchestrate.yaml"
+
+// LoadFlagConfig reads a YAML file mapping flag names, without the leading
+// dashes, to default values. A list sets a flag that can be specified
+// multiple times once per entry.
+func LoadFlagConfig(path string) (map[string][]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %v", err)
+	}
+
+	values := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %v", path, err)
+	}
+
+	config := map[string][]string{}
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		switch value := values[name].(type) {
+		case nil, map[string]interface{}:
+			return nil, fmt.Errorf("invalid value for %s in config file %s: expected a scalar or a list", name, path)
+		case []interface{}:
+			config[name] = []string{}
+			for _, entry := range value {
+				switch entry.(type) {
+				case nil, map[string]interface{}, []interface{}:
+					return nil, fmt.Errorf("invalid value for %s in config file %s: expected a list of scalars", name, path)
+				}
+				config[name] = append(config[name], fmt.Sprint(entry))
+			}
+		default:
+			config[name] = []string{fmt.Sprint(value)}
+		}
+	}
+
+	return config, nil
+}
+
+// ApplyFlagConfigInput is the input for the ApplyFlagConfig function
+type ApplyFlagConfigInput struct {
+	// Changed reports whether a flag was explicitly set on the command line
+	Changed func(name string) bool
+	// Config maps flag names to the values read from the config file
+	Config map[string][]string
+	// Path is the path to the config file, used in errors
+	Path string
+	// Set sets the value of a flag, appending to flags that can be specified multiple times
+	Set func(name string, value string) error
+}
+
+// ApplyFlagConfig sets each flag in the config that was not explicitly set
+// on the command line, so command line flags override the config file
+func ApplyFlagConfig(input ApplyFlagConfigInput) error {
+	for _, name := range slices.Sorted(maps.Keys(input.Config)) {
+		if name == "config" {
+			return fmt.Errorf("invalid flag config in config file %s: a config file cannot load another", input.Path)
+		}
+		if input.Changed(name) {
+			continue
+		}
+
+		for _, value := range input.Config[name] {
+			if err := input.Set(name, value); err != nil {
+				return fmt.Errorf("error applying %s from config file %s: %v", name, input.Path, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,189 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestValidateFlags(t *testing.T) {
+	rules := []FlagRule{
+		{Flag: "keep-old", ConflictsWith: []string{"max-old-containers"}},
+		{Flag: "replicas", RequiresService: true},
+		{Flag: "select", ForbidsService: true},
+		{Flag: "inherit-label", Requires: []string{"keep-old"}},
+	}
+
+	tests := []struct {
+		name          string
+		changed       []string
+		serviceName   string
+		expectedError string
+	}{
+		{
+			name:    "no flags",
+			changed: []string{},
+		},
+		{
+			name:        "compatible flags",
+			changed:     []string{"keep-old", "replicas", "inherit-label"},
+			serviceName: "web",
+		},
+		{
+			name:          "conflicting flags",
+			changed:       []string{"keep-old", "max-old-containers"},
+			expectedError: "--keep-old and --max-old-containers flags cannot be used together",
+		},
+		{
+			name:          "flag requiring a service name",
+			changed:       []string{"replicas"},
+			expectedError: "--replicas flag requires a service name argument",
+		},
+		{
+			name:          "flag forbidding a service name",
+			changed:       []string{"select"},
+			serviceName:   "web",
+			expectedError: "--select flag cannot be used with a service name argument",
+		},
+		{
+			name:          "flag missing a dependency",
+			changed:       []string{"inherit-label"},
+			expectedError: "--inherit-label flag requires the --keep-old flag",
+		},
+		{
+			name:          "multiple violations",
+			changed:       []string{"keep-old", "max-old-containers", "select"},
+			serviceName:   "web",
+			expectedError: "--keep-old and --max-old-containers flags cannot be used together; --select flag cannot be used with a service name argument",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateFlags(ValidateFlagsInput{
+				Changed: func(name string) bool {
+					return slices.Contains(tt.changed, name)
+				},
+				Rules:       rules,
+				ServiceName: tt.serviceName,
+			})
+			if tt.expectedError == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if err.Error() != tt.expectedError {
+				t.Errorf("expected error %q, got %q", tt.expectedError, err.Error())
+			}
+		})
+	}
+}
+
+func TestApplyFlagConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FlagConfigFile)
+	contents := `container-name-template: "{{.ServiceName}}-{{.InstanceID}}"
+profile:
+  - web
+  - worker
+quiet-pull: true
+replicas-max: 4
+`
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	config, err := LoadFlagConfig(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// parse builds a flag set like the deploy command's, parsing the args
+	// before applying the config file
+	parse := func(args []string) (*pflag.FlagSet, error) {
+		f := pflag.NewFlagSet("deploy", pflag.ContinueOnError)
+		f.String("container-name-template", "{{.ProjectName}}-{{.ServiceName}}-{{.InstanceID}}", "")
+		f.StringSlice("profile", []string{}, "")
+		f.Bool("quiet-pull", false, "")
+		f.Int("replicas-max", 0, "")
+		if err := f.Parse(args); err != nil {
+			return nil, err
+		}
+		return f, ApplyFlagConfig(ApplyFlagConfigInput{
+			Changed: f.Changed,
+			Config:  config,
+			Path:    path,
+			Set:     f.Set,
+		})
+	}
+
+	t.Run("file defaults apply", func(t *testing.T) {
+		f, err := parse([]string{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if value, _ := f.GetString("container-name-template"); value != "{{.ServiceName}}-{{.InstanceID}}" {
+			t.Errorf("expected the container name template from the file, got %q", value)
+		}
+		if value, _ := f.GetStringSlice("profile"); !slices.Equal(value, []string{"web", "worker"}) {
+			t.Errorf("expected the profiles from the file, got %v", value)
+		}
+		if value, _ := f.GetBool("quiet-pull"); !value {
+			t.Error("expected quiet pull from the file")
+		}
+		if value, _ := f.GetInt("replicas-max"); value != 4 {
+			t.Errorf("expected the max replicas from the file, got %d", value)
+		}
+	})
+
+	t.Run("command line flags win", func(t *testing.T) {
+		f, err := parse([]string{"--container-name-template", "{{.ServiceName}}", "--profile", "api", "--quiet-pull=false", "--replicas-max", "2"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if value, _ := f.GetString("container-name-template"); value != "{{.ServiceName}}" {
+			t.Errorf("expected the command line container name template, got %q", value)
+		}
+		if value, _ := f.GetStringSlice("profile"); !slices.Equal(value, []string{"api"}) {
+			t.Errorf("expected only the command line profiles, got %v", value)
+		}
+		if value, _ := f.GetBool("quiet-pull"); value {
+			t.Error("expected quiet pull to be disabled from the command line")
+		}
+		if value, _ := f.GetInt("replicas-max"); value != 2 {
+			t.Errorf("expected the command line max replicas, got %d", value)
+		}
+	})
+
+	t.Run("unknown flag", func(t *testing.T) {
+		f := pflag.NewFlagSet("deploy", pflag.ContinueOnError)
+		err := ApplyFlagConfig(ApplyFlagConfigInput{
+			Changed: f.Changed,
+			Config:  map[string][]string{"paralelism": {"2"}},
+			Path:    path,
+			Set:     f.Set,
+		})
+		if err == nil || !strings.Contains(err.Error(), "error applying paralelism from config file") {
+			t.Errorf("expected an unknown flag error, got %v", err)
+		}
+	})
+
+	t.Run("invalid value", func(t *testing.T) {
+		invalidPath := filepath.Join(t.TempDir(), FlagConfigFile)
+		if err := os.WriteFile(invalidPath, []byte("profile:\n  web: true\n"), 0644); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := LoadFlagConfig(invalidPath); err == nil || !strings.Contains(err.Error(), "invalid value for profile in config file") {
+			t.Errorf("expected an invalid value error, got %v", err)
+		}
+	})
+}
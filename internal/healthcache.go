@@ -0,0 +1,174 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"golang.org/x/sync/singleflight"
+)
+
+// containerHealth is the health state of a container as seen by a single poll
+type containerHealth struct {
+	// HasHealthcheck is whether the container reports a healthcheck status
+	HasHealthcheck bool
+	// Running is whether the container is running
+	Running bool
+	// Status is the healthcheck status (starting, healthy, unhealthy)
+	Status string
+}
+
+// HealthStatusCache shares container health lookups across the concurrent
+// healthcheck goroutines of a batch. Rather than inspecting each container on
+// every tick, a single ContainerList call refreshes the status of every
+// container in the batch, and results are reused until they are older than
+// the configured TTL.
+type HealthStatusCache struct {
+	client       DockerClientInterface
+	containerIDs []string
+	fetchedAt    time.Time
+	// mu guards fetchedAt and statuses, and is never held across a call
+	// to the daemon
+	mu sync.Mutex
+	// refreshes coalesces the listings of waiters that find the cache
+	// stale at the same time into one call
+	refreshes singleflight.Group
+	statuses  map[string]containerHealth
+	ttl       time.Duration
+}
+
+// NewHealthStatusCache creates a cache covering the given containers
+func NewHealthStatusCache(client DockerClientInterface, containerIDs []string, ttl time.Duration) *HealthStatusCache {
+	return &HealthStatusCache{
+		client:       client,
+		containerIDs: containerIDs,
+		statuses:     map[string]containerHealth{},
+		ttl:          ttl,
+	}
+}
+
+// Status returns the health of a container, refreshing the whole batch with
+// one ContainerList call when the cached value is stale. Containers missing
+// from the listing fall back to an individual ContainerInspect.
+func (c *HealthStatusCache) Status(ctx context.Context, containerID string) (containerHealth, error) {
+	// A listing costs as much as an inspect when there is nothing to coalesce
+	if len(c.containerIDs) < 2 {
+		return inspectContainerHealth(ctx, c.client, containerID)
+	}
+
+	if status, ok := c.cached(containerID); ok {
+		return status, nil
+	}
+
+	_, err, _ := c.refreshes.Do("refresh", func() (interface{}, error) {
+		return nil, c.refresh(ctx)
+	})
+	if err != nil {
+		return containerHealth{}, err
+	}
+
+	if status, ok := c.cached(containerID); ok {
+		return status, nil
+	}
+
+	return inspectContainerHealth(ctx, c.client, containerID)
+}
+
+// cached returns the health of a container if it was listed within the TTL
+func (c *HealthStatusCache) cached(containerID string) (containerHealth, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	status, ok := c.statuses[containerID]
+	if !ok || time.Since(c.fetchedAt) >= c.ttl {
+		return containerHealth{}, false
+	}
+	return status, true
+}
+
+// refresh lists every container in the batch and records its health
+func (c *HealthStatusCache) refresh(ctx context.Context) error {
+	filterArgs := filters.NewArgs()
+	for _, id := range c.containerIDs {
+		filterArgs.Add("id", id)
+	}
+
+	containers, err := c.client.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filterArgs,
+	})
+	if err != nil {
+		return fmt.Errorf("error listing containers: %v", err)
+	}
+
+	statuses := map[string]containerHealth{}
+	for _, summary := range containers {
+		// Summaries without a state carry no usable health information
+		if summary.State == "" {
+			continue
+		}
+
+		for _, id := range c.containerIDs {
+			if summary.ID == id {
+				statuses[id] = summaryHealth(summary)
+			}
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.statuses = statuses
+	c.fetchedAt = time.Now()
+	return nil
+}
+
+// summaryHealth derives the health of a container from its list summary.
+// The daemon appends the healthcheck status to the human-readable status,
+// e.g. "Up 5 seconds (health: starting)".
+func summaryHealth(summary container.Summary) containerHealth {
+	health := containerHealth{
+		Running: summary.State == container.StateRunning,
+	}
+
+	switch {
+	case strings.Contains(summary.Status, "(health: starting)"):
+		health.HasHealthcheck = true
+		health.Status = container.Starting
+	case strings.Contains(summary.Status, "(unhealthy)"):
+		health.HasHealthcheck = true
+		health.Status = container.Unhealthy
+	case strings.Contains(summary.Status, "(healthy)"):
+		health.HasHealthcheck = true
+		health.Status = container.Healthy
+	}
+
+	return health
+}
+
+// inspectContainerHealth inspects a single container and records its health
+func inspectContainerHealth(ctx context.Context, client DockerClientInterface, containerID string) (containerHealth, error) {
+	containerJSON, err := client.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return containerHealth{}, fmt.Errorf("error inspecting container: %v", err)
+	}
+
+	// some daemons return a partial response for a container that has not
+	// started yet, so a missing state is an error rather than a panic
+	if containerJSON.ContainerJSONBase == nil || containerJSON.State == nil {
+		return containerHealth{}, fmt.Errorf("container %s inspect response has no state", containerID)
+	}
+
+	health := containerHealth{
+		Running: containerJSON.State.Running,
+	}
+	if containerJSON.State.Health != nil {
+		health.HasHealthcheck = true
+		health.Status = containerJSON.State.Health.Status
+	}
+
+	return health, nil
+}
@@ -0,0 +1,265 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestSummaryHealth(t *testing.T) {
+	tests := []struct {
+		name     string
+		summary  container.Summary
+		expected containerHealth
+	}{
+		{
+			name:     "running without healthcheck",
+			summary:  container.Summary{State: container.StateRunning, Status: "Up 5 seconds"},
+			expected: containerHealth{Running: true},
+		},
+		{
+			name:     "starting",
+			summary:  container.Summary{State: container.StateRunning, Status: "Up 5 seconds (health: starting)"},
+			expected: containerHealth{HasHealthcheck: true, Running: true, Status: container.Starting},
+		},
+		{
+			name:     "healthy",
+			summary:  container.Summary{State: container.StateRunning, Status: "Up 5 seconds (healthy)"},
+			expected: containerHealth{HasHealthcheck: true, Running: true, Status: container.Healthy},
+		},
+		{
+			name:     "unhealthy",
+			summary:  container.Summary{State: container.StateRunning, Status: "Up 5 seconds (unhealthy)"},
+			expected: containerHealth{HasHealthcheck: true, Running: true, Status: container.Unhealthy},
+		},
+		{
+			name:     "exited",
+			summary:  container.Summary{State: container.StateExited, Status: "Exited (1) 2 seconds ago"},
+			expected: containerHealth{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := summaryHealth(tt.summary); got != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestHealthStatusCacheReducesInspects(t *testing.T) {
+	ctx := context.Background()
+	containerIDs := []string{"c1", "c2", "c3", "c4", "c5"}
+
+	var listCalls, inspectCalls atomic.Int32
+	mock := &mockDockerClient{
+		containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+			listCalls.Add(1)
+			summaries := []container.Summary{}
+			for _, id := range containerIDs {
+				if !options.Filters.ExactMatch("id", id) {
+					t.Errorf("expected listing to filter on container %s", id)
+				}
+				summaries = append(summaries, container.Summary{
+					ID:     id,
+					State:  container.StateRunning,
+					Status: "Up 1 second (healthy)",
+				})
+			}
+			return summaries, nil
+		},
+		containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+			inspectCalls.Add(1)
+			return container.InspectResponse{
+				ContainerJSONBase: &container.ContainerJSONBase{
+					State: &container.State{
+						Running: true,
+						Health:  &container.Health{Status: container.Healthy},
+					},
+				},
+			}, nil
+		},
+	}
+
+	waitAll := func(cache *HealthStatusCache) {
+		var wg sync.WaitGroup
+		for _, id := range containerIDs {
+			wg.Add(1)
+			go func(id string) {
+				defer wg.Done()
+				err := waitForDockerHealthCheck(ctx, WaitForHealthcheckInput{
+					Client:            mock,
+					ContainerID:       id,
+					HealthStatusCache: cache,
+					Monitor:           time.Second,
+					TickerCh:          testTickerCh(),
+				})
+				if err != nil {
+					t.Errorf("unexpected error for %s: %v", id, err)
+				}
+			}(id)
+		}
+		wg.Wait()
+	}
+
+	waitAll(nil)
+	if inspectCalls.Load() != int32(len(containerIDs)) {
+		t.Fatalf("expected %d inspect calls without a cache, got %d", len(containerIDs), inspectCalls.Load())
+	}
+
+	listCalls.Store(0)
+	inspectCalls.Store(0)
+	waitAll(NewHealthStatusCache(mock, containerIDs, time.Minute))
+	if inspectCalls.Load() != 0 {
+		t.Errorf("expected no inspect calls with a cache, got %d", inspectCalls.Load())
+	}
+	if listCalls.Load() != 1 {
+		t.Errorf("expected 1 list call with a cache, got %d", listCalls.Load())
+	}
+}
+
+func TestHealthStatusCacheFallsBackToInspect(t *testing.T) {
+	ctx := context.Background()
+
+	inspected := []string{}
+	mock := &mockDockerClient{
+		containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+			return []container.Summary{
+				{ID: "c1", State: container.StateRunning, Status: "Up 1 second (health: starting)"},
+			}, nil
+		},
+		containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+			inspected = append(inspected, id)
+			return container.InspectResponse{
+				ContainerJSONBase: &container.ContainerJSONBase{
+					State: &container.State{Running: true},
+				},
+			}, nil
+		},
+	}
+
+	cache := NewHealthStatusCache(mock, []string{"c1", "c2"}, time.Minute)
+
+	health, err := cache.Status(ctx, "c1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if health.Status != container.Starting {
+		t.Errorf("expected c1 to be starting, got %q", health.Status)
+	}
+
+	health, err = cache.Status(ctx, "c2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !health.Running || health.HasHealthcheck {
+		t.Errorf("expected c2 to be running without a healthcheck, got %+v", health)
+	}
+	if fmt.Sprint(inspected) != "[c2]" {
+		t.Errorf("expected only c2 to be inspected, got %v", inspected)
+	}
+}
+
+func TestHealthStatusCacheListsWithoutLock(t *testing.T) {
+	ctx := context.Background()
+
+	var cache *HealthStatusCache
+	mock := &mockDockerClient{
+		containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+			// reading the cache while the listing is in flight would block
+			// forever if the lock was held across the call
+			if _, ok := cache.cached("c1"); ok {
+				t.Errorf("expected c1 not to be cached before the first listing")
+			}
+			return []container.Summary{
+				{ID: "c1", State: container.StateRunning, Status: "Up 1 second (healthy)"},
+				{ID: "c2", State: container.StateRunning, Status: "Up 1 second (healthy)"},
+			}, nil
+		},
+	}
+	cache = NewHealthStatusCache(mock, []string{"c1", "c2"}, time.Minute)
+
+	health, err := cache.Status(ctx, "c1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if health.Status != container.Healthy {
+		t.Errorf("expected c1 to be healthy, got %q", health.Status)
+	}
+}
+
+// BenchmarkHealthStatusCache compares the daemon calls made by a batch of
+// containers polling their health with and without a shared cache
+func BenchmarkHealthStatusCache(b *testing.B) {
+	ctx := context.Background()
+	containerIDs := []string{}
+	for i := 0; i < 20; i++ {
+		containerIDs = append(containerIDs, fmt.Sprintf("c%d", i))
+	}
+
+	var calls atomic.Int64
+	mock := &mockDockerClient{
+		containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+			calls.Add(1)
+			summaries := []container.Summary{}
+			for _, id := range containerIDs {
+				summaries = append(summaries, container.Summary{ID: id, State: container.StateRunning, Status: "Up 1 second (healthy)"})
+			}
+			return summaries, nil
+		},
+		containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+			calls.Add(1)
+			return container.InspectResponse{
+				ContainerJSONBase: &container.ContainerJSONBase{
+					State: &container.State{
+						Running: true,
+						Health:  &container.Health{Status: container.Healthy},
+					},
+				},
+			}, nil
+		},
+	}
+
+	// each poll starts from nothing cached, as a new batch does
+	poll := func(b *testing.B, newStatus func() func(id string) (containerHealth, error)) {
+		calls.Store(0)
+		for i := 0; i < b.N; i++ {
+			status := newStatus()
+			var wg sync.WaitGroup
+			for _, id := range containerIDs {
+				wg.Add(1)
+				go func(id string) {
+					defer wg.Done()
+					if _, err := status(id); err != nil {
+						b.Errorf("unexpected error for %s: %v", id, err)
+					}
+				}(id)
+			}
+			wg.Wait()
+		}
+		b.ReportMetric(float64(calls.Load())/float64(b.N), "calls/poll")
+	}
+
+	b.Run("inspect", func(b *testing.B) {
+		poll(b, func() func(id string) (containerHealth, error) {
+			return func(id string) (containerHealth, error) {
+				return inspectContainerHealth(ctx, mock, id)
+			}
+		})
+	})
+
+	b.Run("cache", func(b *testing.B) {
+		poll(b, func() func(id string) (containerHealth, error) {
+			cache := NewHealthStatusCache(mock, containerIDs, time.Minute)
+			return func(id string) (containerHealth, error) {
+				return cache.Status(ctx, id)
+			}
+		})
+	})
+}
@@ -3,11 +3,22 @@ package internal
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
 	"text/template"
 	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/josegonzalez/cli-skeleton/command"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // ErrorWithOutput is an error with output
@@ -29,6 +40,10 @@ type ScriptTemplateData struct {
 	ContainerIP string
 	// ContainerShortID is the short ID of the container
 	ContainerShortID string
+	// FailureOutput is the healthcheck failure and its captured output, set for on-unhealthy commands
+	FailureOutput string
+	// HealthURL is the URL of the container's first published tcp port, set for healthcheck commands
+	HealthURL string
 	// ServiceName is the name of the service
 	ServiceName string
 }
@@ -39,20 +54,39 @@ type WaitForHealthcheckInput struct {
 	Client DockerClientInterface
 	// ContainerID is the ID of the container to wait for
 	ContainerID string
+	// ContainerTimeout is an absolute ceiling on how long the container may take to become healthy
+	ContainerTimeout time.Duration
 	// Executor is the command executor to use. If nil, ExecCommand will be used.
 	Executor CommandExecutor
 	// HealthcheckCommand is the command to run for health checks
 	HealthcheckCommand string
+	// HealthcheckExpectOutput is the pattern the output of the healthcheck command must match for the check to pass
+	HealthcheckExpectOutput *regexp.Regexp
+	// HealthcheckMode is how the docker healthcheck status is followed, either poll or events. Defaults to poll.
+	HealthcheckMode string
+	// HealthcheckScheme is the scheme of the published URL handed to the healthcheck command
+	HealthcheckScheme string
+	// HealthStatusCache is an optional cache shared by the containers of a batch.
+	// If nil, the container is inspected directly on every tick.
+	HealthStatusCache *HealthStatusCache
 	// Monitor is the health check monitoring duration
 	Monitor time.Duration
+	// RunningGrace is how long a container without a healthcheck must stay running before it is considered healthy. If 0, it is healthy as soon as it is running.
+	RunningGrace time.Duration
 	// ServiceName is the name of the service
 	ServiceName string
+	// SkipHealthcheck is whether to consider the container healthy without waiting
+	SkipHealthcheck bool
+	// StartPeriod is the grace period during which unhealthy readings are ignored
+	StartPeriod time.Duration
+	// SuccessThreshold is the number of consecutive healthy readings required. Defaults to 1.
+	SuccessThreshold int
 	// TickerCh is an optional channel to use for ticking. If nil, time.NewTicker will be used.
 	TickerCh <-chan time.Time
 }
 
 // waitForHealthcheck waits for a container to become healthy using both Docker and script health checks
-func waitForHealthcheck(ctx context.Context, input WaitForHealthcheckInput) error {
+func waitForHealthcheck(ctx context.Context, input WaitForHealthcheckInput) (err error) {
 	if input.Client == nil {
 		return fmt.Errorf("client is required")
 	}
@@ -61,18 +95,110 @@ func waitForHealthcheck(ctx context.Context, input WaitForHealthcheckInput) erro
 		return fmt.Errorf("executor is required")
 	}
 
-	if err := waitForDockerHealthCheck(ctx, input); err != nil {
-		return err
+	if input.SkipHealthcheck {
+		return nil
 	}
 
-	return runHostScript(ctx, runScriptInput{
-		Client:      input.Client,
-		ContainerID: input.ContainerID,
-		Executor:    input.Executor,
-		ServiceName: input.ServiceName,
-		Script:      input.HealthcheckCommand,
-		ScriptType:  "healthcheck",
-	})
+	ctx, span := startSpan(ctx, nil, "healthcheck", attribute.String("service", input.ServiceName), attribute.String("container", input.ContainerID[:min(12, len(input.ContainerID))]))
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	if input.ContainerTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, input.ContainerTimeout)
+		defer cancel()
+	}
+
+	if input.HealthcheckMode == "events" {
+		err = waitForHealthEvents(ctx, input)
+	} else {
+		err = waitForDockerHealthCheck(ctx, input)
+	}
+	if err == nil {
+		err = runHostScript(ctx, runScriptInput{
+			Client:          input.Client,
+			ContainerID:     input.ContainerID,
+			Executor:        input.Executor,
+			ExpectOutput:    input.HealthcheckExpectOutput,
+			HealthURLScheme: input.HealthcheckScheme,
+			ServiceName:     input.ServiceName,
+			Script:          input.HealthcheckCommand,
+			ScriptType:      "healthcheck",
+		})
+	}
+
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) && input.ContainerTimeout > 0 {
+		return &HealthcheckTimeoutError{Err: fmt.Errorf("health check exceeded per-container timeout of %v", input.ContainerTimeout)}
+	}
+
+	return err
+}
+
+// loadHealthcheckCommandFile reads the host healthcheck command of a service
+// from the file given by the --healthcheck-command-file flag or, failing that,
+// the x-healthcheck-host-command-file extension. A relative extension path is
+// resolved against the project directory. Returns an empty command if neither
+// is set.
+func loadHealthcheckCommandFile(input DeployServiceInput, params DeployParams) (string, error) {
+	path := input.HealthcheckCommandFile
+	if path == "" {
+		value, ok := params.Extensions["x-healthcheck-host-command-file"]
+		if !ok {
+			return "", nil
+		}
+
+		extensionPath, ok := value.(string)
+		if !ok || extensionPath == "" {
+			return "", fmt.Errorf("invalid x-healthcheck-host-command-file value %v: expected a file path", value)
+		}
+		if _, ok := params.Extensions["x-healthcheck-host-command"]; ok {
+			return "", fmt.Errorf("x-healthcheck-host-command and x-healthcheck-host-command-file cannot both be set: service=%s", input.ServiceName)
+		}
+
+		path = extensionPath
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(input.ComposeFile), path)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("error reading healthcheck command file: %v", err)
+	}
+	if strings.TrimSpace(string(data)) == "" {
+		return "", fmt.Errorf("healthcheck command file is empty: %s", path)
+	}
+	return string(data), nil
+}
+
+// defaultHealthcheckCommand returns the default host healthcheck command for
+// a service with no healthcheck of its own: no host command, no compose
+// healthcheck, and no HEALTHCHECK in its image. An image that is not present
+// locally is taken to have none. Returns an empty command otherwise.
+func defaultHealthcheckCommand(ctx context.Context, input DeployServiceInput, service *types.ServiceConfig, params DeployParams) string {
+	if input.DefaultHealthcheckCommand == "" || params.HealthcheckCommand != "" {
+		return ""
+	}
+
+	// a compose healthcheck counts even when disabled, as the service then
+	// opted out of healthchecks on purpose
+	if service.HealthCheck != nil {
+		return ""
+	}
+
+	imageName := service.Image
+	if input.Image != "" {
+		imageName = input.Image
+	}
+	if imageName != "" {
+		inspect, err := input.Client.ImageInspect(ctx, imageName)
+		if err == nil && inspect.Config != nil && inspect.Config.Healthcheck != nil && len(inspect.Config.Healthcheck.Test) > 0 {
+			return ""
+		}
+	}
+
+	return input.DefaultHealthcheckCommand
 }
 
 // RunStopCommandInput is the input for the stop command functions
@@ -95,8 +221,13 @@ func waitForDockerHealthCheck(ctx context.Context, input WaitForHealthcheckInput
 		input.Monitor = 1 * time.Millisecond
 	}
 
-	maxWaitTime := input.Monitor * 2
-	deadline := time.Now().Add(maxWaitTime)
+	// The start period extends both the grace window for unhealthy readings
+	// and the overall deadline, as does the running grace of containers
+	// without a healthcheck
+	maxWaitTime := input.Monitor*2 + input.StartPeriod + input.RunningGrace
+	startedAt := time.Now()
+	deadline := startedAt.Add(maxWaitTime)
+	graceDeadline := startedAt.Add(input.StartPeriod)
 
 	tickerCh := input.TickerCh
 	var ticker *time.Ticker
@@ -106,33 +237,63 @@ func waitForDockerHealthCheck(ctx context.Context, input WaitForHealthcheckInput
 		tickerCh = ticker.C
 	}
 
+	successThreshold := max(input.SuccessThreshold, 1)
+	consecutiveHealthy := 0
+	var runningSince time.Time
+
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		case <-tickerCh:
 			if time.Now().After(deadline) {
-				return fmt.Errorf("health check timeout after %v", maxWaitTime)
+				return healthcheckTimeoutError(ctx, input, maxWaitTime)
 			}
 
-			containerJSON, err := input.Client.ContainerInspect(ctx, input.ContainerID)
+			var health containerHealth
+			var err error
+			if input.HealthStatusCache != nil {
+				health, err = input.HealthStatusCache.Status(ctx, input.ContainerID)
+			} else {
+				health, err = inspectContainerHealth(ctx, input.Client, input.ContainerID)
+			}
 			if err != nil {
-				return fmt.Errorf("error inspecting container: %v", err)
+				return err
 			}
 
-			// If no health check is configured, consider it healthy if running
-			if containerJSON.State.Health == nil {
-				if containerJSON.State.Running {
+			// If no health check is configured, consider it healthy once it
+			// has been running for the running grace
+			if !health.HasHealthcheck {
+				if !health.Running {
+					if !runningSince.IsZero() {
+						return fmt.Errorf("container exited within the running grace of %v", input.RunningGrace)
+					}
+					return fmt.Errorf("container is not running")
+				}
+				if runningSince.IsZero() {
+					runningSince = time.Now()
+				}
+				if time.Since(runningSince) >= input.RunningGrace {
 					return nil
 				}
-				return fmt.Errorf("container is not running")
+				continue
+			}
+
+			if health.Status != "healthy" {
+				consecutiveHealthy = 0
 			}
 
-			healthStatus := containerJSON.State.Health.Status
-			switch healthStatus {
+			switch health.Status {
 			case "healthy":
-				return nil
+				consecutiveHealthy++
+				if consecutiveHealthy >= successThreshold {
+					return nil
+				}
 			case "unhealthy":
+				if time.Now().Before(graceDeadline) {
+					// Continue waiting until the start period elapses
+					continue
+				}
 				return fmt.Errorf("container is unhealthy")
 			case "starting":
 				// Continue waiting
@@ -143,13 +304,240 @@ func waitForDockerHealthCheck(ctx context.Context, input WaitForHealthcheckInput
 	}
 }
 
+// waitForHealthEvents waits for a container to become healthy by following
+// its health_status events, so a change is noticed as soon as docker reports
+// it rather than on the next monitor tick. Docker only reports changes in
+// status, so consecutive healthy readings cannot be counted.
+func waitForHealthEvents(ctx context.Context, input WaitForHealthcheckInput) error {
+	if input.Monitor == 0 {
+		input.Monitor = 1 * time.Millisecond
+	}
+
+	maxWaitTime := input.Monitor*2 + input.StartPeriod
+	graceDeadline := time.Now().Add(input.StartPeriod)
+	deadline := time.NewTimer(maxWaitTime)
+	defer deadline.Stop()
+	grace := time.NewTimer(input.StartPeriod)
+	defer grace.Stop()
+
+	// subscribe before reading the current status, so a change in between
+	// is not missed
+	eventsCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	messages, errs := input.Client.Events(eventsCtx, events.ListOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("type", string(events.ContainerEventType)),
+			filters.Arg("container", input.ContainerID),
+			filters.Arg("event", string(events.ActionHealthStatus)),
+			filters.Arg("event", string(events.ActionDie)),
+		),
+	})
+
+	health, err := inspectContainerHealth(ctx, input.Client, input.ContainerID)
+	if err != nil {
+		return err
+	}
+
+	// If no health check is configured, consider it healthy once it has been
+	// running for the running grace
+	if !health.HasHealthcheck {
+		if !health.Running {
+			return fmt.Errorf("container is not running")
+		}
+		if input.RunningGrace <= 0 {
+			return nil
+		}
+
+		runningGrace := time.NewTimer(input.RunningGrace)
+		defer runningGrace.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-runningGrace.C:
+				return nil
+			case err := <-errs:
+				return fmt.Errorf("error following health events: %v", err)
+			case message := <-messages:
+				if message.Action == events.ActionDie {
+					return fmt.Errorf("container exited within the running grace of %v", input.RunningGrace)
+				}
+			}
+		}
+	}
+
+	status := health.Status
+	for {
+		switch status {
+		case "healthy":
+			return nil
+		case "unhealthy":
+			// unhealthy readings are ignored until the start period elapses
+			if !time.Now().Before(graceDeadline) {
+				return fmt.Errorf("container is unhealthy")
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline.C:
+			return healthcheckTimeoutError(ctx, input, maxWaitTime)
+		case <-grace.C:
+			// the start period elapsed, so an unhealthy status now fails
+		case err := <-errs:
+			return fmt.Errorf("error following health events: %v", err)
+		case message := <-messages:
+			if message.Action == events.ActionDie {
+				return fmt.Errorf("container is not running")
+			}
+			if current, ok := strings.CutPrefix(string(message.Action), string(events.ActionHealthStatus)+": "); ok {
+				status = current
+			}
+		}
+	}
+}
+
+// HealthcheckTimeoutError is the error for a container that did not become
+// healthy in time, as opposed to one that was found unhealthy
+type HealthcheckTimeoutError struct {
+	// Err is the underlying error
+	Err error
+}
+
+// Error returns the error message
+func (e *HealthcheckTimeoutError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *HealthcheckTimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// healthcheckTimeoutError returns the error for a container that did not
+// become healthy in time, with a hint at why when its state gives one
+func healthcheckTimeoutError(ctx context.Context, input WaitForHealthcheckInput, maxWaitTime time.Duration) error {
+	inspect, err := input.Client.ContainerInspect(ctx, input.ContainerID)
+	if err == nil {
+		if hint := diagnoseUnhealthy(inspect); hint != "" {
+			return &HealthcheckTimeoutError{Err: fmt.Errorf("health check timeout after %v: %s", maxWaitTime, hint)}
+		}
+	}
+	return &HealthcheckTimeoutError{Err: fmt.Errorf("health check timeout after %v", maxWaitTime)}
+}
+
+// diagnoseUnhealthy explains why a container did not become healthy in time,
+// with a hint at how to fix it, or returns an empty string when its state
+// gives no clue
+func diagnoseUnhealthy(inspect container.InspectResponse) string {
+	if inspect.ContainerJSONBase == nil || inspect.State == nil {
+		return ""
+	}
+
+	state := inspect.State
+	switch {
+	case state.Restarting:
+		return fmt.Sprintf("container is restarting after %d restarts, it is likely crashing on startup; check its logs", inspect.RestartCount)
+	case state.OOMKilled:
+		return "container was killed for running out of memory; raise its memory limit"
+	case state.Status == container.StateExited || state.Status == container.StateDead:
+		return fmt.Sprintf("container exited with code %d during startup; check its logs", state.ExitCode)
+	case state.Health == nil:
+		return ""
+	case state.Health.Status == container.Starting:
+		return "healthcheck never passed while starting; check the healthcheck command, or raise its interval, retries or start_period if the service is slow to start"
+	case state.Health.Status == container.Unhealthy:
+		hint := fmt.Sprintf("healthcheck is failing after %d consecutive attempts", state.Health.FailingStreak)
+		if n := len(state.Health.Log); n > 0 {
+			if output := strings.TrimSpace(state.Health.Log[n-1].Output); output != "" {
+				hint = fmt.Sprintf("%s, last output: %s", hint, output)
+			}
+		}
+		return hint
+	}
+	return ""
+}
+
+// runHostHook runs a host command hooked to a container's health changing.
+// A failure is logged rather than returned, so the deploy carries on as it
+// would without the hook.
+func runHostHook(ctx context.Context, logger *command.ZerologUi, input runScriptInput) {
+	if err := runHostScript(ctx, input); err != nil {
+		input.Warnings.Warn(logger, input.ServiceName, fmt.Sprintf("Host command failed: type=%s, service=%s, error=%v", input.ScriptType, input.ServiceName, err))
+		if eo, ok := err.(*ErrorWithOutput); ok {
+			for _, line := range strings.Split(eo.Output, "\n") {
+				logger.Warn(fmt.Sprintf("    %s", line))
+			}
+		}
+	}
+}
+
+// brokenCommandPatterns match the errors of a shell that could not run a
+// command at all, as opposed to a command that ran and failed
+var brokenCommandPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?m)^.*: command not found$`),
+	regexp.MustCompile(`(?m)^.*: not found$`),
+	regexp.MustCompile(`(?m)^.*: bad interpreter: .*$`),
+	regexp.MustCompile(`(?m)^.*executable file not found in \$PATH.*$`),
+}
+
+// brokenCommandError returns the line of a host command failure showing the
+// command itself cannot run, or an empty string when the command ran
+func brokenCommandError(err error) string {
+	output := err.Error()
+	if eo, ok := err.(*ErrorWithOutput); ok && eo.Output != "" {
+		output = eo.Output
+	}
+	for _, pattern := range brokenCommandPatterns {
+		if line := pattern.FindString(output); line != "" {
+			return strings.TrimSpace(line)
+		}
+	}
+	return ""
+}
+
+// smokeTestHealthcheck runs the host healthcheck command against a running
+// container before any container is replaced, so a command that cannot run
+// at all fails the deploy rather than every new container. A check that runs
+// and fails is left to the healthchecks of the new containers, as the running
+// container may well be the reason for the deploy.
+func smokeTestHealthcheck(ctx context.Context, logger *command.ZerologUi, input runScriptInput) error {
+	containerShortID := input.ContainerID[:min(12, len(input.ContainerID))]
+	err := runHostScript(ctx, input)
+	if err == nil {
+		logger.Info(fmt.Sprintf("Healthcheck smoke test passed: service=%s, container=%s", input.ServiceName, containerShortID))
+		return nil
+	}
+
+	if reason := brokenCommandError(err); reason != "" {
+		return fmt.Errorf("host healthcheck command cannot run, no container was replaced: service=%s, container=%s, error=%s", input.ServiceName, containerShortID, reason)
+	}
+
+	logger.Info(fmt.Sprintf("Healthcheck smoke test failed against a running container, continuing: service=%s, container=%s, error=%v", input.ServiceName, containerShortID, err))
+	return nil
+}
+
+// healthcheckFailureOutput returns a healthcheck failure along with any
+// output it captured
+func healthcheckFailureOutput(err error) string {
+	if eo, ok := err.(*ErrorWithOutput); ok && eo.Output != "" {
+		return fmt.Sprintf("%v\n%s", err, eo.Output)
+	}
+	return err.Error()
+}
+
 type runScriptInput struct {
-	Client      DockerClientInterface
-	ContainerID string
-	Executor    CommandExecutor
-	ServiceName string
-	Script      string
-	ScriptType  string
+	Client          DockerClientInterface
+	ContainerID     string
+	Executor        CommandExecutor
+	ExpectOutput    *regexp.Regexp
+	FailureOutput   string
+	HealthURLScheme string
+	ServiceName     string
+	Script          string
+	ScriptType      string
+	Warnings        *DeployWarnings
 }
 
 func runHostScript(ctx context.Context, input runScriptInput) error {
@@ -180,11 +568,22 @@ func runHostScript(ctx context.Context, input runScriptInput) error {
 		containerShortID = containerShortID[:12]
 	}
 
+	healthURL := ""
+	if input.HealthURLScheme != "" {
+		mappings, err := containerPortMappings(ctx, input.Client, []container.Summary{{ID: input.ContainerID}})
+		if err != nil {
+			return fmt.Errorf("error getting published ports: %v", err)
+		}
+		healthURL = publishedURL(input.HealthURLScheme, mappings)
+	}
+
 	var commandBuf bytes.Buffer
 	data := ScriptTemplateData{
 		ContainerID:      input.ContainerID,
 		ContainerIP:      containerIP,
 		ContainerShortID: containerShortID,
+		FailureOutput:    input.FailureOutput,
+		HealthURL:        healthURL,
 		ServiceName:      input.ServiceName,
 	}
 
@@ -192,43 +591,61 @@ func runHostScript(ctx context.Context, input runScriptInput) error {
 		return fmt.Errorf("error executing %s command template: %v", input.ScriptType, err)
 	}
 
-	command := commandBuf.String()
+	output, stdout, err := executeHostScript(ctx, input.Executor, input.ScriptType, commandBuf.String())
+	if err != nil {
+		return &ErrorWithOutput{
+			Err:    fmt.Errorf("%s command failed for container %s: %v", input.ScriptType, containerShortID, err),
+			Output: output,
+		}
+	}
+
+	if input.ExpectOutput != nil && !input.ExpectOutput.MatchString(stdout) {
+		return &ErrorWithOutput{
+			Err:    fmt.Errorf("%s command output for container %s did not match %q", input.ScriptType, containerShortID, input.ExpectOutput.String()),
+			Output: output,
+		}
+	}
+
+	return nil
+}
+
+// executeHostScript writes a rendered host command to a temporary script and
+// runs it, returning the combined output and the stdout alone
+func executeHostScript(ctx context.Context, executor CommandExecutor, scriptType string, command string) (string, string, error) {
 	if !strings.HasPrefix(command, "#!") {
 		command = "#!/usr/bin/env bash\n" + command
 	}
 
-	tempFile, err := os.CreateTemp("", input.ScriptType+"-*.script")
+	dir, err := scriptDir()
+	if err != nil {
+		return "", "", err
+	}
+
+	tempFile, err := os.CreateTemp(dir, scriptType+"-*.script")
 	if err != nil {
-		return fmt.Errorf("error creating temporary %s script: %v", input.ScriptType, err)
+		return "", "", fmt.Errorf("error creating temporary %s script: %v", scriptType, err)
 	}
 	defer os.Remove(tempFile.Name())
 
 	if _, err := tempFile.WriteString(command); err != nil {
-		return fmt.Errorf("error writing %s command to temporary file: %v", input.ScriptType, err)
+		return "", "", fmt.Errorf("error writing %s command to temporary file: %v", scriptType, err)
 	}
 	if err := tempFile.Close(); err != nil {
-		return fmt.Errorf("error closing temporary %s file: %v", input.ScriptType, err)
+		return "", "", fmt.Errorf("error closing temporary %s file: %v", scriptType, err)
 	}
 
 	if err := os.Chmod(tempFile.Name(), 0755); err != nil {
-		return fmt.Errorf("error making temporary %s script executable: %v", input.ScriptType, err)
+		return "", "", fmt.Errorf("error making temporary %s script executable: %v", scriptType, err)
 	}
 
 	var output bytes.Buffer
-	_, err = input.Executor(ctx, ExecCommandInput{
+	response, err := executor(ctx, ExecCommandInput{
 		Command:          tempFile.Name(),
 		StdoutWriter:     &output,
 		StderrWriter:     &output,
 		WorkingDirectory: os.TempDir(),
 	})
-	if err != nil {
-		return &ErrorWithOutput{
-			Err:    fmt.Errorf("%s command failed for container %s: %v", input.ScriptType, containerShortID, err),
-			Output: strings.TrimSpace(output.String()),
-		}
-	}
-
-	return nil
+	return strings.TrimSpace(output.String()), response.Stdout, err
 }
 
 func getContainerIP(ctx context.Context, client DockerClientInterface, containerID string) (string, error) {
@@ -237,20 +654,256 @@ func getContainerIP(ctx context.Context, client DockerClientInterface, container
 		return "", fmt.Errorf("error inspecting container: %v", err)
 	}
 
-	containerIP := ""
 	if containerJSON.ContainerJSONBase != nil && containerJSON.HostConfig != nil && containerJSON.HostConfig.NetworkMode.IsHost() {
-		containerIP = "127.0.0.1"
-	} else if containerJSON.NetworkSettings != nil {
-		for networkName, network := range containerJSON.NetworkSettings.Networks {
-			if containerJSON.ContainerJSONBase != nil && containerJSON.HostConfig != nil && networkName != containerJSON.HostConfig.NetworkMode.NetworkName() {
+		return "127.0.0.1", nil
+	}
+
+	if containerJSON.NetworkSettings == nil {
+		return "", fmt.Errorf("container %s inspect response has no network settings", containerID)
+	}
+
+	containerIP := ""
+	for networkName, network := range containerJSON.NetworkSettings.Networks {
+		if network == nil {
+			continue
+		}
+		if containerJSON.ContainerJSONBase != nil && containerJSON.HostConfig != nil && networkName != containerJSON.HostConfig.NetworkMode.NetworkName() {
+			continue
+		}
+		if network.IPAddress != "" {
+			containerIP = network.IPAddress
+			break
+		}
+	}
+
+	return containerIP, nil
+}
+
+// defaultWaitForDependenciesTimeout is how long to wait for each dependency
+// when no timeout is given, so a dependency that never becomes healthy fails
+// the deploy rather than blocking it
+const defaultWaitForDependenciesTimeout = 5 * time.Minute
+
+// WaitForDependenciesInput is the input for the waitForDependencies function
+type WaitForDependenciesInput struct {
+	// Client is the Docker client to use
+	Client DockerClientInterface
+	// DeployedServices are the services being deployed. When set, dependencies outside of them are not waited on, as nothing in this deploy would start them.
+	DeployedServices []string
+	// Logger is the logger to use
+	Logger *command.ZerologUi
+	// Project is the project configuration
+	Project *types.Project
+	// ProjectLabel overrides the com.docker.compose.project label value used to discover containers. Defaults to ProjectName.
+	ProjectLabel string
+	// ProjectName is the name of the project
+	ProjectName string
+	// ServiceName is the name of the service whose dependencies should be waited on
+	ServiceName string
+	// SkipDatabases is whether database services are skipped by the deploy, and so not waited on
+	SkipDatabases bool
+	// SkipServices are dependencies not waited on, such as those that already failed in this deploy and so will never become healthy
+	SkipServices []string
+	// TickerCh is an optional channel to use for ticking. If nil, time.NewTicker will be used.
+	TickerCh <-chan time.Time
+	// Timeout bounds how long to wait for each dependency. If 0, defaultWaitForDependenciesTimeout is used.
+	Timeout time.Duration
+}
+
+// waitForDependencies waits for every `service_healthy` dependency of a service to become healthy
+func waitForDependencies(ctx context.Context, input WaitForDependenciesInput) error {
+	service, err := input.Project.GetService(input.ServiceName)
+	if err != nil {
+		return err
+	}
+
+	dependencyNames := make([]string, 0, len(service.DependsOn))
+	for dependencyName, dependency := range service.DependsOn {
+		if dependency.Condition != types.ServiceConditionHealthy {
+			continue
+		}
+		dependencyNames = append(dependencyNames, dependencyName)
+	}
+	slices.Sort(dependencyNames)
+
+	for _, dependencyName := range dependencyNames {
+		if slices.Contains(input.SkipServices, dependencyName) {
+			input.Logger.Info(fmt.Sprintf("Not waiting for failed dependency: service=%s, dependency=%s", input.ServiceName, dependencyName))
+			continue
+		}
+
+		if input.DeployedServices != nil && !slices.Contains(input.DeployedServices, dependencyName) {
+			input.Logger.Info(fmt.Sprintf("Not waiting for dependency outside of the deploy: service=%s, dependency=%s", input.ServiceName, dependencyName))
+			continue
+		}
+
+		// services that are never deployed by orchestrate have no containers to gate on
+		if dependency, err := input.Project.GetService(dependencyName); err == nil {
+			if shouldSkipService(ShouldSkipServiceInput{
+				Logger:              input.Logger,
+				Service:             &dependency,
+				ShouldSkipDatabases: input.SkipDatabases,
+				SilenceLogging:      true,
+			}) {
 				continue
 			}
-			if network.IPAddress != "" {
-				containerIP = network.IPAddress
-				break
+		}
+
+		input.Logger.Info(fmt.Sprintf("Waiting for dependency to become healthy: service=%s, dependency=%s", input.ServiceName, dependencyName))
+		if err := waitForServiceHealthy(ctx, input, dependencyName); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// waitForServiceHealthy waits until every running container of a service is healthy
+func waitForServiceHealthy(ctx context.Context, input WaitForDependenciesInput, serviceName string) error {
+	timeout := input.Timeout
+	if timeout <= 0 {
+		timeout = defaultWaitForDependenciesTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	tickerCh := input.TickerCh
+	if tickerCh == nil {
+		ticker := time.NewTicker(1 * time.Second)
+		defer ticker.Stop()
+		tickerCh = ticker.C
+	}
+
+	for {
+		healthy, err := serviceIsHealthy(ctx, input, serviceName)
+		if err != nil {
+			return err
+		}
+		if healthy {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return fmt.Errorf("dependency %s not healthy within %v", serviceName, timeout)
 			}
+			return ctx.Err()
+		case <-tickerCh:
 		}
 	}
+}
 
-	return containerIP, nil
+// serviceIsHealthy returns true if the service has running containers and all of them are healthy
+func serviceIsHealthy(ctx context.Context, input WaitForDependenciesInput, serviceName string) (bool, error) {
+	client := input.Client
+	containers, err := composeContainers(ComposeContainersInput{
+		Client:       client,
+		ProjectLabel: input.ProjectLabel,
+		ProjectName:  input.ProjectName,
+		ServiceName:  serviceName,
+		Status:       "running",
+	})
+	if err != nil {
+		return false, fmt.Errorf("error getting containers for dependency %s: %v", serviceName, err)
+	}
+
+	if len(containers) == 0 {
+		return false, nil
+	}
+
+	for _, c := range containers {
+		containerJSON, err := client.ContainerInspect(ctx, c.ID)
+		if err != nil {
+			return false, fmt.Errorf("error inspecting container: %v", err)
+		}
+
+		if containerJSON.ContainerJSONBase == nil || containerJSON.State == nil {
+			return false, nil
+		}
+
+		if containerJSON.State.Health == nil {
+			if !containerJSON.State.Running {
+				return false, nil
+			}
+			continue
+		}
+
+		if containerJSON.State.Health.Status != "healthy" {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// VerifyGraphHealthInput is the input for the verifyGraphHealth function
+type VerifyGraphHealthInput struct {
+	// Client is the Docker client to use
+	Client DockerClientInterface
+	// Logger is the logger to use
+	Logger *command.ZerologUi
+	// Project is the project configuration
+	Project *types.Project
+	// ProjectLabel overrides the com.docker.compose.project label value used to discover containers. Defaults to ProjectName.
+	ProjectLabel string
+	// ProjectName is the name of the project
+	ProjectName string
+	// ServiceNames are the names of the deployed services to verify
+	ServiceNames []string
+	// SkipDatabases is whether databases were skipped during the deploy
+	SkipDatabases bool
+}
+
+// verifyGraphHealth inspects the running containers of every deployed service
+// once more and fails if any of them regressed to unhealthy, catching cases
+// where a later-deployed service broke an earlier one
+func verifyGraphHealth(ctx context.Context, input VerifyGraphHealthInput) error {
+	input.Logger.Info(fmt.Sprintf("Verifying graph health: services=%d", len(input.ServiceNames)))
+
+	unhealthy := []string{}
+	for _, serviceName := range input.ServiceNames {
+		service, err := input.Project.GetService(serviceName)
+		if err != nil {
+			return err
+		}
+
+		if shouldSkipService(ShouldSkipServiceInput{
+			Logger:              input.Logger,
+			Service:             &service,
+			ShouldSkipDatabases: input.SkipDatabases,
+			SilenceLogging:      true,
+		}) {
+			continue
+		}
+
+		containers, err := composeContainers(ComposeContainersInput{
+			Client:       input.Client,
+			ProjectLabel: input.ProjectLabel,
+			ProjectName:  input.ProjectName,
+			ServiceName:  serviceName,
+			Status:       "running",
+		})
+		if err != nil {
+			return fmt.Errorf("error getting containers for service %s: %v", serviceName, err)
+		}
+
+		for _, c := range containers {
+			health, err := inspectContainerHealth(ctx, input.Client, c.ID)
+			if err != nil {
+				return err
+			}
+
+			if health.HasHealthcheck && health.Status == container.Unhealthy {
+				input.Logger.Info(fmt.Sprintf("Container regressed to unhealthy: service=%s, container=%s", serviceName, c.ID[:12]))
+				unhealthy = append(unhealthy, fmt.Sprintf("%s (%s)", serviceName, c.ID[:12]))
+			}
+		}
+	}
+
+	if len(unhealthy) > 0 {
+		return fmt.Errorf("graph health verification failed, unhealthy containers: %s", strings.Join(unhealthy, ", "))
+	}
+
+	return nil
 }
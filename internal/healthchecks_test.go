@@ -1,15 +1,26 @@
 package internal
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/compose-spec/compose-go/v2/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/api/types/network"
+	"github.com/docker/go-connections/nat"
+	"github.com/josegonzalez/cli-skeleton/command"
+	dockerspec "github.com/moby/docker-image-spec/specs-go/v1"
+	"github.com/rs/zerolog"
 )
 
 func TestErrorWithOutput(t *testing.T) {
@@ -104,6 +115,89 @@ func TestWaitForDockerHealthCheck(t *testing.T) {
 		}
 	})
 
+	t.Run("unhealthy within start period", func(t *testing.T) {
+		callCount := 0
+		mockClient := &mockDockerClient{
+			containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+				callCount++
+				status := "unhealthy"
+				if callCount > 1 {
+					status = "healthy"
+				}
+				return container.InspectResponse{
+					ContainerJSONBase: &container.ContainerJSONBase{
+						State: &container.State{
+							Health: &container.Health{
+								Status: status,
+							},
+						},
+					},
+				}, nil
+			},
+		}
+
+		tickerCh := make(chan time.Time, 2)
+		tickerCh <- time.Now()
+		tickerCh <- time.Now()
+
+		input := WaitForHealthcheckInput{
+			Client:      mockClient,
+			ContainerID: "test-id",
+			Monitor:     1 * time.Nanosecond,
+			StartPeriod: 1 * time.Minute,
+			TickerCh:    tickerCh,
+		}
+
+		err := waitForDockerHealthCheck(ctx, input)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if callCount != 2 {
+			t.Errorf("expected 2 calls, got %d", callCount)
+		}
+	})
+
+	t.Run("success threshold requires consecutive healthy readings", func(t *testing.T) {
+		statuses := []string{"healthy", "starting", "healthy", "healthy"}
+		callCount := 0
+		mockClient := &mockDockerClient{
+			containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+				status := statuses[callCount]
+				callCount++
+				return container.InspectResponse{
+					ContainerJSONBase: &container.ContainerJSONBase{
+						State: &container.State{
+							Health: &container.Health{
+								Status: status,
+							},
+						},
+					},
+				}, nil
+			},
+		}
+
+		tickerCh := make(chan time.Time, len(statuses))
+		for range statuses {
+			tickerCh <- time.Now()
+		}
+
+		input := WaitForHealthcheckInput{
+			Client:           mockClient,
+			ContainerID:      "test-id",
+			Monitor:          1 * time.Second,
+			SuccessThreshold: 2,
+			TickerCh:         tickerCh,
+		}
+
+		err := waitForDockerHealthCheck(ctx, input)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if callCount != 4 {
+			t.Errorf("expected 4 calls, got %d", callCount)
+		}
+	})
+
 	t.Run("container not running no health check", func(t *testing.T) {
 		mockClient := &mockDockerClient{
 			containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
@@ -171,7 +265,322 @@ func TestWaitForDockerHealthCheck(t *testing.T) {
 		if !strings.Contains(err.Error(), "health check timeout") {
 			t.Errorf("expected timeout error, got '%v'", err)
 		}
+		if !strings.Contains(err.Error(), "healthcheck never passed while starting") {
+			t.Errorf("expected a starting diagnosis, got '%v'", err)
+		}
 	})
+
+	for name, response := range map[string]container.InspectResponse{
+		"missing state":     {ContainerJSONBase: &container.ContainerJSONBase{}},
+		"missing base info": {},
+	} {
+		t.Run(name, func(t *testing.T) {
+			mockClient := &mockDockerClient{
+				containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+					return response, nil
+				},
+			}
+
+			tickerCh := make(chan time.Time, 1)
+			tickerCh <- time.Now()
+
+			input := WaitForHealthcheckInput{
+				Client:      mockClient,
+				ContainerID: "test-id",
+				Monitor:     1 * time.Second,
+				TickerCh:    tickerCh,
+			}
+
+			err := waitForDockerHealthCheck(ctx, input)
+			if err == nil || err.Error() != "container test-id inspect response has no state" {
+				t.Errorf("expected a missing state error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestWaitForHealthcheckRunningGrace(t *testing.T) {
+	ctx := context.Background()
+
+	// runningClient reports a container without a healthcheck that is
+	// running for the given number of inspects, then exits
+	runningClient := func(runningInspects int) *mockDockerClient {
+		inspects := 0
+		return &mockDockerClient{
+			containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+				inspects++
+				return container.InspectResponse{
+					ContainerJSONBase: &container.ContainerJSONBase{
+						State: &container.State{Running: inspects <= runningInspects},
+					},
+				}, nil
+			},
+		}
+	}
+
+	t.Run("container exits within the grace", func(t *testing.T) {
+		err := waitForDockerHealthCheck(ctx, WaitForHealthcheckInput{
+			Client:       runningClient(2),
+			ContainerID:  "test-id",
+			Monitor:      time.Second,
+			RunningGrace: time.Minute,
+			TickerCh:     testTickerCh(),
+		})
+		if err == nil || err.Error() != "container exited within the running grace of 1m0s" {
+			t.Errorf("expected the crash within the running grace to fail, got %v", err)
+		}
+	})
+
+	t.Run("container stays running for the grace", func(t *testing.T) {
+		err := waitForDockerHealthCheck(ctx, WaitForHealthcheckInput{
+			Client:       runningClient(1000),
+			ContainerID:  "test-id",
+			Monitor:      5 * time.Millisecond,
+			RunningGrace: 20 * time.Millisecond,
+			StartPeriod:  time.Minute,
+		})
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("container is healthy as soon as it runs without a grace", func(t *testing.T) {
+		err := waitForDockerHealthCheck(ctx, WaitForHealthcheckInput{
+			Client:      runningClient(1),
+			ContainerID: "test-id",
+			Monitor:     time.Second,
+			TickerCh:    testTickerCh(),
+		})
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("events mode container exits within the grace", func(t *testing.T) {
+		messages := make(chan events.Message, 1)
+		messages <- events.Message{Action: events.ActionDie}
+		client := runningClient(1000)
+		client.events = func(ctx context.Context, options events.ListOptions) (<-chan events.Message, <-chan error) {
+			return messages, make(chan error)
+		}
+
+		err := waitForHealthEvents(ctx, WaitForHealthcheckInput{
+			Client:       client,
+			ContainerID:  "test-id",
+			Monitor:      time.Second,
+			RunningGrace: time.Minute,
+		})
+		if err == nil || err.Error() != "container exited within the running grace of 1m0s" {
+			t.Errorf("expected the crash within the running grace to fail, got %v", err)
+		}
+	})
+}
+
+func TestWaitForHealthEvents(t *testing.T) {
+	ctx := context.Background()
+
+	startingClient := func(messages chan events.Message, filters *[]string) *mockDockerClient {
+		return &mockDockerClient{
+			containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+				return container.InspectResponse{
+					ContainerJSONBase: &container.ContainerJSONBase{
+						State: &container.State{
+							Running: true,
+							Health:  &container.Health{Status: "starting"},
+						},
+					},
+				}, nil
+			},
+			events: func(ctx context.Context, options events.ListOptions) (<-chan events.Message, <-chan error) {
+				*filters = append(options.Filters.Get("container"), options.Filters.Get("event")...)
+				return messages, make(chan error)
+			},
+		}
+	}
+
+	t.Run("container becomes healthy", func(t *testing.T) {
+		messages := make(chan events.Message, 2)
+		messages <- events.Message{Action: events.ActionHealthStatusRunning}
+		messages <- events.Message{Action: events.ActionHealthStatusHealthy}
+
+		filters := []string{}
+		err := waitForHealthcheck(ctx, WaitForHealthcheckInput{
+			Client:      startingClient(messages, &filters),
+			ContainerID: "test-id",
+			Executor: func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+				return ExecCommandResponse{ExitCode: 0}, nil
+			},
+			HealthcheckMode: "events",
+			Monitor:         time.Minute,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected := []string{"test-id", "die", "health_status"}
+		slices.Sort(filters[1:])
+		if !slices.Equal(filters, expected) {
+			t.Errorf("expected the events of the container to be followed, got filters %v", filters)
+		}
+	})
+
+	t.Run("container becomes unhealthy", func(t *testing.T) {
+		messages := make(chan events.Message, 1)
+		messages <- events.Message{Action: events.ActionHealthStatusUnhealthy}
+
+		filters := []string{}
+		err := waitForHealthEvents(ctx, WaitForHealthcheckInput{
+			Client:      startingClient(messages, &filters),
+			ContainerID: "test-id",
+			Monitor:     time.Minute,
+		})
+		if err == nil || err.Error() != "container is unhealthy" {
+			t.Errorf("expected an unhealthy error, got %v", err)
+		}
+	})
+
+	t.Run("unhealthy during start period", func(t *testing.T) {
+		messages := make(chan events.Message, 2)
+		messages <- events.Message{Action: events.ActionHealthStatusUnhealthy}
+		messages <- events.Message{Action: events.ActionHealthStatusHealthy}
+
+		filters := []string{}
+		err := waitForHealthEvents(ctx, WaitForHealthcheckInput{
+			Client:      startingClient(messages, &filters),
+			ContainerID: "test-id",
+			Monitor:     time.Minute,
+			StartPeriod: time.Minute,
+		})
+		if err != nil {
+			t.Errorf("expected the unhealthy reading to be ignored during the start period, got %v", err)
+		}
+	})
+
+	t.Run("container dies", func(t *testing.T) {
+		messages := make(chan events.Message, 1)
+		messages <- events.Message{Action: events.ActionDie}
+
+		filters := []string{}
+		err := waitForHealthEvents(ctx, WaitForHealthcheckInput{
+			Client:      startingClient(messages, &filters),
+			ContainerID: "test-id",
+			Monitor:     time.Minute,
+		})
+		if err == nil || err.Error() != "container is not running" {
+			t.Errorf("expected a not running error, got %v", err)
+		}
+	})
+}
+
+func TestDiagnoseUnhealthy(t *testing.T) {
+	tests := []struct {
+		name     string
+		inspect  container.InspectResponse
+		expected string
+	}{
+		{
+			name:     "missing state",
+			inspect:  container.InspectResponse{},
+			expected: "",
+		},
+		{
+			name: "crash loop",
+			inspect: container.InspectResponse{ContainerJSONBase: &container.ContainerJSONBase{
+				RestartCount: 4,
+				State:        &container.State{Status: container.StateRestarting, Restarting: true, ExitCode: 1},
+			}},
+			expected: "container is restarting after 4 restarts, it is likely crashing on startup; check its logs",
+		},
+		{
+			name: "out of memory",
+			inspect: container.InspectResponse{ContainerJSONBase: &container.ContainerJSONBase{
+				State: &container.State{Status: container.StateExited, OOMKilled: true, ExitCode: 137},
+			}},
+			expected: "container was killed for running out of memory; raise its memory limit",
+		},
+		{
+			name: "startup crash",
+			inspect: container.InspectResponse{ContainerJSONBase: &container.ContainerJSONBase{
+				State: &container.State{Status: container.StateExited, ExitCode: 3},
+			}},
+			expected: "container exited with code 3 during startup; check its logs",
+		},
+		{
+			name: "stuck starting",
+			inspect: container.InspectResponse{ContainerJSONBase: &container.ContainerJSONBase{
+				State: &container.State{Status: container.StateRunning, Running: true, Health: &container.Health{Status: container.Starting}},
+			}},
+			expected: "healthcheck never passed while starting; check the healthcheck command, or raise its interval, retries or start_period if the service is slow to start",
+		},
+		{
+			name: "failing healthcheck",
+			inspect: container.InspectResponse{ContainerJSONBase: &container.ContainerJSONBase{
+				State: &container.State{Status: container.StateRunning, Running: true, Health: &container.Health{
+					Status:        container.Unhealthy,
+					FailingStreak: 3,
+					Log:           []*container.HealthcheckResult{{ExitCode: 1, Output: "curl: (7) Failed to connect\n"}},
+				}},
+			}},
+			expected: "healthcheck is failing after 3 consecutive attempts, last output: curl: (7) Failed to connect",
+		},
+		{
+			name: "running without a healthcheck",
+			inspect: container.InspectResponse{ContainerJSONBase: &container.ContainerJSONBase{
+				State: &container.State{Status: container.StateRunning, Running: true},
+			}},
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if hint := diagnoseUnhealthy(tt.inspect); hint != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, hint)
+			}
+		})
+	}
+}
+
+func TestWaitForHealthcheckContainerTimeout(t *testing.T) {
+	mockClient := &mockDockerClient{
+		containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+			return container.InspectResponse{
+				ContainerJSONBase: &container.ContainerJSONBase{
+					State: &container.State{
+						Health: &container.Health{
+							Status: "starting",
+						},
+					},
+				},
+			}, nil
+		},
+	}
+
+	executor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+		return ExecCommandResponse{ExitCode: 0}, nil
+	}
+
+	// The ticker never fires, so only the per-container timeout can end the wait
+	input := WaitForHealthcheckInput{
+		Client:           mockClient,
+		ContainerID:      "test-id",
+		ContainerTimeout: 10 * time.Millisecond,
+		Executor:         executor,
+		Monitor:          1 * time.Hour,
+		TickerCh:         make(chan time.Time),
+	}
+
+	started := time.Now()
+	err := waitForHealthcheck(context.Background(), input)
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if !strings.Contains(err.Error(), "per-container timeout of 10ms") {
+		t.Errorf("expected per-container timeout error, got '%v'", err)
+	}
+	if time.Since(started) > 5*time.Second {
+		t.Errorf("expected the per-container timeout to fire before the monitor deadline")
+	}
 }
 
 func TestRunHostScript(t *testing.T) {
@@ -273,6 +682,55 @@ func TestRunHostScript(t *testing.T) {
 		}
 	})
 
+	t.Run("health url from the published port", func(t *testing.T) {
+		mockClient := &mockDockerClient{
+			containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+				return container.InspectResponse{
+					ContainerJSONBase: &container.ContainerJSONBase{
+						ID:         id,
+						Name:       "/web-1",
+						HostConfig: &container.HostConfig{NetworkMode: "bridge"},
+					},
+					NetworkSettings: &container.NetworkSettings{
+						NetworkSettingsBase: container.NetworkSettingsBase{
+							Ports: nat.PortMap{
+								"8080/tcp": []nat.PortBinding{{HostIP: "0.0.0.0", HostPort: "32768"}},
+							},
+						},
+						Networks: map[string]*network.EndpointSettings{
+							"bridge": {IPAddress: "172.17.0.2"},
+						},
+					},
+				}, nil
+			},
+		}
+
+		var executedCommand string
+		executor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+			content, _ := os.ReadFile(input.Command)
+			executedCommand = string(content)
+			return ExecCommandResponse{ExitCode: 0}, nil
+		}
+
+		err := runHostScript(ctx, runScriptInput{
+			Client:          mockClient,
+			ContainerID:     "12345678901234567890",
+			Executor:        executor,
+			HealthURLScheme: "https",
+			ServiceName:     "web",
+			Script:          "curl -f {{.HealthURL}}/health",
+			ScriptType:      "healthcheck",
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected := "curl -f https://127.0.0.1:32768/health"
+		if !strings.Contains(executedCommand, expected) {
+			t.Errorf("expected command to contain %q, got %q", expected, executedCommand)
+		}
+	})
+
 	t.Run("failing command", func(t *testing.T) {
 		mockClient := &mockDockerClient{
 			containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
@@ -378,6 +836,309 @@ func TestRunHostScript(t *testing.T) {
 			t.Errorf("expected inspect error, got %v", err)
 		}
 	})
+
+	t.Run("expected output", func(t *testing.T) {
+		mockClient := &mockDockerClient{
+			containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+				return container.InspectResponse{
+					ContainerJSONBase: &container.ContainerJSONBase{
+						ID:         id,
+						HostConfig: &container.HostConfig{NetworkMode: "bridge"},
+					},
+					NetworkSettings: &container.NetworkSettings{
+						Networks: map[string]*network.EndpointSettings{
+							"bridge": {IPAddress: "172.17.0.2"},
+						},
+					},
+				}, nil
+			},
+		}
+
+		// executor exits 0 after printing the given stdout
+		executor := func(stdout string) CommandExecutor {
+			return func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+				input.StdoutWriter.Write([]byte(stdout))
+				return ExecCommandResponse{ExitCode: 0, Stdout: stdout}, nil
+			}
+		}
+
+		input := runScriptInput{
+			Client:       mockClient,
+			ContainerID:  "12345678901234567890",
+			ExpectOutput: regexp.MustCompile(`"status":\s*"ok"`),
+			ServiceName:  "web",
+			Script:       "curl -s http://{{.ContainerIP}}/health",
+			ScriptType:   "healthcheck",
+		}
+
+		input.Executor = executor(`{"status": "ok"}` + "\n")
+		if err := runHostScript(ctx, input); err != nil {
+			t.Errorf("expected matching output to pass, got %v", err)
+		}
+
+		input.Executor = executor(`{"status": "degraded"}` + "\n")
+		err := runHostScript(ctx, input)
+		if err == nil || !strings.Contains(err.Error(), `healthcheck command output for container 123456789012 did not match`) {
+			t.Fatalf("expected non-matching output to fail, got %v", err)
+		}
+		if output := healthcheckFailureOutput(err); !strings.Contains(output, `{"status": "degraded"}`) {
+			t.Errorf("expected the failure to carry the command output, got %q", output)
+		}
+	})
+}
+
+func TestSmokeTestHealthcheck(t *testing.T) {
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	mockClient := &mockDockerClient{
+		containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+			return container.InspectResponse{
+				ContainerJSONBase: &container.ContainerJSONBase{
+					ID:         id,
+					HostConfig: &container.HostConfig{NetworkMode: "bridge"},
+				},
+				NetworkSettings: &container.NetworkSettings{
+					Networks: map[string]*network.EndpointSettings{
+						"bridge": {IPAddress: "172.17.0.2"},
+					},
+				},
+			}, nil
+		},
+	}
+
+	tests := []struct {
+		name          string
+		exitCode      int
+		stderr        string
+		expectedError string
+		expectedLog   string
+	}{
+		{
+			name:        "passing check",
+			expectedLog: "Healthcheck smoke test passed: service=web, container=old1_contain",
+		},
+		{
+			name:          "missing binary under bash",
+			exitCode:      127,
+			stderr:        "/tmp/healthcheck-1.script: line 2: curlx: command not found",
+			expectedError: "host healthcheck command cannot run, no container was replaced: service=web, container=old1_contain, error=/tmp/healthcheck-1.script: line 2: curlx: command not found",
+		},
+		{
+			name:          "missing binary under sh",
+			exitCode:      127,
+			stderr:        "/tmp/healthcheck-1.script: 2: curlx: not found",
+			expectedError: "host healthcheck command cannot run, no container was replaced: service=web, container=old1_contain, error=/tmp/healthcheck-1.script: 2: curlx: not found",
+		},
+		{
+			name:        "failing but valid check",
+			exitCode:    7,
+			stderr:      "curl: (7) Failed to connect to 172.17.0.2 port 80: Connection refused",
+			expectedLog: "Healthcheck smoke test failed against a running container, continuing: service=web, container=old1_contain",
+		},
+		{
+			name:        "check reporting a missing page",
+			exitCode:    22,
+			stderr:      "curl: (22) The requested URL returned error: 404 Not Found",
+			expectedLog: "Healthcheck smoke test failed against a running container, continuing: service=web, container=old1_contain",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			executor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+				if tt.exitCode == 0 {
+					return ExecCommandResponse{ExitCode: 0}, nil
+				}
+				_, _ = input.StderrWriter.Write([]byte(tt.stderr))
+				return ExecCommandResponse{ExitCode: tt.exitCode, Stderr: tt.stderr}, errors.New(tt.stderr)
+			}
+
+			err := smokeTestHealthcheck(context.Background(), logger, runScriptInput{
+				Client:      mockClient,
+				ContainerID: "old1_container_id",
+				Executor:    executor,
+				ServiceName: "web",
+				Script:      "curl --fail http://{{ .ContainerIP }}/health",
+				ScriptType:  "healthcheck",
+			})
+			if tt.expectedError != "" {
+				if err == nil || err.Error() != tt.expectedError {
+					t.Errorf("expected error %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !strings.Contains(buf.String(), tt.expectedLog) {
+				t.Errorf("expected log %q, got %s", tt.expectedLog, buf.String())
+			}
+		})
+	}
+}
+
+func TestLoadHealthcheckCommandFile(t *testing.T) {
+	projectDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(projectDir, "checks"), 0755); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	script := "curl -f http://{{.ContainerIP}}:8080/health\n"
+	if err := os.WriteFile(filepath.Join(projectDir, "checks", "health.sh"), []byte(script), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	resolve := func(input DeployServiceInput, extensions types.Extensions) (DeployParams, error) {
+		input.ComposeFile = filepath.Join(projectDir, "docker-compose.yml")
+		input.ServiceName = "web"
+		return resolveDeployParams(context.Background(), input, &types.ServiceConfig{
+			Name: "web",
+			Deploy: &types.DeployConfig{
+				UpdateConfig: &types.UpdateConfig{Extensions: extensions},
+			},
+		})
+	}
+
+	t.Run("renders the script from the file", func(t *testing.T) {
+		params, err := resolve(DeployServiceInput{}, types.Extensions{"x-healthcheck-host-command-file": "checks/health.sh"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if params.HealthcheckCommand != script {
+			t.Fatalf("expected the healthcheck command to be read from the file, got %q", params.HealthcheckCommand)
+		}
+
+		var rendered string
+		err = runHostScript(context.Background(), runScriptInput{
+			Client: &mockDockerClient{
+				containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+					return container.InspectResponse{
+						NetworkSettings: &container.NetworkSettings{
+							Networks: map[string]*network.EndpointSettings{"bridge": {IPAddress: "172.17.0.2"}},
+						},
+					}, nil
+				},
+			},
+			ContainerID: "container_id",
+			Executor: func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+				data, err := os.ReadFile(input.Command)
+				rendered = string(data)
+				return ExecCommandResponse{ExitCode: 0}, err
+			},
+			ServiceName: "web",
+			Script:      params.HealthcheckCommand,
+			ScriptType:  "healthcheck",
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !strings.Contains(rendered, "curl -f http://172.17.0.2:8080/health") {
+			t.Errorf("expected the script to be rendered, got %q", rendered)
+		}
+	})
+
+	t.Run("flag takes precedence", func(t *testing.T) {
+		flagFile := filepath.Join(t.TempDir(), "flag.sh")
+		if err := os.WriteFile(flagFile, []byte("exit 0"), 0644); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		params, err := resolve(DeployServiceInput{HealthcheckCommandFile: flagFile}, types.Extensions{"x-healthcheck-host-command": "exit 1"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if params.HealthcheckCommand != "exit 0" {
+			t.Errorf("expected the flag file to override the extension, got %q", params.HealthcheckCommand)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := resolve(DeployServiceInput{}, types.Extensions{"x-healthcheck-host-command-file": "checks/missing.sh"})
+		if err == nil || !strings.Contains(err.Error(), "error reading healthcheck command file") {
+			t.Errorf("expected a missing file error, got %v", err)
+		}
+	})
+
+	t.Run("both set", func(t *testing.T) {
+		_, err := resolve(DeployServiceInput{}, types.Extensions{
+			"x-healthcheck-host-command":      "exit 0",
+			"x-healthcheck-host-command-file": "checks/health.sh",
+		})
+		if err == nil || err.Error() != "x-healthcheck-host-command and x-healthcheck-host-command-file cannot both be set: service=web" {
+			t.Errorf("expected a conflict error, got %v", err)
+		}
+	})
+}
+
+func TestDefaultHealthcheckCommand(t *testing.T) {
+	services := []types.ServiceConfig{
+		{Name: "bare", Image: "bare:latest"},
+		{Name: "compose", Image: "bare:latest", HealthCheck: &types.HealthCheckConfig{Test: types.HealthCheckTest{"CMD", "true"}}},
+		{Name: "disabled", Image: "bare:latest", HealthCheck: &types.HealthCheckConfig{Disable: true}},
+		{Name: "host-command", Image: "bare:latest", Deploy: &types.DeployConfig{
+			UpdateConfig: &types.UpdateConfig{Extensions: types.Extensions{"x-healthcheck-host-command": "exit 1"}},
+		}},
+		{Name: "image", Image: "healthy:latest"},
+		{Name: "unpulled", Image: "missing:latest"},
+	}
+
+	mockClient := &mockDockerClient{
+		imageInspect: func(ctx context.Context, imageID string) (image.InspectResponse, error) {
+			switch imageID {
+			case "healthy:latest":
+				config := &dockerspec.DockerOCIImageConfig{}
+				config.Healthcheck = &dockerspec.HealthcheckConfig{Test: []string{"CMD-SHELL", "curl -f localhost"}}
+				return image.InspectResponse{ID: imageID, Config: config}, nil
+			case "missing:latest":
+				return image.InspectResponse{}, errors.New("no such image")
+			}
+			return image.InspectResponse{ID: imageID, Config: &dockerspec.DockerOCIImageConfig{}}, nil
+		},
+	}
+
+	expected := map[string]string{
+		"bare":         "exit 0",
+		"compose":      "",
+		"disabled":     "",
+		"host-command": "exit 1",
+		"image":        "",
+		"unpulled":     "exit 0",
+	}
+	for _, service := range services {
+		t.Run(service.Name, func(t *testing.T) {
+			input := DeployServiceInput{
+				Client:                    mockClient,
+				DefaultHealthcheckCommand: "exit 0",
+				ServiceName:               service.Name,
+			}
+			params, err := resolveDeployParams(context.Background(), input, &service)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			command := defaultHealthcheckCommand(context.Background(), input, &service, params)
+			if command != "" {
+				params.HealthcheckCommand = command
+			}
+			if params.HealthcheckCommand != expected[service.Name] {
+				t.Errorf("expected host healthcheck command %q, got %q", expected[service.Name], params.HealthcheckCommand)
+			}
+		})
+	}
+
+	t.Run("unset", func(t *testing.T) {
+		service := services[0]
+		command := defaultHealthcheckCommand(context.Background(), DeployServiceInput{Client: mockClient, ServiceName: "bare"}, &service, DeployParams{})
+		if command != "" {
+			t.Errorf("expected no default healthcheck command, got %q", command)
+		}
+	})
 }
 
 func TestGetContainerIP(t *testing.T) {
@@ -487,4 +1248,273 @@ func TestGetContainerIP(t *testing.T) {
 			t.Errorf("expected empty IP for network mismatch, got %s", ip)
 		}
 	})
+
+	t.Run("missing network settings", func(t *testing.T) {
+		client := &mockDockerClient{
+			containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+				return container.InspectResponse{
+					ContainerJSONBase: &container.ContainerJSONBase{},
+				}, nil
+			},
+		}
+		_, err := getContainerIP(ctx, client, "id")
+		if err == nil || err.Error() != "container id inspect response has no network settings" {
+			t.Errorf("expected a missing network settings error, got %v", err)
+		}
+	})
+
+	t.Run("nil network endpoint", func(t *testing.T) {
+		client := &mockDockerClient{
+			containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+				return container.InspectResponse{
+					NetworkSettings: &container.NetworkSettings{
+						Networks: map[string]*network.EndpointSettings{
+							"bridge": nil,
+						},
+					},
+				}, nil
+			},
+		}
+		ip, err := getContainerIP(ctx, client, "id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ip != "" {
+			t.Errorf("expected empty IP for a nil endpoint, got %s", ip)
+		}
+	})
+}
+
+func TestWaitForDependencies(t *testing.T) {
+	ctx := context.Background()
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	project := &types.Project{
+		Services: types.Services{
+			"web": types.ServiceConfig{
+				Name: "web",
+				DependsOn: types.DependsOnConfig{
+					"db":     {Condition: types.ServiceConditionHealthy},
+					"worker": {Condition: types.ServiceConditionStarted},
+				},
+			},
+			"db": types.ServiceConfig{
+				Name: "db",
+			},
+			"worker": types.ServiceConfig{
+				Name: "worker",
+			},
+		},
+	}
+
+	newMockClient := func(status string) *mockDockerClient {
+		return &mockDockerClient{
+			containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+				if !options.Filters.ExactMatch("label", "com.docker.compose.service=db") {
+					t.Errorf("expected only the service_healthy dependency to be checked, got filters %v", options.Filters)
+				}
+				return []container.Summary{{ID: "db_container_id"}}, nil
+			},
+			containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+				return container.InspectResponse{
+					ContainerJSONBase: &container.ContainerJSONBase{
+						State: &container.State{
+							Running: true,
+							Health: &container.Health{
+								Status: status,
+							},
+						},
+					},
+				}, nil
+			},
+		}
+	}
+
+	t.Run("dependency is healthy", func(t *testing.T) {
+		err := waitForDependencies(ctx, WaitForDependenciesInput{
+			Client:      newMockClient("healthy"),
+			Logger:      logger,
+			Project:     project,
+			ProjectName: "proj",
+			ServiceName: "web",
+			Timeout:     time.Second,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("dependency stays unhealthy", func(t *testing.T) {
+		tickerCh := make(chan time.Time, 1)
+		tickerCh <- time.Now()
+
+		err := waitForDependencies(ctx, WaitForDependenciesInput{
+			Client:      newMockClient("unhealthy"),
+			Logger:      logger,
+			Project:     project,
+			ProjectName: "proj",
+			ServiceName: "web",
+			TickerCh:    tickerCh,
+			Timeout:     20 * time.Millisecond,
+		})
+		if err == nil {
+			t.Fatal("expected error, got nil")
+		}
+		if err.Error() != "dependency db not healthy within 20ms" {
+			t.Errorf("expected dependency timeout error, got '%v'", err)
+		}
+	})
+
+	// a dependency that this deploy never starts would otherwise block until
+	// the timeout
+	unchecked := &mockDockerClient{
+		containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+			t.Errorf("expected the dependency not to be checked, got filters %v", options.Filters)
+			return []container.Summary{}, nil
+		},
+	}
+
+	t.Run("dependency outside of the deploy", func(t *testing.T) {
+		err := waitForDependencies(ctx, WaitForDependenciesInput{
+			Client:           unchecked,
+			DeployedServices: []string{"web", "worker"},
+			Logger:           logger,
+			Project:          project,
+			ProjectName:      "proj",
+			ServiceName:      "web",
+			Timeout:          time.Second,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("failed dependency", func(t *testing.T) {
+		failedProject := &types.Project{
+			Services: types.Services{
+				"web": types.ServiceConfig{
+					Name: "web",
+					DependsOn: types.DependsOnConfig{
+						"cache": {Condition: types.ServiceConditionHealthy},
+						"db":    {Condition: types.ServiceConditionHealthy},
+					},
+				},
+				"cache": types.ServiceConfig{Name: "cache"},
+				"db":    types.ServiceConfig{Name: "db"},
+			},
+		}
+
+		// the healthy db is still waited on, and only the failed cache is not
+		err := waitForDependencies(ctx, WaitForDependenciesInput{
+			Client:       newMockClient("healthy"),
+			Logger:       logger,
+			Project:      failedProject,
+			ProjectName:  "proj",
+			ServiceName:  "web",
+			SkipServices: []string{"cache"},
+			Timeout:      time.Second,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("skipped database dependency", func(t *testing.T) {
+		databaseProject := &types.Project{
+			Services: types.Services{
+				"web": project.Services["web"],
+				"db":  types.ServiceConfig{Name: "db", Image: "postgres:16"},
+			},
+		}
+
+		err := waitForDependencies(ctx, WaitForDependenciesInput{
+			Client:        unchecked,
+			Logger:        logger,
+			Project:       databaseProject,
+			ProjectName:   "proj",
+			ServiceName:   "web",
+			SkipDatabases: true,
+			Timeout:       time.Second,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestVerifyGraphHealth(t *testing.T) {
+	ctx := context.Background()
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	project := &types.Project{
+		Services: types.Services{
+			"api": types.ServiceConfig{Name: "api"},
+			"web": types.ServiceConfig{
+				Name: "web",
+				DependsOn: types.DependsOnConfig{
+					"api": {Condition: types.ServiceConditionHealthy},
+				},
+			},
+		},
+	}
+
+	// api was healthy when it deployed, but deploying web broke it
+	webDeployed := false
+	mock := &mockDockerClient{
+		containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+			if options.Filters.ExactMatch("label", "com.docker.compose.service=api") {
+				return []container.Summary{{ID: "api1_container_id"}}, nil
+			}
+			return []container.Summary{{ID: "web1_container_id"}}, nil
+		},
+		containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+			status := container.Healthy
+			if id == "api1_container_id" && webDeployed {
+				status = container.Unhealthy
+			}
+			return container.InspectResponse{
+				ContainerJSONBase: &container.ContainerJSONBase{
+					State: &container.State{
+						Running: true,
+						Health:  &container.Health{Status: status},
+					},
+				},
+			}, nil
+		},
+	}
+
+	input := VerifyGraphHealthInput{
+		Client:       mock,
+		Logger:       logger,
+		Project:      project,
+		ProjectName:  "proj",
+		ServiceNames: []string{"api", "web"},
+	}
+
+	if err := verifyGraphHealth(ctx, input); err != nil {
+		t.Fatalf("unexpected error before web deployed: %v", err)
+	}
+
+	webDeployed = true
+	err := verifyGraphHealth(ctx, input)
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if err.Error() != "graph health verification failed, unhealthy containers: api (api1_contain)" {
+		t.Errorf("unexpected error: %v", err)
+	}
 }
@@ -0,0 +1,205 @@
+package internal
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// historyFileName is the name of the deploy history file kept in the project directory
+const historyFileName = ".docker-orchestrate-history.jsonl"
+
+// HistoryRecord is a single successful service deploy
+type HistoryRecord struct {
+	// DeployID is the ID of the deploy, stamped on its containers
+	DeployID string `json:"deploy_id"`
+	// Image is the image reference the service was deployed with
+	Image string `json:"image"`
+	// ImageID is the ID of the image the deployed containers run
+	ImageID string `json:"image_id,omitempty"`
+	// Project is the name of the project
+	Project string `json:"project"`
+	// Replicas is the number of replicas the service was deployed with
+	Replicas int `json:"replicas"`
+	// Revision is the source revision the service was deployed from
+	Revision string `json:"revision,omitempty"`
+	// Service is the name of the service
+	Service string `json:"service"`
+	// Time is when the deploy completed
+	Time time.Time `json:"time"`
+}
+
+// DeployHistory is an append-only store of deploy records kept as JSON lines.
+// A nil history records nothing, so callers do not need to check whether one
+// is configured.
+type DeployHistory struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewDeployHistory creates a history stored at the given path
+func NewDeployHistory(path string) *DeployHistory {
+	return &DeployHistory{path: path}
+}
+
+// HistoryFile returns the path of the deploy history file for a project directory
+func HistoryFile(projectDir string) string {
+	return filepath.Join(projectDir, historyFileName)
+}
+
+// RevisionFromEnvironment returns the source revision set by the build
+// environment in GIT_SHA or, failing that, SOURCE_COMMIT
+func RevisionFromEnvironment() string {
+	if revision := os.Getenv("GIT_SHA"); revision != "" {
+		return revision
+	}
+	return os.Getenv("SOURCE_COMMIT")
+}
+
+// NewDeployID returns a unique, time-ordered ID for a deploy
+func NewDeployID() string {
+	suffix := make([]byte, 3)
+	_, _ = rand.Read(suffix)
+	return fmt.Sprintf("%s-%s", time.Now().UTC().Format("20060102T150405Z"), hex.EncodeToString(suffix))
+}
+
+// Append adds a record to the history, stamping its time if unset
+func (h *DeployHistory) Append(record HistoryRecord) error {
+	if h == nil {
+		return nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if record.Time.IsZero() {
+		record.Time = time.Now().UTC()
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("error encoding history record: %v", err)
+	}
+
+	f, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening history file: %v", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("error writing history record: %v", err)
+	}
+	return nil
+}
+
+// Records returns the recorded deploys of a service, oldest first, or of
+// every service if the service name is empty
+func (h *DeployHistory) Records(serviceName string) ([]HistoryRecord, error) {
+	records := []HistoryRecord{}
+	if h == nil {
+		return records, nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	f, err := os.Open(h.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening history file: %v", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var record HistoryRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("error parsing history file line %d: %v", line, err)
+		}
+		if serviceName == "" || record.Service == serviceName {
+			records = append(records, record)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading history file: %v", err)
+	}
+
+	return records, nil
+}
+
+// Purge removes every record of a project from the history, returning the
+// number of records removed. The history file is removed once it holds no
+// records of any project.
+func (h *DeployHistory) Purge(projectName string) (int, error) {
+	if h == nil {
+		return 0, nil
+	}
+
+	records, err := h.Records("")
+	if err != nil {
+		return 0, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	kept := []HistoryRecord{}
+	for _, record := range records {
+		if record.Project != projectName {
+			kept = append(kept, record)
+		}
+	}
+	removed := len(records) - len(kept)
+
+	if len(kept) == 0 {
+		if err := os.Remove(h.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return 0, fmt.Errorf("error removing history file: %v", err)
+		}
+		return removed, nil
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+
+	var data []byte
+	for _, record := range kept {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return 0, fmt.Errorf("error encoding history record: %v", err)
+		}
+		data = append(append(data, line...), '\n')
+	}
+
+	tempPath := h.path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0644); err != nil {
+		return 0, fmt.Errorf("error writing history file: %v", err)
+	}
+	if err := os.Rename(tempPath, h.path); err != nil {
+		return 0, fmt.Errorf("error replacing history file: %v", err)
+	}
+	return removed, nil
+}
+
+// PurgeState removes the local state a project keeps in its project
+// directory, so the next deploy of the project starts as its first did. It
+// returns the number of history records removed.
+func PurgeState(projectDir string, projectName string) (int, error) {
+	return NewDeployHistory(HistoryFile(projectDir)).Purge(projectName)
+}
@@ -0,0 +1,142 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeployHistory(t *testing.T) {
+	t.Run("append and read", func(t *testing.T) {
+		history := NewDeployHistory(HistoryFile(t.TempDir()))
+
+		deployedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+		records := []HistoryRecord{
+			{DeployID: "one", Image: "example/web:1", ImageID: "sha256:aaa", Project: "app", Replicas: 2, Service: "web", Time: deployedAt},
+			{DeployID: "one", Image: "example/worker:1", Project: "app", Replicas: 1, Service: "worker", Time: deployedAt},
+			{DeployID: "two", Image: "example/web:2", Project: "app", Replicas: 3, Service: "web"},
+		}
+		for _, record := range records {
+			if err := history.Append(record); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+
+		all, err := history.Records("")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(all) != 3 {
+			t.Fatalf("expected 3 records, got %d", len(all))
+		}
+		if all[0] != records[0] {
+			t.Errorf("expected record %+v, got %+v", records[0], all[0])
+		}
+		if all[2].Time.IsZero() {
+			t.Error("expected an unset time to be stamped on append")
+		}
+
+		web, err := history.Records("web")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(web) != 2 || web[0].DeployID != "one" || web[1].DeployID != "two" {
+			t.Errorf("expected the web deploys oldest first, got %+v", web)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		history := NewDeployHistory(filepath.Join(t.TempDir(), "missing.jsonl"))
+		records, err := history.Records("")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(records) != 0 {
+			t.Errorf("expected no records, got %+v", records)
+		}
+	})
+
+	t.Run("malformed line", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "history.jsonl")
+		if err := os.WriteFile(path, []byte("{\"service\":\"web\"}\nnot json\n"), 0644); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		_, err := NewDeployHistory(path).Records("")
+		if err == nil || !strings.HasPrefix(err.Error(), "error parsing history file line 2:") {
+			t.Errorf("expected a parse error for line 2, got %v", err)
+		}
+	})
+
+	t.Run("nil history", func(t *testing.T) {
+		var history *DeployHistory
+		if err := history.Append(HistoryRecord{Service: "web"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		records, err := history.Records("")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(records) != 0 {
+			t.Errorf("expected no records, got %+v", records)
+		}
+	})
+}
+
+func TestPurgeState(t *testing.T) {
+	projectDir := t.TempDir()
+	history := NewDeployHistory(HistoryFile(projectDir))
+	for _, record := range []HistoryRecord{
+		{DeployID: "one", Image: "example/web:1", Project: "app", Replicas: 1, Service: "web"},
+		{DeployID: "one", Image: "example/api:1", Project: "other", Replicas: 1, Service: "api"},
+		{DeployID: "two", Image: "example/web:2", Project: "app", Replicas: 2, Service: "web"},
+	} {
+		if err := history.Append(record); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	removed, err := PurgeState(projectDir, "app")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("expected 2 records removed, got %d", removed)
+	}
+
+	records, err := history.Records("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(records) != 1 || records[0].Project != "other" {
+		t.Errorf("expected only the other project's record to be left, got %+v", records)
+	}
+
+	// the next deploy of the project is recorded as its first
+	if err := history.Append(HistoryRecord{DeployID: "three", Image: "example/web:3", Project: "app", Replicas: 1, Service: "web"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	web, err := history.Records("web")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(web) != 1 || web[0].DeployID != "three" {
+		t.Errorf("expected the new deploy to be the only web record, got %+v", web)
+	}
+
+	if _, err := PurgeState(projectDir, "app"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := PurgeState(projectDir, "other"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(HistoryFile(projectDir)); !os.IsNotExist(err) {
+		t.Errorf("expected the history file to be removed once empty, got %v", err)
+	}
+
+	if removed, err := PurgeState(projectDir, "app"); err != nil || removed != 0 {
+		t.Errorf("expected purging missing state to be a no-op, got %d, %v", removed, err)
+	}
+}
@@ -0,0 +1,70 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/compose-spec/compose-go/v2/loader"
+	"github.com/compose-spec/compose-go/v2/types"
+)
+
+// ImageProjectInput is the input for the ImageProject function
+type ImageProjectInput struct {
+	// Image is the image the service runs
+	Image string
+	// ProjectName is the name of the project
+	ProjectName string
+	// ServiceName is the name of the service
+	ServiceName string
+	// WorkingDir is the directory the project is deployed from
+	WorkingDir string
+}
+
+// ImageProject synthesizes a project of a single service running the
+// image, for deploying without a compose file
+func ImageProject(input ImageProjectInput) (*types.Project, error) {
+	if input.Image == "" {
+		return nil, fmt.Errorf("an image is required to deploy without a compose file")
+	}
+	if input.ServiceName == "" {
+		return nil, fmt.Errorf("a service name is required to deploy an image without a compose file")
+	}
+
+	projectName := loader.NormalizeProjectName(input.ProjectName)
+	if projectName == "" {
+		return nil, fmt.Errorf("invalid project name %q: must contain a letter or digit", input.ProjectName)
+	}
+
+	return &types.Project{
+		Name:       projectName,
+		WorkingDir: input.WorkingDir,
+		Services: types.Services{
+			input.ServiceName: types.ServiceConfig{
+				Name:  input.ServiceName,
+				Image: input.Image,
+			},
+		},
+	}, nil
+}
+
+// WriteImageComposeFile writes a synthesized project to a compose file in
+// a new temporary directory, so the `docker compose` calls of the deploy
+// have a file to read. The returned function removes the directory.
+func WriteImageComposeFile(project *types.Project) (string, func(), error) {
+	dir, err := os.MkdirTemp("", "docker-orchestrate-")
+	if err != nil {
+		return "", nil, fmt.Errorf("error creating compose file directory: %v", err)
+	}
+	cleanup := func() {
+		_ = os.RemoveAll(dir)
+	}
+
+	composeFile := filepath.Join(dir, "docker-compose.yaml")
+	if err := DumpComposeConfig(project, composeFile); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+
+	return composeFile, cleanup, nil
+}
@@ -0,0 +1,112 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/josegonzalez/cli-skeleton/command"
+	"github.com/rs/zerolog"
+)
+
+func TestDeployImageProject(t *testing.T) {
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	project, err := ImageProject(ImageProjectInput{
+		Image:       "nginx:alpine",
+		ProjectName: "Ad Hoc",
+		ServiceName: "web",
+		WorkingDir:  t.TempDir(),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if project.Name != "adhoc" {
+		t.Errorf("expected the project name to be normalized, got %q", project.Name)
+	}
+
+	// poll the new containers quickly
+	service := project.Services["web"]
+	service.Deploy = &types.DeployConfig{UpdateConfig: &types.UpdateConfig{Monitor: types.Duration(time.Millisecond)}}
+	project.Services["web"] = service
+
+	composeFile, cleanup, err := WriteImageComposeFile(project)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	contents, err := os.ReadFile(composeFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(contents), "image: nginx:alpine") {
+		t.Errorf("expected the compose file to run the image, got:\n%s", contents)
+	}
+
+	containers := []container.Summary{}
+	mockClient := &mockDockerClient{
+		containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+			return slices.Clone(containers), nil
+		},
+		containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+			return container.InspectResponse{
+				ContainerJSONBase: &container.ContainerJSONBase{
+					State: &container.State{Running: true},
+				},
+			}, nil
+		},
+	}
+
+	creates := [][]string{}
+	executor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+		if slices.Contains(input.Args, "create") {
+			creates = append(creates, input.Args)
+			for i := len(containers) + 1; i <= 2; i++ {
+				containers = append(containers, container.Summary{
+					ID:     fmt.Sprintf("new%d_container_id", i),
+					Image:  "nginx:alpine",
+					Labels: map[string]string{"com.docker.compose.container-number": fmt.Sprint(i)},
+					State:  container.StateRunning,
+				})
+			}
+		}
+		return ExecCommandResponse{ExitCode: 0}, nil
+	}
+
+	err = DeployService(context.Background(), DeployServiceInput{
+		Client:      mockClient,
+		ComposeFile: composeFile,
+		Executor:    executor,
+		Logger:      logger,
+		Project:     project,
+		ProjectName: project.Name,
+		Replicas:    2,
+		ServiceName: "web",
+		SkipRename:  true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(creates) != 1 || creates[0][2] != composeFile || !slices.Contains(creates[0], "web=2") || !slices.Contains(creates[0], "adhoc") {
+		t.Errorf("expected the service to be created from the synthesized compose file, got %v", creates)
+	}
+
+	cleanup()
+	if _, err := os.Stat(composeFile); !os.IsNotExist(err) {
+		t.Errorf("expected the compose file to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,151 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/josegonzalez/cli-skeleton/command"
+)
+
+// VerifyImagesInput is the input for the verifyImages function
+type VerifyImagesInput struct {
+	// Client is the Docker client to use
+	Client DockerClientInterface
+	// Executor is the command executor to use
+	Executor CommandExecutor
+	// Logger is the logger to use
+	Logger *command.ZerologUi
+	// Services are the services whose images should be verified
+	Services []types.ServiceConfig
+	// SkipDatabases is whether database services are skipped, and so not verified
+	SkipDatabases bool
+}
+
+// verifyImages checks the image of each service is present locally or can
+// be pulled from its registry, so that a missing image fails the deploy
+// before any old container is stopped
+func verifyImages(ctx context.Context, input VerifyImagesInput) error {
+	executor := input.Executor
+	if executor == nil {
+		executor = ExecCommand
+	}
+
+	checked := []string{}
+	for _, service := range input.Services {
+		// built images do not exist until compose builds them
+		if service.Image == "" || service.Build != nil || slices.Contains(checked, service.Image) {
+			continue
+		}
+
+		if shouldSkipService(ShouldSkipServiceInput{
+			Logger:              input.Logger,
+			Service:             &service,
+			ShouldSkipDatabases: input.SkipDatabases,
+			SilenceLogging:      true,
+		}) {
+			continue
+		}
+		checked = append(checked, service.Image)
+
+		_, err := input.Client.ImageInspect(ctx, service.Image)
+		if err == nil {
+			input.Logger.Info(fmt.Sprintf("Verified image: image=%s, source=local", service.Image))
+			continue
+		}
+		if !cerrdefs.IsNotFound(err) {
+			return fmt.Errorf("error inspecting image %s: %v", service.Image, err)
+		}
+
+		if service.PullPolicy == types.PullPolicyNever {
+			return fmt.Errorf("image %s not found", service.Image)
+		}
+
+		// The manifest check goes through the docker cli, so registry
+		// credentials from `docker login` apply as they do for a pull
+		_, err = executor(ctx, ExecCommandInput{
+			Command: "docker",
+			Args:    []string{"manifest", "inspect", service.Image},
+		})
+		if err != nil {
+			return fmt.Errorf("image %s not found: %v", service.Image, err)
+		}
+		input.Logger.Info(fmt.Sprintf("Verified image: image=%s, source=registry", service.Image))
+	}
+
+	return nil
+}
+
+// WaitForImagesInput is the input for the WaitForImages function
+type WaitForImagesInput struct {
+	// Client is the Docker client to use
+	Client DockerClientInterface
+	// Images are the image references to wait for, such as myapp:v2
+	Images []string
+	// Logger is the logger to use
+	Logger *command.ZerologUi
+	// TickerCh is an optional channel to use for ticking. If nil, time.NewTicker will be used.
+	TickerCh <-chan time.Time
+	// Timeout bounds how long to wait for every image to become available. If 0, waits until the context is done.
+	Timeout time.Duration
+}
+
+// WaitForImages blocks until every image is available in its registry, as
+// reported by a manifest lookup, so a deploy started before the images of a
+// release finished pushing waits for them rather than failing
+func WaitForImages(ctx context.Context, input WaitForImagesInput) error {
+	if input.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, input.Timeout)
+		defer cancel()
+	}
+
+	tickerCh := input.TickerCh
+	if tickerCh == nil {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+		tickerCh = ticker.C
+	}
+
+	pending := slices.Clone(input.Images)
+	input.Logger.Info(fmt.Sprintf("Waiting for images to become available: images=%s", strings.Join(pending, ",")))
+
+	// the last lookup error of each pending image, reported on timeout
+	lastErrs := map[string]error{}
+	for {
+		available := []string{}
+		for _, imageRef := range pending {
+			inspect, err := input.Client.DistributionInspect(ctx, imageRef)
+			if err != nil {
+				lastErrs[imageRef] = err
+				continue
+			}
+			input.Logger.Info(fmt.Sprintf("Image available: image=%s, digest=%s", imageRef, inspect.Descriptor.Digest))
+			available = append(available, imageRef)
+		}
+		pending = slices.DeleteFunc(pending, func(imageRef string) bool {
+			return slices.Contains(available, imageRef)
+		})
+		if len(pending) == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) && input.Timeout > 0 {
+				messages := []string{}
+				for _, imageRef := range pending {
+					messages = append(messages, fmt.Sprintf("%s: %v", imageRef, lastErrs[imageRef]))
+				}
+				return fmt.Errorf("images not available within %v: %s", input.Timeout, strings.Join(messages, "; "))
+			}
+			return ctx.Err()
+		case <-tickerCh:
+		}
+	}
+}
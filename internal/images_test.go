@@ -0,0 +1,225 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/registry"
+	"github.com/josegonzalez/cli-skeleton/command"
+	"github.com/rs/zerolog"
+)
+
+func TestVerifyImages(t *testing.T) {
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger: zerolog.New(&buf),
+		StdoutLogger: zerolog.New(&buf),
+	}
+
+	localImages := []string{"example/web:1.0"}
+	registryImages := []string{"nginx:1.27"}
+	client := &mockDockerClient{
+		imageInspect: func(ctx context.Context, imageID string) (image.InspectResponse, error) {
+			if slices.Contains(localImages, imageID) {
+				return image.InspectResponse{ID: imageID}, nil
+			}
+			return image.InspectResponse{}, fmt.Errorf("no such image: %s: %w", imageID, cerrdefs.ErrNotFound)
+		},
+	}
+	executor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+		if slices.Contains(registryImages, input.Args[len(input.Args)-1]) {
+			return ExecCommandResponse{ExitCode: 0}, nil
+		}
+		return ExecCommandResponse{ExitCode: 1}, errors.New("no such manifest")
+	}
+
+	tests := []struct {
+		name          string
+		services      []types.ServiceConfig
+		expectedError string
+	}{
+		{
+			name: "present locally or in the registry",
+			services: []types.ServiceConfig{
+				{Name: "web", Image: "example/web:1.0"},
+				{Name: "proxy", Image: "nginx:1.27"},
+			},
+		},
+		{
+			name: "built images are not checked",
+			services: []types.ServiceConfig{
+				{Name: "web", Image: "example/web:dev", Build: &types.BuildConfig{Context: "."}},
+			},
+		},
+		{
+			name: "missing everywhere",
+			services: []types.ServiceConfig{
+				{Name: "web", Image: "example/web:1.0"},
+				{Name: "worker", Image: "example/worker:2.0"},
+			},
+			expectedError: "image example/worker:2.0 not found: no such manifest",
+		},
+		{
+			name: "never pulled and missing locally",
+			services: []types.ServiceConfig{
+				{Name: "proxy", Image: "nginx:1.27", PullPolicy: types.PullPolicyNever},
+			},
+			expectedError: "image nginx:1.27 not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyImages(context.Background(), VerifyImagesInput{
+				Client:   client,
+				Executor: executor,
+				Logger:   logger,
+				Services: tt.services,
+			})
+			if tt.expectedError == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.expectedError {
+				t.Errorf("expected error %q, got %v", tt.expectedError, err)
+			}
+		})
+	}
+
+	t.Run("inspect failure", func(t *testing.T) {
+		client := &mockDockerClient{
+			imageInspect: func(ctx context.Context, imageID string) (image.InspectResponse, error) {
+				return image.InspectResponse{}, errors.New("connection refused")
+			},
+		}
+
+		err := verifyImages(context.Background(), VerifyImagesInput{
+			Client:   client,
+			Executor: executor,
+			Logger:   logger,
+			Services: []types.ServiceConfig{{Name: "web", Image: "example/web:1.0"}},
+		})
+		if err == nil || err.Error() != "error inspecting image example/web:1.0: connection refused" {
+			t.Errorf("expected an inspect error, got %v", err)
+		}
+	})
+}
+
+func TestDeployServiceVerifyImageExists(t *testing.T) {
+	touched := []string{}
+	client := &mockDockerClient{
+		containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+			return []container.Summary{{ID: "old1_container_id", State: container.StateRunning}}, nil
+		},
+		containerStart: func(ctx context.Context, id string, options container.StartOptions) error {
+			touched = append(touched, "start "+id)
+			return nil
+		},
+		containerTerminate: func(ctx context.Context, id string, stopTimeout time.Duration) error {
+			touched = append(touched, "terminate "+id)
+			return nil
+		},
+		imageInspect: func(ctx context.Context, imageID string) (image.InspectResponse, error) {
+			return image.InspectResponse{}, fmt.Errorf("no such image: %s: %w", imageID, cerrdefs.ErrNotFound)
+		},
+	}
+	executor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+		if slices.Contains(input.Args, "manifest") {
+			return ExecCommandResponse{ExitCode: 1}, errors.New("manifest unknown")
+		}
+		touched = append(touched, strings.Join(input.Args, " "))
+		return ExecCommandResponse{ExitCode: 0}, nil
+	}
+
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger: zerolog.New(&buf),
+		StdoutLogger: zerolog.New(&buf),
+	}
+
+	err := DeployService(context.Background(), DeployServiceInput{
+		Client:                client,
+		ComposeFile:           "/tmp/docker-compose.yaml",
+		ContainerNameTemplate: "{{.ServiceName}}",
+		Executor:              executor,
+		Logger:                logger,
+		Project: &types.Project{
+			Services: types.Services{
+				"web": types.ServiceConfig{Name: "web", Image: "example/web:missing"},
+			},
+		},
+		ProjectName:       "test",
+		ServiceName:       "web",
+		VerifyImageExists: true,
+	})
+	if err == nil || err.Error() != "image example/web:missing not found: manifest unknown" {
+		t.Fatalf("expected a missing image error, got %v", err)
+	}
+	if len(touched) != 0 {
+		t.Errorf("expected no containers to be touched, got %v", touched)
+	}
+}
+
+func TestWaitForImages(t *testing.T) {
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger: zerolog.New(&buf),
+		StdoutLogger: zerolog.New(&buf),
+	}
+
+	// worker:v2 is pushed after a couple of polls
+	polls := map[string]int{}
+	client := &mockDockerClient{
+		distributionInspect: func(ctx context.Context, imageRef string) (registry.DistributionInspect, error) {
+			polls[imageRef]++
+			if imageRef == "worker:v2" && polls[imageRef] <= 2 {
+				return registry.DistributionInspect{}, errors.New("manifest unknown")
+			}
+			if imageRef == "missing:v2" {
+				return registry.DistributionInspect{}, errors.New("manifest unknown")
+			}
+			return registry.DistributionInspect{}, nil
+		},
+	}
+
+	err := WaitForImages(context.Background(), WaitForImagesInput{
+		Client:   client,
+		Images:   []string{"myapp:v2", "worker:v2"},
+		Logger:   logger,
+		TickerCh: testTickerCh(),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if polls["myapp:v2"] != 1 {
+		t.Errorf("expected an available image to be checked once, got %d polls", polls["myapp:v2"])
+	}
+	if polls["worker:v2"] != 3 {
+		t.Errorf("expected worker:v2 to be polled until available, got %d polls", polls["worker:v2"])
+	}
+
+	t.Run("timeout", func(t *testing.T) {
+		err := WaitForImages(context.Background(), WaitForImagesInput{
+			Client:   client,
+			Images:   []string{"myapp:v2", "missing:v2"},
+			Logger:   logger,
+			TickerCh: time.NewTicker(time.Millisecond).C,
+			Timeout:  20 * time.Millisecond,
+		})
+		if err == nil || !strings.Contains(err.Error(), "images not available within 20ms: missing:v2: manifest unknown") {
+			t.Errorf("expected the missing image to time out, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,235 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+)
+
+// interleavedTurns coordinates the rolling updates of interleaved services,
+// so that their batches alternate in lockstep. A service that fails pauses
+// the others at their next batch.
+type interleavedTurns struct {
+	// changed is closed and replaced whenever the turn moves or a service finishes
+	changed chan struct{}
+	// failed is the name of the first service whose deploy failed
+	failed string
+	// finished is the set of services whose deploy has finished
+	finished map[string]bool
+	// mu guards the fields of the interleavedTurns
+	mu sync.Mutex
+	// next is the index of the service whose batch may start next
+	next int
+	// services are the names of the interleaved services, in turn order
+	services []string
+}
+
+// newInterleavedTurns returns the turns of the interleaved services, with
+// the first service taking the first turn
+func newInterleavedTurns(services []string) *interleavedTurns {
+	return &interleavedTurns{
+		changed:  make(chan struct{}),
+		finished: map[string]bool{},
+		services: services,
+	}
+}
+
+// batchTurn returns the BatchTurn callback of a rolling update of the service
+func (t *interleavedTurns) batchTurn(serviceName string) func(ctx context.Context) (func(), error) {
+	return func(ctx context.Context) (func(), error) {
+		for {
+			t.mu.Lock()
+			if t.failed != "" && t.failed != serviceName {
+				t.mu.Unlock()
+				return nil, fmt.Errorf("pausing deployment, interleaved service %s failed", t.failed)
+			}
+			if t.services[t.next] == serviceName {
+				t.mu.Unlock()
+				return func() {
+					t.mu.Lock()
+					defer t.mu.Unlock()
+					t.passTurn()
+				}, nil
+			}
+			changed := t.changed
+			t.mu.Unlock()
+
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-changed:
+			}
+		}
+	}
+}
+
+// finish records that the deploy of the service finished, passing its turn
+// on. If the deploy failed, the other services are paused.
+func (t *interleavedTurns) finish(serviceName string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.finished[serviceName] = true
+	if err != nil && t.failed == "" {
+		t.failed = serviceName
+	}
+	if t.services[t.next] == serviceName {
+		t.passTurn()
+		return
+	}
+	t.notify()
+}
+
+// passTurn moves the turn to the next service whose deploy has not
+// finished. Must be called with mu held.
+func (t *interleavedTurns) passTurn() {
+	for i := 1; i <= len(t.services); i++ {
+		next := (t.next + i) % len(t.services)
+		if !t.finished[t.services[next]] {
+			t.next = next
+			break
+		}
+	}
+	t.notify()
+}
+
+// notify wakes the services waiting for their turn. Must be called with mu
+// held.
+func (t *interleavedTurns) notify() {
+	close(t.changed)
+	t.changed = make(chan struct{})
+}
+
+// validateInterleave checks that the interleaved services can be deployed
+// side by side
+func validateInterleave(input DeployProjectInput, serviceNames []string) error {
+	if len(input.Interleave) == 0 {
+		return nil
+	}
+	if len(input.Interleave) != 2 {
+		return fmt.Errorf("exactly two services must be interleaved, got %d", len(input.Interleave))
+	}
+	if input.Interleave[0] == input.Interleave[1] {
+		return fmt.Errorf("cannot interleave service %s with itself", input.Interleave[0])
+	}
+	if input.Atomic {
+		return fmt.Errorf("interleaved services cannot be deployed atomically")
+	}
+
+	for _, serviceName := range input.Interleave {
+		if !slices.Contains(serviceNames, serviceName) {
+			return fmt.Errorf("interleaved service %s is not being deployed", serviceName)
+		}
+	}
+
+	first, second := input.Interleave[0], input.Interleave[1]
+	if dependsOnService(input.Project, first, second) || dependsOnService(input.Project, second, first) {
+		return fmt.Errorf("cannot interleave services %s and %s as one depends on the other", first, second)
+	}
+	return nil
+}
+
+// dependsOnService returns whether the service depends on the dependency,
+// directly or through other services
+func dependsOnService(project *types.Project, serviceName string, dependency string) bool {
+	seen := map[string]bool{}
+	pending := []string{serviceName}
+	for len(pending) > 0 {
+		name := pending[0]
+		pending = pending[1:]
+		service, ok := project.Services[name]
+		if !ok {
+			continue
+		}
+		for dependsOn := range service.DependsOn {
+			if dependsOn == dependency {
+				return true
+			}
+			if !seen[dependsOn] {
+				seen[dependsOn] = true
+				pending = append(pending, dependsOn)
+			}
+		}
+	}
+	return false
+}
+
+// interleaveOrder moves the interleaved services next to each other in the
+// deploy order, in the order they take turns. The services in between that depend on the first
+// interleaved service are deployed after the pair, and the others before it.
+func interleaveOrder(project *types.Project, serviceNames []string, interleave []string) []string {
+	if len(interleave) != 2 {
+		return serviceNames
+	}
+
+	first := slices.IndexFunc(serviceNames, func(name string) bool { return slices.Contains(interleave, name) })
+	second := first + 1 + slices.IndexFunc(serviceNames[first+1:], func(name string) bool { return slices.Contains(interleave, name) })
+
+	before := []string{}
+	after := []string{}
+	for _, serviceName := range serviceNames[first+1 : second] {
+		if dependsOnService(project, serviceName, serviceNames[first]) {
+			after = append(after, serviceName)
+		} else {
+			before = append(before, serviceName)
+		}
+	}
+
+	ordered := slices.Clone(serviceNames[:first])
+	ordered = append(ordered, before...)
+	ordered = append(ordered, interleave...)
+	ordered = append(ordered, after...)
+	return append(ordered, serviceNames[second+1:]...)
+}
+
+// groupDeploy is the deploy of one service of a group deployed together
+type groupDeploy struct {
+	// Duration is how long the deploy took
+	Duration time.Duration
+	// Err is the error the deploy failed with, if any
+	Err error
+	// FailedDependencies are the failed dependencies the service was deployed despite
+	FailedDependencies []string
+	// Input is the input of the service deploy
+	Input DeployServiceInput
+	// Result is the result of the service deploy
+	Result DeployServiceResult
+	// StartedAt is when the deploy of the service started
+	StartedAt time.Time
+}
+
+// deployServiceGroup deploys the services of a group, returning their
+// deploys in the same order. A lone service is deployed as usual, while a
+// pair of interleaved services is deployed side by side with their rolling
+// update batches alternating.
+func deployServiceGroup(ctx context.Context, deploys []groupDeploy) []groupDeploy {
+	if len(deploys) == 1 {
+		deploys[0].Result, deploys[0].Err = deployServiceWithResult(ctx, deploys[0].Input)
+		deploys[0].Duration = time.Since(deploys[0].StartedAt)
+		return deploys
+	}
+
+	serviceNames := []string{}
+	for _, deploy := range deploys {
+		serviceNames = append(serviceNames, deploy.Input.ServiceName)
+	}
+	turns := newInterleavedTurns(serviceNames)
+
+	var wg sync.WaitGroup
+	for i := range deploys {
+		wg.Add(1)
+		go func(deploy *groupDeploy) {
+			defer wg.Done()
+			deploy.Input.BatchTurn = turns.batchTurn(deploy.Input.ServiceName)
+			deploy.Result, deploy.Err = deployServiceWithResult(ctx, deploy.Input)
+			deploy.Duration = time.Since(deploy.StartedAt)
+			turns.finish(deploy.Input.ServiceName, deploy.Err)
+		}(&deploys[i])
+	}
+	wg.Wait()
+	return deploys
+}
@@ -0,0 +1,147 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/josegonzalez/cli-skeleton/command"
+	"github.com/rs/zerolog"
+)
+
+func TestInterleavedRollingUpdates(t *testing.T) {
+	// the services log from their own goroutines
+	var buf bytes.Buffer
+	output := zerolog.SyncWriter(&buf)
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(output).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(output).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	// deploy runs the rolling updates of the web and worker services side by
+	// side, returning the services of the batches in the order they started
+	// and the error of each rolling update
+	deploy := func(failingBatch map[string]int) ([]string, map[string]error) {
+		var mu sync.Mutex
+		batches := []string{}
+		executor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+			if !slices.Contains(input.Args, "up") {
+				return ExecCommandResponse{ExitCode: 0}, nil
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			serviceName := input.Args[len(input.Args)-1]
+			batches = append(batches, serviceName)
+			if failingBatch[serviceName] == len(slices.DeleteFunc(slices.Clone(batches), func(name string) bool { return name != serviceName })) {
+				return ExecCommandResponse{ExitCode: 1}, errors.New("exit status 1")
+			}
+			return ExecCommandResponse{ExitCode: 0}, nil
+		}
+
+		mockClient := &mockDockerClient{
+			containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+				return []container.Summary{}, nil
+			},
+			containerTerminate: func(ctx context.Context, id string, stopTimeout time.Duration) error {
+				return nil
+			},
+		}
+
+		turns := newInterleavedTurns([]string{"web", "worker"})
+		errs := map[string]error{}
+		var wg sync.WaitGroup
+		for _, serviceName := range []string{"worker", "web"} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := rollingUpdateContainers(context.Background(), RollingUpdateInput{
+					BatchTurn: turns.batchTurn(serviceName),
+					Client:    mockClient,
+					ContainersToUpdate: []container.Summary{
+						{ID: serviceName + "1_container_id", Created: 50},
+						{ID: serviceName + "2_container_id", Created: 60},
+					},
+					Executor:        executor,
+					FailureAction:   "pause",
+					Logger:          logger,
+					Order:           "stop-first",
+					Parallelism:     1,
+					ProjectName:     "proj",
+					ServiceName:     serviceName,
+					SkipHealthcheck: true,
+					Sleeper:         func(time.Duration) {},
+				})
+				turns.finish(serviceName, err)
+
+				mu.Lock()
+				defer mu.Unlock()
+				errs[serviceName] = err
+			}()
+		}
+		wg.Wait()
+		return batches, errs
+	}
+
+	t.Run("batches alternate between the services", func(t *testing.T) {
+		batches, errs := deploy(nil)
+		for serviceName, err := range errs {
+			if err != nil {
+				t.Fatalf("unexpected error for %s: %v", serviceName, err)
+			}
+		}
+
+		expected := []string{"web", "worker", "web", "worker"}
+		if !slices.Equal(batches, expected) {
+			t.Errorf("expected the batches to alternate\nexpected: %v\ngot:      %v", expected, batches)
+		}
+	})
+
+	t.Run("a failed batch pauses the other service", func(t *testing.T) {
+		batches, errs := deploy(map[string]int{"web": 2})
+
+		expected := []string{"web", "worker", "web"}
+		if !slices.Equal(batches, expected) {
+			t.Errorf("expected worker to be paused after the failed web batch\nexpected: %v\ngot:      %v", expected, batches)
+		}
+		if errs["web"] == nil {
+			t.Error("expected web to fail")
+		}
+		if errs["worker"] == nil || !strings.Contains(errs["worker"].Error(), "pausing deployment, interleaved service web failed") {
+			t.Errorf("expected worker to be paused, got %v", errs["worker"])
+		}
+	})
+}
+
+func TestInterleaveOrder(t *testing.T) {
+	project := &types.Project{
+		Services: types.Services{
+			"api":    types.ServiceConfig{Name: "api", DependsOn: types.DependsOnConfig{"db": {}}},
+			"cache":  types.ServiceConfig{Name: "cache"},
+			"db":     types.ServiceConfig{Name: "db"},
+			"web":    types.ServiceConfig{Name: "web", DependsOn: types.DependsOnConfig{"cache": {}}},
+			"worker": types.ServiceConfig{Name: "worker", DependsOn: types.DependsOnConfig{"db": {}}},
+		},
+	}
+
+	ordered := interleaveOrder(project, []string{"db", "cache", "api", "web", "worker"}, []string{"worker", "cache"})
+	expected := []string{"db", "api", "worker", "cache", "web"}
+	if !slices.Equal(ordered, expected) {
+		t.Errorf("expected the interleaved services to be moved next to each other\nexpected: %v\ngot:      %v", expected, ordered)
+	}
+
+	err := validateInterleave(DeployProjectInput{Interleave: []string{"web", "cache"}, Project: project}, []string{"cache", "web"})
+	if err == nil || !strings.Contains(err.Error(), "as one depends on the other") {
+		t.Errorf("expected dependent services to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/go-units"
+)
+
+// sysctlNamePattern matches dotted sysctl names such as net.core.somaxconn
+var sysctlNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+(\.[a-zA-Z0-9_/-]+)+$`)
+
+// namespacedSysctls are the sysctls that are isolated per container by a
+// kernel namespace, and so may be set by docker
+var namespacedSysctls = []string{
+	"kernel.msgmax",
+	"kernel.msgmnb",
+	"kernel.msgmni",
+	"kernel.sem",
+	"kernel.shm_rmid_forced",
+	"kernel.shmall",
+	"kernel.shmmax",
+	"kernel.shmmni",
+}
+
+// validateServiceLimits checks the sysctls and ulimits declared by a service
+// are well-formed, as the daemon otherwise only rejects them once a
+// container fails to start
+func validateServiceLimits(service *types.ServiceConfig) error {
+	for _, name := range slices.Sorted(maps.Keys(service.Sysctls)) {
+		if err := validateSysctl(service, name, service.Sysctls[name]); err != nil {
+			return fmt.Errorf("invalid sysctls for service %s: %v", service.Name, err)
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(service.Ulimits)) {
+		if _, err := units.ParseUlimit(ulimitString(name, service.Ulimits[name])); err != nil {
+			return fmt.Errorf("invalid ulimits for service %s: %v", service.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// validateSysctl checks a single sysctl is well-formed and can be set per container
+func validateSysctl(service *types.ServiceConfig, name string, value string) error {
+	if !sysctlNamePattern.MatchString(name) {
+		return fmt.Errorf("malformed sysctl name %q", name)
+	}
+	if strings.TrimSpace(value) == "" {
+		return fmt.Errorf("sysctl %s has an empty value", name)
+	}
+
+	// a service joining the network namespace of another container or
+	// service shares its network sysctls rather than having its own
+	if strings.HasPrefix(name, "net.") {
+		switch {
+		case service.NetworkMode == "host":
+			return fmt.Errorf("sysctl %s cannot be set with the host network mode", name)
+		case strings.HasPrefix(service.NetworkMode, "container:"), strings.HasPrefix(service.NetworkMode, "service:"):
+			return fmt.Errorf("sysctl %s cannot be set with the %s network mode, as the network namespace is shared", name, service.NetworkMode)
+		}
+		return nil
+	}
+	if name == "kernel.domainname" {
+		if service.Uts == "host" {
+			return fmt.Errorf("sysctl %s cannot be set with the host uts mode", name)
+		}
+		return nil
+	}
+	if slices.Contains(namespacedSysctls, name) || strings.HasPrefix(name, "fs.mqueue.") {
+		return nil
+	}
+	return fmt.Errorf("sysctl %s is not namespaced, and so cannot be set per container", name)
+}
+
+// ulimitString formats a compose ulimit in the name=soft[:hard] form used by docker
+func ulimitString(name string, ulimit *types.UlimitsConfig) string {
+	if ulimit == nil {
+		return fmt.Sprintf("%s=", name)
+	}
+	if ulimit.Single != 0 {
+		return fmt.Sprintf("%s=%d", name, ulimit.Single)
+	}
+	return fmt.Sprintf("%s=%d:%d", name, ulimit.Soft, ulimit.Hard)
+}
+
+// serviceLimitsHint returns a hint for a start failure caused by a sysctl or
+// ulimit the host refused, or an empty string if the failure is unrelated
+func serviceLimitsHint(service *types.ServiceConfig, err error) string {
+	if err == nil || (len(service.Sysctls) == 0 && len(service.Ulimits) == 0) {
+		return ""
+	}
+
+	message := strings.ToLower(err.Error())
+	switch {
+	case len(service.Sysctls) > 0 && strings.Contains(message, "sysctl"):
+		return fmt.Sprintf("The host refused a sysctl declared by the service, check the host allows setting it: service=%s, sysctls=%s", service.Name, strings.Join(slices.Sorted(maps.Keys(service.Sysctls)), ","))
+	case len(service.Ulimits) > 0 && (strings.Contains(message, "ulimit") || strings.Contains(message, "rlimit")):
+		return fmt.Sprintf("The host refused a ulimit declared by the service, check it does not exceed the limits of the docker daemon: service=%s, ulimits=%s", service.Name, strings.Join(slices.Sorted(maps.Keys(service.Ulimits)), ","))
+	}
+	return ""
+}
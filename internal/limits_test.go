@@ -0,0 +1,202 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/compose-spec/compose-go/v2/types"
+)
+
+func TestValidateServiceLimits(t *testing.T) {
+	tests := []struct {
+		name          string
+		service       types.ServiceConfig
+		expectedError string
+	}{
+		{
+			name: "no limits",
+			service: types.ServiceConfig{
+				Name: "web",
+			},
+		},
+		{
+			name: "valid limits",
+			service: types.ServiceConfig{
+				Name: "web",
+				Sysctls: types.Mapping{
+					"net.core.somaxconn": "1024",
+					"kernel.shmmax":      "68719476736",
+					"fs.mqueue.msg_max":  "100",
+				},
+				Ulimits: map[string]*types.UlimitsConfig{
+					"nofile":  {Soft: 20000, Hard: 40000},
+					"nproc":   {Single: 65535},
+					"memlock": {Soft: -1, Hard: -1},
+				},
+			},
+		},
+		{
+			name: "unknown ulimit",
+			service: types.ServiceConfig{
+				Name: "web",
+				Ulimits: map[string]*types.UlimitsConfig{
+					"nofiles": {Single: 1024},
+				},
+			},
+			expectedError: "invalid ulimits for service web: invalid ulimit type: nofiles",
+		},
+		{
+			name: "ulimit soft limit above hard limit",
+			service: types.ServiceConfig{
+				Name: "web",
+				Ulimits: map[string]*types.UlimitsConfig{
+					"nofile": {Soft: 40000, Hard: 20000},
+				},
+			},
+			expectedError: "invalid ulimits for service web: ulimit soft limit must be less than or equal to hard limit: 40000 > 20000",
+		},
+		{
+			name: "ulimit unlimited soft limit with a hard limit",
+			service: types.ServiceConfig{
+				Name: "web",
+				Ulimits: map[string]*types.UlimitsConfig{
+					"memlock": {Soft: -1, Hard: 1024},
+				},
+			},
+			expectedError: "invalid ulimits for service web: ulimit soft limit must be less than or equal to hard limit: soft: -1 (unlimited), hard: 1024",
+		},
+		{
+			name: "malformed sysctl name",
+			service: types.ServiceConfig{
+				Name:    "web",
+				Sysctls: types.Mapping{"somaxconn": "1024"},
+			},
+			expectedError: `invalid sysctls for service web: malformed sysctl name "somaxconn"`,
+		},
+		{
+			name: "empty sysctl value",
+			service: types.ServiceConfig{
+				Name:    "web",
+				Sysctls: types.Mapping{"net.core.somaxconn": ""},
+			},
+			expectedError: "invalid sysctls for service web: sysctl net.core.somaxconn has an empty value",
+		},
+		{
+			name: "sysctl that is not namespaced",
+			service: types.ServiceConfig{
+				Name:    "web",
+				Sysctls: types.Mapping{"vm.swappiness": "10"},
+			},
+			expectedError: "invalid sysctls for service web: sysctl vm.swappiness is not namespaced, and so cannot be set per container",
+		},
+		{
+			name: "network sysctl with the host network",
+			service: types.ServiceConfig{
+				Name:        "web",
+				NetworkMode: "host",
+				Sysctls:     types.Mapping{"net.core.somaxconn": "1024"},
+			},
+			expectedError: "invalid sysctls for service web: sysctl net.core.somaxconn cannot be set with the host network mode",
+		},
+		{
+			name: "network sysctl with the network of another service",
+			service: types.ServiceConfig{
+				Name:        "web",
+				NetworkMode: "service:proxy",
+				Sysctls:     types.Mapping{"net.core.somaxconn": "1024"},
+			},
+			expectedError: "invalid sysctls for service web: sysctl net.core.somaxconn cannot be set with the service:proxy network mode, as the network namespace is shared",
+		},
+		{
+			name: "network sysctl with the network of another container",
+			service: types.ServiceConfig{
+				Name:        "web",
+				NetworkMode: "container:proxy-1",
+				Sysctls:     types.Mapping{"net.ipv4.ip_forward": "1"},
+			},
+			expectedError: "invalid sysctls for service web: sysctl net.ipv4.ip_forward cannot be set with the container:proxy-1 network mode, as the network namespace is shared",
+		},
+		{
+			name: "domain name sysctl",
+			service: types.ServiceConfig{
+				Name:    "web",
+				Sysctls: types.Mapping{"kernel.domainname": "example.com"},
+			},
+		},
+		{
+			name: "domain name sysctl with the host uts mode",
+			service: types.ServiceConfig{
+				Name:    "web",
+				Sysctls: types.Mapping{"kernel.domainname": "example.com"},
+				Uts:     "host",
+			},
+			expectedError: "invalid sysctls for service web: sysctl kernel.domainname cannot be set with the host uts mode",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateServiceLimits(&tt.service)
+			if tt.expectedError == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if err.Error() != tt.expectedError {
+				t.Errorf("expected error %q, got %q", tt.expectedError, err.Error())
+			}
+		})
+	}
+}
+
+func TestServiceLimitsHint(t *testing.T) {
+	service := &types.ServiceConfig{
+		Name:    "web",
+		Sysctls: types.Mapping{"net.core.somaxconn": "1024"},
+		Ulimits: map[string]*types.UlimitsConfig{"nofile": {Single: 1024}},
+	}
+
+	tests := []struct {
+		name     string
+		service  *types.ServiceConfig
+		err      error
+		expected string
+	}{
+		{
+			name:     "sysctl failure",
+			service:  service,
+			err:      errors.New(`failed to create task for container: write sysctl key net.core.somaxconn: open /proc/sys/net/core/somaxconn: no such file or directory`),
+			expected: "The host refused a sysctl declared by the service, check the host allows setting it: service=web, sysctls=net.core.somaxconn",
+		},
+		{
+			name:     "ulimit failure",
+			service:  service,
+			err:      errors.New("error setting rlimit type 7: operation not permitted"),
+			expected: "The host refused a ulimit declared by the service, check it does not exceed the limits of the docker daemon: service=web, ulimits=nofile",
+		},
+		{
+			name:     "unrelated failure",
+			service:  service,
+			err:      errors.New("image not found"),
+			expected: "",
+		},
+		{
+			name:     "no declared limits",
+			service:  &types.ServiceConfig{Name: "web"},
+			err:      errors.New("write sysctl key net.core.somaxconn"),
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serviceLimitsHint(tt.service, tt.err); got != tt.expected {
+				t.Errorf("expected hint %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DeployLockHolder describes the deploy holding the lock of a project, as
+// written to its lock file
+type DeployLockHolder struct {
+	// Args are the command line arguments of the deploy
+	Args []string `json:"args"`
+	// Hostname is the host the deploy runs on
+	Hostname string `json:"hostname"`
+	// PID is the process ID of the deploy
+	PID int `json:"pid"`
+	// Project is the name of the project being deployed
+	Project string `json:"project"`
+	// StartedAt is when the deploy acquired the lock
+	StartedAt time.Time `json:"started_at"`
+}
+
+// Stale is whether the holder is a deploy on this host whose process is no
+// longer running, such as one that was killed before releasing its lock
+func (h DeployLockHolder) Stale() bool {
+	hostname, err := os.Hostname()
+	if err != nil || hostname != h.Hostname {
+		return false
+	}
+	return !processRunning(h.PID)
+}
+
+// DeployLockedError is returned when a project is already being deployed
+type DeployLockedError struct {
+	// Holder is the deploy holding the lock
+	Holder DeployLockHolder
+	// Path is the path of the lock file
+	Path string
+}
+
+func (e *DeployLockedError) Error() string {
+	return fmt.Sprintf("project %s is already being deployed: pid=%d, host=%s, since=%s, command=%q, lock=%s", e.Holder.Project, e.Holder.PID, e.Holder.Hostname, e.Holder.StartedAt.Format(time.RFC3339), strings.Join(e.Holder.Args, " "), e.Path)
+}
+
+// DeployLock is a held per-project deploy lock
+type DeployLock struct {
+	path string
+}
+
+// LockFile returns the path of the deploy lock file of a project
+func LockFile(projectDir string, projectName string) string {
+	return filepath.Join(projectDir, ".docker-orchestrate-"+projectName+".lock")
+}
+
+// NewDeployLockHolder describes the current process as the holder of the
+// lock of a project
+func NewDeployLockHolder(projectName string, args []string) DeployLockHolder {
+	hostname, _ := os.Hostname()
+	return DeployLockHolder{
+		Args:      args,
+		Hostname:  hostname,
+		PID:       os.Getpid(),
+		Project:   projectName,
+		StartedAt: time.Now().UTC(),
+	}
+}
+
+// AcquireDeployLock creates the lock file at path, recording the holder. If
+// another deploy holds the lock, a DeployLockedError describing it is
+// returned. A stale lock left behind by a deploy that is no longer running
+// is replaced.
+func AcquireDeployLock(path string, holder DeployLockHolder) (*DeployLock, error) {
+	data, err := json.MarshalIndent(holder, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error encoding deploy lock: %v", err)
+	}
+
+	for attempt := 0; ; attempt++ {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			_, writeErr := f.Write(append(data, '\n'))
+			closeErr := f.Close()
+			if err := errors.Join(writeErr, closeErr); err != nil {
+				os.Remove(path)
+				return nil, fmt.Errorf("error writing deploy lock %s: %v", path, err)
+			}
+			return &DeployLock{path: path}, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("error creating deploy lock %s: %v", path, err)
+		}
+
+		current, found, err := ReadDeployLock(path)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			continue
+		}
+		if attempt > 0 || !current.Stale() {
+			return nil, &DeployLockedError{Holder: current, Path: path}
+		}
+		if err := removeStaleDeployLock(path, current); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// removeStaleDeployLock removes the lock file at path if it still records
+// the stale holder. Another deploy may replace a stale lock between it being
+// read and removed, so the lock is first moved aside, and a lock that turns
+// out to be another deploy's is put back rather than removed.
+func removeStaleDeployLock(path string, stale DeployLockHolder) error {
+	aside := fmt.Sprintf("%s.stale-%d", path, os.Getpid())
+	if err := os.Rename(path, aside); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			// another deploy removed it first
+			return nil
+		}
+		return fmt.Errorf("error removing stale deploy lock %s: %v", path, err)
+	}
+	defer os.Remove(aside)
+
+	moved, found, err := ReadDeployLock(aside)
+	if err != nil {
+		return err
+	}
+	if found && (moved.PID != stale.PID || moved.Hostname != stale.Hostname || !moved.StartedAt.Equal(stale.StartedAt)) {
+		// the link fails if yet another deploy took the lock in the meantime,
+		// which then holds it
+		if err := os.Link(aside, path); err != nil && !errors.Is(err, fs.ErrExist) {
+			return fmt.Errorf("error restoring deploy lock %s: %v", path, err)
+		}
+		return &DeployLockedError{Holder: moved, Path: path}
+	}
+	return nil
+}
+
+// ReadDeployLock returns the holder recorded in the lock file at path, and
+// whether the file exists
+func ReadDeployLock(path string) (DeployLockHolder, bool, error) {
+	var holder DeployLockHolder
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return holder, false, nil
+	}
+	if err != nil {
+		return holder, false, fmt.Errorf("error reading deploy lock %s: %v", path, err)
+	}
+
+	if err := json.Unmarshal(data, &holder); err != nil {
+		return holder, false, fmt.Errorf("error decoding deploy lock %s: %v", path, err)
+	}
+	return holder, true, nil
+}
+
+// Release removes the lock file. Releasing a nil lock does nothing.
+func (l *DeployLock) Release() error {
+	if l == nil {
+		return nil
+	}
+	if err := os.Remove(l.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("error removing deploy lock %s: %v", l.path, err)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeployLock(t *testing.T) {
+	t.Run("lock file records the holder", func(t *testing.T) {
+		path := LockFile(t.TempDir(), "app")
+		holder := NewDeployLockHolder("app", []string{"docker-orchestrate", "deploy", "web"})
+
+		lock, err := AcquireDeployLock(path, holder)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var contents map[string]interface{}
+		if err := json.Unmarshal(data, &contents); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, key := range []string{"args", "hostname", "pid", "project", "started_at"} {
+			if _, ok := contents[key]; !ok {
+				t.Errorf("expected the lock file to contain %s, got %s", key, data)
+			}
+		}
+
+		read, found, err := ReadDeployLock(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !found {
+			t.Fatal("expected the lock file to be found")
+		}
+		if read.PID != os.Getpid() || read.Project != "app" || !slices.Equal(read.Args, holder.Args) || !read.StartedAt.Equal(holder.StartedAt) {
+			t.Errorf("expected holder %+v, got %+v", holder, read)
+		}
+		hostname, _ := os.Hostname()
+		if read.Hostname != hostname {
+			t.Errorf("expected hostname %s, got %s", hostname, read.Hostname)
+		}
+
+		if err := lock.Release(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, found, _ := ReadDeployLock(path); found {
+			t.Error("expected the lock file to be removed on release")
+		}
+	})
+
+	t.Run("second deploy reports the holder", func(t *testing.T) {
+		path := LockFile(t.TempDir(), "app")
+		holder := NewDeployLockHolder("app", []string{"docker-orchestrate", "deploy"})
+		holder.StartedAt = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+		lock, err := AcquireDeployLock(path, holder)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer lock.Release()
+
+		_, err = AcquireDeployLock(path, NewDeployLockHolder("app", []string{"docker-orchestrate", "deploy", "web"}))
+		var locked *DeployLockedError
+		if !errors.As(err, &locked) {
+			t.Fatalf("expected a DeployLockedError, got %v", err)
+		}
+		if locked.Holder.PID != os.Getpid() || !locked.Holder.StartedAt.Equal(holder.StartedAt) {
+			t.Errorf("expected the first deploy to be reported as the holder, got %+v", locked.Holder)
+		}
+		for _, expected := range []string{fmt.Sprintf("pid=%d", os.Getpid()), "since=2024-01-02T03:04:05Z", `command="docker-orchestrate deploy"`} {
+			if !strings.Contains(err.Error(), expected) {
+				t.Errorf("expected error to contain %q, got %q", expected, err.Error())
+			}
+		}
+	})
+
+	t.Run("stale lock is replaced", func(t *testing.T) {
+		path := LockFile(t.TempDir(), "app")
+		stale := NewDeployLockHolder("app", []string{"docker-orchestrate", "deploy"})
+		stale.PID = -1
+		data, _ := json.Marshal(stale)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		lock, err := AcquireDeployLock(path, NewDeployLockHolder("app", []string{"docker-orchestrate", "deploy"}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer lock.Release()
+
+		read, _, err := ReadDeployLock(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if read.PID != os.Getpid() {
+			t.Errorf("expected the stale lock to be replaced, got pid %d", read.PID)
+		}
+	})
+	t.Run("lock taken over in the meantime is kept", func(t *testing.T) {
+		path := LockFile(t.TempDir(), "app")
+		stale := NewDeployLockHolder("app", []string{"docker-orchestrate", "deploy"})
+		stale.PID = -1
+
+		// another deploy replaced the stale lock after it was read
+		taken := NewDeployLockHolder("app", []string{"docker-orchestrate", "deploy", "worker"})
+		data, _ := json.Marshal(taken)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		err := removeStaleDeployLock(path, stale)
+		var locked *DeployLockedError
+		if !errors.As(err, &locked) {
+			t.Fatalf("expected a DeployLockedError, got %v", err)
+		}
+		read, found, err := ReadDeployLock(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !found || !slices.Equal(read.Args, taken.Args) {
+			t.Errorf("expected the other deploy's lock to be kept, got %+v", read)
+		}
+		if _, err := os.Stat(fmt.Sprintf("%s.stale-%d", path, os.Getpid())); !os.IsNotExist(err) {
+			t.Errorf("expected the lock moved aside to be cleaned up, got %v", err)
+		}
+	})
+}
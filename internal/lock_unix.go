@@ -0,0 +1,17 @@
+//go:build !windows
+
+package internal
+
+import (
+	"errors"
+	"syscall"
+)
+
+// processRunning returns whether a process with the given ID is running
+func processRunning(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,54 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/josegonzalez/cli-skeleton/command"
+)
+
+// CheckLoggingDriverInput is the input for the checkLoggingDriver function
+type CheckLoggingDriverInput struct {
+	// Client is the Docker client to use
+	Client DockerClientInterface
+	// Logger is the logger to use
+	Logger *command.ZerologUi
+	// Service is the service whose logging config is checked
+	Service *types.ServiceConfig
+	// Warnings collects the warnings raised by the check, if set
+	Warnings *DeployWarnings
+}
+
+// checkLoggingDriver logs the effective logging config of a service and warns
+// when the driver it declares is not registered with the daemon. Compose
+// passes the logging config through at create time, so an unavailable driver
+// otherwise only surfaces once the new containers fail to start.
+func checkLoggingDriver(ctx context.Context, input CheckLoggingDriverInput) {
+	if input.Service.Logging == nil || input.Service.Logging.Driver == "" {
+		return
+	}
+
+	driver := input.Service.Logging.Driver
+	input.Logger.StdoutLogger.Debug().
+		Str("service", input.Service.Name).
+		Str("driver", driver).
+		Interface("options", input.Service.Logging.Options).
+		Msg("Resolved logging config")
+
+	info, err := input.Client.Info(ctx)
+	if err != nil {
+		input.Warnings.Warn(input.Logger, input.Service.Name, fmt.Sprintf("Unable to verify logging driver: service=%s, driver=%s, error=%v", input.Service.Name, driver, err))
+		return
+	}
+
+	// a daemon that reports no log plugins cannot be checked against
+	available := info.Plugins.Log
+	if len(available) == 0 || slices.Contains(available, driver) {
+		return
+	}
+
+	input.Warnings.Warn(input.Logger, input.Service.Name, fmt.Sprintf("Logging driver not available on host: service=%s, driver=%s, available=%s", input.Service.Name, driver, strings.Join(available, ",")))
+}
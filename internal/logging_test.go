@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/docker/api/types/system"
+	"github.com/josegonzalez/cli-skeleton/command"
+	"github.com/rs/zerolog"
+)
+
+func TestCheckLoggingDriver(t *testing.T) {
+	mockClient := &mockDockerClient{
+		info: func(ctx context.Context) (system.Info, error) {
+			return system.Info{Plugins: system.PluginsInfo{Log: []string{"json-file", "local", "syslog"}}}, nil
+		},
+	}
+
+	tests := []struct {
+		name     string
+		client   DockerClientInterface
+		logging  *types.LoggingConfig
+		wantWarn string
+	}{
+		{name: "no logging config", client: mockClient},
+		{name: "available driver", client: mockClient, logging: &types.LoggingConfig{Driver: "json-file", Options: types.Options{"max-size": "10m"}}},
+		{name: "unavailable driver", client: mockClient, logging: &types.LoggingConfig{Driver: "gelf"}, wantWarn: "Logging driver not available on host: service=web, driver=gelf, available=json-file,local,syslog"},
+		{name: "no plugins reported", client: &mockDockerClient{}, logging: &types.LoggingConfig{Driver: "gelf"}},
+		{
+			name: "info error",
+			client: &mockDockerClient{info: func(ctx context.Context) (system.Info, error) {
+				return system.Info{}, fmt.Errorf("daemon unavailable")
+			}},
+			logging:  &types.LoggingConfig{Driver: "gelf"},
+			wantWarn: "Unable to verify logging driver: service=web, driver=gelf, error=daemon unavailable",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := &command.ZerologUi{
+				StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+				StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+				OriginalFields:    nil,
+				Ui:                nil,
+				OutputIndentField: false,
+			}
+
+			checkLoggingDriver(context.Background(), CheckLoggingDriverInput{
+				Client:  tt.client,
+				Logger:  logger,
+				Service: &types.ServiceConfig{Name: "web", Logging: tt.logging},
+			})
+
+			if tt.wantWarn == "" {
+				if strings.Contains(buf.String(), `"level":"warn"`) {
+					t.Errorf("expected no warning, got %s", buf.String())
+				}
+				return
+			}
+			if !strings.Contains(buf.String(), tt.wantWarn) {
+				t.Errorf("expected warning %q, got %s", tt.wantWarn, buf.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/josegonzalez/cli-skeleton/command"
+)
+
+// dumpContainerLogs prints the trailing log lines of a container that failed
+// its healthcheck, so the cause is visible once the container is removed.
+// A failure to read the logs is logged rather than returned.
+func dumpContainerLogs(ctx context.Context, logger *command.ZerologUi, client DockerClientInterface, containerID string, lines int) {
+	if lines <= 0 {
+		return
+	}
+
+	shortID := containerID
+	if len(shortID) > 12 {
+		shortID = shortID[:12]
+	}
+
+	output, err := client.ContainerLogs(ctx, containerID, container.LogsOptions{
+		ShowStderr: true,
+		ShowStdout: true,
+		Tail:       strconv.Itoa(lines),
+	})
+	if err != nil {
+		logger.Warn(fmt.Sprintf("Unable to read container logs: container=%s, error=%v", shortID, err))
+		return
+	}
+
+	output = strings.TrimRight(output, "\n")
+	if output == "" {
+		return
+	}
+
+	// the daemon honors the tail, but the bound is kept even if it does not
+	logLines := strings.Split(output, "\n")
+	if len(logLines) > lines {
+		logLines = logLines[len(logLines)-lines:]
+	}
+
+	logger.Info(fmt.Sprintf("Last %d log lines of container %s:", len(logLines), shortID))
+	for _, line := range logLines {
+		logger.Info(fmt.Sprintf("    %s", line))
+	}
+}
+
+// ContainerLog is the log output of a container
+type ContainerLog struct {
+	// Logs is the log output of the container, with standard output and standard error interleaved
+	Logs string
+	// Name is the name of the container
+	Name string
+	// Service is the service the container belongs to
+	Service string
+}
+
+// ServiceLogsInput is the input for the ServiceLogs function
+type ServiceLogsInput struct {
+	// Client is the Docker client to use
+	Client DockerClientInterface
+	// DeployID only reads the logs of the containers stamped with this deploy ID, when set
+	DeployID string
+	// ProjectLabel overrides the com.docker.compose.project label value used to discover containers. Defaults to ProjectName.
+	ProjectLabel string
+	// ProjectName is the name of the project
+	ProjectName string
+	// ServiceName is the name of the service to read logs for. Defaults to every service of the project.
+	ServiceName string
+	// Tail is the number of trailing log lines read from each container. If 0, every line is read.
+	Tail int
+}
+
+// ServiceLogs returns the logs of the containers of a project or service,
+// running or not, oldest container first
+func ServiceLogs(ctx context.Context, input ServiceLogsInput) ([]ContainerLog, error) {
+	if input.Tail < 0 {
+		return nil, fmt.Errorf("invalid tail value %d: must not be negative", input.Tail)
+	}
+
+	containers, err := ListContainers(ctx, ListContainersInput{
+		Client:       input.Client,
+		DeployID:     input.DeployID,
+		Now:          time.Now(),
+		ProjectLabel: input.ProjectLabel,
+		ProjectName:  input.ProjectName,
+		ServiceName:  input.ServiceName,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tail := "all"
+	if input.Tail > 0 {
+		tail = strconv.Itoa(input.Tail)
+	}
+
+	logs := []ContainerLog{}
+	for _, c := range containers {
+		name := c.ID
+		if len(c.Names) > 0 {
+			name = strings.TrimPrefix(c.Names[0], "/")
+		}
+
+		output, err := input.Client.ContainerLogs(ctx, c.ID, container.LogsOptions{
+			ShowStderr: true,
+			ShowStdout: true,
+			Tail:       tail,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error reading logs of container %s: %v", name, err)
+		}
+
+		logs = append(logs, ContainerLog{
+			Logs:    output,
+			Name:    name,
+			Service: c.Labels["com.docker.compose.service"],
+		})
+	}
+	return logs, nil
+}
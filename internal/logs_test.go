@@ -0,0 +1,147 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/josegonzalez/cli-skeleton/command"
+	"github.com/rs/zerolog"
+)
+
+func TestDumpContainerLogs(t *testing.T) {
+	newLogger := func(buf *bytes.Buffer) *command.ZerologUi {
+		return &command.ZerologUi{
+			StderrLogger:      zerolog.New(buf).With().Timestamp().Logger(),
+			StdoutLogger:      zerolog.New(buf).With().Timestamp().Logger(),
+			OriginalFields:    nil,
+			Ui:                nil,
+			OutputIndentField: false,
+		}
+	}
+
+	t.Run("only the last lines are requested and shown", func(t *testing.T) {
+		var buf bytes.Buffer
+		requestedTail := ""
+		mockClient := &mockDockerClient{
+			containerLogs: func(ctx context.Context, id string, options container.LogsOptions) (string, error) {
+				requestedTail = options.Tail
+				if !options.ShowStdout || !options.ShowStderr {
+					t.Errorf("expected both stdout and stderr to be requested, got %+v", options)
+				}
+				// more lines than requested, as a daemon ignoring the tail would return
+				return "line 1\nline 2\nline 3\nline 4\nline 5\n", nil
+			},
+		}
+
+		dumpContainerLogs(context.Background(), newLogger(&buf), mockClient, "failed_container_id", 3)
+
+		if requestedTail != "3" {
+			t.Errorf("expected a tail of 3 to be requested, got %q", requestedTail)
+		}
+		output := buf.String()
+		if !strings.Contains(output, "Last 3 log lines of container failed_conta") {
+			t.Errorf("expected a log header, got %s", output)
+		}
+		for _, line := range []string{"line 3", "line 4", "line 5"} {
+			if !strings.Contains(output, line) {
+				t.Errorf("expected %q to be shown, got %s", line, output)
+			}
+		}
+		for _, line := range []string{"line 1", "line 2"} {
+			if strings.Contains(output, line) {
+				t.Errorf("expected %q not to be shown, got %s", line, output)
+			}
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		var buf bytes.Buffer
+		mockClient := &mockDockerClient{
+			containerLogs: func(ctx context.Context, id string, options container.LogsOptions) (string, error) {
+				t.Error("expected logs not to be requested")
+				return "", nil
+			},
+		}
+
+		dumpContainerLogs(context.Background(), newLogger(&buf), mockClient, "failed_container_id", 0)
+		if buf.Len() != 0 {
+			t.Errorf("expected no output, got %s", buf.String())
+		}
+	})
+
+	t.Run("error reading logs", func(t *testing.T) {
+		var buf bytes.Buffer
+		mockClient := &mockDockerClient{
+			containerLogs: func(ctx context.Context, id string, options container.LogsOptions) (string, error) {
+				return "", errors.New("no such container")
+			},
+		}
+
+		dumpContainerLogs(context.Background(), newLogger(&buf), mockClient, "failed_container_id", 50)
+		if !strings.Contains(buf.String(), "Unable to read container logs: container=failed_conta, error=no such container") {
+			t.Errorf("expected a warning, got %s", buf.String())
+		}
+	})
+}
+
+func TestServiceLogs(t *testing.T) {
+	deployLabel := DeployIDLabel + "=deploy-2"
+	mockClient := &mockDockerClient{
+		containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+			containers := []container.Summary{
+				{ID: "web2_container_id", Created: 200, Labels: map[string]string{"com.docker.compose.service": "web", DeployIDLabel: "deploy-2"}, Names: []string{"/test-web-2"}},
+				{ID: "web1_container_id", Created: 100, Labels: map[string]string{"com.docker.compose.service": "web", DeployIDLabel: "deploy-1"}, Names: []string{"/test-web-1"}},
+			}
+			if slices.Contains(options.Filters.Get("label"), deployLabel) {
+				return containers[:1], nil
+			}
+			return containers, nil
+		},
+		containerLogs: func(ctx context.Context, id string, options container.LogsOptions) (string, error) {
+			return fmt.Sprintf("%s tail=%s\n", id, options.Tail), nil
+		},
+	}
+
+	t.Run("every container oldest first", func(t *testing.T) {
+		logs, err := ServiceLogs(context.Background(), ServiceLogsInput{
+			Client:      mockClient,
+			ProjectName: "test",
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected := []ContainerLog{
+			{Logs: "web1_container_id tail=all\n", Name: "test-web-1", Service: "web"},
+			{Logs: "web2_container_id tail=all\n", Name: "test-web-2", Service: "web"},
+		}
+		if !slices.Equal(logs, expected) {
+			t.Errorf("expected %+v, got %+v", expected, logs)
+		}
+	})
+
+	t.Run("deploy id", func(t *testing.T) {
+		logs, err := ServiceLogs(context.Background(), ServiceLogsInput{
+			Client:      mockClient,
+			DeployID:    "deploy-2",
+			ProjectName: "test",
+			Tail:        10,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected := []ContainerLog{
+			{Logs: "web2_container_id tail=10\n", Name: "test-web-2", Service: "web"},
+		}
+		if !slices.Equal(logs, expected) {
+			t.Errorf("expected only the containers of the deploy, got %+v", logs)
+		}
+	})
+}
@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/josegonzalez/cli-skeleton/command"
+)
+
+// MaintenanceServiceInput is the input for the startMaintenanceService and stopMaintenanceService functions
+type MaintenanceServiceInput struct {
+	// ComposeFile is the path to the compose file
+	ComposeFile string
+	// Executor is the command executor to use
+	Executor CommandExecutor
+	// Logger is the logger to use
+	Logger *command.ZerologUi
+	// MaintenanceService is the name of the service covering for the service being deployed
+	MaintenanceService string
+	// OverlayFiles are additional compose files layered over the compose file
+	OverlayFiles []string
+	// ProjectDir is the project directory
+	ProjectDir string
+	// ProjectName is the name of the project
+	ProjectName string
+	// QuietPull is whether to suppress the per-layer progress of image pulls
+	QuietPull bool
+	// ServiceName is the name of the service being deployed
+	ServiceName string
+}
+
+// maintenanceServiceName returns the service named by the
+// x-maintenance-service extension, validating that it can cover for the
+// service during a stop-first update
+func maintenanceServiceName(input DeployServiceInput, params DeployParams) (string, error) {
+	value, ok := params.Extensions["x-maintenance-service"]
+	if !ok {
+		return "", nil
+	}
+
+	maintenanceService, _ := value.(string)
+	if maintenanceService == "" {
+		return "", fmt.Errorf("invalid x-maintenance-service value %v: expected a service name", value)
+	}
+	if maintenanceService == input.ServiceName {
+		return "", fmt.Errorf("invalid x-maintenance-service value %s: a service cannot be its own maintenance service", maintenanceService)
+	}
+	if input.Project != nil {
+		// a maintenance service is usually kept behind a profile so project
+		// deploys leave it alone, and compose still starts it when named
+		if _, ok := input.Project.AllServices()[maintenanceService]; !ok {
+			return "", fmt.Errorf("invalid x-maintenance-service value %s: service not found in compose file", maintenanceService)
+		}
+	}
+	if params.Order != "stop-first" {
+		return "", fmt.Errorf("x-maintenance-service requires the stop-first update order: service=%s, order=%s", input.ServiceName, params.Order)
+	}
+
+	return maintenanceService, nil
+}
+
+// startMaintenanceService starts a single container of the maintenance
+// service, so it can answer in place of the service while its containers
+// are replaced
+func startMaintenanceService(ctx context.Context, input MaintenanceServiceInput) error {
+	input.Logger.Info(fmt.Sprintf("Starting maintenance service: service=%s, maintenance-service=%s", input.ServiceName, input.MaintenanceService))
+	return scaleMaintenanceService(ctx, input, 1)
+}
+
+// stopMaintenanceService removes the containers of the maintenance service
+// once the service's replacements are healthy
+func stopMaintenanceService(ctx context.Context, input MaintenanceServiceInput) error {
+	input.Logger.Info(fmt.Sprintf("Stopping maintenance service: service=%s, maintenance-service=%s", input.ServiceName, input.MaintenanceService))
+	return scaleMaintenanceService(ctx, input, 0)
+}
+
+// scaleMaintenanceService scales the maintenance service to the given
+// number of containers without touching its dependencies
+func scaleMaintenanceService(ctx context.Context, input MaintenanceServiceInput, replicas int) error {
+	err := runComposeCommand(ctx, input.Executor, ExecCommandInput{
+		Command: "docker",
+		Args: composeCommandArgs(ComposeCommandArgsInput{
+			ComposeFile:  input.ComposeFile,
+			OverlayFiles: input.OverlayFiles,
+			ProjectName:  input.ProjectName,
+			QuietPull:    input.QuietPull,
+		},
+			"up",
+			"--detach",
+			"--scale", fmt.Sprintf("%s=%d", input.MaintenanceService, replicas),
+			"--no-deps",
+			input.MaintenanceService,
+		),
+		WorkingDirectory: input.ProjectDir,
+	})
+	if err != nil {
+		return fmt.Errorf("error scaling maintenance service %s to %d: %v", input.MaintenanceService, replicas, err)
+	}
+
+	return nil
+}
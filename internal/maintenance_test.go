@@ -0,0 +1,216 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/josegonzalez/cli-skeleton/command"
+	"github.com/rs/zerolog"
+)
+
+func TestDeployServiceMaintenanceService(t *testing.T) {
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	newProject := func(replicas int) *types.Project {
+		parallelism := uint64(1)
+		return &types.Project{
+			Services: types.Services{
+				"web": types.ServiceConfig{
+					Name: "web",
+					Deploy: &types.DeployConfig{
+						Replicas: &replicas,
+						UpdateConfig: &types.UpdateConfig{
+							Monitor:     types.Duration(time.Millisecond),
+							Order:       "stop-first",
+							Parallelism: &parallelism,
+							Extensions:  types.Extensions{"x-maintenance-service": "maintenance"},
+						},
+					},
+				},
+			},
+			DisabledServices: types.Services{
+				"maintenance": types.ServiceConfig{Name: "maintenance", Profiles: []string{"maintenance"}},
+			},
+		}
+	}
+
+	// deploy runs a deploy of the web service over the given running
+	// containers, returning the order in which the maintenance service was
+	// scaled, the old containers stopped and the replacements checked
+	deploy := func(project *types.Project, containers []container.Summary) ([]string, error) {
+		events := []string{}
+		mockClient := &mockDockerClient{
+			containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+				return slices.Clone(containers), nil
+			},
+			containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+				// later inspections report on the deployed containers
+				if strings.HasPrefix(id, "new") && !slices.Contains(events, "healthcheck "+id) {
+					events = append(events, "healthcheck "+id)
+				}
+				return container.InspectResponse{
+					ContainerJSONBase: &container.ContainerJSONBase{
+						State: &container.State{Running: true},
+					},
+				}, nil
+			},
+			containerTerminate: func(ctx context.Context, id string, stopTimeout time.Duration) error {
+				events = append(events, "stop "+id)
+				containers = slices.DeleteFunc(containers, func(c container.Summary) bool {
+					return c.ID == id
+				})
+				return nil
+			},
+		}
+
+		replacements := 0
+		mockExecutor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+			index := slices.Index(input.Args, "--scale")
+			if index == -1 {
+				return ExecCommandResponse{ExitCode: 0}, nil
+			}
+			scale := input.Args[index+1]
+			events = append(events, "scale "+scale)
+			if strings.HasPrefix(scale, "web=") {
+				replacements++
+				containers = append(containers, container.Summary{ID: fmt.Sprintf("new%d_container_id", replacements), Created: int64(100 + replacements), State: container.StateRunning})
+			}
+			return ExecCommandResponse{ExitCode: 0}, nil
+		}
+
+		err := DeployService(context.Background(), DeployServiceInput{
+			Client:            mockClient,
+			ComposeFile:       "/tmp/docker-compose.yaml",
+			Executor:          mockExecutor,
+			HealthStartPeriod: time.Second,
+			Logger:            logger,
+			Project:           project,
+			ProjectName:       "test",
+			ServiceName:       "web",
+			SkipRename:        true,
+		})
+		return events, err
+	}
+
+	t.Run("covers the gap of a single replica", func(t *testing.T) {
+		events, err := deploy(newProject(1), []container.Summary{
+			{ID: "old1_container_id", Created: 50, State: container.StateRunning},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected := []string{
+			"scale maintenance=1",
+			"stop old1_container_id",
+			"scale web=1",
+			"healthcheck new1_container_id",
+			"scale maintenance=0",
+		}
+		if !slices.Equal(events, expected) {
+			t.Errorf("expected the maintenance service to be started before the stop and stopped after the replacement is healthy\nexpected: %v\ngot:      %v", expected, events)
+		}
+	})
+
+	t.Run("skipped when containers keep running", func(t *testing.T) {
+		events, err := deploy(newProject(2), []container.Summary{
+			{ID: "old1_container_id", Created: 50, State: container.StateRunning},
+			{ID: "old2_container_id", Created: 60, State: container.StateRunning},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		for _, event := range events {
+			if strings.HasPrefix(event, "scale maintenance=") {
+				t.Errorf("expected the maintenance service to be left alone, got %v", events)
+			}
+		}
+		if !strings.Contains(buf.String(), "Skipping maintenance service, containers keep running during the update: service=web, maintenance-service=maintenance") {
+			t.Errorf("expected the skipped maintenance service to be logged, got %s", buf.String())
+		}
+	})
+}
+
+func TestMaintenanceServiceName(t *testing.T) {
+	project := &types.Project{
+		Services: types.Services{
+			"web": types.ServiceConfig{Name: "web"},
+		},
+		DisabledServices: types.Services{
+			"maintenance": types.ServiceConfig{Name: "maintenance"},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		extensions    map[string]interface{}
+		order         string
+		expected      string
+		expectedError string
+	}{
+		{
+			name:  "unset",
+			order: "stop-first",
+		},
+		{
+			name:       "service behind a profile",
+			extensions: map[string]interface{}{"x-maintenance-service": "maintenance"},
+			order:      "stop-first",
+			expected:   "maintenance",
+		},
+		{
+			name:          "unknown service",
+			extensions:    map[string]interface{}{"x-maintenance-service": "missing"},
+			order:         "stop-first",
+			expectedError: "invalid x-maintenance-service value missing: service not found in compose file",
+		},
+		{
+			name:          "own service",
+			extensions:    map[string]interface{}{"x-maintenance-service": "web"},
+			order:         "stop-first",
+			expectedError: "invalid x-maintenance-service value web: a service cannot be its own maintenance service",
+		},
+		{
+			name:          "start-first",
+			extensions:    map[string]interface{}{"x-maintenance-service": "maintenance"},
+			order:         "start-first",
+			expectedError: "x-maintenance-service requires the stop-first update order: service=web, order=start-first",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			maintenanceService, err := maintenanceServiceName(
+				DeployServiceInput{Project: project, ServiceName: "web"},
+				DeployParams{Extensions: tt.extensions, Order: tt.order},
+			)
+			if tt.expectedError != "" {
+				if err == nil || err.Error() != tt.expectedError {
+					t.Errorf("expected error %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if maintenanceService != tt.expected {
+				t.Errorf("expected maintenance service %q, got %q", tt.expected, maintenanceService)
+			}
+		})
+	}
+}
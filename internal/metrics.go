@@ -0,0 +1,143 @@
+package internal
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// DeployMetrics are the Prometheus metrics of a deploy, updated as each
+// service is deployed. A nil DeployMetrics records nothing, so callers do
+// not need to check whether metrics are configured.
+type DeployMetrics struct {
+	// containersCurrent is the number of running containers of each service
+	containersCurrent *prometheus.GaugeVec
+	// containersDesired is the replica count each service is deployed to
+	containersDesired *prometheus.GaugeVec
+	// containersFailed is the number of new containers of each service that failed to become healthy
+	containersFailed *prometheus.GaugeVec
+	// containersHealthy is the number of new containers of each service that became healthy
+	containersHealthy *prometheus.GaugeVec
+	// deployDuration is how long each service deploy took
+	deployDuration *prometheus.HistogramVec
+	// registry is the registry the metrics are gathered from
+	registry *prometheus.Registry
+}
+
+// NewDeployMetrics returns the metrics of a deploy, registered with a
+// registry of their own
+func NewDeployMetrics() *DeployMetrics {
+	m := &DeployMetrics{
+		containersCurrent: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "orchestrate_containers_current",
+			Help: "The number of running containers of the service.",
+		}, []string{"service"}),
+		containersDesired: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "orchestrate_containers_desired",
+			Help: "The replica count the service is being deployed to.",
+		}, []string{"service"}),
+		containersFailed: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "orchestrate_containers_failed",
+			Help: "The number of new containers of the service that failed to become healthy during the deploy.",
+		}, []string{"service"}),
+		containersHealthy: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "orchestrate_containers_healthy",
+			Help: "The number of new containers of the service that became healthy during the deploy.",
+		}, []string{"service"}),
+		deployDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "orchestrate_deploy_duration_seconds",
+			Help:    "How long the deploy of the service took.",
+			Buckets: []float64{5, 15, 30, 60, 120, 300, 600, 1200, 1800, 3600},
+		}, []string{"service", "outcome"}),
+		registry: prometheus.NewRegistry(),
+	}
+	m.registry.MustRegister(m.containersCurrent, m.containersDesired, m.containersFailed, m.containersHealthy, m.deployDuration)
+	return m
+}
+
+// Handler returns the handler serving the metrics in the Prometheus
+// exposition format
+func (m *DeployMetrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// serviceStarted resets the container counts of a service about to be
+// deployed
+func (m *DeployMetrics) serviceStarted(serviceName string, desired int, current int) {
+	if m == nil {
+		return
+	}
+	m.containersCurrent.WithLabelValues(serviceName).Set(float64(current))
+	m.containersDesired.WithLabelValues(serviceName).Set(float64(desired))
+	m.containersFailed.WithLabelValues(serviceName).Set(0)
+	m.containersHealthy.WithLabelValues(serviceName).Set(0)
+}
+
+// serviceCompleted records the outcome of a service deploy
+func (m *DeployMetrics) serviceCompleted(serviceName string, result DeployServiceResult, err error) {
+	if m == nil {
+		return
+	}
+	if err == nil && !result.Skipped {
+		m.containersCurrent.WithLabelValues(serviceName).Set(float64(result.Replicas))
+	}
+	m.deployDuration.WithLabelValues(serviceName, serviceOutcome(result, err)).Observe(result.Duration.Seconds())
+}
+
+// containersStarted records new containers of a service starting, so the
+// current count follows the containers as the deploy replaces them
+func (m *DeployMetrics) containersStarted(serviceName string, count int) {
+	if m == nil {
+		return
+	}
+	m.containersCurrent.WithLabelValues(serviceName).Add(float64(count))
+}
+
+// containerStopped records a container of a service being stopped
+func (m *DeployMetrics) containerStopped(serviceName string) {
+	if m == nil {
+		return
+	}
+	m.containersCurrent.WithLabelValues(serviceName).Dec()
+}
+
+// containerHealthy records a new container of a service becoming healthy
+func (m *DeployMetrics) containerHealthy(serviceName string) {
+	if m == nil {
+		return
+	}
+	m.containersHealthy.WithLabelValues(serviceName).Inc()
+}
+
+// containerFailed records a new container of a service failing to start or
+// become healthy
+func (m *DeployMetrics) containerFailed(serviceName string) {
+	if m == nil {
+		return
+	}
+	m.containersFailed.WithLabelValues(serviceName).Inc()
+}
+
+// ServeMetrics serves the metrics on the given address at /metrics until the
+// returned server is shut down
+func ServeMetrics(addr string, metrics *DeployMetrics) (*http.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("error listening on metrics address %s: %v", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	return server, nil
+}
@@ -0,0 +1,162 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/josegonzalez/cli-skeleton/command"
+	"github.com/rs/zerolog"
+)
+
+// gatherMetric returns the value of a gauge, or the sample count of a
+// histogram, recorded for the service
+func gatherMetric(t *testing.T, metrics *DeployMetrics, name string, serviceName string) float64 {
+	t.Helper()
+
+	families, err := metrics.registry.Gather()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() != "service" || label.GetValue() != serviceName {
+					continue
+				}
+				if metric.GetHistogram() != nil {
+					return float64(metric.GetHistogram().GetSampleCount())
+				}
+				return metric.GetGauge().GetValue()
+			}
+		}
+	}
+	return -1
+}
+
+func TestDeployMetrics(t *testing.T) {
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger: zerolog.New(&buf),
+		StdoutLogger: zerolog.New(&buf),
+	}
+
+	metrics := NewDeployMetrics()
+	metrics.serviceStarted("web", 3, 0)
+
+	// the counts are read as the last container starts, while the deploy
+	// is still in progress
+	inProgress := map[string]float64{}
+	mock := &mockDockerClient{
+		containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+			return []container.Summary{
+				{ID: "new1_container_id", Names: []string{"/new1"}},
+				{ID: "new2_container_id", Names: []string{"/new2"}},
+				{ID: "new3_container_id", Names: []string{"/new3"}},
+			}, nil
+		},
+		containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+			return container.InspectResponse{
+				ContainerJSONBase: &container.ContainerJSONBase{
+					State: &container.State{Running: true},
+				},
+			}, nil
+		},
+		containerStart: func(ctx context.Context, id string, options container.StartOptions) error {
+			if id == "new3_container_id" {
+				for _, name := range []string{"orchestrate_containers_current", "orchestrate_containers_desired", "orchestrate_containers_healthy", "orchestrate_containers_failed"} {
+					inProgress[name] = gatherMetric(t, metrics, name, "web")
+				}
+			}
+			return nil
+		},
+	}
+	executor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+		return ExecCommandResponse{ExitCode: 0}, nil
+	}
+
+	err := scaleUpContainers(context.Background(), ScaleUpContainersInput{
+		Client:             mock,
+		DesiredReplicas:    3,
+		ExistingContainers: []container.Summary{},
+		Executor:           executor,
+		Logger:             logger,
+		Metrics:            metrics,
+		Parallelism:        1,
+		ProjectName:        "proj",
+		ServiceName:        "web",
+		TickerCh:           testTickerCh(),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[string]float64{
+		"orchestrate_containers_current": 2,
+		"orchestrate_containers_desired": 3,
+		"orchestrate_containers_healthy": 2,
+		"orchestrate_containers_failed":  0,
+	}
+	for name, value := range expected {
+		if inProgress[name] != value {
+			t.Errorf("expected %s to be %v while the deploy was in progress, got %v", name, value, inProgress[name])
+		}
+	}
+	if healthy := gatherMetric(t, metrics, "orchestrate_containers_healthy", "web"); healthy != 3 {
+		t.Errorf("expected every container to be healthy once the scale up finished, got %v", healthy)
+	}
+
+	if current := gatherMetric(t, metrics, "orchestrate_containers_current", "web"); current != 3 {
+		t.Errorf("expected every started container to be counted once the scale up finished, got %v", current)
+	}
+
+	err = scaleDownContainers(context.Background(), ScaleDownContainersInput{
+		Client: mock,
+		CurrentContainers: []container.Summary{
+			{ID: "new1_container_id", Created: 100, Names: []string{"/new1"}},
+			{ID: "new2_container_id", Created: 110, Names: []string{"/new2"}},
+			{ID: "new3_container_id", Created: 120, Names: []string{"/new3"}},
+		},
+		CurrentReplicas: 3,
+		DesiredReplicas: 1,
+		Executor:        executor,
+		Logger:          logger,
+		Metrics:         metrics,
+		ProjectName:     "proj",
+		ServiceName:     "web",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if current := gatherMetric(t, metrics, "orchestrate_containers_current", "web"); current != 1 {
+		t.Errorf("expected the stopped containers to no longer be counted, got %v", current)
+	}
+
+	metrics.serviceCompleted("web", DeployServiceResult{Duration: 2 * time.Second, Replicas: 1}, nil)
+	if current := gatherMetric(t, metrics, "orchestrate_containers_current", "web"); current != 1 {
+		t.Errorf("expected the current containers to be the deployed replicas, got %v", current)
+	}
+	if deploys := gatherMetric(t, metrics, "orchestrate_deploy_duration_seconds", "web"); deploys != 1 {
+		t.Errorf("expected one deploy duration to be observed, got %v", deploys)
+	}
+
+	recorder := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if body := recorder.Body.String(); !strings.Contains(body, `orchestrate_containers_healthy{service="web"} 3`) {
+		t.Errorf("expected the handler to expose the metrics, got:\n%s", body)
+	}
+
+	// a nil DeployMetrics records nothing
+	var disabled *DeployMetrics
+	disabled.serviceStarted("web", 1, 0)
+	disabled.containersStarted("web", 1)
+	disabled.containerStopped("web")
+	disabled.containerHealthy("web")
+}
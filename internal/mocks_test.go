@@ -2,18 +2,39 @@ package internal
 
 import (
 	"context"
+	"time"
 
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/registry"
+	"github.com/docker/docker/api/types/system"
+	"github.com/docker/docker/api/types/volume"
 )
 
 type mockDockerClient struct {
 	DockerClientInterface
-	containerList      func(ctx context.Context, options container.ListOptions) ([]container.Summary, error)
-	containerInspect   func(ctx context.Context, id string) (container.InspectResponse, error)
-	containerStart     func(ctx context.Context, id string, options container.StartOptions) error
-	containerTerminate func(ctx context.Context, id string) error
-	containerRename    func(ctx context.Context, id, name string) error
-	renamedContainers  map[string]string
+	containerExec       func(ctx context.Context, id string, options ContainerExecOptions) (int, error)
+	containerList       func(ctx context.Context, options container.ListOptions) ([]container.Summary, error)
+	containerLogs       func(ctx context.Context, id string, options container.LogsOptions) (string, error)
+	containerInspect    func(ctx context.Context, id string) (container.InspectResponse, error)
+	containerStart      func(ctx context.Context, id string, options container.StartOptions) error
+	containerTerminate  func(ctx context.Context, id string, stopTimeout time.Duration) error
+	containerRemove     func(ctx context.Context, id string, options container.RemoveOptions) error
+	containerRename     func(ctx context.Context, id, name string) error
+	containerUpdate     func(ctx context.Context, id string, updateConfig container.UpdateConfig) (container.UpdateResponse, error)
+	containerWait       func(ctx context.Context, id string, condition container.WaitCondition) (<-chan container.WaitResponse, <-chan error)
+	diskUsage           func(ctx context.Context) (DiskSpace, error)
+	distributionInspect func(ctx context.Context, imageRef string) (registry.DistributionInspect, error)
+	events              func(ctx context.Context, options events.ListOptions) (<-chan events.Message, <-chan error)
+	imageInspect        func(ctx context.Context, imageID string) (image.InspectResponse, error)
+	info                func(ctx context.Context) (system.Info, error)
+	networkList         func(ctx context.Context, options network.ListOptions) ([]network.Summary, error)
+	networkRemove       func(ctx context.Context, networkID string) error
+	volumeList          func(ctx context.Context, options volume.ListOptions) (volume.ListResponse, error)
+	volumeRemove        func(ctx context.Context, volumeID string, force bool) error
+	renamedContainers   map[string]string
 }
 
 func (m *mockDockerClient) ContainerList(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
@@ -23,6 +44,20 @@ func (m *mockDockerClient) ContainerList(ctx context.Context, options container.
 	return nil, nil
 }
 
+func (m *mockDockerClient) ContainerLogs(ctx context.Context, id string, options container.LogsOptions) (string, error) {
+	if m.containerLogs != nil {
+		return m.containerLogs(ctx, id, options)
+	}
+	return "", nil
+}
+
+func (m *mockDockerClient) ContainerExec(ctx context.Context, id string, options ContainerExecOptions) (int, error) {
+	if m.containerExec != nil {
+		return m.containerExec(ctx, id, options)
+	}
+	return 0, nil
+}
+
 func (m *mockDockerClient) ContainerInspect(ctx context.Context, id string) (container.InspectResponse, error) {
 	if m.containerInspect != nil {
 		return m.containerInspect(ctx, id)
@@ -38,8 +73,26 @@ func (m *mockDockerClient) ContainerStart(ctx context.Context, id string, option
 }
 
 func (m *mockDockerClient) ContainerTerminate(ctx context.Context, id string) error {
+	return m.ContainerTerminateWithTimeout(ctx, id, 10*time.Second)
+}
+
+func (m *mockDockerClient) ContainerTerminateWithTimeout(ctx context.Context, id string, stopTimeout time.Duration) error {
 	if m.containerTerminate != nil {
-		return m.containerTerminate(ctx, id)
+		return m.containerTerminate(ctx, id, stopTimeout)
+	}
+	return nil
+}
+
+func (m *mockDockerClient) ContainerUpdate(ctx context.Context, id string, updateConfig container.UpdateConfig) (container.UpdateResponse, error) {
+	if m.containerUpdate != nil {
+		return m.containerUpdate(ctx, id, updateConfig)
+	}
+	return container.UpdateResponse{}, nil
+}
+
+func (m *mockDockerClient) ContainerRemove(ctx context.Context, id string, options container.RemoveOptions) error {
+	if m.containerRemove != nil {
+		return m.containerRemove(ctx, id, options)
 	}
 	return nil
 }
@@ -55,6 +108,78 @@ func (m *mockDockerClient) ContainerRename(ctx context.Context, id, name string)
 	return nil
 }
 
+func (m *mockDockerClient) ContainerWait(ctx context.Context, id string, condition container.WaitCondition) (<-chan container.WaitResponse, <-chan error) {
+	if m.containerWait != nil {
+		return m.containerWait(ctx, id, condition)
+	}
+	respCh := make(chan container.WaitResponse, 1)
+	respCh <- container.WaitResponse{StatusCode: 0}
+	return respCh, make(chan error)
+}
+
 func (m *mockDockerClient) Close() error {
 	return nil
 }
+
+func (m *mockDockerClient) DiskUsage(ctx context.Context) (DiskSpace, error) {
+	if m.diskUsage != nil {
+		return m.diskUsage(ctx)
+	}
+	return DiskSpace{}, nil
+}
+
+func (m *mockDockerClient) DistributionInspect(ctx context.Context, imageRef string) (registry.DistributionInspect, error) {
+	if m.distributionInspect != nil {
+		return m.distributionInspect(ctx, imageRef)
+	}
+	return registry.DistributionInspect{}, nil
+}
+
+func (m *mockDockerClient) Events(ctx context.Context, options events.ListOptions) (<-chan events.Message, <-chan error) {
+	if m.events != nil {
+		return m.events(ctx, options)
+	}
+	return make(chan events.Message), make(chan error)
+}
+
+func (m *mockDockerClient) ImageInspect(ctx context.Context, imageID string) (image.InspectResponse, error) {
+	if m.imageInspect != nil {
+		return m.imageInspect(ctx, imageID)
+	}
+	return image.InspectResponse{ID: imageID}, nil
+}
+
+func (m *mockDockerClient) Info(ctx context.Context) (system.Info, error) {
+	if m.info != nil {
+		return m.info(ctx)
+	}
+	return system.Info{}, nil
+}
+
+func (m *mockDockerClient) NetworkList(ctx context.Context, options network.ListOptions) ([]network.Summary, error) {
+	if m.networkList != nil {
+		return m.networkList(ctx, options)
+	}
+	return nil, nil
+}
+
+func (m *mockDockerClient) NetworkRemove(ctx context.Context, networkID string) error {
+	if m.networkRemove != nil {
+		return m.networkRemove(ctx, networkID)
+	}
+	return nil
+}
+
+func (m *mockDockerClient) VolumeList(ctx context.Context, options volume.ListOptions) (volume.ListResponse, error) {
+	if m.volumeList != nil {
+		return m.volumeList(ctx, options)
+	}
+	return volume.ListResponse{}, nil
+}
+
+func (m *mockDockerClient) VolumeRemove(ctx context.Context, volumeID string, force bool) error {
+	if m.volumeRemove != nil {
+		return m.volumeRemove(ctx, volumeID, force)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/compose-spec/compose-go/v2/types"
+)
+
+// writeComposeOverlay writes a compose file overriding the specified
+// service's configuration and returns the path to the file. Compose
+// files are parsed as YAML, so the overlay is written as JSON.
+func writeComposeOverlay(serviceName string, overrides map[string]interface{}) (string, error) {
+	return writeComposeOverlayDocument(map[string]interface{}{
+		"services": map[string]interface{}{
+			serviceName: overrides,
+		},
+	})
+}
+
+// writeComposeOverlayDocument writes a full compose document, such as one
+// declaring top-level volumes alongside a service override, and returns the
+// path to the file
+func writeComposeOverlayDocument(document map[string]interface{}) (string, error) {
+	data, err := json.Marshal(document)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling compose overlay: %v", err)
+	}
+
+	overlayFile, err := os.CreateTemp("", "compose-overlay-*.json")
+	if err != nil {
+		return "", fmt.Errorf("error creating compose overlay: %v", err)
+	}
+
+	if _, err := overlayFile.Write(data); err != nil {
+		overlayFile.Close()
+		os.Remove(overlayFile.Name())
+		return "", fmt.Errorf("error writing compose overlay: %v", err)
+	}
+
+	if err := overlayFile.Close(); err != nil {
+		os.Remove(overlayFile.Name())
+		return "", fmt.Errorf("error closing compose overlay: %v", err)
+	}
+
+	return overlayFile.Name(), nil
+}
+
+// compatibilityOverrides translates the swarm-only `deploy` keys of a
+// service into the equivalent container-level settings, mirroring
+// `docker compose --compatibility`
+func compatibilityOverrides(service *types.ServiceConfig) map[string]interface{} {
+	overrides := map[string]interface{}{}
+	if service.Deploy == nil {
+		return overrides
+	}
+
+	if limits := service.Deploy.Resources.Limits; limits != nil {
+		if limits.MemoryBytes > 0 {
+			overrides["mem_limit"] = int64(limits.MemoryBytes)
+		}
+		if limits.NanoCPUs > 0 {
+			overrides["cpus"] = float32(limits.NanoCPUs)
+		}
+		if limits.Pids > 0 {
+			overrides["pids_limit"] = limits.Pids
+		}
+	}
+
+	if reservations := service.Deploy.Resources.Reservations; reservations != nil {
+		if reservations.MemoryBytes > 0 {
+			overrides["mem_reservation"] = int64(reservations.MemoryBytes)
+		}
+	}
+
+	if restartPolicy := service.Deploy.RestartPolicy; restartPolicy != nil {
+		switch restartPolicy.Condition {
+		case "none":
+			overrides["restart"] = "no"
+		case "on-failure":
+			if restartPolicy.MaxAttempts != nil {
+				overrides["restart"] = fmt.Sprintf("on-failure:%d", *restartPolicy.MaxAttempts)
+			} else {
+				overrides["restart"] = "on-failure"
+			}
+		case "any", "":
+			overrides["restart"] = "always"
+		}
+	}
+
+	return overrides
+}
+
+// legacyResourceOverrides returns the legacy top-level resource keys of a
+// service (the v2 schema's `mem_limit`, `cpus` and `cpu_shares`) so they are
+// applied when containers are created, even where a `--compatibility`
+// translation of `deploy.resources` would otherwise take their place
+func legacyResourceOverrides(service *types.ServiceConfig) map[string]interface{} {
+	overrides := map[string]interface{}{}
+	if service.MemLimit > 0 {
+		overrides["mem_limit"] = int64(service.MemLimit)
+	}
+	if service.CPUS > 0 {
+		overrides["cpus"] = service.CPUS
+	}
+	if service.CPUShares > 0 {
+		overrides["cpu_shares"] = service.CPUShares
+	}
+
+	return overrides
+}
+
+// hasDeployResources returns whether the service sets any `deploy.resources` limits or reservations
+func hasDeployResources(service *types.ServiceConfig) bool {
+	if service.Deploy == nil {
+		return false
+	}
+
+	return service.Deploy.Resources.Limits != nil || service.Deploy.Resources.Reservations != nil
+}
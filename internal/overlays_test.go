@@ -0,0 +1,170 @@
+package internal
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/compose-spec/compose-go/v2/types"
+)
+
+func TestCompatibilityOverrides(t *testing.T) {
+	threeAttempts := uint64(3)
+
+	t.Run("memory limit translation", func(t *testing.T) {
+		service := &types.ServiceConfig{
+			Name: "web",
+			Deploy: &types.DeployConfig{
+				Resources: types.Resources{
+					Limits: &types.Resource{
+						MemoryBytes: types.UnitBytes(512 * 1024 * 1024),
+						NanoCPUs:    types.NanoCPUs(0.5),
+					},
+					Reservations: &types.Resource{
+						MemoryBytes: types.UnitBytes(256 * 1024 * 1024),
+					},
+				},
+			},
+		}
+
+		overrides := compatibilityOverrides(service)
+		if overrides["mem_limit"] != int64(512*1024*1024) {
+			t.Errorf("expected mem_limit 536870912, got %v", overrides["mem_limit"])
+		}
+		if overrides["cpus"] != float32(0.5) {
+			t.Errorf("expected cpus 0.5, got %v", overrides["cpus"])
+		}
+		if overrides["mem_reservation"] != int64(256*1024*1024) {
+			t.Errorf("expected mem_reservation 268435456, got %v", overrides["mem_reservation"])
+		}
+		if _, ok := overrides["restart"]; ok {
+			t.Errorf("expected no restart override, got %v", overrides["restart"])
+		}
+	})
+
+	t.Run("restart policy translation", func(t *testing.T) {
+		tests := []struct {
+			name          string
+			restartPolicy *types.RestartPolicy
+			expected      string
+		}{
+			{
+				name:          "none",
+				restartPolicy: &types.RestartPolicy{Condition: "none"},
+				expected:      "no",
+			},
+			{
+				name:          "on_failure",
+				restartPolicy: &types.RestartPolicy{Condition: "on-failure"},
+				expected:      "on-failure",
+			},
+			{
+				name:          "on_failure_with_max_attempts",
+				restartPolicy: &types.RestartPolicy{Condition: "on-failure", MaxAttempts: &threeAttempts},
+				expected:      "on-failure:3",
+			},
+			{
+				name:          "any",
+				restartPolicy: &types.RestartPolicy{Condition: "any"},
+				expected:      "always",
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				service := &types.ServiceConfig{
+					Name: "web",
+					Deploy: &types.DeployConfig{
+						RestartPolicy: tt.restartPolicy,
+					},
+				}
+
+				overrides := compatibilityOverrides(service)
+				if overrides["restart"] != tt.expected {
+					t.Errorf("expected restart %q, got %v", tt.expected, overrides["restart"])
+				}
+			})
+		}
+	})
+
+	t.Run("no deploy config", func(t *testing.T) {
+		overrides := compatibilityOverrides(&types.ServiceConfig{Name: "web"})
+		if len(overrides) != 0 {
+			t.Errorf("expected no overrides, got %v", overrides)
+		}
+	})
+}
+
+func TestLegacyResourceOverrides(t *testing.T) {
+	t.Run("legacy mem_limit", func(t *testing.T) {
+		service := &types.ServiceConfig{
+			Name:     "web",
+			MemLimit: types.UnitBytes(512 * 1024 * 1024),
+		}
+
+		overrides := legacyResourceOverrides(service)
+		if overrides["mem_limit"] != int64(512*1024*1024) {
+			t.Errorf("expected mem_limit 536870912, got %v", overrides["mem_limit"])
+		}
+		if len(overrides) != 1 {
+			t.Errorf("expected only mem_limit to be set, got %v", overrides)
+		}
+		if hasDeployResources(service) {
+			t.Error("expected no deploy.resources to be detected")
+		}
+	})
+
+	t.Run("legacy keys and deploy resources", func(t *testing.T) {
+		service := &types.ServiceConfig{
+			Name:      "web",
+			CPUS:      0.5,
+			CPUShares: 512,
+			MemLimit:  types.UnitBytes(512 * 1024 * 1024),
+			Deploy: &types.DeployConfig{
+				Resources: types.Resources{
+					Limits: &types.Resource{
+						MemoryBytes: types.UnitBytes(512 * 1024 * 1024),
+					},
+				},
+			},
+		}
+
+		overrides := legacyResourceOverrides(service)
+		if overrides["cpus"] != float32(0.5) {
+			t.Errorf("expected cpus 0.5, got %v", overrides["cpus"])
+		}
+		if overrides["cpu_shares"] != int64(512) {
+			t.Errorf("expected cpu_shares 512, got %v", overrides["cpu_shares"])
+		}
+		if overrides["mem_limit"] != int64(512*1024*1024) {
+			t.Errorf("expected mem_limit 536870912, got %v", overrides["mem_limit"])
+		}
+		if !hasDeployResources(service) {
+			t.Error("expected deploy.resources to be detected")
+		}
+	})
+}
+
+func TestWriteComposeOverlay(t *testing.T) {
+	overlayFile, err := writeComposeOverlay("web", map[string]interface{}{
+		"mem_limit": int64(1024),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.Remove(overlayFile)
+
+	data, err := os.ReadFile(overlayFile)
+	if err != nil {
+		t.Fatalf("unexpected error reading overlay: %v", err)
+	}
+
+	var overlay map[string]map[string]map[string]interface{}
+	if err := json.Unmarshal(data, &overlay); err != nil {
+		t.Fatalf("unexpected error parsing overlay: %v", err)
+	}
+
+	if overlay["services"]["web"]["mem_limit"] != float64(1024) {
+		t.Errorf("expected mem_limit 1024 in overlay, got %v", overlay["services"]["web"]["mem_limit"])
+	}
+}
@@ -0,0 +1,44 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// ParallelismBudget bounds the number of containers updated at once across
+// every service of a deploy. Each batch of containers holds a slot of the
+// budget per container until the batch settles, so services deployed
+// together take turns rather than each updating its own parallelism. A nil
+// ParallelismBudget leaves every service to its own parallelism.
+type ParallelismBudget struct {
+	// sem holds a slot for each container being updated
+	sem *semaphore.Weighted
+	// size is the number of containers updated at once
+	size int
+}
+
+// NewParallelismBudget returns a budget of size containers, or nil when the
+// size is 0 so the services are not bounded
+func NewParallelismBudget(size int) *ParallelismBudget {
+	if size <= 0 {
+		return nil
+	}
+	return &ParallelismBudget{sem: semaphore.NewWeighted(int64(size)), size: size}
+}
+
+// acquire waits for a slot for each of the containers, returning the function
+// that hands them back. A batch larger than the budget waits for the whole
+// budget rather than forever.
+func (b *ParallelismBudget) acquire(ctx context.Context, containers int) (func(), error) {
+	if b == nil || containers <= 0 {
+		return func() {}, nil
+	}
+
+	slots := int64(min(containers, b.size))
+	if err := b.sem.Acquire(ctx, slots); err != nil {
+		return nil, fmt.Errorf("error waiting for the parallelism budget: %v", err)
+	}
+	return func() { b.sem.Release(slots) }, nil
+}
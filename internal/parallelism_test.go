@@ -0,0 +1,154 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"maps"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/josegonzalez/cli-skeleton/command"
+	"github.com/rs/zerolog"
+)
+
+func TestParallelismBudget(t *testing.T) {
+	t.Run("batches wait for the slots of other services", func(t *testing.T) {
+		budget := NewParallelismBudget(4)
+
+		releaseWeb, err := budget.acquire(context.Background(), 3)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		acquired := make(chan func())
+		go func() {
+			releaseWorker, err := budget.acquire(context.Background(), 3)
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			acquired <- releaseWorker
+		}()
+
+		select {
+		case <-acquired:
+			t.Fatal("expected the worker batch to wait while the web batch holds the budget")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		releaseWeb()
+		select {
+		case releaseWorker := <-acquired:
+			releaseWorker()
+		case <-time.After(time.Second):
+			t.Fatal("expected the worker batch to acquire the budget once the web batch released it")
+		}
+	})
+
+	t.Run("batches larger than the budget take the whole budget", func(t *testing.T) {
+		budget := NewParallelismBudget(2)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		release, err := budget.acquire(ctx, 5)
+		if err != nil {
+			t.Fatalf("expected an oversized batch to acquire the whole budget, got %v", err)
+		}
+		release()
+	})
+
+	t.Run("cancelled waits return an error", func(t *testing.T) {
+		budget := NewParallelismBudget(1)
+		release, err := budget.acquire(context.Background(), 1)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer release()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := budget.acquire(ctx, 1); err == nil {
+			t.Error("expected an error waiting on a cancelled context")
+		}
+	})
+
+	t.Run("nil budget does not bound", func(t *testing.T) {
+		budget := NewParallelismBudget(0)
+		if budget != nil {
+			t.Fatalf("expected no budget for a size of 0, got %+v", budget)
+		}
+		release, err := budget.acquire(context.Background(), 100)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		release()
+	})
+}
+
+func TestDeployProjectParallelismBudget(t *testing.T) {
+	// the services log from their own goroutines
+	var buf bytes.Buffer
+	output := zerolog.SyncWriter(&buf)
+	logger := &command.ZerologUi{
+		StderrLogger: zerolog.New(output),
+		StdoutLogger: zerolog.New(output),
+	}
+
+	mockClient := &mockDockerClient{
+		containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+			return []container.Summary{}, nil
+		},
+	}
+	mockExecutor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+		return ExecCommandResponse{ExitCode: 0}, nil
+	}
+
+	parallelism := func(value uint64) *types.DeployConfig {
+		return &types.DeployConfig{UpdateConfig: &types.UpdateConfig{Parallelism: &value}}
+	}
+	project := &types.Project{
+		Services: types.Services{
+			"web":    types.ServiceConfig{Name: "web", Deploy: parallelism(6)},
+			"worker": types.ServiceConfig{Name: "worker", Deploy: parallelism(6)},
+			"cron":   types.ServiceConfig{Name: "cron", Deploy: parallelism(6)},
+		},
+	}
+
+	err := DeployProject(context.Background(), DeployProjectInput{
+		Client:                mockClient,
+		ComposeFile:           "/tmp/docker-compose.yaml",
+		ContainerNameTemplate: "{{.ServiceName}}",
+		Executor:              mockExecutor,
+		Interleave:            []string{"web", "worker"},
+		Logger:                logger,
+		ParallelismBudget:     4,
+		Project:               project,
+		ProjectName:           "test",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	resolved := map[string]int{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry struct {
+			Message     string `json:"message"`
+			Parallelism int    `json:"parallelism"`
+			Service     string `json:"service"`
+		}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil || entry.Message != "Resolved deploy plan" {
+			continue
+		}
+		resolved[entry.Service] = entry.Parallelism
+	}
+
+	// each service's batches are capped to the budget, which the services
+	// deployed together then share
+	expected := map[string]int{"cron": 4, "web": 4, "worker": 4}
+	if !maps.Equal(resolved, expected) {
+		t.Errorf("expected each service to be capped to the parallelism budget\nexpected: %v\ngot:      %v", expected, resolved)
+	}
+}
@@ -0,0 +1,257 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+)
+
+// CheckPortConflictsInput contains the parameters for checking published port conflicts
+type CheckPortConflictsInput struct {
+	// Client is the docker client to use
+	Client DockerClientInterface
+	// Project is the compose project
+	Project *types.Project
+	// ProjectLabel overrides the com.docker.compose.project label value used to discover containers. Defaults to ProjectName.
+	ProjectLabel string
+	// ProjectName is the name of the project
+	ProjectName string
+	// ServiceNames are the services being deployed, the only ones whose ports are checked
+	ServiceNames []string
+}
+
+// publishedPort is a host port published by a service
+type publishedPort struct {
+	// HostIP is the host address the port is bound to, empty for all addresses
+	HostIP string
+	// Port is the host port number
+	Port uint16
+	// Protocol is the port protocol (tcp, udp)
+	Protocol string
+	// ServiceName is the name of the service publishing the port
+	ServiceName string
+}
+
+// String returns the port in port/protocol form
+func (p publishedPort) String() string {
+	return fmt.Sprintf("%d/%s", p.Port, p.Protocol)
+}
+
+// overlaps returns whether two ports would contend for the same host binding
+func (p publishedPort) overlaps(port uint16, protocol string, hostIP string) bool {
+	if p.Port != port || p.Protocol != protocol {
+		return false
+	}
+	return isWildcardHostIP(p.HostIP) || isWildcardHostIP(hostIP) || p.HostIP == hostIP
+}
+
+// checkPortConflicts fails fast when two services being deployed publish the
+// same host port, or when a published host port is already bound by a running
+// container outside of the project
+func checkPortConflicts(ctx context.Context, input CheckPortConflictsInput) error {
+	ports, err := projectPublishedPorts(input.Project, input.ServiceNames)
+	if err != nil {
+		return err
+	}
+	if len(ports) == 0 {
+		return nil
+	}
+
+	for i, port := range ports {
+		for _, other := range ports[:i] {
+			if other.ServiceName == port.ServiceName {
+				continue
+			}
+			if other.overlaps(port.Port, port.Protocol, port.HostIP) {
+				return fmt.Errorf("port conflict: services %s and %s both publish host port %s", other.ServiceName, port.ServiceName, port)
+			}
+		}
+	}
+
+	projectLabel := input.ProjectName
+	if input.ProjectLabel != "" {
+		projectLabel = input.ProjectLabel
+	}
+
+	filterArgs := filters.NewArgs()
+	filterArgs.Add("status", "running")
+	containers, err := input.Client.ContainerList(ctx, container.ListOptions{
+		Filters: filterArgs,
+	})
+	if err != nil {
+		return fmt.Errorf("error listing containers: %v", err)
+	}
+
+	for _, c := range containers {
+		if c.Labels["com.docker.compose.project"] == projectLabel {
+			continue
+		}
+
+		for _, containerPort := range c.Ports {
+			if containerPort.PublicPort == 0 {
+				continue
+			}
+
+			for _, port := range ports {
+				if port.overlaps(containerPort.PublicPort, containerPort.Type, containerPort.IP) {
+					return fmt.Errorf("port conflict: service %s publishes host port %s which is already in use by container %s", port.ServiceName, port, containerDisplayName(c))
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// projectPublishedPorts collects the host ports published by the given services of the project
+func projectPublishedPorts(project *types.Project, serviceNames []string) ([]publishedPort, error) {
+	ports := []publishedPort{}
+	for _, serviceName := range slices.Sorted(slices.Values(serviceNames)) {
+		service, ok := project.Services[serviceName]
+		if !ok {
+			continue
+		}
+		for _, portConfig := range service.Ports {
+			if portConfig.Published == "" {
+				continue
+			}
+
+			hostPorts, err := parsePublishedPorts(portConfig.Published)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing published port for service %s: %v", serviceName, err)
+			}
+
+			protocol := portConfig.Protocol
+			if protocol == "" {
+				protocol = "tcp"
+			}
+
+			for _, hostPort := range hostPorts {
+				ports = append(ports, publishedPort{
+					HostIP:      portConfig.HostIP,
+					Port:        hostPort,
+					Protocol:    protocol,
+					ServiceName: serviceName,
+				})
+			}
+		}
+	}
+
+	return ports, nil
+}
+
+// parsePublishedPorts parses a published port or port range such as 8080 or 8000-8010
+func parsePublishedPorts(published string) ([]uint16, error) {
+	start, end, isRange := strings.Cut(published, "-")
+	if !isRange {
+		end = start
+	}
+
+	startPort, err := strconv.ParseUint(start, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q", published)
+	}
+	endPort, err := strconv.ParseUint(end, 10, 16)
+	if err != nil || endPort < startPort {
+		return nil, fmt.Errorf("invalid port range %q", published)
+	}
+
+	ports := []uint16{}
+	for port := startPort; port <= endPort; port++ {
+		ports = append(ports, uint16(port))
+	}
+	return ports, nil
+}
+
+// isWildcardHostIP returns whether the host address binds all interfaces
+func isWildcardHostIP(hostIP string) bool {
+	return hostIP == "" || hostIP == "0.0.0.0" || hostIP == "::"
+}
+
+// publishedURL returns a URL for the first published tcp port in the
+// mappings, or an empty string when no tcp port is published. A wildcard
+// binding is reached through the loopback address.
+func publishedURL(scheme string, mappings []PortMapping) string {
+	for _, m := range mappings {
+		if !strings.HasSuffix(m.ContainerPort, "/tcp") || m.HostPort == "" {
+			continue
+		}
+		host := m.HostIP
+		if isWildcardHostIP(host) {
+			host = "127.0.0.1"
+		}
+		return fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(host, m.HostPort))
+	}
+	return ""
+}
+
+// containerDisplayName returns a human-readable name for a container
+func containerDisplayName(c container.Summary) string {
+	shortID := c.ID
+	if len(shortID) > 12 {
+		shortID = shortID[:12]
+	}
+	if len(c.Names) == 0 {
+		return shortID
+	}
+	return fmt.Sprintf("%s (%s)", strings.TrimPrefix(c.Names[0], "/"), shortID)
+}
+
+// PortMapping is a container port published on a host port
+type PortMapping struct {
+	// Container is the name of the container
+	Container string
+	// ContainerPort is the container port and protocol, such as 8080/tcp
+	ContainerPort string
+	// HostIP is the host address the port is bound to
+	HostIP string
+	// HostPort is the host port assigned to the container port
+	HostPort string
+}
+
+// String returns the mapping in the form used by docker ps
+func (m PortMapping) String() string {
+	return fmt.Sprintf("%s:%s->%s", m.HostIP, m.HostPort, m.ContainerPort)
+}
+
+// containerPortMappings returns the host ports assigned to the published
+// ports of the containers, which for dynamically published ports are only
+// known once the containers are running
+func containerPortMappings(ctx context.Context, client DockerClientInterface, containers []container.Summary) ([]PortMapping, error) {
+	mappings := []PortMapping{}
+	for _, c := range containers {
+		inspect, err := client.ContainerInspect(ctx, c.ID)
+		if err != nil {
+			return nil, fmt.Errorf("error inspecting container %s: %v", containerDisplayName(c), err)
+		}
+		if inspect.ContainerJSONBase == nil || inspect.NetworkSettings == nil {
+			continue
+		}
+
+		name := strings.TrimPrefix(inspect.Name, "/")
+		if name == "" {
+			name = containerDisplayName(c)
+		}
+
+		for _, port := range slices.Sorted(maps.Keys(inspect.NetworkSettings.Ports)) {
+			for _, binding := range inspect.NetworkSettings.Ports[port] {
+				mappings = append(mappings, PortMapping{
+					Container:     name,
+					ContainerPort: string(port),
+					HostIP:        binding.HostIP,
+					HostPort:      binding.HostPort,
+				})
+			}
+		}
+	}
+
+	return mappings, nil
+}
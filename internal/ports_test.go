@@ -0,0 +1,191 @@
+package internal
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestCheckPortConflicts(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name          string
+		services      types.Services
+		deployed      []string
+		containers    []container.Summary
+		expectedError string
+	}{
+		{
+			name: "no conflicts",
+			services: types.Services{
+				"web": {Name: "web", Ports: []types.ServicePortConfig{{Target: 80, Published: "8080"}}},
+				"api": {Name: "api", Ports: []types.ServicePortConfig{{Target: 80, Published: "8081"}}},
+			},
+		},
+		{
+			name: "intra-project duplicate",
+			services: types.Services{
+				"web": {Name: "web", Ports: []types.ServicePortConfig{{Target: 80, Published: "8080"}}},
+				"api": {Name: "api", Ports: []types.ServicePortConfig{{Target: 3000, Published: "8000-8080"}}},
+			},
+			expectedError: "port conflict: services api and web both publish host port 8080/tcp",
+		},
+		{
+			name: "same port on different protocols",
+			services: types.Services{
+				"web": {Name: "web", Ports: []types.ServicePortConfig{{Target: 53, Published: "53", Protocol: "tcp"}}},
+				"dns": {Name: "dns", Ports: []types.ServicePortConfig{{Target: 53, Published: "53", Protocol: "udp"}}},
+			},
+		},
+		{
+			name: "same port on different host addresses",
+			services: types.Services{
+				"web": {Name: "web", Ports: []types.ServicePortConfig{{Target: 80, Published: "8080", HostIP: "127.0.0.1"}}},
+				"api": {Name: "api", Ports: []types.ServicePortConfig{{Target: 80, Published: "8080", HostIP: "10.0.0.1"}}},
+			},
+		},
+		{
+			name: "external conflict",
+			services: types.Services{
+				"web": {Name: "web", Ports: []types.ServicePortConfig{{Target: 80, Published: "8080"}}},
+			},
+			containers: []container.Summary{
+				{
+					ID:     "abcdef1234567890",
+					Names:  []string{"/other"},
+					Labels: map[string]string{"com.docker.compose.project": "other"},
+					Ports:  []container.Port{{IP: "0.0.0.0", PrivatePort: 80, PublicPort: 8080, Type: "tcp"}},
+				},
+			},
+			expectedError: "port conflict: service web publishes host port 8080/tcp which is already in use by container other (abcdef123456)",
+		},
+		{
+			name: "conflict with a service that is not deployed",
+			services: types.Services{
+				"web": {Name: "web", Ports: []types.ServicePortConfig{{Target: 80, Published: "8080"}}},
+				"api": {Name: "api", Ports: []types.ServicePortConfig{{Target: 80, Published: "8080"}}},
+			},
+			deployed: []string{"web"},
+		},
+		{
+			name: "external conflict with a service that is not deployed",
+			services: types.Services{
+				"web": {Name: "web", Ports: []types.ServicePortConfig{{Target: 80, Published: "8080"}}},
+				"api": {Name: "api", Ports: []types.ServicePortConfig{{Target: 80, Published: "9090"}}},
+			},
+			deployed: []string{"web"},
+			containers: []container.Summary{
+				{
+					ID:     "abcdef1234567890",
+					Names:  []string{"/other"},
+					Labels: map[string]string{"com.docker.compose.project": "other"},
+					Ports:  []container.Port{{IP: "0.0.0.0", PrivatePort: 80, PublicPort: 9090, Type: "tcp"}},
+				},
+			},
+		},
+		{
+			name: "port held by the project itself",
+			services: types.Services{
+				"web": {Name: "web", Ports: []types.ServicePortConfig{{Target: 80, Published: "8080"}}},
+			},
+			containers: []container.Summary{
+				{
+					ID:     "abcdef1234567890",
+					Names:  []string{"/test_web_1"},
+					Labels: map[string]string{"com.docker.compose.project": "test"},
+					Ports:  []container.Port{{IP: "0.0.0.0", PrivatePort: 80, PublicPort: 8080, Type: "tcp"}},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := &mockDockerClient{
+				containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+					return tt.containers, nil
+				},
+			}
+
+			deployed := tt.deployed
+			if deployed == nil {
+				deployed = slices.Collect(maps.Keys(tt.services))
+			}
+
+			err := checkPortConflicts(ctx, CheckPortConflictsInput{
+				Client:       mockClient,
+				Project:      &types.Project{Name: "test", Services: tt.services},
+				ProjectName:  "test",
+				ServiceNames: deployed,
+			})
+			if tt.expectedError == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), tt.expectedError) {
+				t.Errorf("expected error containing %q, got %q", tt.expectedError, err.Error())
+			}
+		})
+	}
+}
+
+func TestPublishedURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		scheme   string
+		mappings []PortMapping
+		expected string
+	}{
+		{
+			name:     "no published ports",
+			scheme:   "http",
+			expected: "",
+		},
+		{
+			name:     "wildcard binding uses the loopback address",
+			scheme:   "http",
+			mappings: []PortMapping{{ContainerPort: "80/tcp", HostIP: "0.0.0.0", HostPort: "32768"}},
+			expected: "http://127.0.0.1:32768",
+		},
+		{
+			name:     "specific host address",
+			scheme:   "https",
+			mappings: []PortMapping{{ContainerPort: "443/tcp", HostIP: "10.0.0.5", HostPort: "8443"}},
+			expected: "https://10.0.0.5:8443",
+		},
+		{
+			name:     "ipv6 host address",
+			scheme:   "http",
+			mappings: []PortMapping{{ContainerPort: "80/tcp", HostIP: "fd00::1", HostPort: "8080"}},
+			expected: "http://[fd00::1]:8080",
+		},
+		{
+			name:   "udp ports are skipped",
+			scheme: "http",
+			mappings: []PortMapping{
+				{ContainerPort: "53/udp", HostIP: "0.0.0.0", HostPort: "5353"},
+				{ContainerPort: "8080/tcp", HostIP: "0.0.0.0", HostPort: "80"},
+			},
+			expected: "http://127.0.0.1:80",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := publishedURL(tt.scheme, tt.mappings); actual != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/compose-spec/compose-go/v2/types"
+)
+
+// ProjectCache caches loaded compose projects, so a long-running process
+// loading the same unchanged compose files repeatedly only parses them once.
+// A cached project is reused until a compose file or the .env file next to
+// it is modified, or the environment changes.
+type ProjectCache struct {
+	// entries are the cached projects, keyed by their inputs
+	entries map[string]*types.Project
+	// load loads a project on a cache miss
+	load func(projectName string, filenames []string, profiles []string) (*types.Project, error)
+	// mu guards entries
+	mu sync.Mutex
+}
+
+// NewProjectCache returns an empty project cache
+func NewProjectCache() *ProjectCache {
+	return &ProjectCache{
+		entries: map[string]*types.Project{},
+		load:    ComposeProjectFiles,
+	}
+}
+
+// Load returns the compose project merged from the specified files with the
+// given profiles enabled, reading it from the cache when none of its inputs
+// changed since it was last loaded. Each call returns a copy that may be
+// modified freely.
+func (c *ProjectCache) Load(projectName string, filenames []string, profiles []string) (*types.Project, error) {
+	key, err := projectCacheKey(projectName, filenames, profiles)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	project, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok {
+		return project.WithServicesDisabled(), nil
+	}
+
+	project, err = c.load(projectName, filenames, profiles)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// a file that changed keys a new entry, so the old entries of the
+	// same files can never be hit again
+	prefix := projectCacheFilesKey(projectName, filenames, profiles)
+	for existing := range c.entries {
+		if strings.HasPrefix(existing, prefix) {
+			delete(c.entries, existing)
+		}
+	}
+	c.entries[key] = project
+	return project.WithServicesDisabled(), nil
+}
+
+// projectCacheFilesKey returns the part of the cache key naming the loaded
+// files, without the state they were loaded in
+func projectCacheFilesKey(projectName string, filenames []string, profiles []string) string {
+	return fmt.Sprintf("%s\x00%s\x00%s\x00", projectName, strings.Join(filenames, "\x01"), strings.Join(profiles, "\x01"))
+}
+
+// projectCacheKey returns the cache key of a project load, covering the
+// modification time of every file read and a hash of the environment
+func projectCacheKey(projectName string, filenames []string, profiles []string) (string, error) {
+	key := projectCacheFilesKey(projectName, filenames, profiles)
+
+	files := slices.Clone(filenames)
+	if len(filenames) > 0 {
+		files = append(files, filepath.Join(filepath.Dir(filenames[0]), ".env"))
+	}
+	for i, filename := range files {
+		info, err := os.Stat(filename)
+		if err != nil {
+			// the .env file is optional
+			if os.IsNotExist(err) && i == len(filenames) {
+				key += "-"
+				continue
+			}
+			return "", fmt.Errorf("error reading compose file %s: %v", filename, err)
+		}
+		key += fmt.Sprintf("%d.%d,", info.ModTime().UnixNano(), info.Size())
+	}
+
+	environ := os.Environ()
+	slices.Sort(environ)
+	sum := sha256.Sum256([]byte(strings.Join(environ, "\x00")))
+	return key + "\x00" + hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,80 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+)
+
+func TestProjectCache(t *testing.T) {
+	composeFile := filepath.Join(t.TempDir(), "docker-compose.yml")
+	if err := os.WriteFile(composeFile, []byte("services:\n  web:\n    image: nginx:1.27\n"), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cache := NewProjectCache()
+	loads := 0
+	cache.load = func(projectName string, filenames []string, profiles []string) (*types.Project, error) {
+		loads++
+		return ComposeProjectFiles(projectName, filenames, profiles)
+	}
+
+	project, err := cache.Load("test", []string{composeFile}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if loads != 1 {
+		t.Errorf("expected the first load to miss the cache, got %d loads", loads)
+	}
+
+	// the cached project is not shared with the caller
+	project.Services["web"] = types.ServiceConfig{Name: "web", Image: "nginx:changed"}
+
+	project, err = cache.Load("test", []string{composeFile}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if loads != 1 {
+		t.Errorf("expected an unchanged load to hit the cache, got %d loads", loads)
+	}
+	if image := project.Services["web"].Image; image != "nginx:1.27" {
+		t.Errorf("expected the cached project to be unchanged, got image %s", image)
+	}
+
+	t.Run("changed file", func(t *testing.T) {
+		if err := os.WriteFile(composeFile, []byte("services:\n  web:\n    image: nginx:1.28\n"), 0644); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		modTime := time.Now().Add(time.Minute)
+		if err := os.Chtimes(composeFile, modTime, modTime); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		project, err := cache.Load("test", []string{composeFile}, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if loads != 2 {
+			t.Errorf("expected a changed file to miss the cache, got %d loads", loads)
+		}
+		if image := project.Services["web"].Image; image != "nginx:1.28" {
+			t.Errorf("expected the changed file to be loaded, got image %s", image)
+		}
+		if len(cache.entries) != 1 {
+			t.Errorf("expected the stale entry to be evicted, got %d entries", len(cache.entries))
+		}
+	})
+
+	t.Run("changed environment", func(t *testing.T) {
+		t.Setenv("DOCKER_ORCHESTRATE_PROJECT_CACHE_TEST", "1")
+		if _, err := cache.Load("test", []string{composeFile}, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if loads != 3 {
+			t.Errorf("expected a changed environment to miss the cache, got %d loads", loads)
+		}
+	})
+}
@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// ListContainersInput is the input for the ListContainers function
+type ListContainersInput struct {
+	// Client is the Docker client to use
+	Client DockerClientInterface
+	// DeployID only lists the containers stamped with this deploy ID, when set
+	DeployID string
+	// Now is the time container ages are measured from. Defaults to the current time.
+	Now time.Time
+	// ProjectLabel overrides the com.docker.compose.project label value used to discover containers. Defaults to ProjectName.
+	ProjectLabel string
+	// ProjectName is the name of the project
+	ProjectName string
+	// ServiceName is the name of the service to list containers for. Defaults to every service of the project.
+	ServiceName string
+	// Since only lists containers created within this long of Now, when set
+	Since time.Duration
+	// Until only lists containers created at least this long before Now, when set
+	Until time.Duration
+}
+
+// ListContainers returns the containers of a project or service, running or
+// not, oldest first
+func ListContainers(ctx context.Context, input ListContainersInput) ([]container.Summary, error) {
+	if input.Client == nil {
+		return nil, fmt.Errorf("client is required")
+	}
+
+	if input.Since < 0 || input.Until < 0 {
+		return nil, fmt.Errorf("container age filters must not be negative")
+	}
+
+	if input.Since > 0 && input.Until >= input.Since {
+		return nil, fmt.Errorf("until must be shorter than since, or no container can match: since=%s, until=%s", input.Since, input.Until)
+	}
+
+	containers, err := composeContainers(ComposeContainersInput{
+		Client:       input.Client,
+		ExtraFilters: deployIDFilters(input.DeployID),
+		ProjectLabel: input.ProjectLabel,
+		ProjectName:  input.ProjectName,
+		ServiceName:  input.ServiceName,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting containers: %v", err)
+	}
+
+	now := input.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	containers = filterContainersByAge(containers, now, input.Since, input.Until)
+	slices.SortStableFunc(containers, func(a, b container.Summary) int {
+		return cmp.Compare(a.Created, b.Created)
+	})
+	return containers, nil
+}
+
+// filterContainersByAge keeps the containers created within since of now,
+// and at least until before now. A zero duration leaves that bound open.
+func filterContainersByAge(containers []container.Summary, now time.Time, since time.Duration, until time.Duration) []container.Summary {
+	return slices.DeleteFunc(containers, func(c container.Summary) bool {
+		age := now.Sub(time.Unix(c.Created, 0))
+		if since > 0 && age > since {
+			return true
+		}
+		return until > 0 && age < until
+	})
+}
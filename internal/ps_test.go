@@ -0,0 +1,116 @@
+package internal
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestListContainersAgeFilter(t *testing.T) {
+	now := time.Unix(100000, 0)
+	containers := []container.Summary{
+		{ID: "day_old_container_id", Created: now.Add(-24 * time.Hour).Unix()},
+		{ID: "minute_old_container_id", Created: now.Add(-time.Minute).Unix()},
+		{ID: "hour_old_container_id", Created: now.Add(-time.Hour).Unix()},
+		{ID: "ten_minutes_old_container_id", Created: now.Add(-10 * time.Minute).Unix()},
+	}
+	mockClient := &mockDockerClient{
+		containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+			if len(options.Filters.Get("status")) > 0 {
+				t.Errorf("expected containers of every status to be listed, got %v", options.Filters.Get("status"))
+			}
+			return slices.Clone(containers), nil
+		},
+	}
+
+	tests := []struct {
+		name          string
+		since         time.Duration
+		until         time.Duration
+		expected      []string
+		expectedError string
+	}{
+		{
+			name:     "unfiltered",
+			expected: []string{"day_old_container_id", "hour_old_container_id", "ten_minutes_old_container_id", "minute_old_container_id"},
+		},
+		{
+			name:     "since",
+			since:    time.Hour,
+			expected: []string{"hour_old_container_id", "ten_minutes_old_container_id", "minute_old_container_id"},
+		},
+		{
+			name:     "until",
+			until:    10 * time.Minute,
+			expected: []string{"day_old_container_id", "hour_old_container_id", "ten_minutes_old_container_id"},
+		},
+		{
+			name:     "since and until",
+			since:    2 * time.Hour,
+			until:    5 * time.Minute,
+			expected: []string{"hour_old_container_id", "ten_minutes_old_container_id"},
+		},
+		{
+			name:          "empty window",
+			since:         time.Minute,
+			until:         time.Hour,
+			expectedError: "until must be shorter than since, or no container can match: since=1m0s, until=1h0m0s",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listed, err := ListContainers(context.Background(), ListContainersInput{
+				Client:      mockClient,
+				Now:         now,
+				ProjectName: "test",
+				Since:       tt.since,
+				Until:       tt.until,
+			})
+			if tt.expectedError != "" {
+				if err == nil || err.Error() != tt.expectedError {
+					t.Errorf("expected error %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			ids := []string{}
+			for _, c := range listed {
+				ids = append(ids, c.ID)
+			}
+			if !slices.Equal(ids, tt.expected) {
+				t.Errorf("unexpected containers\nexpected: %v\ngot:      %v", tt.expected, ids)
+			}
+		})
+	}
+}
+
+func TestListContainersDeployID(t *testing.T) {
+	deployLabel := DeployIDLabel + "=deploy-2"
+	mockClient := &mockDockerClient{
+		containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+			if !slices.Contains(options.Filters.Get("label"), deployLabel) {
+				t.Errorf("expected containers to be filtered to the deploy, got filters %v", options.Filters)
+			}
+			return []container.Summary{{ID: "web2_container_id", Labels: map[string]string{DeployIDLabel: "deploy-2"}}}, nil
+		},
+	}
+
+	listed, err := ListContainers(context.Background(), ListContainersInput{
+		Client:      mockClient,
+		DeployID:    "deploy-2",
+		ProjectName: "test",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(listed) != 1 || listed[0].ID != "web2_container_id" {
+		t.Errorf("expected only the containers of the deploy, got %+v", listed)
+	}
+}
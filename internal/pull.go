@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync/atomic"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/josegonzalez/cli-skeleton/command"
+	"golang.org/x/sync/errgroup"
+)
+
+// PullImagesInput is the input for the pullImages function
+type PullImagesInput struct {
+	// Executor is the command executor to use
+	Executor CommandExecutor
+	// Logger is the logger to use
+	Logger *command.ZerologUi
+	// Parallelism is the number of images to pull at once. If 0, images are not pulled up front.
+	Parallelism int
+	// Progress is whether to stream the per-layer progress of each pull rather than pulling quietly
+	Progress bool
+	// Project is the compose project
+	Project *types.Project
+	// QuietPull is whether to log a line when each pull starts as well as when it finishes
+	QuietPull bool
+	// ServiceNames are the services whose images should be pulled
+	ServiceNames []string
+	// SkipDatabases is whether database services are skipped, and so not pulled
+	SkipDatabases bool
+	// SkipServices are the services whose images are not pulled, relying on the local image
+	SkipServices []string
+}
+
+// pullImages pulls the distinct images of the given services concurrently,
+// so that a registry failure aborts the deploy before any container is touched
+func pullImages(ctx context.Context, input PullImagesInput) error {
+	if input.Parallelism <= 0 {
+		return nil
+	}
+
+	images := serviceImages(input)
+	if len(images) == 0 {
+		return nil
+	}
+
+	executor := input.Executor
+	if executor == nil {
+		executor = ExecCommand
+	}
+
+	input.Logger.Info(fmt.Sprintf("Pulling images: count=%d, parallelism=%d", len(images), input.Parallelism))
+
+	var pulled atomic.Int32
+	g, pullCtx := errgroup.WithContext(ctx)
+	g.SetLimit(input.Parallelism)
+	for _, image := range images {
+		g.Go(func() error {
+			if input.QuietPull {
+				input.Logger.Info(fmt.Sprintf("Pulling image: image=%s", image))
+			}
+
+			// the per-layer progress of concurrent pulls interleaves into
+			// noise, so it is only streamed when asked for
+			args := []string{"pull", "--quiet", image}
+			if input.Progress {
+				args = []string{"pull", image}
+			}
+
+			_, err := executor(pullCtx, ExecCommandInput{
+				Command:     "docker",
+				Args:        args,
+				StreamStdio: input.Progress,
+			})
+			if err != nil {
+				return fmt.Errorf("error pulling image %s: %v", image, err)
+			}
+
+			input.Logger.Info(fmt.Sprintf("Pulled image: image=%s, progress=%d/%d", image, pulled.Add(1), len(images)))
+			return nil
+		})
+	}
+
+	return g.Wait()
+}
+
+// serviceImages returns the sorted, distinct images referenced by the
+// services, ignoring services that are built locally, never pulled, or
+// marked to skip pulling
+func serviceImages(input PullImagesInput) []string {
+	images := []string{}
+	for _, serviceName := range input.ServiceNames {
+		service, err := input.Project.GetService(serviceName)
+		if err != nil || service.Image == "" || service.Build != nil {
+			continue
+		}
+		if service.PullPolicy == types.PullPolicyNever || service.PullPolicy == types.PullPolicyBuild {
+			continue
+		}
+		if serviceSkipsPull(&service) || slices.Contains(input.SkipServices, serviceName) {
+			continue
+		}
+
+		if shouldSkipService(ShouldSkipServiceInput{
+			Logger:              input.Logger,
+			Service:             &service,
+			ShouldSkipDatabases: input.SkipDatabases,
+			SilenceLogging:      true,
+		}) {
+			continue
+		}
+
+		if !slices.Contains(images, service.Image) {
+			images = append(images, service.Image)
+		}
+	}
+
+	slices.Sort(images)
+	return images
+}
+
+// serviceSkipsPull returns whether the service opts out of pulling its image
+// with the x-skip-pull extension
+func serviceSkipsPull(service *types.ServiceConfig) bool {
+	skipPull, _ := service.Extensions["x-skip-pull"].(bool)
+	return skipPull
+}
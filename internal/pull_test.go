@@ -0,0 +1,334 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/josegonzalez/cli-skeleton/command"
+	"github.com/rs/zerolog"
+)
+
+func TestPullImages(t *testing.T) {
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	project := &types.Project{
+		Services: types.Services{
+			"web": types.ServiceConfig{
+				Name:  "web",
+				Image: "example/app:1.0",
+			},
+			"worker": types.ServiceConfig{
+				Name:  "worker",
+				Image: "example/app:1.0",
+			},
+			"proxy": types.ServiceConfig{
+				Name:  "proxy",
+				Image: "nginx:1.27",
+			},
+			"builder": types.ServiceConfig{
+				Name:  "builder",
+				Image: "example/builder:dev",
+				Build: &types.BuildConfig{Context: "."},
+			},
+		},
+	}
+	serviceNames := []string{"web", "worker", "proxy", "builder"}
+
+	t.Run("distinct images are pulled concurrently", func(t *testing.T) {
+		var mu sync.Mutex
+		pulled := []string{}
+		inFlight := 0
+		maxInFlight := 0
+		bothStarted := make(chan struct{})
+
+		executor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+			mu.Lock()
+			pulled = append(pulled, input.Args[len(input.Args)-1])
+			inFlight++
+			maxInFlight = max(maxInFlight, inFlight)
+			if inFlight == 2 {
+				close(bothStarted)
+			}
+			mu.Unlock()
+
+			// hold each pull open until the other has started, which only
+			// happens when they run concurrently
+			select {
+			case <-bothStarted:
+			case <-time.After(time.Second):
+			}
+
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+			return ExecCommandResponse{ExitCode: 0}, nil
+		}
+
+		err := pullImages(context.Background(), PullImagesInput{
+			Executor:     executor,
+			Logger:       logger,
+			Parallelism:  2,
+			Project:      project,
+			ServiceNames: serviceNames,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		slices.Sort(pulled)
+		if strings.Join(pulled, ",") != "example/app:1.0,nginx:1.27" {
+			t.Errorf("expected each distinct image to be pulled once, got %v", pulled)
+		}
+		if maxInFlight != 2 {
+			t.Errorf("expected images to be pulled concurrently, got at most %d pulls at once", maxInFlight)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		executor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+			t.Errorf("expected no pulls, got %v", input.Args)
+			return ExecCommandResponse{ExitCode: 0}, nil
+		}
+
+		err := pullImages(context.Background(), PullImagesInput{
+			Executor:     executor,
+			Logger:       logger,
+			Project:      project,
+			ServiceNames: serviceNames,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("skipped services are not pulled", func(t *testing.T) {
+		project := &types.Project{
+			Services: types.Services{
+				"web": types.ServiceConfig{
+					Name:  "web",
+					Image: "example/web:dev",
+				},
+				"worker": types.ServiceConfig{
+					Name:       "worker",
+					Image:      "example/worker:dev",
+					Extensions: types.Extensions{"x-skip-pull": true},
+				},
+				"proxy": types.ServiceConfig{
+					Name:  "proxy",
+					Image: "nginx:1.27",
+				},
+			},
+		}
+
+		var mu sync.Mutex
+		pulled := []string{}
+		executor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			pulled = append(pulled, input.Args[len(input.Args)-1])
+			return ExecCommandResponse{ExitCode: 0}, nil
+		}
+
+		err := pullImages(context.Background(), PullImagesInput{
+			Executor:     executor,
+			Logger:       logger,
+			Parallelism:  2,
+			Project:      project,
+			ServiceNames: []string{"web", "worker", "proxy"},
+			SkipServices: []string{"web"},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if strings.Join(pulled, ",") != "nginx:1.27" {
+			t.Errorf("expected only the proxy image to be pulled, got %v", pulled)
+		}
+	})
+
+	t.Run("quiet pull", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := &command.ZerologUi{
+			StderrLogger: zerolog.New(&buf),
+			StdoutLogger: zerolog.New(&buf),
+		}
+
+		executor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+			if !slices.Contains(input.Args, "--quiet") || input.StreamStdio {
+				t.Errorf("expected pull progress to be suppressed, got args=%v, stream=%t", input.Args, input.StreamStdio)
+			}
+			return ExecCommandResponse{
+				ExitCode: 0,
+				Stdout:   "a1b2c3: Pulling fs layer\na1b2c3: Downloading 12.5MB/40MB\na1b2c3: Pull complete\n",
+			}, nil
+		}
+
+		err := pullImages(context.Background(), PullImagesInput{
+			Executor:     executor,
+			Logger:       logger,
+			Parallelism:  1,
+			Project:      project,
+			QuietPull:    true,
+			ServiceNames: []string{"proxy"},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		expected := []string{
+			"Pulling images: count=1, parallelism=1",
+			"Pulling image: image=nginx:1.27",
+			"Pulled image: image=nginx:1.27, progress=1/1",
+		}
+		if len(lines) != len(expected) {
+			t.Fatalf("expected only %d summary lines, got %q", len(expected), lines)
+		}
+		for i, line := range lines {
+			if !strings.Contains(line, expected[i]) {
+				t.Errorf("expected line %d to contain %q, got %q", i, expected[i], line)
+			}
+		}
+	})
+
+	t.Run("quiet by default", func(t *testing.T) {
+		executor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+			if !slices.Contains(input.Args, "--quiet") || input.StreamStdio {
+				t.Errorf("expected pull progress to be suppressed, got args=%v, stream=%t", input.Args, input.StreamStdio)
+			}
+			return ExecCommandResponse{ExitCode: 0}, nil
+		}
+
+		err := pullImages(context.Background(), PullImagesInput{
+			Executor:     executor,
+			Logger:       logger,
+			Parallelism:  1,
+			Project:      project,
+			ServiceNames: []string{"proxy"},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("pull progress", func(t *testing.T) {
+		executor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+			if slices.Contains(input.Args, "--quiet") || !input.StreamStdio {
+				t.Errorf("expected pull progress to be streamed, got args=%v, stream=%t", input.Args, input.StreamStdio)
+			}
+			return ExecCommandResponse{ExitCode: 0}, nil
+		}
+
+		err := pullImages(context.Background(), PullImagesInput{
+			Executor:     executor,
+			Logger:       logger,
+			Parallelism:  1,
+			Progress:     true,
+			Project:      project,
+			ServiceNames: []string{"proxy"},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("pull failure", func(t *testing.T) {
+		executor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+			if slices.Contains(input.Args, "nginx:1.27") {
+				return ExecCommandResponse{ExitCode: 1}, errors.New("manifest unknown")
+			}
+			return ExecCommandResponse{ExitCode: 0}, nil
+		}
+
+		err := pullImages(context.Background(), PullImagesInput{
+			Executor:     executor,
+			Logger:       logger,
+			Parallelism:  1,
+			Project:      project,
+			ServiceNames: serviceNames,
+		})
+		if err == nil || err.Error() != "error pulling image nginx:1.27: manifest unknown" {
+			t.Errorf("expected a pull error, got %v", err)
+		}
+	})
+}
+
+func TestDeployServiceSkipPull(t *testing.T) {
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	tests := []struct {
+		name       string
+		extensions types.Extensions
+		skipPull   bool
+		expected   bool
+	}{
+		{name: "pulled", expected: false},
+		{name: "skip-pull-for", skipPull: true, expected: true},
+		{name: "x-skip-pull", extensions: types.Extensions{"x-skip-pull": true}, expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replicas := 1
+			project := &types.Project{
+				Services: types.Services{
+					"web": types.ServiceConfig{
+						Name:       "web",
+						Image:      "registry.example.com/web:latest",
+						PullPolicy: types.PullPolicyAlways,
+						Deploy:     &types.DeployConfig{Replicas: &replicas},
+						Extensions: tt.extensions,
+					},
+				},
+			}
+
+			var createArgs []string
+			executor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+				if !slices.Contains(input.Args, "create") {
+					return ExecCommandResponse{ExitCode: 0}, nil
+				}
+				createArgs = input.Args
+				return ExecCommandResponse{ExitCode: 1}, errors.New("stop after create")
+			}
+
+			DeployService(context.Background(), DeployServiceInput{
+				Client:      &mockDockerClient{},
+				ComposeFile: "/tmp/docker-compose.yaml",
+				Executor:    executor,
+				Logger:      logger,
+				Project:     project,
+				ProjectName: "test",
+				ServiceName: "web",
+				SkipPull:    tt.skipPull,
+			})
+
+			if createArgs == nil {
+				t.Fatalf("expected the containers to be created")
+			}
+			if got := strings.Contains(strings.Join(createArgs, " "), "create --pull never"); got != tt.expected {
+				t.Errorf("expected --pull never to be passed=%t, got args %v", tt.expected, createArgs)
+			}
+		})
+	}
+}
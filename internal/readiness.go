@@ -0,0 +1,126 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// ServiceReadinessTemplateData is the data available to the service readiness command template
+type ServiceReadinessTemplateData struct {
+	// ContainerIDs are the IDs of the containers in the batch
+	ContainerIDs []string
+	// ContainerIPs are the IP addresses of the containers in the batch
+	ContainerIPs []string
+	// ServiceName is the name of the service
+	ServiceName string
+}
+
+// WaitForServiceReadinessInput is the input for the waitForServiceReadiness function
+type WaitForServiceReadinessInput struct {
+	// Client is the Docker client to use
+	Client DockerClientInterface
+	// Command is the host command that decides whether the batch is ready
+	Command string
+	// ContainerIDs are the IDs of the containers in the batch
+	ContainerIDs []string
+	// Executor is the command executor to use
+	Executor CommandExecutor
+	// Monitor is the interval between attempts
+	Monitor time.Duration
+	// ServiceName is the name of the service
+	ServiceName string
+	// StartPeriod extends the deadline for the batch to become ready
+	StartPeriod time.Duration
+	// TickerCh is an optional channel to use for ticking. If nil, time.NewTicker will be used.
+	TickerCh <-chan time.Time
+}
+
+// waitForServiceReadiness runs the service readiness command against a whole
+// batch of containers, retrying every monitor interval until it passes or the
+// same deadline as a container healthcheck passes
+func waitForServiceReadiness(ctx context.Context, input WaitForServiceReadinessInput) error {
+	if input.Client == nil {
+		return fmt.Errorf("client is required")
+	}
+
+	if input.Executor == nil {
+		return fmt.Errorf("executor is required")
+	}
+
+	tmpl, err := template.New("service-readiness-command").Parse(input.Command)
+	if err != nil {
+		return fmt.Errorf("error parsing service readiness command template: %v", err)
+	}
+
+	data := ServiceReadinessTemplateData{
+		ContainerIDs: input.ContainerIDs,
+		ServiceName:  input.ServiceName,
+	}
+	for _, containerID := range input.ContainerIDs {
+		containerIP, err := getContainerIP(ctx, input.Client, containerID)
+		if err != nil {
+			return fmt.Errorf("error getting container IP: %v", err)
+		}
+		data.ContainerIPs = append(data.ContainerIPs, containerIP)
+	}
+
+	var commandBuf bytes.Buffer
+	if err := tmpl.Execute(&commandBuf, data); err != nil {
+		return fmt.Errorf("error executing service readiness command template: %v", err)
+	}
+
+	if input.Monitor == 0 {
+		input.Monitor = 1 * time.Millisecond
+	}
+
+	maxWaitTime := input.Monitor*2 + input.StartPeriod
+	deadline := time.Now().Add(maxWaitTime)
+
+	tickerCh := input.TickerCh
+	var ticker *time.Ticker
+	if tickerCh == nil {
+		ticker = time.NewTicker(input.Monitor)
+		defer ticker.Stop()
+		tickerCh = ticker.C
+	}
+
+	var lastErr error
+	var lastOutput string
+	for {
+		output, _, err := executeHostScript(ctx, input.Executor, "service-readiness", commandBuf.String())
+		if err == nil {
+			return nil
+		}
+		lastErr, lastOutput = err, output
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tickerCh:
+			if time.Now().After(deadline) {
+				return &ErrorWithOutput{
+					Err:    fmt.Errorf("service readiness command failed after %v: %v", maxWaitTime, lastErr),
+					Output: strings.TrimSpace(lastOutput),
+				}
+			}
+		}
+	}
+}
+
+// serviceReadinessOnce returns a function that runs the service readiness
+// command a single time for a batch, however many of its containers wait on
+// the result. When started is set, the command waits for every container in
+// the batch to have been started first.
+func serviceReadinessOnce(ctx context.Context, input WaitForServiceReadinessInput, started *sync.WaitGroup) func() error {
+	return sync.OnceValue(func() error {
+		if started != nil {
+			started.Wait()
+		}
+		return waitForServiceReadiness(ctx, input)
+	})
+}
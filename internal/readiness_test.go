@@ -0,0 +1,132 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/josegonzalez/cli-skeleton/command"
+	"github.com/rs/zerolog"
+)
+
+func TestScaleUpContainersServiceReadiness(t *testing.T) {
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	mock := &mockDockerClient{
+		containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+			return []container.Summary{
+				{ID: "new1_container_id", Names: []string{"/new1"}, Created: 1},
+				{ID: "new2_container_id", Names: []string{"/new2"}, Created: 2},
+				{ID: "new3_container_id", Names: []string{"/new3"}, Created: 3},
+				{ID: "new4_container_id", Names: []string{"/new4"}, Created: 4},
+			}, nil
+		},
+		containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+			return container.InspectResponse{
+				ContainerJSONBase: &container.ContainerJSONBase{
+					State: &container.State{Running: true},
+				},
+				NetworkSettings: &container.NetworkSettings{
+					Networks: map[string]*network.EndpointSettings{"bridge": {IPAddress: "172.17.0.2"}},
+				},
+			}, nil
+		},
+	}
+
+	// newExecutor returns an executor recording every readiness probe and
+	// per-container healthcheck it runs
+	newExecutor := func(readinessExitCode int) (CommandExecutor, *[]string, *int) {
+		var mu sync.Mutex
+		probes := []string{}
+		healthchecks := 0
+		executor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			switch {
+			case strings.HasPrefix(filepath.Base(input.Command), "service-readiness-"):
+				script, err := os.ReadFile(input.Command)
+				if err != nil {
+					t.Fatalf("error reading readiness script: %v", err)
+				}
+				probes = append(probes, strings.TrimSpace(strings.TrimPrefix(string(script), "#!/usr/bin/env bash\n")))
+				if readinessExitCode != 0 {
+					return ExecCommandResponse{ExitCode: readinessExitCode}, fmt.Errorf("exit status %d", readinessExitCode)
+				}
+			case strings.HasPrefix(filepath.Base(input.Command), "healthcheck-"):
+				healthchecks++
+			}
+			return ExecCommandResponse{ExitCode: 0}, nil
+		}
+		return executor, &probes, &healthchecks
+	}
+
+	input := ScaleUpContainersInput{
+		Client:                  mock,
+		DesiredReplicas:         4,
+		ExistingContainers:      []container.Summary{},
+		HealthcheckCommand:      "curl {{.ContainerIP}}",
+		Logger:                  logger,
+		Parallelism:             2,
+		ProjectName:             "proj",
+		ServiceName:             "web",
+		ServiceReadinessCommand: "check {{.ServiceName}} {{range .ContainerIDs}}{{.}} {{end}}",
+		TickerCh:                testTickerCh(),
+	}
+
+	t.Run("runs once per batch", func(t *testing.T) {
+		executor, probes, healthchecks := newExecutor(0)
+		input.Executor = executor
+
+		if err := scaleUpContainers(context.Background(), input); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected := []string{
+			"check web new1_container_id new2_container_id",
+			"check web new3_container_id new4_container_id",
+		}
+		if len(*probes) != len(expected) {
+			t.Fatalf("expected one probe per batch, got %v", *probes)
+		}
+		for i := range expected {
+			if (*probes)[i] != expected[i] {
+				t.Errorf("expected probe %q, got %q", expected[i], (*probes)[i])
+			}
+		}
+		if *healthchecks != 0 {
+			t.Errorf("expected the per-container healthchecks to be skipped, got %d", *healthchecks)
+		}
+	})
+
+	t.Run("failure fails the whole batch", func(t *testing.T) {
+		executor, probes, _ := newExecutor(1)
+		input.Executor = executor
+		input.TickerCh = nil
+
+		err := scaleUpContainers(context.Background(), input)
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		if !strings.Contains(err.Error(), "service readiness command failed") {
+			t.Errorf("expected the readiness failure to be reported, got %v", err)
+		}
+		if len(*probes) == 0 {
+			t.Error("expected the readiness command to run")
+		}
+	})
+}
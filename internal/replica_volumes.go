@@ -0,0 +1,211 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/docker/api/types/container"
+)
+
+// servicePerReplicaVolume returns the `x-per-replica-volume` volume spec
+// template of the service, or an empty string when the service does not set
+// one. The template is rendered with each container's instance ID, so every
+// replica binds its own named volume.
+func servicePerReplicaVolume(service *types.ServiceConfig) (string, error) {
+	value, ok := service.Extensions["x-per-replica-volume"]
+	if !ok {
+		return "", nil
+	}
+
+	volumeTemplate, ok := value.(string)
+	if !ok || volumeTemplate == "" {
+		return "", fmt.Errorf("invalid x-per-replica-volume for service %s: expected a non-empty string", service.Name)
+	}
+
+	if _, err := template.New("per-replica-volume").Parse(volumeTemplate); err != nil {
+		return "", fmt.Errorf("invalid x-per-replica-volume for service %s: %v", service.Name, err)
+	}
+
+	if source, target, ok := strings.Cut(volumeTemplate, ":"); !ok || source == "" || target == "" {
+		return "", fmt.Errorf("invalid x-per-replica-volume for service %s: expected a source:target volume spec", service.Name)
+	}
+
+	return volumeTemplate, nil
+}
+
+// PerReplicaVolumeOverlayInput is the input for the perReplicaVolumeOverlay function
+type PerReplicaVolumeOverlayInput struct {
+	// InstanceID is the instance ID the volume is rendered for
+	InstanceID int
+	// Profiles are the active compose profiles
+	Profiles []string
+	// ProjectName is the name of the project
+	ProjectName string
+	// ServiceName is the name of the service
+	ServiceName string
+	// VolumeTemplate is the Go template for the volume spec
+	VolumeTemplate string
+}
+
+// perReplicaVolumeOverlay renders the volume spec for an instance and returns
+// the compose document binding it to the service. Named volumes are declared
+// at the top level so compose creates them; bind mounts are passed as-is. The
+// instance ID is stamped on the container, so a replacement can bind the same
+// volume.
+func perReplicaVolumeOverlay(input PerReplicaVolumeOverlayInput) (map[string]interface{}, error) {
+	tmpl, err := template.New("per-replica-volume").Parse(input.VolumeTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing per-replica volume template: %v", err)
+	}
+
+	var buf bytes.Buffer
+	data := containerNameTemplateData(input.ProjectName, input.ServiceName, input.Profiles, input.InstanceID)
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("error executing per-replica volume template: %v", err)
+	}
+	volumeSpec := buf.String()
+
+	document := map[string]interface{}{
+		"services": map[string]interface{}{
+			input.ServiceName: map[string]interface{}{
+				"labels":  map[string]string{ReplicaVolumeLabel: strconv.Itoa(input.InstanceID)},
+				"volumes": []string{volumeSpec},
+			},
+		},
+	}
+
+	source, _, _ := strings.Cut(volumeSpec, ":")
+	if !strings.HasPrefix(source, "/") && !strings.HasPrefix(source, ".") && !strings.HasPrefix(source, "~") {
+		document["volumes"] = map[string]interface{}{
+			source: map[string]interface{}{},
+		}
+	}
+
+	return document, nil
+}
+
+// replicaVolumeInstance returns the instance ID the per-replica volume of a
+// container was rendered for. Containers created before the instance ID was
+// stamped fall back to their compose container number.
+func replicaVolumeInstance(c container.Summary) (int, bool) {
+	for _, label := range []string{ReplicaVolumeLabel, "com.docker.compose.container-number"} {
+		if instanceID, err := strconv.Atoi(c.Labels[label]); err == nil && instanceID > 0 {
+			return instanceID, true
+		}
+	}
+	return 0, false
+}
+
+// replicaVolumeInstances returns the instance IDs to render the per-replica
+// volumes of count new containers for. New containers replacing old ones take
+// over the volumes of the containers they replace, in order, and the rest
+// take the lowest instance IDs whose volumes no existing container binds, so
+// a replica that was scaled away gets its volume back once scaled up again.
+func replicaVolumeInstances(existing []container.Summary, replaced []container.Summary, count int) []int {
+	used := map[int]bool{}
+	for _, c := range existing {
+		if instanceID, ok := replicaVolumeInstance(c); ok {
+			used[instanceID] = true
+		}
+	}
+
+	instances := []int{}
+	for _, c := range replaced {
+		if len(instances) == count {
+			break
+		}
+		if instanceID, ok := replicaVolumeInstance(c); ok {
+			instances = append(instances, instanceID)
+			used[instanceID] = true
+		}
+	}
+	for instanceID := 1; len(instances) < count; instanceID++ {
+		if !used[instanceID] {
+			instances = append(instances, instanceID)
+			used[instanceID] = true
+		}
+	}
+	return instances
+}
+
+// PerReplicaContainerInput is the input for the createPerReplicaContainer function
+type PerReplicaContainerInput struct {
+	// Args are the compose subcommand arguments creating the container
+	Args []string
+	// ComposeArgs are the compose invocation settings, without the per-replica overlay
+	ComposeArgs ComposeCommandArgsInput
+	// Executor is the command executor to use
+	Executor CommandExecutor
+	// Overlay is the per-replica volume overlay of the container
+	Overlay PerReplicaVolumeOverlayInput
+	// ProjectDir is the project directory
+	ProjectDir string
+}
+
+// createPerReplicaContainer runs a compose invocation creating a single
+// container with the per-replica volume overlay layered over the compose files
+func createPerReplicaContainer(ctx context.Context, input PerReplicaContainerInput) error {
+	document, err := perReplicaVolumeOverlay(input.Overlay)
+	if err != nil {
+		return err
+	}
+
+	overlayFile, err := writeComposeOverlayDocument(document)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(overlayFile)
+
+	composeArgs := input.ComposeArgs
+	composeArgs.OverlayFiles = append(slices.Clone(composeArgs.OverlayFiles), overlayFile)
+	return runComposeCommand(ctx, input.Executor, ExecCommandInput{
+		Command:          "docker",
+		Args:             composeCommandArgs(composeArgs, input.Args...),
+		WorkingDirectory: input.ProjectDir,
+	})
+}
+
+// createPerReplicaContainers creates the containers needed to reach the
+// desired replica count one at a time, each with an overlay binding the
+// volume rendered for its instance ID.
+func createPerReplicaContainers(ctx context.Context, input ScaleUpContainersInput, executor CommandExecutor) error {
+	volumeInstances := replicaVolumeInstances(input.ExistingContainers, input.ReplacedContainers, input.DesiredReplicas-input.CurrentReplicas)
+	for i, volumeInstance := range volumeInstances {
+		scale := input.CurrentReplicas + i + 1
+		input.Logger.Info(fmt.Sprintf("Creating container with per-replica volume: service=%s, instance=%d", input.ServiceName, volumeInstance))
+		// existing containers keep their volumes, so they must not be
+		// recreated from an overlay rendered for another instance
+		err := createPerReplicaContainer(ctx, PerReplicaContainerInput{
+			Args: []string{"create", "--scale", fmt.Sprintf("%s=%d", input.ServiceName, scale), "--no-recreate", input.ServiceName},
+			ComposeArgs: ComposeCommandArgsInput{
+				ComposeFile:              input.ComposeFile,
+				OverlayFiles:             input.OverlayFiles,
+				ProjectName:              input.ProjectName,
+				QuietPull:                input.QuietPull,
+				RecreateAnonymousVolumes: input.RecreateAnonymousVolumes,
+				SkipPull:                 input.SkipPull,
+			},
+			Executor: executor,
+			Overlay: PerReplicaVolumeOverlayInput{
+				InstanceID:     volumeInstance,
+				Profiles:       input.Profiles,
+				ProjectName:    input.ProjectName,
+				ServiceName:    input.ServiceName,
+				VolumeTemplate: input.PerReplicaVolume,
+			},
+			ProjectDir: input.ProjectDir,
+		})
+		if err != nil {
+			return fmt.Errorf("error creating container for instance %d: %v", volumeInstance, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,314 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/josegonzalez/cli-skeleton/command"
+	"github.com/rs/zerolog"
+)
+
+func TestServicePerReplicaVolume(t *testing.T) {
+	tests := []struct {
+		name       string
+		extensions types.Extensions
+		want       string
+		wantErr    string
+	}{
+		{name: "unset", want: ""},
+		{name: "named volume", extensions: types.Extensions{"x-per-replica-volume": "data-{{.InstanceID}}:/var/lib/data"}, want: "data-{{.InstanceID}}:/var/lib/data"},
+		{name: "not a string", extensions: types.Extensions{"x-per-replica-volume": 1}, wantErr: "expected a non-empty string"},
+		{name: "invalid template", extensions: types.Extensions{"x-per-replica-volume": "data-{{.InstanceID:/data"}, wantErr: "invalid x-per-replica-volume for service web"},
+		{name: "missing target", extensions: types.Extensions{"x-per-replica-volume": "data-{{.InstanceID}}"}, wantErr: "expected a source:target volume spec"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := servicePerReplicaVolume(&types.ServiceConfig{Name: "web", Extensions: tt.extensions})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPerReplicaVolumeOverlay(t *testing.T) {
+	t.Run("named volume is declared", func(t *testing.T) {
+		document, err := perReplicaVolumeOverlay(PerReplicaVolumeOverlayInput{
+			InstanceID:     3,
+			ProjectName:    "proj",
+			ServiceName:    "db",
+			VolumeTemplate: "data-{{.InstanceID}}:/var/lib/data",
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		data, _ := json.Marshal(document)
+		expected := `{"services":{"db":{"labels":{"com.dokku.orchestrate/replica-volume":"3"},"volumes":["data-3:/var/lib/data"]}},"volumes":{"data-3":{}}}`
+		if string(data) != expected {
+			t.Errorf("expected %s, got %s", expected, data)
+		}
+	})
+
+	t.Run("bind mount is not declared", func(t *testing.T) {
+		document, err := perReplicaVolumeOverlay(PerReplicaVolumeOverlayInput{
+			InstanceID:     2,
+			ProjectName:    "proj",
+			ServiceName:    "db",
+			VolumeTemplate: "/srv/{{.ServiceName}}-{{.InstanceID}}:/var/lib/data",
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if _, ok := document["volumes"]; ok {
+			t.Errorf("expected no top-level volumes for a bind mount, got %v", document["volumes"])
+		}
+		data, _ := json.Marshal(document)
+		if !strings.Contains(string(data), `"/srv/db-2:/var/lib/data"`) {
+			t.Errorf("expected the rendered bind mount, got %s", data)
+		}
+	})
+
+	t.Run("profile is rendered", func(t *testing.T) {
+		document, err := perReplicaVolumeOverlay(PerReplicaVolumeOverlayInput{
+			InstanceID:     1,
+			Profiles:       []string{"prod"},
+			ProjectName:    "proj",
+			ServiceName:    "db",
+			VolumeTemplate: "{{.Profile}}-data-{{.InstanceID}}:/var/lib/data",
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		data, _ := json.Marshal(document)
+		if !strings.Contains(string(data), `"prod-data-1:/var/lib/data"`) {
+			t.Errorf("expected the active profile in the volume, got %s", data)
+		}
+	})
+}
+
+// overlayVolumes returns the volumes the last compose file of an invocation
+// binds to the service, which is where the per-replica overlay is layered
+func overlayVolumes(t *testing.T, args []string, serviceName string) []string {
+	t.Helper()
+
+	overlayFile := ""
+	for i, arg := range args {
+		if arg == "-f" {
+			overlayFile = args[i+1]
+		}
+	}
+	data, err := os.ReadFile(overlayFile)
+	if err != nil {
+		t.Fatalf("error reading overlay: %v", err)
+	}
+	var document struct {
+		Services map[string]struct {
+			Volumes []string `json:"volumes"`
+		} `json:"services"`
+	}
+	if err := json.Unmarshal(data, &document); err != nil {
+		t.Fatalf("error parsing overlay: %v", err)
+	}
+	return document.Services[serviceName].Volumes
+}
+
+func TestScaleUpContainersPerReplicaVolume(t *testing.T) {
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	containers := []container.Summary{
+		{ID: "existing_container_id", Created: 100, Labels: map[string]string{"com.docker.compose.container-number": "1"}, Names: []string{"/db-1"}},
+	}
+	mock := &mockDockerClient{
+		containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+			return slices.Clone(containers), nil
+		},
+		containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+			return container.InspectResponse{
+				ContainerJSONBase: &container.ContainerJSONBase{
+					State: &container.State{Running: true},
+				},
+			}, nil
+		},
+	}
+
+	volumesByScale := map[string][]string{}
+	executor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+		scaleIndex := slices.Index(input.Args, "--scale")
+		if scaleIndex == -1 {
+			t.Fatalf("expected a --scale argument, got %v", input.Args)
+		}
+		if !slices.Contains(input.Args, "--no-recreate") {
+			t.Errorf("expected existing containers to be left alone, got %v", input.Args)
+		}
+
+		volumesByScale[input.Args[scaleIndex+1]] = overlayVolumes(t, input.Args, "db")
+		containers = append(containers, container.Summary{
+			ID:      fmt.Sprintf("new%d_container_id", len(containers)),
+			Created: int64(100 + len(containers)),
+		})
+		return ExecCommandResponse{ExitCode: 0}, nil
+	}
+
+	err := scaleUpContainers(context.Background(), ScaleUpContainersInput{
+		Client:             mock,
+		ComposeFile:        "/tmp/docker-compose.yaml",
+		CurrentReplicas:    1,
+		DesiredReplicas:    3,
+		Executor:           executor,
+		ExistingContainers: slices.Clone(containers),
+		Logger:             logger,
+		Parallelism:        1,
+		PerReplicaVolume:   "data-{{.InstanceID}}:/var/lib/data",
+		ProjectName:        "proj",
+		ServiceName:        "db",
+		TickerCh:           testTickerCh(),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(volumesByScale) != 2 {
+		t.Fatalf("expected one create per new replica, got %v", volumesByScale)
+	}
+	for instanceID := 2; instanceID <= 3; instanceID++ {
+		expected := []string{fmt.Sprintf("data-%d:/var/lib/data", instanceID)}
+		if got := volumesByScale[fmt.Sprintf("db=%d", instanceID)]; !slices.Equal(got, expected) {
+			t.Errorf("expected instance %d to get %v, got %v", instanceID, expected, got)
+		}
+	}
+}
+
+func TestRollingUpdatePerReplicaVolume(t *testing.T) {
+	var buf bytes.Buffer
+	writer := zerolog.SyncWriter(&buf)
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(writer).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(writer).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	for _, order := range []string{"start-first", "stop-first"} {
+		t.Run(order, func(t *testing.T) {
+			// the old containers were created across earlier deploys, so
+			// their volumes no longer follow their creation order
+			batch := []container.Summary{
+				{ID: "old1_container_id", Created: 50, Labels: map[string]string{ReplicaVolumeLabel: "2"}, State: container.StateRunning},
+				{ID: "old2_container_id", Created: 60, Labels: map[string]string{ReplicaVolumeLabel: "5"}, State: container.StateRunning},
+			}
+			// the batch goroutines and the health cache refresh share the
+			// containers and volumes
+			var mu sync.Mutex
+			containers := slices.Clone(batch)
+			mock := &mockDockerClient{
+				containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+					mu.Lock()
+					defer mu.Unlock()
+					return slices.Clone(containers), nil
+				},
+				containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+					return container.InspectResponse{
+						ContainerJSONBase: &container.ContainerJSONBase{
+							State: &container.State{Running: true},
+						},
+					}, nil
+				},
+				containerTerminate: func(ctx context.Context, id string, stopTimeout time.Duration) error {
+					mu.Lock()
+					defer mu.Unlock()
+					containers = slices.DeleteFunc(containers, func(c container.Summary) bool { return c.ID == id })
+					return nil
+				},
+			}
+
+			volumes := []string{}
+			executor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+				if !slices.Contains(input.Args, "up") {
+					return ExecCommandResponse{ExitCode: 0}, nil
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				volumes = append(volumes, overlayVolumes(t, input.Args, "db")...)
+				containers = append(containers, container.Summary{
+					ID:      fmt.Sprintf("new%d_container_id", len(volumes)),
+					Created: int64(100 + len(volumes)),
+					State:   container.StateRunning,
+				})
+				return ExecCommandResponse{ExitCode: 0}, nil
+			}
+
+			_, err := rollingUpdateContainers(context.Background(), RollingUpdateInput{
+				Client:             mock,
+				ContainersToUpdate: batch,
+				Executor:           executor,
+				Logger:             logger,
+				Order:              order,
+				Parallelism:        2,
+				PerReplicaVolume:   "data-{{.InstanceID}}:/var/lib/data",
+				ProjectName:        "proj",
+				ServiceName:        "db",
+				TickerCh:           testTickerCh(),
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			slices.Sort(volumes)
+			expected := []string{"data-2:/var/lib/data", "data-5:/var/lib/data"}
+			if !slices.Equal(volumes, expected) {
+				t.Errorf("expected the replacements to bind the volumes of the old containers %v, got %v", expected, volumes)
+			}
+		})
+	}
+}
+
+func TestReplicaVolumeInstances(t *testing.T) {
+	labelled := func(id string, instanceID string) container.Summary {
+		return container.Summary{ID: id, Labels: map[string]string{ReplicaVolumeLabel: instanceID}}
+	}
+
+	t.Run("scale up fills the gaps", func(t *testing.T) {
+		existing := []container.Summary{labelled("a", "2"), labelled("b", "3")}
+		if got := replicaVolumeInstances(existing, nil, 2); !slices.Equal(got, []int{1, 4}) {
+			t.Errorf("expected [1 4], got %v", got)
+		}
+	})
+
+	t.Run("prepared containers take over the replaced volumes", func(t *testing.T) {
+		replaced := []container.Summary{labelled("a", "3"), labelled("b", "1")}
+		if got := replicaVolumeInstances(replaced, replaced, 3); !slices.Equal(got, []int{3, 1, 2}) {
+			t.Errorf("expected [3 1 2], got %v", got)
+		}
+	})
+}
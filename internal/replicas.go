@@ -0,0 +1,126 @@
+package internal
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"go.yaml.in/yaml/v4"
+)
+
+// LoadReplicasFile reads a JSON or YAML file mapping service names to
+// replica counts, such as one maintained by an external autoscaler
+func LoadReplicasFile(path string) (map[string]int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading replicas file: %v", err)
+	}
+
+	// JSON is valid YAML, so a single parser handles both formats
+	replicas := map[string]int{}
+	if err := yaml.Unmarshal(data, &replicas); err != nil {
+		return nil, fmt.Errorf("error parsing replicas file %s: %v", path, err)
+	}
+
+	for _, serviceName := range slices.Sorted(maps.Keys(replicas)) {
+		if replicas[serviceName] < 0 {
+			return nil, fmt.Errorf("invalid replica count for service %s in replicas file %s: %d", serviceName, path, replicas[serviceName])
+		}
+	}
+
+	return replicas, nil
+}
+
+// labelReplicas reads the desired replica count of a service off a label of
+// its existing containers, such as one maintained by an external controller.
+// The oldest container carrying the label is used. The second return value is
+// false when no container carries a usable count, in which case the caller
+// falls back to its next source.
+func labelReplicas(ctx context.Context, input DeployServiceInput) (int, bool) {
+	containers, err := composeContainers(ComposeContainersInput{
+		Client:       input.Client,
+		ProjectLabel: input.ProjectLabel,
+		ProjectName:  input.ProjectName,
+		ServiceName:  input.ServiceName,
+	})
+	if err != nil {
+		warnReplicaLabel(input, fmt.Sprintf("Unable to read replica count label: service=%s, label=%s, error=%v", input.ServiceName, input.ReplicasFromLabel, err))
+		return 0, false
+	}
+
+	slices.SortStableFunc(containers, func(a, b container.Summary) int {
+		return cmp.Compare(a.Created, b.Created)
+	})
+	for _, c := range containers {
+		inspect, err := input.Client.ContainerInspect(ctx, c.ID)
+		if err != nil {
+			warnReplicaLabel(input, fmt.Sprintf("Unable to read replica count label: service=%s, label=%s, error=%v", input.ServiceName, input.ReplicasFromLabel, err))
+			return 0, false
+		}
+		if inspect.Config == nil {
+			continue
+		}
+
+		value, ok := inspect.Config.Labels[input.ReplicasFromLabel]
+		if !ok {
+			continue
+		}
+
+		replicas, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || replicas < 0 {
+			warnReplicaLabel(input, fmt.Sprintf("Invalid replica count label, ignoring: service=%s, label=%s, value=%q", input.ServiceName, input.ReplicasFromLabel, value))
+			return 0, false
+		}
+		return replicas, true
+	}
+
+	if input.Logger != nil {
+		input.Logger.Info(fmt.Sprintf("Replica count label not found, ignoring: service=%s, label=%s", input.ServiceName, input.ReplicasFromLabel))
+	}
+	return 0, false
+}
+
+// warnReplicaLabel logs why the replica count label was not used
+func warnReplicaLabel(input DeployServiceInput, message string) {
+	input.Warnings.Warn(input.Logger, input.ServiceName, message)
+}
+
+// ParseReplicasDelta parses a relative replica count, such as `+2` or `-1`
+func ParseReplicasDelta(value string) (int, error) {
+	if !strings.HasPrefix(value, "+") && !strings.HasPrefix(value, "-") {
+		return 0, fmt.Errorf("invalid replicas delta %q: expected a signed number such as +2 or -1", value)
+	}
+
+	delta, err := strconv.Atoi(value)
+	if err != nil || delta == 0 {
+		return 0, fmt.Errorf("invalid replicas delta %q: expected a signed number such as +2 or -1", value)
+	}
+	return delta, nil
+}
+
+// deltaReplicas returns the replica count of a service adjusted by the
+// replicas delta from the number of its running containers, clamped at zero
+func deltaReplicas(input DeployServiceInput) (int, error) {
+	containers, err := composeContainers(ComposeContainersInput{
+		Client:       input.Client,
+		ProjectLabel: input.ProjectLabel,
+		ProjectName:  input.ProjectName,
+		ServiceName:  input.ServiceName,
+		Status:       "running",
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error getting running containers: %v", err)
+	}
+
+	replicas := max(len(containers)+input.ReplicasDelta, 0)
+	if input.Logger != nil {
+		input.Logger.Info(fmt.Sprintf("Scaling relative to running containers: service=%s, running=%d, delta=%+d, replicas=%d", input.ServiceName, len(containers), input.ReplicasDelta, replicas))
+	}
+	return replicas, nil
+}
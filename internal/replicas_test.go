@@ -0,0 +1,288 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/josegonzalez/cli-skeleton/command"
+	"github.com/rs/zerolog"
+)
+
+func TestLoadReplicasFile(t *testing.T) {
+	tests := []struct {
+		name          string
+		contents      string
+		expected      map[string]int
+		expectedError string
+	}{
+		{
+			name:     "json",
+			contents: `{"web": 4, "worker": 0}`,
+			expected: map[string]int{"web": 4, "worker": 0},
+		},
+		{
+			name:     "yaml",
+			contents: "web: 4\nworker: 2\n",
+			expected: map[string]int{"web": 4, "worker": 2},
+		},
+		{
+			name:          "negative count",
+			contents:      "web: -1\n",
+			expectedError: "invalid replica count for service web in replicas file",
+		},
+		{
+			name:          "not a mapping of counts",
+			contents:      "web: many\n",
+			expectedError: "error parsing replicas file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "replicas")
+			if err := os.WriteFile(path, []byte(tt.contents), 0644); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			replicas, err := LoadReplicasFile(path)
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(replicas) != len(tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, replicas)
+			}
+			for service, count := range tt.expected {
+				if replicas[service] != count {
+					t.Errorf("expected %d replicas for %s, got %d", count, service, replicas[service])
+				}
+			}
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := LoadReplicasFile(filepath.Join(t.TempDir(), "missing.yaml"))
+		if err == nil || !strings.HasPrefix(err.Error(), "error reading replicas file:") {
+			t.Errorf("expected a read error, got %v", err)
+		}
+	})
+}
+
+func TestResolveDeployParamsReplicasFile(t *testing.T) {
+	replicasFile := filepath.Join(t.TempDir(), "replicas.json")
+	if err := os.WriteFile(replicasFile, []byte(`{"web": 6}`), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	deployReplicas := 3
+	tests := []struct {
+		name        string
+		service     string
+		replicas    int
+		replicasMax int
+		expected    int
+	}{
+		{name: "file overrides the compose file", service: "web", expected: 6},
+		{name: "service absent from the file keeps the compose count", service: "worker", expected: 3},
+		{name: "explicit replicas override the file", service: "web", replicas: 2, expected: 2},
+		{name: "file count is still clamped", service: "web", replicasMax: 5, expected: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &types.ServiceConfig{
+				Name:   tt.service,
+				Deploy: &types.DeployConfig{Replicas: &deployReplicas},
+			}
+
+			params, err := resolveDeployParams(context.Background(), DeployServiceInput{
+				Replicas:     tt.replicas,
+				ReplicasFile: replicasFile,
+				ReplicasMax:  tt.replicasMax,
+				ServiceName:  tt.service,
+			}, service)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if params.Replicas != tt.expected {
+				t.Errorf("expected %d replicas, got %d", tt.expected, params.Replicas)
+			}
+		})
+	}
+
+	t.Run("unreadable file", func(t *testing.T) {
+		_, err := resolveDeployParams(context.Background(), DeployServiceInput{
+			ReplicasFile: filepath.Join(t.TempDir(), "missing.json"),
+			ServiceName:  "web",
+		}, &types.ServiceConfig{Name: "web"})
+		if err == nil {
+			t.Fatal("expected error, got nil")
+		}
+	})
+}
+
+func TestResolveDeployParamsReplicasFromLabel(t *testing.T) {
+	deployReplicas := 2
+
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	// newClient returns a client whose web containers carry the given
+	// labels, oldest first
+	newClient := func(labels ...map[string]string) *mockDockerClient {
+		return &mockDockerClient{
+			containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+				containers := []container.Summary{}
+				for i := len(labels) - 1; i >= 0; i-- {
+					containers = append(containers, container.Summary{ID: fmt.Sprintf("web%d_container_id", i), Created: int64(100 + i)})
+				}
+				return containers, nil
+			},
+			containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+				var i int
+				if _, err := fmt.Sscanf(id, "web%d_container_id", &i); err != nil {
+					t.Fatalf("unexpected container %s", id)
+				}
+				return container.InspectResponse{Config: &container.Config{Labels: labels[i]}}, nil
+			},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		client   *mockDockerClient
+		replicas int
+		expected int
+		wantLog  string
+	}{
+		{
+			name:     "valid label on the oldest container",
+			client:   newClient(map[string]string{"com.acme.desired": "4"}, map[string]string{"com.acme.desired": "7"}),
+			expected: 4,
+		},
+		{
+			name:     "label only on a later container",
+			client:   newClient(map[string]string{}, map[string]string{"com.acme.desired": "3"}),
+			expected: 3,
+		},
+		{
+			name:     "invalid label falls back to the compose file",
+			client:   newClient(map[string]string{"com.acme.desired": "lots"}),
+			expected: 2,
+			wantLog:  `Invalid replica count label, ignoring: service=web, label=com.acme.desired, value=\"lots\"`,
+		},
+		{
+			name:     "missing label falls back to the compose file",
+			client:   newClient(map[string]string{"other": "1"}),
+			expected: 2,
+			wantLog:  "Replica count label not found, ignoring: service=web, label=com.acme.desired",
+		},
+		{
+			name:     "explicit replicas take precedence",
+			client:   newClient(map[string]string{"com.acme.desired": "4"}),
+			replicas: 5,
+			expected: 5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			params, err := resolveDeployParams(context.Background(), DeployServiceInput{
+				Client:            tt.client,
+				Logger:            logger,
+				ProjectName:       "test",
+				Replicas:          tt.replicas,
+				ReplicasFromLabel: "com.acme.desired",
+				ServiceName:       "web",
+			}, &types.ServiceConfig{
+				Name:   "web",
+				Deploy: &types.DeployConfig{Replicas: &deployReplicas},
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if params.Replicas != tt.expected {
+				t.Errorf("expected %d replicas, got %d", tt.expected, params.Replicas)
+			}
+			if tt.wantLog != "" && !strings.Contains(buf.String(), tt.wantLog) {
+				t.Errorf("expected log %q, got %s", tt.wantLog, buf.String())
+			}
+		})
+	}
+}
+
+func TestResolveDeployParamsReplicasDelta(t *testing.T) {
+	deployReplicas := 2
+	client := &mockDockerClient{
+		containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+			if !options.Filters.ExactMatch("status", "running") {
+				t.Errorf("expected only running containers to be counted, got filters %v", options.Filters)
+			}
+			return []container.Summary{
+				{ID: "web1_container_id", State: container.StateRunning},
+				{ID: "web2_container_id", State: container.StateRunning},
+				{ID: "web3_container_id", State: container.StateRunning},
+			}, nil
+		},
+	}
+
+	tests := []struct {
+		name     string
+		delta    string
+		expected int
+	}{
+		{name: "increment", delta: "+2", expected: 5},
+		{name: "decrement", delta: "-1", expected: 2},
+		{name: "decrement clamped at zero", delta: "-5", expected: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delta, err := ParseReplicasDelta(tt.delta)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			params, err := resolveDeployParams(context.Background(), DeployServiceInput{
+				Client:        client,
+				ProjectName:   "test",
+				ReplicasDelta: delta,
+				ServiceName:   "web",
+			}, &types.ServiceConfig{
+				Name:   "web",
+				Deploy: &types.DeployConfig{Replicas: &deployReplicas},
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if params.Replicas != tt.expected {
+				t.Errorf("expected %d replicas, got %d", tt.expected, params.Replicas)
+			}
+		})
+	}
+
+	for _, value := range []string{"2", "+0", "+two", ""} {
+		if _, err := ParseReplicasDelta(value); err == nil {
+			t.Errorf("expected %q to be rejected", value)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package internal
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// RollbackImageLabel is the label pinning the known-good image a service is
+// rolled back to. It is carried over onto the new containers of every deploy
+// until a different image is pinned.
+const RollbackImageLabel = "com.dokku.orchestrate/rollback-image"
+
+// RollbackServiceInput is the input for the RollbackService function
+type RollbackServiceInput struct {
+	// DeployID is the recorded deploy to roll the service back to. If empty, the service is rolled back to its pinned rollback image, or failing that, to its previous deploy.
+	DeployID string
+	// DeployServiceInput is the input used to re-deploy the service. Its image and replicas are replaced by the recorded ones.
+	DeployServiceInput DeployServiceInput
+}
+
+// rollbackTarget is the image and replica count a service is rolled back to
+type rollbackTarget struct {
+	// DeployID is the recorded deploy rolled back to, empty for a pinned image
+	DeployID string
+	// Image is the image to deploy
+	Image string
+	// Pinned is whether the image is the pinned rollback image
+	Pinned bool
+	// Replicas is the number of containers to deploy
+	Replicas int
+	// Revision is the source revision of the recorded deploy
+	Revision string
+}
+
+// RollbackService re-deploys a service with the image and replica count
+// recorded in the history for a past deploy, or with its pinned rollback
+// image
+func RollbackService(ctx context.Context, input RollbackServiceInput) error {
+	deployInput := input.DeployServiceInput
+	if deployInput.History == nil {
+		return fmt.Errorf("deploy history is required")
+	}
+
+	target, err := selectRollbackTarget(ctx, input)
+	if err != nil {
+		return err
+	}
+
+	deployInput.Image = target.Image
+	deployInput.Replicas = target.Replicas
+	deployInput.Revision = target.Revision
+	if target.Pinned {
+		deployInput.Logger.Info(fmt.Sprintf("Rolling back service to pinned image: service=%s, image=%s, replicas=%d", deployInput.ServiceName, deployInput.Image, deployInput.Replicas))
+		return DeployService(ctx, deployInput)
+	}
+
+	deployInput.AllowZero = target.Replicas == 0
+	deployInput.Logger.Info(fmt.Sprintf("Rolling back service: service=%s, deploy_id=%s, image=%s, replicas=%d", deployInput.ServiceName, target.DeployID, deployInput.Image, deployInput.Replicas))
+	return DeployService(ctx, deployInput)
+}
+
+// selectRollbackTarget returns what a service is rolled back to: the given
+// recorded deploy, or else the pinned rollback image, or else the deploy
+// before the most recent one
+func selectRollbackTarget(ctx context.Context, input RollbackServiceInput) (rollbackTarget, error) {
+	deployInput := input.DeployServiceInput
+	if input.DeployID != "" {
+		record, err := findHistoryRecord(deployInput.History, deployInput.ProjectName, deployInput.ServiceName, input.DeployID)
+		if err != nil {
+			return rollbackTarget{}, err
+		}
+		return recordRollbackTarget(record), nil
+	}
+
+	pinnedImage, replicas, err := pinnedRollbackImage(ctx, deployInput)
+	if err != nil {
+		return rollbackTarget{}, err
+	}
+	if pinnedImage != "" {
+		return rollbackTarget{Image: pinnedImage, Pinned: true, Replicas: replicas}, nil
+	}
+
+	record, err := previousHistoryRecord(deployInput.History, deployInput.ProjectName, deployInput.ServiceName)
+	if err != nil {
+		return rollbackTarget{}, err
+	}
+	return recordRollbackTarget(record), nil
+}
+
+// recordRollbackTarget returns the rollback target of a recorded deploy
+func recordRollbackTarget(record HistoryRecord) rollbackTarget {
+	// The image ID pins the exact image that was running, even if the
+	// recorded tag has since been moved to a newer image
+	image := record.Image
+	if record.ImageID != "" {
+		image = record.ImageID
+	}
+	return rollbackTarget{
+		DeployID: record.DeployID,
+		Image:    image,
+		Replicas: record.Replicas,
+		Revision: record.Revision,
+	}
+}
+
+// pinnedRollbackImage returns the rollback image pinned on the newest running
+// container of a service, along with the number of running containers. The
+// image is empty when no container carries a pin.
+func pinnedRollbackImage(ctx context.Context, input DeployServiceInput) (string, int, error) {
+	containers, err := composeContainers(ComposeContainersInput{
+		Client:       input.Client,
+		ProjectLabel: input.ProjectLabel,
+		ProjectName:  input.ProjectName,
+		ServiceName:  input.ServiceName,
+		Status:       "running",
+	})
+	if err != nil {
+		return "", 0, fmt.Errorf("error reading pinned rollback image: %v", err)
+	}
+
+	slices.SortStableFunc(containers, func(a, b container.Summary) int {
+		return cmp.Compare(b.Created, a.Created)
+	})
+	for _, c := range containers {
+		if image := c.Labels[RollbackImageLabel]; image != "" {
+			return image, len(containers), nil
+		}
+	}
+	return "", len(containers), nil
+}
+
+// previousHistoryRecord returns the recorded deploy of a service before its
+// most recent one
+func previousHistoryRecord(history *DeployHistory, projectName string, serviceName string) (HistoryRecord, error) {
+	records, err := history.Records(serviceName)
+	if err != nil {
+		return HistoryRecord{}, err
+	}
+
+	records = slices.DeleteFunc(records, func(record HistoryRecord) bool {
+		return record.Project != projectName
+	})
+	if len(records) < 2 {
+		return HistoryRecord{}, fmt.Errorf("no previous deploy of service %s in history to roll back to", serviceName)
+	}
+
+	record := records[len(records)-2]
+	if record.Image == "" && record.ImageID == "" {
+		return HistoryRecord{}, fmt.Errorf("deploy %s of service %s has no recorded image", record.DeployID, serviceName)
+	}
+	return record, nil
+}
+
+// findHistoryRecord returns the recorded deploy of a service with the given deploy ID
+func findHistoryRecord(history *DeployHistory, projectName string, serviceName string, deployID string) (HistoryRecord, error) {
+	if deployID == "" {
+		return HistoryRecord{}, fmt.Errorf("deploy id is required")
+	}
+
+	records, err := history.Records(serviceName)
+	if err != nil {
+		return HistoryRecord{}, err
+	}
+
+	for _, record := range records {
+		if record.DeployID == deployID && record.Project == projectName {
+			if record.Image == "" && record.ImageID == "" {
+				return HistoryRecord{}, fmt.Errorf("deploy %s of service %s has no recorded image", deployID, serviceName)
+			}
+			return record, nil
+		}
+	}
+
+	return HistoryRecord{}, fmt.Errorf("deploy %s not found in history for service %s", deployID, serviceName)
+}
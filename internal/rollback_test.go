@@ -0,0 +1,271 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/josegonzalez/cli-skeleton/command"
+	"github.com/rs/zerolog"
+)
+
+func TestRollbackService(t *testing.T) {
+	newHistory := func(t *testing.T) *DeployHistory {
+		history := NewDeployHistory(HistoryFile(t.TempDir()))
+		records := []HistoryRecord{
+			{DeployID: "old", Image: "example/web:latest", ImageID: "sha256:old", Project: "test", Replicas: 2, Revision: "0123abcd", Service: "web"},
+			{DeployID: "old", Image: "example/worker:latest", ImageID: "sha256:worker", Project: "test", Replicas: 1, Service: "worker"},
+			{DeployID: "new", Image: "example/web:latest", ImageID: "sha256:new", Project: "test", Replicas: 4, Service: "web"},
+		}
+		for _, record := range records {
+			if err := history.Append(record); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		return history
+	}
+
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	project := &types.Project{
+		Services: types.Services{
+			"web": types.ServiceConfig{
+				Name:  "web",
+				Image: "example/web:latest",
+				Deploy: &types.DeployConfig{
+					UpdateConfig: &types.UpdateConfig{
+						Monitor: types.Duration(time.Millisecond),
+					},
+				},
+			},
+		},
+	}
+
+	t.Run("rolls back to the recorded image and replicas", func(t *testing.T) {
+		history := newHistory(t)
+
+		created := []container.Summary{}
+		running := []container.Summary{}
+		mockClient := &mockDockerClient{
+			containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+				if slices.Contains(options.Filters.Get("status"), "running") {
+					return slices.Clone(running), nil
+				}
+				return slices.Clone(created), nil
+			},
+			containerStart: func(ctx context.Context, id string, options container.StartOptions) error {
+				running = append(running, created...)
+				created = []container.Summary{}
+				return nil
+			},
+			containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+				return container.InspectResponse{
+					ContainerJSONBase: &container.ContainerJSONBase{
+						Name:  "/web",
+						State: &container.State{Running: true},
+					},
+				}, nil
+			},
+		}
+
+		var overlay map[string]map[string]map[string]interface{}
+		scaleArg := ""
+		mockExecutor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+			if !slices.Contains(input.Args, "create") {
+				return ExecCommandResponse{ExitCode: 0}, nil
+			}
+
+			scaleArg = input.Args[slices.Index(input.Args, "--scale")+1]
+			for i := range 2 {
+				created = append(created, container.Summary{ID: fmt.Sprintf("new%d_container_id", i), Created: 100, ImageID: "sha256:old"})
+			}
+
+			index := slices.Index(input.Args, "/tmp/docker-compose.yaml")
+			contents, err := os.ReadFile(input.Args[index+2])
+			if err != nil {
+				t.Fatalf("unexpected error reading overlay: %v", err)
+			}
+			if err := json.Unmarshal(contents, &overlay); err != nil {
+				t.Fatalf("unexpected error parsing overlay: %v", err)
+			}
+			return ExecCommandResponse{ExitCode: 0}, nil
+		}
+
+		err := RollbackService(context.Background(), RollbackServiceInput{
+			DeployID: "old",
+			DeployServiceInput: DeployServiceInput{
+				Client:                mockClient,
+				ComposeFile:           "/tmp/docker-compose.yaml",
+				ContainerNameTemplate: "{{.ServiceName}}-{{.InstanceID}}",
+				DeployID:              "rollback",
+				Executor:              mockExecutor,
+				HealthStartPeriod:     time.Second,
+				History:               history,
+				Logger:                logger,
+				Project:               project,
+				ProjectName:           "test",
+				ServiceName:           "web",
+			},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if image := overlay["services"]["web"]["image"]; image != "sha256:old" {
+			t.Errorf("expected the recorded image sha256:old to be deployed, got %v", image)
+		}
+		if scaleArg != "web=2" {
+			t.Errorf("expected the recorded 2 replicas to be deployed, got %s", scaleArg)
+		}
+
+		records, err := history.Records("web")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		last := records[len(records)-1]
+		if last.DeployID != "rollback" || last.Image != "sha256:old" || last.Replicas != 2 || last.Revision != "0123abcd" {
+			t.Errorf("expected the rollback to be recorded, got %+v", last)
+		}
+	})
+
+	t.Run("unknown deploy id", func(t *testing.T) {
+		err := RollbackService(context.Background(), RollbackServiceInput{
+			DeployID: "missing",
+			DeployServiceInput: DeployServiceInput{
+				History:     newHistory(t),
+				Logger:      logger,
+				Project:     project,
+				ProjectName: "test",
+				ServiceName: "web",
+			},
+		})
+		if err == nil || err.Error() != "deploy missing not found in history for service web" {
+			t.Errorf("expected a missing deploy error, got %v", err)
+		}
+	})
+
+	t.Run("deploy id of another service", func(t *testing.T) {
+		history := NewDeployHistory(HistoryFile(t.TempDir()))
+		if err := history.Append(HistoryRecord{DeployID: "worker-only", Image: "example/worker:1", Project: "test", Replicas: 1, Service: "worker"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		err := RollbackService(context.Background(), RollbackServiceInput{
+			DeployID: "worker-only",
+			DeployServiceInput: DeployServiceInput{
+				History:     history,
+				Logger:      logger,
+				Project:     project,
+				ProjectName: "test",
+				ServiceName: "web",
+			},
+		})
+		if err == nil || err.Error() != "deploy worker-only not found in history for service web" {
+			t.Errorf("expected a missing deploy error, got %v", err)
+		}
+	})
+}
+
+func TestSelectRollbackTarget(t *testing.T) {
+	history := NewDeployHistory(HistoryFile(t.TempDir()))
+	records := []HistoryRecord{
+		{DeployID: "first", Image: "example/web:1", ImageID: "sha256:first", Project: "test", Replicas: 2, Revision: "aaaa", Service: "web"},
+		{DeployID: "second", Image: "example/web:2", ImageID: "sha256:second", Project: "test", Replicas: 3, Revision: "bbbb", Service: "web"},
+		{DeployID: "third", Image: "example/web:3", ImageID: "sha256:third", Project: "test", Replicas: 3, Revision: "cccc", Service: "web"},
+	}
+	for _, record := range records {
+		if err := history.Append(record); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	running := func(labels ...map[string]string) *mockDockerClient {
+		return &mockDockerClient{
+			containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+				if !slices.Contains(options.Filters.Get("status"), "running") {
+					t.Errorf("expected only running containers to be listed")
+				}
+				containers := []container.Summary{}
+				for i, containerLabels := range labels {
+					containers = append(containers, container.Summary{ID: fmt.Sprintf("web%d_container_id", i), Created: int64(100 + i), Labels: containerLabels})
+				}
+				return containers, nil
+			},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		client   *mockDockerClient
+		deployID string
+		expected rollbackTarget
+	}{
+		{
+			name: "pin present",
+			client: running(
+				map[string]string{RollbackImageLabel: "example/web:1"},
+				map[string]string{RollbackImageLabel: "example/web:known-good"},
+			),
+			expected: rollbackTarget{Image: "example/web:known-good", Pinned: true, Replicas: 2},
+		},
+		{
+			name:     "pin absent",
+			client:   running(map[string]string{}, nil),
+			expected: rollbackTarget{DeployID: "second", Image: "sha256:second", Replicas: 3, Revision: "bbbb"},
+		},
+		{
+			name:     "deploy id preferred over the pin",
+			client:   running(map[string]string{RollbackImageLabel: "example/web:known-good"}),
+			deployID: "first",
+			expected: rollbackTarget{DeployID: "first", Image: "sha256:first", Replicas: 2, Revision: "aaaa"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, err := selectRollbackTarget(context.Background(), RollbackServiceInput{
+				DeployID: tt.deployID,
+				DeployServiceInput: DeployServiceInput{
+					Client:      tt.client,
+					History:     history,
+					ProjectName: "test",
+					ServiceName: "web",
+				},
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if target != tt.expected {
+				t.Errorf("expected rollback target %+v, got %+v", tt.expected, target)
+			}
+		})
+	}
+
+	t.Run("no previous deploy", func(t *testing.T) {
+		_, err := selectRollbackTarget(context.Background(), RollbackServiceInput{
+			DeployServiceInput: DeployServiceInput{
+				Client:      running(),
+				History:     history,
+				ProjectName: "other",
+				ServiceName: "web",
+			},
+		})
+		if err == nil || err.Error() != "no previous deploy of service web in history to roll back to" {
+			t.Errorf("expected a missing previous deploy error, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,130 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// scriptDirPrefix is the prefix of the temporary directories host scripts
+// are written to
+const scriptDirPrefix = "docker-orchestrate-scripts-"
+
+// StaleScriptDirAge is how old a script directory left behind by an earlier
+// run must be before it is swept
+const StaleScriptDirAge = time.Hour
+
+var (
+	// scriptDirPath is the script directory of the current run, if created
+	scriptDirPath string
+	// scriptDirMu guards scriptDirPath
+	scriptDirMu sync.Mutex
+)
+
+// scriptDir returns the temporary directory the host scripts of the current
+// run are written to, creating it on first use. Scripts left behind when
+// the process is killed are swept along with the directory on a later run.
+func scriptDir() (string, error) {
+	scriptDirMu.Lock()
+	defer scriptDirMu.Unlock()
+
+	// a later run may have swept the directory as stale, so it is created
+	// again rather than written into once it is gone
+	if scriptDirPath != "" {
+		if _, err := os.Stat(scriptDirPath); err == nil {
+			return scriptDirPath, nil
+		}
+	}
+
+	// the process ID lets a later run tell whether the directory is still
+	// in use before sweeping it
+	dir, err := os.MkdirTemp("", fmt.Sprintf("%s%d-*", scriptDirPrefix, os.Getpid()))
+	if err != nil {
+		return "", fmt.Errorf("error creating script directory: %v", err)
+	}
+	scriptDirPath = dir
+	return scriptDirPath, nil
+}
+
+// RemoveScriptDir removes the script directory of the current run, if it
+// was created
+func RemoveScriptDir() error {
+	scriptDirMu.Lock()
+	defer scriptDirMu.Unlock()
+
+	if scriptDirPath == "" {
+		return nil
+	}
+	if err := os.RemoveAll(scriptDirPath); err != nil {
+		return fmt.Errorf("error removing script directory %s: %v", scriptDirPath, err)
+	}
+	scriptDirPath = ""
+	return nil
+}
+
+// SweepStaleScriptDirs removes the script directories left in the system
+// temporary directory by earlier runs that were killed before cleaning up,
+// returning the removed directories
+func SweepStaleScriptDirs() ([]string, error) {
+	return sweepStaleScriptDirs(os.TempDir(), time.Now().Add(-StaleScriptDirAge))
+}
+
+// sweepStaleScriptDirs removes the script directories in tempDir last
+// modified before the cutoff, leaving those of runs that are still going
+func sweepStaleScriptDirs(tempDir string, cutoff time.Time) ([]string, error) {
+	entries, err := os.ReadDir(tempDir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading temporary directory: %v", err)
+	}
+
+	removed := []string{}
+	errs := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), scriptDirPrefix) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			// removed by another run in the meantime
+			continue
+		}
+		if !info.ModTime().Before(cutoff) {
+			continue
+		}
+		if pid, ok := scriptDirPID(entry.Name()); ok && processRunning(pid) {
+			continue
+		}
+
+		dir := filepath.Join(tempDir, entry.Name())
+		if err := os.RemoveAll(dir); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", dir, err))
+			continue
+		}
+		removed = append(removed, dir)
+	}
+
+	if len(errs) > 0 {
+		return removed, fmt.Errorf("error removing stale script directories: %s", strings.Join(errs, "; "))
+	}
+	return removed, nil
+}
+
+// scriptDirPID returns the process ID of the run that created the script
+// directory, if its name records one
+func scriptDirPID(name string) (int, bool) {
+	pid, _, found := strings.Cut(strings.TrimPrefix(name, scriptDirPrefix), "-")
+	if !found {
+		return 0, false
+	}
+
+	value, err := strconv.Atoi(pid)
+	if err != nil {
+		return 0, false
+	}
+	return value, true
+}
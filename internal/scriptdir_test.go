@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	_ = RemoveScriptDir()
+	os.Exit(code)
+}
+
+func TestSweepStaleScriptDirs(t *testing.T) {
+	tempDir := t.TempDir()
+	now := time.Now()
+
+	dirs := map[string]time.Time{
+		scriptDirPrefix + "stale":           now.Add(-2 * time.Hour),
+		scriptDirPrefix + "fresh":           now.Add(-time.Minute),
+		scriptDirPrefix + "99999999-exited": now.Add(-2 * time.Hour),
+		"docker-orchestrate-unrelated":      now.Add(-2 * time.Hour),
+		// a deploy running for longer than the stale age is still using it
+		fmt.Sprintf("%s%d-running", scriptDirPrefix, os.Getpid()): now.Add(-2 * time.Hour),
+	}
+	for name, modTime := range dirs {
+		dir := filepath.Join(tempDir, name)
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "healthcheck-1.script"), []byte("exit 0"), 0755); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := os.Chtimes(dir, modTime, modTime); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	removed, err := sweepStaleScriptDirs(tempDir, now.Add(-StaleScriptDirAge))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{filepath.Join(tempDir, scriptDirPrefix+"99999999-exited"), filepath.Join(tempDir, scriptDirPrefix+"stale")}
+	if !slices.Equal(removed, expected) {
+		t.Errorf("expected only the stale script directory to be swept\nexpected: %v\ngot:      %v", expected, removed)
+	}
+	for name := range dirs {
+		_, err := os.Stat(filepath.Join(tempDir, name))
+		if exists := err == nil; exists == slices.Contains(expected, filepath.Join(tempDir, name)) {
+			t.Errorf("unexpected state for %s: %v", name, err)
+		}
+	}
+
+	t.Run("a swept script directory is created again", func(t *testing.T) {
+		dir, err := scriptDir()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if pid, ok := scriptDirPID(filepath.Base(dir)); !ok || pid != os.Getpid() {
+			t.Errorf("expected the script directory to record the process ID, got %s", dir)
+		}
+
+		if err := os.RemoveAll(dir); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		recreated, err := scriptDir()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := os.Stat(recreated); err != nil {
+			t.Errorf("expected the script directory to be created again, got %v", err)
+		}
+		if err := RemoveScriptDir(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("scripts are written to the run's script directory", func(t *testing.T) {
+		var scriptPath string
+		executor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+			scriptPath = input.Command
+			return ExecCommandResponse{}, nil
+		}
+		if _, _, err := executeHostScript(context.Background(), executor, "healthcheck", "exit 0"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		dir, err := scriptDir()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if filepath.Dir(scriptPath) != dir {
+			t.Errorf("expected the script to be written to %s, got %s", dir, scriptPath)
+		}
+
+		if err := RemoveScriptDir(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := os.Stat(dir); !os.IsNotExist(err) {
+			t.Errorf("expected the script directory to be removed, got %v", err)
+		}
+	})
+}
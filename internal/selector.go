@@ -0,0 +1,262 @@
+package internal
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/compose-spec/compose-go/v2/types"
+)
+
+// Selector matches services against a selector expression
+type Selector interface {
+	// Matches returns true if the service matches the selector
+	Matches(service types.ServiceConfig) bool
+}
+
+// andSelector matches when both selectors match
+type andSelector struct {
+	left  Selector
+	right Selector
+}
+
+// Matches returns true if both selectors match
+func (s andSelector) Matches(service types.ServiceConfig) bool {
+	return s.left.Matches(service) && s.right.Matches(service)
+}
+
+// orSelector matches when either selector matches
+type orSelector struct {
+	left  Selector
+	right Selector
+}
+
+// Matches returns true if either selector matches
+func (s orSelector) Matches(service types.ServiceConfig) bool {
+	return s.left.Matches(service) || s.right.Matches(service)
+}
+
+// notSelector matches when the wrapped selector does not match
+type notSelector struct {
+	selector Selector
+}
+
+// Matches returns true if the wrapped selector does not match
+func (s notSelector) Matches(service types.ServiceConfig) bool {
+	return !s.selector.Matches(service)
+}
+
+// profileSelector matches services belonging to any of the profiles
+type profileSelector struct {
+	profiles []string
+}
+
+// Matches returns true if the service belongs to any of the profiles
+func (s profileSelector) Matches(service types.ServiceConfig) bool {
+	for _, profile := range service.Profiles {
+		if slices.Contains(s.profiles, profile) {
+			return true
+		}
+	}
+	return false
+}
+
+// labelSelector matches services with the label, optionally set to a specific value
+type labelSelector struct {
+	key      string
+	value    string
+	hasValue bool
+}
+
+// Matches returns true if the service has the label (and value, if specified)
+func (s labelSelector) Matches(service types.ServiceConfig) bool {
+	value, ok := service.Labels[s.key]
+	if !ok {
+		return false
+	}
+	return !s.hasValue || value == s.value
+}
+
+// ParseSelector parses a selector expression such as
+// `profile in (web,worker) and not label:batch`
+//
+// Supported terms are `profile in (a,b,...)` and `label:key[=value]`,
+// combined with `and`, `or`, `not`, and parentheses. `and` binds
+// tighter than `or`.
+func ParseSelector(expression string) (Selector, error) {
+	tokens := tokenizeSelector(expression)
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("selector expression is empty")
+	}
+
+	p := &selectorParser{tokens: tokens}
+	selector, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected token %q in selector", p.tokens[p.pos])
+	}
+
+	return selector, nil
+}
+
+// tokenizeSelector splits a selector expression into tokens
+func tokenizeSelector(expression string) []string {
+	tokens := []string{}
+	current := strings.Builder{}
+	flush := func() {
+		if current.Len() > 0 {
+			tokens = append(tokens, current.String())
+			current.Reset()
+		}
+	}
+
+	for _, r := range expression {
+		switch {
+		case r == '(' || r == ')' || r == ',':
+			flush()
+			tokens = append(tokens, string(r))
+		case r == ' ' || r == '\t' || r == '\n':
+			flush()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+
+	return tokens
+}
+
+// selectorParser is a recursive descent parser for selector expressions
+type selectorParser struct {
+	tokens []string
+	pos    int
+}
+
+// peek returns the current token without consuming it
+func (p *selectorParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+// next consumes and returns the current token
+func (p *selectorParser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+// expect consumes the current token, erroring if it does not match
+func (p *selectorParser) expect(expected string) error {
+	if token := p.next(); token != expected {
+		if token == "" {
+			return fmt.Errorf("expected %q in selector, got end of expression", expected)
+		}
+		return fmt.Errorf("expected %q in selector, got %q", expected, token)
+	}
+	return nil
+}
+
+func (p *selectorParser) parseOr() (Selector, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for strings.EqualFold(p.peek(), "or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orSelector{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *selectorParser) parseAnd() (Selector, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for strings.EqualFold(p.peek(), "and") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andSelector{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *selectorParser) parseNot() (Selector, error) {
+	if strings.EqualFold(p.peek(), "not") {
+		p.next()
+		selector, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notSelector{selector: selector}, nil
+	}
+
+	return p.parseTerm()
+}
+
+func (p *selectorParser) parseTerm() (Selector, error) {
+	token := p.next()
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("unexpected end of selector expression")
+	case token == "(":
+		selector, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return selector, nil
+	case strings.EqualFold(token, "profile"):
+		if err := p.expect("in"); err != nil {
+			return nil, err
+		}
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+
+		profiles := []string{}
+		for {
+			profile := p.next()
+			if profile == "" || profile == "(" || profile == ")" || profile == "," {
+				return nil, fmt.Errorf("expected profile name in selector, got %q", profile)
+			}
+			profiles = append(profiles, profile)
+
+			separator := p.next()
+			if separator == ")" {
+				break
+			}
+			if separator != "," {
+				return nil, fmt.Errorf("expected \",\" or \")\" in selector, got %q", separator)
+			}
+		}
+		return profileSelector{profiles: profiles}, nil
+	case strings.HasPrefix(token, "label:"):
+		label := strings.TrimPrefix(token, "label:")
+		key, value, hasValue := strings.Cut(label, "=")
+		if key == "" {
+			return nil, fmt.Errorf("label selector requires a key: %q", token)
+		}
+		return labelSelector{key: key, value: value, hasValue: hasValue}, nil
+	}
+
+	return nil, fmt.Errorf("unexpected token %q in selector", token)
+}
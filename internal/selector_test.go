@@ -0,0 +1,147 @@
+package internal
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/compose-spec/compose-go/v2/types"
+)
+
+func TestParseSelector(t *testing.T) {
+	project := &types.Project{
+		Services: types.Services{
+			"web": types.ServiceConfig{
+				Name:     "web",
+				Profiles: []string{"web"},
+			},
+			"worker": types.ServiceConfig{
+				Name:     "worker",
+				Profiles: []string{"worker"},
+			},
+			"cron": types.ServiceConfig{
+				Name:     "cron",
+				Profiles: []string{"worker"},
+				Labels:   types.Labels{"batch": "true"},
+			},
+			"db": types.ServiceConfig{
+				Name:   "db",
+				Labels: types.Labels{"tier": "data"},
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		selector string
+		expected []string
+	}{
+		{
+			name:     "profile_in",
+			selector: "profile in (web,worker)",
+			expected: []string{"cron", "web", "worker"},
+		},
+		{
+			name:     "profile_in_and_not_label",
+			selector: "profile in (web, worker) and not label:batch",
+			expected: []string{"web", "worker"},
+		},
+		{
+			name:     "label_with_value",
+			selector: "label:tier=data",
+			expected: []string{"db"},
+		},
+		{
+			name:     "label_with_mismatched_value",
+			selector: "label:tier=web",
+			expected: []string{},
+		},
+		{
+			name:     "or",
+			selector: "label:tier=data or profile in (web)",
+			expected: []string{"db", "web"},
+		},
+		{
+			name:     "and_binds_tighter_than_or",
+			selector: "label:tier or profile in (worker) and label:batch",
+			expected: []string{"cron", "db"},
+		},
+		{
+			name:     "parentheses",
+			selector: "not (profile in (worker) or label:tier)",
+			expected: []string{"web"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selector, err := ParseSelector(tt.selector)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			matched := []string{}
+			for _, service := range project.Services {
+				if selector.Matches(service) {
+					matched = append(matched, service.Name)
+				}
+			}
+			slices.Sort(matched)
+
+			if !slices.Equal(matched, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, matched)
+			}
+		})
+	}
+}
+
+func TestParseSelectorErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		selector      string
+		expectedError string
+	}{
+		{
+			name:          "empty",
+			selector:      "",
+			expectedError: "selector expression is empty",
+		},
+		{
+			name:          "missing_in",
+			selector:      "profile (web)",
+			expectedError: `expected "in" in selector`,
+		},
+		{
+			name:          "unclosed_profile_list",
+			selector:      "profile in (web",
+			expectedError: `expected "," or ")" in selector`,
+		},
+		{
+			name:          "empty_label_key",
+			selector:      "label:",
+			expectedError: "label selector requires a key",
+		},
+		{
+			name:          "dangling_operator",
+			selector:      "label:batch and",
+			expectedError: "unexpected end of selector expression",
+		},
+		{
+			name:          "unknown_term",
+			selector:      "image:nginx",
+			expectedError: `unexpected token "image:nginx"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseSelector(tt.selector)
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), tt.expectedError) {
+				t.Errorf("expected error containing %q, got %q", tt.expectedError, err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// ExecServiceInput is the input for the ExecService function
+type ExecServiceInput struct {
+	// Client is the Docker client to use
+	Client DockerClientInterface
+	// Command is the command to run, along with its arguments
+	Command []string
+	// ConsoleSize is the initial height and width of the TTY, if one is allocated
+	ConsoleSize *[2]uint
+	// Index is the compose container number of the container to run the command in. Defaults to the lowest numbered running container.
+	Index int
+	// ProjectLabel overrides the com.docker.compose.project label value used to discover containers. Defaults to ProjectName.
+	ProjectLabel string
+	// ProjectName is the name of the project
+	ProjectName string
+	// ServiceName is the name of the service
+	ServiceName string
+	// Stderr receives the standard error of the command
+	Stderr io.Writer
+	// Stdin is attached to the standard input of the command, if set
+	Stdin io.Reader
+	// Stdout receives the standard output of the command
+	Stdout io.Writer
+	// Tty is whether to allocate a pseudo-TTY for the command
+	Tty bool
+}
+
+// ExecService runs a command inside a running container of a service,
+// returning the exit code of the command
+func ExecService(ctx context.Context, input ExecServiceInput) (int, error) {
+	if input.Client == nil {
+		return 0, fmt.Errorf("client is required")
+	}
+
+	if input.ServiceName == "" {
+		return 0, fmt.Errorf("service name is required")
+	}
+
+	if len(input.Command) == 0 {
+		return 0, fmt.Errorf("command is required")
+	}
+
+	containers, err := composeContainers(ComposeContainersInput{
+		Client:       input.Client,
+		ProjectLabel: input.ProjectLabel,
+		ProjectName:  input.ProjectName,
+		ServiceName:  input.ServiceName,
+		Status:       "running",
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error getting containers: %v", err)
+	}
+
+	target, err := execTarget(input.ServiceName, containers, input.Index)
+	if err != nil {
+		return 0, err
+	}
+
+	return input.Client.ContainerExec(ctx, target.ID, ContainerExecOptions{
+		Cmd:         input.Command,
+		ConsoleSize: input.ConsoleSize,
+		Stderr:      input.Stderr,
+		Stdin:       input.Stdin,
+		Stdout:      input.Stdout,
+		Tty:         input.Tty,
+	})
+}
+
+// execTarget picks the running container to exec into, either the one with
+// the given compose container number or the lowest numbered one
+func execTarget(serviceName string, containers []container.Summary, index int) (container.Summary, error) {
+	if len(containers) == 0 {
+		return container.Summary{}, fmt.Errorf("no running containers for service %s", serviceName)
+	}
+
+	containerNumber := func(c container.Summary) int {
+		number, err := strconv.Atoi(c.Labels["com.docker.compose.container-number"])
+		if err != nil {
+			return 0
+		}
+		return number
+	}
+
+	if index > 0 {
+		for _, c := range containers {
+			if containerNumber(c) == index {
+				return c, nil
+			}
+		}
+		return container.Summary{}, fmt.Errorf("no running container with index %d for service %s", index, serviceName)
+	}
+
+	return slices.MinFunc(containers, func(a, b container.Summary) int {
+		if containerNumber(a) != containerNumber(b) {
+			return containerNumber(a) - containerNumber(b)
+		}
+		return int(a.Created - b.Created)
+	}), nil
+}
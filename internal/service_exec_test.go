@@ -0,0 +1,140 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestExecService(t *testing.T) {
+	running := []container.Summary{
+		{ID: "web2_container_id", Created: 200, Labels: map[string]string{"com.docker.compose.container-number": "2"}},
+		{ID: "web1_container_id", Created: 100, Labels: map[string]string{"com.docker.compose.container-number": "1"}},
+	}
+
+	newClient := func(execedIn *string, execOptions *ContainerExecOptions) *mockDockerClient {
+		return &mockDockerClient{
+			containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+				if !slices.Contains(options.Filters.Get("status"), "running") {
+					t.Errorf("expected only running containers to be listed, got filters %v", options.Filters)
+				}
+				if !slices.Contains(options.Filters.Get("label"), "com.docker.compose.service=web") {
+					t.Errorf("expected containers to be filtered to the web service, got filters %v", options.Filters)
+				}
+				return slices.Clone(running), nil
+			},
+			containerExec: func(ctx context.Context, id string, options ContainerExecOptions) (int, error) {
+				*execedIn = id
+				*execOptions = options
+				_, _ = options.Stdout.Write([]byte("hello from " + id + "\n"))
+				_, _ = options.Stderr.Write([]byte("a warning\n"))
+				return 3, nil
+			},
+		}
+	}
+
+	t.Run("captures output from the first container", func(t *testing.T) {
+		execedIn := ""
+		execOptions := ContainerExecOptions{}
+		var stdout, stderr bytes.Buffer
+
+		exitCode, err := ExecService(context.Background(), ExecServiceInput{
+			Client:      newClient(&execedIn, &execOptions),
+			Command:     []string{"cat", "/etc/hostname"},
+			ProjectName: "test",
+			ServiceName: "web",
+			Stderr:      &stderr,
+			Stdout:      &stdout,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if exitCode != 3 {
+			t.Errorf("expected the exit code of the command, got %d", exitCode)
+		}
+		if execedIn != "web1_container_id" {
+			t.Errorf("expected the lowest numbered container to be used, got %s", execedIn)
+		}
+		if execOptions.Tty || execOptions.Stdin != nil {
+			t.Errorf("expected no tty or stdin to be attached, got %+v", execOptions)
+		}
+		if !slices.Equal(execOptions.Cmd, []string{"cat", "/etc/hostname"}) {
+			t.Errorf("expected the command to be passed through, got %v", execOptions.Cmd)
+		}
+		if stdout.String() != "hello from web1_container_id\n" {
+			t.Errorf("unexpected stdout %q", stdout.String())
+		}
+		if stderr.String() != "a warning\n" {
+			t.Errorf("unexpected stderr %q", stderr.String())
+		}
+	})
+
+	t.Run("index selects the container", func(t *testing.T) {
+		execedIn := ""
+		execOptions := ContainerExecOptions{}
+		var stdout, stderr bytes.Buffer
+
+		_, err := ExecService(context.Background(), ExecServiceInput{
+			Client:      newClient(&execedIn, &execOptions),
+			Command:     []string{"sh"},
+			Index:       2,
+			ProjectName: "test",
+			ServiceName: "web",
+			Stderr:      &stderr,
+			Stdout:      &stdout,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if execedIn != "web2_container_id" {
+			t.Errorf("expected container number 2 to be used, got %s", execedIn)
+		}
+	})
+
+	t.Run("unknown index", func(t *testing.T) {
+		execedIn := ""
+		execOptions := ContainerExecOptions{}
+
+		_, err := ExecService(context.Background(), ExecServiceInput{
+			Client:      newClient(&execedIn, &execOptions),
+			Command:     []string{"sh"},
+			Index:       5,
+			ProjectName: "test",
+			ServiceName: "web",
+		})
+		if err == nil || err.Error() != "no running container with index 5 for service web" {
+			t.Errorf("expected an unknown index error, got %v", err)
+		}
+		if execedIn != "" {
+			t.Errorf("expected no exec, got one in %s", execedIn)
+		}
+	})
+
+	t.Run("no running containers", func(t *testing.T) {
+		_, err := ExecService(context.Background(), ExecServiceInput{
+			Client:      &mockDockerClient{},
+			Command:     []string{"sh"},
+			ProjectName: "test",
+			ServiceName: "web",
+		})
+		if err == nil || err.Error() != "no running containers for service web" {
+			t.Errorf("expected a no running containers error, got %v", err)
+		}
+	})
+
+	t.Run("command is required", func(t *testing.T) {
+		_, err := ExecService(context.Background(), ExecServiceInput{
+			Client:      &mockDockerClient{},
+			ProjectName: "test",
+			ServiceName: "web",
+		})
+		if err == nil || !strings.Contains(err.Error(), "command is required") {
+			t.Errorf("expected a missing command error, got %v", err)
+		}
+	})
+}
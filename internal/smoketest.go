@@ -0,0 +1,70 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/josegonzalez/cli-skeleton/command"
+)
+
+// RunSmokeTestInput is the input for the runSmokeTest function
+type RunSmokeTestInput struct {
+	// Client is the Docker client to use
+	Client DockerClientInterface
+	// Command is the host command checking the deployed service end to end
+	Command string
+	// Containers are the running containers of the deployed service
+	Containers []container.Summary
+	// Executor is the command executor to use
+	Executor CommandExecutor
+	// HealthURLScheme is the scheme of the published URL handed to the command
+	HealthURLScheme string
+	// Logger is the logger to use
+	Logger *command.ZerologUi
+	// ServiceName is the name of the service
+	ServiceName string
+}
+
+// runSmokeTest runs the smoke test command of a service once it is fully
+// deployed, rendered against its lowest numbered running container. Unlike
+// a healthcheck, it is run once and not retried, so a failure fails the
+// service deploy.
+func runSmokeTest(ctx context.Context, input RunSmokeTestInput) error {
+	if input.Command == "" {
+		return nil
+	}
+
+	if len(input.Containers) == 0 {
+		input.Logger.Info(fmt.Sprintf("Skipping smoke test, service has no running containers: service=%s", input.ServiceName))
+		return nil
+	}
+
+	target, err := execTarget(input.ServiceName, input.Containers, 0)
+	if err != nil {
+		return err
+	}
+
+	input.Logger.Info(fmt.Sprintf("Running smoke test: service=%s", input.ServiceName))
+	err = runHostScript(ctx, runScriptInput{
+		Client:          input.Client,
+		ContainerID:     target.ID,
+		Executor:        input.Executor,
+		HealthURLScheme: input.HealthURLScheme,
+		ServiceName:     input.ServiceName,
+		Script:          input.Command,
+		ScriptType:      "smoke-test",
+	})
+	if err != nil {
+		if eo, ok := err.(*ErrorWithOutput); ok && eo.Output != "" {
+			for _, line := range strings.Split(eo.Output, "\n") {
+				input.Logger.Info(fmt.Sprintf("    %s", line))
+			}
+		}
+		return fmt.Errorf("smoke test failed: service=%s, error=%v", input.ServiceName, err)
+	}
+
+	input.Logger.Info(fmt.Sprintf("Smoke test passed: service=%s", input.ServiceName))
+	return nil
+}
@@ -0,0 +1,132 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/josegonzalez/cli-skeleton/command"
+	"github.com/rs/zerolog"
+)
+
+func TestDeployServiceSmokeTest(t *testing.T) {
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	replicas := 2
+	project := &types.Project{
+		Services: types.Services{
+			"web": types.ServiceConfig{
+				Name: "web",
+				Deploy: &types.DeployConfig{
+					Replicas: &replicas,
+					UpdateConfig: &types.UpdateConfig{
+						// the deadline is twice the monitor, so leave room for
+						// slow healthcheck polls under the race detector
+						Monitor:    types.Duration(100 * time.Millisecond),
+						Order:      "start-first",
+						Extensions: types.Extensions{"x-smoke-test-command": "curl -f http://{{.ContainerIP}}:8080/orders"},
+					},
+				},
+			},
+		},
+	}
+
+	// deploy runs a deploy of the web service, with the smoke test exiting
+	// with the given error, returning the rendered smoke test scripts
+	deploy := func(smokeTestErr error) ([]string, error) {
+		containers := []container.Summary{}
+		mockClient := &mockDockerClient{
+			containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+				return slices.Clone(containers), nil
+			},
+			containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+				return container.InspectResponse{
+					ContainerJSONBase: &container.ContainerJSONBase{
+						State: &container.State{Running: true},
+					},
+					NetworkSettings: &container.NetworkSettings{
+						Networks: map[string]*network.EndpointSettings{
+							"bridge": {IPAddress: "172.17.0." + strings.TrimPrefix(id[:4], "new")},
+						},
+					},
+				}, nil
+			},
+			containerStart: func(ctx context.Context, id string, options container.StartOptions) error {
+				return nil
+			},
+		}
+
+		smokeTests := []string{}
+		mockExecutor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+			if input.Command != "docker" {
+				script, err := os.ReadFile(input.Command)
+				if err != nil {
+					return ExecCommandResponse{}, err
+				}
+				smokeTests = append(smokeTests, strings.TrimPrefix(string(script), "#!/usr/bin/env bash\n"))
+				return ExecCommandResponse{}, smokeTestErr
+			}
+
+			if slices.Contains(input.Args, "create") {
+				for i := len(containers) + 1; i <= replicas; i++ {
+					containers = append(containers, container.Summary{
+						ID:     fmt.Sprintf("new%d_container_id", i),
+						Labels: map[string]string{"com.docker.compose.container-number": fmt.Sprint(i)},
+						State:  container.StateRunning,
+					})
+				}
+			}
+			return ExecCommandResponse{ExitCode: 0}, nil
+		}
+
+		err := DeployService(context.Background(), DeployServiceInput{
+			Client:      mockClient,
+			ComposeFile: "/tmp/docker-compose.yaml",
+			Executor:    mockExecutor,
+			Logger:      logger,
+			Project:     project,
+			ProjectName: "test",
+			ServiceName: "web",
+			SkipRename:  true,
+		})
+		return smokeTests, err
+	}
+
+	t.Run("passing", func(t *testing.T) {
+		smokeTests, err := deploy(nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected := []string{"curl -f http://172.17.0.1:8080/orders"}
+		if !slices.Equal(smokeTests, expected) {
+			t.Errorf("expected a single smoke test against the first container\nexpected: %v\ngot:      %v", expected, smokeTests)
+		}
+	})
+
+	t.Run("failing", func(t *testing.T) {
+		smokeTests, err := deploy(errors.New("exit status 22"))
+		if len(smokeTests) != 1 {
+			t.Errorf("expected the smoke test to run once, got %v", smokeTests)
+		}
+		if err == nil || !strings.Contains(err.Error(), "smoke test failed: service=web, error=smoke-test command failed for container new1_contain: exit status 22") {
+			t.Errorf("expected the deploy to fail with the smoke test, got %v", err)
+		}
+	})
+}
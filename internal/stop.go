@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/josegonzalez/cli-skeleton/command"
+)
+
+// StopOldContainersInput is the input for the StopOldContainers function
+type StopOldContainersInput struct {
+	// Client is the Docker client to use
+	Client DockerClientInterface
+	// Logger is the logger to use
+	Logger *command.ZerologUi
+	// ProjectLabel overrides the com.docker.compose.project label value used to discover containers. Defaults to ProjectName.
+	ProjectLabel string
+	// ProjectName is the name of the project
+	ProjectName string
+	// ServiceName is the name of the service
+	ServiceName string
+	// StopGracePeriod is how long each container is given to exit once stopped before it is killed, or 0 for its own stop timeout
+	StopGracePeriod time.Duration
+}
+
+// StopOldContainers stops and removes the running containers of a service
+// that are not of its newest generation, such as the containers a deploy
+// with --keep-old left running alongside their replacements
+func StopOldContainers(ctx context.Context, input StopOldContainersInput) error {
+	if input.Client == nil {
+		return fmt.Errorf("client is required")
+	}
+
+	if input.ServiceName == "" {
+		return fmt.Errorf("service name is required")
+	}
+
+	containers, err := composeContainers(ComposeContainersInput{
+		Client:       input.Client,
+		ProjectLabel: input.ProjectLabel,
+		ProjectName:  input.ProjectName,
+		ServiceName:  input.ServiceName,
+		Status:       "running",
+	})
+	if err != nil {
+		return fmt.Errorf("error getting containers: %v", err)
+	}
+
+	oldContainers, generation := oldGenerationContainers(containers)
+	if generation == "" {
+		return fmt.Errorf("no running containers of service %s are labeled with a generation", input.ServiceName)
+	}
+
+	if len(oldContainers) == 0 {
+		input.Logger.Info(fmt.Sprintf("No old containers to stop: service=%s, generation=%s", input.ServiceName, generation))
+		return nil
+	}
+
+	input.Logger.Info(fmt.Sprintf("Stopping old containers: service=%s, generation=%s, old=%d", input.ServiceName, generation, len(oldContainers)))
+	for _, c := range oldContainers {
+		if err := input.Client.ContainerTerminateWithTimeout(ctx, c.ID, input.StopGracePeriod); err != nil {
+			return fmt.Errorf("error stopping container %s: %v", c.ID[:min(12, len(c.ID))], err)
+		}
+		input.Logger.Info(fmt.Sprintf("Stopped old container: container=%s, generation=%s", c.ID[:min(12, len(c.ID))], c.Labels[GenerationLabel]))
+	}
+
+	return nil
+}
+
+// oldGenerationContainers returns the containers that are not of the newest
+// generation, along with the newest generation. Containers without a
+// generation label predate it, so they are always old. Generations are UTC
+// timestamps, so the newest sorts last.
+func oldGenerationContainers(containers []container.Summary) ([]container.Summary, string) {
+	newest := ""
+	for _, c := range containers {
+		newest = max(newest, c.Labels[GenerationLabel])
+	}
+
+	oldContainers := []container.Summary{}
+	for _, c := range containers {
+		if c.Labels[GenerationLabel] != newest {
+			oldContainers = append(oldContainers, c)
+		}
+	}
+	return oldContainers, newest
+}
@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/josegonzalez/cli-skeleton/command"
+	"github.com/rs/zerolog"
+)
+
+func TestStopOldContainers(t *testing.T) {
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger: zerolog.New(&buf),
+		StdoutLogger: zerolog.New(&buf),
+	}
+
+	// newClient returns a client listing the containers, recording the
+	// containers terminated along with their stop timeouts
+	newClient := func(containers []container.Summary, terminated map[string]time.Duration) *mockDockerClient {
+		return &mockDockerClient{
+			containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+				if !slices.Contains(options.Filters.Get("label"), "com.docker.compose.service=web") {
+					t.Errorf("expected containers to be filtered to the web service, got filters %v", options.Filters)
+				}
+				return slices.Clone(containers), nil
+			},
+			containerTerminate: func(ctx context.Context, id string, stopTimeout time.Duration) error {
+				terminated[id] = stopTimeout
+				return nil
+			},
+		}
+	}
+
+	t.Run("stops every container not of the newest generation", func(t *testing.T) {
+		containers := []container.Summary{
+			{ID: "unlabeled_container_id"},
+			{ID: "old_container_id", Labels: map[string]string{GenerationLabel: "20260101000000"}},
+			{ID: "new1_container_id", Labels: map[string]string{GenerationLabel: "20260201000000"}},
+			{ID: "new2_container_id", Labels: map[string]string{GenerationLabel: "20260201000000"}},
+		}
+
+		terminated := map[string]time.Duration{}
+		err := StopOldContainers(context.Background(), StopOldContainersInput{
+			Client:          newClient(containers, terminated),
+			Logger:          logger,
+			ProjectName:     "test",
+			ServiceName:     "web",
+			StopGracePeriod: 5 * time.Second,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected := map[string]time.Duration{"unlabeled_container_id": 5 * time.Second, "old_container_id": 5 * time.Second}
+		if len(terminated) != len(expected) {
+			t.Fatalf("expected %v to be stopped, got %v", expected, terminated)
+		}
+		for id, stopTimeout := range expected {
+			if terminated[id] != stopTimeout {
+				t.Errorf("expected %s to be stopped with a timeout of %v, got %v", id, stopTimeout, terminated)
+			}
+		}
+	})
+
+	t.Run("only the newest generation is running", func(t *testing.T) {
+		containers := []container.Summary{
+			{ID: "new1_container_id", Labels: map[string]string{GenerationLabel: "20260201000000"}},
+		}
+
+		terminated := map[string]time.Duration{}
+		err := StopOldContainers(context.Background(), StopOldContainersInput{
+			Client:      newClient(containers, terminated),
+			Logger:      logger,
+			ProjectName: "test",
+			ServiceName: "web",
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(terminated) != 0 {
+			t.Errorf("expected nothing to be stopped, got %v", terminated)
+		}
+	})
+
+	t.Run("no generation refuses to stop anything", func(t *testing.T) {
+		containers := []container.Summary{{ID: "unlabeled_container_id"}}
+
+		terminated := map[string]time.Duration{}
+		err := StopOldContainers(context.Background(), StopOldContainersInput{
+			Client:      newClient(containers, terminated),
+			Logger:      logger,
+			ProjectName: "test",
+			ServiceName: "web",
+		})
+		if err == nil {
+			t.Fatal("expected an error without a generation to keep")
+		}
+		if len(terminated) != 0 {
+			t.Errorf("expected nothing to be stopped, got %v", terminated)
+		}
+	})
+}
@@ -0,0 +1,136 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/josegonzalez/cli-skeleton/command"
+)
+
+// defaultPreStopTimeout bounds the in-container pre-stop command of a
+// service without a stop grace period
+const defaultPreStopTimeout = 10 * time.Second
+
+// PreStopHooksInput is the input for the runPreStopHooks function
+type PreStopHooksInput struct {
+	// Client is the Docker client to use
+	Client DockerClientInterface
+	// Command is the command to run inside the container
+	Command string
+	// ContainerID is the ID of the container about to be stopped
+	ContainerID string
+	// DrainCommand is the host command run first, such as to deregister the container from a load balancer while it is still up
+	DrainCommand string
+	// DrainTimeout is how long to wait after the drain command before the pre-stop commands run
+	DrainTimeout time.Duration
+	// Executor is the command executor to use for the host command
+	Executor CommandExecutor
+	// HostCommand is the command to run on the host
+	HostCommand string
+	// Logger is the logger to use
+	Logger *command.ZerologUi
+	// Order is which command runs first, either host-first or container-first. Defaults to host-first.
+	Order string
+	// ServiceName is the name of the service
+	ServiceName string
+	// StopGracePeriod bounds how long the in-container command may run. Defaults to 10 seconds, the stop timeout docker gives containers by default.
+	StopGracePeriod time.Duration
+	// Warnings collects the warnings raised by failing commands, if set
+	Warnings *DeployWarnings
+}
+
+// runPreStopHooks drains a container, then runs its host and in-container
+// pre-stop commands in the configured order. Failures do not prevent the
+// container from being stopped.
+func runPreStopHooks(ctx context.Context, input PreStopHooksInput) {
+	drainContainer(ctx, input)
+
+	runHost := func() {
+		_ = runHostScript(ctx, runScriptInput{
+			Client:      input.Client,
+			ContainerID: input.ContainerID,
+			Executor:    input.Executor,
+			ServiceName: input.ServiceName,
+			Script:      input.HostCommand,
+			ScriptType:  "pre-stop",
+		})
+	}
+
+	if input.Order == "container-first" {
+		runContainerPreStopCommand(ctx, input)
+		runHost()
+		return
+	}
+
+	runHost()
+	runContainerPreStopCommand(ctx, input)
+}
+
+// runContainerPreStopCommand runs the pre-stop command inside the container,
+// logging its output if it fails
+func runContainerPreStopCommand(ctx context.Context, input PreStopHooksInput) {
+	if input.Command == "" {
+		return
+	}
+
+	// a hung command would otherwise hold up the stop forever
+	timeout := input.StopGracePeriod
+	if timeout <= 0 {
+		timeout = defaultPreStopTimeout
+	}
+	execCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var output bytes.Buffer
+	exitCode, err := input.Client.ContainerExec(execCtx, input.ContainerID, ContainerExecOptions{
+		Cmd:    []string{"/bin/sh", "-c", input.Command},
+		Stderr: &output,
+		Stdout: &output,
+	})
+	if err == nil && exitCode == 0 {
+		return
+	}
+	if err == nil {
+		err = fmt.Errorf("exit code %d", exitCode)
+	}
+
+	input.Warnings.Warn(input.Logger, input.ServiceName, fmt.Sprintf("Pre-stop command failed: service=%s, container=%s, error=%v", input.ServiceName, input.ContainerID[:min(12, len(input.ContainerID))], err))
+	for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+		if line != "" {
+			input.Logger.Warn(fmt.Sprintf("    %s", line))
+		}
+	}
+}
+
+// drainContainer runs the drain command of a container about to be stopped,
+// then waits for the drain timeout, so a load balancer the container was
+// deregistered from stops sending it requests before it goes away
+func drainContainer(ctx context.Context, input PreStopHooksInput) {
+	if input.DrainCommand == "" {
+		return
+	}
+
+	input.Logger.Info(fmt.Sprintf("Draining container: service=%s, container=%s, timeout=%v", input.ServiceName, input.ContainerID[:min(12, len(input.ContainerID))], input.DrainTimeout))
+	runHostHook(ctx, input.Logger, runScriptInput{
+		Client:      input.Client,
+		ContainerID: input.ContainerID,
+		Executor:    input.Executor,
+		ServiceName: input.ServiceName,
+		Script:      input.DrainCommand,
+		ScriptType:  "drain",
+		Warnings:    input.Warnings,
+	})
+
+	if input.DrainTimeout <= 0 {
+		return
+	}
+	timer := time.NewTimer(input.DrainTimeout)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
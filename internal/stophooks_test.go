@@ -0,0 +1,374 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/josegonzalez/cli-skeleton/command"
+	"github.com/rs/zerolog"
+)
+
+func TestRunPreStopHooks(t *testing.T) {
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	// newHooks returns a client and executor recording the order in which
+	// the pre-stop commands and the stop itself run
+	newHooks := func(containerExitCode int) (*mockDockerClient, CommandExecutor, *[]string) {
+		steps := []string{}
+		mockClient := &mockDockerClient{
+			containerExec: func(ctx context.Context, id string, options ContainerExecOptions) (int, error) {
+				steps = append(steps, "container:"+strings.Join(options.Cmd, " "))
+				_, _ = options.Stdout.Write([]byte("draining failed\n"))
+				return containerExitCode, nil
+			},
+			containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+				return container.InspectResponse{
+					NetworkSettings: &container.NetworkSettings{
+						Networks: map[string]*network.EndpointSettings{"bridge": {IPAddress: "172.17.0.2"}},
+					},
+				}, nil
+			},
+			containerTerminate: func(ctx context.Context, id string, stopTimeout time.Duration) error {
+				steps = append(steps, "stop")
+				return nil
+			},
+		}
+		executor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+			steps = append(steps, "host")
+			return ExecCommandResponse{ExitCode: 0}, nil
+		}
+		return mockClient, executor, &steps
+	}
+
+	tests := []struct {
+		name     string
+		order    string
+		expected []string
+	}{
+		{name: "host first by default", order: "", expected: []string{"host", "container:/bin/sh -c drain", "stop"}},
+		{name: "host first", order: "host-first", expected: []string{"host", "container:/bin/sh -c drain", "stop"}},
+		{name: "container first", order: "container-first", expected: []string{"container:/bin/sh -c drain", "host", "stop"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient, executor, steps := newHooks(0)
+
+			err := scaleDownContainers(context.Background(), ScaleDownContainersInput{
+				Client:             mockClient,
+				CurrentContainers:  []container.Summary{{ID: "old_container_id", Names: []string{"/web-1"}}},
+				CurrentReplicas:    1,
+				DesiredReplicas:    0,
+				Executor:           executor,
+				Logger:             logger,
+				PreStopCommand:     "drain",
+				PreStopHostCommand: "deregister {{.ContainerIP}}",
+				PreStopOrder:       tt.order,
+				ProjectName:        "test",
+				ServiceName:        "web",
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !slices.Equal(*steps, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, *steps)
+			}
+		})
+	}
+
+	t.Run("failed container command is logged", func(t *testing.T) {
+		buf.Reset()
+		mockClient, executor, steps := newHooks(3)
+
+		runPreStopHooks(context.Background(), PreStopHooksInput{
+			Client:      mockClient,
+			Command:     "drain",
+			ContainerID: "old_container_id",
+			Executor:    executor,
+			Logger:      logger,
+			ServiceName: "web",
+		})
+
+		if !slices.Equal(*steps, []string{"container:/bin/sh -c drain"}) {
+			t.Errorf("expected only the container command to run, got %v", *steps)
+		}
+		if !strings.Contains(buf.String(), "Pre-stop command failed: service=web, container=old_containe, error=exit code 3") {
+			t.Errorf("expected the failure to be logged, got %s", buf.String())
+		}
+		if !strings.Contains(buf.String(), "draining failed") {
+			t.Errorf("expected the command output to be logged, got %s", buf.String())
+		}
+	})
+
+	t.Run("hung container command is bounded by the stop grace period", func(t *testing.T) {
+		buf.Reset()
+		mockClient := &mockDockerClient{
+			containerExec: func(ctx context.Context, id string, options ContainerExecOptions) (int, error) {
+				<-ctx.Done()
+				return 0, ctx.Err()
+			},
+		}
+
+		runPreStopHooks(context.Background(), PreStopHooksInput{
+			Client:          mockClient,
+			Command:         "sleep infinity",
+			ContainerID:     "old_container_id",
+			Logger:          logger,
+			ServiceName:     "web",
+			StopGracePeriod: 10 * time.Millisecond,
+		})
+
+		if !strings.Contains(buf.String(), "Pre-stop command failed: service=web, container=old_containe, error=context deadline exceeded") {
+			t.Errorf("expected the timed out command to be logged, got %s", buf.String())
+		}
+	})
+}
+
+func TestFailedContainerCleanupHooks(t *testing.T) {
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	// newCleanup returns a client and executor recording the stop hooks and
+	// stops of a new container that never becomes healthy
+	newCleanup := func() (*mockDockerClient, CommandExecutor, *[]string) {
+		steps := []string{}
+		created := false
+		mockClient := &mockDockerClient{
+			containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+				if !created {
+					return []container.Summary{{ID: "old_container_id", Created: 50}}, nil
+				}
+				return []container.Summary{
+					{ID: "old_container_id", Created: 50},
+					{ID: "new_container_id", Created: 300},
+				}, nil
+			},
+			containerExec: func(ctx context.Context, id string, options ContainerExecOptions) (int, error) {
+				steps = append(steps, "container:"+strings.Join(options.Cmd, " "))
+				return 0, nil
+			},
+			containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+				return container.InspectResponse{
+					ContainerJSONBase: &container.ContainerJSONBase{
+						State: &container.State{Running: false},
+					},
+					NetworkSettings: &container.NetworkSettings{
+						Networks: map[string]*network.EndpointSettings{"bridge": {IPAddress: "172.17.0.2"}},
+					},
+				}, nil
+			},
+			containerTerminate: func(ctx context.Context, id string, stopTimeout time.Duration) error {
+				steps = append(steps, "stop:"+id[:3])
+				return nil
+			},
+		}
+		executor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+			if input.Command == "docker" {
+				created = true
+			} else {
+				steps = append(steps, "host")
+			}
+			return ExecCommandResponse{ExitCode: 0}, nil
+		}
+		return mockClient, executor, &steps
+	}
+
+	tests := []struct {
+		name     string
+		skip     bool
+		expected []string
+	}{
+		{name: "hooks run by default", skip: false, expected: []string{"host", "container:/bin/sh -c drain", "stop:new", "host"}},
+		{name: "hooks skipped", skip: true, expected: []string{"stop:new"}},
+	}
+
+	for _, tt := range tests {
+		t.Run("rolling update "+tt.name, func(t *testing.T) {
+			mockClient, executor, steps := newCleanup()
+
+			_, err := rollingUpdateContainers(context.Background(), RollingUpdateInput{
+				Client:              mockClient,
+				ContainersToUpdate:  []container.Summary{{ID: "old_container_id", Created: 50}},
+				Executor:            executor,
+				FailureAction:       "pause",
+				Logger:              logger,
+				Order:               "start-first",
+				Parallelism:         1,
+				PostStopHostCommand: "cleanup",
+				PreStopCommand:      "drain",
+				PreStopHostCommand:  "deregister",
+				ProjectName:         "test",
+				ServiceName:         "web",
+				SkipCleanupHooks:    tt.skip,
+				TickerCh:            testTickerCh(),
+			})
+			if err == nil {
+				t.Fatal("expected the rolling update to fail")
+			}
+
+			if !slices.Equal(*steps, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, *steps)
+			}
+		})
+
+		t.Run("scale up "+tt.name, func(t *testing.T) {
+			mockClient, executor, steps := newCleanup()
+
+			err := scaleUpContainers(context.Background(), ScaleUpContainersInput{
+				Client:              mockClient,
+				DesiredReplicas:     2,
+				Executor:            executor,
+				ExistingContainers:  []container.Summary{{ID: "old_container_id", Created: 50}},
+				Logger:              logger,
+				Parallelism:         1,
+				PostStopHostCommand: "cleanup",
+				PreStopCommand:      "drain",
+				PreStopHostCommand:  "deregister",
+				ProjectName:         "test",
+				ServiceName:         "web",
+				SkipCleanupHooks:    tt.skip,
+				TickerCh:            testTickerCh(),
+			})
+			if err == nil {
+				t.Fatal("expected the scale up to fail")
+			}
+
+			if !slices.Equal(*steps, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, *steps)
+			}
+		})
+	}
+}
+
+func TestDrainCommand(t *testing.T) {
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	// newDrain returns a client and executor recording the host scripts run
+	// for each container and the stops themselves
+	newDrain := func() (*mockDockerClient, CommandExecutor, *[]string) {
+		steps := []string{}
+		scaled := false
+		mockClient := &mockDockerClient{
+			containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+				if !scaled {
+					return []container.Summary{{ID: "old_container_id", Created: 50}}, nil
+				}
+				return []container.Summary{
+					{ID: "old_container_id", Created: 50},
+					{ID: "new_container_id", Created: 300},
+				}, nil
+			},
+			containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+				return container.InspectResponse{
+					ContainerJSONBase: &container.ContainerJSONBase{
+						State: &container.State{Running: true},
+					},
+					NetworkSettings: &container.NetworkSettings{
+						Networks: map[string]*network.EndpointSettings{"bridge": {IPAddress: "172.17.0.2"}},
+					},
+				}, nil
+			},
+			containerTerminate: func(ctx context.Context, id string, stopTimeout time.Duration) error {
+				steps = append(steps, "stop:"+id)
+				return nil
+			},
+		}
+		executor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+			script := filepath.Base(input.Command)
+			if !strings.HasSuffix(script, ".script") {
+				scaled = true
+				return ExecCommandResponse{ExitCode: 0}, nil
+			}
+			steps = append(steps, script[:strings.LastIndex(script, "-")])
+			return ExecCommandResponse{ExitCode: 0}, nil
+		}
+		return mockClient, executor, &steps
+	}
+
+	expected := []string{"drain", "pre-stop", "stop:old_container_id"}
+
+	t.Run("scale down", func(t *testing.T) {
+		mockClient, executor, steps := newDrain()
+
+		err := scaleDownContainers(context.Background(), ScaleDownContainersInput{
+			Client:             mockClient,
+			CurrentContainers:  []container.Summary{{ID: "old_container_id", Names: []string{"/web-1"}}},
+			CurrentReplicas:    1,
+			DesiredReplicas:    0,
+			DrainCommand:       "deregister {{.ContainerIP}}",
+			Executor:           executor,
+			Logger:             logger,
+			PreStopHostCommand: "shutdown {{.ContainerIP}}",
+			ProjectName:        "test",
+			ServiceName:        "web",
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !slices.Equal(*steps, expected) {
+			t.Errorf("expected %v, got %v", expected, *steps)
+		}
+	})
+
+	for _, order := range []string{"start-first", "stop-first"} {
+		t.Run("rolling update "+order, func(t *testing.T) {
+			mockClient, executor, steps := newDrain()
+
+			_, err := rollingUpdateContainers(context.Background(), RollingUpdateInput{
+				Client:             mockClient,
+				ContainersToUpdate: []container.Summary{{ID: "old_container_id", Created: 50}},
+				CurrentReplicas:    1,
+				DesiredReplicas:    1,
+				DrainCommand:       "deregister {{.ContainerIP}}",
+				DrainTimeout:       10 * time.Millisecond,
+				Executor:           executor,
+				Logger:             logger,
+				Order:              order,
+				Parallelism:        1,
+				PreStopHostCommand: "shutdown {{.ContainerIP}}",
+				ProjectName:        "test",
+				ServiceName:        "web",
+				TickerCh:           testTickerCh(),
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !slices.Equal(*steps, expected) {
+				t.Errorf("expected %v, got %v", expected, *steps)
+			}
+			if !strings.Contains(buf.String(), "Draining container: service=web, container=old_containe, timeout=10ms") {
+				t.Errorf("expected the drain to be logged, got %s", buf.String())
+			}
+		})
+	}
+}
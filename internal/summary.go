@@ -0,0 +1,125 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	// OutcomeOK is the outcome of a service that deployed successfully
+	OutcomeOK = "ok"
+	// OutcomeFailed is the outcome of a service whose deploy failed
+	OutcomeFailed = "failed"
+	// OutcomeTimedOut is the outcome of a service whose deploy ran out of time
+	OutcomeTimedOut = "timed-out"
+	// OutcomeSkipped is the outcome of a service that was skipped rather than deployed
+	OutcomeSkipped = "skipped"
+	// OutcomeNotStarted is the outcome of a service the deploy ran out of time before reaching
+	OutcomeNotStarted = "not-started"
+)
+
+// timeoutMessages are the errors returned when a healthcheck or dependency
+// wait runs out of time. They are built with %v, so the deadline is not
+// always recoverable with errors.Is.
+var timeoutMessages = []string{
+	"health check timeout after",
+	"health check exceeded per-container timeout",
+	"not healthy within",
+}
+
+// ServiceSummary is the outcome of a single service in a project deploy
+type ServiceSummary struct {
+	// Duration is how long the service deploy took, including any dependency wait
+	Duration time.Duration `json:"duration"`
+	// FailedDependencies are the dependencies of the service that failed, set when the service was skipped or deployed in a degraded state
+	FailedDependencies []string `json:"failed_dependencies,omitempty"`
+	// Failures is the number of new containers that failed their healthcheck
+	Failures int `json:"failures"`
+	// Outcome is one of OutcomeOK, OutcomeFailed, OutcomeTimedOut, OutcomeSkipped or OutcomeNotStarted
+	Outcome string `json:"outcome"`
+	// Replicas is the number of running containers once the service deploy finished
+	Replicas int `json:"replicas"`
+	// Service is the name of the service
+	Service string `json:"service"`
+	// Updates is the number of containers replaced by the rolling update
+	Updates int `json:"updates"`
+}
+
+// MarshalJSON renders the duration the same way as the summary table,
+// rather than as a count of nanoseconds
+func (s ServiceSummary) MarshalJSON() ([]byte, error) {
+	type serviceSummary ServiceSummary
+	return json.Marshal(struct {
+		serviceSummary
+		Duration string `json:"duration"`
+	}{
+		serviceSummary: serviceSummary(s),
+		Duration:       s.Duration.Round(time.Millisecond).String(),
+	})
+}
+
+// DeployProjectResult is the outcome of deploying a project
+type DeployProjectResult struct {
+	// Error is the error the deploy failed with, if any
+	Error string `json:"error,omitempty"`
+	// Services are the outcomes of each service the deploy reached, in deploy order
+	Services []ServiceSummary `json:"services"`
+	// Success is whether the entire deploy succeeded
+	Success bool `json:"success"`
+	// Warnings are the warnings raised during the deploy, if they were collected
+	Warnings []Warning `json:"warnings,omitempty"`
+}
+
+// SummaryJSON renders the result as a single JSON document
+func (r DeployProjectResult) SummaryJSON() (string, error) {
+	if r.Services == nil {
+		r.Services = []ServiceSummary{}
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", fmt.Errorf("error encoding deploy summary: %v", err)
+	}
+	return string(data), nil
+}
+
+// SummaryTable renders the outcome and duration of each service as a table
+func (r DeployProjectResult) SummaryTable() string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SERVICE\tOUTCOME\tDURATION")
+	for _, summary := range r.Services {
+		outcome := summary.Outcome
+		if summary.Outcome == OutcomeOK && len(summary.FailedDependencies) > 0 {
+			outcome = fmt.Sprintf("%s (degraded)", outcome)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", summary.Service, outcome, summary.Duration.Round(time.Millisecond))
+	}
+	w.Flush()
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// serviceOutcome classifies the result of a service deploy
+func serviceOutcome(result DeployServiceResult, err error) string {
+	if err == nil {
+		if result.Skipped {
+			return OutcomeSkipped
+		}
+		return OutcomeOK
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return OutcomeTimedOut
+	}
+	for _, message := range timeoutMessages {
+		if strings.Contains(err.Error(), message) {
+			return OutcomeTimedOut
+		}
+	}
+	return OutcomeFailed
+}
@@ -0,0 +1,294 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/josegonzalez/cli-skeleton/command"
+	"github.com/rs/zerolog"
+)
+
+func TestDeployProjectWithResult(t *testing.T) {
+	mockClient := &mockDockerClient{
+		containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+			return []container.Summary{}, nil
+		},
+	}
+
+	mockExecutor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+		return ExecCommandResponse{ExitCode: 0}, nil
+	}
+
+	project := &types.Project{
+		Services: types.Services{
+			"web": types.ServiceConfig{
+				Name: "web",
+			},
+			"db": types.ServiceConfig{
+				Name:  "db",
+				Image: "postgres:16",
+				DependsOn: types.DependsOnConfig{
+					"web": types.ServiceDependency{Condition: types.ServiceConditionStarted},
+				},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	result, err := DeployProjectWithResult(context.Background(), DeployProjectInput{
+		Client:                mockClient,
+		ComposeFile:           "/tmp/docker-compose.yaml",
+		ContainerNameTemplate: "{{.ServiceName}}",
+		Executor:              mockExecutor,
+		Logger:                logger,
+		Project:               project,
+		ProjectName:           "test",
+		SkipDatabases:         true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !result.Success || result.Error != "" {
+		t.Errorf("expected a successful result, got %+v", result)
+	}
+	if len(result.Services) != 2 {
+		t.Fatalf("expected 2 service summaries, got %+v", result.Services)
+	}
+	if result.Services[0].Service != "web" || result.Services[0].Outcome != OutcomeOK {
+		t.Errorf("expected web to be ok, got %+v", result.Services[0])
+	}
+	if result.Services[1].Service != "db" || result.Services[1].Outcome != OutcomeSkipped {
+		t.Errorf("expected db to be skipped, got %+v", result.Services[1])
+	}
+
+	lines := strings.Split(result.SummaryTable(), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected a header and 2 rows, got %q", lines)
+	}
+	if strings.Join(strings.Fields(lines[0]), " ") != "SERVICE OUTCOME DURATION" {
+		t.Errorf("unexpected header %q", lines[0])
+	}
+	if fields := strings.Fields(lines[1]); len(fields) != 3 || fields[0] != "web" || fields[1] != "ok" {
+		t.Errorf("expected an ok row for web, got %q", lines[1])
+	}
+	if fields := strings.Fields(lines[2]); len(fields) != 3 || fields[0] != "db" || fields[1] != "skipped" {
+		t.Errorf("expected a skipped row for db, got %q", lines[2])
+	}
+}
+
+func TestDeployProjectResultSummaryJSON(t *testing.T) {
+	result := DeployProjectResult{
+		Error: "error deploying service worker: boom",
+		Services: []ServiceSummary{
+			{Duration: 1500 * time.Millisecond, Outcome: OutcomeOK, Replicas: 3, Service: "web", Updates: 3},
+			{Duration: 2 * time.Second, Failures: 1, Outcome: OutcomeFailed, Replicas: 1, Service: "worker", Updates: 1},
+		},
+	}
+
+	summary, err := result.SummaryJSON()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var decoded struct {
+		Error    string `json:"error"`
+		Services []struct {
+			Duration string `json:"duration"`
+			Failures int    `json:"failures"`
+			Outcome  string `json:"outcome"`
+			Replicas int    `json:"replicas"`
+			Service  string `json:"service"`
+			Updates  int    `json:"updates"`
+		} `json:"services"`
+		Success *bool `json:"success"`
+	}
+	if err := json.Unmarshal([]byte(summary), &decoded); err != nil {
+		t.Fatalf("expected valid JSON, got %q: %v", summary, err)
+	}
+
+	if decoded.Success == nil || *decoded.Success {
+		t.Errorf("expected success to be false, got %q", summary)
+	}
+	if decoded.Error != "error deploying service worker: boom" {
+		t.Errorf("unexpected error %q", decoded.Error)
+	}
+	if len(decoded.Services) != 2 {
+		t.Fatalf("expected 2 services, got %q", summary)
+	}
+	web := decoded.Services[0]
+	if web.Service != "web" || web.Outcome != OutcomeOK || web.Replicas != 3 || web.Updates != 3 || web.Failures != 0 || web.Duration != "1.5s" {
+		t.Errorf("unexpected web summary %+v", web)
+	}
+	worker := decoded.Services[1]
+	if worker.Service != "worker" || worker.Outcome != OutcomeFailed || worker.Replicas != 1 || worker.Updates != 1 || worker.Failures != 1 {
+		t.Errorf("unexpected worker summary %+v", worker)
+	}
+
+	empty, err := DeployProjectResult{Success: true}.SummaryJSON()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if empty != `{"services":[],"success":true}` {
+		t.Errorf("unexpected empty summary %q", empty)
+	}
+}
+
+func TestServiceOutcome(t *testing.T) {
+	tests := []struct {
+		name     string
+		result   DeployServiceResult
+		err      error
+		expected string
+	}{
+		{name: "deployed", expected: OutcomeOK},
+		{name: "skipped", result: DeployServiceResult{Skipped: true}, expected: OutcomeSkipped},
+		{name: "failed", err: fmt.Errorf("error scaling up containers: boom"), expected: OutcomeFailed},
+		{name: "health check timeout", err: fmt.Errorf("error waiting for container: health check timeout after %v", time.Second), expected: OutcomeTimedOut},
+		{name: "per-container timeout", err: fmt.Errorf("health check exceeded per-container timeout of %v", time.Second), expected: OutcomeTimedOut},
+		{name: "dependency timeout", err: fmt.Errorf("dependency db not healthy within %v", time.Second), expected: OutcomeTimedOut},
+		{name: "deadline exceeded", err: fmt.Errorf("error waiting: %w", context.DeadlineExceeded), expected: OutcomeTimedOut},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if outcome := serviceOutcome(tt.result, tt.err); outcome != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, outcome)
+			}
+		})
+	}
+}
+
+func TestDeployProjectOverallTimeout(t *testing.T) {
+	project := &types.Project{
+		Services: types.Services{
+			"api": types.ServiceConfig{Name: "api"},
+			"web": types.ServiceConfig{
+				Name:      "web",
+				DependsOn: types.DependsOnConfig{"api": types.ServiceDependency{Condition: types.ServiceConditionStarted}},
+			},
+			"worker": types.ServiceConfig{
+				Name:      "worker",
+				DependsOn: types.DependsOnConfig{"web": types.ServiceDependency{Condition: types.ServiceConditionStarted}},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(zerolog.SyncWriter(&buf)).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(zerolog.SyncWriter(&buf)).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	// web starts a container that never becomes healthy, so the overall
+	// timeout fires while its batch is in progress
+	var mu sync.Mutex
+	webStarted := false
+	terminated := []string{}
+	mockClient := &mockDockerClient{
+		containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if webStarted && options.Filters.ExactMatch("label", "com.docker.compose.service=web") {
+				return []container.Summary{{ID: "web_container_id", Names: []string{"/web-1"}, Created: 100}}, nil
+			}
+			return []container.Summary{}, nil
+		},
+		containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+			return container.InspectResponse{
+				ContainerJSONBase: &container.ContainerJSONBase{
+					State: &container.State{Running: true, Health: &container.Health{Status: container.Starting}},
+				},
+				Config: &container.Config{Healthcheck: &container.HealthConfig{Test: []string{"CMD", "true"}}},
+			}, nil
+		},
+		containerTerminate: func(ctx context.Context, id string, stopTimeout time.Duration) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			terminated = append(terminated, id)
+			return nil
+		},
+	}
+	mockExecutor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+		if slices.Contains(input.Args, "web") {
+			mu.Lock()
+			webStarted = true
+			mu.Unlock()
+		}
+		return ExecCommandResponse{ExitCode: 0}, nil
+	}
+
+	result, err := DeployProjectWithResult(context.Background(), DeployProjectInput{
+		Client:                mockClient,
+		ComposeFile:           "/tmp/docker-compose.yaml",
+		ContainerNameTemplate: "{{.ServiceName}}",
+		ContinueOnError:       true,
+		Executor:              mockExecutor,
+		Logger:                logger,
+		OverallTimeout:        200 * time.Millisecond,
+		Project:               project,
+		ProjectName:           "test",
+	})
+	if err == nil {
+		t.Fatal("expected the overall timeout to fail the deploy")
+	}
+	expected := "deploy exceeded the overall timeout of 200ms: completed=api, failed=none, skipped=none, in-progress=web, not-started=worker"
+	if err.Error() != expected {
+		t.Errorf("expected error %q, got %q", expected, err.Error())
+	}
+
+	outcomes := map[string]string{}
+	for _, summary := range result.Services {
+		outcomes[summary.Service] = summary.Outcome
+	}
+	expectedOutcomes := map[string]string{"api": OutcomeOK, "web": OutcomeTimedOut, "worker": OutcomeNotStarted}
+	if fmt.Sprint(outcomes) != fmt.Sprint(expectedOutcomes) {
+		t.Errorf("expected outcomes %v, got %v", expectedOutcomes, outcomes)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !slices.Equal(terminated, []string{"web_container_id"}) {
+		t.Errorf("expected the in-progress web container to be cleaned up, got %v", terminated)
+	}
+}
+
+func TestOverallTimeoutError(t *testing.T) {
+	err := overallTimeoutError(time.Minute, DeployProjectResult{
+		Services: []ServiceSummary{
+			{Outcome: OutcomeOK, Service: "api"},
+			{Outcome: OutcomeFailed, Service: "db"},
+			{FailedDependencies: []string{"db"}, Outcome: OutcomeSkipped, Service: "cache"},
+			{Outcome: OutcomeTimedOut, Service: "web"},
+			{Outcome: OutcomeNotStarted, Service: "worker"},
+		},
+	})
+
+	expected := "deploy exceeded the overall timeout of 1m0s: completed=api, failed=db, skipped=cache, in-progress=web, not-started=worker"
+	if err.Error() != expected {
+		t.Errorf("expected error %q, got %q", expected, err.Error())
+	}
+}
@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/josegonzalez/cli-skeleton/command"
+)
+
+// projectResources are the networks and volumes belonging to a project
+type projectResources struct {
+	// Networks are the IDs of the project networks
+	Networks []string
+	// Volumes are the names of the project volumes
+	Volumes []string
+}
+
+// listProjectResources lists the networks and volumes compose has labeled as
+// belonging to the project
+func listProjectResources(ctx context.Context, client DockerClientInterface, projectLabel string) (projectResources, error) {
+	resources := projectResources{}
+	filterArgs := filters.NewArgs(filters.Arg("label", fmt.Sprintf("com.docker.compose.project=%s", projectLabel)))
+
+	networks, err := client.NetworkList(ctx, network.ListOptions{Filters: filterArgs})
+	if err != nil {
+		return resources, fmt.Errorf("error listing networks: %v", err)
+	}
+	for _, n := range networks {
+		resources.Networks = append(resources.Networks, n.ID)
+	}
+
+	volumes, err := client.VolumeList(ctx, volume.ListOptions{Filters: filterArgs})
+	if err != nil {
+		return resources, fmt.Errorf("error listing volumes: %v", err)
+	}
+	for _, v := range volumes.Volumes {
+		if v != nil {
+			resources.Volumes = append(resources.Volumes, v.Name)
+		}
+	}
+
+	return resources, nil
+}
+
+// TeardownDeployInput is the input for the teardownDeploy function
+type TeardownDeployInput struct {
+	// Client is the Docker client to use
+	Client DockerClientInterface
+	// DeployID is the deploy whose containers are removed
+	DeployID string
+	// Existing are the project networks and volumes that existed before the deploy, which are kept
+	Existing projectResources
+	// Logger is the logger to use
+	Logger *command.ZerologUi
+	// ProjectLabel is the com.docker.compose.project label value of the project
+	ProjectLabel string
+}
+
+// teardownDeploy removes the containers stamped with the deploy ID, along
+// with any project network or volume that did not exist before the deploy.
+// Every resource is attempted, so one failed removal does not leave the rest
+// behind.
+func teardownDeploy(ctx context.Context, input TeardownDeployInput) error {
+	input.Logger.Info(fmt.Sprintf("Tearing down deploy: deploy_id=%s", input.DeployID))
+
+	failures := []string{}
+	containers, err := composeContainers(ComposeContainersInput{
+		Client:       input.Client,
+		ExtraFilters: deployIDFilters(input.DeployID),
+		ProjectLabel: input.ProjectLabel,
+	})
+	if err != nil {
+		failures = append(failures, fmt.Sprintf("error listing containers: %v", err))
+	}
+	for _, c := range containers {
+		input.Logger.Info(fmt.Sprintf("Removing container: id=%s", c.ID))
+		if err := input.Client.ContainerRemove(ctx, c.ID, container.RemoveOptions{Force: true, RemoveVolumes: true}); err != nil {
+			failures = append(failures, fmt.Sprintf("error removing container %s: %v", c.ID, err))
+		}
+	}
+
+	current, err := listProjectResources(ctx, input.Client, input.ProjectLabel)
+	if err != nil {
+		failures = append(failures, err.Error())
+	}
+	for _, networkID := range current.Networks {
+		if slices.Contains(input.Existing.Networks, networkID) {
+			continue
+		}
+		input.Logger.Info(fmt.Sprintf("Removing network: id=%s", networkID))
+		if err := input.Client.NetworkRemove(ctx, networkID); err != nil {
+			failures = append(failures, fmt.Sprintf("error removing network %s: %v", networkID, err))
+		}
+	}
+	for _, volumeName := range current.Volumes {
+		if slices.Contains(input.Existing.Volumes, volumeName) {
+			continue
+		}
+		input.Logger.Info(fmt.Sprintf("Removing volume: name=%s", volumeName))
+		if err := input.Client.VolumeRemove(ctx, volumeName, true); err != nil {
+			failures = append(failures, fmt.Sprintf("error removing volume %s: %v", volumeName, err))
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("error tearing down deploy %s: %s", input.DeployID, strings.Join(failures, "; "))
+	}
+	return nil
+}
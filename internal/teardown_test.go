@@ -0,0 +1,182 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/josegonzalez/cli-skeleton/command"
+	"github.com/rs/zerolog"
+)
+
+func TestDeployProjectTeardownOnFailure(t *testing.T) {
+	project := &types.Project{
+		Services: types.Services{
+			"web": types.ServiceConfig{
+				Name:  "web",
+				Image: "example/web:latest",
+				Deploy: &types.DeployConfig{
+					UpdateConfig: &types.UpdateConfig{
+						Monitor: types.Duration(time.Millisecond),
+					},
+				},
+			},
+			"worker": types.ServiceConfig{
+				Name: "worker",
+				DependsOn: types.DependsOnConfig{
+					"web": types.ServiceDependency{Condition: types.ServiceConditionStarted},
+				},
+				Deploy: &types.DeployConfig{
+					UpdateConfig: &types.UpdateConfig{
+						Extensions: types.Extensions{"x-healthcheck-success-threshold": "many"},
+					},
+				},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	t.Run("removes only what the deploy created", func(t *testing.T) {
+		// a container from an earlier deploy shares the project label, but not the deploy id
+		containers := []container.Summary{
+			{ID: "old_cache_container_id", State: container.StateRunning, Labels: map[string]string{
+				"com.docker.compose.project": "test",
+				"com.docker.compose.service": "cache",
+			}},
+		}
+		removedContainers := []string{}
+		networkListCalls := 0
+		removedNetworks := []string{}
+		volumeListCalls := 0
+		removedVolumes := []string{}
+
+		mockClient := &mockDockerClient{
+			containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+				matched := []container.Summary{}
+				for _, c := range containers {
+					if slices.ContainsFunc(options.Filters.Get("label"), func(label string) bool {
+						key, value, _ := strings.Cut(label, "=")
+						return c.Labels[key] != value
+					}) {
+						continue
+					}
+					if slices.Contains(options.Filters.Get("status"), container.StateRunning) && c.State != container.StateRunning {
+						continue
+					}
+					matched = append(matched, c)
+				}
+				return matched, nil
+			},
+			containerStart: func(ctx context.Context, id string, options container.StartOptions) error {
+				for i := range containers {
+					if containers[i].ID == id {
+						containers[i].State = container.StateRunning
+					}
+				}
+				return nil
+			},
+			containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+				return container.InspectResponse{
+					ContainerJSONBase: &container.ContainerJSONBase{
+						Name:  "/web",
+						State: &container.State{Running: true},
+					},
+				}, nil
+			},
+			containerRemove: func(ctx context.Context, id string, options container.RemoveOptions) error {
+				removedContainers = append(removedContainers, id)
+				return nil
+			},
+			networkList: func(ctx context.Context, options network.ListOptions) ([]network.Summary, error) {
+				networkListCalls++
+				networks := []network.Summary{{ID: "old_network_id"}}
+				if networkListCalls > 1 {
+					networks = append(networks, network.Summary{ID: "new_network_id"})
+				}
+				return networks, nil
+			},
+			networkRemove: func(ctx context.Context, networkID string) error {
+				removedNetworks = append(removedNetworks, networkID)
+				return nil
+			},
+			volumeList: func(ctx context.Context, options volume.ListOptions) (volume.ListResponse, error) {
+				volumeListCalls++
+				volumes := []*volume.Volume{{Name: "test_old"}}
+				if volumeListCalls > 1 {
+					volumes = append(volumes, &volume.Volume{Name: "test_new"})
+				}
+				return volume.ListResponse{Volumes: volumes}, nil
+			},
+			volumeRemove: func(ctx context.Context, volumeID string, force bool) error {
+				removedVolumes = append(removedVolumes, volumeID)
+				return nil
+			},
+		}
+
+		mockExecutor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+			if slices.Contains(input.Args, "create") {
+				containers = append(containers, container.Summary{ID: "new_web_container_id", Created: 100, State: container.StateCreated, Labels: map[string]string{
+					"com.docker.compose.project": "test",
+					"com.docker.compose.service": "web",
+					DeployIDLabel:                "deploy-1",
+				}})
+			}
+			return ExecCommandResponse{ExitCode: 0}, nil
+		}
+
+		err := DeployProject(context.Background(), DeployProjectInput{
+			Client:                mockClient,
+			ComposeFile:           "/tmp/docker-compose.yaml",
+			ContainerNameTemplate: "{{.ServiceName}}",
+			DeployID:              "deploy-1",
+			Executor:              mockExecutor,
+			HealthStartPeriod:     time.Second,
+			Logger:                logger,
+			Project:               project,
+			ProjectName:           "test",
+			TeardownOnFailure:     true,
+		})
+		if err == nil || !strings.Contains(err.Error(), "invalid x-healthcheck-success-threshold value") {
+			t.Fatalf("expected the worker deploy error, got %v", err)
+		}
+
+		if !slices.Equal(removedContainers, []string{"new_web_container_id"}) {
+			t.Errorf("expected only the new web container to be removed, got %v", removedContainers)
+		}
+		if !slices.Equal(removedNetworks, []string{"new_network_id"}) {
+			t.Errorf("expected only the new network to be removed, got %v", removedNetworks)
+		}
+		if !slices.Equal(removedVolumes, []string{"test_new"}) {
+			t.Errorf("expected only the new volume to be removed, got %v", removedVolumes)
+		}
+	})
+
+	t.Run("requires a deploy id", func(t *testing.T) {
+		err := DeployProject(context.Background(), DeployProjectInput{
+			Client:            &mockDockerClient{},
+			ComposeFile:       "/tmp/docker-compose.yaml",
+			Logger:            logger,
+			Project:           project,
+			ProjectName:       "test",
+			TeardownOnFailure: true,
+		})
+		if err == nil || err.Error() != "deploy id is required to tear down on failure" {
+			t.Errorf("expected a missing deploy id error, got %v", err)
+		}
+	})
+}
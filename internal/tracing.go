@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation scope of the spans traced for a deploy
+const tracerName = "github.com/dokku/docker-orchestrate"
+
+// NewTracerProvider returns a tracer provider exporting spans over OTLP/HTTP
+// to the given endpoint, such as http://localhost:4318. The provider must be
+// shut down to flush the spans once the deploy finishes.
+func NewTracerProvider(ctx context.Context, endpoint string) (*sdktrace.TracerProvider, error) {
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil || (endpointURL.Scheme != "http" && endpointURL.Scheme != "https") || endpointURL.Host == "" {
+		return nil, fmt.Errorf("invalid otel endpoint %q: expected an http or https url", endpoint)
+	}
+
+	// a collector address without a path receives traces on the standard
+	// OTLP/HTTP path
+	if strings.Trim(endpointURL.Path, "/") == "" {
+		endpointURL.Path = "/v1/traces"
+	}
+
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpointURL.String()))
+	if err != nil {
+		return nil, fmt.Errorf("error creating trace exporter: %v", err)
+	}
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", "docker-orchestrate"))),
+	), nil
+}
+
+// TraceContextFromEnvironment returns the context carrying the remote span
+// given by the TRACEPARENT and TRACESTATE environment variables, so the spans
+// of a deploy join the trace of the pipeline running it
+func TraceContextFromEnvironment(ctx context.Context) context.Context {
+	return propagation.TraceContext{}.Extract(ctx, propagation.MapCarrier{
+		"traceparent": os.Getenv("TRACEPARENT"),
+		"tracestate":  os.Getenv("TRACESTATE"),
+	})
+}
+
+// startSpan starts a span with the given tracer provider, or when nil, with
+// the provider of the span in the context. Without either, the span is a
+// no-op and costs nothing to record.
+func startSpan(ctx context.Context, provider trace.TracerProvider, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if provider == nil {
+		provider = trace.SpanFromContext(ctx).TracerProvider()
+	}
+	return provider.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan ends a span, marking it failed when err is set
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,153 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/josegonzalez/cli-skeleton/command"
+	"github.com/rs/zerolog"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestDeployProjectSpans(t *testing.T) {
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	replicas := 2
+	project := &types.Project{
+		Services: types.Services{
+			"web": types.ServiceConfig{
+				Name: "web",
+				Deploy: &types.DeployConfig{
+					Replicas: &replicas,
+					UpdateConfig: &types.UpdateConfig{
+						Monitor: types.Duration(time.Millisecond),
+						Order:   "start-first",
+					},
+				},
+			},
+		},
+	}
+
+	// one running container is replaced by the rolling update, and a second
+	// is created by the scale up
+	var mu sync.Mutex
+	containers := []container.Summary{
+		{ID: "old1_container_id", Created: 50, State: container.StateRunning},
+	}
+	mockClient := &mockDockerClient{
+		containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if slices.Contains(options.Filters.Get("status"), "running") {
+				return slices.DeleteFunc(slices.Clone(containers), func(c container.Summary) bool {
+					return c.State != container.StateRunning
+				}), nil
+			}
+			return slices.Clone(containers), nil
+		},
+		containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+			return container.InspectResponse{
+				ContainerJSONBase: &container.ContainerJSONBase{
+					State: &container.State{Running: true},
+				},
+			}, nil
+		},
+		containerStart: func(ctx context.Context, id string, options container.StartOptions) error {
+			mu.Lock()
+			defer mu.Unlock()
+			for i := range containers {
+				if containers[i].ID == id {
+					containers[i].State = container.StateRunning
+				}
+			}
+			return nil
+		},
+		containerTerminate: func(ctx context.Context, id string, stopTimeout time.Duration) error {
+			mu.Lock()
+			defer mu.Unlock()
+			containers = slices.DeleteFunc(containers, func(c container.Summary) bool {
+				return c.ID == id
+			})
+			return nil
+		},
+	}
+
+	mockExecutor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if slices.Contains(input.Args, "create") {
+			containers = append(containers, container.Summary{ID: "new2_container_id", Created: 200, State: container.StateCreated})
+		} else if slices.Contains(input.Args, "--scale") {
+			containers = append(containers, container.Summary{ID: "new1_container_id", Created: 100, State: container.StateRunning})
+		}
+		return ExecCommandResponse{ExitCode: 0}, nil
+	}
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	t.Setenv("TRACEPARENT", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	err := DeployProject(TraceContextFromEnvironment(context.Background()), DeployProjectInput{
+		Client:            mockClient,
+		ComposeFile:       "/tmp/docker-compose.yaml",
+		Executor:          mockExecutor,
+		HealthStartPeriod: time.Second,
+		Logger:            logger,
+		Project:           project,
+		ProjectName:       "test",
+		SkipRename:        true,
+		TracerProvider:    provider,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	spans := recorder.Ended()
+	spanNames := map[trace.SpanID]string{}
+	for _, span := range spans {
+		spanNames[span.SpanContext().SpanID()] = span.Name()
+	}
+
+	// each span is expected under the named parent, with the project span
+	// under the span handed over through the environment
+	parents := []string{}
+	for _, span := range spans {
+		parent, ok := spanNames[span.Parent().SpanID()]
+		if !ok {
+			parent = span.Parent().SpanID().String()
+		}
+		parents = append(parents, span.Name()+" < "+parent)
+
+		if span.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("expected span %s to join the trace from the environment, got trace %s", span.Name(), span.SpanContext().TraceID())
+		}
+	}
+
+	expected := []string{
+		"deploy project < 00f067aa0ba902b7",
+		"deploy service < deploy project",
+		"healthcheck < rolling update",
+		"healthcheck < scale up",
+		"rolling update < deploy service",
+		"scale up < deploy service",
+	}
+	slices.Sort(parents)
+	if !slices.Equal(parents, expected) {
+		t.Errorf("unexpected span hierarchy\nexpected: %v\ngot:      %v", expected, parents)
+	}
+}
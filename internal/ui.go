@@ -0,0 +1,59 @@
+package internal
+
+import (
+	"io"
+	"maps"
+	"os"
+
+	"github.com/josegonzalez/cli-skeleton/command"
+	"github.com/mitchellh/cli"
+	"github.com/rs/zerolog"
+)
+
+// NewHumanUi returns a ui writing human-readable log records to stdout and
+// stderr. Each record is written whole, so records logged by services
+// deploying at the same time never interleave within a line.
+func NewHumanUi(ui cli.Ui) *command.ZerologUi {
+	return newHumanUi(ui, os.Stdout, os.Stderr)
+}
+
+// newHumanUi returns a ui writing synchronized human-readable log records to
+// the given writers
+func newHumanUi(ui cli.Ui, stdout io.Writer, stderr io.Writer) *command.ZerologUi {
+	stdoutWriter := command.NewHumanWriter(func(w *command.HumanWriter) {
+		w.Out = stdout
+	})
+	stderrWriter := command.NewHumanWriter(func(w *command.HumanWriter) {
+		w.Out = stderr
+	})
+	return &command.ZerologUi{
+		StderrLogger:      zerolog.New(zerolog.SyncWriter(stderrWriter)).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(zerolog.SyncWriter(stdoutWriter)).With().Timestamp().Logger(),
+		OriginalFields:    map[string]interface{}{},
+		Ui:                ui,
+		OutputIndentField: true,
+	}
+}
+
+// serviceLogger returns a logger tagging every record with the name of the
+// service being deployed, writing to the same outputs at the same level as
+// the project logger
+func serviceLogger(logger *command.ZerologUi, serviceName string) *command.ZerologUi {
+	if logger == nil {
+		return nil
+	}
+
+	fields := maps.Clone(logger.OriginalFields)
+	if fields == nil {
+		fields = map[string]interface{}{}
+	}
+	fields["service"] = serviceName
+
+	return &command.ZerologUi{
+		StderrLogger:      logger.StderrLogger.With().Str("service", serviceName).Logger(),
+		StdoutLogger:      logger.StdoutLogger.With().Str("service", serviceName).Logger(),
+		OriginalFields:    fields,
+		Ui:                logger.Ui,
+		OutputIndentField: logger.OutputIndentField,
+	}
+}
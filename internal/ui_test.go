@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestServiceLoggerConcurrentOutput(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	logger := newHumanUi(nil, &stdout, &stderr)
+	input := DeployProjectInput{Logger: logger}
+
+	services := []string{"api", "web", "worker"}
+	linesPerService := 200
+
+	var wg sync.WaitGroup
+	for _, serviceName := range services {
+		serviceInput := projectServiceInput(input, serviceName)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range linesPerService {
+				serviceInput.Logger.Info(fmt.Sprintf("Waiting for container to become healthy: %s-%d", serviceName, i))
+			}
+			serviceInput.Logger.Warn(fmt.Sprintf("Deploy of %s is slow", serviceName))
+		}()
+	}
+	wg.Wait()
+
+	ansi := regexp.MustCompile(`\x1b\[[0-9;]*m`)
+	record := regexp.MustCompile(`^ {7}Waiting for container to become healthy: ([a-z]+)-\d+ service=([a-z]+)$`)
+
+	counts := map[string]int{}
+	for _, line := range strings.Split(strings.TrimSuffix(stdout.String(), "\n"), "\n") {
+		matches := record.FindStringSubmatch(ansi.ReplaceAllString(line, ""))
+		if matches == nil {
+			t.Fatalf("expected a whole service-tagged record, got %q", line)
+		}
+		if matches[1] != matches[2] {
+			t.Errorf("expected the record to be tagged with its own service, got %q", line)
+		}
+		counts[matches[2]]++
+	}
+	for _, serviceName := range services {
+		if counts[serviceName] != linesPerService {
+			t.Errorf("expected %d records for %s, got %d", linesPerService, serviceName, counts[serviceName])
+		}
+		if !strings.Contains(ansi.ReplaceAllString(stderr.String(), ""), fmt.Sprintf("Deploy of %s is slow service=%s", serviceName, serviceName)) {
+			t.Errorf("expected the warning of %s to be tagged, got %s", serviceName, stderr.String())
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-units"
+	"github.com/josegonzalez/cli-skeleton/command"
+)
+
+// UpdateServiceResourcesInput is the input for the UpdateServiceResources function
+type UpdateServiceResourcesInput struct {
+	// CPUs is the number of CPUs each container may use, such as 1.5. If 0, the CPU limit is left unchanged.
+	CPUs float64
+	// Client is the Docker client to use
+	Client DockerClientInterface
+	// Logger is the logger to use
+	Logger *command.ZerologUi
+	// Memory is the memory limit of each container in bytes. If 0, the memory limit is left unchanged.
+	Memory int64
+	// ProjectLabel overrides the com.docker.compose.project label value used to discover containers. Defaults to ProjectName.
+	ProjectLabel string
+	// ProjectName is the name of the project
+	ProjectName string
+	// ServiceName is the name of the service
+	ServiceName string
+}
+
+// ParseMemoryFlag parses the value of a memory flag, such as `512m` or `2g`,
+// using the binary units of `docker run --memory`. An empty value is treated
+// as unset and returns 0.
+func ParseMemoryFlag(name string, value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	memory, err := units.RAMInBytes(value)
+	if err != nil || memory < 0 {
+		return 0, fmt.Errorf("invalid %s value %q: expected a size such as 512m or 2g", name, value)
+	}
+
+	return memory, nil
+}
+
+// UpdateServiceResources changes the resource limits of every running
+// container of a service in place, without restarting or recreating them.
+// The compose file is not changed, so the next deploy restores its limits.
+func UpdateServiceResources(ctx context.Context, input UpdateServiceResourcesInput) error {
+	if input.Client == nil {
+		return fmt.Errorf("client is required")
+	}
+
+	if input.ServiceName == "" {
+		return fmt.Errorf("service name is required")
+	}
+
+	if input.CPUs < 0 || math.IsNaN(input.CPUs) || math.IsInf(input.CPUs, 0) {
+		return fmt.Errorf("invalid cpus value %v: must not be negative", input.CPUs)
+	}
+
+	if input.Memory < 0 {
+		return fmt.Errorf("invalid memory value %d: must not be negative", input.Memory)
+	}
+
+	if input.CPUs == 0 && input.Memory == 0 {
+		return fmt.Errorf("at least one resource limit is required")
+	}
+
+	containers, err := composeContainers(ComposeContainersInput{
+		Client:       input.Client,
+		ProjectLabel: input.ProjectLabel,
+		ProjectName:  input.ProjectName,
+		ServiceName:  input.ServiceName,
+		Status:       "running",
+	})
+	if err != nil {
+		return fmt.Errorf("error getting containers: %v", err)
+	}
+
+	if len(containers) == 0 {
+		return fmt.Errorf("no running containers found for service %s", input.ServiceName)
+	}
+
+	resources := container.Resources{
+		Memory:   input.Memory,
+		NanoCPUs: int64(math.Round(input.CPUs * 1e9)),
+	}
+
+	for _, c := range containers {
+		response, err := input.Client.ContainerUpdate(ctx, c.ID, container.UpdateConfig{Resources: resources})
+		if err != nil {
+			return fmt.Errorf("error updating container %s: %v", c.ID[:min(12, len(c.ID))], err)
+		}
+
+		input.Logger.Info(fmt.Sprintf("Updated container resources: container=%s, memory=%s, cpus=%s", c.ID[:min(12, len(c.ID))], resourceValue(input.Memory, units.BytesSize(float64(input.Memory))), resourceValue(input.CPUs, strconv.FormatFloat(input.CPUs, 'f', -1, 64))))
+		for _, warning := range response.Warnings {
+			input.Logger.Warn(fmt.Sprintf("Container update warning: container=%s, warning=%s", c.ID[:min(12, len(c.ID))], warning))
+		}
+	}
+
+	return nil
+}
+
+// resourceValue returns the formatted value of a resource limit, or
+// "unchanged" when the limit is not being set
+func resourceValue[T int64 | float64](value T, formatted string) string {
+	if value == 0 {
+		return "unchanged"
+	}
+	return formatted
+}
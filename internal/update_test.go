@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/josegonzalez/cli-skeleton/command"
+	"github.com/rs/zerolog"
+)
+
+func TestUpdateServiceResources(t *testing.T) {
+	var buf bytes.Buffer
+	logger := &command.ZerologUi{
+		StderrLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		StdoutLogger:      zerolog.New(&buf).With().Timestamp().Logger(),
+		OriginalFields:    nil,
+		Ui:                nil,
+		OutputIndentField: false,
+	}
+
+	// newClient returns a client with two running web containers, recording
+	// the update request sent to each
+	newClient := func(updates map[string]container.UpdateConfig) *mockDockerClient {
+		return &mockDockerClient{
+			containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+				if !slices.Contains(options.Filters.Get("status"), "running") {
+					t.Errorf("expected only running containers to be listed, got filters %v", options.Filters)
+				}
+				if !slices.Contains(options.Filters.Get("label"), "com.docker.compose.service=web") {
+					t.Errorf("expected containers to be filtered to the web service, got filters %v", options.Filters)
+				}
+				return []container.Summary{{ID: "web1_container_id"}, {ID: "web2_container_id"}}, nil
+			},
+			containerUpdate: func(ctx context.Context, id string, updateConfig container.UpdateConfig) (container.UpdateResponse, error) {
+				updates[id] = updateConfig
+				return container.UpdateResponse{Warnings: []string{"swap limit not supported"}}, nil
+			},
+		}
+	}
+
+	t.Run("applies the limits to every container", func(t *testing.T) {
+		memory, err := ParseMemoryFlag("--memory", "512m")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		updates := map[string]container.UpdateConfig{}
+		err = UpdateServiceResources(context.Background(), UpdateServiceResourcesInput{
+			CPUs:        1.5,
+			Client:      newClient(updates),
+			Logger:      logger,
+			Memory:      memory,
+			ProjectName: "test",
+			ServiceName: "web",
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(updates) != 2 {
+			t.Fatalf("expected both containers to be updated, got %v", updates)
+		}
+		for id, update := range updates {
+			if update.Memory != 512*1024*1024 {
+				t.Errorf("expected %s to get a 512m memory limit, got %d", id, update.Memory)
+			}
+			if update.NanoCPUs != 1_500_000_000 {
+				t.Errorf("expected %s to get 1.5 cpus, got %d nano cpus", id, update.NanoCPUs)
+			}
+		}
+		if !strings.Contains(buf.String(), "Container update warning: container=web1_contain, warning=swap limit not supported") {
+			t.Errorf("expected the update warnings to be logged, got %s", buf.String())
+		}
+	})
+
+	t.Run("leaves unset limits unchanged", func(t *testing.T) {
+		updates := map[string]container.UpdateConfig{}
+		err := UpdateServiceResources(context.Background(), UpdateServiceResourcesInput{
+			CPUs:        2,
+			Client:      newClient(updates),
+			Logger:      logger,
+			ProjectName: "test",
+			ServiceName: "web",
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if update := updates["web1_container_id"]; update.Memory != 0 || update.NanoCPUs != 2_000_000_000 {
+			t.Errorf("expected only the cpu limit to be set, got %+v", update.Resources)
+		}
+	})
+
+	t.Run("requires a limit", func(t *testing.T) {
+		err := UpdateServiceResources(context.Background(), UpdateServiceResourcesInput{
+			Client:      newClient(map[string]container.UpdateConfig{}),
+			Logger:      logger,
+			ProjectName: "test",
+			ServiceName: "web",
+		})
+		if err == nil || err.Error() != "at least one resource limit is required" {
+			t.Errorf("expected a missing limit error, got %v", err)
+		}
+	})
+
+	t.Run("invalid memory", func(t *testing.T) {
+		if _, err := ParseMemoryFlag("--memory", "lots"); err == nil {
+			t.Error("expected an invalid memory error")
+		}
+	})
+}
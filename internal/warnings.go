@@ -0,0 +1,79 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/josegonzalez/cli-skeleton/command"
+)
+
+// Warning is a warning raised during a deploy
+type Warning struct {
+	// Message is the warning as it was logged
+	Message string `json:"message"`
+	// Service is the service the warning concerns, if any
+	Service string `json:"service,omitempty"`
+}
+
+// DeployWarnings collects the warnings raised during a deploy, so they can be
+// reported together once it finishes instead of scrolling past in the deploy
+// output. A nil DeployWarnings only logs each warning, so callers do not need
+// to check whether warnings are collected.
+type DeployWarnings struct {
+	// mu guards warnings, as services in a group are deployed concurrently
+	mu sync.Mutex
+	// warnings are the warnings raised so far, in the order they were raised
+	warnings []Warning
+}
+
+// NewDeployWarnings returns an empty warnings collector
+func NewDeployWarnings() *DeployWarnings {
+	return &DeployWarnings{}
+}
+
+// Warn logs a warning concerning the service, or the whole deploy when the
+// service is empty, and records it
+func (w *DeployWarnings) Warn(logger *command.ZerologUi, serviceName string, message string) {
+	if logger != nil {
+		logger.Warn(message)
+	}
+	if w == nil {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.warnings = append(w.warnings, Warning{Message: message, Service: serviceName})
+}
+
+// Warnings returns the recorded warnings, in the order they were raised
+func (w *DeployWarnings) Warnings() []Warning {
+	if w == nil {
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]Warning(nil), w.warnings...)
+}
+
+// Report renders the recorded warnings as a single section, or an empty
+// string when there are none
+func (w *DeployWarnings) Report() string {
+	warnings := w.Warnings()
+	if len(warnings) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Warnings (%d):", len(warnings))
+	for _, warning := range warnings {
+		if warning.Service == "" {
+			fmt.Fprintf(&b, "\n  - %s", warning.Message)
+			continue
+		}
+		fmt.Fprintf(&b, "\n  - %s: %s", warning.Service, warning.Message)
+	}
+	return b.String()
+}
@@ -0,0 +1,201 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/josegonzalez/cli-skeleton/command"
+	"github.com/rs/zerolog"
+)
+
+func TestDeployWarnings(t *testing.T) {
+	t.Run("deploy warnings are collected and reported together", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := &command.ZerologUi{
+			StderrLogger: zerolog.New(&buf),
+			StdoutLogger: zerolog.New(&buf),
+		}
+
+		replicas := 2
+		scale := 3
+		project := &types.Project{
+			Services: types.Services{
+				"web": types.ServiceConfig{
+					Name:  "web",
+					Image: "nginx:1.27",
+					Deploy: &types.DeployConfig{
+						Replicas: &replicas,
+						UpdateConfig: &types.UpdateConfig{
+							Monitor: types.Duration(time.Millisecond),
+						},
+					},
+					ExtraHosts: types.HostsList{"db": []string{"not-an-ip"}},
+					Restart:    types.RestartPolicyNo,
+					Scale:      &scale,
+				},
+			},
+		}
+
+		containers := []container.Summary{}
+		mockClient := &mockDockerClient{
+			containerList: func(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+				return slices.Clone(containers), nil
+			},
+			containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+				return container.InspectResponse{
+					ContainerJSONBase: &container.ContainerJSONBase{
+						State: &container.State{Running: true},
+					},
+				}, nil
+			},
+			containerRename: func(ctx context.Context, id string, newName string) error {
+				return nil
+			},
+		}
+		mockExecutor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+			if slices.Contains(input.Args, "--scale") && len(containers) == 0 {
+				containers = append(containers,
+					container.Summary{ID: "new1_container_id", Created: 100, Image: "nginx:1.27", State: container.StateRunning},
+					container.Summary{ID: "new2_container_id", Created: 110, Image: "nginx:1.27", State: container.StateRunning},
+				)
+			}
+			return ExecCommandResponse{ExitCode: 0}, nil
+		}
+
+		warnings := NewDeployWarnings()
+		err := DeployService(context.Background(), DeployServiceInput{
+			Client:                mockClient,
+			ComposeFile:           "/tmp/docker-compose.yaml",
+			ContainerNameTemplate: "{{.ProjectName}}-{{.ServiceName}}-{{.InstanceID}}",
+			Executor:              mockExecutor,
+			HealthStartPeriod:     time.Second,
+			Logger:                logger,
+			Project:               project,
+			ProjectName:           "test",
+			ServiceName:           "web",
+			Warnings:              warnings,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected := []string{
+			"Invalid extra_hosts entry: service=web, entry=db:not-an-ip",
+			"Conflicting replica counts, using deploy.replicas: service=web, deploy.replicas=2, scale=3",
+			"Service does not restart but is deployed for replicas",
+		}
+		collected := warnings.Warnings()
+		if len(collected) != len(expected) {
+			t.Fatalf("expected %d warnings, got %+v", len(expected), collected)
+		}
+		for i, message := range expected {
+			if collected[i].Service != "web" || !strings.HasPrefix(collected[i].Message, message) {
+				t.Errorf("expected warning %d to be %q for web, got %+v", i, message, collected[i])
+			}
+			if !strings.Contains(buf.String(), message) {
+				t.Errorf("expected warning %q to still be logged as it was raised, got %s", message, buf.String())
+			}
+		}
+
+		report := warnings.Report()
+		if !strings.HasPrefix(report, "Warnings (3):") {
+			t.Errorf("expected the report to count the warnings, got %q", report)
+		}
+		for _, message := range expected {
+			if !strings.Contains(report, "- web: "+message) {
+				t.Errorf("expected the report to contain %q, got %q", message, report)
+			}
+		}
+	})
+
+	t.Run("nil collector only logs", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := &command.ZerologUi{
+			StderrLogger: zerolog.New(&buf),
+			StdoutLogger: zerolog.New(&buf),
+		}
+
+		var warnings *DeployWarnings
+		warnings.Warn(logger, "web", "Something looks off: service=web")
+		if !strings.Contains(buf.String(), "Something looks off: service=web") {
+			t.Errorf("expected the warning to be logged, got %s", buf.String())
+		}
+		if len(warnings.Warnings()) != 0 || warnings.Report() != "" {
+			t.Errorf("expected nothing to be collected, got %+v", warnings.Warnings())
+		}
+	})
+
+	t.Run("hook failures are collected", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := &command.ZerologUi{
+			StderrLogger: zerolog.New(&buf),
+			StdoutLogger: zerolog.New(&buf),
+		}
+
+		mockClient := &mockDockerClient{
+			containerExec: func(ctx context.Context, id string, options ContainerExecOptions) (int, error) {
+				return 3, nil
+			},
+			containerInspect: func(ctx context.Context, id string) (container.InspectResponse, error) {
+				return container.InspectResponse{
+					NetworkSettings: &container.NetworkSettings{
+						Networks: map[string]*network.EndpointSettings{"bridge": {IPAddress: "172.17.0.2"}},
+					},
+				}, nil
+			},
+		}
+		mockExecutor := func(ctx context.Context, input ExecCommandInput) (ExecCommandResponse, error) {
+			return ExecCommandResponse{ExitCode: 1}, fmt.Errorf("exit status 1")
+		}
+
+		warnings := NewDeployWarnings()
+		runHostHook(context.Background(), logger, runScriptInput{
+			Client:      mockClient,
+			ContainerID: "new_container_id",
+			Executor:    mockExecutor,
+			ServiceName: "web",
+			Script:      "notify {{.ContainerIP}}",
+			ScriptType:  "on-healthy",
+			Warnings:    warnings,
+		})
+		runPreStopHooks(context.Background(), PreStopHooksInput{
+			Client:      mockClient,
+			Command:     "drain",
+			ContainerID: "old_container_id",
+			Executor:    mockExecutor,
+			Logger:      logger,
+			ServiceName: "web",
+			Warnings:    warnings,
+		})
+
+		expected := []string{
+			"Host command failed: type=on-healthy, service=web",
+			"Pre-stop command failed: service=web, container=old_containe, error=exit code 3",
+		}
+		collected := warnings.Warnings()
+		if len(collected) != len(expected) {
+			t.Fatalf("expected %d warnings, got %+v", len(expected), collected)
+		}
+		for i, message := range expected {
+			if collected[i].Service != "web" || !strings.HasPrefix(collected[i].Message, message) {
+				t.Errorf("expected warning %d to be %q for web, got %+v", i, message, collected[i])
+			}
+		}
+	})
+
+	t.Run("project warnings are reported without a service", func(t *testing.T) {
+		warnings := NewDeployWarnings()
+		warnings.Warn(nil, "", "Unable to tear down deploy: deploy_id=abc")
+		if report := warnings.Report(); report != "Warnings (1):\n  - Unable to tear down deploy: deploy_id=abc" {
+			t.Errorf("unexpected report %q", report)
+		}
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 
 	"github.com/dokku/docker-orchestrate/commands"
+	"github.com/dokku/docker-orchestrate/pkg/orchestrate"
 
 	"github.com/josegonzalez/cli-skeleton/command"
 	"github.com/mitchellh/cli"
@@ -25,12 +26,23 @@ func main() {
 func Run(args []string) int {
 	ctx := context.Background()
 	commandMeta := command.SetupRun(ctx, AppName, Version, args)
-	commandMeta.Ui = command.HumanZerologUiWithFields(commandMeta.Ui, make(map[string]interface{}, 0))
+	commandMeta.Ui = orchestrate.NewHumanUi(commandMeta.Ui)
 	cliArgs := os.Args[1:]
 	if len(os.Args) > 2 && os.Args[1] == "orchestrate" {
 		cliArgs = os.Args[2:]
 	}
 
+	// script directories of runs that were killed are never removed by
+	// those runs, so they are swept here instead
+	if _, err := orchestrate.SweepStaleScriptDirs(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", err.Error())
+	}
+	defer func() {
+		if err := orchestrate.RemoveScriptDir(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", err.Error())
+		}
+	}()
+
 	c := cli.NewCLI(AppName, Version)
 	c.Args = cliArgs
 	c.Commands = command.Commands(ctx, commandMeta, Commands)
@@ -53,6 +65,33 @@ func Commands(ctx context.Context, meta command.Meta) map[string]cli.CommandFact
 		"docker-cli-plugin-metadata": func() (cli.Command, error) {
 			return &commands.DockerCliPluginMetadataCommand{Meta: meta, Version: Version}, nil
 		},
+		"exec": func() (cli.Command, error) {
+			return &commands.ExecCommand{Meta: meta}, nil
+		},
+		"history": func() (cli.Command, error) {
+			return &commands.HistoryCommand{Meta: meta}, nil
+		},
+		"logs": func() (cli.Command, error) {
+			return &commands.LogsCommand{Meta: meta}, nil
+		},
+		"ps": func() (cli.Command, error) {
+			return &commands.PsCommand{Meta: meta}, nil
+		},
+		"rollback": func() (cli.Command, error) {
+			return &commands.RollbackCommand{Meta: meta}, nil
+		},
+		"state": func() (cli.Command, error) {
+			return &commands.StateCommand{Meta: meta}, nil
+		},
+		"status": func() (cli.Command, error) {
+			return &commands.StatusCommand{Meta: meta}, nil
+		},
+		"stop": func() (cli.Command, error) {
+			return &commands.StopCommand{Meta: meta}, nil
+		},
+		"update": func() (cli.Command, error) {
+			return &commands.UpdateCommand{Meta: meta}, nil
+		},
 		"version": func() (cli.Command, error) {
 			return &command.VersionCommand{Meta: meta}, nil
 		},
@@ -0,0 +1,60 @@
+package orchestrate_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/dokku/docker-orchestrate/pkg/orchestrate"
+	"github.com/josegonzalez/cli-skeleton/command"
+	"github.com/rs/zerolog"
+)
+
+type exampleClient struct {
+	orchestrate.Client
+}
+
+func (c *exampleClient) ContainerList(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+	return []container.Summary{}, nil
+}
+
+func ExampleDeployService() {
+	logger := &command.ZerologUi{
+		StderrLogger: zerolog.New(io.Discard),
+		StdoutLogger: zerolog.New(io.Discard),
+	}
+
+	executor := func(ctx context.Context, input orchestrate.ExecCommandInput) (orchestrate.ExecCommandResponse, error) {
+		return orchestrate.ExecCommandResponse{ExitCode: 0}, nil
+	}
+
+	project := &types.Project{
+		Name: "example",
+		Services: types.Services{
+			"web": types.ServiceConfig{
+				Name:  "web",
+				Image: "nginx:alpine",
+			},
+		},
+	}
+
+	err := orchestrate.DeployService(context.Background(), orchestrate.DeployServiceInput{
+		Client:                &exampleClient{},
+		ComposeFile:           "/tmp/docker-compose.yaml",
+		ContainerNameTemplate: orchestrate.DefaultContainerNameTemplate,
+		Executor:              executor,
+		Logger:                logger,
+		Project:               project,
+		ProjectName:           "example",
+		ServiceName:           "web",
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Println("deployed web")
+	// Output: deployed web
+}
@@ -0,0 +1,399 @@
+// Package orchestrate exposes the docker-orchestrate deploy machinery as a Go
+// library so that it can be driven programmatically without shelling out to
+// the CLI.
+package orchestrate
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/dokku/docker-orchestrate/internal"
+	"github.com/josegonzalez/cli-skeleton/command"
+	"github.com/mitchellh/cli"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Client is the Docker client used to inspect and manage containers
+type Client = internal.DockerClientInterface
+
+// CommandExecutor is a function that executes a command on the host
+type CommandExecutor = internal.CommandExecutor
+
+// ExecCommandInput is the input passed to a CommandExecutor
+type ExecCommandInput = internal.ExecCommandInput
+
+// ExecCommandResponse is the response returned by a CommandExecutor
+type ExecCommandResponse = internal.ExecCommandResponse
+
+// DeployProjectInput is the input for the DeployProject function
+type DeployProjectInput = internal.DeployProjectInput
+
+// DeployServiceInput is the input for the DeployService function
+type DeployServiceInput = internal.DeployServiceInput
+
+// DeployServiceResult is the outcome of deploying a single service, passed to DeployProjectInput.OnServiceComplete
+type DeployServiceResult = internal.DeployServiceResult
+
+// DeployProjectResult is the outcome of each service of a project deploy, returned by DeployProjectWithResult
+type DeployProjectResult = internal.DeployProjectResult
+
+// ServiceSummary is the outcome and duration of a single service in a DeployProjectResult
+type ServiceSummary = internal.ServiceSummary
+
+// ExecServiceInput is the input for the ExecService function
+type ExecServiceInput = internal.ExecServiceInput
+
+// ListContainersInput is the input for the ListContainers function
+type ListContainersInput = internal.ListContainersInput
+
+// ServiceLogsInput is the input for the ServiceLogs function
+type ServiceLogsInput = internal.ServiceLogsInput
+
+// ContainerLog is the log output of a container
+type ContainerLog = internal.ContainerLog
+
+// UpdateServiceResourcesInput is the input for the UpdateServiceResources function
+type UpdateServiceResourcesInput = internal.UpdateServiceResourcesInput
+
+// StopOldContainersInput is the input for the StopOldContainers function
+type StopOldContainersInput = internal.StopOldContainersInput
+
+// RollbackServiceInput is the input for the RollbackService function
+type RollbackServiceInput = internal.RollbackServiceInput
+
+// PortMapping is a container port published on a host port, reported in DeployServiceResult
+type PortMapping = internal.PortMapping
+
+// Event is a structured record of a deploy phase
+type Event = internal.Event
+
+// EventEmitter writes deploy events as JSON lines
+type EventEmitter = internal.EventEmitter
+
+// DeployMetrics are the Prometheus metrics of a deploy
+type DeployMetrics = internal.DeployMetrics
+
+// DeployWarnings collects the warnings raised during a deploy
+type DeployWarnings = internal.DeployWarnings
+
+// Warning is a warning raised during a deploy
+type Warning = internal.Warning
+
+// ParallelismBudget bounds the containers updated at once across the services of a deploy
+type ParallelismBudget = internal.ParallelismBudget
+
+// FlagRule declares how a flag relates to other flags and to the service name argument
+type FlagRule = internal.FlagRule
+
+// DeployHistory is an append-only store of successful service deploys
+type DeployHistory = internal.DeployHistory
+
+// HistoryRecord is a single successful service deploy
+type HistoryRecord = internal.HistoryRecord
+
+// DeployLock is a held per-project deploy lock
+type DeployLock = internal.DeployLock
+
+// DeployLockHolder describes the deploy holding the lock of a project
+type DeployLockHolder = internal.DeployLockHolder
+
+// DeployLockedError is returned when a project is already being deployed
+type DeployLockedError = internal.DeployLockedError
+
+// ValidateFlagsInput is the input for the ValidateFlags function
+type ValidateFlagsInput = internal.ValidateFlagsInput
+
+// TracerProvider creates the spans traced for a deploy
+type TracerProvider = trace.TracerProvider
+
+// Project is a loaded compose project
+type Project = types.Project
+
+// ServiceDiff is the difference between the running containers of a service and the state a deploy would bring it to
+type ServiceDiff = internal.ServiceDiff
+
+// ApplyFlagConfigInput is the input for the ApplyFlagConfig function
+type ApplyFlagConfigInput = internal.ApplyFlagConfigInput
+
+// ImageProjectInput is the input for the ImageProject function
+type ImageProjectInput = internal.ImageProjectInput
+
+// ProjectCache caches loaded compose projects until their files or the environment change
+type ProjectCache = internal.ProjectCache
+
+// WaitForImagesInput is the input for the WaitForImages function
+type WaitForImagesInput = internal.WaitForImagesInput
+
+// FlagConfigFile is the name of the file in the project directory providing default flag values
+const FlagConfigFile = internal.FlagConfigFile
+
+// DefaultContainerNameTemplate is the container name template used by the CLI
+const DefaultContainerNameTemplate = "{{.ProjectName}}-{{.ServiceName}}-{{.InstanceID}}"
+
+// CanaryLabel is the label stamped on canary containers deployed alongside the existing containers of a service
+const CanaryLabel = internal.CanaryLabel
+
+// OutcomeOK is the outcome of a service that deployed successfully
+const OutcomeOK = internal.OutcomeOK
+
+// OutcomeFailed is the outcome of a service whose deploy failed
+const OutcomeFailed = internal.OutcomeFailed
+
+// OutcomeTimedOut is the outcome of a service whose deploy ran out of time
+const OutcomeTimedOut = internal.OutcomeTimedOut
+
+// OutcomeSkipped is the outcome of a service that was skipped rather than deployed
+const OutcomeSkipped = internal.OutcomeSkipped
+
+// OutcomeNotStarted is the outcome of a service the deploy ran out of time before reaching
+const OutcomeNotStarted = internal.OutcomeNotStarted
+
+// DeployIDLabel is the label identifying the deploy that created a container
+const DeployIDLabel = internal.DeployIDLabel
+
+// RevisionLabel is the label identifying the source revision a container was deployed from
+const RevisionLabel = internal.RevisionLabel
+
+// GenerationLabel is the label stamped on new containers when old containers are kept running
+const GenerationLabel = internal.GenerationLabel
+
+// NewEventEmitter returns an emitter writing deploy events as JSON lines to the writer
+func NewEventEmitter(w io.Writer) *EventEmitter {
+	return internal.NewEventEmitter(w)
+}
+
+// NewDeployMetrics returns the Prometheus metrics of a deploy, registered with a registry of their own
+func NewDeployMetrics() *DeployMetrics {
+	return internal.NewDeployMetrics()
+}
+
+// NewDeployWarnings returns an empty collector for the warnings of a deploy
+func NewDeployWarnings() *DeployWarnings {
+	return internal.NewDeployWarnings()
+}
+
+// NewParallelismBudget returns a budget of size containers shared by the services of a deploy
+func NewParallelismBudget(size int) *ParallelismBudget {
+	return internal.NewParallelismBudget(size)
+}
+
+// ServeMetrics serves the metrics on the given address at /metrics until the returned server is shut down
+func ServeMetrics(addr string, metrics *DeployMetrics) (*http.Server, error) {
+	return internal.ServeMetrics(addr, metrics)
+}
+
+// NewClient returns a new Docker client configured from the environment
+func NewClient() (Client, error) {
+	return internal.NewDockerClient()
+}
+
+// ComposeFile returns the absolute path to the compose file in the current directory
+func ComposeFile() (string, error) {
+	return internal.ComposeFile()
+}
+
+// ComposeFiles returns the absolute paths to the compose file in the current
+// directory followed by its docker-compose.override file, if present
+func ComposeFiles() ([]string, error) {
+	return internal.ComposeFiles()
+}
+
+// LoadProject loads the compose project from the specified file with the given profiles enabled
+func LoadProject(projectName string, filename string, profiles []string) (*types.Project, error) {
+	return internal.ComposeProject(projectName, filename, profiles)
+}
+
+// LoadProjectFiles loads the compose project merged from the specified files with the given profiles enabled
+func LoadProjectFiles(projectName string, filenames []string, profiles []string) (*types.Project, error) {
+	return internal.ComposeProjectFiles(projectName, filenames, profiles)
+}
+
+// DumpComposeConfig writes the fully-resolved compose project as YAML to the specified path
+func DumpComposeConfig(project *types.Project, path string) error {
+	return internal.DumpComposeConfig(project, path)
+}
+
+// ImageProject synthesizes a project of a single service running an image, for deploying without a compose file
+func ImageProject(input ImageProjectInput) (*types.Project, error) {
+	return internal.ImageProject(input)
+}
+
+// WriteImageComposeFile writes a synthesized project to a temporary compose file, returning its path and a function removing it
+func WriteImageComposeFile(project *types.Project) (string, func(), error) {
+	return internal.WriteImageComposeFile(project)
+}
+
+// RemoveScriptDir removes the temporary directory the host scripts of the current run are written to
+func RemoveScriptDir() error {
+	return internal.RemoveScriptDir()
+}
+
+// SweepStaleScriptDirs removes the script directories left behind by earlier runs that were killed before cleaning up
+func SweepStaleScriptDirs() ([]string, error) {
+	return internal.SweepStaleScriptDirs()
+}
+
+// ParseReplicasDelta parses a relative replica count, such as `+2` or `-1`
+func ParseReplicasDelta(value string) (int, error) {
+	return internal.ParseReplicasDelta(value)
+}
+
+// WaitForImages blocks until every image is available in its registry
+func WaitForImages(ctx context.Context, input WaitForImagesInput) error {
+	return internal.WaitForImages(ctx, input)
+}
+
+// ParseDurationFlag parses the value of a duration flag, such as `30s` or `5m`, returning 0 for an empty value
+func ParseDurationFlag(name string, value string) (time.Duration, error) {
+	return internal.ParseDurationFlag(name, value)
+}
+
+// NewProjectCache creates an empty cache of loaded compose projects, for processes loading the same project repeatedly
+func NewProjectCache() *ProjectCache {
+	return internal.NewProjectCache()
+}
+
+// NewDeployHistory creates a deploy history stored at the given path
+func NewDeployHistory(path string) *DeployHistory {
+	return internal.NewDeployHistory(path)
+}
+
+// HistoryFile returns the path of the deploy history file for a project directory
+func HistoryFile(projectDir string) string {
+	return internal.HistoryFile(projectDir)
+}
+
+// LockFile returns the path of the deploy lock file of a project
+func LockFile(projectDir string, projectName string) string {
+	return internal.LockFile(projectDir, projectName)
+}
+
+// NewDeployLockHolder describes the current process as the holder of the lock of a project
+func NewDeployLockHolder(projectName string, args []string) DeployLockHolder {
+	return internal.NewDeployLockHolder(projectName, args)
+}
+
+// AcquireDeployLock creates the lock file at path, returning a DeployLockedError if another deploy holds it
+func AcquireDeployLock(path string, holder DeployLockHolder) (*DeployLock, error) {
+	return internal.AcquireDeployLock(path, holder)
+}
+
+// ReadDeployLock returns the holder recorded in the lock file at path, and whether the file exists
+func ReadDeployLock(path string) (DeployLockHolder, bool, error) {
+	return internal.ReadDeployLock(path)
+}
+
+// PurgeState removes the local state a project keeps in its project directory
+func PurgeState(projectDir string, projectName string) (int, error) {
+	return internal.PurgeState(projectDir, projectName)
+}
+
+// RevisionFromEnvironment returns the source revision set in GIT_SHA or SOURCE_COMMIT
+func RevisionFromEnvironment() string {
+	return internal.RevisionFromEnvironment()
+}
+
+// NewHumanUi returns a ui writing human-readable log records to stdout and stderr, one whole record at a time
+func NewHumanUi(ui cli.Ui) *command.ZerologUi {
+	return internal.NewHumanUi(ui)
+}
+
+// NewDeployID returns a unique, time-ordered ID for a deploy
+func NewDeployID() string {
+	return internal.NewDeployID()
+}
+
+// ParseSizeFlag parses the value of a size flag, such as `500MB` or `5GB`, returning 0 for an empty value
+func ParseSizeFlag(name string, value string) (int64, error) {
+	return internal.ParseSizeFlag(name, value)
+}
+
+// ValidateFlags checks the set flags against the declared rules, returning a single error listing every violated rule
+func ValidateFlags(input ValidateFlagsInput) error {
+	return internal.ValidateFlags(input)
+}
+
+// NewTracerProvider returns a tracer provider exporting spans over OTLP/HTTP to the given endpoint, which must be shut down to flush the spans
+func NewTracerProvider(ctx context.Context, endpoint string) (*sdktrace.TracerProvider, error) {
+	return internal.NewTracerProvider(ctx, endpoint)
+}
+
+// TraceContextFromEnvironment returns the context carrying the remote span given by the TRACEPARENT and TRACESTATE environment variables
+func TraceContextFromEnvironment(ctx context.Context) context.Context {
+	return internal.TraceContextFromEnvironment(ctx)
+}
+
+// LoadFlagConfig reads a YAML file mapping flag names to default values
+func LoadFlagConfig(path string) (map[string][]string, error) {
+	return internal.LoadFlagConfig(path)
+}
+
+// ApplyFlagConfig sets each flag in the config that was not explicitly set on the command line
+func ApplyFlagConfig(input ApplyFlagConfigInput) error {
+	return internal.ApplyFlagConfig(input)
+}
+
+// DeployProject deploys every service in an already-loaded project
+func DeployProject(ctx context.Context, input DeployProjectInput) error {
+	return internal.DeployProject(ctx, input)
+}
+
+// DeployProjectWithResult deploys every service in an already-loaded project, returning the outcome of each service
+func DeployProjectWithResult(ctx context.Context, input DeployProjectInput) (DeployProjectResult, error) {
+	return internal.DeployProjectWithResult(ctx, input)
+}
+
+// DiffProject returns the diff of each service a project deploy would deploy, without changing anything
+func DiffProject(ctx context.Context, input DeployProjectInput) ([]ServiceDiff, error) {
+	return internal.DiffProject(ctx, input)
+}
+
+// DiffService returns the diff between the running containers of a service and the state a deploy would bring it to
+func DiffService(ctx context.Context, input DeployServiceInput) (ServiceDiff, error) {
+	return internal.DiffService(ctx, input)
+}
+
+// DeployService deploys a single service from an already-loaded project
+func DeployService(ctx context.Context, input DeployServiceInput) error {
+	return internal.DeployService(ctx, input)
+}
+
+// ExecService runs a command inside a running container of a service, returning the exit code of the command
+func ExecService(ctx context.Context, input ExecServiceInput) (int, error) {
+	return internal.ExecService(ctx, input)
+}
+
+// ListContainers returns the containers of a project or service, running or not, oldest first
+func ListContainers(ctx context.Context, input ListContainersInput) ([]container.Summary, error) {
+	return internal.ListContainers(ctx, input)
+}
+
+// ServiceLogs returns the logs of the containers of a project or service, oldest container first
+func ServiceLogs(ctx context.Context, input ServiceLogsInput) ([]ContainerLog, error) {
+	return internal.ServiceLogs(ctx, input)
+}
+
+// ParseMemoryFlag parses the value of a memory flag, such as `512m` or `2g`, returning 0 for an empty value
+func ParseMemoryFlag(name string, value string) (int64, error) {
+	return internal.ParseMemoryFlag(name, value)
+}
+
+// UpdateServiceResources changes the resource limits of every running container of a service in place
+func UpdateServiceResources(ctx context.Context, input UpdateServiceResourcesInput) error {
+	return internal.UpdateServiceResources(ctx, input)
+}
+
+// StopOldContainers stops the running containers of a service that are not of its newest generation
+func StopOldContainers(ctx context.Context, input StopOldContainersInput) error {
+	return internal.StopOldContainers(ctx, input)
+}
+
+// RollbackService re-deploys a service with the image and replica count recorded for a past deploy
+func RollbackService(ctx context.Context, input RollbackServiceInput) error {
+	return internal.RollbackService(ctx, input)
+}